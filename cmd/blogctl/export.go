@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+)
+
+// exportManifest is manifest.json at the root of an export archive. Each item's content
+// is in a file of its own, named by the item's Content field.
+type exportManifest struct {
+	UserID     string             `json:"userId"`
+	ExportedAt time.Time          `json:"exportedAt"`
+	Posts      []exportedPost     `json:"posts"`
+	CodeFiles  []exportedCodeFile `json:"codeFiles"`
+}
+
+type exportedPost struct {
+	models.Post
+	ContentVersion int    `json:"contentVersion"`
+	Content        string `json:"content"` // Path in the archive
+}
+
+type exportedCodeFile struct {
+	models.CodeFile
+	ContentVersion int    `json:"contentVersion"`
+	Content        string `json:"content"` // Path in the archive
+}
+
+// runExport writes all of a user's live items, archived ones included, with their
+// current content to a .tar.gz archive.
+func runExport(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	userID := flags.String("user", "", "User whose items to export")
+	out := flags.String("out", "", "Archive to write, or - for stdout (default <user>-export.tar.gz)")
+	tenantID := flags.String("tenant", "", "Tenant of the user (required with multi-tenancy)")
+	flags.Parse(args)
+	if *userID == "" {
+		fmt.Fprint(os.Stderr, "-user is required\n")
+		return 2
+	}
+	if *out == "" {
+		*out = *userID + "-export.tar.gz"
+	}
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Failed to create archive", "path", *out, "error", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	start := time.Now()
+	manifest, err := exportUser(ctx, appService, *userID, w)
+	if err != nil {
+		slog.Error("Export failed", "userID", *userID, "error", err)
+		if *out != "-" {
+			os.Remove(*out) // Don't leave a truncated archive behind
+		}
+		return 1
+	}
+	slog.Info("Exported items", "userID", *userID, "path", *out, "posts", len(manifest.Posts), "codeFiles", len(manifest.CodeFiles), "duration", time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// exportUser writes the archive to w and returns its manifest.
+func exportUser(ctx context.Context, appService *service.Service, userID string, w io.Writer) (*exportManifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &exportManifest{UserID: userID, ExportedAt: time.Now().UTC(), Posts: []exportedPost{}, CodeFiles: []exportedCodeFile{}}
+
+	for offset := 0; ; offset += listPageSize {
+		posts, err := appService.ListUserPosts(ctx, userID, listPageSize, offset, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list posts: %w", err)
+		}
+		for _, post := range posts {
+			name := path.Join("posts", post.ID+".md")
+			version, err := exportContent(ctx, appService, tw, userID, post.ID, models.ItemTypePost, name, post.UpdatedAt)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Posts = append(manifest.Posts, exportedPost{Post: post, ContentVersion: version, Content: name})
+		}
+		if len(posts) < listPageSize {
+			break
+		}
+	}
+	for offset := 0; ; offset += listPageSize {
+		files, err := appService.ListUserCodeFiles(ctx, userID, listPageSize, offset, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list code files: %w", err)
+		}
+		for _, file := range files {
+			name := path.Join("codefiles", file.ID, file.FileName)
+			version, err := exportContent(ctx, appService, tw, userID, file.ID, models.ItemTypeCodeFile, name, file.UpdatedAt)
+			if err != nil {
+				return nil, err
+			}
+			manifest.CodeFiles = append(manifest.CodeFiles, exportedCodeFile{CodeFile: file, ContentVersion: version, Content: name})
+		}
+		if len(files) < listPageSize {
+			break
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeTarFile(tw, "manifest.json", data, manifest.ExportedAt); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// exportContent adds an item's current content to the archive as name and returns its
+// version.
+func exportContent(ctx context.Context, appService *service.Service, tw *tar.Writer, userID, itemID string, itemType models.ItemType, name string, modTime time.Time) (int, error) {
+	content, version, err := appService.GetItemContent(ctx, userID, itemID, string(itemType))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read content of %s %s: %w", itemType, itemID, err)
+	}
+	if err := writeTarFile(tw, name, []byte(content), modTime); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// listPageSize is how many items are read at a time when listing all of a user's items.
+const listPageSize = 100
+
+// itemSummary is one line of items list.
+type itemSummary struct {
+	Type       models.ItemType `json:"type"`
+	ID         string          `json:"id"`
+	Name       string          `json:"name"` // Title of a post, path of a code file
+	Size       int64           `json:"size"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	ArchivedAt *time.Time      `json:"archivedAt,omitempty"`
+}
+
+// runItems lists a user's items or moves an item to the trash.
+func runItems(ctx context.Context, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, "Usage: blogctl items list|delete [flags]\n")
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return runItemsList(ctx, args[1:])
+	case "delete":
+		return runItemsDelete(ctx, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown items command %q (want list or delete)\n", args[0])
+		return 2
+	}
+}
+
+func runItemsList(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("items list", flag.ExitOnError)
+	userID := flags.String("user", "", "User whose items to list")
+	itemType := flags.String("type", "", "List only items of this type: post or codefile (default: both)")
+	archived := flags.Bool("archived", false, "Include archived items")
+	asJSON := flags.Bool("json", false, "Print the items as JSON")
+	tenantID := flags.String("tenant", "", "Tenant of the user (required with multi-tenancy)")
+	flags.Parse(args)
+	if *userID == "" {
+		fmt.Fprint(os.Stderr, "-user is required\n")
+		return 2
+	}
+	if *itemType != "" && *itemType != string(models.ItemTypePost) && *itemType != string(models.ItemTypeCodeFile) {
+		fmt.Fprintf(os.Stderr, "Unknown item type %q (want post or codefile)\n", *itemType)
+		return 2
+	}
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	items, err := listItems(ctx, appService, *userID, models.ItemType(*itemType), *archived)
+	if err != nil {
+		slog.Error("Failed to list items", "userID", *userID, "error", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(items); err != nil {
+			slog.Error("Failed to write items", "error", err)
+			return 1
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tID\tNAME\tSIZE\tUPDATED\tARCHIVED")
+	for _, item := range items {
+		archivedAt := ""
+		if item.ArchivedAt != nil {
+			archivedAt = item.ArchivedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", item.Type, item.ID, item.Name, item.Size, item.UpdatedAt.Format(time.RFC3339), archivedAt)
+	}
+	w.Flush()
+	return 0
+}
+
+// listItems returns all of a user's live items of itemType, or of both types if it's
+// empty, posts first.
+func listItems(ctx context.Context, appService *service.Service, userID string, itemType models.ItemType, includeArchived bool) ([]itemSummary, error) {
+	var items []itemSummary
+	if itemType == "" || itemType == models.ItemTypePost {
+		for offset := 0; ; offset += listPageSize {
+			posts, err := appService.ListUserPosts(ctx, userID, listPageSize, offset, includeArchived)
+			if err != nil {
+				return nil, err
+			}
+			for _, post := range posts {
+				items = append(items, itemSummary{Type: models.ItemTypePost, ID: post.ID, Name: post.Title, Size: post.Size, UpdatedAt: post.UpdatedAt, ArchivedAt: post.ArchivedAt})
+			}
+			if len(posts) < listPageSize {
+				break
+			}
+		}
+	}
+	if itemType == "" || itemType == models.ItemTypeCodeFile {
+		for offset := 0; ; offset += listPageSize {
+			files, err := appService.ListUserCodeFiles(ctx, userID, listPageSize, offset, includeArchived)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				items = append(items, itemSummary{Type: models.ItemTypeCodeFile, ID: file.ID, Name: file.Path, Size: file.Size, UpdatedAt: file.UpdatedAt, ArchivedAt: file.ArchivedAt})
+			}
+			if len(files) < listPageSize {
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+// runItemsDelete moves an item to the trash on behalf of its owner, from where the owner
+// can still restore it until it's purged.
+func runItemsDelete(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("items delete", flag.ExitOnError)
+	itemID := flags.String("id", "", "ID of the item to delete")
+	itemType := flags.String("type", "", "Type of the item: post or codefile")
+	tenantID := flags.String("tenant", "", "Tenant of the item (required with multi-tenancy)")
+	flags.Parse(args)
+	if *itemID == "" || *itemType == "" {
+		fmt.Fprint(os.Stderr, "-id and -type are required\n")
+		return 2
+	}
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	ownerID, err := itemOwner(ctx, appService, *itemID, models.ItemType(*itemType))
+	if err != nil {
+		slog.Error("Failed to find item", "itemID", *itemID, "itemType", *itemType, "error", err)
+		return 1
+	}
+	if err := appService.DeleteItem(ctx, ownerID, *itemID, *itemType); err != nil {
+		slog.Error("Failed to delete item", "itemID", *itemID, "itemType", *itemType, "error", err)
+		return 1
+	}
+	slog.Info("Moved item to the trash", "itemID", *itemID, "itemType", *itemType, "userID", ownerID)
+	return 0
+}
+
+// itemOwner returns the ID of the user who owns an item.
+func itemOwner(ctx context.Context, appService *service.Service, itemID string, itemType models.ItemType) (string, error) {
+	switch itemType {
+	case models.ItemTypePost:
+		post, err := appService.GetPostDetails(ctx, itemID)
+		if err != nil {
+			return "", err
+		}
+		return post.UserID, nil
+	case models.ItemTypeCodeFile:
+		file, err := appService.GetCodeFileDetails(ctx, itemID)
+		if err != nil {
+			return "", err
+		}
+		return file.UserID, nil
+	}
+	return "", service.ErrInvalidItemType
+}
@@ -0,0 +1,194 @@
+// Command blogctl runs administrative and maintenance tasks against the configured
+// database and storage, through the same service layer as the server. It uses the same
+// configuration as the server and can run while the server is up.
+//
+//	go run ./cmd/blogctl user create -username <name> [-password <password>]
+//	go run ./cmd/blogctl user reset-password -username <name> [-password <password>]
+//	go run ./cmd/blogctl items list -user <name> [-type post|codefile] [-archived] [-json]
+//	go run ./cmd/blogctl items delete -type post|codefile -id <id>
+//	go run ./cmd/blogctl reindex [-reset]
+//	go run ./cmd/blogctl gc [-dry-run] [-json]
+//	go run ./cmd/blogctl fsck [-repair] [-deep] [-json]
+//	go run ./cmd/blogctl export -user <name> [-out <file.tar.gz>]
+//	go run ./cmd/blogctl site-export -user <name> [-format hugo|jekyll|html] [-out <file.zip>]
+//	go run ./cmd/blogctl backup [-out <file.tar.gz>] [-json]
+//	go run ./cmd/blogctl restore -in <file.tar.gz> [-json]
+//	go run ./cmd/blogctl seed [-file demo|<fixtures.json>] [-json]
+//	go run ./cmd/blogctl push-keys
+//
+// Every command but push-keys takes -tenant <id>, required with multi-tenancy.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const usage = `Usage: blogctl <command> [flags]
+
+Commands:
+  user     Create users and reset passwords (user create, user reset-password)
+  items    List a user's items or move one to the trash (items list, items delete)
+  reindex  Rebuild the full-text search index
+  gc       Purge expired trash, compact old history and delta-encode retained versions
+  fsck     Cross-check item metadata, stored objects and history, and optionally repair
+  export   Write a user's items, with their content, to a .tar.gz archive
+  site-export  Render a user's published posts as a static site (Hugo, Jekyll or HTML) in a .zip archive
+  backup   Write all metadata and stored objects to a .tar.gz archive, for any database type
+  restore  Read a backup archive into an empty database and its storage
+  seed     Create sample users, posts and code files from JSON fixtures
+  push-keys  Generate a VAPID key pair for Web Push notifications
+
+Run blogctl <command> -h for a command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch os.Args[1] {
+	case "user":
+		os.Exit(runUser(ctx, os.Args[2:]))
+	case "items":
+		os.Exit(runItems(ctx, os.Args[2:]))
+	case "reindex":
+		os.Exit(runReindex(ctx, os.Args[2:]))
+	case "gc":
+		os.Exit(runGC(ctx, os.Args[2:]))
+	case "fsck":
+		os.Exit(runFsck(ctx, os.Args[2:]))
+	case "export":
+		os.Exit(runExport(ctx, os.Args[2:]))
+	case "site-export":
+		os.Exit(runSiteExport(ctx, os.Args[2:]))
+	case "backup":
+		os.Exit(runBackup(ctx, os.Args[2:]))
+	case "restore":
+		os.Exit(runRestore(ctx, os.Args[2:]))
+	case "seed":
+		os.Exit(runSeed(ctx, os.Args[2:]))
+	case "push-keys":
+		os.Exit(runPushKeys(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// loadConfig loads the server's configuration and sets up logging.
+func loadConfig() *config.Config {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(&cfg.Log); err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// newService connects to the database and storage. Reads go straight to the database;
+// the server's cache may be stale for maintenance purposes. With multi-tenancy it acts
+// for tenantID, which is then required, and returns ctx scoped to it.
+func newService(ctx context.Context, cfg *config.Config, tenantID string) (*service.Service, context.Context, func()) {
+	var err error
+	switch {
+	case cfg.Tenancy.Enabled && !slices.Contains(cfg.Tenancy.Tenants, tenantID):
+		slog.Error("Multi-tenancy is enabled; -tenant must name a configured tenant", "tenantID", tenantID)
+		os.Exit(1)
+	case !cfg.Tenancy.Enabled && tenantID != "":
+		slog.Error("-tenant requires multi-tenancy (TENANCY_ENABLED=true)")
+		os.Exit(1)
+	}
+
+	storageAdapter, err := storage.NewStorageAdapter(&cfg.Storage)
+	if err != nil {
+		slog.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+	dbAdapter, err := database.NewDBAdapter(ctx, &cfg.Database)
+	if err != nil {
+		storageAdapter.Close()
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+
+	closeAll := func() {
+		dbAdapter.Close(context.Background())
+		storageAdapter.Close()
+	}
+	if cfg.Tenancy.Enabled {
+		if dbAdapter, err = database.ForTenants(dbAdapter); err != nil {
+			closeAll()
+			slog.Error("Failed to enable multi-tenancy", "error", err)
+			os.Exit(1)
+		}
+		storageAdapter = storage.ForTenants(storageAdapter)
+		ctx = logging.WithTenantID(tenant.WithID(ctx, tenantID), tenantID)
+	}
+	return service.NewService(dbAdapter, storageAdapter, cache.NewNoOpCache(), cfg), ctx, closeAll
+}
+
+// runFsck checks consistency and prints the issues found. It exits non-zero if any
+// issue was left unrepaired.
+func runFsck(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "Fix what can be fixed safely (resolve interrupted writes, restore objects, bridge history gaps)")
+	deep := flags.Bool("deep", false, "Also compare every item's live content with the version rebuilt from history (downloads all content)")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	tenantID := flags.String("tenant", "", "Tenant to check (required with multi-tenancy)")
+	flags.Parse(args)
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	start := time.Now()
+	report, err := appService.CheckConsistency(ctx, service.FsckOptions{Repair: *repair, Deep: *deep})
+	if err != nil {
+		slog.Error("Consistency check failed", "itemsChecked", report.ItemsChecked, "error", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			slog.Error("Failed to write report", "error", err)
+		}
+	} else {
+		for _, issue := range report.Issues {
+			status := ""
+			if issue.Repaired {
+				status = " (repaired)"
+			}
+			fmt.Printf("%s %s %s: %s%s\n", issue.ItemType, issue.ItemID, issue.Kind, issue.Detail, status)
+		}
+		slog.Info("Consistency check finished", "itemsChecked", report.ItemsChecked, "duration", time.Since(start).Round(time.Millisecond), "issues", len(report.Issues), "repaired", report.Repaired)
+	}
+
+	if err != nil || report.Repaired < len(report.Issues) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/search"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// runReindex rebuilds the search index from the database, like cmd/reindex but for one
+// tenant at a time.
+func runReindex(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	reset := flags.Bool("reset", false, "Delete and recreate the index first, dropping documents of items that no longer exist")
+	tenantID := flags.String("tenant", "", "Tenant to reindex (required with multi-tenancy)")
+	flags.Parse(args)
+
+	cfg := loadConfig()
+	if !cfg.Search.Enabled {
+		slog.Error("Search is disabled (SEARCH_ENABLED=false)")
+		return 1
+	}
+	if *reset && cfg.Tenancy.Enabled {
+		slog.Error("-reset empties the index of every tenant; use go run ./cmd/reindex -reset instead")
+		return 1
+	}
+
+	appService, ctx, closeAll := newService(ctx, cfg, *tenantID)
+	defer closeAll()
+
+	searchIndex, err := search.NewSearchAdapter(ctx, &cfg.Search)
+	if err != nil {
+		slog.Error("Failed to initialize search", "type", cfg.Search.Type, "error", err)
+		return 1
+	}
+	defer searchIndex.Close()
+	appService.EnableSearch(searchIndex, cfg.Search.QueueSize)
+
+	start := time.Now()
+	indexed, err := appService.ReindexSearch(ctx, *reset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Reindex failed", "indexed", indexed, "error", err)
+		return 1
+	}
+	slog.InfoContext(ctx, "Reindexed documents", "indexed", indexed, "duration", time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// gcReport is what gc did, or on a dry run would do.
+type gcReport struct {
+	TrashPurged int                             `json:"trashPurged"`
+	History     *models.HistoryCompactionReport `json:"history"`
+	Versions    *models.VersionCompactionReport `json:"versions"`
+}
+
+// runGC runs the scheduled cleanup jobs once: purging expired trash, compacting history
+// older than the retention and delta-encoding retained versions. With -dry-run it only
+// reports what compaction would do; trash isn't purged.
+func runGC(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Report what compaction would do without changing anything, and skip the trash purge")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	tenantID := flags.String("tenant", "", "Tenant to clean up (required with multi-tenancy)")
+	flags.Parse(args)
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	start := time.Now()
+	report := gcReport{}
+	failed := false
+	if !*dryRun {
+		// Each pass purges a bounded batch; one that purges nothing means the rest (if
+		// any) failed, which was logged
+		for {
+			n, err := appService.PurgeExpiredTrash(ctx)
+			report.TrashPurged += n
+			if err != nil {
+				slog.ErrorContext(ctx, "Trash purge failed", "purged", report.TrashPurged, "error", err)
+				failed = true
+				break
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+
+	history, err := appService.CompactHistory(ctx, *dryRun)
+	report.History = history
+	if err != nil {
+		slog.ErrorContext(ctx, "History compaction failed", "itemsScanned", history.ItemsScanned, "error", err)
+		failed = true
+	}
+
+	versions, err := appService.CompactVersions(ctx, *dryRun)
+	report.Versions = versions
+	if err != nil {
+		slog.ErrorContext(ctx, "Version compaction failed", "itemsScanned", versions.ItemsScanned, "error", err)
+		failed = true
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			slog.Error("Failed to write report", "error", err)
+		}
+	} else {
+		slog.InfoContext(ctx, "Cleanup finished",
+			"dryRun", *dryRun,
+			"duration", time.Since(start).Round(time.Millisecond),
+			"trashPurged", report.TrashPurged,
+			"itemsScanned", history.ItemsScanned,
+			"itemsCompacted", history.ItemsCompacted,
+			"itemsSkipped", history.ItemsSkipped,
+			"patchesRemoved", history.PatchesRemoved,
+			"snapshotsCreated", history.SnapshotsCreated,
+			"versionsRewritten", versions.VersionsRewritten,
+			"versionBytesSaved", versions.BytesSaved)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
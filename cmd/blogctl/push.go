@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/webpush"
+	"log/slog"
+)
+
+// runPushKeys prints a new VAPID key pair for Web Push, as configuration lines.
+func runPushKeys(args []string) int {
+	flags := flag.NewFlagSet("push-keys", flag.ExitOnError)
+	flags.Parse(args)
+
+	privateKey, publicKey, err := webpush.GenerateKey()
+	if err != nil {
+		slog.Error("Failed to generate VAPID key pair", "error", err)
+		return 1
+	}
+	fmt.Printf("WEBPUSH_VAPID_PRIVATE_KEY=%s\n", privateKey)
+	fmt.Printf("# Public key (served at GET /api/v1/push/key): %s\n", publicKey)
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/seed"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+// seedSummary is what seed prints: the IDs of the created records.
+type seedSummary struct {
+	Users     []seedRecord `json:"users"`
+	Posts     []seedRecord `json:"posts"`
+	CodeFiles []seedRecord `json:"codeFiles"`
+}
+
+type seedRecord struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version,omitempty"`
+}
+
+// runSeed creates sample users, posts and code files, with history, from JSON fixtures.
+func runSeed(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := flags.String("file", seed.DemoName, "Fixtures file, or demo for the built-in set")
+	asJSON := flags.Bool("json", false, "Print the created records as JSON")
+	tenantID := flags.String("tenant", "", "Tenant to seed (required with multi-tenancy)")
+	flags.Parse(args)
+
+	cfg := loadConfig()
+	if cfg.Database.Type == "memory" {
+		// The data would be gone when blogctl exits; the server seeds itself instead
+		slog.Error("The memory database is not shared with the server; set SEED_FILE to seed it at startup", "seedFile", *file)
+		return 1
+	}
+	fixtures, err := seed.ReadFile(*file)
+	if err != nil {
+		slog.Error("Failed to read fixtures", "path", *file, "error", err)
+		return 1
+	}
+
+	appService, ctx, closeAll := newService(ctx, cfg, *tenantID)
+	defer closeAll()
+
+	result, err := seed.Load(ctx, appService, fixtures)
+	if err != nil {
+		slog.Error("Seeding failed", "error", err,
+			"usersCreated", len(result.Users), "postsCreated", len(result.Posts), "codeFilesCreated", len(result.CodeFiles))
+		return 1
+	}
+
+	summary := seedSummary{Users: []seedRecord{}, Posts: []seedRecord{}, CodeFiles: []seedRecord{}}
+	for _, user := range result.Users {
+		summary.Users = append(summary.Users, seedRecord{ID: user.ID, Name: user.Username})
+	}
+	for _, post := range result.Posts {
+		summary.Posts = append(summary.Posts, seedRecord{ID: post.ID, Name: post.Title, Version: post.Version})
+	}
+	for _, file := range result.CodeFiles {
+		summary.CodeFiles = append(summary.CodeFiles, seedRecord{ID: file.ID, Name: file.Path, Version: file.Version})
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			slog.Error("Failed to write summary", "error", err)
+			return 1
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tNAME\tVERSION")
+	for _, r := range summary.Users {
+		fmt.Fprintf(w, "user\t%s\t%s\t\n", r.ID, r.Name)
+	}
+	for _, r := range summary.Posts {
+		fmt.Fprintf(w, "post\t%s\t%s\t%d\n", r.ID, r.Name, r.Version)
+	}
+	for _, r := range summary.CodeFiles {
+		fmt.Fprintf(w, "codefile\t%s\t%s\t%d\n", r.ID, r.Name, r.Version)
+	}
+	w.Flush()
+	return 0
+}
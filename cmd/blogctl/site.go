@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/site"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runSiteExport renders a user's published posts into a zip archive of a static site.
+func runSiteExport(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("site-export", flag.ExitOnError)
+	userID := flags.String("user", "", "User whose blog to export")
+	format := flags.String("format", site.FormatHugo, "hugo, jekyll or html")
+	title := flags.String("title", "", "The blog's title (default SITE_TITLE, else the user ID)")
+	baseURL := flags.String("base-url", "", "Public address of the site (default SITE_BASE_URL)")
+	theme := flags.String("theme", "", "Theme of HTML pages, from SITE_THEMES_DIR (default the user's)")
+	out := flags.String("out", "", "Archive to write (default <user>-<format>.zip)")
+	tenantID := flags.String("tenant", "", "Tenant of the user (required with multi-tenancy)")
+	flags.Parse(args)
+	if *userID == "" {
+		fmt.Fprint(os.Stderr, "-user is required\n")
+		return 2
+	}
+	if *out == "" {
+		*out = *userID + "-" + *format + ".zip"
+	}
+
+	cfg := loadConfig()
+	if *title == "" {
+		*title = cfg.Site.Title
+	}
+	if *baseURL == "" {
+		*baseURL = cfg.Site.BaseURL
+	}
+	themes, err := site.LoadThemes(cfg.Site.ThemesDir)
+	if err != nil {
+		slog.Error("Failed to load site themes", "error", err)
+		return 1
+	}
+	appService, ctx, closeAll := newService(ctx, cfg, *tenantID)
+	defer closeAll()
+	appService.UseSiteThemes(themes.Names())
+
+	// Write next to the destination and rename, so a failed export never replaces a good one
+	tmp, err := os.CreateTemp(filepath.Dir(*out), ".site-export-*")
+	if err != nil {
+		slog.Error("Failed to create archive", "path", *out, "error", err)
+		return 1
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	start := time.Now()
+	opts := site.ExportOptions{Format: *format, Title: *title, BaseURL: *baseURL, Theme: *theme}
+	result, err := site.Export(ctx, appService, themes, *userID, opts, tmp)
+	if err == nil {
+		if err = tmp.Close(); err == nil {
+			err = os.Rename(tmp.Name(), *out)
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		slog.Error("Site export failed", "userID", *userID, "error", err)
+		return 1
+	}
+	slog.Info("Exported site", "userID", *userID, "format", result.Format, "path", *out, "posts", result.Posts, "covers", result.Covers, "files", result.Files, "duration", time.Since(start).Round(time.Millisecond))
+	return 0
+}
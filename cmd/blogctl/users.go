@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// runUser creates a user or resets a user's password.
+func runUser(ctx context.Context, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, "Usage: blogctl user create|reset-password -username <name> [-password <password>]\n")
+		return 2
+	}
+	action := args[0]
+	if action != "create" && action != "reset-password" {
+		fmt.Fprintf(os.Stderr, "Unknown user command %q (want create or reset-password)\n", action)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("user "+action, flag.ExitOnError)
+	username := flags.String("username", "", "Username")
+	password := flags.String("password", "", "New password (default: read the first line of stdin, which keeps it out of the shell history)")
+	tenantID := flags.String("tenant", "", "Tenant of the user (required with multi-tenancy)")
+	flags.Parse(args[1:])
+	if *username == "" {
+		fmt.Fprint(os.Stderr, "-username is required\n")
+		return 2
+	}
+	if *password == "" {
+		var err error
+		if *password, err = readPassword(os.Stdin); err != nil {
+			slog.Error("Failed to read password", "error", err)
+			return 1
+		}
+	}
+
+	appService, ctx, closeAll := newService(ctx, loadConfig(), *tenantID)
+	defer closeAll()
+
+	switch action {
+	case "create":
+		user, err := appService.RegisterUser(ctx, *username, *password)
+		if err != nil {
+			slog.Error("Failed to create user", "username", *username, "error", err)
+			return 1
+		}
+		slog.Info("Created user", "userID", user.ID)
+	case "reset-password":
+		if err := appService.ResetPassword(ctx, *username, *password); err != nil {
+			slog.Error("Failed to reset password", "username", *username, "error", err)
+			return 1
+		}
+		slog.Info("Reset password", "username", *username)
+	}
+	return 0
+}
+
+// readPassword reads a password from the first line of r.
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password given (use -password or pass it on stdin)")
+	}
+	return password, nil
+}
@@ -0,0 +1,118 @@
+// Command reindex rebuilds the full-text search index from the database, e.g. after
+// switching SEARCH_TYPE or when the index has drifted. It uses the same configuration
+// as the server. With Elasticsearch or OpenSearch it can run while the server is up; a
+// Bleve index on disk can only be open in one process, so stop the server first.
+//
+//	go run ./cmd/reindex [-reset] [-tenant <id>]
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/search"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+func main() {
+	reset := flag.Bool("reset", false, "Delete and recreate the index first, dropping documents of items that no longer exist")
+	tenantID := flag.String("tenant", "", "With multi-tenancy, reindex only this tenant's items (default: every tenant)")
+	configFile := flag.String("config", "", "YAML config file (default $CONFIG_FILE); environment variables take precedence")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(&cfg.Log); err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	if !cfg.Search.Enabled {
+		slog.Error("Search is disabled (SEARCH_ENABLED=false)")
+		os.Exit(1)
+	}
+	if (cfg.Search.Type == "" || cfg.Search.Type == "bleve") && cfg.Search.IndexPath == "" {
+		slog.Error("The Bleve index is kept in the server's memory (SEARCH_INDEX_PATH is empty); there is nothing to reindex")
+		os.Exit(1)
+	}
+	tenants := []string{""}
+	if cfg.Tenancy.Enabled {
+		tenants = cfg.Tenancy.Tenants
+		if *tenantID != "" {
+			if !slices.Contains(tenants, *tenantID) {
+				slog.Error("Unknown tenant", "tenantID", *tenantID)
+				os.Exit(1)
+			}
+			if *reset {
+				slog.Error("-reset empties the index of every tenant; run it without -tenant")
+				os.Exit(1)
+			}
+			tenants = []string{*tenantID}
+		}
+	} else if *tenantID != "" {
+		slog.Error("-tenant requires multi-tenancy (TENANCY_ENABLED=true)")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storageAdapter, err := storage.NewStorageAdapter(&cfg.Storage)
+	if err != nil {
+		slog.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+	defer storageAdapter.Close()
+
+	dbAdapter, err := database.NewDBAdapter(ctx, &cfg.Database)
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+	defer dbAdapter.Close(context.Background())
+	if cfg.Tenancy.Enabled {
+		if dbAdapter, err = database.ForTenants(dbAdapter); err != nil {
+			slog.Error("Failed to enable multi-tenancy", "error", err)
+			os.Exit(1)
+		}
+		storageAdapter = storage.ForTenants(storageAdapter)
+	}
+
+	searchIndex, err := search.NewSearchAdapter(ctx, &cfg.Search)
+	if err != nil {
+		slog.Error("Failed to initialize search (a Bleve index can't be opened while the server runs)", "type", cfg.Search.Type, "error", err)
+		os.Exit(1)
+	}
+	defer searchIndex.Close()
+
+	// Read straight from the database; the server's cache may be stale for this purpose
+	appService := service.NewService(dbAdapter, storageAdapter, cache.NewNoOpCache(), cfg)
+	appService.EnableSearch(searchIndex, cfg.Search.QueueSize)
+
+	for i, id := range tenants {
+		tenantCtx := ctx
+		if id != "" {
+			tenantCtx = logging.WithTenantID(tenant.WithID(ctx, id), id)
+		}
+		start := time.Now()
+		indexed, err := appService.ReindexSearch(tenantCtx, *reset && i == 0) // The index is shared by all tenants
+		if err != nil {
+			slog.ErrorContext(tenantCtx, "Reindex failed", "indexed", indexed, "error", err)
+			os.Exit(1)
+		}
+		slog.InfoContext(tenantCtx, "Reindexed documents", "indexed", indexed, "duration", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -3,21 +3,37 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/kkuzar/blog_system/internal/api"
+	"github.com/kkuzar/blog_system/internal/audit"
 	"github.com/kkuzar/blog_system/internal/auth"
 	"github.com/kkuzar/blog_system/internal/cache"       // Added
 	"github.com/kkuzar/blog_system/internal/cache/redis" // Added
 	"github.com/kkuzar/blog_system/internal/config"
 	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/hooks"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/mail"
+	"github.com/kkuzar/blog_system/internal/metrics"
 	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/runner"
+	"github.com/kkuzar/blog_system/internal/search"
 	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/site"
+	"github.com/kkuzar/blog_system/internal/spam"
 	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"github.com/kkuzar/blog_system/internal/webpush"
 	"github.com/kkuzar/blog_system/internal/websocket"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -28,9 +44,28 @@ import (
 
 func main() {
 	// --- Configuration ---
-	cfg, err := config.LoadConfig()
+	configFile := flag.String("config", "", "YAML config file (default $CONFIG_FILE); environment variables take precedence")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := logging.Setup(&cfg.Log); err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Report panics, 5xx responses and inconsistencies to an error tracker (optional)
+	reporter, err := errreport.NewReporter(&cfg.ErrorReport)
+	if err != nil {
+		slog.Error("Invalid error reporting configuration", "error", err)
+		os.Exit(1)
+	}
+	if reporter != nil {
+		errreport.SetDefault(reporter)
+		slog.Info("Error reporting enabled", "sentry", cfg.ErrorReport.SentryDSN != "", "webhook", cfg.ErrorReport.WebhookURL != "", "environment", cfg.ErrorReport.Environment)
 	}
 
 	// --- Initialize Components ---
@@ -40,58 +75,433 @@ func main() {
 	// Initialize JWT Auth
 	auth.Init(&cfg.JWT)
 
-	// Initialize Cache Adapter (Redis or NoOp)
+	if cfg.DevMode {
+		slog.Warn("Running in development mode: data is kept in memory and lost on restart unless configured otherwise",
+			"dbType", cfg.Database.Type, "storageType", cfg.Storage.Type)
+	}
+
+	// Dependencies may come up after the server, so connecting to them is retried for a
+	// while; a signal ends the wait
+	startupCtx, stopStartup := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+
+	// Initialize Cache Adapter (Redis, or NoOp; in-process in development mode)
 	var cacheAdapter cache.Cache
-	redisCache, err := redis.NewRedisCache(&cfg.Redis)
-	if err == nil && redisCache != nil {
+	cacheBackend := "noop"
+	var redisCache *redis.RedisCache
+	if cfg.Redis.Enabled {
+		redisCache, err = connectWithRetry(startupCtx, &cfg.Server, "redis", nil, func(ctx context.Context) (*redis.RedisCache, error) {
+			return redis.NewRedisCache(&cfg.Redis)
+		})
+	}
+	if redisCache != nil {
 		cacheAdapter = redisCache
-		defer func() {
-			if err := cacheAdapter.Close(); err != nil {
-				log.Printf("Error closing cache adapter: %v", err)
-			}
-		}()
-		log.Println("Redis Cache Adapter initialized")
+		cacheBackend = "redis"
+		slog.Info("Redis Cache Adapter initialized")
+	} else if cfg.DevMode {
+		cacheAdapter = cache.NewMemoryCache() // A single node can't serve stale entries
+		cacheBackend = "memory"
+		slog.Info("Redis disabled or not configured, using in-process cache")
 	} else {
-		if err != nil && !errors.Is(err, errors.New("redis disabled")) { // Log actual errors
-			log.Printf("WARNING: Failed to initialize Redis Cache, falling back to NoOpCache: %v", err)
+		if cfg.Redis.Enabled { // Log actual errors
+			slog.Warn("Failed to initialize Redis Cache, falling back to NoOpCache", "error", err)
 		} else {
-			log.Println("Redis disabled or not configured, using NoOpCache.")
+			slog.Info("Redis disabled or not configured, using NoOpCache")
 		}
 		cacheAdapter = cache.NewNoOpCache() // Use NoOp if Redis fails or is disabled
 	}
 
 	// Initialize Storage Adapter
-	storageAdapter, err := storage.NewStorageAdapter(&cfg.Storage)
-	// ... (handle error, defer close) ...
-	log.Printf("Storage Adapter initialized (Type: %s)", cfg.Storage.Type)
+	storageAdapter, err := connectWithRetry(startupCtx, &cfg.Server, "storage", storage.ErrStorageConfig, func(ctx context.Context) (storage.StorageAdapter, error) {
+		adapter, err := storage.NewStorageAdapter(&cfg.Storage)
+		if err != nil {
+			return nil, err
+		}
+		// Constructing an S3 client doesn't contact S3, so look up a key to check it answers
+		probeCtx, cancel := withProbeTimeout(ctx, cfg.Storage.Timeout)
+		defer cancel()
+		if _, err := adapter.FileExists(probeCtx, ".startup-probe"); err != nil {
+			adapter.Close()
+			return nil, err
+		}
+		return adapter, nil
+	})
+	if err != nil {
+		slog.Error("Failed to initialize storage adapter", "type", cfg.Storage.Type, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Storage Adapter initialized", "type", cfg.Storage.Type)
 
 	// Initialize Database Adapter
-	dbAdapter, err := database.NewDBAdapter(ctx, &cfg.Database)
-	// ... (handle error, defer close) ...
-	log.Printf("Database Adapter initialized (Type: %s)", cfg.Database.Type)
+	dbAdapter, err := connectWithRetry(startupCtx, &cfg.Server, "database", database.ErrDBConfig, func(ctx context.Context) (database.DBAdapter, error) {
+		adapter, err := database.NewDBAdapter(ctx, &cfg.Database)
+		if err != nil {
+			return nil, err
+		}
+		// Only some clients connect when created, so read something to check it answers
+		probeCtx, cancel := withProbeTimeout(ctx, cfg.Database.Timeout)
+		defer cancel()
+		if _, err := adapter.GetUserByUsername(probeCtx, "startup-probe"); err != nil && !errors.Is(err, database.ErrNotFound) {
+			adapter.Close(context.Background())
+			return nil, err
+		}
+		return adapter, nil
+	})
+	stopStartup()
+	if err != nil {
+		slog.Error("Failed to initialize database adapter", "type", cfg.Database.Type, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Database Adapter initialized", "type", cfg.Database.Type)
+
+	// Give each tenant its own database namespace and storage prefix (optional)
+	var tenants *tenant.Resolver
+	if cfg.Tenancy.Enabled {
+		tenants, err = tenant.NewResolver(&cfg.Tenancy)
+		if err != nil {
+			slog.Error("Invalid tenancy configuration", "error", err)
+			os.Exit(1)
+		}
+		dbAdapter, err = database.ForTenants(dbAdapter)
+		if err != nil {
+			slog.Error("Failed to enable multi-tenancy", "type", cfg.Database.Type, "error", err)
+			os.Exit(1)
+		}
+		storageAdapter = storage.ForTenants(storageAdapter)
+		slog.Info("Multi-tenancy enabled", "tenants", cfg.Tenancy.Tenants)
+	}
+
+	// Bound every backend call, so an unresponsive backend fails requests instead of hanging them
+	dbAdapter = database.WithTimeout(dbAdapter, cfg.Database.Timeout)
+	storageAdapter = storage.WithTimeout(storageAdapter, cfg.Storage.Timeout)
+
+	// Record the latency and failures of every backend call
+	if cfg.Metrics.Enabled {
+		cacheAdapter = cache.Instrument(cacheAdapter, cacheBackend)
+		storageAdapter = storage.Instrument(storageAdapter, cfg.Storage.Type)
+		dbAdapter = database.Instrument(dbAdapter, cfg.Database.Type)
+	}
+
+	// Public pages are cached until the posts they show change
+	pages := site.NewPageCache(&cfg.Site)
 
 	// Initialize Service Layer (Inject Cache and Config)
-	appService := service.NewService(dbAdapter, storageAdapter, cacheAdapter, cfg)
-	log.Println("Service Layer initialized")
+	appService := service.NewService(dbAdapter, storageAdapter, cacheAdapter, cfg,
+		service.WithItemChangedHook(pages.ItemChanged), service.WithItemDeletedHook(pages.ItemChanged))
+	pages.CountViews(appService)
+	slog.Info("Service Layer initialized")
+
+	// Stream history and authentication events to SIEM/analytics sinks (optional)
+	auditExporter, err := audit.NewExporter(&cfg.AuditExport, &cfg.Storage)
+	if err != nil {
+		slog.Error("Invalid audit export configuration", "error", err)
+		os.Exit(1)
+	}
+	if auditExporter != nil {
+		appService.UseAuditExporter(auditExporter)
+		slog.Info("Audit export enabled", "webhook", cfg.AuditExport.WebhookURL != "", "kafka", cfg.AuditExport.KafkaRESTURL != "", "s3Bucket", cfg.AuditExport.S3Bucket)
+	}
+
+	// Web Push notifications (optional)
+	pushSender, err := webpush.NewSender(&cfg.Push)
+	if err != nil {
+		slog.Error("Invalid Web Push configuration", "error", err)
+		os.Exit(1)
+	}
+	if pushSender != nil {
+		appService.UsePushSender(pushSender)
+		slog.Info("Web Push notifications enabled", "subject", cfg.Push.VAPIDSubject)
+	}
+
+	// Email, for activity digests and mentions (optional)
+	mailer, err := mail.NewMailer(&cfg.Mail)
+	if err != nil {
+		slog.Error("Invalid email configuration", "error", err)
+		os.Exit(1)
+	}
+	if mailer != nil {
+		appService.UseMailer(mailer)
+		slog.Info("Email enabled", "smtp", cfg.Mail.SMTPAddr, "digestIntervalDays", cfg.Digest.IntervalDays)
+	}
+
+	// Spam checking of comments (optional)
+	spamChecker, err := spam.NewChecker(&cfg.Comments)
+	if err != nil {
+		slog.Error("Invalid spam checker configuration", "error", err)
+		os.Exit(1)
+	}
+	if spamChecker != nil {
+		appService.UseSpamChecker(spamChecker)
+		slog.Info("Comment spam checking enabled", "checker", cfg.Comments.SpamChecker)
+	}
+
+	// Initialize Background Jobs (history retries, snapshots, trash purging, history compaction)
+	var jobStore jobs.Store = jobs.NewMemoryStore()
+	if cfg.Jobs.Backend == "redis" {
+		if redisCache != nil {
+			jobStore = jobs.NewRedisStore(redisCache.Client(), redisCache.KeyPrefix())
+		} else {
+			slog.Warn("JOBS_BACKEND is redis but Redis is not available, keeping jobs in memory")
+		}
+	}
+	jobOpts := jobs.Options{Workers: cfg.Jobs.Workers}
+	if tenants != nil {
+		jobOpts.Tenants = tenants.Tenants() // Scheduled jobs run for every tenant
+	}
+	jobQueue := jobs.NewQueue(jobStore, cache.NewDeduper(cacheAdapter), jobOpts)
+	appService.UseJobQueue(jobQueue)
+	// Before jobs run, as maintenance mode may pause some
+	appService.InitMaintenance(ctx)
+	var background sync.WaitGroup // Goroutines that stop when ctx is cancelled
+	runInBackground := func(run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+	runInBackground(jobQueue.Run)
+	slog.Info("Job Queue initialized", "backend", cfg.Jobs.Backend, "workers", cfg.Jobs.Workers)
+
+	// Write buffered view/edit counts
+	runInBackground(func(ctx context.Context) { appService.RunStatsFlusher(ctx, cfg.Stats.FlushInterval) })
+
+	// Initialize Full-Text Search (optional)
+	if cfg.Search.Enabled {
+		searchIndex, err := search.NewSearchAdapter(ctx, &cfg.Search)
+		if err != nil {
+			slog.Warn("Failed to initialize search, search disabled", "type", cfg.Search.Type, "error", err)
+		} else {
+			defer func() {
+				if err := searchIndex.Close(); err != nil {
+					slog.Error("Error closing search index", "error", err)
+				}
+			}()
+			appService.EnableSearch(searchIndex, cfg.Search.QueueSize)
+			runInBackground(appService.RunSearchIndexer)
+			slog.Info("Search Adapter initialized", "type", cfg.Search.Type)
+		}
+	}
+
+	// Register Content Hooks (run on every create and content update)
+	if cfg.Hooks.LinkCheck {
+		appService.RegisterHook(hooks.NewLinkChecker(cfg.Hooks.LinkCheckTimeout))
+		slog.Info("Link checker hook enabled")
+	}
+
+	// Initialize Code Execution (optional)
+	codeRunner, err := runner.NewRunner(&cfg.Runner)
+	if err != nil {
+		slog.Warn("Failed to initialize code runner, code execution disabled", "type", cfg.Runner.Type, "error", err)
+	} else if codeRunner != nil {
+		defer codeRunner.Close()
+		appService.EnableCodeRunner(codeRunner)
+		slog.Info("Code Runner initialized", "type", cfg.Runner.Type)
+	}
+
+	// Load sample data, e.g. into the in-memory database of development mode (optional)
+	if cfg.SeedFile != "" {
+		seedData(ctx, appService, cfg.SeedFile, tenants)
+	}
+
+	// Preload recently active items into the cache (optional)
+	if cfg.Cache.WarmItems > 0 {
+		runInBackground(func(ctx context.Context) { warmCache(ctx, appService, tenants) })
+	}
+
+	// Reload the settings that can change at runtime on SIGHUP (or POST /api/v1/admin/config/reload)
+	appService.UseConfigLoader(func() (*config.Config, error) { return config.LoadConfig(*configFile) })
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			_, _ = appService.ReloadConfig(ctx) // Logs the outcome
+		}
+	}()
 
 	// Initialize WebSocket Hub
 	wsHub := websocket.NewHub()
+	var rateLimiter cache.RateLimiter
+	if cfg.RateLimit.Enabled {
+		rateLimiter = cache.NewRateLimiter(cacheAdapter) // Shared through Redis when available
+		wsHub.UseRateLimiter(rateLimiter, func() cache.RateLimit {
+			limits := appService.RateLimits() // May change on a config reload
+			return cache.RateLimit{Rate: limits.WSMessagesPerMinute, Period: time.Minute, Burst: limits.WSMessageBurst}
+		})
+		slog.Info("Rate limiting enabled", "shared", cacheBackend == "redis", "requestsPerMinute", cfg.RateLimit.RequestsPerMinute, "wsMessagesPerMinute", cfg.RateLimit.WSMessagesPerMinute)
+	}
 	go wsHub.Run()
-	log.Println("WebSocket Hub initialized and running")
+	slog.Info("WebSocket Hub initialized and running")
+
+	// Follow maintenance mode switched on other replicas, telling this one's clients
+	runInBackground(func(ctx context.Context) {
+		appService.RunMaintenanceSync(ctx, func(status *models.MaintenanceStatus) {
+			if err := wsHub.BroadcastToAll(models.WebSocketMessage{Action: "maintenance", Payload: status}); err != nil {
+				slog.ErrorContext(ctx, "Failed to broadcast maintenance mode", "error", err)
+			}
+		})
+	})
 
 	// --- Setup HTTP Server ---
 	mux := http.NewServeMux()
-	api.SetupRoutes(mux, appService, wsHub) // Pass service and hub
-	loggedMux := middleware.LoggingMiddleware(mux)
+	themes, err := site.LoadThemes(cfg.Site.ThemesDir)
+	if err != nil {
+		slog.Error("Failed to load site themes", "error", err)
+		os.Exit(1)
+	}
+	appService.UseSiteThemes(themes.Names())
+	appService.UseStaticSiteBuilder(site.Builder(appService, themes))
+	api.SetupRoutes(mux, service.NewServices(appService), wsHub, themes, pages)
+	if cfg.Site.Enabled {
+		site.SetupRoutes(mux, appService, &cfg.Site, themes, pages)
+		slog.Info("Serving blog pages", "userID", cfg.Site.UserID)
+	}
+	// Long-running admin tasks (consistency checks scan every item) and archive downloads
+	// aren't bounded
+	handler := middleware.TimeoutMiddleware(cfg.Server.RequestTimeout, mux, "/api/v1/admin/fsck",
+		"/api/v1/export/static", "/api/v1/users/me/data-export")
+	// In maintenance mode only admins and signing in may change anything
+	handler = middleware.ReadOnlyMiddleware(appService, handler, "/api/v1/admin/", "/api/v1/auth/login", "/api/v1/auth/ws-ticket")
+	if cfg.Server.MaintenanceMode {
+		slog.Warn("Starting in maintenance mode: changes are rejected until an admin switches it off")
+	}
+	handler = middleware.UsageMiddleware(appService, handler) // Counted as requests are authenticated
+	if tenants != nil {
+		handler = middleware.TenantMiddleware(tenants, handler)
+	}
+	if cfg.Site.CustomDomains {
+		handler = site.CustomDomains(appService, &cfg.Site, themes, pages, handler) // Sets the domain owner's tenant itself
+	}
+	if rateLimiter != nil {
+		handler = middleware.RateLimitMiddleware(rateLimiter, appService, handler) // Per client IP, whatever the tenant
+	}
+	if cfg.Metrics.Enabled {
+		root := http.NewServeMux() // Metrics are for the whole deployment, not one tenant
+		root.Handle("GET /metrics", metrics.Default.Handler(cfg.Metrics.Token))
+		root.Handle("/", handler)
+		handler = root
+	}
+	if err := middleware.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("Failed to set trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	accessLog, err := middleware.NewAccessLogger(&cfg.Log)
+	if err != nil {
+		slog.Error("Failed to open access log", "error", err)
+		os.Exit(1)
+	}
+	defer accessLog.Close()
+	loggedMux := middleware.LoggingMiddleware(accessLog, middleware.RecoverMiddleware(handler))
 	serverAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+	var customDomain func(ctx context.Context, host string) error
+	if cfg.Site.CustomDomains {
+		customDomain = func(ctx context.Context, host string) error {
+			_, err := appService.GetVerifiedDomain(ctx, host)
+			return err
+		}
+	}
+	tlsConfig, redirect, err := setupTLS(&cfg.Server, customDomain)
+	if err != nil {
+		slog.Error("Failed to set up TLS", "error", err)
+		os.Exit(1)
+	}
 	httpServer := &http.Server{
-		Addr:    serverAddr,
-		Handler: loggedMux,
+		Addr:      serverAddr,
+		Handler:   loggedMux,
+		TLSConfig: tlsConfig,
 		// ... (timeouts) ...
 	}
 
 	// --- Start Server & Graceful Shutdown ---
-	// ... (ListenAndServe in goroutine, wait for signal, httpServer.Shutdown) ...
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			slog.Info("Server listening with TLS", "addr", serverAddr, "autocert", len(cfg.Server.AutocertDomains) > 0)
+			err = httpServer.ListenAndServeTLS("", "") // Certificates come from TLSConfig
+		} else {
+			slog.Info("Server listening", "addr", serverAddr)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	var redirectServer *http.Server
+	if cfg.Server.RedirectPort != "" {
+		redirectServer = &http.Server{
+			Addr:              fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.RedirectPort),
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP redirect server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	slog.Info("Shutting down", "signal", sig.String(), "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// 1. Stop the background work (the job queue, stats flusher and search indexer)
+	cancel()
+
+	// 2. Stop accepting requests and wait for the ones in progress
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP server did not shut down cleanly", "error", err)
+	}
+	if redirectServer != nil {
+		_ = redirectServer.Shutdown(shutdownCtx)
+	}
+
+	// 3. Refuse WebSocket upgrades and close the connections once their queued messages
+	// are sent
+	if err := wsHub.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("WebSocket clients were not all drained", "error", err)
+	}
+
+	// 4. Let content changes already under way finish, so none is cut off between its
+	// storage upload and database update
+	if err := appService.DrainWrites(shutdownCtx); err != nil {
+		slog.Warn("Content writes still in progress at shutdown", "error", err)
+	}
+	backgroundDone := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundDone)
+	}()
+	select {
+	case <-backgroundDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Background work still running at shutdown")
+	}
+
+	// 5. Close the database, cache and storage adapters and send queued audit events and
+	// error reports, with a context of their own as
+	// the shutdown timeout may have passed
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer closeCancel()
+	if err := dbAdapter.Close(closeCtx); err != nil {
+		slog.Error("Error closing database adapter", "error", err)
+	}
+	if err := cacheAdapter.Close(); err != nil {
+		slog.Error("Error closing cache adapter", "error", err)
+	}
+	if err := storageAdapter.Close(); err != nil {
+		slog.Error("Error closing storage adapter", "error", err)
+	}
+	if err := auditExporter.Close(closeCtx); err != nil {
+		slog.Warn("Audit events not all exported", "error", err)
+	}
+	if err := reporter.Close(closeCtx); err != nil {
+		slog.Warn("Error reports not all sent", "error", err)
+	}
 
-	log.Println("Application shut down complete.")
+	slog.Info("Application shut down complete")
 }
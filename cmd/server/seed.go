@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/seed"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"os"
+)
+
+// seedData loads the fixtures in path ("demo" for the built-in set) for every tenant.
+// A tenant whose first fixture user already exists is taken to be seeded and skipped, so
+// restarting against a persistent database is harmless.
+func seedData(ctx context.Context, appService *service.Service, path string, tenants *tenant.Resolver) {
+	fixtures, err := seed.ReadFile(path)
+	if err != nil {
+		slog.Error("Failed to read seed file", "path", path, "error", err)
+		os.Exit(1)
+	}
+	tenantIDs := []string{""}
+	if tenants != nil {
+		tenantIDs = tenants.Tenants()
+	}
+	for _, tenantID := range tenantIDs {
+		tenantCtx := ctx
+		if tenantID != "" {
+			tenantCtx = logging.WithTenantID(tenant.WithID(ctx, tenantID), tenantID)
+		}
+		result, err := seed.Load(tenantCtx, appService, fixtures)
+		switch {
+		case errors.Is(err, service.ErrUsernameTaken) && len(result.Users) == 0:
+			slog.InfoContext(tenantCtx, "Seed data already present, skipping", "path", path)
+		case err != nil:
+			slog.ErrorContext(tenantCtx, "Failed to load seed data", "path", path, "error", err)
+			os.Exit(1)
+		default:
+			slog.InfoContext(tenantCtx, "Seed data loaded", "path", path,
+				"users", len(result.Users), "posts", len(result.Posts), "codeFiles", len(result.CodeFiles))
+		}
+	}
+}
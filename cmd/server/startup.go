@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+	"log/slog"
+	"time"
+)
+
+// firstRetryDelay is the pause after the first failed attempt to reach a dependency; it
+// doubles with each further attempt, up to the configured maximum.
+const firstRetryDelay = time.Second
+
+// connectWithRetry calls connect until it succeeds, retrying with exponential backoff for
+// up to cfg.StartupWait, as the database, Redis or storage may start after the server
+// (e.g. in a container orchestrator). Errors matching permanent (a misconfiguration) are
+// returned at once. It gives up early when ctx is cancelled.
+func connectWithRetry[T any](ctx context.Context, cfg *config.ServerConfig, name string, permanent error, connect func(context.Context) (T, error)) (T, error) {
+	deadline := time.Now().Add(cfg.StartupWait)
+	delay := firstRetryDelay
+	for attempt := 1; ; attempt++ {
+		value, err := connect(ctx)
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("Connected after retrying", "dependency", name, "attempts", attempt)
+			}
+			return value, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 || (permanent != nil && errors.Is(err, permanent)) {
+			return value, err
+		}
+		wait := min(delay, cfg.StartupMaxBackoff, remaining)
+		slog.Warn("Dependency not available yet, retrying", "dependency", name, "attempt", attempt, "retryIn", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return value, err
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, cfg.StartupMaxBackoff)
+	}
+}
+
+// probeTimeout bounds the check that a dependency answers when its calls have no timeout
+// of their own.
+const probeTimeout = 10 * time.Second
+
+// withProbeTimeout returns ctx bounded by timeout, or by probeTimeout if that is 0.
+func withProbeTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = probeTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// setupTLS returns the TLS config to serve HTTPS with, or nil for plain HTTP, and the
+// handler for the redirect port: it sends clients to HTTPS and, with autocert, answers
+// Let's Encrypt's HTTP challenges. With autocert, certificates are also obtained for the
+// hosts customDomain accepts, if it isn't nil.
+func setupTLS(cfg *config.ServerConfig, customDomain func(ctx context.Context, host string) error) (*tls.Config, http.Handler, error) {
+	redirect := redirectToHTTPS(cfg.Port)
+	switch {
+	case len(cfg.AutocertDomains) > 0:
+		ownDomains := autocert.HostWhitelist(cfg.AutocertDomains...)
+		hostPolicy := func(ctx context.Context, host string) error {
+			err := ownDomains(ctx, host)
+			if err != nil && customDomain != nil && customDomain(ctx, host) == nil {
+				return nil
+			}
+			return err
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: hostPolicy,
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig() // Also answers TLS-ALPN challenges on the HTTPS port
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	case cfg.TLSCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// redirectToHTTPS redirects requests to the same URL on the HTTPS port.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]") // IPv6 literals, bracketed again by JoinHostPort
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect // Keep the method and body
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
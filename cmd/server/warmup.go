@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"time"
+)
+
+// warmCache preloads recently active items into the cache, for every tenant when
+// multi-tenancy is enabled. It runs in the background while the server starts serving.
+func warmCache(ctx context.Context, appService *service.Service, tenants *tenant.Resolver) {
+	tenantIDs := []string{""}
+	if tenants != nil {
+		tenantIDs = tenants.Tenants()
+	}
+	for _, tenantID := range tenantIDs {
+		tenantCtx := ctx
+		if tenantID != "" {
+			tenantCtx = logging.WithTenantID(tenant.WithID(ctx, tenantID), tenantID)
+		}
+		start := time.Now()
+		n, err := appService.WarmCache(tenantCtx)
+		if err != nil {
+			slog.WarnContext(tenantCtx, "Cache warm-up stopped", "itemsWarmed", n, "error", err)
+			continue
+		}
+		slog.InfoContext(tenantCtx, "Cache warmed", "items", n, "duration", time.Since(start))
+	}
+}
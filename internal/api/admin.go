@@ -0,0 +1,195 @@
+// internal/api/admin.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"log/slog"
+	"net/http"
+)
+
+// requireAdmin wraps an authenticated handler so only admins (ADMIN_USER_IDS) reach it.
+func (h *APIHandler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.auth.IsAdmin(middleware.GetUserIDFromContext(r.Context())) {
+			writeError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// PreviewHistoryCompaction godoc
+// @Summary Preview history compaction
+// @Description Dry-runs the history retention policy: reports how many patch entries older than HISTORY_PATCH_RETENTION_DAYS would be collapsed into snapshots, without changing anything. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.HistoryCompactionReport "What a compaction run would do"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/history/compaction [get]
+func (h *APIHandler) PreviewHistoryCompaction(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.CompactHistory(r.Context(), true)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CheckConsistency godoc
+// @Summary Check data consistency
+// @Description Cross-checks every item's metadata, stored objects and history log and reports missing objects, dangling paths, history gaps and interrupted writes, without changing anything. With deep=true live content is also compared with the version rebuilt from history, which downloads every item. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param deep query bool false "Compare live content with history"
+// @Success 200 {object} models.FsckReport "Issues found"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/fsck [get]
+func (h *APIHandler) CheckConsistency(w http.ResponseWriter, r *http.Request) {
+	h.runConsistencyCheck(w, r, false)
+}
+
+// RepairConsistency godoc
+// @Summary Check and repair data consistency
+// @Description Runs the consistency check and fixes what can be fixed safely: interrupted writes are resolved, missing or (with deep=true) diverged live objects are restored from history, and history gaps are bridged with snapshots of retained versions. Other issues are reported only. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param deep query bool false "Compare live content with history"
+// @Success 200 {object} models.FsckReport "Issues found and whether each was repaired"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/fsck [post]
+func (h *APIHandler) RepairConsistency(w http.ResponseWriter, r *http.Request) {
+	h.runConsistencyCheck(w, r, true)
+}
+
+func (h *APIHandler) runConsistencyCheck(w http.ResponseWriter, r *http.Request, repair bool) {
+	opts := service.FsckOptions{Repair: repair, Deep: r.URL.Query().Get("deep") == "true"}
+	report, err := h.service.CheckConsistency(r.Context(), opts)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ReloadConfig godoc
+// @Summary Reload configuration
+// @Description Reads the configuration again (as on SIGHUP) and applies the settings that can change at runtime: LOG_LEVEL, SNAPSHOT_INTERVAL_CHANGES, the CACHE_*_TTL_MINUTES settings and the RATE_LIMIT_* limits. Other settings (including RATE_LIMIT_ENABLED) need a restart. Connections, including WebSockets, are kept. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.ConfigReloadResult "Settings that changed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 422 {object} map[string]string "Invalid configuration; nothing was applied"
+// @Failure 503 {object} map[string]string "Reload not available"
+// @Router /admin/config/reload [post]
+func (h *APIHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.ReloadConfig(r.Context())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetMaintenance godoc
+// @Summary Get maintenance mode
+// @Description Tells whether the servers are in maintenance mode, in which they reject changes with 503 and code READ_ONLY (over WebSocket, an error with that code) while serving reads and WebSocket subscriptions. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MaintenanceStatus "Maintenance mode"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Router /admin/maintenance [get]
+func (h *APIHandler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.Maintenance())
+}
+
+// SetMaintenance godoc
+// @Summary Switch maintenance mode
+// @Description Switches maintenance mode on or off. While it is on, requests that would change data (other than admin requests and signing in) are answered with 503 and code READ_ONLY, with the given message, and so are WebSocket actions that would; reads and subscriptions go on, while background jobs that write content (scheduled publishing, purging the trash, compactions, ...) wait until it is off. The mode is shared by all replicas through the cache (with Redis), which follow within a few seconds. Connected WebSocket clients are sent a "maintenance" message with the new status, as are clients connecting while it is on. Requires admin access.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.MaintenanceRequest true "Maintenance mode"
+// @Security BearerAuth
+// @Success 200 {object} models.MaintenanceStatus "Maintenance mode"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/maintenance [put]
+func (h *APIHandler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req models.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	status, err := h.service.SetMaintenance(r.Context(), middleware.GetUserIDFromContext(r.Context()), &req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if err := h.hub.BroadcastToAll(models.WebSocketMessage{Action: "maintenance", Payload: status}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast maintenance mode", "error", err)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// BroadcastAnnouncement godoc
+// @Summary Broadcast an announcement
+// @Description Sends an "announcement" WebSocket message (e.g. "maintenance in 10 minutes, saves will pause") to every client connected to this server, or with items, to the subscribers of those items, with the item in the message. Requires admin access.
+// @Tags admin
+// @Accept json
+// @Param request body models.AnnouncementRequest true "Announcement"
+// @Security BearerAuth
+// @Success 202 "Announcement sent"
+// @Failure 400 {object} map[string]string "Invalid announcement, level or item type"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Router /admin/broadcast [post]
+func (h *APIHandler) BroadcastAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var req models.AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	announcement, err := h.service.NewAnnouncement(r.Context(), middleware.GetUserIDFromContext(r.Context()), &req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if len(req.Items) == 0 {
+		err = h.hub.BroadcastToAll(models.WebSocketMessage{Action: "announcement", Payload: announcement})
+	}
+	for _, item := range req.Items {
+		payload := *announcement
+		payload.ItemID, payload.ItemType = item.ItemID, item.ItemType
+		if err = h.hub.BroadcastToItem(models.ItemType(item.ItemType), item.ItemID, models.WebSocketMessage{Action: "announcement", Payload: payload}); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast announcement", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to broadcast announcement")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
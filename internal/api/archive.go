@@ -0,0 +1,76 @@
+// internal/api/archive.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+// includeArchived reports whether a listing request asked for archived items with
+// ?include=archived.
+func includeArchived(r *http.Request) bool {
+	return r.URL.Query().Get("include") == "archived"
+}
+
+// ArchiveItem godoc
+// @Summary Archive an item
+// @Description Hides a post or code file from default listings. Archived items stay readable and are listed with ?include=archived. The change is recorded in the item's history. Requires ownership.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {object} interface{} "Updated item metadata (models.Post or models.CodeFile)"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/archive [post]
+func (h *APIHandler) ArchiveItem(w http.ResponseWriter, r *http.Request) {
+	h.setItemArchived(w, r, true)
+}
+
+// UnarchiveItem godoc
+// @Summary Unarchive an item
+// @Description Returns an archived post or code file to default listings. The change is recorded in the item's history. Requires ownership.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {object} interface{} "Updated item metadata (models.Post or models.CodeFile)"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/unarchive [post]
+func (h *APIHandler) UnarchiveItem(w http.ResponseWriter, r *http.Request) {
+	h.setItemArchived(w, r, false)
+}
+
+func (h *APIHandler) setItemArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemID, itemType := r.PathValue("id"), r.PathValue("type")
+
+	var meta models.ItemMeta
+	var err error
+	if archived {
+		meta, err = h.service.ArchiveItem(r.Context(), userID, itemID, itemType)
+	} else {
+		meta, err = h.service.UnarchiveItem(r.Context(), userID, itemID, itemType)
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = h.hub.BroadcastToItem(models.ItemType(itemType), itemID, models.WebSocketMessage{
+		Action:  "archive_changed",
+		Payload: models.BroadcastArchivePayload{ItemID: itemID, Archived: archived, Originator: userID},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast archive change", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, meta)
+}
@@ -0,0 +1,184 @@
+// internal/api/assets.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UploadAsset godoc
+// @Summary Upload a binary asset
+// @Description Stores a binary file such as an image or a font from a multipart/form-data upload. Assets are replaced whole rather than edited, so they have no history and aren't searched. The content type comes from the upload, or else the name and content. At most 8 MiB.
+// @Tags assets
+// @Accept mpfd
+// @Produce json
+// @Param file formData file true "The file"
+// @Param path formData string false "Path to store it at, e.g. img/logo.png (defaults to the file's name)"
+// @Param projectId formData string false "Project to add it to"
+// @Security BearerAuth
+// @Success 201 {object} models.Asset "Created asset"
+// @Failure 400 {object} map[string]string "No file, empty file or invalid path"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Failure 413 {object} map[string]string "File or storage quota too large"
+// @Router /assets [post]
+func (h *APIHandler) UploadAsset(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileName, content, ok := readUpload(w, r)
+	defer cleanupUpload(r)
+	if !ok {
+		return
+	}
+	filePath := r.FormValue("path")
+	if filePath == "" {
+		filePath = fileName
+	}
+
+	asset, err := h.service.UploadAsset(r.Context(), userID, filePath, strings.TrimSpace(r.FormValue("projectId")), uploadContentType(r), content)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, asset)
+}
+
+// uploadContentType returns the content type the client gave the "file" part, if any.
+func uploadContentType(r *http.Request) string {
+	if files := r.MultipartForm.File["file"]; len(files) > 0 {
+		return files[0].Header.Get("Content-Type")
+	}
+	return ""
+}
+
+// ListAssets godoc
+// @Summary List assets
+// @Description Returns the user's assets, sorted by path.
+// @Tags assets
+// @Produce json
+// @Param limit query int false "Limit number of results" default(50)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.Asset "Assets"
+// @Router /assets [get]
+func (h *APIHandler) ListAssets(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	assets, err := h.service.ListAssets(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, assets)
+}
+
+// GetAsset godoc
+// @Summary Get an asset's metadata
+// @Tags assets
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Asset "Asset"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Asset not found"
+// @Router /assets/{id} [get]
+func (h *APIHandler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	asset, err := h.service.GetAsset(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, asset)
+}
+
+// DownloadAsset godoc
+// @Summary Download an asset
+// @Description Streams an asset's content as an attachment under its file name.
+// @Tags assets
+// @Produce octet-stream
+// @Param id path string true "Asset ID"
+// @Security BearerAuth
+// @Success 200 {file} file "The content"
+// @Success 304 "Content unchanged (If-None-Match)"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Asset not found"
+// @Router /assets/{id}/download [get]
+func (h *APIHandler) DownloadAsset(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	download, err := h.service.DownloadAsset(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeDownload(w, r, download)
+}
+
+// ReplaceAsset godoc
+// @Summary Replace an asset's content
+// @Description Replaces an asset's content with a multipart/form-data upload, keeping its path. At most 8 MiB.
+// @Tags assets
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Asset ID"
+// @Param file formData file true "The file"
+// @Param baseVersion formData int false "If set, must be the current version"
+// @Security BearerAuth
+// @Success 200 {object} models.Asset "Updated asset"
+// @Failure 400 {object} map[string]string "No file or empty file"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Asset not found"
+// @Failure 409 {object} map[string]string "baseVersion is not the current version"
+// @Failure 413 {object} map[string]string "File or storage quota too large"
+// @Router /assets/{id} [put]
+func (h *APIHandler) ReplaceAsset(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	_, content, ok := readUpload(w, r)
+	defer cleanupUpload(r)
+	if !ok {
+		return
+	}
+	baseVersion := 0
+	if v := r.FormValue("baseVersion"); v != "" {
+		var err error
+		if baseVersion, err = strconv.Atoi(v); err != nil || baseVersion < 1 {
+			writeError(w, http.StatusBadRequest, "baseVersion must be a positive integer")
+			return
+		}
+	}
+
+	asset, err := h.service.ReplaceAsset(r.Context(), userID, r.PathValue("id"), baseVersion, uploadContentType(r), content)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, asset)
+}
+
+// DeleteAsset godoc
+// @Summary Delete an asset
+// @Description Deletes an asset and its content for good; assets don't go to the trash.
+// @Tags assets
+// @Param id path string true "Asset ID"
+// @Security BearerAuth
+// @Success 204 "Asset deleted"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Asset not found"
+// @Router /assets/{id} [delete]
+func (h *APIHandler) DeleteAsset(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.DeleteAsset(r.Context(), userID, r.PathValue("id")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+// internal/api/bookmarks.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+)
+
+// ListBookmarks godoc
+// @Summary List your reading list
+// @Description Returns the published posts the caller bookmarked, most recently bookmarked first. Posts deleted or unpublished since are left out.
+// @Tags bookmarks
+// @Produce json
+// @Param limit query int false "Limit number of results" default(20)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.BookmarkedPost "Bookmarked posts"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /bookmarks [get]
+func (h *APIHandler) ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	posts, err := h.service.ListBookmarks(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, posts)
+}
+
+// AddBookmark godoc
+// @Summary Bookmark a post
+// @Description Adds a published post to the caller's reading list. Any signed-in user can bookmark a published post; authors see the count in the post's stats. Bookmarking a post again keeps the original bookmark.
+// @Tags bookmarks
+// @Produce json
+// @Param postId path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Bookmark "The bookmark"
+// @Failure 404 {object} map[string]string "Post not found or not published"
+// @Router /bookmarks/{postId} [put]
+func (h *APIHandler) AddBookmark(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	bookmark, err := h.service.AddBookmark(r.Context(), userID, r.PathValue("postId"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookmark)
+}
+
+// RemoveBookmark godoc
+// @Summary Remove a bookmark
+// @Description Takes a post off the caller's reading list.
+// @Tags bookmarks
+// @Param postId path string true "Post ID"
+// @Security BearerAuth
+// @Success 204 "Bookmark removed"
+// @Failure 404 {object} map[string]string "Post is not bookmarked"
+// @Router /bookmarks/{postId} [delete]
+func (h *APIHandler) RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.RemoveBookmark(r.Context(), userID, r.PathValue("postId")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
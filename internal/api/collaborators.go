@@ -0,0 +1,122 @@
+// internal/api/collaborators.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// Handlers for /api/v1/items/{type}/{id}/collaborators/..., which manage who else can
+// view or edit an item.
+
+// ListCollaborators godoc
+// @Summary List an item's collaborators
+// @Description Returns everyone with access to a post or code file, starting with the owner. Requires at least viewer access.
+// @Tags collaborators
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {array} models.Collaborator "Owner and collaborators"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/collaborators [get]
+func (h *APIHandler) ListCollaborators(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	collabs, err := h.service.ListCollaborators(r.Context(), userID, r.PathValue("id"), r.PathValue("type"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, collabs)
+}
+
+// SetCollaborator godoc
+// @Summary Add or update a collaborator
+// @Description Grants a user the editor or viewer role on a post or code file, or changes their role. Only the owner can manage collaborators.
+// @Tags collaborators
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param userId path string true "Collaborator user ID"
+// @Param request body models.SetCollaboratorRequest true "Role"
+// @Security BearerAuth
+// @Success 200 {object} models.Collaborator "The collaborator"
+// @Failure 400 {object} map[string]string "Invalid item type or role"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or user not found"
+// @Router /items/{type}/{id}/collaborators/{userId} [put]
+func (h *APIHandler) SetCollaborator(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetCollaboratorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	collab, err := h.service.SetCollaborator(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("userId"), req.Role)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, collab)
+}
+
+// RemoveCollaborator godoc
+// @Summary Remove a collaborator
+// @Description Revokes a user's access to a post or code file. The owner can remove anyone; collaborators can remove themselves.
+// @Tags collaborators
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param userId path string true "Collaborator user ID"
+// @Security BearerAuth
+// @Success 204 "Collaborator removed"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or collaborator not found"
+// @Router /items/{type}/{id}/collaborators/{userId} [delete]
+func (h *APIHandler) RemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	err := h.service.RemoveCollaborator(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("userId"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetPostCoAuthors godoc
+// @Summary Credit co-authors of a post
+// @Description Replaces the co-authors credited on a post alongside its owner, in byline order. Co-authors must be editors of the post (at most 10); they lose the credit when they lose editor access. The change is recorded in the post's history. Only the owner can credit co-authors.
+// @Tags collaborators
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SetPostAuthorsRequest true "Co-authors"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Not an editor, duplicate or too many co-authors"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/authors [put]
+func (h *APIHandler) SetPostCoAuthors(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetPostAuthorsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SetPostCoAuthors(r.Context(), userID, r.PathValue("id"), req.CoAuthors)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
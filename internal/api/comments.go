@@ -0,0 +1,207 @@
+// internal/api/comments.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Handlers for /api/v1/items/{type}/{id}/comments/..., and the moderation queue of the
+// comments on the caller's items. Subscribers of an item are sent "comment_added" when a
+// comment on it is shown (posted approved, or approved later) and "comment_removed" when
+// one is deleted or taken back into moderation.
+
+// broadcastComment tells subscribers of an item that a comment on it was shown, with
+// comment set, or removed.
+func (h *APIHandler) broadcastComment(ctx context.Context, userID, itemTypeStr, itemID, commentID string, comment *models.Comment) {
+	action := "comment_removed"
+	if comment != nil {
+		action = "comment_added"
+	}
+	err := h.hub.BroadcastToItem(models.ItemType(itemTypeStr), itemID, models.WebSocketMessage{
+		Action: action,
+		Payload: models.BroadcastCommentPayload{
+			ItemID: itemID, ItemType: itemTypeStr, CommentID: commentID, Comment: comment, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to broadcast comment", "action", action, "commentID", commentID, "itemType", itemTypeStr, "itemID", itemID, "error", err)
+	}
+}
+
+// ListComments godoc
+// @Summary List an item's comments
+// @Description Returns the approved comments on a post or code file, oldest first. Each comment lists the users it mentions, with where in the body (in characters) the @username is. Comments on a selection of the content have an anchor, moved along with the text it selects up to the current version shortly after each edit (its version says which content it is on); an anchor whose text was deleted, or that couldn't be followed through the edits, is detached. Anchors of readers of a published post (users without access to its draft) are marked published and follow the published content instead. Clients following the item over WebSocket can move anchors themselves with the changes in "content_changed" messages. Requires viewer access, or only signing in for a published post.
+// @Tags comments
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param limit query int false "Limit number of results" default(50)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.Comment "Comments"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/comments [get]
+func (h *APIHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	comments, err := h.service.ListComments(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+// AddComment godoc
+// @Summary Comment on an item
+// @Description Posts a comment on a post or code file. Depending on the server's moderation settings and spam check, it is approved at once or held for the item's owner (status pending or spam). Each @username in the body that names a user who can read the comments is listed in the comment's mentions and, once it is approved, notifies them (the "mention" notification type, also emailed). With an anchor the comment is on a selection of the content, from the start position up to the end position (0-based lines, columns in characters), as of the anchor's version or else the current one; it is moved up to the current version right away. Readers of a published post, who can't see its draft, anchor to the published content: their anchor's version must be the published one, or left out. Once approved, the item's WebSocket subscribers are sent "comment_added". Requires viewer access, or only signing in for a published post.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CommentRequest true "Comment"
+// @Security BearerAuth
+// @Success 201 {object} models.Comment "The comment"
+// @Failure 400 {object} map[string]string "Invalid item type, comment or anchor"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Failure 410 {object} map[string]string "Anchor's version no longer retained"
+// @Router /items/{type}/{id}/comments [post]
+func (h *APIHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	comment, err := h.service.AddComment(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), &req, middleware.ClientIP(r), r.UserAgent())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if comment.Status == models.CommentApproved {
+		h.broadcastComment(r.Context(), userID, comment.ItemType, comment.ItemID, comment.ID, comment)
+	}
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description Removes a comment from a post or code file, and sends the item's WebSocket subscribers "comment_removed". Its author and the item's owner can delete it.
+// @Tags comments
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param commentId path string true "Comment ID"
+// @Security BearerAuth
+// @Success 204 "Comment deleted"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or comment not found"
+// @Router /items/{type}/{id}/comments/{commentId} [delete]
+func (h *APIHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	err := h.service.DeleteComment(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("commentId"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	h.broadcastComment(r.Context(), userID, r.PathValue("type"), r.PathValue("id"), r.PathValue("commentId"), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModerateComment godoc
+// @Summary Approve or reject a comment
+// @Description Sets the status of a comment on one of your items: approved shows it (and notifies the users it mentions, the first time), pending hides it again and spam marks it as spam. The item's WebSocket subscribers are sent "comment_added" or "comment_removed" accordingly. Requires owner access.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param commentId path string true "Comment ID"
+// @Param request body models.CommentStatusRequest true "New status"
+// @Security BearerAuth
+// @Success 200 {object} models.Comment "The comment"
+// @Failure 400 {object} map[string]string "Invalid item type or status"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or comment not found"
+// @Router /items/{type}/{id}/comments/{commentId}/status [put]
+func (h *APIHandler) ModerateComment(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CommentStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	comment, err := h.service.ModerateComment(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("commentId"), req.Status)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	shown := comment
+	if !comment.Status.Is(models.CommentApproved) {
+		shown = nil
+	}
+	h.broadcastComment(r.Context(), userID, comment.ItemType, comment.ItemID, comment.ID, shown)
+	writeJSON(w, http.StatusOK, comment)
+}
+
+// ListModerationQueue godoc
+// @Summary List comments awaiting moderation
+// @Description Returns the comments on your posts and code files that are held for moderation (status pending, the default) or marked as spam, newest first.
+// @Tags comments
+// @Produce json
+// @Param status query string false "Comment status" Enums(pending, spam) default(pending)
+// @Param limit query int false "Limit number of results" default(50)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.Comment "Comments"
+// @Failure 400 {object} map[string]string "Invalid status"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/comments/moderation [get]
+func (h *APIHandler) ListModerationQueue(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	status := models.CommentStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = models.CommentPending
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	comments, err := h.service.ListModerationQueue(r.Context(), userID, status, limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
@@ -0,0 +1,80 @@
+// internal/api/dataexport.go
+package api
+
+import (
+	"errors"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// GetDataExport godoc
+// @Summary Download an archive of your data
+// @Description Returns a zip archive of everything stored about the caller: their profile, posts and code files (archived and trashed ones included) with their content, history, audit events, comments they wrote, and the rest of their records, as JSON. Archives are built in the background: until one is ready this requests it, if none is pending, and answers 202 with its status; poll again later. A ready archive is kept for DATA_EXPORT_RETENTION_HOURS.
+// @Tags users
+// @Produce application/zip
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {file} file "Zip archive"
+// @Success 202 {object} models.DataExport "The export is being built"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 503 {object} map[string]string "Job queue not configured"
+// @Router /users/me/data-export [get]
+func (h *APIHandler) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	export, err := h.service.GetDataExport(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if export.Status != models.DataExportReady {
+		writeJSON(w, http.StatusAccepted, export)
+		return
+	}
+	body, export, err := h.service.OpenDataExport(r.Context(), userID)
+	if errors.Is(err, service.ErrDataExportNotReady) { // Expired meanwhile
+		if export, err = h.service.RequestDataExport(r.Context(), userID); err == nil {
+			writeJSON(w, http.StatusAccepted, export)
+			return
+		}
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.FormatInt(export.SizeBytes, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": userID + "-data.zip"}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		slog.WarnContext(r.Context(), "Download interrupted", "path", r.URL.Path, "error", err)
+	}
+}
+
+// RequestDataExport godoc
+// @Summary Request a fresh archive of your data
+// @Description Starts building a new archive of the caller's data, as served by GET /users/me/data-export, replacing any earlier one. An export already being built is left to finish.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.DataExport "The export is being built"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 503 {object} map[string]string "Job queue not configured"
+// @Router /users/me/data-export [post]
+func (h *APIHandler) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	export, err := h.service.RequestDataExport(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, export)
+}
@@ -0,0 +1,97 @@
+// internal/api/domains.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// ListDomains godoc
+// @Summary List your custom domains
+// @Description Returns the domains the current user added for their blog, verified or not. Unverified ones come with the DNS record that verifies them.
+// @Tags domains
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Domain "Domains"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/domains [get]
+func (h *APIHandler) ListDomains(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	domains, err := h.service.ListDomains(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, domains)
+}
+
+// AddDomain godoc
+// @Summary Add a custom domain
+// @Description Claims a domain to serve the current user's blog at. To prove they control it, they publish the returned verificationRecord (a TXT record at _blog-verify.<domain>), point the domain at the server, then verify it. A claim left unverified for a week can be taken by someone else.
+// @Tags domains
+// @Accept json
+// @Produce json
+// @Param request body models.AddDomainRequest true "Domain, e.g. blog.example.com"
+// @Security BearerAuth
+// @Success 201 {object} models.Domain "The domain, with its verification record"
+// @Failure 400 {object} map[string]string "Not a domain"
+// @Failure 409 {object} map[string]string "Domain in use, or too many domains"
+// @Failure 503 {object} map[string]string "Custom domains are disabled"
+// @Router /users/me/domains [post]
+func (h *APIHandler) AddDomain(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.AddDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	domain, err := h.service.AddDomain(r.Context(), userID, req.Host)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, domain)
+}
+
+// VerifyDomain godoc
+// @Summary Verify a custom domain
+// @Description Looks up the domain's verification record in DNS and, if it is there, starts serving the current user's blog at the domain (within a minute). New DNS records can take a while to be seen; retry until then.
+// @Tags domains
+// @Produce json
+// @Param host path string true "Domain"
+// @Security BearerAuth
+// @Success 200 {object} models.Domain "The verified domain"
+// @Failure 404 {object} map[string]string "Domain not found"
+// @Failure 422 {object} map[string]string "Verification record not found"
+// @Router /users/me/domains/{host}/verify [post]
+func (h *APIHandler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	domain, err := h.service.VerifyDomain(r.Context(), userID, r.PathValue("host"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, domain)
+}
+
+// RemoveDomain godoc
+// @Summary Remove a custom domain
+// @Description Stops serving the current user's blog at the domain and releases it.
+// @Tags domains
+// @Param host path string true "Domain"
+// @Security BearerAuth
+// @Success 204 "Domain removed"
+// @Failure 404 {object} map[string]string "Domain not found"
+// @Router /users/me/domains/{host} [delete]
+func (h *APIHandler) RemoveDomain(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.RemoveDomain(r.Context(), userID, r.PathValue("host")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,350 @@
+// internal/api/drafts.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// broadcastDraftChange tells subscribers of a post that its draft was replaced through
+// the REST API, in the same shape as a WebSocket edit.
+func (h *APIHandler) broadcastDraftChange(ctx context.Context, userID, postID string, newVersion int, changes []models.Change) {
+	if len(changes) == 0 {
+		return // Nothing changed
+	}
+	err := h.hub.BroadcastToItem(models.ItemTypePost, postID, models.WebSocketMessage{
+		Action: "content_changed",
+		Payload: models.BroadcastChangePayload{
+			ItemID: postID, ItemType: string(models.ItemTypePost),
+			Changes: changes, NewVersion: newVersion, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to broadcast draft change of post", "postID", postID, "error", err)
+	}
+}
+
+// GetDraft godoc
+// @Summary Preview a post's draft
+// @Description Returns the draft content of a post (the content edited over WebSocket) and whether it has changed since it was last published. The ETag is derived from the content hash and versions. Requires at least viewer access.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Param If-None-Match header string false "ETag of a draft the client already has"
+// @Success 200 {object} models.PostDraft "Draft and publishing state"
+// @Success 304 "Draft unchanged since the ETag"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/draft [get]
+func (h *APIHandler) GetDraft(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	draft, err := h.service.GetDraft(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if notModified(w, r, contentETag(draft.ContentHash, draft.Version, draft.PublishedVersion)) {
+		return
+	}
+	writeJSON(w, http.StatusOK, draft)
+}
+
+// SaveDraft godoc
+// @Summary Save a post's draft
+// @Description Replaces the draft content of a post, e.g. from an autosave. baseVersion must be the current draft version. Published content is not affected. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SaveDraftRequest true "Base version and full draft content"
+// @Security BearerAuth
+// @Success 200 {object} models.DraftSavedResponse "New draft version"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]interface{} "Draft changed since baseVersion; conflict holds the changes since or the current content"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /posts/{id}/draft [put]
+func (h *APIHandler) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	postID := r.PathValue("id")
+
+	var req models.SaveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	newVersion, changes, err := h.service.SaveDraft(r.Context(), userID, postID, req.BaseVersion, req.Content)
+	if errors.Is(err, service.ErrVersionConflict) {
+		h.writeVersionConflict(w, r, userID, postID, string(models.ItemTypePost), req.BaseVersion)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	h.broadcastDraftChange(r.Context(), userID, postID, newVersion, changes)
+	writeJSON(w, http.StatusOK, models.DraftSavedResponse{Version: newVersion})
+}
+
+// DiscardDraft godoc
+// @Summary Discard a post's draft
+// @Description Resets the draft of a post to its published content. The discarded edits remain in the history. Requires editor access.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param baseVersion query int true "Current draft version"
+// @Security BearerAuth
+// @Success 200 {object} models.DraftSavedResponse "New draft version"
+// @Failure 400 {object} map[string]string "Missing or invalid baseVersion"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found or never published"
+// @Failure 409 {object} map[string]string "Draft changed since baseVersion"
+// @Router /posts/{id}/draft [delete]
+func (h *APIHandler) DiscardDraft(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	postID := r.PathValue("id")
+
+	baseVersion, err := strconv.Atoi(r.URL.Query().Get("baseVersion"))
+	if err != nil || baseVersion < 1 {
+		writeError(w, http.StatusBadRequest, "baseVersion must be a positive integer")
+		return
+	}
+
+	newVersion, changes, err := h.service.DiscardDraft(r.Context(), userID, postID, baseVersion)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	h.broadcastDraftChange(r.Context(), userID, postID, newVersion, changes)
+	writeJSON(w, http.StatusOK, models.DraftSavedResponse{Version: newVersion})
+}
+
+// PublishPost godoc
+// @Summary Publish a post
+// @Description Promotes the current draft of a post to its published content. Pass the previewed version to make sure nothing changed in between. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.PublishPostRequest false "Draft version to publish"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Post metadata with publishing state"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Draft changed since the given version"
+// @Router /posts/{id}/publish [post]
+func (h *APIHandler) PublishPost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.PublishPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.PublishPost(r.Context(), userID, r.PathValue("id"), req.Version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// SchedulePost godoc
+// @Summary Schedule a post to be published
+// @Description Publishes the draft of a post at a later time, within a year: publishAt is either a local time such as 2026-10-20T09:00, read in timezone (an IANA name) or else the author's time zone, or an RFC 3339 time with an offset. With version, that draft version is published, and the schedule is dropped if the draft has moved on by then; without, the draft as it is then. Scheduling again replaces the schedule; publishing in between cancels it. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SchedulePostRequest true "When to publish"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Post metadata with its schedule (scheduledAt, in UTC)"
+// @Failure 400 {object} map[string]string "Invalid time or time zone"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Draft changed since the given version"
+// @Failure 503 {object} map[string]string "Scheduled publishing is unavailable"
+// @Router /posts/{id}/schedule [put]
+func (h *APIHandler) SchedulePost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SchedulePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SchedulePost(r.Context(), userID, r.PathValue("id"), req.PublishAt, strings.TrimSpace(req.Timezone), req.Version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// UnschedulePost godoc
+// @Summary Cancel a scheduled publish
+// @Description Cancels the scheduled publish of a post, if it has one. Requires editor access.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Post metadata"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/schedule [delete]
+func (h *APIHandler) UnschedulePost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	post, err := h.posts.UnschedulePost(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// GetPublishedPost godoc
+// @Summary Get a post's published content
+// @Description Returns the content the post was last published with. Requires at least viewer access.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param frontMatter query string false "Set to strip to leave the front-matter block out of the content" Enums(strip)
+// @Security BearerAuth
+// @Success 200 {object} models.PublishedPost "Published content"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found or never published"
+// @Router /posts/{id}/published [get]
+func (h *APIHandler) GetPublishedPost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	strip := r.URL.Query().Get("frontMatter") == "strip"
+	published, err := h.service.GetPublishedPost(r.Context(), userID, r.PathValue("id"), strip)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, published)
+}
+
+// SetPostExcerpt godoc
+// @Summary Set a post's excerpt
+// @Description Overrides the summary shown for a post in lists. By default the excerpt is generated from the first paragraph of the published content on every publish; a manual excerpt (at most 500 characters) is kept until it is cleared by setting an empty one. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SetPostExcerptRequest true "New excerpt, or empty to generate it"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Excerpt too long"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/excerpt [put]
+func (h *APIHandler) SetPostExcerpt(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetPostExcerptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SetPostExcerpt(r.Context(), userID, r.PathValue("id"), req.Excerpt)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// SetPostCoverImage godoc
+// @Summary Set a post's cover image
+// @Description Sets the image shown at the top of a post and in its previews to one of the owner's image assets (see /assets), or removes it given an empty assetId. Share links serve the cover at /shared/{token}/cover. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SetPostCoverImageRequest true "Asset ID, or empty to remove the cover"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Not an image asset of the post's owner"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/cover [put]
+func (h *APIHandler) SetPostCoverImage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetPostCoverImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SetPostCoverImage(r.Context(), userID, r.PathValue("id"), strings.TrimSpace(req.AssetID))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// UpdatePost godoc
+// @Summary Update a post's settings
+// @Description Changes any of a post's slug, excerpt, cover image and search engine metadata in one request; the first three as the PUT /posts/{id}/slug, /excerpt and /cover endpoints do. Omitted fields are left as they are. An empty excerpt goes back to the generated one, an empty coverImage removes the cover. canonicalUrl (an absolute http(s) URL) names the original if the post is republished from elsewhere; metaDescription (at most 300 characters) is shown in search results instead of the excerpt; noIndex keeps the published post out of search indexes. Invalid values are rejected before anything is changed. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.UpdatePostRequest true "Fields to change"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Invalid slug or canonical URL, excerpt or meta description too long, or not an image asset of the post's owner"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Slug already in use"
+// @Router /posts/{id} [patch]
+func (h *APIHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	postID := r.PathValue("id")
+
+	var req models.UpdatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.CoverImage != nil {
+		assetID := strings.TrimSpace(*req.CoverImage)
+		req.CoverImage = &assetID
+	}
+
+	post, err := h.posts.UpdatePost(r.Context(), userID, postID, req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	if req.Slug != nil {
+		err = h.hub.BroadcastToItem(models.ItemTypePost, postID, models.WebSocketMessage{
+			Action:  "slug_changed",
+			Payload: models.BroadcastSlugPayload{ItemID: postID, Slug: post.Slug, Originator: userID},
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to broadcast slug change of post", "postID", postID, "error", err)
+		}
+	}
+	writeJSON(w, http.StatusOK, post)
+}
@@ -0,0 +1,243 @@
+// internal/api/edits.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"log/slog"
+	"net/http"
+)
+
+// The handlers here make the WebSocket writes (create_post, create_codefile,
+// apply_changes, delete_item) available over HTTP, for clients and scripts that don't
+// keep a socket open. They go through the same service methods, and subscribers get the
+// same broadcasts.
+
+// CreatePost godoc
+// @Summary Create a post
+// @Description Creates a post, like create_post over WebSocket. The slug is generated from the title if empty; a templateId pre-fills the title and content where they are empty.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param request body models.CreatePostPayload true "Title, slug, initial content and template"
+// @Security BearerAuth
+// @Success 201 {object} models.Post "Created post"
+// @Failure 400 {object} map[string]string "Invalid request body, title or slug"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Failure 409 {object} map[string]string "Slug already taken"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /posts [post]
+func (h *APIHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.CreatePostPayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.service.CreatePostFromTemplate(r.Context(), userID, req.TemplateID, req.Title, req.Slug, req.InitialContent)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, post)
+}
+
+// CreateCodeFile godoc
+// @Summary Create a code file
+// @Description Creates a code file, like create_codefile over WebSocket. A templateId pre-fills the file name, language and content where they are empty.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param request body models.CreateCodeFilePayload true "File name, language, initial content and template"
+// @Security BearerAuth
+// @Success 201 {object} models.CodeFile "Created code file"
+// @Failure 400 {object} map[string]string "Invalid request body or file name"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /code [post]
+func (h *APIHandler) CreateCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.CreateCodeFilePayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, err := h.service.CreateCodeFileFromTemplate(r.Context(), userID, req.TemplateID, req.FileName, req.Language, req.InitialContent)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, file)
+}
+
+// ApplyPostChanges godoc
+// @Summary Edit a post's content
+// @Description Applies changes to a post's (draft) content, like apply_changes over WebSocket. baseVersion must be the current version, unless merge is set: then changes based on an older version are merged with the edits since. Subscribers receive the changes as a content_changed broadcast. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.ApplyChangesRequest true "Base version and changes"
+// @Security BearerAuth
+// @Success 200 {object} models.ApplyChangesSuccessPayload "New version"
+// @Failure 400 {object} map[string]string "Invalid request body, or a change doesn't apply"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]interface{} "Post changed since baseVersion (conflict holds the server state), or the merge conflicts (merge holds the conflicts)"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /posts/{id}/content [patch]
+func (h *APIHandler) ApplyPostChanges(w http.ResponseWriter, r *http.Request) {
+	h.applyItemChanges(w, r, models.ItemTypePost)
+}
+
+// ApplyCodeFileChanges godoc
+// @Summary Edit a code file's content
+// @Description Applies changes to a code file's content, like apply_changes over WebSocket. baseVersion must be the current version, unless merge is set: then changes based on an older version are merged with the edits since. Subscribers receive the changes as a content_changed broadcast. Requires editor access.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param request body models.ApplyChangesRequest true "Base version and changes"
+// @Security BearerAuth
+// @Success 200 {object} models.ApplyChangesSuccessPayload "New version"
+// @Failure 400 {object} map[string]string "Invalid request body, or a change doesn't apply"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Failure 409 {object} map[string]interface{} "Code file changed since baseVersion (conflict holds the server state), or the merge conflicts (merge holds the conflicts)"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /code/{id}/content [patch]
+func (h *APIHandler) ApplyCodeFileChanges(w http.ResponseWriter, r *http.Request) {
+	h.applyItemChanges(w, r, models.ItemTypeCodeFile)
+}
+
+// applyItemChanges answers a PATCH of the content of the item of itemType in the path.
+func (h *APIHandler) applyItemChanges(w http.ResponseWriter, r *http.Request, itemType models.ItemType) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemID := r.PathValue("id")
+	var req models.ApplyChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Changes) == 0 {
+		writeError(w, http.StatusBadRequest, "changes must not be empty")
+		return
+	}
+
+	success := models.ApplyChangesSuccessPayload{
+		ItemID: itemID, ItemType: string(itemType),
+		Message: "Changes applied successfully",
+	}
+	var newVersion int
+	var changes []models.Change
+	var err error
+	if req.Merge {
+		var outcome *service.MergeOutcome
+		outcome, err = h.content.MergeItemChanges(r.Context(), userID, itemID, string(itemType), req.BaseVersion, req.Changes)
+		if errors.Is(err, service.ErrMergeConflict) {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": service.ErrMergeConflict.Error(), "code": apperr.Conflict,
+				"merge": models.MergeConflictPayload{
+					ItemID: itemID, ItemType: string(itemType),
+					BaseVersion: req.BaseVersion, CurrentVersion: outcome.CurrentVersion,
+					Content: outcome.Content, Conflicts: outcome.Conflicts,
+				},
+			})
+			return
+		}
+		if err == nil {
+			newVersion, changes = outcome.NewVersion, outcome.Changes
+			if outcome.Merged {
+				success.Merged, success.Content = true, outcome.Content
+				success.Message = "Changes merged with newer version"
+			}
+		}
+	} else {
+		newVersion, changes, err = h.content.ApplyItemChanges(r.Context(), userID, itemID, string(itemType), req.BaseVersion, req.Changes)
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		h.writeVersionConflict(w, r, userID, itemID, string(itemType), req.BaseVersion)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	h.broadcastItemChange(r.Context(), userID, itemID, itemType, newVersion, changes)
+	success.NewVersion = newVersion
+	writeJSON(w, http.StatusOK, success)
+}
+
+// broadcastItemChange tells subscribers of an item about changes applied through the
+// REST API, as apply_changes would.
+func (h *APIHandler) broadcastItemChange(ctx context.Context, userID, itemID string, itemType models.ItemType, newVersion int, changes []models.Change) {
+	if len(changes) == 0 {
+		return // Merge was a no-op
+	}
+	err := h.hub.BroadcastToItem(itemType, itemID, models.WebSocketMessage{
+		Action: "content_changed",
+		Payload: models.BroadcastChangePayload{
+			ItemID: itemID, ItemType: string(itemType),
+			Changes: changes, NewVersion: newVersion, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to broadcast changes to item", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+}
+
+// DeletePost godoc
+// @Summary Delete a post
+// @Description Moves a post to the trash, like delete_item over WebSocket. Subscribers receive an item_deleted broadcast. Requires ownership.
+// @Tags posts
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 204 "Post deleted"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id} [delete]
+func (h *APIHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	h.deleteItem(w, r, models.ItemTypePost)
+}
+
+// DeleteCodeFile godoc
+// @Summary Delete a code file
+// @Description Moves a code file to the trash, like delete_item over WebSocket. Subscribers receive an item_deleted broadcast. Requires ownership.
+// @Tags codefiles
+// @Param id path string true "Code File ID"
+// @Security BearerAuth
+// @Success 204 "Code file deleted"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Router /code/{id} [delete]
+func (h *APIHandler) DeleteCodeFile(w http.ResponseWriter, r *http.Request) {
+	h.deleteItem(w, r, models.ItemTypeCodeFile)
+}
+
+// deleteItem answers a DELETE of the item of itemType in the path.
+func (h *APIHandler) deleteItem(w http.ResponseWriter, r *http.Request, itemType models.ItemType) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemID := r.PathValue("id")
+	if err := h.content.DeleteItem(r.Context(), userID, itemID, string(itemType)); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err := h.hub.BroadcastToItem(itemType, itemID, models.WebSocketMessage{
+		Action:  "item_deleted",
+		Payload: models.BroadcastDeletePayload{ItemID: itemID, ItemType: string(itemType)},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast deletion of item", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+	h.hub.DropSharedSubscribers(itemType, itemID) // Its share links no longer open it
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,32 @@
+// internal/api/events.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+)
+
+// ListItemEvents godoc
+// @Summary Poll for changes to your items
+// @Description Returns what happened to the caller's posts and code files after the cursor since, in the order it happened: created, updated (with the version it produced), deleted, restored, published, unpublished and purged from the trash. Each event has a number (seq) that grows with every event of the caller's. Pass the returned next as since on the following call; without since, listing starts with the oldest event the history still has. When more is true, call again right away. For backup agents, indexers and other tools that sync without WebSockets or webhooks.
+// @Tags items
+// @Produce json
+// @Param since query string false "Cursor from a previous page"
+// @Param limit query int false "Maximum number of events" default(100)
+// @Security BearerAuth
+// @Success 200 {object} models.ItemEventsPage "Events and the cursor to continue from"
+// @Failure 400 {object} map[string]string "Invalid cursor"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /events [get]
+func (h *APIHandler) ListItemEvents(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit")) // Invalid or missing: the default
+
+	page, err := h.history.ListItemEvents(r.Context(), userID, r.URL.Query().Get("since"), limit)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
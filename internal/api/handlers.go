@@ -3,9 +3,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/middleware"
 	"github.com/kkuzar/blog_system/internal/models"
 	"github.com/kkuzar/blog_system/internal/service"
-	"log"
+	"github.com/kkuzar/blog_system/internal/site"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"github.com/kkuzar/blog_system/internal/websocket"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,11 +21,22 @@ import (
 )
 
 type APIHandler struct {
-	service *service.Service
+	auth      service.AuthService
+	posts     service.PostService
+	codeFiles service.CodeFileService
+	content   service.ContentService
+	history   service.HistoryService
+	usage     service.UsageService
+	service   *service.Service // The rest; see service.Services
+	hub       *websocket.Hub   // Notifies WebSocket subscribers of changes made over HTTP
+	themes    *site.Themes     // For static exports
 }
 
-func NewAPIHandler(s *service.Service) *APIHandler {
-	return &APIHandler{service: s}
+func NewAPIHandler(s *service.Services, hub *websocket.Hub, themes *site.Themes) *APIHandler {
+	return &APIHandler{
+		auth: s.Auth, posts: s.Posts, codeFiles: s.CodeFiles, content: s.Content, history: s.History, usage: s.Usage,
+		service: s.Core, hub: hub, themes: themes,
+	}
 }
 
 // writeJSON is a helper to write JSON responses
@@ -27,7 +46,7 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
 			// Log error, but response header is already sent
-			log.Printf("Error encoding JSON response: %v", err)
+			slog.Error("Error encoding JSON response", "error", err)
 		}
 	}
 }
@@ -37,6 +56,55 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
 
+// contentETag derives the ETag of a response carrying content from the content's hash and
+// the versions reported alongside it, which can change while the content doesn't (e.g. a
+// revert to identical content).
+func contentETag(hash string, versions ...int) string {
+	etag := `"` + hash
+	for _, v := range versions {
+		etag += "." + strconv.Itoa(v)
+	}
+	return etag + `"`
+}
+
+// notModified sets the response's ETag and reports whether the client already has that
+// representation (If-None-Match), in which case it has been answered with 304.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// writeVersionConflict answers a write based on a stale version with 409 (code CONFLICT)
+// and the server state to rebase it on, under "conflict" (left out if it fails to load).
+func (h *APIHandler) writeVersionConflict(w http.ResponseWriter, r *http.Request, userID, itemID, itemType string, baseVersion int) {
+	body := map[string]interface{}{"error": service.ErrVersionConflict.Error(), "code": apperr.Conflict}
+	state, err := h.content.VersionConflictState(r.Context(), userID, itemID, itemType, baseVersion)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to load server state for version conflict", "itemType", itemType, "itemID", itemID, "baseVersion", baseVersion, "error", err)
+	} else {
+		body["conflict"] = state
+	}
+	writeJSON(w, http.StatusConflict, body)
+}
+
+// writeServiceError answers err with the HTTP status of its apperr code, and the code
+// itself under "code", as WebSocket errors carry it. Internal errors are logged (with the
+// request's fields) and answered with a generic message.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	code := apperr.CodeOf(err)
+	if code == apperr.Internal {
+		slog.ErrorContext(r.Context(), "Unhandled service error", "error", err)
+	}
+	writeJSON(w, apperr.HTTPStatus(code), map[string]string{"error": apperr.Message(err), "code": string(code)})
+}
+
 // Register godoc
 // @Summary Register a new user
 // @Description Creates a new user account.
@@ -56,13 +124,9 @@ func (h *APIHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.service.RegisterUser(r.Context(), req.Username, req.Password)
+	user, err := h.auth.RegisterUser(r.Context(), req.Username, req.Password)
 	if err != nil {
-		if err == service.ErrUsernameTaken {
-			writeError(w, http.StatusConflict, err.Error())
-		} else {
-			writeError(w, http.StatusInternalServerError, "Failed to register user")
-		}
+		writeServiceError(w, r, err)
 		return
 	}
 
@@ -88,13 +152,9 @@ func (h *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.service.LoginUser(r.Context(), req.Username, req.Password)
+	token, user, err := h.auth.LoginUser(r.Context(), req.Username, req.Password)
 	if err != nil {
-		if err == service.ErrInvalidCredentials {
-			writeError(w, http.StatusUnauthorized, err.Error())
-		} else {
-			writeError(w, http.StatusInternalServerError, "Login failed")
-		}
+		writeServiceError(w, r, err)
 		return
 	}
 
@@ -105,16 +165,44 @@ func (h *APIHandler) Login(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// IssueWSTicket godoc
+// @Summary Issue a WebSocket ticket
+// @Description Returns a short-lived, single-use ticket for connecting to /ws?ticket=..., so browser clients don't need to pass the raw JWT over the socket.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.WSTicketResponse "Ticket issued"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/ws-ticket [post]
+func (h *APIHandler) IssueWSTicket(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ticket, expiresAt, err := auth.GenerateWSTicket(userID, tenant.ID(r.Context()), middleware.GetKeyIDFromContext(r.Context()))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error issuing WebSocket ticket for user", "userID", userID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to issue ticket")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.WSTicketResponse{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
 // --- Read/List Handlers ---
 
 // ListPosts godoc
 // @Summary List posts metadata
-// @Description Get a list of post metadata for a user (or public, depending on implementation). Requires authentication.
+// @Description Get a list of post metadata for a user (or public, depending on implementation): pinned posts first, then posts in the user's manual order, then the rest newest first. Requires authentication.
 // @Tags posts
 // @Produce json
 // @Param userId query string true "User ID to list posts for" // Or get from context if listing own posts
 // @Param limit query int false "Limit number of results" default(10)
 // @Param offset query int false "Offset for pagination" default(0)
+// @Param include query string false "Set to \"archived\" to include archived posts"
 // @Security BearerAuth
 // @Success 200 {array} models.Post "List of post metadata"
 // @Failure 401 {object} map[string]string "Unauthorized"
@@ -144,7 +232,7 @@ func (h *APIHandler) ListPosts(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	posts, err := h.service.ListUserPosts(r.Context(), userID, limit, offset)
+	posts, err := h.posts.ListUserPosts(r.Context(), userID, limit, offset, includeArchived(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to list posts")
 		return
@@ -175,13 +263,9 @@ func (h *APIHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	}
 	postID := pathParts[3]
 
-	post, err := h.service.GetPostDetails(r.Context(), postID)
+	post, err := h.posts.GetPostDetails(r.Context(), postID)
 	if err != nil {
-		if err == service.ErrItemNotFound {
-			writeError(w, http.StatusNotFound, "Post not found")
-		} else {
-			writeError(w, http.StatusInternalServerError, "Failed to get post details")
-		}
+		writeServiceError(w, r, err)
 		return
 	}
 
@@ -203,6 +287,7 @@ func (h *APIHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 // @Param userId query string true "User ID to list code files for"
 // @Param limit query int false "Limit number of results" default(10)
 // @Param offset query int false "Offset for pagination" default(0)
+// @Param include query string false "Set to \"archived\" to include archived code files"
 // @Security BearerAuth
 // @Success 200 {array} models.CodeFile "List of code file metadata"
 // @Failure 401 {object} map[string]string "Unauthorized"
@@ -224,7 +309,7 @@ func (h *APIHandler) ListCodeFiles(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	files, err := h.service.ListUserCodeFiles(r.Context(), userID, limit, offset)
+	files, err := h.codeFiles.ListUserCodeFiles(r.Context(), userID, limit, offset, includeArchived(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to list code files")
 		return
@@ -253,13 +338,9 @@ func (h *APIHandler) GetCodeFile(w http.ResponseWriter, r *http.Request) {
 	}
 	fileID := pathParts[3]
 
-	file, err := h.service.GetCodeFileDetails(r.Context(), fileID)
+	file, err := h.codeFiles.GetCodeFileDetails(r.Context(), fileID)
 	if err != nil {
-		if err == service.ErrItemNotFound {
-			writeError(w, http.StatusNotFound, "Code file not found")
-		} else {
-			writeError(w, http.StatusInternalServerError, "Failed to get code file details")
-		}
+		writeServiceError(w, r, err)
 		return
 	}
 
@@ -272,3 +353,128 @@ func (h *APIHandler) GetCodeFile(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, file)
 }
+
+// RenameCodeFile godoc
+// @Summary Rename or move a code file
+// @Description Sets a code file's path (e.g. "src/main.go"); the file name is its last element. Content and version are unchanged. Requires ownership.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param request body models.RenameCodeFileRequest true "New path"
+// @Security BearerAuth
+// @Success 200 {object} models.CodeFile "Updated code file metadata"
+// @Failure 400 {object} map[string]string "Invalid path"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Router /code/{id} [patch]
+func (h *APIHandler) RenameCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileID := r.PathValue("id")
+
+	var req models.RenameCodeFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, err := h.codeFiles.RenameCodeFile(r.Context(), userID, fileID, req.Path)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = h.hub.BroadcastToItem(models.ItemTypeCodeFile, fileID, models.WebSocketMessage{
+		Action: "item_renamed",
+		Payload: models.BroadcastRenamePayload{
+			ItemID: fileID, ItemType: string(models.ItemTypeCodeFile),
+			FileName: file.FileName, Path: file.Path, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast rename of codefile", "fileID", fileID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
+
+// FormatCodeFile godoc
+// @Summary Format a code file
+// @Description Runs the formatter for the file's language (gofmt, or a configured command such as prettier) over the current content and saves the result as a new version. Subscribers receive the edit as a content_changed broadcast. Requires editor access.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param request body models.FormatCodeRequest false "Optional expected version"
+// @Security BearerAuth
+// @Success 200 {object} models.FormatCodeResponse "New version, or the current one if nothing changed"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Failure 409 {object} map[string]string "baseVersion is not the current version"
+// @Failure 422 {object} map[string]string "No formatter for the language, or the formatter rejected the content"
+// @Failure 503 {object} map[string]string "Formatter timed out"
+// @Router /code/{id}/format [post]
+func (h *APIHandler) FormatCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileID := r.PathValue("id")
+
+	var req models.FormatCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	newVersion, changes, err := h.codeFiles.FormatCodeFile(r.Context(), userID, fileID, req.BaseVersion)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	if len(changes) > 0 {
+		err = h.hub.BroadcastToItem(models.ItemTypeCodeFile, fileID, models.WebSocketMessage{
+			Action: "content_changed",
+			Payload: models.BroadcastChangePayload{
+				ItemID: fileID, ItemType: string(models.ItemTypeCodeFile),
+				Changes: changes, NewVersion: newVersion, Originator: userID,
+			},
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to broadcast formatting of codefile", "fileID", fileID, "error", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, models.FormatCodeResponse{ItemID: fileID, NewVersion: newVersion, Changed: len(changes) > 0})
+}
+
+// RunCodeFile godoc
+// @Summary Run a code file
+// @Description Executes the current content of a code file in a sandbox with the given stdin, under the server's time, memory and output limits. A program that fails or hits a limit still returns 200; check exitCode, timedOut and outOfMemory. Requires viewer access.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param request body models.RunCodeRequest false "Program input"
+// @Security BearerAuth
+// @Success 200 {object} runner.Result "Program output"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Failure 413 {object} map[string]string "stdin too large"
+// @Failure 422 {object} map[string]string "The file's language can't be run"
+// @Failure 503 {object} map[string]string "Code execution is not enabled"
+// @Router /code/{id}/run [post]
+func (h *APIHandler) RunCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.RunCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.codeFiles.RunCodeFile(r.Context(), userID, r.PathValue("id"), req.Stdin)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
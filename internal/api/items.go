@@ -0,0 +1,356 @@
+// internal/api/items.go
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handlers for /api/v1/items/{type}/{id}/..., which work for both posts and code files.
+
+// GetItemVersion godoc
+// @Summary Get item content at a version
+// @Description Returns the content of a post or code file as it was at the given version. Requires ownership.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param version path int true "Version number"
+// @Security BearerAuth
+// @Success 200 {object} models.ContentResponsePayload "Content at the requested version"
+// @Failure 400 {object} map[string]string "Invalid item type or version"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or version not found"
+// @Failure 410 {object} map[string]string "Version content not retained"
+// @Router /items/{type}/{id}/versions/{version} [get]
+func (h *APIHandler) GetItemVersion(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemType := r.PathValue("type")
+	itemID := r.PathValue("id")
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 1 {
+		writeError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	content, err := h.content.GetItemContentAtVersion(r.Context(), userID, itemID, itemType, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ContentResponsePayload{
+		ItemID: itemID, ItemType: itemType, Content: content, Version: version,
+	})
+}
+
+// GetItemChanges godoc
+// @Summary Get the changes made to an item since a version
+// @Description Returns the batches of changes that took a post or code file from sinceVersion to its current version, oldest first, for incremental sync after a reconnect. If they are no longer all in the history (e.g. a revert in between), reload the content instead. Requires at least viewer access.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param sinceVersion query int true "Version the client has"
+// @Security BearerAuth
+// @Success 200 {object} models.ChangesSincePayload "Changes since the version"
+// @Failure 400 {object} map[string]string "Invalid item type or version"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or version not found"
+// @Failure 410 {object} map[string]string "Changes not available; reload the content"
+// @Router /items/{type}/{id}/changes [get]
+func (h *APIHandler) GetItemChanges(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	sinceVersion, err := strconv.Atoi(r.URL.Query().Get("sinceVersion"))
+	if err != nil || sinceVersion < 1 {
+		writeError(w, http.StatusBadRequest, "sinceVersion query parameter must be a positive integer")
+		return
+	}
+
+	result, err := h.content.GetChangesSince(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), sinceVersion)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetItemContent godoc
+// @Summary Get an item's current content
+// @Description Returns the current content of a post or code file as text. A Range header asks for part of it, so editors can load large files lazily: "bytes=<first>-[<last>]" (0-based offsets) or "lines=<first>-[<last>]" (1-based line numbers), both inclusive. Byte ranges are widened so as not to split a UTF-8 character, and the part sent is described by Content-Range. Requires at least viewer access.
+// @Tags items
+// @Produce plain
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param Range header string false "Part of the content, e.g. bytes=0-65535 or lines=1-200"
+// @Security BearerAuth
+// @Success 200 {string} string "The whole content"
+// @Success 206 {string} string "The requested part of the content"
+// @Failure 400 {object} map[string]string "Invalid item type or range"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Failure 416 {object} map[string]string "Range starts past the end of the content"
+// @Router /items/{type}/{id}/content [get]
+func (h *APIHandler) GetItemContent(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemType := r.PathValue("type")
+	itemID := r.PathValue("id")
+	w.Header().Set("Accept-Ranges", "bytes, lines")
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		content, version, err := h.content.GetItemContent(r.Context(), userID, itemID, itemType)
+		if err != nil {
+			writeServiceError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Item-Version", strconv.Itoa(version))
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, content)
+		return
+	}
+
+	req, ok := parseContentRange(rangeHeader)
+	if !ok {
+		writeError(w, http.StatusBadRequest, service.ErrInvalidRange.Error())
+		return
+	}
+	req.ItemID, req.ItemType = itemID, itemType
+	part, err := h.content.GetItemContentRange(r.Context(), userID, itemID, itemType, req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", part.Unit, part.Start, part.End, part.Total))
+	w.Header().Set("X-Item-Version", strconv.Itoa(part.Version))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = io.WriteString(w, part.Content)
+}
+
+// parseContentRange parses a Range header asking for a single range of bytes or lines,
+// e.g. "bytes=0-1023" or "lines=100-". Suffix ranges ("bytes=-500") aren't supported.
+func parseContentRange(header string) (models.GetContentRangePayload, bool) {
+	var req models.GetContentRangePayload
+	unit, spec, ok := strings.Cut(strings.TrimSpace(header), "=")
+	if !ok || (unit != models.RangeBytes && unit != models.RangeLines) || strings.Contains(spec, ",") {
+		return req, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return req, false
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return req, false
+	}
+	req.Unit, req.Start = unit, start
+	if last != "" {
+		end, err := strconv.Atoi(last)
+		if err != nil {
+			return req, false
+		}
+		req.End = &end
+	}
+	return req, true
+}
+
+// DownloadItem godoc
+// @Summary Download an item's current content
+// @Description Streams the current content of a post (as <slug>.md) or code file (under its file name) as an attachment, without a JSON envelope. Requires at least viewer access.
+// @Tags items
+// @Produce plain
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {file} file "The content"
+// @Success 304 "Content unchanged (If-None-Match)"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/download [get]
+func (h *APIHandler) DownloadItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemType := r.PathValue("type")
+	itemID := r.PathValue("id")
+
+	download, err := h.content.DownloadItem(r.Context(), userID, itemID, itemType)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeDownload(w, r, download)
+}
+
+// writeDownload sends a download as an attachment, or 304 if the client has it already,
+// and closes its body.
+func writeDownload(w http.ResponseWriter, r *http.Request, download *service.ItemDownload) {
+	defer download.Body.Close()
+
+	if download.ContentHash != "" && notModified(w, r, contentETag(download.ContentHash, download.Version)) {
+		return
+	}
+	w.Header().Set("Content-Type", download.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(download.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": download.FileName}))
+	w.Header().Set("X-Item-Version", strconv.Itoa(download.Version))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, download.Body); err != nil {
+		slog.WarnContext(r.Context(), "Download interrupted", "path", r.URL.Path, "error", err)
+	}
+}
+
+// GetItemDiff godoc
+// @Summary Diff two versions of an item
+// @Description Returns a structured and unified line diff between two versions of a post or code file. Omit "to" to diff against the current version.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param from query int true "Base version"
+// @Param to query int false "Target version (defaults to current)"
+// @Security BearerAuth
+// @Success 200 {object} models.VersionDiffPayload "Diff between the versions"
+// @Failure 400 {object} map[string]string "Invalid item type or version"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or version not found"
+// @Failure 410 {object} map[string]string "Version content not retained"
+// @Router /items/{type}/{id}/diff [get]
+func (h *APIHandler) GetItemDiff(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fromVersion, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || fromVersion < 1 {
+		writeError(w, http.StatusBadRequest, "from query parameter must be a positive integer")
+		return
+	}
+	toVersion := 0 // Current version
+	if to := r.URL.Query().Get("to"); to != "" {
+		toVersion, err = strconv.Atoi(to)
+		if err != nil || toVersion < 1 {
+			writeError(w, http.StatusBadRequest, "to query parameter must be a positive integer")
+			return
+		}
+	}
+
+	result, err := h.content.DiffItemVersions(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), fromVersion, toVersion)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// CloneItem godoc
+// @Summary Clone an item
+// @Description Copies a post or code file (metadata and current content) into a new item at version 1. The body is optional; without a name the copy is named after the source. Requires ownership.
+// @Tags items
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CloneItemRequest false "Name of the copy"
+// @Security BearerAuth
+// @Success 201 {object} models.Post "The new post or code file"
+// @Failure 400 {object} map[string]string "Invalid item type or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /items/{type}/{id}/clone [post]
+func (h *APIHandler) CloneItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CloneItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.service.CloneItem(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), strings.TrimSpace(req.Name))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// CreateSnapshot godoc
+// @Summary Snapshot an item
+// @Description Checkpoints the current version of a post or code file, regardless of the automatic snapshot interval. The snapshot appears in the item's history with the optional label and can be reverted to like any other entry. Requires editor access.
+// @Tags items
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CreateSnapshotRequest false "Snapshot label"
+// @Security BearerAuth
+// @Success 201 {object} models.HistoryLog "The snapshot's history entry"
+// @Failure 400 {object} map[string]string "Invalid item type, label or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Failure 410 {object} map[string]string "Current content can't be rebuilt"
+// @Router /items/{type}/{id}/snapshots [post]
+func (h *APIHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	itemID, itemType := r.PathValue("id"), r.PathValue("type")
+
+	var req models.CreateSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	snapshot, err := h.history.CreateSnapshot(r.Context(), userID, itemID, itemType, req.Label)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = h.hub.BroadcastToItem(models.ItemType(itemType), itemID, models.WebSocketMessage{
+		Action: "item_snapshotted",
+		Payload: models.BroadcastSnapshotPayload{
+			ItemID: itemID, ItemType: itemType, LogID: snapshot.ID,
+			Version: snapshot.ItemVersion, Label: snapshot.Label, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast snapshot", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+// ListItemChecks godoc
+// @Summary Get content check results
+// @Description Returns the latest findings of each content hook (e.g. the link checker) for a post or code file. Each result names the version it looked at; hooks that run in the background may lag behind the current version. Requires at least viewer access.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {array} models.HookResult "One result per hook, by hook name"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/checks [get]
+func (h *APIHandler) ListItemChecks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	results, err := h.service.ListHookResults(r.Context(), userID, r.PathValue("id"), r.PathValue("type"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
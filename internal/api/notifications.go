@@ -0,0 +1,140 @@
+// internal/api/notifications.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// GetPushKey godoc
+// @Summary Get the Web Push public key
+// @Description Returns the server's VAPID public key, base64url-encoded: the applicationServerKey to pass to pushManager.subscribe.
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} map[string]string "Public key"
+// @Failure 503 {object} map[string]string "Web Push is disabled"
+// @Router /push/key [get]
+func (h *APIHandler) GetPushKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.service.PushPublicKey()
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"publicKey": key})
+}
+
+// ListPushSubscriptions godoc
+// @Summary List your push subscriptions
+// @Description Returns the browsers the current user gets notifications in, oldest first.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PushSubscription "Subscriptions"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/push/subscriptions [get]
+func (h *APIHandler) ListPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	subs, err := h.service.ListPushSubscriptions(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// SubscribePush godoc
+// @Summary Subscribe a browser to notifications
+// @Description Saves the browser's PushSubscription (as its toJSON method gives it), so the current user gets notifications in it. Subscribing the same endpoint again replaces the subscription.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body models.PushSubscriptionRequest true "Push subscription"
+// @Security BearerAuth
+// @Success 201 {object} models.PushSubscription "Subscription"
+// @Failure 400 {object} map[string]string "Invalid subscription"
+// @Failure 503 {object} map[string]string "Web Push is disabled"
+// @Router /users/me/push/subscriptions [post]
+func (h *APIHandler) SubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.PushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	sub, err := h.service.SubscribePush(r.Context(), userID, &req, r.UserAgent())
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// UnsubscribePush godoc
+// @Summary Unsubscribe a browser from notifications
+// @Description Stops sending the current user's notifications to a browser.
+// @Tags notifications
+// @Param id path string true "Subscription ID"
+// @Security BearerAuth
+// @Success 204 "Subscription removed"
+// @Failure 404 {object} map[string]string "Subscription not found"
+// @Router /users/me/push/subscriptions/{id} [delete]
+func (h *APIHandler) UnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.UnsubscribePush(r.Context(), userID, r.PathValue("id")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNotificationPreferences godoc
+// @Summary Get your notification preferences
+// @Description Returns which notification types the current user gets: edit (a collaborator edited your item), share (you were made a collaborator), transfer (you were offered an item), publish (your scheduled post went out), mention (you were mentioned in a comment, also emailed) and digest (the periodic activity email).
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.NotificationPreferences "Preferences"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/notifications [get]
+func (h *APIHandler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	prefs, err := h.service.GetNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// SetNotificationPreferences godoc
+// @Summary Set your notification preferences
+// @Description Turns notification types on (true) or off (false) for the current user. Types left out keep their setting.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body models.NotificationPreferences true "Preferences"
+// @Security BearerAuth
+// @Success 200 {object} models.NotificationPreferences "Preferences"
+// @Failure 400 {object} map[string]string "Unknown notification type"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/notifications [put]
+func (h *APIHandler) SetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	prefs, err := h.service.SetNotificationPreferences(r.Context(), userID, &req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
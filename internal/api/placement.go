@@ -0,0 +1,84 @@
+// internal/api/placement.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// PinPost godoc
+// @Summary Pin a post
+// @Description Lists a post at the top of its owner's post listing, ahead of posts ordered with PUT /posts/order. Requires ownership.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/pin [post]
+func (h *APIHandler) PinPost(w http.ResponseWriter, r *http.Request) {
+	h.setPostPinned(w, r, true)
+}
+
+// UnpinPost godoc
+// @Summary Unpin a post
+// @Description Returns a pinned post to its place in its owner's post listing. Requires ownership.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/unpin [post]
+func (h *APIHandler) UnpinPost(w http.ResponseWriter, r *http.Request) {
+	h.setPostPinned(w, r, false)
+}
+
+func (h *APIHandler) setPostPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var post *models.Post
+	var err error
+	if pinned {
+		post, err = h.posts.PinPost(r.Context(), userID, r.PathValue("id"))
+	} else {
+		post, err = h.posts.UnpinPost(r.Context(), userID, r.PathValue("id"))
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// SetPostOrder godoc
+// @Summary Order your posts
+// @Description Sets the manual order of the caller's post listing: the given posts (at most 100) are listed first, after pinned posts, in the given order. Posts left out are listed by date, newest first; an empty list removes the manual order.
+// @Tags posts
+// @Accept json
+// @Param request body models.SetPostOrderRequest true "Posts in listing order"
+// @Security BearerAuth
+// @Success 204 "Order saved"
+// @Failure 400 {object} map[string]string "Too many or duplicate posts"
+// @Failure 403 {object} map[string]string "A post is not yours"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/order [put]
+func (h *APIHandler) SetPostOrder(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetPostOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.posts.SetPostOrder(r.Context(), userID, req.PostIDs); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
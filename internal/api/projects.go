@@ -0,0 +1,161 @@
+// internal/api/projects.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Handlers for /api/v1/projects/... and moving code files between projects.
+
+// CreateProject godoc
+// @Summary Create a project
+// @Description Creates an empty project for grouping the current user's code files.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param request body models.CreateProjectRequest true "Project name and description"
+// @Security BearerAuth
+// @Success 201 {object} models.Project "The new project"
+// @Failure 400 {object} map[string]string "Missing name or invalid body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects [post]
+func (h *APIHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CreateProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project, err := h.service.CreateProject(r.Context(), userID, req.Name, req.Description)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, project)
+}
+
+// ListProjects godoc
+// @Summary List projects
+// @Description Lists the current user's projects, sorted by name.
+// @Tags projects
+// @Produce json
+// @Param limit query int false "Limit number of results" default(50)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.Project "Projects"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /projects [get]
+func (h *APIHandler) ListProjects(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	projects, err := h.service.ListProjects(r.Context(), userID, limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, projects)
+}
+
+// ListProjectFiles godoc
+// @Summary List the code files in a project
+// @Description Returns metadata for every code file in the project, sorted by path. Requires ownership.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Security BearerAuth
+// @Success 200 {array} models.CodeFile "Code files"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/files [get]
+func (h *APIHandler) ListProjectFiles(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	files, err := h.service.ListProjectFiles(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+// GetProjectTree godoc
+// @Summary Get a project's folder tree
+// @Description Returns the project's code files arranged into folders by path. Folders come before files and are sorted by name. Requires ownership.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Security BearerAuth
+// @Success 200 {object} models.ProjectTreeNode "Root of the tree"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Router /projects/{id}/tree [get]
+func (h *APIHandler) GetProjectTree(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	tree, err := h.service.GetProjectTree(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// MoveCodeFile godoc
+// @Summary Move a code file to another project
+// @Description Moves a code file into a project, or out of any project when projectId is empty, optionally changing its path. Requires ownership of the file and the project.
+// @Tags codefiles
+// @Accept json
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param request body models.MoveCodeFileRequest true "Target project and optional path"
+// @Security BearerAuth
+// @Success 200 {object} models.CodeFile "Updated code file metadata"
+// @Failure 400 {object} map[string]string "Invalid path or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file or project not found"
+// @Router /code/{id}/move [post]
+func (h *APIHandler) MoveCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileID := r.PathValue("id")
+
+	var req models.MoveCodeFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, err := h.codeFiles.MoveCodeFile(r.Context(), userID, fileID, req.ProjectID, req.Path)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = h.hub.BroadcastToItem(models.ItemTypeCodeFile, fileID, models.WebSocketMessage{
+		Action: "item_moved",
+		Payload: models.BroadcastRenamePayload{
+			ItemID: fileID, ItemType: string(models.ItemTypeCodeFile),
+			FileName: file.FileName, Path: file.Path, ProjectID: file.ProjectID, Originator: userID,
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast move of codefile", "fileID", fileID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
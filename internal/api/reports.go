@@ -0,0 +1,135 @@
+// internal/api/reports.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// ReportContent godoc
+// @Summary Report abusive content
+// @Description Reports a published post, or with commentId an approved comment on a post or code file, to the admins. Requires signing in, and for a comment being able to read it.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param request body models.ReportRequest true "What is reported and why"
+// @Security BearerAuth
+// @Success 201 {object} models.Report "The report"
+// @Failure 400 {object} map[string]string "Invalid item type, reason or details"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Post or comment not found"
+// @Failure 409 {object} map[string]string "Already reported by this user"
+// @Failure 429 {object} map[string]string "Too many reports"
+// @Router /reports [post]
+func (h *APIHandler) ReportContent(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	report, err := h.service.ReportContent(r.Context(), userID, &req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, report)
+}
+
+// ListReports godoc
+// @Summary List abuse reports
+// @Description Returns the reports with a status (open by default, or any if empty), newest first, with an excerpt of what was reported. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Param status query string false "Report status" Enums(open, actioned, dismissed) default(open)
+// @Param limit query int false "Limit number of results" default(50)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Security BearerAuth
+// @Success 200 {array} models.Report "Reports"
+// @Failure 400 {object} map[string]string "Invalid status"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Router /admin/reports [get]
+func (h *APIHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	status := models.ReportOpen
+	if values, ok := r.URL.Query()["status"]; ok {
+		status = models.ReportStatus(values[0])
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	reports, err := h.service.ListReports(r.Context(), status, limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// ResolveReport godoc
+// @Summary Resolve an abuse report
+// @Description Closes an open report, either dismissing it or taking the reported content down: a post is unpublished (its owner keeps the draft, but can't publish it again until an admin reinstates it) and a comment deleted. Requires admin access.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Report ID"
+// @Param request body models.ResolveReportRequest true "Action and note"
+// @Security BearerAuth
+// @Success 200 {object} models.Report "The resolved report"
+// @Failure 400 {object} map[string]string "Invalid action or note"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 404 {object} map[string]string "Report not found"
+// @Failure 409 {object} map[string]string "Report already resolved"
+// @Router /admin/reports/{id}/resolve [post]
+func (h *APIHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	report, err := h.service.ResolveReport(r.Context(), userID, r.PathValue("id"), &req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ReinstatePost godoc
+// @Summary Reinstate a post taken down on a report
+// @Description Lets the owner of a post that was taken down on a report publish it again. The post stays unpublished until they do. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "The reinstated post"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /admin/posts/{id}/reinstate [post]
+func (h *APIHandler) ReinstatePost(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	post, err := h.service.ReinstatePost(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
@@ -4,6 +4,7 @@ package api
 import (
 	"github.com/kkuzar/blog_system/internal/middleware"
 	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/site"
 	"github.com/kkuzar/blog_system/internal/websocket"
 	"net/http"
 	"strings"
@@ -13,22 +14,27 @@ import (
 )
 
 // SetupRoutes configures the HTTP routes using the standard library's ServeMux.
-func SetupRoutes(mux *http.ServeMux, service *service.Service, wsHub *websocket.Hub) {
-	apiHandler := NewAPIHandler(service)
-	wsHandler := websocket.NewWebSocketHandler(service, wsHub)
+func SetupRoutes(mux *http.ServeMux, services *service.Services, wsHub *websocket.Hub, themes *site.Themes, pages *site.PageCache) {
+	apiHandler := NewAPIHandler(services, wsHub, themes)
+	wsHandler := websocket.NewWebSocketHandler(services, wsHub)
 
 	// Public routes (authentication)
 	mux.HandleFunc("POST /api/v1/auth/register", apiHandler.Register)
 	mux.HandleFunc("POST /api/v1/auth/login", apiHandler.Login)
+	mux.HandleFunc("POST /api/v1/auth/ws-ticket", middleware.AuthMiddleware(apiHandler.IssueWSTicket))
 
-	// WebSocket upgrade endpoint (authentication handled within the WS connection)
+	mux.HandleFunc("GET /api/v1/shared/{token}", apiHandler.GetSharedItem) // Public; the token is the credential
+	mux.HandleFunc("GET /api/v1/shared/{token}/cover", apiHandler.GetSharedCoverImage)
+	mux.HandleFunc("GET /api/v1/public/users/{userId}/posts/{slug}", pages.Wrap(apiHandler.GetPublicPost)) // Published posts only
+
+	// WebSocket upgrade endpoint (Authorization header, ?ticket=, or in-band "auth" message)
 	mux.HandleFunc("/ws", wsHandler.HandleConnections)
 
-	// --- Protected Routes (Read/List only via HTTP) ---
+	// --- Protected Routes ---
 	// We need a simple way to group routes under middleware without a framework.
 	// We can wrap the final handler function.
 
-	// Posts API (Read/List)
+	// Posts API (Read/List; the writes below are more specific routes)
 	mux.HandleFunc("/api/v1/posts", func(w http.ResponseWriter, r *http.Request) {
 		// Basic path matching for standard library mux
 		if r.Method == http.MethodGet && r.URL.Path == "/api/v1/posts" {
@@ -53,7 +59,32 @@ func SetupRoutes(mux *http.ServeMux, service *service.Service, wsHub *websocket.
 		}
 	})
 
-	// CodeFiles API (Read/List)
+	// Post writes (as over WebSocket)
+	mux.HandleFunc("POST /api/v1/posts", middleware.AuthMiddleware(apiHandler.CreatePost))
+	mux.HandleFunc("PATCH /api/v1/posts/{id}/content", middleware.AuthMiddleware(apiHandler.ApplyPostChanges))
+	mux.HandleFunc("DELETE /api/v1/posts/{id}", middleware.AuthMiddleware(apiHandler.DeletePost))
+
+	// Post drafts and publishing (the live, WebSocket-edited content is the draft)
+	mux.HandleFunc("GET /api/v1/posts/{id}/draft", middleware.AuthMiddleware(apiHandler.GetDraft))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/draft", middleware.AuthMiddleware(apiHandler.SaveDraft))
+	mux.HandleFunc("DELETE /api/v1/posts/{id}/draft", middleware.AuthMiddleware(apiHandler.DiscardDraft))
+	mux.HandleFunc("POST /api/v1/posts/{id}/publish", middleware.AuthMiddleware(apiHandler.PublishPost))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/schedule", middleware.AuthMiddleware(apiHandler.SchedulePost))
+	mux.HandleFunc("DELETE /api/v1/posts/{id}/schedule", middleware.AuthMiddleware(apiHandler.UnschedulePost))
+	mux.HandleFunc("GET /api/v1/posts/{id}/published", middleware.AuthMiddleware(apiHandler.GetPublishedPost))
+	mux.HandleFunc("PATCH /api/v1/posts/{id}", middleware.AuthMiddleware(apiHandler.UpdatePost))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/slug", middleware.AuthMiddleware(apiHandler.SetPostSlug))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/excerpt", middleware.AuthMiddleware(apiHandler.SetPostExcerpt))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/cover", middleware.AuthMiddleware(apiHandler.SetPostCoverImage))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/language", middleware.AuthMiddleware(apiHandler.SetPostLanguage))
+	mux.HandleFunc("GET /api/v1/posts/{id}/translations", middleware.AuthMiddleware(apiHandler.ListPostTranslations))
+
+	// Placement in the owner's post listing
+	mux.HandleFunc("POST /api/v1/posts/{id}/pin", middleware.AuthMiddleware(apiHandler.PinPost))
+	mux.HandleFunc("POST /api/v1/posts/{id}/unpin", middleware.AuthMiddleware(apiHandler.UnpinPost))
+	mux.HandleFunc("PUT /api/v1/posts/order", middleware.AuthMiddleware(apiHandler.SetPostOrder))
+
+	// CodeFiles API (Read/List; the writes below are more specific routes)
 	mux.HandleFunc("/api/v1/code", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet && r.URL.Path == "/api/v1/code" {
 			middleware.AuthMiddleware(apiHandler.ListCodeFiles)(w, r)
@@ -75,6 +106,139 @@ func SetupRoutes(mux *http.ServeMux, service *service.Service, wsHub *websocket.
 		}
 	})
 
+	mux.HandleFunc("POST /api/v1/code", middleware.AuthMiddleware(apiHandler.CreateCodeFile))
+	mux.HandleFunc("PATCH /api/v1/code/{id}/content", middleware.AuthMiddleware(apiHandler.ApplyCodeFileChanges))
+	mux.HandleFunc("DELETE /api/v1/code/{id}", middleware.AuthMiddleware(apiHandler.DeleteCodeFile))
+	mux.HandleFunc("POST /api/v1/code/upload", middleware.AuthMiddleware(apiHandler.UploadCodeFile))
+	mux.HandleFunc("PUT /api/v1/code/{id}/upload", middleware.AuthMiddleware(apiHandler.ReplaceCodeFileContent))
+	mux.HandleFunc("PATCH /api/v1/code/{id}", middleware.AuthMiddleware(apiHandler.RenameCodeFile))
+	mux.HandleFunc("POST /api/v1/code/{id}/move", middleware.AuthMiddleware(apiHandler.MoveCodeFile))
+	mux.HandleFunc("POST /api/v1/code/{id}/format", middleware.AuthMiddleware(apiHandler.FormatCodeFile))
+	mux.HandleFunc("POST /api/v1/code/{id}/run", middleware.AuthMiddleware(apiHandler.RunCodeFile))
+
+	// Workspaces API (separate contexts for posts and code files)
+	mux.HandleFunc("POST /api/v1/workspaces", middleware.AuthMiddleware(apiHandler.CreateWorkspace))
+	mux.HandleFunc("GET /api/v1/workspaces", middleware.AuthMiddleware(apiHandler.ListWorkspaces))
+	mux.HandleFunc("GET /api/v1/workspaces/{id}/items", middleware.AuthMiddleware(apiHandler.ListWorkspaceItems))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/workspace", middleware.AuthMiddleware(apiHandler.MoveItemToWorkspace))
+
+	// Projects API (groups code files into folder trees)
+	mux.HandleFunc("POST /api/v1/projects", middleware.AuthMiddleware(apiHandler.CreateProject))
+	mux.HandleFunc("GET /api/v1/projects", middleware.AuthMiddleware(apiHandler.ListProjects))
+	mux.HandleFunc("GET /api/v1/projects/{id}/files", middleware.AuthMiddleware(apiHandler.ListProjectFiles))
+	mux.HandleFunc("GET /api/v1/projects/{id}/tree", middleware.AuthMiddleware(apiHandler.GetProjectTree))
+
+	// Assets API (binary workspace files; replaced whole, never patched)
+	mux.HandleFunc("POST /api/v1/assets", middleware.AuthMiddleware(apiHandler.UploadAsset))
+	mux.HandleFunc("GET /api/v1/assets", middleware.AuthMiddleware(apiHandler.ListAssets))
+	mux.HandleFunc("GET /api/v1/assets/{id}", middleware.AuthMiddleware(apiHandler.GetAsset))
+	mux.HandleFunc("GET /api/v1/assets/{id}/download", middleware.AuthMiddleware(apiHandler.DownloadAsset))
+	mux.HandleFunc("PUT /api/v1/assets/{id}", middleware.AuthMiddleware(apiHandler.ReplaceAsset))
+	mux.HandleFunc("DELETE /api/v1/assets/{id}", middleware.AuthMiddleware(apiHandler.DeleteAsset))
+
+	// Items API (works across posts and code files)
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/versions/{version}", middleware.AuthMiddleware(apiHandler.GetItemVersion))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/diff", middleware.AuthMiddleware(apiHandler.GetItemDiff))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/content", middleware.AuthMiddleware(apiHandler.GetItemContent))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/download", middleware.AuthMiddleware(apiHandler.DownloadItem))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/changes", middleware.AuthMiddleware(apiHandler.GetItemChanges))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/stats", middleware.AuthMiddleware(apiHandler.GetItemStats))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/clone", middleware.AuthMiddleware(apiHandler.CloneItem))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/restore", middleware.AuthMiddleware(apiHandler.RestoreItem))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/snapshots", middleware.AuthMiddleware(apiHandler.CreateSnapshot))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/tags", middleware.AuthMiddleware(apiHandler.ListVersionTags))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/tags", middleware.AuthMiddleware(apiHandler.CreateVersionTag))
+	mux.HandleFunc("DELETE /api/v1/items/{type}/{id}/tags/{name}", middleware.AuthMiddleware(apiHandler.DeleteVersionTag))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/tags/{name}/revert", middleware.AuthMiddleware(apiHandler.RevertToTag))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/comments", middleware.AuthMiddleware(apiHandler.ListComments))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/comments", middleware.AuthMiddleware(apiHandler.AddComment))
+	mux.HandleFunc("DELETE /api/v1/items/{type}/{id}/comments/{commentId}", middleware.AuthMiddleware(apiHandler.DeleteComment))
+	mux.HandleFunc("PUT /api/v1/items/{type}/{id}/comments/{commentId}/status", middleware.AuthMiddleware(apiHandler.ModerateComment))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/checks", middleware.AuthMiddleware(apiHandler.ListItemChecks))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/archive", middleware.AuthMiddleware(apiHandler.ArchiveItem))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/unarchive", middleware.AuthMiddleware(apiHandler.UnarchiveItem))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/share", middleware.AuthMiddleware(apiHandler.CreateShareLink))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/share", middleware.AuthMiddleware(apiHandler.ListShareLinks))
+	mux.HandleFunc("DELETE /api/v1/items/{type}/{id}/share/{linkId}", middleware.AuthMiddleware(apiHandler.RevokeShareLink))
+	mux.HandleFunc("POST /api/v1/items/{type}/{id}/transfer", middleware.AuthMiddleware(apiHandler.RequestTransfer))
+	mux.HandleFunc("GET /api/v1/items/{type}/{id}/collaborators", middleware.AuthMiddleware(apiHandler.ListCollaborators))
+	mux.HandleFunc("PUT /api/v1/items/{type}/{id}/collaborators/{userId}", middleware.AuthMiddleware(apiHandler.SetCollaborator))
+	mux.HandleFunc("DELETE /api/v1/items/{type}/{id}/collaborators/{userId}", middleware.AuthMiddleware(apiHandler.RemoveCollaborator))
+	mux.HandleFunc("PUT /api/v1/posts/{id}/authors", middleware.AuthMiddleware(apiHandler.SetPostCoAuthors))
+
+	// Ownership transfers (offered with POST /items/{type}/{id}/transfer)
+	mux.HandleFunc("GET /api/v1/transfers", middleware.AuthMiddleware(apiHandler.ListIncomingTransfers))
+	mux.HandleFunc("POST /api/v1/transfers/{id}/accept", middleware.AuthMiddleware(apiHandler.AcceptTransfer))
+	mux.HandleFunc("POST /api/v1/transfers/{id}/decline", middleware.AuthMiddleware(apiHandler.DeclineTransfer))
+	mux.HandleFunc("POST /api/v1/transfers/{id}/cancel", middleware.AuthMiddleware(apiHandler.CancelTransfer))
+
+	// Templates (used by create_post / create_codefile over WebSocket)
+	mux.HandleFunc("GET /api/v1/templates", middleware.AuthMiddleware(apiHandler.ListTemplates))
+	mux.HandleFunc("POST /api/v1/templates", middleware.AuthMiddleware(apiHandler.CreateTemplate))
+	mux.HandleFunc("GET /api/v1/templates/{id}", middleware.AuthMiddleware(apiHandler.GetTemplate))
+	mux.HandleFunc("PUT /api/v1/templates/{id}", middleware.AuthMiddleware(apiHandler.UpdateTemplate))
+	mux.HandleFunc("DELETE /api/v1/templates/{id}", middleware.AuthMiddleware(apiHandler.DeleteTemplate))
+
+	// Search
+	mux.HandleFunc("GET /api/v1/search", middleware.AuthMiddleware(apiHandler.Search))
+
+	// Item events, for integrations that sync by polling
+	mux.HandleFunc("GET /api/v1/events", middleware.AuthMiddleware(apiHandler.ListItemEvents))
+
+	// Trash
+	mux.HandleFunc("GET /api/v1/trash", middleware.AuthMiddleware(apiHandler.ListTrash))
+
+	// Bookmarks (the caller's reading list)
+	mux.HandleFunc("GET /api/v1/bookmarks", middleware.AuthMiddleware(apiHandler.ListBookmarks))
+	mux.HandleFunc("PUT /api/v1/bookmarks/{postId}", middleware.AuthMiddleware(apiHandler.AddBookmark))
+	mux.HandleFunc("DELETE /api/v1/bookmarks/{postId}", middleware.AuthMiddleware(apiHandler.RemoveBookmark))
+
+	// Current user
+	mux.HandleFunc("GET /api/v1/users/me/storage", middleware.AuthMiddleware(apiHandler.GetStorageUsage))
+	mux.HandleFunc("GET /api/v1/users/me/usage", middleware.AuthMiddleware(apiHandler.GetUsage))
+	mux.HandleFunc("GET /api/v1/users/me/theme", middleware.AuthMiddleware(apiHandler.GetSiteTheme))
+	mux.HandleFunc("PUT /api/v1/users/me/theme", middleware.AuthMiddleware(apiHandler.SetSiteTheme))
+	mux.HandleFunc("GET /api/v1/users/me/timezone", middleware.AuthMiddleware(apiHandler.GetTimezone))
+	mux.HandleFunc("PUT /api/v1/users/me/timezone", middleware.AuthMiddleware(apiHandler.SetTimezone))
+	mux.HandleFunc("GET /api/v1/users/me/email", middleware.AuthMiddleware(apiHandler.GetEmail))
+	mux.HandleFunc("PUT /api/v1/users/me/email", middleware.AuthMiddleware(apiHandler.SetEmail))
+	mux.HandleFunc("GET /api/v1/users/me/comments/moderation", middleware.AuthMiddleware(apiHandler.ListModerationQueue))
+	mux.HandleFunc("GET /api/v1/users/me/domains", middleware.AuthMiddleware(apiHandler.ListDomains))
+	mux.HandleFunc("POST /api/v1/users/me/domains", middleware.AuthMiddleware(apiHandler.AddDomain))
+	mux.HandleFunc("POST /api/v1/users/me/domains/{host}/verify", middleware.AuthMiddleware(apiHandler.VerifyDomain))
+	mux.HandleFunc("DELETE /api/v1/users/me/domains/{host}", middleware.AuthMiddleware(apiHandler.RemoveDomain))
+	mux.HandleFunc("GET /api/v1/users/me/data-export", middleware.AuthMiddleware(apiHandler.GetDataExport))
+	mux.HandleFunc("POST /api/v1/users/me/data-export", middleware.AuthMiddleware(apiHandler.RequestDataExport))
+
+	// Web Push notifications
+	mux.HandleFunc("GET /api/v1/push/key", apiHandler.GetPushKey)
+	mux.HandleFunc("GET /api/v1/users/me/push/subscriptions", middleware.AuthMiddleware(apiHandler.ListPushSubscriptions))
+	mux.HandleFunc("POST /api/v1/users/me/push/subscriptions", middleware.AuthMiddleware(apiHandler.SubscribePush))
+	mux.HandleFunc("DELETE /api/v1/users/me/push/subscriptions/{id}", middleware.AuthMiddleware(apiHandler.UnsubscribePush))
+	mux.HandleFunc("GET /api/v1/users/me/notifications", middleware.AuthMiddleware(apiHandler.GetNotificationPreferences))
+	mux.HandleFunc("PUT /api/v1/users/me/notifications", middleware.AuthMiddleware(apiHandler.SetNotificationPreferences))
+
+	// Abuse reports of public content
+	mux.HandleFunc("POST /api/v1/reports", middleware.AuthMiddleware(apiHandler.ReportContent))
+
+	// Static site export of the caller's published posts
+	mux.HandleFunc("GET /api/v1/export/static", middleware.AuthMiddleware(apiHandler.DownloadStaticSite))
+	mux.HandleFunc("POST /api/v1/export/static", middleware.AuthMiddleware(apiHandler.SaveStaticSite))
+
+	// Admin API (users listed in ADMIN_USER_IDS)
+	mux.HandleFunc("GET /api/v1/admin/history/compaction", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.PreviewHistoryCompaction)))
+	mux.HandleFunc("GET /api/v1/admin/fsck", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.CheckConsistency)))
+	mux.HandleFunc("POST /api/v1/admin/fsck", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.RepairConsistency)))
+	mux.HandleFunc("POST /api/v1/admin/config/reload", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.ReloadConfig)))
+	mux.HandleFunc("POST /api/v1/admin/templates", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.CreateSystemTemplate)))
+	mux.HandleFunc("GET /api/v1/admin/reports", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.ListReports)))
+	mux.HandleFunc("POST /api/v1/admin/reports/{id}/resolve", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.ResolveReport)))
+	mux.HandleFunc("POST /api/v1/admin/posts/{id}/reinstate", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.ReinstatePost)))
+	mux.HandleFunc("GET /api/v1/admin/users/{id}/usage", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.GetUserUsage)))
+	mux.HandleFunc("GET /api/v1/admin/maintenance", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.GetMaintenance)))
+	mux.HandleFunc("PUT /api/v1/admin/maintenance", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.SetMaintenance)))
+	mux.HandleFunc("POST /api/v1/admin/broadcast", middleware.AuthMiddleware(apiHandler.requireAdmin(apiHandler.BroadcastAnnouncement)))
+
 	// Swagger UI endpoint
 	// The URL needs to match the base path used in swagger annotations/config
 	// Usually /swagger/index.html
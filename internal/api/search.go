@@ -0,0 +1,43 @@
+// internal/api/search.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+)
+
+// Search godoc
+// @Summary Search my posts and code files
+// @Description Full-text search over the titles and content of the authenticated user's posts and code files, best match first. Matching fragments are returned with <mark> highlighting. Recent edits may take a moment to show up.
+// @Tags search
+// @Produce json
+// @Param q query string true "Search text"
+// @Param type query string false "Restrict to one item type" Enums(post, codefile)
+// @Param limit query int false "Maximum number of hits" default(20)
+// @Param offset query int false "Number of hits to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} search.Results "Total match count and ranked hits"
+// @Failure 400 {object} map[string]string "Missing query or invalid item type"
+// @Failure 503 {object} map[string]string "Search is not enabled"
+// @Router /search [get]
+func (h *APIHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	query := r.URL.Query()
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	results, err := h.service.Search(r.Context(), userID, query.Get("q"), query.Get("type"), limit, offset)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
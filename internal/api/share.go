@@ -0,0 +1,135 @@
+// internal/api/share.go
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CreateShareLink godoc
+// @Summary Create a share link
+// @Description Creates a signed link giving anyone who has it read access to a post or code file without an account. Omit expiresInSeconds for a link that never expires. The token is only returned here. Only the owner can share.
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CreateShareLinkRequest false "Access level and lifetime"
+// @Security BearerAuth
+// @Success 201 {object} models.ShareLink "The share link"
+// @Failure 400 {object} map[string]string "Invalid item type, access or body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/share [post]
+func (h *APIHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) { // Body is optional
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "expiresInSeconds must not be negative")
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInSeconds) * time.Second
+	link, err := h.service.CreateShareLink(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), req.Access, ttl)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// ListShareLinks godoc
+// @Summary List an item's share links
+// @Description Returns the unexpired share links of a post or code file that haven't been revoked, oldest first. Tokens are not included. Only the owner can list them.
+// @Tags sharing
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {array} models.ShareLink "Share links"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/share [get]
+func (h *APIHandler) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	links, err := h.service.ListShareLinks(r.Context(), userID, r.PathValue("id"), r.PathValue("type"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, links)
+}
+
+// RevokeShareLink godoc
+// @Summary Revoke a share link
+// @Description Makes a share link of a post or code file stop working, ending the WebSocket subscriptions made through it. Only the owner can revoke links.
+// @Tags sharing
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param linkId path string true "Share link ID"
+// @Security BearerAuth
+// @Success 204 "Link revoked"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or link not found"
+// @Router /items/{type}/{id}/share/{linkId} [delete]
+func (h *APIHandler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	err := h.service.RevokeShareLink(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("linkId"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	h.hub.DropShareLink(r.PathValue("linkId"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedItem godoc
+// @Summary Open a share link
+// @Description Returns the current content of the item a share link points to and counts a view of it. No authentication is required; the token is the credential.
+// @Tags sharing
+// @Produce json
+// @Param token path string true "Share token"
+// @Success 200 {object} models.SharedItemPayload "Shared item"
+// @Failure 401 {object} map[string]string "Invalid or expired link"
+// @Router /shared/{token} [get]
+func (h *APIHandler) GetSharedItem(w http.ResponseWriter, r *http.Request) {
+	item, err := h.service.GetSharedItem(r.Context(), r.PathValue("token"), middleware.ViewerKey(r))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store") // Don't let proxies keep content after a link expires
+	writeJSON(w, http.StatusOK, item)
+}
+
+// GetSharedCoverImage godoc
+// @Summary Get the cover image of a shared post
+// @Description Streams the cover image of the post a share link points to. No authentication is required; the token is the credential.
+// @Tags sharing
+// @Produce octet-stream
+// @Param token path string true "Share token"
+// @Success 200 {file} file "The image"
+// @Failure 401 {object} map[string]string "Invalid or expired link"
+// @Failure 404 {object} map[string]string "The post has no cover image"
+// @Router /shared/{token}/cover [get]
+func (h *APIHandler) GetSharedCoverImage(w http.ResponseWriter, r *http.Request) {
+	download, err := h.service.GetSharedCoverImage(r.Context(), r.PathValue("token"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeDownload(w, r, download)
+}
@@ -0,0 +1,105 @@
+// internal/api/slugs.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/site"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// SetPostSlug godoc
+// @Summary Change a post's slug
+// @Description Sets the URL slug of a post. Slugs are lowercase letters, digits and single hyphens (at most 100 characters) and must be unique among the owner's posts. The change is recorded in the post's history. Requires editor access.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SetPostSlugRequest true "New slug"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Invalid slug"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Slug already in use"
+// @Router /posts/{id}/slug [put]
+func (h *APIHandler) SetPostSlug(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	postID := r.PathValue("id")
+
+	var req models.SetPostSlugRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SetPostSlug(r.Context(), userID, postID, req.Slug)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	err = h.hub.BroadcastToItem(models.ItemTypePost, postID, models.WebSocketMessage{
+		Action:  "slug_changed",
+		Payload: models.BroadcastSlugPayload{ItemID: postID, Slug: post.Slug, Originator: userID},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast slug change of post", "postID", postID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, post)
+}
+
+// GetPublicPost godoc
+// @Summary Read a published post by its slug
+// @Description Returns the published content of a user's post, found by its slug. No authentication is required; only published posts are served. A former slug of a post answers with a 301 to its current slug, so links keep working after a rename. Redirects aren't cached, since a later rename may reuse the slug. Posts set to noIndex are sent with an X-Robots-Tag: noindex header. A post with a language is sent with it as Content-Language, and lists its other published language variants in translations; with ?lang= (a language tag, or several as in Accept-Language) it answers with a 302 to the variant best matching it, if that is another.
+// @Tags posts
+// @Produce json
+// @Param userId path string true "Owner's user ID"
+// @Param slug path string true "Post slug"
+// @Param frontMatter query string false "Set to strip to leave the front-matter block out of the content" Enums(strip)
+// @Param lang query string false "Preferred language, e.g. pt-BR"
+// @Success 200 {object} models.PublishedPost "Published content"
+// @Success 301 "The slug has changed; Location has the current one"
+// @Success 302 "Another variant matches lang; Location has its slug"
+// @Failure 404 {object} map[string]string "No published post at this slug"
+// @Router /public/users/{userId}/posts/{slug} [get]
+func (h *APIHandler) GetPublicPost(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userId")
+	strip := r.URL.Query().Get("frontMatter") == "strip"
+	published, movedTo, err := h.service.GetPublicPost(r.Context(), userID, r.PathValue("slug"), strip)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	location := func(slug string) string {
+		location := "/api/v1/public/users/" + url.PathEscape(userID) + "/posts/" + slug
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		return location
+	}
+	if movedTo != "" {
+		w.Header().Set("Cache-Control", "no-cache") // A later rename may point the slug elsewhere
+		http.Redirect(w, r, location(movedTo), http.StatusMovedPermanently)
+		return
+	}
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if variant := service.PreferredVariant(published, service.ParseLanguages(lang)); variant != nil {
+			http.Redirect(w, r, location(variant.Slug), http.StatusFound)
+			return
+		}
+	}
+	if published.NoIndex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	if published.Language != "" {
+		w.Header().Set("Content-Language", published.Language)
+	}
+	site.CountView(w, published.PostID)
+	writeJSON(w, http.StatusOK, published)
+}
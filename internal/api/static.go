@@ -0,0 +1,117 @@
+// internal/api/static.go
+package api
+
+import (
+	"errors"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/site"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// staticExportOptions reads a static export's options from the query string.
+func staticExportOptions(r *http.Request) site.ExportOptions {
+	query := r.URL.Query()
+	opts := site.ExportOptions{Format: query.Get("format"), Title: query.Get("title"), BaseURL: query.Get("baseUrl"), Theme: query.Get("theme")}
+	if opts.Format == "" {
+		opts.Format = site.FormatHugo
+	}
+	return opts
+}
+
+// checkStaticExportOptions answers the request with 400 and returns false if opts asks
+// for a format or theme that doesn't exist.
+func (h *APIHandler) checkStaticExportOptions(w http.ResponseWriter, opts site.ExportOptions) bool {
+	if err := site.CheckExportOptions(h.themes, opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// DownloadStaticSite godoc
+// @Summary Download the blog as a static site
+// @Description Returns the caller's published posts as a zip archive: sources for the Hugo or Jekyll site generators (Markdown with front-matter, cover images and a site config), or plain HTML pages like those the server renders, ready to serve from the site's root. Drafts, archived posts and posts without a slug are left out. Archives are built in the background: until one with these options is ready this requests it, if none is pending, and answers 202 with its status; poll again later. A ready archive is kept for DATA_EXPORT_RETENTION_HOURS.
+// @Tags export
+// @Produce application/zip
+// @Produce json
+// @Param format query string false "Output format" Enums(hugo, jekyll, html) default(hugo)
+// @Param title query string false "The blog's title (defaults to the user ID)"
+// @Param baseUrl query string false "Public address of the site, for absolute URLs in the config and link previews"
+// @Param theme query string false "Theme of HTML pages (defaults to the caller's)"
+// @Security BearerAuth
+// @Success 200 {file} file "Zip archive"
+// @Success 202 {object} models.StaticSiteExport "The archive is being built"
+// @Failure 400 {object} map[string]string "Unknown format or theme"
+// @Failure 503 {object} map[string]string "Job queue not configured"
+// @Router /export/static [get]
+func (h *APIHandler) DownloadStaticSite(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	opts := staticExportOptions(r)
+	if !h.checkStaticExportOptions(w, opts) {
+		return
+	}
+
+	export, err := h.service.GetStaticSite(r.Context(), userID, opts)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if export.Status != models.DataExportReady {
+		writeJSON(w, http.StatusAccepted, export)
+		return
+	}
+	body, export, err := h.service.OpenStaticSite(r.Context(), userID, opts)
+	if errors.Is(err, service.ErrStaticSiteNotReady) { // Expired or replaced meanwhile
+		if export, err = h.service.RequestStaticSite(r.Context(), userID, opts, false); err == nil {
+			writeJSON(w, http.StatusAccepted, export)
+			return
+		}
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.FormatInt(export.SizeBytes, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": userID + "-" + opts.Format + ".zip"}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		slog.WarnContext(r.Context(), "Download interrupted", "path", r.URL.Path, "error", err)
+	}
+}
+
+// SaveStaticSite godoc
+// @Summary Save the blog as a static site in storage
+// @Description Starts building the caller's published posts into an archive as by GET /export/static, replacing any earlier one, and once built stores it as one of their assets, at exports/<format>-site-<time>.zip, to download or hand to a deploy job later; the status then has its assetId. It counts towards the storage quota: an archive over it is only kept for download, and the status says why.
+// @Tags export
+// @Produce json
+// @Param format query string false "Output format" Enums(hugo, jekyll, html) default(hugo)
+// @Param title query string false "The blog's title (defaults to the user ID)"
+// @Param baseUrl query string false "Public address of the site, for absolute URLs in the config and link previews"
+// @Param theme query string false "Theme of HTML pages (defaults to the caller's)"
+// @Security BearerAuth
+// @Success 202 {object} models.StaticSiteExport "The archive is being built"
+// @Failure 400 {object} map[string]string "Unknown format or theme"
+// @Failure 503 {object} map[string]string "Job queue not configured"
+// @Router /export/static [post]
+func (h *APIHandler) SaveStaticSite(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	opts := staticExportOptions(r)
+	if !h.checkStaticExportOptions(w, opts) {
+		return
+	}
+	export, err := h.service.RequestStaticSite(r.Context(), userID, opts, true)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, export)
+}
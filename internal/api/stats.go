@@ -0,0 +1,34 @@
+// internal/api/stats.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+)
+
+// GetItemStats godoc
+// @Summary Get view and edit statistics of an item
+// @Description Returns daily counts of public views (share link opens and public post pages, each viewer counted once a day) and edits (new versions) of a post or code file, oldest day first. Counts are written in batches, so the latest activity can take a minute to appear. For posts, also returns how many readers currently have the post bookmarked. Requires editor access.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param days query int false "Number of days up to and including today" default(30)
+// @Security BearerAuth
+// @Success 200 {object} models.ItemStats "Daily statistics"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/stats [get]
+func (h *APIHandler) GetItemStats(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	days, _ := strconv.Atoi(r.URL.Query().Get("days")) // Invalid or missing: the default period
+
+	stats, err := h.service.GetItemStats(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), days)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
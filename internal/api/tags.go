@@ -0,0 +1,117 @@
+// internal/api/tags.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// Handlers for /api/v1/items/{type}/{id}/tags/..., which name versions of an item so
+// they can be found and reverted to without knowing their numbers.
+
+// ListVersionTags godoc
+// @Summary List an item's version tags
+// @Description Returns the named versions of a post or code file, newest version first. Requires at least viewer access.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 200 {array} models.VersionTag "Tags"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /items/{type}/{id}/tags [get]
+func (h *APIHandler) ListVersionTags(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	tags, err := h.history.ListVersionTags(r.Context(), userID, r.PathValue("id"), r.PathValue("type"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// CreateVersionTag godoc
+// @Summary Tag a version
+// @Description Names a version of a post or code file, given by history entry, version number, or neither for the current version. A version that only has patch entries is snapshotted so the tag stays revertible after history compaction. Requires editor access.
+// @Tags items
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CreateVersionTagRequest true "Tag name and version"
+// @Security BearerAuth
+// @Success 201 {object} models.VersionTag "The tag"
+// @Failure 400 {object} map[string]string "Invalid item type, tag name or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item, version or history entry not found"
+// @Failure 409 {object} map[string]string "Tag name already in use on this item"
+// @Failure 410 {object} map[string]string "Version can't be rebuilt"
+// @Router /items/{type}/{id}/tags [post]
+func (h *APIHandler) CreateVersionTag(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CreateVersionTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tag, err := h.history.TagVersion(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), req.Name, req.Version, req.LogID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+// DeleteVersionTag godoc
+// @Summary Delete a version tag
+// @Description Removes a tag from a post or code file. The tagged version stays in the history. Requires editor access.
+// @Tags items
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param name path string true "Tag name"
+// @Security BearerAuth
+// @Success 204 "Tag deleted"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or tag not found"
+// @Router /items/{type}/{id}/tags/{name} [delete]
+func (h *APIHandler) DeleteVersionTag(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	err := h.history.DeleteVersionTag(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("name"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevertToTag godoc
+// @Summary Revert to a tagged version
+// @Description Reverts a post or code file to the version a tag points at. The revert is a new version; the tag is unchanged. Requires editor access.
+// @Tags items
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param name path string true "Tag name"
+// @Security BearerAuth
+// @Success 200 {object} map[string]int "newVersion"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or tag not found"
+// @Failure 410 {object} map[string]string "Tagged version can't be rebuilt"
+// @Router /items/{type}/{id}/tags/{name}/revert [post]
+func (h *APIHandler) RevertToTag(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	newVersion, err := h.history.RevertToTag(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), r.PathValue("name"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"newVersion": newVersion})
+}
@@ -0,0 +1,154 @@
+// internal/api/templates.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+)
+
+// Handlers for /api/v1/templates/..., which pre-fill new posts and code files. Items are
+// created from a template by passing its ID in the create_post or create_codefile
+// WebSocket message.
+
+// CreateTemplate godoc
+// @Summary Create a template
+// @Description Saves a post or code file template for the current user. Title (posts), file name and language (code files) and content pre-fill new items where the create request leaves them empty.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param request body models.TemplateRequest true "Template"
+// @Security BearerAuth
+// @Success 201 {object} models.Template "The new template"
+// @Failure 400 {object} map[string]string "Invalid template or request body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /templates [post]
+func (h *APIHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	h.createTemplate(w, r, false)
+}
+
+// CreateSystemTemplate godoc
+// @Summary Create a system-wide template
+// @Description Saves a template available to every user. Admins edit and delete it through /templates/{id}. Requires admin access.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.TemplateRequest true "Template"
+// @Security BearerAuth
+// @Success 201 {object} models.Template "The new template"
+// @Failure 400 {object} map[string]string "Invalid template or request body"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Router /admin/templates [post]
+func (h *APIHandler) CreateSystemTemplate(w http.ResponseWriter, r *http.Request) {
+	h.createTemplate(w, r, true)
+}
+
+func (h *APIHandler) createTemplate(w http.ResponseWriter, r *http.Request, system bool) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, err := h.service.CreateTemplate(r.Context(), userID, req, system)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, template)
+}
+
+// ListTemplates godoc
+// @Summary List templates
+// @Description Lists the current user's templates followed by the system-wide ones (no userId).
+// @Tags templates
+// @Produce json
+// @Param type query string false "Only templates for this item type" Enums(post, codefile)
+// @Security BearerAuth
+// @Success 200 {array} models.Template "Templates"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /templates [get]
+func (h *APIHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	templates, err := h.service.ListTemplates(r.Context(), userID, r.URL.Query().Get("type"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+// GetTemplate godoc
+// @Summary Get a template
+// @Description Returns one of the current user's templates or a system-wide template.
+// @Tags templates
+// @Produce json
+// @Param id path string true "Template ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Template "The template"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /templates/{id} [get]
+func (h *APIHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	template, err := h.service.GetTemplate(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, template)
+}
+
+// UpdateTemplate godoc
+// @Summary Update a template
+// @Description Replaces a template's name and pre-filled fields; its item type can't change. System-wide templates can only be updated by admins.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param request body models.TemplateRequest true "Template"
+// @Security BearerAuth
+// @Success 200 {object} models.Template "The updated template"
+// @Failure 400 {object} map[string]string "Invalid template or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /templates/{id} [put]
+func (h *APIHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	template, err := h.service.UpdateTemplate(r.Context(), userID, r.PathValue("id"), req)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, template)
+}
+
+// DeleteTemplate godoc
+// @Summary Delete a template
+// @Description Deletes a template. Items created from it are unaffected. System-wide templates can only be deleted by admins.
+// @Tags templates
+// @Param id path string true "Template ID"
+// @Security BearerAuth
+// @Success 204 "Template deleted"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Template not found"
+// @Router /templates/{id} [delete]
+func (h *APIHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.DeleteTemplate(r.Context(), userID, r.PathValue("id")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
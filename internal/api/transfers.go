@@ -0,0 +1,145 @@
+// internal/api/transfers.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"net/http"
+)
+
+// Handlers for ownership transfers. The owner offers an item to another user, who then
+// accepts or declines; the owner can cancel while the offer is pending.
+
+// RequestTransfer godoc
+// @Summary Offer an item to another user
+// @Description Creates a pending ownership transfer of a post or code file. The item changes owner only when the recipient accepts. Only the owner can offer an item.
+// @Tags transfers
+// @Accept json
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.CreateTransferRequest true "Recipient"
+// @Security BearerAuth
+// @Success 201 {object} models.OwnershipTransfer "The pending transfer"
+// @Failure 400 {object} map[string]string "Invalid item type or recipient"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or user not found"
+// @Router /items/{type}/{id}/transfer [post]
+func (h *APIHandler) RequestTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CreateTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ToUserID == "" {
+		writeError(w, http.StatusBadRequest, "toUserId is required")
+		return
+	}
+
+	transfer, err := h.service.RequestTransfer(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), req.ToUserID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, transfer)
+}
+
+// ListIncomingTransfers godoc
+// @Summary List transfers offered to me
+// @Description Returns the pending ownership transfers offered to the authenticated user, newest first.
+// @Tags transfers
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.OwnershipTransfer "Pending transfers"
+// @Router /transfers [get]
+func (h *APIHandler) ListIncomingTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	transfers, err := h.service.ListIncomingTransfers(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+// AcceptTransfer godoc
+// @Summary Accept a transfer
+// @Description Makes the authenticated user the owner of the offered item. The item moves to their default workspace and counts against their storage quota.
+// @Tags transfers
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Security BearerAuth
+// @Success 200 {object} models.OwnershipTransfer "The accepted transfer"
+// @Failure 403 {object} map[string]string "Not the recipient"
+// @Failure 404 {object} map[string]string "Transfer not found"
+// @Failure 409 {object} map[string]string "Transfer no longer pending"
+// @Failure 413 {object} map[string]string "Storage quota exceeded"
+// @Router /transfers/{id}/accept [post]
+func (h *APIHandler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	transfer, err := h.service.AcceptTransfer(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	// Let subscribers know the item changed hands
+	err = h.hub.BroadcastToItem(models.ItemType(transfer.ItemType), transfer.ItemID, models.WebSocketMessage{
+		Action:  "item_transferred",
+		Payload: map[string]string{"itemId": transfer.ItemID, "itemType": transfer.ItemType, "userId": transfer.ToUserID},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to broadcast transfer", "itemType", transfer.ItemType, "itemID", transfer.ItemID, "error", err)
+	}
+	// The previous owner's share links stop working
+	h.hub.DropSharedSubscribers(models.ItemType(transfer.ItemType), transfer.ItemID)
+	writeJSON(w, http.StatusOK, transfer)
+}
+
+// DeclineTransfer godoc
+// @Summary Decline a transfer
+// @Description Rejects an ownership transfer offered to the authenticated user.
+// @Tags transfers
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Security BearerAuth
+// @Success 200 {object} models.OwnershipTransfer "The declined transfer"
+// @Failure 403 {object} map[string]string "Not the recipient"
+// @Failure 404 {object} map[string]string "Transfer not found"
+// @Failure 409 {object} map[string]string "Transfer no longer pending"
+// @Router /transfers/{id}/decline [post]
+func (h *APIHandler) DeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	transfer, err := h.service.DeclineTransfer(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, transfer)
+}
+
+// CancelTransfer godoc
+// @Summary Cancel a transfer
+// @Description Withdraws a pending ownership transfer made by the authenticated user.
+// @Tags transfers
+// @Produce json
+// @Param id path string true "Transfer ID"
+// @Security BearerAuth
+// @Success 200 {object} models.OwnershipTransfer "The cancelled transfer"
+// @Failure 403 {object} map[string]string "Not the sender"
+// @Failure 404 {object} map[string]string "Transfer not found"
+// @Failure 409 {object} map[string]string "Transfer no longer pending"
+// @Router /transfers/{id}/cancel [post]
+func (h *APIHandler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	transfer, err := h.service.CancelTransfer(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, transfer)
+}
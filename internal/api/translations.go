@@ -0,0 +1,63 @@
+// internal/api/translations.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+	"strings"
+)
+
+// SetPostLanguage godoc
+// @Summary Set a post's language
+// @Description Sets the language of a post (a tag such as en or pt-BR; empty to unset), and makes it a translation of another of the owner's posts, its canonical post, given translationOf. The canonical post must have a language and not be a translation itself, and a post that has translations can't become one or lose its language. No two variants of a post share a language. Public listings show each post once, in the variant matching the reader's language. Only the owner can link their posts.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param id path string true "Post ID"
+// @Param request body models.SetPostLanguageRequest true "Language, and the post this one translates"
+// @Security BearerAuth
+// @Success 200 {object} models.Post "Updated post metadata"
+// @Failure 400 {object} map[string]string "Invalid language or translation"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Failure 409 {object} map[string]string "Another variant has this language"
+// @Router /posts/{id}/language [put]
+func (h *APIHandler) SetPostLanguage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.SetPostLanguageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post, err := h.posts.SetPostLanguage(r.Context(), userID, r.PathValue("id"), req.Language, strings.TrimSpace(req.TranslationOf))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, post)
+}
+
+// ListPostTranslations godoc
+// @Summary List a post's language variants
+// @Description Returns the other language variants of a post the caller can view: its canonical post and that post's other translations, or its own translations. Requires viewer access.
+// @Tags posts
+// @Produce json
+// @Param id path string true "Post ID"
+// @Security BearerAuth
+// @Success 200 {array} models.Post "Variants"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Post not found"
+// @Router /posts/{id}/translations [get]
+func (h *APIHandler) ListPostTranslations(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	posts, err := h.posts.ListPostTranslations(r.Context(), userID, r.PathValue("id"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, posts)
+}
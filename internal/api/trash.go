@@ -0,0 +1,55 @@
+// internal/api/trash.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+)
+
+// ListTrash godoc
+// @Summary List trashed items
+// @Description Returns the current user's deleted posts and code files, most recently deleted first. purgeAt is when the item will be removed permanently (zero if trash is kept indefinitely).
+// @Tags trash
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.TrashedItem "Trashed items"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /trash [get]
+func (h *APIHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	items, err := h.service.ListTrash(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// RestoreItem godoc
+// @Summary Restore an item from the trash
+// @Description Restores a deleted post or code file with its content and history intact. Requires ownership.
+// @Tags trash
+// @Produce json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Security BearerAuth
+// @Success 204 "Item restored"
+// @Failure 400 {object} map[string]string "Invalid item type"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item not found (or already purged)"
+// @Failure 409 {object} map[string]string "Item is not in the trash"
+// @Router /items/{type}/{id}/restore [post]
+func (h *APIHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if err := h.service.RestoreItem(r.Context(), userID, r.PathValue("id"), r.PathValue("type")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
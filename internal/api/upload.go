@@ -0,0 +1,145 @@
+// internal/api/upload.go
+package api
+
+import (
+	"errors"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxUploadSize bounds an uploaded code file (the request body, to be exact).
+const maxUploadSize = 8 << 20
+
+// readUpload reads the "file" part of a multipart upload and returns its name and
+// content. It answers the request itself and returns ok=false if the upload is invalid.
+func readUpload(w http.ResponseWriter, r *http.Request) (fileName string, content []byte, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "file must be at most 8 MiB")
+		} else {
+			writeError(w, http.StatusBadRequest, "expected a multipart/form-data body with a \"file\" part")
+		}
+		return "", nil, false
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data body with a \"file\" part")
+		return "", nil, false
+	}
+	defer file.Close()
+	content, err = io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read the uploaded file")
+		return "", nil, false
+	}
+	return header.Filename, content, true
+}
+
+// cleanupUpload removes the temporary files of a multipart form.
+func cleanupUpload(r *http.Request) {
+	if r.MultipartForm != nil {
+		_ = r.MultipartForm.RemoveAll()
+	}
+}
+
+// UploadCodeFile godoc
+// @Summary Create a code file from an uploaded file
+// @Description Creates a code file from a multipart/form-data upload, e.g. a file dropped onto the editor. The name comes from the "path" field or else the uploaded file's name; the language from the "language" field or else the name and content. The file must be UTF-8 text of at most 8 MiB.
+// @Tags codefiles
+// @Accept mpfd
+// @Produce json
+// @Param file formData file true "The file"
+// @Param path formData string false "Path to create it at, e.g. src/main.go (defaults to the file's name)"
+// @Param language formData string false "Language (inferred if omitted)"
+// @Security BearerAuth
+// @Success 201 {object} models.CodeFile "Created code file"
+// @Failure 400 {object} map[string]string "No file, invalid path, or not a text file"
+// @Failure 413 {object} map[string]string "File or storage quota too large"
+// @Router /code/upload [post]
+func (h *APIHandler) UploadCodeFile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileName, content, ok := readUpload(w, r)
+	defer cleanupUpload(r)
+	if !ok {
+		return
+	}
+	filePath := r.FormValue("path")
+	if filePath == "" {
+		filePath = fileName
+	}
+
+	file, err := h.codeFiles.UploadCodeFile(r.Context(), userID, filePath, strings.TrimSpace(r.FormValue("language")), content)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, file)
+}
+
+// ReplaceCodeFileContent godoc
+// @Summary Overwrite a code file with an uploaded file
+// @Description Replaces a code file's content with a multipart/form-data upload, saved as a new version. Subscribers receive the difference as a content_changed broadcast. The file must be UTF-8 text of at most 8 MiB. Requires editor access.
+// @Tags codefiles
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Code File ID"
+// @Param file formData file true "The file"
+// @Param baseVersion formData int false "If set, must be the current version"
+// @Security BearerAuth
+// @Success 200 {object} models.ReplaceContentResponse "New version, or the current one if nothing changed"
+// @Failure 400 {object} map[string]string "No file, or not a text file"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Code file not found"
+// @Failure 409 {object} map[string]interface{} "baseVersion is not the current version; the changes since it are under conflict"
+// @Failure 413 {object} map[string]string "File or storage quota too large"
+// @Router /code/{id}/upload [put]
+func (h *APIHandler) ReplaceCodeFileContent(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	fileID := r.PathValue("id")
+	_, content, ok := readUpload(w, r)
+	defer cleanupUpload(r)
+	if !ok {
+		return
+	}
+	baseVersion := 0
+	if v := r.FormValue("baseVersion"); v != "" {
+		var err error
+		if baseVersion, err = strconv.Atoi(v); err != nil || baseVersion < 1 {
+			writeError(w, http.StatusBadRequest, "baseVersion must be a positive integer")
+			return
+		}
+	}
+
+	newVersion, changes, err := h.codeFiles.ReplaceCodeFileContent(r.Context(), userID, fileID, baseVersion, content)
+	if errors.Is(err, service.ErrVersionConflict) {
+		h.writeVersionConflict(w, r, userID, fileID, string(models.ItemTypeCodeFile), baseVersion)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	if len(changes) > 0 {
+		err = h.hub.BroadcastToItem(models.ItemTypeCodeFile, fileID, models.WebSocketMessage{
+			Action: "content_changed",
+			Payload: models.BroadcastChangePayload{
+				ItemID: fileID, ItemType: string(models.ItemTypeCodeFile),
+				Changes: changes, NewVersion: newVersion, Originator: userID,
+			},
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to broadcast upload to codefile", "fileID", fileID, "error", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, models.ReplaceContentResponse{ItemID: fileID, NewVersion: newVersion, Changed: len(changes) > 0})
+}
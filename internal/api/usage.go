@@ -0,0 +1,54 @@
+// internal/api/usage.go
+package api
+
+import (
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"net/http"
+	"strconv"
+)
+
+// GetUsage godoc
+// @Summary Get your API usage
+// @Description Returns the current user's daily counts of authenticated API requests and WebSocket messages (UTC days, oldest first), their totals per API key (the bearer token used, identified by its jti claim), and their daily quotas (0 means unlimited). Counts are written in batches, so the latest activity can take a minute to appear.
+// @Tags users
+// @Produce json
+// @Param days query int false "Number of days up to and including today" default(30)
+// @Security BearerAuth
+// @Success 200 {object} models.Usage "Daily usage"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 429 {object} map[string]string "Daily request quota used up"
+// @Router /users/me/usage [get]
+func (h *APIHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	days, _ := strconv.Atoi(r.URL.Query().Get("days")) // Invalid or missing: the default period
+
+	usage, err := h.usage.GetUsage(r.Context(), userID, days)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// GetUserUsage godoc
+// @Summary Get a user's API usage
+// @Description Returns a user's daily counts of authenticated API requests and WebSocket messages, as GET /users/me/usage does for the caller. Requires admin access.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param days query int false "Number of days up to and including today" default(30)
+// @Security BearerAuth
+// @Success 200 {object} models.Usage "Daily usage"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Router /admin/users/{id}/usage [get]
+func (h *APIHandler) GetUserUsage(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+
+	usage, err := h.usage.GetUsage(r.Context(), r.PathValue("id"), days)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,189 @@
+// internal/api/users.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+	"strings"
+)
+
+// Handlers for /api/v1/users/me/..., scoped to the authenticated user.
+
+// GetStorageUsage godoc
+// @Summary Get storage usage
+// @Description Returns how many bytes of content the current user stores and their quota (0 means unlimited).
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.StorageUsage "Storage usage"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/me/storage [get]
+func (h *APIHandler) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	if userID == "" {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	usage, err := h.service.GetStorageUsage(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// GetSiteTheme godoc
+// @Summary Get the theme of your public pages
+// @Description Returns the theme of the current user's server-rendered pages and static HTML exports, and the themes installed on the server. An empty theme is the built-in one.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SiteTheme "Theme"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/theme [get]
+func (h *APIHandler) GetSiteTheme(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	theme, err := h.service.GetSiteTheme(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.SiteTheme{Theme: theme, Available: h.themes.Names()})
+}
+
+// SetSiteTheme godoc
+// @Summary Pick the theme of your public pages
+// @Description Sets the theme of the current user's server-rendered pages and static HTML exports to one installed on the server, or the built-in one if empty. Cached pages keep the old theme until they expire.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.SiteTheme true "Theme"
+// @Security BearerAuth
+// @Success 200 {object} models.SiteTheme "Theme"
+// @Failure 400 {object} map[string]string "Unknown theme"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/theme [put]
+func (h *APIHandler) SetSiteTheme(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.SiteTheme
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	theme := strings.TrimSpace(req.Theme)
+	if err := h.service.SetSiteTheme(r.Context(), userID, theme); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.SiteTheme{Theme: theme, Available: h.themes.Names()})
+}
+
+// GetTimezone godoc
+// @Summary Get your time zone
+// @Description Returns the current user's time zone, in which their public pages show dates and scheduled times without an offset are read. An empty time zone is UTC.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserTimezone "Time zone"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/timezone [get]
+func (h *APIHandler) GetTimezone(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	timezone, err := h.service.GetTimezone(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.UserTimezone{Timezone: timezone})
+}
+
+// SetTimezone godoc
+// @Summary Set your time zone
+// @Description Sets the current user's time zone to an IANA name such as Europe/Helsinki, or UTC if empty. Cached pages keep the old dates until they expire.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.UserTimezone true "Time zone"
+// @Security BearerAuth
+// @Success 200 {object} models.UserTimezone "Time zone"
+// @Failure 400 {object} map[string]string "Unknown time zone"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/timezone [put]
+func (h *APIHandler) SetTimezone(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.UserTimezone
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.service.SetTimezone(r.Context(), userID, req.Timezone); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	timezone, err := h.service.GetTimezone(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.UserTimezone{Timezone: timezone})
+}
+
+// GetEmail godoc
+// @Summary Get your email address
+// @Description Returns the address the current user's activity digests are sent to, empty if none.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserEmail "Email address"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/email [get]
+func (h *APIHandler) GetEmail(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	email, err := h.service.GetEmail(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.UserEmail{Email: email})
+}
+
+// SetEmail godoc
+// @Summary Set your email address
+// @Description Sets the address the current user's activity digests are sent to, or removes it if empty. Digests can also be turned off in the notification preferences.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body models.UserEmail true "Email address"
+// @Security BearerAuth
+// @Success 200 {object} models.UserEmail "Email address"
+// @Failure 400 {object} map[string]string "Not an email address"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /users/me/email [put]
+func (h *APIHandler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	var req models.UserEmail
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.service.SetEmail(r.Context(), userID, req.Email); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	email, err := h.service.GetEmail(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.UserEmail{Email: email})
+}
@@ -0,0 +1,127 @@
+// internal/api/workspaces.go
+package api
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// Handlers for /api/v1/workspaces/... and moving items between workspaces.
+
+// CreateWorkspace godoc
+// @Summary Create a workspace
+// @Description Creates an empty workspace for the current user.
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param request body models.CreateWorkspaceRequest true "Workspace name"
+// @Security BearerAuth
+// @Success 201 {object} models.Workspace "The new workspace"
+// @Failure 400 {object} map[string]string "Missing name or invalid body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /workspaces [post]
+func (h *APIHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.CreateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	workspace, err := h.service.CreateWorkspace(r.Context(), userID, req.Name)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, workspace)
+}
+
+// ListWorkspaces godoc
+// @Summary List workspaces
+// @Description Lists the current user's workspaces. The first entry is always the default workspace (id "default").
+// @Tags workspaces
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Workspace "Workspaces"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /workspaces [get]
+func (h *APIHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+	workspaces, err := h.service.ListWorkspaces(r.Context(), userID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// ListWorkspaceItems godoc
+// @Summary List the items in a workspace
+// @Description Returns the posts and code files in a workspace, newest first. Use "default" for the default workspace. limit and offset apply to posts and code files separately.
+// @Tags workspaces
+// @Produce json
+// @Param id path string true "Workspace ID"
+// @Param limit query int false "Limit number of results" default(10)
+// @Param offset query int false "Offset for pagination" default(0)
+// @Param include query string false "Set to \"archived\" to include archived items"
+// @Security BearerAuth
+// @Success 200 {object} models.WorkspaceItems "Posts and code files"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Workspace not found"
+// @Router /workspaces/{id}/items [get]
+func (h *APIHandler) ListWorkspaceItems(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10 // Default limit
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, err := h.service.ListWorkspaceItems(r.Context(), userID, r.PathValue("id"), limit, offset, includeArchived(r))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// MoveItemToWorkspace godoc
+// @Summary Move an item to another workspace
+// @Description Moves a post or code file into a workspace ("default" for the default workspace). Requires ownership of the item and the workspace.
+// @Tags workspaces
+// @Accept json
+// @Param type path string true "Item type" Enums(post, codefile)
+// @Param id path string true "Item ID"
+// @Param request body models.MoveToWorkspaceRequest true "Target workspace"
+// @Security BearerAuth
+// @Success 204 "Item moved"
+// @Failure 400 {object} map[string]string "Invalid item type or request body"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "Item or workspace not found"
+// @Router /items/{type}/{id}/workspace [post]
+func (h *APIHandler) MoveItemToWorkspace(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserIDFromContext(r.Context())
+
+	var req models.MoveToWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := h.service.MoveItemToWorkspace(r.Context(), userID, r.PathValue("id"), r.PathValue("type"), req.WorkspaceID)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+// internal/apperr/apperr.go
+package apperr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Code classifies an error by what the caller can do about it. Codes are shared by every
+// layer, so the API answers the same failure alike over HTTP and WebSocket: the value is
+// the WebSocket ErrorPayload code, and HTTPStatus gives the HTTP status.
+type Code string
+
+const (
+	NotFound            Code = "NOT_FOUND"
+	Conflict            Code = "CONFLICT"
+	PermissionDenied    Code = "PERMISSION_DENIED"
+	Unauthenticated     Code = "UNAUTHENTICATED"
+	Validation          Code = "INVALID_PAYLOAD"
+	Unprocessable       Code = "UNPROCESSABLE" // Valid, but the content can't be processed
+	Gone                Code = "GONE"          // Existed, but is no longer kept
+	RangeNotSatisfiable Code = "RANGE_NOT_SATISFIABLE"
+	TooLarge            Code = "TOO_LARGE" // Over a size or storage limit
+	RateLimited         Code = "RATE_LIMITED"
+	Unavailable         Code = "UNAVAILABLE" // Disabled or unconfigured here, or shutting down
+	ReadOnly            Code = "READ_ONLY"   // Changes are paused for maintenance; reads work
+	Timeout             Code = "TIMEOUT"
+	Integrity           Code = "INTEGRITY_ERROR" // Stored data is damaged; retrying won't help
+	Internal            Code = "INTERNAL_ERROR"
+)
+
+var httpStatus = map[Code]int{
+	NotFound:            http.StatusNotFound,
+	Conflict:            http.StatusConflict,
+	PermissionDenied:    http.StatusForbidden,
+	Unauthenticated:     http.StatusUnauthorized,
+	Validation:          http.StatusBadRequest,
+	Unprocessable:       http.StatusUnprocessableEntity,
+	Gone:                http.StatusGone,
+	RangeNotSatisfiable: http.StatusRequestedRangeNotSatisfiable,
+	TooLarge:            http.StatusRequestEntityTooLarge,
+	RateLimited:         http.StatusTooManyRequests,
+	Unavailable:         http.StatusServiceUnavailable,
+	ReadOnly:            http.StatusServiceUnavailable,
+	Timeout:             http.StatusGatewayTimeout,
+	Integrity:           http.StatusInternalServerError,
+	Internal:            http.StatusInternalServerError,
+}
+
+// HTTPStatus returns the HTTP status to answer errors of code with.
+func HTTPStatus(code Code) int {
+	if status, ok := httpStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error with a Code. Declare sentinel errors with New, and compare them with
+// errors.Is as usual; wrapping them with fmt.Errorf("%w") keeps their code.
+type Error struct {
+	code    Code
+	message string
+	err     error // Cause, if any
+}
+
+// New returns an error of code with message.
+func New(code Code, message string) error {
+	return &Error{code: code, message: message}
+}
+
+// Wrap gives err a code, keeping its message and leaving errors.Is(…, err) true. It
+// returns nil for a nil err.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{code: code, err: err}
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.err == nil:
+		return e.message
+	case e.message == "":
+		return e.err.Error()
+	default:
+		return e.message + ": " + e.err.Error()
+	}
+}
+
+func (e *Error) Unwrap() error { return e.err }
+
+// Code returns the error's code.
+func (e *Error) Code() Code { return e.code }
+
+// CodeOf returns the code of err: that of the outermost Error in its chain, Timeout for
+// an expired context, and Internal for anything else. It returns "" for a nil err.
+func CodeOf(err error) Code {
+	var coded *Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	default:
+		return Internal
+	}
+}
+
+// Message returns the message to show clients for err. Internal errors may carry details
+// of the deployment, so they get a generic message and should be logged instead.
+func Message(err error) string {
+	switch CodeOf(err) {
+	case Internal:
+		return "Internal server error"
+	case Timeout:
+		return "operation timed out"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,264 @@
+// Package audit streams history and authentication events to external systems (a
+// webhook, a Kafka topic through its REST proxy, or batch files in S3) for SIEM and
+// analytics pipelines. Each sink receives the event types it is configured for.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication event types. History events are "history.<action>", e.g.
+// "history.patch".
+const (
+	AuthRegister      = "auth.register"
+	AuthLogin         = "auth.login"
+	AuthLoginFailed   = "auth.login_failed"
+	AuthPasswordReset = "auth.password_reset"
+)
+
+const (
+	sendAttempts   = 3               // Per batch, before it is dropped
+	firstSendRetry = 2 * time.Second // Doubles with each further attempt
+)
+
+var exportedEvents = metrics.Default.Counter("blog_audit_events_total",
+	"Audit events per export sink, by result: sent, or dropped because the queue was full or the sink kept failing.", "sink", "result")
+
+// Event is an audit event as sinks receive it.
+type Event struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	Time      time.Time          `json:"time"`
+	TenantID  string             `json:"tenantId,omitempty"`
+	UserID    string             `json:"userId,omitempty"` // Acting user, or the one a login was attempted for
+	ItemID    string             `json:"itemId,omitempty"`
+	ItemType  string             `json:"itemType,omitempty"`
+	Reason    string             `json:"reason,omitempty"` // Why an attempt failed
+	RequestID string             `json:"requestId,omitempty"`
+	ClientIP  string             `json:"clientIp,omitempty"`
+	UserAgent string             `json:"userAgent,omitempty"`
+	History   *models.HistoryLog `json:"history,omitempty"` // History events; patches without their text
+}
+
+// HistoryEvent returns the event of a history entry.
+func HistoryEvent(entry *models.HistoryLog) Event {
+	history := *entry
+	history.ChangeData = nil // Content doesn't belong in audit pipelines
+	return Event{
+		Type:     "history." + string(entry.Action),
+		UserID:   entry.UserID,
+		ItemID:   entry.ItemID,
+		ItemType: entry.ItemType,
+		History:  &history,
+	}
+}
+
+type clientKey struct{}
+
+type client struct {
+	ip        string
+	userAgent string
+}
+
+// WithClient returns a context whose audit events record the client's address and user
+// agent.
+func WithClient(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client{ip: ip, userAgent: userAgent})
+}
+
+// Sink delivers a batch of events.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// Exporter sends events to its sinks in the background, in batches. Each sink has a
+// queue of its own, so a slow one holds up no other; when a queue is full, events for
+// it are dropped rather than holding up the write or login that produced them.
+type Exporter struct {
+	routes []*route
+	wg     sync.WaitGroup
+}
+
+// route feeds one sink the event types it wants.
+type route struct {
+	name          string
+	sink          Sink
+	patterns      []string
+	queue         chan Event
+	batchSize     int
+	flushInterval time.Duration
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewExporter creates an exporter for the sinks cfg configures and starts sending, or
+// returns nil if none is configured.
+func NewExporter(cfg *config.AuditExportConfig, storageCfg *config.StorageConfig) (*Exporter, error) {
+	e := &Exporter{}
+	add := func(name string, sink Sink, patterns []string) {
+		e.routes = append(e.routes, &route{
+			name: name, sink: sink, patterns: patterns,
+			queue:     make(chan Event, cfg.QueueSize),
+			batchSize: cfg.BatchSize, flushInterval: cfg.FlushInterval,
+		})
+	}
+	if cfg.WebhookURL != "" {
+		add("webhook", NewWebhookSink(cfg.WebhookURL, cfg.WebhookToken), cfg.WebhookEvents)
+	}
+	if cfg.KafkaRESTURL != "" {
+		add("kafka", NewKafkaRESTSink(cfg.KafkaRESTURL, cfg.KafkaTopic), cfg.KafkaEvents)
+	}
+	if cfg.S3Bucket != "" {
+		sink, err := NewS3Sink(storageCfg, cfg.S3Bucket, cfg.S3Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("audit export to S3: %w", err)
+		}
+		add("s3", sink, cfg.S3Events)
+	}
+	if len(e.routes) == 0 {
+		return nil, nil
+	}
+	for _, r := range e.routes {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			r.run()
+		}()
+	}
+	return e, nil
+}
+
+// Export queues event for the sinks that want its type, filling in its ID, time, tenant
+// and the request it came from (from ctx).
+func (e *Exporter) Export(ctx context.Context, event Event) {
+	if e == nil {
+		return
+	}
+	event.ID = uuid.NewString()
+	event.Time = time.Now().UTC()
+	event.TenantID = tenant.ID(ctx)
+	event.RequestID = logging.RequestID(ctx)
+	if c, ok := ctx.Value(clientKey{}).(client); ok {
+		event.ClientIP, event.UserAgent = c.ip, c.userAgent
+	}
+	for _, r := range e.routes {
+		if matches(r.patterns, event.Type) {
+			r.enqueue(ctx, event)
+		}
+	}
+}
+
+// Close stops accepting events and sends the queued ones, until ctx is done.
+func (e *Exporter) Close(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	for _, r := range e.routes {
+		r.mu.Lock()
+		if !r.closed {
+			r.closed = true
+			close(r.queue)
+		}
+		r.mu.Unlock()
+	}
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit events still queued: %w", ctx.Err())
+	}
+}
+
+// matches reports whether eventType matches one of patterns: a type, a prefix ending in
+// ".*" (e.g. "auth.*") or "*".
+func matches(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *route) enqueue(ctx context.Context, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		exportedEvents.Inc(r.name, "dropped")
+		slog.WarnContext(ctx, "Audit export queue full, dropping event", "sink", r.name, "type", event.Type)
+	}
+}
+
+// run sends batches of up to batchSize events, or fewer once flushInterval passes, until
+// the queue is closed and drained.
+func (r *route) run() {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Event, 0, r.batchSize)
+	for {
+		select {
+		case event, ok := <-r.queue:
+			if !ok {
+				r.send(batch)
+				return
+			}
+			if batch = append(batch, event); len(batch) >= r.batchSize {
+				r.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send delivers a batch, retrying with backoff before giving up on it.
+func (r *route) send(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	delay := firstSendRetry
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := r.sink.Send(ctx, batch)
+		cancel()
+		if err == nil {
+			exportedEvents.Add(float64(len(batch)), r.name, "sent")
+			return
+		}
+		if attempt == sendAttempts {
+			exportedEvents.Add(float64(len(batch)), r.name, "dropped")
+			slog.Error("Failed to export audit events, dropping them", "sink", r.name, "events", len(batch), "attempts", attempt, "error", err)
+			return
+		}
+		slog.Warn("Failed to export audit events, retrying", "sink", r.name, "events", len(batch), "attempt", attempt, "retryIn", delay, "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,129 @@
+// internal/audit/sinks.go
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/storage/s3"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebhookSink POSTs each batch as a JSON array of events.
+type WebhookSink struct {
+	url    string
+	token  string // Optional bearer token
+	client *http.Client
+}
+
+func NewWebhookSink(url, token string) *WebhookSink {
+	return &WebhookSink{url: url, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *WebhookSink) Send(ctx context.Context, events []Event) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if s.token != "" {
+		headers["Authorization"] = "Bearer " + s.token
+	}
+	return postJSON(ctx, s.client, s.url, events, headers)
+}
+
+// KafkaRESTSink produces each event as a record of a Kafka topic through a Kafka REST
+// proxy (the Confluent REST Proxy v2 API), keyed by user so a user's events keep their
+// order within a partition.
+type KafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaRESTSink creates a sink producing to topic through the REST proxy at baseURL,
+// e.g. http://kafka-rest:8082.
+func NewKafkaRESTSink(baseURL, topic string) *KafkaRESTSink {
+	return &KafkaRESTSink{
+		url:    strings.TrimSuffix(baseURL, "/") + "/topics/" + url.PathEscape(topic),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value Event  `json:"value"`
+}
+
+func (s *KafkaRESTSink) Send(ctx context.Context, events []Event) error {
+	records := make([]kafkaRecord, len(events))
+	for i, event := range events {
+		records[i] = kafkaRecord{Key: event.TenantID + "/" + event.UserID, Value: event}
+	}
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{"records": records},
+		map[string]string{"Content-Type": "application/vnd.kafka.json.v2+json", "Accept": "application/vnd.kafka.v2+json"})
+}
+
+// S3Sink writes each batch as a JSON Lines file under a prefix of a bucket, named by
+// the time it was written: <prefix>/2006/01/02/150405-<id>.jsonl.
+type S3Sink struct {
+	client *s3.S3Client
+	prefix string
+}
+
+// NewS3Sink creates a sink writing to bucket with the S3 region, endpoint and
+// credentials of storageCfg.
+func NewS3Sink(storageCfg *config.StorageConfig, bucket, prefix string) (*S3Sink, error) {
+	cfg := *storageCfg
+	cfg.S3Bucket = bucket
+	if cfg.S3Region == "" {
+		return nil, errors.New("AWS_REGION is required")
+	}
+	client, err := s3.NewS3Client(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Sink{client: client, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (s *S3Sink) Send(ctx context.Context, events []Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // One event per line
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+	}
+	now := time.Now().UTC()
+	key := path.Join(s.prefix, now.Format("2006/01/02"), now.Format("150405")+"-"+uuid.NewString()+".jsonl")
+	return s.client.UploadFile(ctx, key, &buf, "application/x-ndjson")
+}
+
+// postJSON POSTs payload as JSON and fails on any status but 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -3,14 +3,16 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
 	"github.com/kkuzar/blog_system/internal/config"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrInvalidToken = apperr.New(apperr.Unauthenticated, "invalid or expired token")
 	jwtSecret       []byte
 	jwtExpiration   time.Duration
 )
@@ -24,8 +26,10 @@ func Init(cfg *config.JWTConfig) {
 	jwtExpiration = cfg.Expiration
 }
 
-// GenerateJWT creates a new JWT token for a given user ID.
-func GenerateJWT(userID string) (string, error) {
+// GenerateJWT creates a new JWT token for a given user ID. A non-empty tenantID is
+// recorded as the tenant the token is valid for. Each token gets an ID (see KeyID), so
+// API usage can be told apart per token.
+func GenerateJWT(userID, tenantID string) (string, error) {
 	if len(jwtSecret) == 0 {
 		return "", errors.New("JWT secret not initialized")
 	}
@@ -33,9 +37,11 @@ func GenerateJWT(userID string) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": userID,                               // Subject (user ID)
 		"iss": "go-blog-coder-backend",              // Issuer
+		"jti": uuid.NewString(),                     // Token ID
 		"iat": time.Now().Unix(),                    // Issued At
 		"exp": time.Now().Add(jwtExpiration).Unix(), // Expiration Time
 	}
+	setTenant(claims, tenantID)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtSecret)
@@ -46,9 +52,62 @@ func GenerateJWT(userID string) (string, error) {
 }
 
 // ValidateJWT verifies a JWT token string and returns the user ID (subject).
+// WebSocket tickets and share tokens are rejected here; they are only accepted by
+// ValidateWSTicket and ValidateShareToken.
 func ValidateJWT(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	if typ, _ := claims["typ"].(string); typ != "" {
+		return "", ErrInvalidToken // Tickets and share tokens must not be usable as bearer tokens
+	}
+
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return "", ErrInvalidToken // Subject claim missing or not a string
+	}
+	// You could add more checks here (e.g., issuer)
+	return userID, nil
+}
+
+// TokenTenant verifies a token of any kind (JWT, WebSocket ticket or share token) and
+// returns the tenant it was issued for, "" if none.
+func TokenTenant(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	tenantID, _ := claims["tid"].(string)
+	return tenantID, nil
+}
+
+// KeyID verifies a bearer token or WebSocket ticket and returns the ID of the API key it
+// stands for: a bearer token's own ID, or for a ticket, that of the token it was issued
+// with. Tokens issued before they had IDs return "".
+func KeyID(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	claim := "jti"
+	if typ, _ := claims["typ"].(string); typ == tokenTypeWSTicket {
+		claim = "kid"
+	}
+	keyID, _ := claims[claim].(string)
+	return keyID, nil
+}
+
+func setTenant(claims jwt.MapClaims, tenantID string) {
+	if tenantID != "" {
+		claims["tid"] = tenantID
+	}
+}
+
+// parseToken verifies the signature and expiry of a token and returns its claims.
+func parseToken(tokenString string) (jwt.MapClaims, error) {
 	if len(jwtSecret) == 0 {
-		return "", errors.New("JWT secret not initialized")
+		return nil, errors.New("JWT secret not initialized")
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -62,19 +121,14 @@ func ValidateJWT(tokenString string) (string, error) {
 	if err != nil {
 		// Handle specific errors like expiration
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", ErrInvalidToken
+			return nil, ErrInvalidToken
 		}
-		return "", fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["sub"].(string)
-		if !ok || userID == "" {
-			return "", ErrInvalidToken // Subject claim missing or not a string
-		}
-		// You could add more checks here (e.g., issuer)
-		return userID, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
 	}
-
-	return "", ErrInvalidToken
+	return claims, nil
 }
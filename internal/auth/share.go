@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const tokenTypeShare = "share"
+
+// ShareClaims describes what a share token grants.
+type ShareClaims struct {
+	IssuedBy  string     // User who created the link
+	ItemID    string     // Shared item
+	ItemType  string     // "post" or "codefile"
+	Access    string     // Access level granted, e.g. "read"
+	LinkID    string     // Unique ID of this link (jti)
+	TenantID  string     // Tenant the item belongs to, "" if none
+	ExpiresAt *time.Time // Nil if the link never expires
+}
+
+// GenerateShareToken creates a signed token granting access to a single item without an
+// account. A zero expiresAt creates a link that never expires.
+func GenerateShareToken(issuedBy, itemID, itemType, access, tenantID string, expiresAt time.Time) (string, string, error) {
+	if len(jwtSecret) == 0 {
+		return "", "", errors.New("JWT secret not initialized")
+	}
+
+	linkID := uuid.NewString()
+	claims := jwt.MapClaims{
+		"sub":    issuedBy,
+		"iss":    "go-blog-coder-backend",
+		"typ":    tokenTypeShare,
+		"jti":    linkID,
+		"iat":    time.Now().Unix(),
+		"item":   itemID,
+		"itype":  itemType,
+		"access": access,
+	}
+	if !expiresAt.IsZero() {
+		claims["exp"] = expiresAt.Unix()
+	}
+	setTenant(claims, tenantID)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign share token: %w", err)
+	}
+	return tokenString, linkID, nil
+}
+
+// ValidateShareToken verifies a token issued by GenerateShareToken and returns its claims.
+// Expired tokens are rejected with ErrInvalidToken.
+func ValidateShareToken(tokenString string) (*ShareClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := claims["typ"].(string); typ != tokenTypeShare {
+		return nil, ErrInvalidToken
+	}
+
+	share := &ShareClaims{}
+	share.IssuedBy, _ = claims["sub"].(string)
+	share.ItemID, _ = claims["item"].(string)
+	share.ItemType, _ = claims["itype"].(string)
+	share.Access, _ = claims["access"].(string)
+	share.LinkID, _ = claims["jti"].(string)
+	share.TenantID, _ = claims["tid"].(string)
+	if share.IssuedBy == "" || share.ItemID == "" || share.ItemType == "" || share.Access == "" {
+		return nil, ErrInvalidToken
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		share.ExpiresAt = &exp.Time
+	}
+	return share, nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// WSTicketTTL is how long a WebSocket ticket stays valid after being issued.
+// Tickets are meant to be exchanged immediately for a connection.
+const WSTicketTTL = 30 * time.Second
+
+const tokenTypeWSTicket = "ws_ticket"
+
+var ErrTicketUsed = apperr.New(apperr.Unauthenticated, "websocket ticket has already been used")
+
+// usedTickets tracks consumed ticket IDs (jti) until they expire, so a ticket
+// leaked via logs or browser history cannot be replayed on this node.
+var (
+	usedTickets   = make(map[string]time.Time)
+	usedTicketsMu sync.Mutex
+)
+
+// GenerateWSTicket creates a short-lived, single-use ticket that lets a browser
+// open an authenticated WebSocket (/ws?ticket=...) without keeping the raw JWT in JS.
+// keyID is the ID of the token it was requested with (see KeyID), if any.
+func GenerateWSTicket(userID, tenantID, keyID string) (string, time.Time, error) {
+	if len(jwtSecret) == 0 {
+		return "", time.Time{}, errors.New("JWT secret not initialized")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(WSTicketTTL)
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"iss": "go-blog-coder-backend",
+		"typ": tokenTypeWSTicket,
+		"jti": uuid.NewString(),
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+	}
+	if keyID != "" {
+		claims["kid"] = keyID
+	}
+	setTenant(claims, tenantID)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	ticket, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign ticket: %w", err)
+	}
+	return ticket, expiresAt, nil
+}
+
+// ValidateWSTicket verifies a ticket issued by GenerateWSTicket, marks it as used,
+// and returns the user ID it was issued for.
+func ValidateWSTicket(ticket string) (string, error) {
+	claims, err := parseToken(ticket)
+	if err != nil {
+		return "", err
+	}
+	if typ, _ := claims["typ"].(string); typ != tokenTypeWSTicket {
+		return "", ErrInvalidToken
+	}
+	userID, ok := claims["sub"].(string)
+	if !ok || userID == "" {
+		return "", ErrInvalidToken
+	}
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return "", ErrInvalidToken
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return "", ErrInvalidToken
+	}
+
+	usedTicketsMu.Lock()
+	defer usedTicketsMu.Unlock()
+	now := time.Now()
+	for id, expiry := range usedTickets { // Prune expired entries; the map stays tiny
+		if now.After(expiry) {
+			delete(usedTickets, id)
+		}
+	}
+	if _, used := usedTickets[jti]; used {
+		return "", ErrTicketUsed
+	}
+	usedTickets[jti] = exp.Time
+	return userID, nil
+}
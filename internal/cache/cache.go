@@ -16,8 +16,8 @@ type Cache interface {
 	SetUser(ctx context.Context, user *models.User, expiration time.Duration) error
 	DeleteUser(ctx context.Context, userID string) error
 
-	GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (interface{}, error) // Returns *models.Post or *models.CodeFile
-	SetItemMeta(ctx context.Context, itemID string, itemType models.ItemType, meta interface{}, expiration time.Duration) error
+	GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) // Meta of itemType
+	SetItemMeta(ctx context.Context, meta models.ItemMeta, expiration time.Duration) error             // Keyed by the meta's ID and type
 	DeleteItemMeta(ctx context.Context, itemID string, itemType models.ItemType) error
 
 	GetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error)
@@ -42,10 +42,10 @@ func (c *NoOpCache) SetUser(ctx context.Context, user *models.User, expiration t
 	return nil
 }
 func (c *NoOpCache) DeleteUser(ctx context.Context, userID string) error { return nil }
-func (c *NoOpCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (interface{}, error) {
+func (c *NoOpCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
 	return nil, ErrNotFound
 }
-func (c *NoOpCache) SetItemMeta(ctx context.Context, itemID string, itemType models.ItemType, meta interface{}, expiration time.Duration) error {
+func (c *NoOpCache) SetItemMeta(ctx context.Context, meta models.ItemMeta, expiration time.Duration) error {
 	return nil
 }
 func (c *NoOpCache) DeleteItemMeta(ctx context.Context, itemID string, itemType models.ItemType) error {
@@ -0,0 +1,85 @@
+// internal/cache/counter.go
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Counter tracks named integer counters, such as changes applied since an item's last snapshot.
+// RedisCache implements it so counts are shared across replicas and survive restarts;
+// MemoryCounter is the single-process fallback.
+type Counter interface {
+	IncrBy(ctx context.Context, key string, delta int64) (int64, error)
+	// IncrByTTL is IncrBy for counters only needed for a while, such as daily counts:
+	// key expires ttl after its last increment.
+	IncrByTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// NewCounter returns c as a Counter if the cache supports shared counters,
+// otherwise an in-memory counter (e.g. when caching is disabled via NoOpCache).
+func NewCounter(c Cache) Counter {
+	if ic, ok := c.(*instrumentedCache); ok {
+		if counter, ok := ic.cache.(Counter); ok {
+			return &instrumentedCounter{counter: counter, cache: ic}
+		}
+		return NewMemoryCounter()
+	}
+	if counter, ok := c.(Counter); ok {
+		return counter
+	}
+	return NewMemoryCounter()
+}
+
+// MemoryCounter is an in-process Counter. Counts are lost on restart and not shared between nodes.
+type MemoryCounter struct {
+	mu        sync.Mutex
+	counters  map[string]int64
+	expires   map[string]time.Time // Of the counters given a TTL
+	lastSweep time.Time
+}
+
+// counterSweepInterval is how often MemoryCounter drops expired counters.
+const counterSweepInterval = time.Minute
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{counters: make(map[string]int64), expires: make(map[string]time.Time)}
+}
+
+func (m *MemoryCounter) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key] += delta
+	return m.counters[key], nil
+}
+
+func (m *MemoryCounter) IncrByTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= counterSweepInterval {
+		for k, expiresAt := range m.expires {
+			if now.After(expiresAt) {
+				delete(m.counters, k)
+				delete(m.expires, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	if expiresAt, ok := m.expires[key]; ok && now.After(expiresAt) {
+		delete(m.counters, key)
+	}
+	m.counters[key] += delta
+	m.expires[key] = now.Add(ttl)
+	return m.counters[key], nil
+}
+
+func (m *MemoryCounter) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counters, key)
+	delete(m.expires, key)
+	return nil
+}
@@ -0,0 +1,62 @@
+// internal/cache/dedup.go
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Deduper remembers keys for a while, e.g. to count a viewer once per item per day.
+// RedisCache implements it so replicas share what they've seen; MemoryDeduper is the
+// single-process fallback.
+type Deduper interface {
+	// FirstSeen records key for ttl and reports whether it wasn't already recorded.
+	FirstSeen(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// NewDeduper returns c as a Deduper if the cache supports it, otherwise an in-memory one.
+func NewDeduper(c Cache) Deduper {
+	if ic, ok := c.(*instrumentedCache); ok {
+		if deduper, ok := ic.cache.(Deduper); ok {
+			return &instrumentedDeduper{deduper: deduper, cache: ic}
+		}
+		return NewMemoryDeduper()
+	}
+	if deduper, ok := c.(Deduper); ok {
+		return deduper
+	}
+	return NewMemoryDeduper()
+}
+
+// memoryDeduperSweepEvery is how many calls pass between sweeps of expired keys.
+const memoryDeduperSweepEvery = 1024
+
+// MemoryDeduper is an in-process Deduper. Keys are lost on restart and not shared between nodes.
+type MemoryDeduper struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	calls   int
+}
+
+func NewMemoryDeduper() *MemoryDeduper {
+	return &MemoryDeduper{expires: make(map[string]time.Time)}
+}
+
+func (m *MemoryDeduper) FirstSeen(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.calls++; m.calls%memoryDeduperSweepEvery == 0 {
+		for k, exp := range m.expires {
+			if now.After(exp) {
+				delete(m.expires, k)
+			}
+		}
+	}
+	if exp, ok := m.expires[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.expires[key] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,196 @@
+// internal/cache/instrumented.go
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"github.com/kkuzar/blog_system/internal/models"
+	"time"
+)
+
+// Instrument wraps c so the latency and failures of every call are recorded in the
+// metrics registry, labelled with backend (e.g. "redis" or "noop") and the method called.
+// Misses (ErrNotFound) don't count as failures. NewCounter, NewDeduper, NewLocker,
+// NewRateLimiter and NewSettings see through the wrapper, and instrument the shared ones too.
+func Instrument(c Cache, backend string) Cache {
+	return &instrumentedCache{cache: c, backend: backend}
+}
+
+type instrumentedCache struct {
+	cache   Cache
+	backend string
+}
+
+func (c *instrumentedCache) observe(operation string, start time.Time, err error) {
+	metrics.ObserveCall("cache", c.backend, operation, start, err != nil && !errors.Is(err, ErrNotFound))
+}
+
+func (c *instrumentedCache) Close() error {
+	return c.cache.Close()
+}
+
+func (c *instrumentedCache) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	start := time.Now()
+	user, err := c.cache.GetUser(ctx, userID)
+	c.observe("GetUser", start, err)
+	return user, err
+}
+
+func (c *instrumentedCache) SetUser(ctx context.Context, user *models.User, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetUser(ctx, user, expiration)
+	c.observe("SetUser", start, err)
+	return err
+}
+
+func (c *instrumentedCache) DeleteUser(ctx context.Context, userID string) error {
+	start := time.Now()
+	err := c.cache.DeleteUser(ctx, userID)
+	c.observe("DeleteUser", start, err)
+	return err
+}
+
+func (c *instrumentedCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
+	start := time.Now()
+	meta, err := c.cache.GetItemMeta(ctx, itemID, itemType)
+	c.observe("GetItemMeta", start, err)
+	return meta, err
+}
+
+func (c *instrumentedCache) SetItemMeta(ctx context.Context, meta models.ItemMeta, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetItemMeta(ctx, meta, expiration)
+	c.observe("SetItemMeta", start, err)
+	return err
+}
+
+func (c *instrumentedCache) DeleteItemMeta(ctx context.Context, itemID string, itemType models.ItemType) error {
+	start := time.Now()
+	err := c.cache.DeleteItemMeta(ctx, itemID, itemType)
+	c.observe("DeleteItemMeta", start, err)
+	return err
+}
+
+func (c *instrumentedCache) GetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	start := time.Now()
+	content, err := c.cache.GetItemContent(ctx, itemID, itemType, version)
+	c.observe("GetItemContent", start, err)
+	return content, err
+}
+
+func (c *instrumentedCache) SetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int, content string, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.SetItemContent(ctx, itemID, itemType, version, content, expiration)
+	c.observe("SetItemContent", start, err)
+	return err
+}
+
+func (c *instrumentedCache) DeleteItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) error {
+	start := time.Now()
+	err := c.cache.DeleteItemContent(ctx, itemID, itemType, version)
+	c.observe("DeleteItemContent", start, err)
+	return err
+}
+
+func (c *instrumentedCache) InvalidateItemContent(ctx context.Context, itemID string, itemType models.ItemType) error {
+	start := time.Now()
+	err := c.cache.InvalidateItemContent(ctx, itemID, itemType)
+	c.observe("InvalidateItemContent", start, err)
+	return err
+}
+
+func (c *instrumentedCache) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := c.cache.Ping(ctx)
+	c.observe("Ping", start, err)
+	return err
+}
+
+type instrumentedCounter struct {
+	counter Counter
+	cache   *instrumentedCache
+}
+
+func (c *instrumentedCounter) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	start := time.Now()
+	count, err := c.counter.IncrBy(ctx, key, delta)
+	c.cache.observe("IncrBy", start, err)
+	return count, err
+}
+
+func (c *instrumentedCounter) IncrByTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	count, err := c.counter.IncrByTTL(ctx, key, delta, ttl)
+	c.cache.observe("IncrByTTL", start, err)
+	return count, err
+}
+
+func (c *instrumentedCounter) Reset(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.counter.Reset(ctx, key)
+	c.cache.observe("Reset", start, err)
+	return err
+}
+
+type instrumentedDeduper struct {
+	deduper Deduper
+	cache   *instrumentedCache
+}
+
+func (d *instrumentedDeduper) FirstSeen(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	first, err := d.deduper.FirstSeen(ctx, key, ttl)
+	d.cache.observe("FirstSeen", start, err)
+	return first, err
+}
+
+type instrumentedLocker struct {
+	locker Locker
+	cache  *instrumentedCache
+}
+
+func (l *instrumentedLocker) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := l.locker.TryLock(ctx, key, token, ttl)
+	l.cache.observe("TryLock", start, err)
+	return ok, err
+}
+
+func (l *instrumentedLocker) Unlock(ctx context.Context, key, token string) error {
+	start := time.Now()
+	err := l.locker.Unlock(ctx, key, token)
+	l.cache.observe("Unlock", start, err)
+	return err
+}
+
+type instrumentedRateLimiter struct {
+	limiter RateLimiter
+	cache   *instrumentedCache
+}
+
+func (l *instrumentedRateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	start := time.Now()
+	allowed, retryAfter, err := l.limiter.Allow(ctx, key, limit)
+	l.cache.observe("Allow", start, err)
+	return allowed, retryAfter, err
+}
+
+type instrumentedSettings struct {
+	settings Settings
+	cache    *instrumentedCache
+}
+
+func (s *instrumentedSettings) GetSetting(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	value, err := s.settings.GetSetting(ctx, key)
+	s.cache.observe("GetSetting", start, err)
+	return value, err
+}
+
+func (s *instrumentedSettings) SetSetting(ctx context.Context, key, value string) error {
+	start := time.Now()
+	err := s.settings.SetSetting(ctx, key, value)
+	s.cache.observe("SetSetting", start, err)
+	return err
+}
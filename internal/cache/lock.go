@@ -0,0 +1,105 @@
+// internal/cache/lock.go
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// lockRetryInterval is how long Lock waits between attempts to take a held lock.
+const lockRetryInterval = 25 * time.Millisecond
+
+// Locker grants exclusive leases on keys, e.g. to serialize writes to one item.
+// RedisCache implements it so a lease holds across replicas; MemoryLocker is the
+// single-process fallback. A lease expires after its ttl even if never released, so a
+// crashed holder can't block the key for good.
+type Locker interface {
+	// TryLock takes the lease on key for ttl if no one holds it, reporting whether it did.
+	// token identifies this holder to Unlock.
+	TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Unlock releases the lease on key if token still holds it.
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// NewLocker returns c as a Locker if the cache supports shared locks, otherwise an
+// in-memory one.
+func NewLocker(c Cache) Locker {
+	if ic, ok := c.(*instrumentedCache); ok {
+		if locker, ok := ic.cache.(Locker); ok {
+			return &instrumentedLocker{locker: locker, cache: ic}
+		}
+		return NewMemoryLocker()
+	}
+	if locker, ok := c.(Locker); ok {
+		return locker
+	}
+	return NewMemoryLocker()
+}
+
+// Lock takes the lease on key for ttl, waiting up to wait for its holder to release it.
+// It returns ErrLockTimeout if the lease is still held after wait. The returned func
+// releases the lease.
+func Lock(ctx context.Context, l Locker, key string, ttl, wait time.Duration) (func(), error) {
+	token := uuid.NewString()
+	deadline := time.Now().Add(wait)
+	for {
+		ok, err := l.TryLock(ctx, key, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() {
+				// Release even if ctx was cancelled meanwhile, or others wait out the ttl
+				_ = l.Unlock(context.WithoutCancel(ctx), key, token)
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+type lease struct {
+	token   string
+	expires time.Time
+}
+
+// MemoryLocker is an in-process Locker. Leases are not shared between nodes.
+type MemoryLocker struct {
+	mu     sync.Mutex
+	leases map[string]lease
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{leases: make(map[string]lease)}
+}
+
+func (m *MemoryLocker) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if held, ok := m.leases[key]; ok && now.Before(held.expires) {
+		return false, nil
+	}
+	m.leases[key] = lease{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *MemoryLocker) Unlock(ctx context.Context, key, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.leases[key]; ok && held.token == token {
+		delete(m.leases, key)
+	}
+	return nil
+}
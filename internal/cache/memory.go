@@ -0,0 +1,150 @@
+// internal/cache/memory.go
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process Cache for a single node, e.g. in development. Entries are
+// lost on restart and not shared between nodes, so with several replicas one could serve
+// metadata another has already changed; use Redis there.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   interface{}
+	expires time.Time // Zero never expires
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryEntry)}
+}
+
+// key prefixes name with the tenant in ctx, so tenants' entries never collide.
+func (c *MemoryCache) key(ctx context.Context, name string) string {
+	if tenantID := tenant.ID(ctx); tenantID != "" {
+		return "t:" + tenantID + ":" + name
+	}
+	return name
+}
+
+func (c *MemoryCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *MemoryCache) set(key string, value interface{}, expiration time.Duration) {
+	entry := memoryEntry{value: value}
+	if expiration > 0 {
+		entry.expires = time.Now().Add(expiration)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *MemoryCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Values are stored and returned as copies, like a cache that serializes them.
+
+func (c *MemoryCache) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	value, ok := c.get(c.key(ctx, "user:"+userID))
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := value.(models.User)
+	return &user, nil
+}
+
+func (c *MemoryCache) SetUser(ctx context.Context, user *models.User, expiration time.Duration) error {
+	c.set(c.key(ctx, "user:"+user.ID), *user, expiration)
+	return nil
+}
+
+func (c *MemoryCache) DeleteUser(ctx context.Context, userID string) error {
+	c.delete(c.key(ctx, "user:"+userID))
+	return nil
+}
+
+func (c *MemoryCache) itemMetaKey(ctx context.Context, itemID string, itemType models.ItemType) string {
+	return c.key(ctx, fmt.Sprintf("item:meta:%s:%s", itemType, itemID))
+}
+
+// Item meta is stored and returned as copies, so callers can't change the cached value.
+
+func (c *MemoryCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
+	value, ok := c.get(c.itemMetaKey(ctx, itemID, itemType))
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value.(models.ItemMeta).CopyMeta(), nil
+}
+
+func (c *MemoryCache) SetItemMeta(ctx context.Context, meta models.ItemMeta, expiration time.Duration) error {
+	c.set(c.itemMetaKey(ctx, meta.GetID(), meta.Type()), meta.CopyMeta(), expiration)
+	return nil
+}
+
+func (c *MemoryCache) DeleteItemMeta(ctx context.Context, itemID string, itemType models.ItemType) error {
+	c.delete(c.itemMetaKey(ctx, itemID, itemType))
+	return nil
+}
+
+// itemContentPrefix is the key prefix of all cached versions of an item's content.
+func (c *MemoryCache) itemContentPrefix(ctx context.Context, itemID string, itemType models.ItemType) string {
+	return c.key(ctx, fmt.Sprintf("item:content:%s:%s:", itemType, itemID))
+}
+
+func (c *MemoryCache) GetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	value, ok := c.get(fmt.Sprintf("%sv%d", c.itemContentPrefix(ctx, itemID, itemType), version))
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value.(string), nil
+}
+
+func (c *MemoryCache) SetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int, content string, expiration time.Duration) error {
+	c.set(fmt.Sprintf("%sv%d", c.itemContentPrefix(ctx, itemID, itemType), version), content, expiration)
+	return nil
+}
+
+func (c *MemoryCache) DeleteItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) error {
+	c.delete(fmt.Sprintf("%sv%d", c.itemContentPrefix(ctx, itemID, itemType), version))
+	return nil
+}
+
+func (c *MemoryCache) InvalidateItemContent(ctx context.Context, itemID string, itemType models.ItemType) error {
+	prefix := c.itemContentPrefix(ctx, itemID, itemType)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) Ping(ctx context.Context) error { return nil }
+func (c *MemoryCache) Close() error                   { return nil }
@@ -0,0 +1,95 @@
+// internal/cache/ratelimit.go
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Rate events per Period, in bursts of up to Burst. A Rate <= 0 allows
+// any number of events.
+type RateLimit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// Unlimited reports whether the limit allows any number of events.
+func (l RateLimit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// interval is the time one event uses up of the allowance, 0 if it is Unlimited.
+func (l RateLimit) interval() time.Duration {
+	if l.Unlimited() {
+		return 0
+	}
+	return l.Period / time.Duration(l.Rate)
+}
+
+// RateLimiter enforces rate limits per key with the generic cell rate algorithm (GCRA):
+// each key keeps the time its allowance is next fully used up, which each allowed event
+// moves on by Period/Rate. RedisCache implements it so limits hold across replicas;
+// MemoryRateLimiter is the single-process fallback.
+type RateLimiter interface {
+	// Allow records an event for key if limit allows it now. Otherwise it reports how long
+	// until it would.
+	Allow(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// NewRateLimiter returns c as a RateLimiter if the cache supports shared limits,
+// otherwise an in-memory one.
+func NewRateLimiter(c Cache) RateLimiter {
+	if ic, ok := c.(*instrumentedCache); ok {
+		if limiter, ok := ic.cache.(RateLimiter); ok {
+			return &instrumentedRateLimiter{limiter: limiter, cache: ic}
+		}
+		return NewMemoryRateLimiter()
+	}
+	if limiter, ok := c.(RateLimiter); ok {
+		return limiter
+	}
+	return NewMemoryRateLimiter()
+}
+
+// memoryRateLimiterSweepEvery is how many calls pass between sweeps of idle keys.
+const memoryRateLimiterSweepEvery = 1024
+
+// MemoryRateLimiter is an in-process RateLimiter. Limits are per node, so with several
+// replicas a client gets the allowance of each.
+type MemoryRateLimiter struct {
+	mu    sync.Mutex
+	tats  map[string]time.Time // Theoretical arrival time of the next event, by key
+	calls int
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{tats: make(map[string]time.Time)}
+}
+
+func (m *MemoryRateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.calls++; m.calls%memoryRateLimiterSweepEvery == 0 {
+		for k, tat := range m.tats {
+			if tat.Before(now) {
+				delete(m.tats, k) // Full allowance again, as if never seen
+			}
+		}
+	}
+	tat := m.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if over := next.Sub(now) - limit.interval()*time.Duration(limit.Burst); over > 0 {
+		return false, over, nil
+	}
+	m.tats[key] = next
+	return true, 0, nil
+}
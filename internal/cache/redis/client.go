@@ -9,7 +9,8 @@ import (
 	"github.com/kkuzar/blog_system/internal/cache"
 	"github.com/kkuzar/blog_system/internal/config"
 	"github.com/kkuzar/blog_system/internal/models"
-	"log"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -23,7 +24,7 @@ type RedisCache struct {
 // NewRedisCache creates a new Redis cache client.
 func NewRedisCache(cfg *config.RedisConfig) (*RedisCache, error) {
 	if !cfg.Enabled {
-		log.Println("Redis is disabled in config.")
+		slog.Info("Redis is disabled in config")
 		// Return nil or a NoOpCache? Let's return nil and handle in main.
 		return nil, errors.New("redis disabled")
 	}
@@ -38,10 +39,11 @@ func NewRedisCache(cfg *config.RedisConfig) (*RedisCache, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close() // Startup may try again with a new client
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	log.Printf("Connected to Redis at %s, DB %d", cfg.Addr, cfg.DB)
+	slog.InfoContext(ctx, "Connected to Redis", "addr", cfg.Addr, "db", cfg.DB)
 	return &RedisCache{client: rdb, prefix: "gbc:"}, nil // Example prefix
 }
 
@@ -56,128 +58,136 @@ func (c *RedisCache) Close() error {
 	return nil
 }
 
+// Client exposes the underlying connection for components that keep their own data in
+// Redis (e.g. the job store). Their keys should start with KeyPrefix.
+func (c *RedisCache) Client() *redis.Client {
+	return c.client
+}
+
+func (c *RedisCache) KeyPrefix() string {
+	return c.prefix
+}
+
 // --- Key Generation ---
-func (c *RedisCache) userKey(userID string) string {
-	return fmt.Sprintf("%suser:%s", c.prefix, userID)
+
+// keyPrefix returns the prefix of the keys of the tenant in ctx, so tenants' entries
+// never collide.
+func (c *RedisCache) keyPrefix(ctx context.Context) string {
+	if tenantID := tenant.ID(ctx); tenantID != "" {
+		return c.prefix + "t:" + tenantID + ":"
+	}
+	return c.prefix
+}
+func (c *RedisCache) userKey(ctx context.Context, userID string) string {
+	return fmt.Sprintf("%suser:%s", c.keyPrefix(ctx), userID)
+}
+func (c *RedisCache) itemMetaKey(ctx context.Context, itemID string, itemType models.ItemType) string {
+	return fmt.Sprintf("%sitem:meta:%s:%s", c.keyPrefix(ctx), itemType, itemID)
+}
+func (c *RedisCache) itemContentKey(ctx context.Context, itemID string, itemType models.ItemType, version int) string {
+	return fmt.Sprintf("%sitem:content:%s:%s:v%d", c.keyPrefix(ctx), itemType, itemID, version)
 }
-func (c *RedisCache) itemMetaKey(itemID string, itemType models.ItemType) string {
-	return fmt.Sprintf("%sitem:meta:%s:%s", c.prefix, itemType, itemID)
+func (c *RedisCache) counterKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("%scounter:%s", c.keyPrefix(ctx), key)
 }
-func (c *RedisCache) itemContentKey(itemID string, itemType models.ItemType, version int) string {
-	return fmt.Sprintf("%sitem:content:%s:%s:v%d", c.prefix, itemType, itemID, version)
+func (c *RedisCache) seenKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("%sseen:%s", c.keyPrefix(ctx), key)
 }
-func (c *RedisCache) itemContentPattern(itemID string, itemType models.ItemType) string {
-	return fmt.Sprintf("%sitem:content:%s:%s:v*", c.prefix, itemType, itemID) // Pattern for invalidation
+func (c *RedisCache) lockKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("%slock:%s", c.keyPrefix(ctx), key)
+}
+func (c *RedisCache) rateKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("%srate:%s", c.keyPrefix(ctx), key)
+}
+func (c *RedisCache) settingKey(key string) string {
+	return fmt.Sprintf("%ssetting:%s", c.prefix, key)
+}
+func (c *RedisCache) itemContentPattern(ctx context.Context, itemID string, itemType models.ItemType) string {
+	return fmt.Sprintf("%sitem:content:%s:%s:v*", c.keyPrefix(ctx), itemType, itemID) // Pattern for invalidation
 }
 
 // --- User Methods ---
 func (c *RedisCache) GetUser(ctx context.Context, userID string) (*models.User, error) {
-	key := c.userKey(userID)
+	key := c.userKey(ctx, userID)
 	val, err := c.client.Get(ctx, key).Bytes()
 	if err == redis.Nil {
 		return nil, cache.ErrNotFound
 	} else if err != nil {
-		log.Printf("Redis GET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis GET error for key", "key", key, "error", err)
 		return nil, err
 	}
 
 	var user models.User
 	if err := json.Unmarshal(val, &user); err != nil {
-		log.Printf("Redis JSON unmarshal error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis JSON unmarshal error for key", "key", key, "error", err)
 		return nil, err
 	}
 	return &user, nil
 }
 
 func (c *RedisCache) SetUser(ctx context.Context, user *models.User, expiration time.Duration) error {
-	key := c.userKey(user.ID)
+	key := c.userKey(ctx, user.ID)
 	val, err := json.Marshal(user)
 	if err != nil {
-		log.Printf("Redis JSON marshal error for user %s: %v", user.ID, err)
+		slog.ErrorContext(ctx, "Redis JSON marshal error for user", "userID", user.ID, "error", err)
 		return err
 	}
 	if err := c.client.Set(ctx, key, val, expiration).Err(); err != nil {
-		log.Printf("Redis SET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis SET error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
 }
 
 func (c *RedisCache) DeleteUser(ctx context.Context, userID string) error {
-	key := c.userKey(userID)
+	key := c.userKey(ctx, userID)
 	if err := c.client.Del(ctx, key).Err(); err != nil && err != redis.Nil {
-		log.Printf("Redis DEL error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis DEL error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
 }
 
 // --- Item Meta Methods ---
-func (c *RedisCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (interface{}, error) {
-	key := c.itemMetaKey(itemID, itemType)
+func (c *RedisCache) GetItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
+	key := c.itemMetaKey(ctx, itemID, itemType)
 	val, err := c.client.Get(ctx, key).Bytes()
 	if err == redis.Nil {
 		return nil, cache.ErrNotFound
 	} else if err != nil {
-		log.Printf("Redis GET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis GET error for key", "key", key, "error", err)
 		return nil, err
 	}
 
-	// Need to unmarshal into the correct type
-	var meta interface{}
-	switch itemType {
-	case models.ItemTypePost:
-		var post models.Post
-		if err := json.Unmarshal(val, &post); err != nil {
-			log.Printf("Redis JSON unmarshal error for post key %s: %v", key, err)
-			return nil, err
-		}
-		meta = &post
-	case models.ItemTypeCodeFile:
-		var codeFile models.CodeFile
-		if err := json.Unmarshal(val, &codeFile); err != nil {
-			log.Printf("Redis JSON unmarshal error for codefile key %s: %v", key, err)
-			return nil, err
-		}
-		meta = &codeFile
-	default:
+	meta := models.NewItemMeta(itemType)
+	if meta == nil {
 		return nil, errors.New("invalid item type for cache")
 	}
+	if err := json.Unmarshal(val, meta); err != nil {
+		slog.ErrorContext(ctx, "Redis JSON unmarshal error for item meta key", "key", key, "itemType", itemType, "error", err)
+		return nil, err
+	}
 	return meta, nil
 }
 
-func (c *RedisCache) SetItemMeta(ctx context.Context, itemID string, itemType models.ItemType, meta interface{}, expiration time.Duration) error {
-	key := c.itemMetaKey(itemID, itemType)
-	// Ensure meta is the correct type before marshalling
-	switch itemType {
-	case models.ItemTypePost:
-		if _, ok := meta.(*models.Post); !ok {
-			return errors.New("invalid meta type for post")
-		}
-	case models.ItemTypeCodeFile:
-		if _, ok := meta.(*models.CodeFile); !ok {
-			return errors.New("invalid meta type for codefile")
-		}
-	default:
-		return errors.New("invalid item type for cache")
-	}
-
+func (c *RedisCache) SetItemMeta(ctx context.Context, meta models.ItemMeta, expiration time.Duration) error {
+	key := c.itemMetaKey(ctx, meta.GetID(), meta.Type())
 	val, err := json.Marshal(meta)
 	if err != nil {
-		log.Printf("Redis JSON marshal error for item %s (%s): %v", itemID, itemType, err)
+		slog.ErrorContext(ctx, "Redis JSON marshal error", "itemID", meta.GetID(), "itemType", meta.Type(), "error", err)
 		return err
 	}
 	if err := c.client.Set(ctx, key, val, expiration).Err(); err != nil {
-		log.Printf("Redis SET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis SET error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
 }
 
 func (c *RedisCache) DeleteItemMeta(ctx context.Context, itemID string, itemType models.ItemType) error {
-	key := c.itemMetaKey(itemID, itemType)
+	key := c.itemMetaKey(ctx, itemID, itemType)
 	if err := c.client.Del(ctx, key).Err(); err != nil && err != redis.Nil {
-		log.Printf("Redis DEL error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis DEL error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
@@ -185,30 +195,30 @@ func (c *RedisCache) DeleteItemMeta(ctx context.Context, itemID string, itemType
 
 // --- Item Content Methods ---
 func (c *RedisCache) GetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
-	key := c.itemContentKey(itemID, itemType, version)
+	key := c.itemContentKey(ctx, itemID, itemType, version)
 	val, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return "", cache.ErrNotFound
 	} else if err != nil {
-		log.Printf("Redis GET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis GET error for key", "key", key, "error", err)
 		return "", err
 	}
 	return val, nil
 }
 
 func (c *RedisCache) SetItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int, content string, expiration time.Duration) error {
-	key := c.itemContentKey(itemID, itemType, version)
+	key := c.itemContentKey(ctx, itemID, itemType, version)
 	if err := c.client.Set(ctx, key, content, expiration).Err(); err != nil {
-		log.Printf("Redis SET error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis SET error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
 }
 
 func (c *RedisCache) DeleteItemContent(ctx context.Context, itemID string, itemType models.ItemType, version int) error {
-	key := c.itemContentKey(itemID, itemType, version)
+	key := c.itemContentKey(ctx, itemID, itemType, version)
 	if err := c.client.Del(ctx, key).Err(); err != nil && err != redis.Nil {
-		log.Printf("Redis DEL error for key %s: %v", key, err)
+		slog.ErrorContext(ctx, "Redis DEL error for key", "key", key, "error", err)
 		return err
 	}
 	return nil
@@ -216,24 +226,161 @@ func (c *RedisCache) DeleteItemContent(ctx context.Context, itemID string, itemT
 
 // InvalidateItemContent deletes all cached versions for a given item.
 func (c *RedisCache) InvalidateItemContent(ctx context.Context, itemID string, itemType models.ItemType) error {
-	pattern := c.itemContentPattern(itemID, itemType)
+	pattern := c.itemContentPattern(ctx, itemID, itemType)
 	iter := c.client.Scan(ctx, 0, pattern, 0).Iterator()
 	keysToDelete := []string{}
 	for iter.Next(ctx) {
 		keysToDelete = append(keysToDelete, iter.Val())
 	}
 	if err := iter.Err(); err != nil {
-		log.Printf("Redis SCAN error for pattern %s: %v", pattern, err)
+		slog.ErrorContext(ctx, "Redis SCAN error for pattern", "pattern", pattern, "error", err)
 		// Continue to delete keys found so far, but return error
 		// return err
 	}
 
 	if len(keysToDelete) > 0 {
 		if err := c.client.Del(ctx, keysToDelete...).Err(); err != nil && err != redis.Nil {
-			log.Printf("Redis DEL error for keys matching %s: %v", pattern, err)
+			slog.ErrorContext(ctx, "Redis DEL error for keys matching", "pattern", pattern, "error", err)
 			return err
 		}
-		log.Printf("Invalidated %d content cache entries for %s %s", len(keysToDelete), itemType, itemID)
+		slog.InfoContext(ctx, "Invalidated content cache entries", "keys", len(keysToDelete), "itemType", itemType, "itemID", itemID)
 	}
 	return iter.Err() // Return scan error if any
 }
+
+// --- Counter Methods (implements cache.Counter) ---
+
+// counterTTL bounds how long an idle counter (e.g. for an abandoned item) lingers in Redis.
+const counterTTL = 7 * 24 * time.Hour
+
+func (c *RedisCache) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.IncrByTTL(ctx, key, delta, counterTTL)
+}
+
+func (c *RedisCache) IncrByTTL(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	rkey := c.counterKey(ctx, key)
+	pipe := c.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, rkey, delta)
+	pipe.Expire(ctx, rkey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.ErrorContext(ctx, "Redis INCRBY error for key", "key", rkey, "error", err)
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (c *RedisCache) Reset(ctx context.Context, key string) error {
+	rkey := c.counterKey(ctx, key)
+	if err := c.client.Del(ctx, rkey).Err(); err != nil && err != redis.Nil {
+		slog.ErrorContext(ctx, "Redis DEL error for key", "key", rkey, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Deduper Methods (implements cache.Deduper) ---
+
+func (c *RedisCache) FirstSeen(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	rkey := c.seenKey(ctx, key)
+	first, err := c.client.SetNX(ctx, rkey, 1, ttl).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "Redis SETNX error for key", "key", rkey, "error", err)
+		return false, err
+	}
+	return first, nil
+}
+
+// --- Locker Methods (implements cache.Locker) ---
+
+// unlockScript deletes a lock only if it still holds the caller's token, so a holder
+// whose lease expired can't release the next holder's.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (c *RedisCache) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	rkey := c.lockKey(ctx, key)
+	ok, err := c.client.SetNX(ctx, rkey, token, ttl).Result()
+	if err != nil {
+		slog.ErrorContext(ctx, "Redis SETNX error for key", "key", rkey, "error", err)
+		return false, err
+	}
+	return ok, nil
+}
+
+func (c *RedisCache) Unlock(ctx context.Context, key, token string) error {
+	rkey := c.lockKey(ctx, key)
+	if err := unlockScript.Run(ctx, c.client, []string{rkey}, token).Err(); err != nil && err != redis.Nil {
+		slog.ErrorContext(ctx, "Redis unlock error for key", "key", rkey, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- RateLimiter Methods (implements cache.RateLimiter) ---
+
+// gcraScript applies the GCRA to the theoretical arrival time stored at KEYS[1], in
+// microseconds of the Redis server's clock, so replicas' clocks needn't agree. ARGV are
+// the emission interval and the burst tolerance (interval * burst), in microseconds. It
+// returns 0 if the event is allowed, else the microseconds until it would be.
+var gcraScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local next = tat + interval
+local over = next - now - tolerance
+if over > 0 then
+	return over
+end
+redis.call("SET", KEYS[1], string.format("%d", next), "PX", math.ceil((next - now) / 1000))
+return 0`)
+
+func (c *RedisCache) Allow(ctx context.Context, key string, limit cache.RateLimit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+	rkey := c.rateKey(ctx, key)
+	interval := (limit.Period / time.Duration(limit.Rate)).Microseconds()
+	over, err := gcraScript.Run(ctx, c.client, []string{rkey}, interval, interval*int64(limit.Burst)).Int64()
+	if err != nil {
+		slog.ErrorContext(ctx, "Redis rate limit error for key", "key", rkey, "error", err)
+		return false, 0, err
+	}
+	if over > 0 {
+		return false, time.Duration(over) * time.Microsecond, nil
+	}
+	return true, 0, nil
+}
+
+// --- Settings Methods (implements cache.Settings) ---
+
+// Settings are server-wide, so their keys take no tenant.
+
+func (c *RedisCache) GetSetting(ctx context.Context, key string) (string, error) {
+	rkey := c.settingKey(key)
+	value, err := c.client.Get(ctx, rkey).Result()
+	if err == redis.Nil {
+		return "", cache.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Redis GET error for key", "key", rkey, "error", err)
+		return "", err
+	}
+	return value, nil
+}
+
+func (c *RedisCache) SetSetting(ctx context.Context, key, value string) error {
+	rkey := c.settingKey(key)
+	if err := c.client.Set(ctx, rkey, value, 0).Err(); err != nil {
+		slog.ErrorContext(ctx, "Redis SET error for key", "key", rkey, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// internal/cache/settings.go
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+// Settings holds server-wide values that every replica must agree on, e.g. whether the
+// server is in maintenance mode. Unlike the other entries they belong to no tenant and
+// never expire. RedisCache implements it so replicas share them; MemorySettings is the
+// single-process fallback.
+type Settings interface {
+	// GetSetting returns the value of key, or ErrNotFound if it was never set.
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+}
+
+// NewSettings returns c as Settings if the cache supports them, otherwise in-memory ones.
+func NewSettings(c Cache) Settings {
+	if ic, ok := c.(*instrumentedCache); ok {
+		if settings, ok := ic.cache.(Settings); ok {
+			return &instrumentedSettings{settings: settings, cache: ic}
+		}
+		return NewMemorySettings()
+	}
+	if settings, ok := c.(Settings); ok {
+		return settings
+	}
+	return NewMemorySettings()
+}
+
+// MemorySettings are in-process Settings. Values are lost on restart and not shared between nodes.
+type MemorySettings struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+func NewMemorySettings() *MemorySettings {
+	return &MemorySettings{values: make(map[string]string)}
+}
+
+func (m *MemorySettings) GetSetting(ctx context.Context, key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.values[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *MemorySettings) SetSetting(ctx context.Context, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+	return nil
+}
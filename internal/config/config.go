@@ -1,9 +1,12 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,6 +15,33 @@ import (
 type ServerConfig struct {
 	Port string
 	Host string
+
+	// TLS, either from certificate files or obtained from Let's Encrypt (autocert)
+	TLSCertFile      string
+	TLSKeyFile       string
+	AutocertDomains  []string // Non-empty enables autocert for these host names
+	AutocertEmail    string   // Optional contact for expiry notices
+	AutocertCacheDir string   // Where certificates are kept across restarts
+	RedirectPort     string   // Optional: plain HTTP port redirecting to HTTPS (and answering ACME challenges)
+
+	// Reverse proxies (CIDRs or addresses) whose X-Forwarded-For is believed; other
+	// clients are known by their connection's address
+	TrustedProxies []string
+
+	RequestTimeout  time.Duration // Requests still running after this long get a 504 (0 for no limit)
+	ShutdownTimeout time.Duration // How long shutdown waits for requests, clients and writes to finish
+
+	StartupWait       time.Duration // How long startup keeps retrying each of the database, Redis and storage (0 to fail at once)
+	StartupMaxBackoff time.Duration // Longest pause between those retries; pauses double from 1s up to it
+
+	// Start in maintenance mode (read-only) with this message; see PUT /admin/maintenance
+	MaintenanceMode    bool
+	MaintenanceMessage string
+}
+
+// TLSEnabled reports whether the server listens with TLS.
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.AutocertDomains) > 0
 }
 
 type JWTConfig struct {
@@ -20,24 +50,28 @@ type JWTConfig struct {
 }
 
 type DBConfig struct {
-	Type         string // "mongodb", "dynamodb", "firestore"
+	Type         string // "mongodb", "dynamodb", "firestore" or "memory"
 	MongoURI     string
 	MongoDBName  string
 	DynamoRegion string
 	DynamoTable  string
 	// Dynamo credentials handled by AWS SDK (env vars, shared config, IAM role)
 	FirestoreProjectID   string
-	FirestoreCredentials string // Path to service account JSON file
+	FirestoreCredentials string        // Path to service account JSON file
+	Timeout              time.Duration // Each call gives up after this long (0 for no limit)
 }
 
 type StorageConfig struct {
-	Type           string // "s3"
+	Type           string // "s3", "local" or "memory"
 	S3Region       string
 	S3Bucket       string
-	S3Endpoint     string // Optional: for MinIO or other S3 compatible
-	S3AccessKey    string // Optional: Use IAM roles in production
-	S3SecretKey    string // Optional: Use IAM roles in production
-	S3UsePathStyle bool   // Optional: for MinIO
+	S3Endpoint     string        // Optional: for MinIO or other S3 compatible
+	S3AccessKey    string        // Optional: Use IAM roles in production
+	S3SecretKey    string        // Optional: Use IAM roles in production
+	S3UsePathStyle bool          // Optional: for MinIO
+	LocalDir       string        // Directory of the local storage
+	Timeout        time.Duration // Each call (downloads including the read) gives up after this long (0 for no limit)
+	VerifyReads    bool          // Check content downloaded for an item against the hash recorded in its metadata
 }
 
 type RedisConfig struct {
@@ -47,84 +81,770 @@ type RedisConfig struct {
 	Enabled  bool // Flag to enable/disable caching easily
 }
 
+type CacheConfig struct {
+	UserTTL        time.Duration
+	ItemMetaTTL    time.Duration
+	ItemContentTTL time.Duration
+	WarmItems      int           // Items whose metadata and content are preloaded on startup (0 to disable)
+	WarmWindow     time.Duration // How far back history is read to find recently active items
+}
+
 type SnapshotConfig struct {
-	IntervalChanges int // Take snapshot every N changes (0 to disable)
+	IntervalChanges int  // Take snapshot every N changes (0 to disable)
+	RetainVersions  bool // Keep an immutable copy of every version's content for historical reads
+	// Retained versions are kept in full every FullVersionInterval versions, and as a
+	// delta against the last full one in between (1 keeps every version in full). They
+	// are written in full and delta-encoded by compaction.
+	FullVersionInterval int
+	CompactionInterval  time.Duration // How often to rewrite old retained versions to the current layout (0 to disable)
+}
+
+type QuotaConfig struct {
+	MaxBytesPerUser int64 // Total content bytes a user may store (0 for unlimited)
+	// Authenticated API requests and WebSocket messages a user may make per UTC day (0
+	// for unlimited). Counted in the shared cache, or per replica without Redis.
+	DailyRequests   int
+	DailyWSMessages int
+}
+
+type TrashConfig struct {
+	Retention     time.Duration // Deleted items are purged after this long (0 keeps them forever)
+	PurgeInterval time.Duration // How often to look for expired trash
+}
+
+type HistoryConfig struct {
+	PatchRetention     time.Duration // Patch entries older than this are collapsed into a snapshot (0 keeps them forever)
+	CompactionInterval time.Duration // How often to compact history
+}
+
+// JournalConfig bounds the change journal: the batch of changes behind each version of
+// an item, kept apart from the history log. Entries are dropped once past either limit.
+type JournalConfig struct {
+	MaxVersions        int           // Entries kept per item, newest first (0 for no limit)
+	Retention          time.Duration // Entries older than this are dropped (0 keeps them forever)
+	CompactionInterval time.Duration // How often to compact the journal
+}
+
+type StatsConfig struct {
+	FlushInterval time.Duration // How often buffered view/edit counts are written to the database
+}
+
+type JobsConfig struct {
+	Workers int    // Background jobs run concurrently
+	Backend string // "memory" (default; pending jobs are lost on restart) or "redis"
+}
+
+// WriteLockConfig serializes content writes to an item across nodes with a lease in the
+// shared cache (in memory without Redis).
+type WriteLockConfig struct {
+	Enabled bool
+	TTL     time.Duration // A lease whose holder died expires after this long
+	Wait    time.Duration // How long a write waits for the lease before failing
+}
+
+type AdminConfig struct {
+	UserIDs []string // Users allowed to call the admin API
+}
+
+type SearchConfig struct {
+	Enabled   bool   // Index content for full-text search
+	Type      string // "bleve" (local, default), "elasticsearch" or "opensearch"
+	IndexPath string // Directory of the local Bleve index; empty keeps it in memory
+	QueueSize int    // Pending index updates before new ones are dropped
+	// Elasticsearch/OpenSearch cluster
+	ElasticURLs     []string // Node base URLs, tried in order
+	ElasticIndex    string
+	ElasticUsername string // Optional: basic auth
+	ElasticPassword string
+	ElasticAPIKey   string // Optional: takes precedence over basic auth
+}
+
+type FormatConfig struct {
+	// Commands maps languages to external formatter command lines that read the file on
+	// stdin and write the result to stdout. "{file}" is replaced by the file's path,
+	// e.g. "prettier --stdin-filepath {file}". Go is formatted in-process unless listed.
+	Commands map[string]string
+	Timeout  time.Duration // Per run of an external formatter
+}
+
+type RunnerConfig struct {
+	Type           string        // "" (code execution disabled), "docker" or "piston"
+	Timeout        time.Duration // Wall-clock limit per run
+	MemoryMB       int           // Memory limit per run
+	MaxOutputBytes int           // stdout and stderr are each cut off after this many bytes
+	MaxConcurrent  int           // Runs (e.g. containers) at once on each replica; more wait
+	MaxPerUser     int           // Runs at once for one user on each replica; more are refused
+	// Docker: runs each file in a fresh container without network access
+	DockerBinary string
+	// Piston (https://github.com/engineer-man/piston) or a compatible service
+	PistonURL string // Base URL, e.g. http://localhost:2000
+}
+
+// RateLimitConfig limits how fast each client may call the API and send WebSocket
+// messages. Limits are shared by all replicas through Redis when it is enabled, else
+// each replica enforces them on its own. Bursts above the steady rate are allowed up to
+// the burst size.
+type RateLimitConfig struct {
+	Enabled             bool
+	RequestsPerMinute   int // HTTP requests per client IP
+	RequestBurst        int
+	AuthPerMinute       int // Login and registration attempts per client IP, on top of the above
+	AuthBurst           int
+	WSMessagesPerMinute int // WebSocket messages per user (or connection address before auth)
+	WSMessageBurst      int
+}
+
+type MetricsConfig struct {
+	Enabled bool   // Record metrics and serve them at GET /metrics (Prometheus text format)
+	Token   string // Optional: scrapers must send it as a bearer token
+}
+
+// ErrorReportConfig sends panics, 5xx responses and storage/database inconsistencies to
+// an error tracker, so they reach someone on call. Either or both sinks may be set.
+type ErrorReportConfig struct {
+	SentryDSN   string // Sentry (or a Sentry-compatible service, e.g. GlitchTip) project DSN
+	WebhookURL  string // Receives each event as a JSON POST, e.g. an alerting gateway
+	Environment string // Reported with each event, e.g. "production"
+	Report5xx   bool   // Also report responses with a 5xx status, not only panics and inconsistencies
+}
+
+// Enabled reports whether any sink is configured.
+func (c *ErrorReportConfig) Enabled() bool {
+	return c.SentryDSN != "" || c.WebhookURL != ""
+}
+
+// AuditExportConfig streams history and authentication events to external sinks. Each
+// sink is enabled by its address and receives the event types its Events patterns match:
+// a type such as "auth.login", a prefix such as "history.*", or "*".
+type AuditExportConfig struct {
+	WebhookURL    string
+	WebhookToken  string // Optional: sent as a bearer token
+	WebhookEvents []string
+	KafkaRESTURL  string // Kafka REST proxy, e.g. http://kafka-rest:8082
+	KafkaTopic    string
+	KafkaEvents   []string
+	S3Bucket      string // Batch files, with the S3 region and credentials of storage
+	S3Prefix      string
+	S3Events      []string
+
+	QueueSize     int           // Events waiting per sink; more are dropped
+	BatchSize     int           // Events per request or file
+	FlushInterval time.Duration // A partial batch is sent after this long
+}
+
+// TenancyConfig enables serving several isolated organizations (tenants) from one
+// deployment. Each request's tenant is found from its host name, else the tenant claim
+// of its token, else Default.
+type TenancyConfig struct {
+	Enabled    bool
+	Tenants    []string          // IDs of the tenants served
+	Hosts      map[string]string // Host name -> tenant ID
+	BaseDomain string            // Optional: <tenant>.<BaseDomain> serves the tenant
+	Default    string            // Optional: tenant of requests nothing else resolves
+}
+
+// SiteConfig serves one user's published posts as a server-rendered HTML blog at the
+// root of the server, next to the API, and any user's at the custom domains they verify.
+type SiteConfig struct {
+	Enabled       bool
+	UserID        string        // Whose posts are the blog
+	Title         string        // Optional: defaults to the user's name
+	BaseURL       string        // Public address, e.g. https://blog.example.com; makes Open Graph URLs absolute
+	CacheTTL      time.Duration // How long rendered pages are cached in memory and by browsers
+	CacheStale    time.Duration // How much longer an expired page is served while it is rendered again
+	ThemesDir     string        // Optional: directory of themes users can pick, one per subdirectory (see package site)
+	CustomDomains bool          // Users can add domains of their own to serve their blog at
+}
+
+// PushConfig enables Web Push notifications to users' browsers. The VAPID key pair
+// identifies the server to browsers' push services; blogctl push-keys generates one.
+type PushConfig struct {
+	VAPIDPrivateKey string        // P-256 private key, base64url; empty disables Web Push
+	VAPIDSubject    string        // Contact for push service operators: a mailto: or https: URL
+	TTL             time.Duration // How long push services hold a notification for a browser that is offline
+}
+
+// Enabled reports whether Web Push is configured.
+func (c *PushConfig) Enabled() bool {
+	return c.VAPIDPrivateKey != ""
+}
+
+// MailConfig sends email through an SMTP server, e.g. activity digests. STARTTLS is used
+// when the server offers it; credentials are only sent over TLS or to localhost.
+type MailConfig struct {
+	SMTPAddr string // host:port, e.g. smtp.example.com:587; empty disables email
+	Username string // Optional
+	Password string
+	From     string // Sender address, e.g. "Blog <blog@example.com>"
+}
+
+// Enabled reports whether email is configured.
+func (c *MailConfig) Enabled() bool {
+	return c.SMTPAddr != ""
+}
+
+// DigestConfig sends each user who set an email address a periodic digest of activity
+// on their items. It needs email to be configured.
+type DigestConfig struct {
+	IntervalDays int // Days covered by each digest, e.g. 7 for weekly; 0 disables digests
+}
+
+// CommentsConfig decides which comments are held for the item owner's approval, and
+// checks comments for spam with an external service.
+type CommentsConfig struct {
+	Moderation     string // "none", "others" (default: hold comments by users without access to the item) or "all" (all but the owner's)
+	MaxLinks       int    // Hold comments with more links than this (0 for no limit)
+	Rate           int    // Comments a user may post per hour (0 for no limit)
+	MentionRate    int    // Users a user may mention per hour; further mentions are plain text (0 for no limit)
+	SpamChecker    string // "" (none) or "akismet"
+	AkismetKey     string
+	AkismetSiteURL string // The blog's address, as registered with Akismet
+}
+
+// DataExportConfig covers the archives users can request: of their data, and of their
+// blog as a static site.
+type DataExportConfig struct {
+	Retention time.Duration // A finished archive is deleted after this long
+}
+
+type LogConfig struct {
+	Level  string // "debug", "info" (default), "warn" or "error"
+	Format string // "text" (default) or "json"
+
+	// Access log of every HTTP request. Without a format, requests are logged as lines of
+	// the application log.
+	AccessFormat     string        // "", "json", "combined" (Apache) or "off"
+	AccessFile       string        // Optional: write the access log here instead of stdout
+	AccessMaxSize    int64         // Rotate the file once it reaches this many bytes (0 never)
+	AccessMaxBackups int           // Rotated files kept (0 keeps all)
+	AccessMaxAge     time.Duration // Rotated files older than this are deleted (0 keeps them)
+}
+
+type HooksConfig struct {
+	LinkCheck        bool          // Report broken links in posts (fetches every link in the background)
+	LinkCheckTimeout time.Duration // Per link
 }
 
 type Config struct {
-	Server   ServerConfig
-	JWT      JWTConfig
-	Database DBConfig
-	Storage  StorageConfig
-	Redis    RedisConfig    // Added
-	Snapshot SnapshotConfig // Added
+	DevMode     bool   // Defaults suit local development without external services
+	SeedFile    string // Fixtures the server loads at startup ("demo" for the built-in set); see package seed
+	Server      ServerConfig
+	JWT         JWTConfig
+	Database    DBConfig
+	Storage     StorageConfig
+	Redis       RedisConfig    // Added
+	Snapshot    SnapshotConfig // Added
+	Cache       CacheConfig
+	Quota       QuotaConfig
+	Trash       TrashConfig
+	History     HistoryConfig
+	Journal     JournalConfig
+	Stats       StatsConfig
+	Search      SearchConfig
+	Jobs        JobsConfig
+	WriteLock   WriteLockConfig
+	Admin       AdminConfig
+	Format      FormatConfig
+	Runner      RunnerConfig
+	Hooks       HooksConfig
+	Log         LogConfig
+	RateLimit   RateLimitConfig
+	Metrics     MetricsConfig
+	ErrorReport ErrorReportConfig
+	AuditExport AuditExportConfig
+	Tenancy     TenancyConfig
+	Site        SiteConfig
+	Push        PushConfig
+	Mail        MailConfig
+	Digest      DigestConfig
+	Comments    CommentsConfig
+	DataExport  DataExportConfig
 }
 
-func LoadConfig() (*Config, error) {
+// LoadConfig loads the configuration from the config file at path, or the one named by
+// CONFIG_FILE if path is empty (there may be none), and the environment (and a .env file),
+// which takes precedence. Settings that are unknown or malformed are errors.
+func LoadConfig(path string) (*Config, error) {
 	_ = godotenv.Load()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
 
-	jwtExpMinutes, _ := strconv.Atoi(getEnv("JWT_EXPIRATION_MINUTES", "60"))
-	s3UsePathStyle, _ := strconv.ParseBool(getEnv("S3_USE_PATH_STYLE", "false"))
-	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
-	redisEnabled, _ := strconv.ParseBool(getEnv("REDIS_ENABLED", "true"))          // Enabled by default if configured
-	snapshotInterval, _ := strconv.Atoi(getEnv("SNAPSHOT_INTERVAL_CHANGES", "50")) // Snapshot every 50 changes
+	src, err := newSource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// DEV_MODE changes the defaults so the server runs with no external services: an
+	// in-memory database, storage and search index and an in-process cache. Settings
+	// that are set explicitly still apply.
+	devMode := src.getBool("DEV_MODE", "false")
+	orDev := func(value, devValue string) string {
+		if devMode {
+			return devValue
+		}
+		return value
+	}
+
+	jwtExpMinutes := src.getInt("JWT_EXPIRATION_MINUTES", "60")
+	s3UsePathStyle := src.getBool("S3_USE_PATH_STYLE", "false")
+	verifyReads := src.getBool("STORAGE_VERIFY_READS", "false")
+	redisDB := src.getInt("REDIS_DB", "0")
+	redisEnabled := src.getBool("REDIS_ENABLED", orDev("true", "false")) // Enabled by default if configured
+	snapshotInterval := src.getInt("SNAPSHOT_INTERVAL_CHANGES", "50")    // Snapshot every 50 changes
+	userCacheMinutes := src.getInt("CACHE_USER_TTL_MINUTES", "60")
+	itemMetaCacheMinutes := src.getInt("CACHE_ITEM_META_TTL_MINUTES", "30")
+	itemContentCacheMinutes := src.getInt("CACHE_ITEM_CONTENT_TTL_MINUTES", "10") // Shorter for content
+	cacheWarmItems := src.getInt("CACHE_WARM_ITEMS", "0")
+	cacheWarmWindowHours := src.getInt("CACHE_WARM_WINDOW_HOURS", "24")
+	retainVersions := src.getBool("RETAIN_VERSION_CONTENT", "true")
+	fullVersionInterval := src.getInt("VERSION_FULL_COPY_INTERVAL", "20")
+	versionCompactionMinutes := src.getInt("VERSION_COMPACTION_INTERVAL_MINUTES", "720")
+	quotaMB := src.getInt64("USER_STORAGE_QUOTA_MB", "0")
+	quotaDailyRequests := src.getInt("USER_DAILY_REQUEST_QUOTA", "0")
+	quotaDailyWSMessages := src.getInt("USER_DAILY_WS_MESSAGE_QUOTA", "0")
+	trashRetentionDays := src.getInt("TRASH_RETENTION_DAYS", "30")
+	trashPurgeMinutes := src.getInt("TRASH_PURGE_INTERVAL_MINUTES", "60")
+	historyRetentionDays := src.getInt("HISTORY_PATCH_RETENTION_DAYS", "90")
+	historyCompactionMinutes := src.getInt("HISTORY_COMPACTION_INTERVAL_MINUTES", "360")
+	journalMaxVersions := src.getInt("JOURNAL_MAX_VERSIONS", "1000")
+	journalRetentionDays := src.getInt("JOURNAL_RETENTION_DAYS", "90")
+	journalCompactionMinutes := src.getInt("JOURNAL_COMPACTION_INTERVAL_MINUTES", "360")
+	statsFlushSeconds := src.getInt("STATS_FLUSH_INTERVAL_SECONDS", "30")
+	searchEnabled := src.getBool("SEARCH_ENABLED", "true")
+	searchQueueSize := src.getInt("SEARCH_QUEUE_SIZE", "1024")
+	jobWorkers := src.getInt("JOBS_WORKERS", "4")
+	writeLockEnabled := src.getBool("WRITE_LOCK_ENABLED", "false")
+	writeLockTTLSeconds := src.getInt("WRITE_LOCK_TTL_SECONDS", "30")
+	writeLockWaitMillis := src.getInt("WRITE_LOCK_WAIT_MS", "5000")
+	formatTimeoutSeconds := src.getInt("FORMAT_TIMEOUT_SECONDS", "10")
+	runTimeoutSeconds := src.getInt("RUNNER_TIMEOUT_SECONDS", "10")
+	runMemoryMB := src.getInt("RUNNER_MEMORY_MB", "256")
+	runMaxOutputKB := src.getInt("RUNNER_MAX_OUTPUT_KB", "64")
+	runMaxConcurrent := src.getInt("RUNNER_MAX_CONCURRENT", "4")
+	runMaxPerUser := src.getInt("RUNNER_MAX_PER_USER", "1")
+	linkCheck := src.getBool("HOOKS_LINK_CHECK", "false")
+	linkCheckTimeoutSeconds := src.getInt("HOOKS_LINK_CHECK_TIMEOUT_SECONDS", "10")
+	metricsEnabled := src.getBool("METRICS_ENABLED", "true")
+	shutdownTimeoutSeconds := src.getInt("SHUTDOWN_TIMEOUT_SECONDS", "30")
+	requestTimeoutSeconds := src.getInt("REQUEST_TIMEOUT_SECONDS", "30")
+	startupWaitSeconds := src.getInt("STARTUP_WAIT_SECONDS", "60")
+	startupMaxBackoffSeconds := src.getInt("STARTUP_MAX_BACKOFF_SECONDS", "10")
+	dbTimeoutSeconds := src.getInt("DB_TIMEOUT_SECONDS", "10")
+	storageTimeoutSeconds := src.getInt("STORAGE_TIMEOUT_SECONDS", "20")
+	tenancyEnabled := src.getBool("TENANCY_ENABLED", "false")
+	report5xx := src.getBool("ERROR_REPORT_5XX", "true")
+	rateLimitEnabled := src.getBool("RATE_LIMIT_ENABLED", "false")
+	rateLimitRequests := src.getInt("RATE_LIMIT_REQUESTS_PER_MINUTE", "600")
+	rateLimitRequestBurst := src.getInt("RATE_LIMIT_REQUEST_BURST", "100")
+	rateLimitAuth := src.getInt("RATE_LIMIT_AUTH_PER_MINUTE", "10")
+	rateLimitAuthBurst := src.getInt("RATE_LIMIT_AUTH_BURST", "5")
+	rateLimitWS := src.getInt("RATE_LIMIT_WS_MESSAGES_PER_MINUTE", "1200")
+	rateLimitWSBurst := src.getInt("RATE_LIMIT_WS_MESSAGE_BURST", "200")
+	auditQueueSize := src.getInt("AUDIT_EXPORT_QUEUE_SIZE", "10000")
+	auditBatchSize := src.getInt("AUDIT_EXPORT_BATCH_SIZE", "100")
+	auditFlushSeconds := src.getInt("AUDIT_EXPORT_FLUSH_INTERVAL_SECONDS", "5")
+	accessLogMaxSizeMB := src.getInt64("ACCESS_LOG_MAX_SIZE_MB", "100")
+	accessLogMaxBackups := src.getInt("ACCESS_LOG_MAX_BACKUPS", "7")
+	accessLogMaxAgeDays := src.getInt("ACCESS_LOG_MAX_AGE_DAYS", "0")
+	siteEnabled := src.getBool("SITE_ENABLED", "false")
+	siteCacheSeconds := src.getInt("SITE_CACHE_SECONDS", "300")
+	siteCacheStaleSeconds := src.getInt("SITE_CACHE_STALE_SECONDS", "3600")
+	pushTTLHours := src.getInt("WEBPUSH_TTL_HOURS", "24")
+	digestIntervalDays := src.getInt("DIGEST_INTERVAL_DAYS", "7")
+	commentMaxLinks := src.getInt("COMMENT_MAX_LINKS", "2")
+	commentRate := src.getInt("COMMENT_RATE_PER_HOUR", "30")
+	mentionRate := src.getInt("COMMENT_MENTIONS_PER_HOUR", "50")
+	dataExportRetentionHours := src.getInt("DATA_EXPORT_RETENTION_HOURS", "72")
 
 	cfg := &Config{
+		DevMode:  devMode,
+		SeedFile: src.get("SEED_FILE", ""),
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Host: getEnv("SERVER_HOST", "localhost"),
+			Port: src.get("SERVER_PORT", "8080"),
+			Host: src.get("SERVER_HOST", "localhost"),
+
+			TLSCertFile:      src.get("TLS_CERT_FILE", ""),
+			TLSKeyFile:       src.get("TLS_KEY_FILE", ""),
+			AutocertDomains:  splitList(src.get("TLS_AUTOCERT_DOMAINS", "")),
+			AutocertEmail:    src.get("TLS_AUTOCERT_EMAIL", ""),
+			AutocertCacheDir: src.get("TLS_AUTOCERT_CACHE_DIR", "autocert-cache"),
+			RedirectPort:     src.get("TLS_REDIRECT_PORT", ""),
+			TrustedProxies:   splitList(src.get("TRUSTED_PROXIES", "")),
+			RequestTimeout:   time.Duration(requestTimeoutSeconds) * time.Second,
+			ShutdownTimeout:  time.Duration(shutdownTimeoutSeconds) * time.Second,
+
+			StartupWait:       time.Duration(startupWaitSeconds) * time.Second,
+			StartupMaxBackoff: time.Duration(startupMaxBackoffSeconds) * time.Second,
+
+			MaintenanceMode:    src.getBool("MAINTENANCE_MODE", "false"),
+			MaintenanceMessage: src.get("MAINTENANCE_MESSAGE", ""),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "a_very_secret_key"),
+			Secret:     src.get("JWT_SECRET", "a_very_secret_key"),
 			Expiration: time.Duration(jwtExpMinutes) * time.Minute,
 		},
 		Database: DBConfig{
-			Type:                 getEnv("DB_TYPE", "mongodb"),
-			MongoURI:             getEnv("MONGO_URI", ""),
-			MongoDBName:          getEnv("MONGO_DB_NAME", ""),
-			DynamoRegion:         getEnv("AWS_REGION", ""),
-			DynamoTable:          getEnv("DYNAMO_TABLE_NAME", ""),
-			FirestoreProjectID:   getEnv("FIRESTORE_PROJECT_ID", ""),
-			FirestoreCredentials: getEnv("FIRESTORE_CREDENTIALS_FILE", ""),
+			Type:                 src.get("DB_TYPE", orDev("mongodb", "memory")),
+			MongoURI:             src.get("MONGO_URI", ""),
+			MongoDBName:          src.get("MONGO_DB_NAME", ""),
+			DynamoRegion:         src.get("AWS_REGION", ""),
+			DynamoTable:          src.get("DYNAMO_TABLE_NAME", ""),
+			FirestoreProjectID:   src.get("FIRESTORE_PROJECT_ID", ""),
+			FirestoreCredentials: src.get("FIRESTORE_CREDENTIALS_FILE", ""),
+			Timeout:              time.Duration(dbTimeoutSeconds) * time.Second,
 		},
 		Storage: StorageConfig{
-			Type:           getEnv("STORAGE_TYPE", "s3"),
-			S3Region:       getEnv("AWS_REGION", ""),
-			S3Bucket:       getEnv("S3_BUCKET_NAME", ""),
-			S3Endpoint:     getEnv("S3_ENDPOINT", ""),
-			S3AccessKey:    getEnv("AWS_ACCESS_KEY_ID", ""),
-			S3SecretKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			Type:           src.get("STORAGE_TYPE", orDev("s3", "memory")),
+			S3Region:       src.get("AWS_REGION", ""),
+			S3Bucket:       src.get("S3_BUCKET_NAME", ""),
+			S3Endpoint:     src.get("S3_ENDPOINT", ""),
+			S3AccessKey:    src.get("AWS_ACCESS_KEY_ID", ""),
+			S3SecretKey:    src.get("AWS_SECRET_ACCESS_KEY", ""),
 			S3UsePathStyle: s3UsePathStyle,
+			LocalDir:       src.get("LOCAL_STORAGE_DIR", "data/storage"),
+			Timeout:        time.Duration(storageTimeoutSeconds) * time.Second,
+			VerifyReads:    verifyReads,
 		},
 		Redis: RedisConfig{ // Added
 			Enabled:  redisEnabled,
-			Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
+			Addr:     src.get("REDIS_ADDR", "localhost:6379"),
+			Password: src.get("REDIS_PASSWORD", ""),
 			DB:       redisDB,
 		},
 		Snapshot: SnapshotConfig{ // Added
-			IntervalChanges: snapshotInterval,
+			IntervalChanges:     snapshotInterval,
+			RetainVersions:      retainVersions,
+			FullVersionInterval: fullVersionInterval,
+			CompactionInterval:  time.Duration(versionCompactionMinutes) * time.Minute,
+		},
+		Cache: CacheConfig{
+			UserTTL:        time.Duration(userCacheMinutes) * time.Minute,
+			ItemMetaTTL:    time.Duration(itemMetaCacheMinutes) * time.Minute,
+			ItemContentTTL: time.Duration(itemContentCacheMinutes) * time.Minute,
+			WarmItems:      cacheWarmItems,
+			WarmWindow:     time.Duration(cacheWarmWindowHours) * time.Hour,
+		},
+		Quota: QuotaConfig{
+			MaxBytesPerUser: quotaMB << 20,
+			DailyRequests:   quotaDailyRequests,
+			DailyWSMessages: quotaDailyWSMessages,
 		},
+		Trash: TrashConfig{
+			Retention:     time.Duration(trashRetentionDays) * 24 * time.Hour,
+			PurgeInterval: time.Duration(trashPurgeMinutes) * time.Minute,
+		},
+		History: HistoryConfig{
+			PatchRetention:     time.Duration(historyRetentionDays) * 24 * time.Hour,
+			CompactionInterval: time.Duration(historyCompactionMinutes) * time.Minute,
+		},
+		Journal: JournalConfig{
+			MaxVersions:        journalMaxVersions,
+			Retention:          time.Duration(journalRetentionDays) * 24 * time.Hour,
+			CompactionInterval: time.Duration(journalCompactionMinutes) * time.Minute,
+		},
+		Stats: StatsConfig{
+			FlushInterval: time.Duration(statsFlushSeconds) * time.Second,
+		},
+		Search: SearchConfig{
+			Enabled:         searchEnabled,
+			Type:            src.get("SEARCH_TYPE", "bleve"),
+			IndexPath:       src.get("SEARCH_INDEX_PATH", orDev("data/search.bleve", "")),
+			QueueSize:       searchQueueSize,
+			ElasticURLs:     splitList(src.get("SEARCH_ELASTIC_URLS", "")),
+			ElasticIndex:    src.get("SEARCH_ELASTIC_INDEX", "blog_system"),
+			ElasticUsername: src.get("SEARCH_ELASTIC_USERNAME", ""),
+			ElasticPassword: src.get("SEARCH_ELASTIC_PASSWORD", ""),
+			ElasticAPIKey:   src.get("SEARCH_ELASTIC_API_KEY", ""),
+		},
+		Jobs: JobsConfig{
+			Workers: jobWorkers,
+			Backend: src.get("JOBS_BACKEND", "memory"),
+		},
+		WriteLock: WriteLockConfig{
+			Enabled: writeLockEnabled,
+			TTL:     time.Duration(writeLockTTLSeconds) * time.Second,
+			Wait:    time.Duration(writeLockWaitMillis) * time.Millisecond,
+		},
+		Admin: AdminConfig{
+			UserIDs: splitList(src.get("ADMIN_USER_IDS", "")),
+		},
+		Format: FormatConfig{
+			Commands: splitCommands(src.get("FORMAT_COMMANDS", "")),
+			Timeout:  time.Duration(formatTimeoutSeconds) * time.Second,
+		},
+		Runner: RunnerConfig{
+			Type:           src.get("RUNNER_TYPE", ""),
+			Timeout:        time.Duration(runTimeoutSeconds) * time.Second,
+			MemoryMB:       runMemoryMB,
+			MaxOutputBytes: runMaxOutputKB << 10,
+			MaxConcurrent:  runMaxConcurrent,
+			MaxPerUser:     runMaxPerUser,
+			DockerBinary:   src.get("RUNNER_DOCKER_BINARY", "docker"),
+			PistonURL:      src.get("RUNNER_PISTON_URL", ""),
+		},
+		Hooks: HooksConfig{
+			LinkCheck:        linkCheck,
+			LinkCheckTimeout: time.Duration(linkCheckTimeoutSeconds) * time.Second,
+		},
+		Log: LogConfig{
+			Level:  strings.ToLower(src.get("LOG_LEVEL", "info")),
+			Format: strings.ToLower(src.get("LOG_FORMAT", "text")),
+
+			AccessFormat:     strings.ToLower(src.get("ACCESS_LOG_FORMAT", "")),
+			AccessFile:       src.get("ACCESS_LOG_FILE", ""),
+			AccessMaxSize:    accessLogMaxSizeMB << 20,
+			AccessMaxBackups: accessLogMaxBackups,
+			AccessMaxAge:     time.Duration(accessLogMaxAgeDays) * 24 * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:             rateLimitEnabled,
+			RequestsPerMinute:   rateLimitRequests,
+			RequestBurst:        rateLimitRequestBurst,
+			AuthPerMinute:       rateLimitAuth,
+			AuthBurst:           rateLimitAuthBurst,
+			WSMessagesPerMinute: rateLimitWS,
+			WSMessageBurst:      rateLimitWSBurst,
+		},
+		Metrics: MetricsConfig{
+			Enabled: metricsEnabled,
+			Token:   src.get("METRICS_TOKEN", ""),
+		},
+		ErrorReport: ErrorReportConfig{
+			SentryDSN:   src.get("ERROR_REPORT_SENTRY_DSN", ""),
+			WebhookURL:  src.get("ERROR_REPORT_WEBHOOK_URL", ""),
+			Environment: src.get("ERROR_REPORT_ENVIRONMENT", orDev("production", "development")),
+			Report5xx:   report5xx,
+		},
+		AuditExport: AuditExportConfig{
+			WebhookURL:    src.get("AUDIT_EXPORT_WEBHOOK_URL", ""),
+			WebhookToken:  src.get("AUDIT_EXPORT_WEBHOOK_TOKEN", ""),
+			WebhookEvents: splitList(src.get("AUDIT_EXPORT_WEBHOOK_EVENTS", "*")),
+			KafkaRESTURL:  src.get("AUDIT_EXPORT_KAFKA_REST_URL", ""),
+			KafkaTopic:    src.get("AUDIT_EXPORT_KAFKA_TOPIC", "blog-audit"),
+			KafkaEvents:   splitList(src.get("AUDIT_EXPORT_KAFKA_EVENTS", "*")),
+			S3Bucket:      src.get("AUDIT_EXPORT_S3_BUCKET", ""),
+			S3Prefix:      src.get("AUDIT_EXPORT_S3_PREFIX", "audit"),
+			S3Events:      splitList(src.get("AUDIT_EXPORT_S3_EVENTS", "*")),
+			QueueSize:     auditQueueSize,
+			BatchSize:     auditBatchSize,
+			FlushInterval: time.Duration(auditFlushSeconds) * time.Second,
+		},
+		Tenancy: TenancyConfig{
+			Enabled:    tenancyEnabled,
+			Tenants:    splitList(strings.ToLower(src.get("TENANTS", ""))),
+			Hosts:      splitPairs(strings.ToLower(src.get("TENANT_HOSTS", ""))),
+			BaseDomain: src.get("TENANT_BASE_DOMAIN", ""),
+			Default:    strings.ToLower(src.get("TENANT_DEFAULT", "")),
+		},
+		Site: SiteConfig{
+			Enabled:       siteEnabled,
+			UserID:        src.get("SITE_USER_ID", ""),
+			Title:         src.get("SITE_TITLE", ""),
+			BaseURL:       strings.TrimSuffix(src.get("SITE_BASE_URL", ""), "/"),
+			CacheTTL:      time.Duration(siteCacheSeconds) * time.Second,
+			CacheStale:    time.Duration(siteCacheStaleSeconds) * time.Second,
+			ThemesDir:     src.get("SITE_THEMES_DIR", ""),
+			CustomDomains: src.getBool("SITE_CUSTOM_DOMAINS", "false"),
+		},
+		Push: PushConfig{
+			VAPIDPrivateKey: src.get("WEBPUSH_VAPID_PRIVATE_KEY", ""),
+			VAPIDSubject:    src.get("WEBPUSH_VAPID_SUBJECT", ""),
+			TTL:             time.Duration(pushTTLHours) * time.Hour,
+		},
+		Mail: MailConfig{
+			SMTPAddr: src.get("MAIL_SMTP_ADDR", ""),
+			Username: src.get("MAIL_SMTP_USERNAME", ""),
+			Password: src.get("MAIL_SMTP_PASSWORD", ""),
+			From:     src.get("MAIL_FROM", ""),
+		},
+		Digest: DigestConfig{
+			IntervalDays: digestIntervalDays,
+		},
+		Comments: CommentsConfig{
+			Moderation:     src.get("COMMENT_MODERATION", "others"),
+			MaxLinks:       commentMaxLinks,
+			Rate:           commentRate,
+			MentionRate:    mentionRate,
+			SpamChecker:    src.get("SPAM_CHECKER", ""),
+			AkismetKey:     src.get("AKISMET_API_KEY", ""),
+			AkismetSiteURL: src.get("AKISMET_SITE_URL", ""),
+		},
+		DataExport: DataExportConfig{
+			Retention: time.Duration(dataExportRetentionHours) * time.Hour,
+		},
+	}
+
+	if err := src.err(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if (cfg.Server.TLSCertFile == "") != (cfg.Server.TLSKeyFile == "") {
+		return nil, errors.New("invalid configuration: TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.Server.TLSCertFile != "" && len(cfg.Server.AutocertDomains) > 0 {
+		return nil, errors.New("invalid configuration: set either TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	if cfg.Server.RedirectPort != "" && !cfg.Server.TLSEnabled() {
+		return nil, errors.New("invalid configuration: TLS_REDIRECT_PORT requires TLS")
+	}
+
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if _, err := ParseProxy(proxy); err != nil {
+			return nil, fmt.Errorf("invalid configuration: TRUSTED_PROXIES: %w", err)
+		}
+	}
+
+	if cfg.Server.StartupWait < 0 || cfg.Server.StartupMaxBackoff < time.Second {
+		return nil, errors.New("invalid configuration: STARTUP_WAIT_SECONDS must not be negative and STARTUP_MAX_BACKOFF_SECONDS must be at least 1")
+	}
+
+	switch cfg.Log.AccessFormat {
+	case "", "json", "combined", "off":
+	default:
+		return nil, fmt.Errorf("invalid configuration: unknown ACCESS_LOG_FORMAT %q (want json, combined or off)", cfg.Log.AccessFormat)
+	}
+	if cfg.Log.AccessFile != "" && (cfg.Log.AccessFormat == "" || cfg.Log.AccessFormat == "off") {
+		return nil, errors.New("invalid configuration: ACCESS_LOG_FILE requires ACCESS_LOG_FORMAT json or combined")
+	}
+
+	if cfg.Cache.WarmItems < 0 || (cfg.Cache.WarmItems > 0 && cfg.Cache.WarmWindow <= 0) {
+		return nil, errors.New("invalid configuration: CACHE_WARM_ITEMS must not be negative and CACHE_WARM_WINDOW_HOURS must be positive")
+	}
+
+	if cfg.Quota.DailyRequests < 0 || cfg.Quota.DailyWSMessages < 0 {
+		return nil, errors.New("invalid configuration: USER_DAILY_REQUEST_QUOTA and USER_DAILY_WS_MESSAGE_QUOTA must not be negative")
+	}
+
+	if cfg.Journal.MaxVersions < 0 || cfg.Journal.Retention < 0 {
+		return nil, errors.New("invalid configuration: JOURNAL_MAX_VERSIONS and JOURNAL_RETENTION_DAYS must not be negative")
+	}
+	if (cfg.Journal.MaxVersions > 0 || cfg.Journal.Retention > 0) && cfg.Journal.CompactionInterval < time.Minute {
+		return nil, errors.New("invalid configuration: JOURNAL_COMPACTION_INTERVAL_MINUTES must be at least 1")
+	}
+
+	// Checked even with rate limiting off: a reload can't switch it on, but it can't
+	// switch it off either, so the limits may still be in force
+	if rl := cfg.RateLimit; min(rl.RequestsPerMinute, rl.RequestBurst, rl.AuthPerMinute, rl.AuthBurst, rl.WSMessagesPerMinute, rl.WSMessageBurst) < 1 {
+		return nil, errors.New("invalid configuration: RATE_LIMIT_* rates and bursts must be positive")
+	}
+
+	if cfg.AuditExport.QueueSize < 1 || cfg.AuditExport.BatchSize < 1 || cfg.AuditExport.FlushInterval < time.Second {
+		return nil, errors.New("invalid configuration: AUDIT_EXPORT_QUEUE_SIZE and AUDIT_EXPORT_BATCH_SIZE must be positive and AUDIT_EXPORT_FLUSH_INTERVAL_SECONDS at least 1")
+	}
+
+	if cfg.Tenancy.Enabled && len(cfg.Tenancy.Tenants) == 0 {
+		return nil, errors.New("invalid configuration: TENANCY_ENABLED requires TENANTS")
+	}
+
+	if cfg.Site.Enabled && cfg.Site.UserID == "" {
+		return nil, errors.New("invalid configuration: SITE_ENABLED requires SITE_USER_ID")
+	}
+	if cfg.Site.CacheTTL < 0 {
+		return nil, errors.New("invalid configuration: SITE_CACHE_SECONDS must not be negative")
+	}
+
+	if cfg.Push.Enabled() && !strings.HasPrefix(cfg.Push.VAPIDSubject, "mailto:") && !strings.HasPrefix(cfg.Push.VAPIDSubject, "https://") {
+		return nil, errors.New("invalid configuration: WEBPUSH_VAPID_PRIVATE_KEY requires WEBPUSH_VAPID_SUBJECT, a mailto: or https: URL")
+	}
+	if cfg.Push.TTL < 0 {
+		return nil, errors.New("invalid configuration: WEBPUSH_TTL_HOURS must not be negative")
+	}
+
+	if cfg.Mail.Enabled() && cfg.Mail.From == "" {
+		return nil, errors.New("invalid configuration: MAIL_SMTP_ADDR requires MAIL_FROM")
+	}
+	if cfg.Digest.IntervalDays < 0 {
+		return nil, errors.New("invalid configuration: DIGEST_INTERVAL_DAYS must not be negative")
+	}
+
+	switch cfg.Comments.Moderation {
+	case "none", "others", "all":
+	default:
+		return nil, fmt.Errorf("invalid configuration: unknown COMMENT_MODERATION %q (want none, others or all)", cfg.Comments.Moderation)
+	}
+	if cfg.Comments.MaxLinks < 0 {
+		return nil, errors.New("invalid configuration: COMMENT_MAX_LINKS must not be negative")
+	}
+	if cfg.Comments.Rate < 0 || cfg.Comments.MentionRate < 0 {
+		return nil, errors.New("invalid configuration: COMMENT_RATE_PER_HOUR and COMMENT_MENTIONS_PER_HOUR must not be negative")
+	}
+	switch cfg.Comments.SpamChecker {
+	case "":
+	case "akismet":
+		if cfg.Comments.AkismetKey == "" || cfg.Comments.AkismetSiteURL == "" {
+			return nil, errors.New("invalid configuration: SPAM_CHECKER akismet requires AKISMET_API_KEY and AKISMET_SITE_URL")
+		}
+	default:
+		return nil, fmt.Errorf("invalid configuration: unknown SPAM_CHECKER %q (want akismet)", cfg.Comments.SpamChecker)
+	}
+	if cfg.DataExport.Retention <= 0 {
+		return nil, errors.New("invalid configuration: DATA_EXPORT_RETENTION_HOURS must be positive")
 	}
 
 	// Basic validation
-	if cfg.JWT.Secret == "a_very_secret_key" {
-		log.Println("WARNING: JWT_SECRET is set to the default insecure value.")
+	if cfg.JWT.Secret == "a_very_secret_key" && !cfg.DevMode {
+		slog.Warn("JWT_SECRET is set to the default insecure value")
 	}
 	if cfg.Storage.Type == "s3" && cfg.Storage.S3Bucket == "" {
-		log.Println("WARNING: STORAGE_TYPE is s3 but S3_BUCKET_NAME is not set.")
+		slog.Warn("STORAGE_TYPE is s3 but S3_BUCKET_NAME is not set")
 	}
 	if cfg.Redis.Enabled && cfg.Redis.Addr == "" {
-		log.Println("WARNING: REDIS_ENABLED is true but REDIS_ADDR is not set. Disabling Redis.")
+		slog.Warn("REDIS_ENABLED is true but REDIS_ADDR is not set, disabling Redis")
 		cfg.Redis.Enabled = false
 	}
 
 	return cfg, nil
 }
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// ParseProxy parses a TRUSTED_PROXIES entry, a CIDR or a single address.
+func ParseProxy(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// splitList parses a comma-separated value, ignoring blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitPairs parses comma-separated "key=value" pairs, e.g. "blog.acme.com=acme".
+func splitPairs(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range splitList(value) {
+		key, val, found := strings.Cut(pair, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if found && key != "" && val != "" {
+			pairs[key] = val
+		}
+	}
+	return pairs
+}
+
+// splitCommands parses "language=command line" pairs separated by semicolons, e.g.
+// "javascript=prettier --stdin-filepath {file};python=black -q -".
+func splitCommands(value string) map[string]string {
+	commands := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		language, command, found := strings.Cut(pair, "=")
+		language, command = strings.ToLower(strings.TrimSpace(language)), strings.TrimSpace(command)
+		if !found || language == "" || command == "" {
+			continue
+		}
+		commands[language] = command
 	}
-	return fallback
+	return commands
 }
@@ -0,0 +1,185 @@
+// internal/config/file.go
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kkuzar/blog_system/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// A config file is a YAML mapping of setting names to values. The names are those of
+// the environment variables (case-insensitive), e.g.
+//
+//	db_type: mongodb
+//	mongo_uri: mongodb://localhost:27017
+//	jwt_expiration_minutes: 1440
+//	admin_user_ids: [u1, u2] # Lists may be given as sequences
+//
+// Environment variables override the file. Unknown names and values of the wrong type
+// are errors, so typos don't silently fall back to defaults.
+//
+// Any value, in the environment or the file, may instead be a reference to a secret in a
+// secret store (see package secrets), e.g. JWT_SECRET=awssm://prod/blog#jwt_secret. It's
+// replaced by the secret when the config is loaded.
+
+// secretTimeout bounds the time spent fetching each secret.
+const secretTimeout = 30 * time.Second
+
+// source looks settings up in the environment, then the config file, and collects the
+// errors found on the way.
+type source struct {
+	path  string
+	file  map[string]string // By upper-case name
+	known map[string]bool   // Names looked up so far
+	errs  []error
+
+	secrets map[string]string // Resolved secrets by reference, so each is fetched once
+}
+
+func newSource(path string) (*source, error) {
+	src := &source{path: path, file: make(map[string]string), known: make(map[string]bool), secrets: make(map[string]string)}
+	if path == "" {
+		return src, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	for name, value := range values {
+		key := strings.ToUpper(name)
+		if _, dup := src.file[key]; dup {
+			return nil, fmt.Errorf("config file %s: %s is set more than once", path, key)
+		}
+		text, err := fileValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %w", path, key, err)
+		}
+		src.file[key] = text
+	}
+	return src, nil
+}
+
+// fileValue converts a YAML value to the text an environment variable would hold.
+func fileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int, bool, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			text, err := fileValue(item)
+			if err != nil || strings.Contains(text, ",") {
+				return "", errors.New("lists may only hold plain values without commas")
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// get returns the value of a setting, or fallback if it isn't set anywhere.
+func (s *source) get(key, fallback string) string {
+	s.known[key] = true
+	if value, exists := os.LookupEnv(key); exists {
+		return s.resolve(key, value)
+	}
+	if value, exists := s.file[key]; exists {
+		return s.resolve(key, value)
+	}
+	return fallback
+}
+
+// resolve returns the secret value refers to, or value itself if it isn't a reference.
+func (s *source) resolve(key, value string) string {
+	if !secrets.IsReference(value) {
+		return value
+	}
+	if secret, ok := s.secrets[value]; ok {
+		return secret
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	secret, err := secrets.Resolve(ctx, value)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", key, err))
+		return ""
+	}
+	s.secrets[value] = secret
+	return secret
+}
+
+// getInt returns an integer setting. An empty value means the default.
+func (s *source) getInt(key, fallback string) int {
+	value := s.get(key, fallback)
+	if value == "" {
+		value = fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		s.invalid(key, value, "an integer")
+	}
+	return n
+}
+
+func (s *source) getInt64(key, fallback string) int64 {
+	value := s.get(key, fallback)
+	if value == "" {
+		value = fallback
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		s.invalid(key, value, "an integer")
+	}
+	return n
+}
+
+// getBool returns a boolean setting. An empty value means the default.
+func (s *source) getBool(key, fallback string) bool {
+	value := s.get(key, fallback)
+	if value == "" {
+		value = fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.invalid(key, value, "true or false")
+	}
+	return b
+}
+
+func (s *source) invalid(key, value, want string) {
+	s.errs = append(s.errs, fmt.Errorf("%s: %q is not %s", key, value, want))
+}
+
+// err reports the invalid values and the settings in the config file that don't exist.
+// Call it after every setting has been looked up.
+func (s *source) err() error {
+	var unknown []string
+	for key := range s.file {
+		if !s.known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		s.errs = append(s.errs, fmt.Errorf("config file %s: unknown setting %s", s.path, key))
+	}
+	return errors.Join(s.errs...)
+}
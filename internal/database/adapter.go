@@ -3,42 +3,274 @@ package database
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"time"
 
+	"github.com/kkuzar/blog_system/internal/apperr"
 	"github.com/kkuzar/blog_system/internal/config"
 	"github.com/kkuzar/blog_system/internal/database/dynamodb"
 	"github.com/kkuzar/blog_system/internal/database/firestore"
+	"github.com/kkuzar/blog_system/internal/database/memory"
 	"github.com/kkuzar/blog_system/internal/database/mongodb"
 	"github.com/kkuzar/blog_system/internal/models"
 )
 
-var ErrNotFound = errors.New("item not found")
-var ErrDuplicateUser = errors.New("username already exists")
-var ErrDBConfig = errors.New("invalid database configuration")
+var ErrNotFound = apperr.New(apperr.NotFound, "item not found")
+var ErrDuplicateUser = apperr.New(apperr.Conflict, "username already exists")
+var ErrDuplicateSlug = apperr.New(apperr.Conflict, "slug already in use")
+var ErrDuplicateTag = apperr.New(apperr.Conflict, "tag name already in use")
+var ErrDuplicateDomain = apperr.New(apperr.Conflict, "domain already in use")
+var ErrDBConfig = apperr.New(apperr.Internal, "invalid database configuration")
+var ErrVersionMismatch = apperr.New(apperr.Conflict, "item version does not match")
+
+// TrashQuery selects soft-deleted items. An empty UserID matches all users and a
+// zero DeletedBefore matches any deletion time.
+type TrashQuery struct {
+	UserID        string
+	DeletedBefore time.Time
+	Limit         int
+}
 
 // DBAdapter defines the interface for database operations.
 type DBAdapter interface {
 	// User operations
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) error
+	AdjustUserStorage(ctx context.Context, userID string, delta int64) error    // Atomically adds delta to StorageBytes
+	SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error // ErrNotFound if the user is missing
+	SetUserSiteTheme(ctx context.Context, userID, theme string) error           // "" for the default; ErrNotFound if the user is missing
+	SetUserTimezone(ctx context.Context, userID, timezone string) error         // "" for UTC; ErrNotFound if the user is missing
+	SetUserEmail(ctx context.Context, userID, email string) error               // "" removes it; ErrNotFound if the user is missing
+	SetUserMuted(ctx context.Context, userID string, types []string) error      // Notification types turned off; ErrNotFound if the user is missing
+	ListUserIDs(ctx context.Context) ([]string, error)                          // Every user; for maintenance tools, not request paths
 
-	// Post operations (Metadata only)
+	// Post operations (Metadata only). A non-empty slug is unique among a user's posts,
+	// trashed ones included; writes that would duplicate one return ErrDuplicateSlug.
 	CreatePostMeta(ctx context.Context, post *models.Post) (string, error) // Returns new post ID
 	GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error)
-	ListPostMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.Post, error)
-	UpdatePostMeta(ctx context.Context, post *models.Post) error
-	DeletePostMeta(ctx context.Context, postID string) error
+	GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) // Trashed posts included
+	ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error)
+	UpdatePostMeta(ctx context.Context, post *models.Post) error                                                   // Content fields only; the slug changes via SetPostSlug
+	SetPostSlug(ctx context.Context, postID, slug string) error                                                    // Does not bump Version
+	DeletePostMeta(ctx context.Context, postID string) error                                                       // Also releases the slug
+	SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error // Does not bump Version
+	SetPostUnpublished(ctx context.Context, postID string) error                                                   // Clears PublishedVersion and PublishedAt; does not bump Version
+	SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error                                 // Does not bump Version
+	SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error              // Does not bump Version
+	SetPostCoverImage(ctx context.Context, postID, assetID string) error                                           // Empty assetID removes it; does not bump Version
+	SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error                                 // Does not bump Version
+	SetPostLanguage(ctx context.Context, postID, language, translationOf string) error                             // Does not bump Version
+	SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error                 // Nil scheduledAt unschedules; does not bump Version
+	SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error                             // Nil takenDownAt reinstates; does not bump Version
+	ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error)                        // userID's posts translating postID, trashed ones included
+	ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error)                          // Every user's posts scheduled at or before before, earliest first, trashed ones included
+
+	// Slug redirects, from a former slug of a user's post to the post. PutSlugRedirect
+	// replaces any redirect of the same slug; DeleteSlugRedirect is a no-op without one.
+	PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error
+	GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error)
+	ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) // Oldest first; for backups, not request paths
+	DeleteSlugRedirect(ctx context.Context, userID, slug string) error
+
+	// Custom domains of users' blogs, keyed by host. CreateDomain fails with
+	// ErrDuplicateDomain if the host is taken; DeleteDomain is a no-op without it.
+	// SetDomainVerified with a zero verifiedAt makes the domain unverified again.
+	CreateDomain(ctx context.Context, domain *models.Domain) error
+	GetDomain(ctx context.Context, host string) (*models.Domain, error)
+	ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error)  // Sorted by host
+	ListVerifiedDomains(ctx context.Context) ([]models.Domain, error)               // Every user's, sorted by host
+	SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error // ErrNotFound if the domain is missing
+	DeleteDomain(ctx context.Context, host string) error
+
+	// Web Push subscriptions of users' browsers, keyed by ID. PutPushSubscription replaces
+	// any subscription of the same ID; DeletePushSubscription is a no-op without it.
+	PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error
+	ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) // Oldest first
+	DeletePushSubscription(ctx context.Context, subscriptionID string) error
+
+	// Share links, keyed by link ID. A link works only while its record exists, so
+	// DeleteShareLink revokes it; it is a no-op without one.
+	CreateShareLink(ctx context.Context, link *models.ShareLink) error
+	GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error)
+	ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) // Oldest first
+	DeleteShareLink(ctx context.Context, linkID string) error
 
 	// CodeFile operations (Metadata only)
 	CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) // Returns new file ID
 	GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error)
-	ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.CodeFile, error)
-	UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error
+	ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error)
+	UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error               // Content fields only; names change via RenameCodeFile
+	RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error // Does not bump Version
 	DeleteCodeFileMeta(ctx context.Context, fileID string) error
 
+	// Ownership transfers. ResolveTransfer only moves a pending transfer and returns
+	// ErrNotFound otherwise, so an offer can't be both accepted and cancelled.
+	// ReopenTransfer moves an accepted transfer back to pending, undoing an acceptance
+	// that couldn't be carried out, and returns ErrNotFound otherwise.
+	CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) // Returns new transfer ID
+	GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error)
+	ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error)
+	ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) // Sent or received, any status, newest first; for data exports
+	ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error
+	ReopenTransfer(ctx context.Context, transferID string) error
+	SetPostOwner(ctx context.Context, postID, userID, s3Path string) error     // Also clears WorkspaceID; ErrDuplicateSlug if the new owner uses the slug
+	SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error // Also clears WorkspaceID and ProjectID
+
+	// Collaborator operations. Owners are implied by the item's UserID and not stored.
+	PutCollaborator(ctx context.Context, collab *models.Collaborator) error // Adds or updates the user's role
+	GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error)
+	ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error)
+	DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error
+
+	// Version tags. Names are unique per item; CreateVersionTag returns ErrDuplicateTag
+	// rather than moving an existing tag.
+	CreateVersionTag(ctx context.Context, tag *models.VersionTag) error
+	GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error)
+	ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error)
+	DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error
+
+	// Comments on items. ListComments returns the oldest first and ListCommentsByOwner,
+	// the comments on a user's items, the newest first; an empty status matches any.
+	// SetCommentStatus, SetCommentAnchor and DeleteComment return ErrNotFound if the
+	// comment is gone.
+	CreateComment(ctx context.Context, comment *models.Comment) (string, error) // Returns new comment ID
+	GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error)
+	ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error)
+	ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error)
+	ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) // Newest first; for data exports, not request paths
+	SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error
+	SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error
+	SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error // On ownership transfers
+	DeleteComment(ctx context.Context, itemID, itemType, commentID string) error
+	DeleteComments(ctx context.Context, itemID, itemType string) error
+
+	// Abuse reports. ListReports returns the newest first; an empty status matches any.
+	// ResolveReport only moves an open report and returns ErrNotFound otherwise.
+	CreateReport(ctx context.Context, report *models.Report) (string, error) // Returns new report ID
+	GetReport(ctx context.Context, reportID string) (*models.Report, error)
+	ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error)
+	ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error
+
+	// Content hook results, one per item and hook. SaveHookResult replaces the hook's
+	// previous result for the item.
+	SaveHookResult(ctx context.Context, result *models.HookResult) error
+	ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) // Sorted by hook name
+	DeleteHookResults(ctx context.Context, itemID, itemType string) error
+
+	// Bookmarks of posts, by reader
+	AddBookmark(ctx context.Context, bookmark *models.Bookmark) error                                     // No-op if already bookmarked
+	DeleteBookmark(ctx context.Context, userID, postID string) error                                      // ErrNotFound if not bookmarked
+	ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) // Newest first
+	CountPostBookmarks(ctx context.Context, postID string) (int64, error)
+	DeletePostBookmarks(ctx context.Context, postID string) error
+
+	// Workspace operations. An empty workspaceID means the user's default workspace,
+	// which holds every item without a WorkspaceID.
+	CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) // Returns new workspace ID
+	GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error)
+	ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error)
+	SetPostWorkspace(ctx context.Context, postID, workspaceID string) error
+	SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error
+	ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error)
+	ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error)
+
+	// Templates. An empty userID lists the system-wide templates. UpdateTemplate replaces
+	// the template's content fields; both it and DeleteTemplate return ErrNotFound if the
+	// template is gone.
+	CreateTemplate(ctx context.Context, template *models.Template) (string, error) // Returns new template ID
+	GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error)
+	ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error)
+	UpdateTemplate(ctx context.Context, template *models.Template) error
+	DeleteTemplate(ctx context.Context, templateID string) error
+
+	// Project operations. Code files belong to at most one project (CodeFile.ProjectID).
+	CreateProject(ctx context.Context, project *models.Project) (string, error) // Returns new project ID
+	GetProjectByID(ctx context.Context, projectID string) (*models.Project, error)
+	ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error)
+	SetCodeFileProject(ctx context.Context, fileID, projectID string) error // Empty projectID removes the file from its project
+	ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error)
+
+	// Assets (binary workspace files). UpdateAsset replaces the content fields, S3Path
+	// included, if asset.Version matches the stored version, which it then increments;
+	// it returns ErrVersionMismatch otherwise. Listings are sorted by path.
+	CreateAsset(ctx context.Context, asset *models.Asset) (string, error) // Returns new asset ID
+	GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error)
+	ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error)
+	ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error)
+	UpdateAsset(ctx context.Context, asset *models.Asset) error
+	DeleteAsset(ctx context.Context, assetID string) error
+
+	// Trash (soft delete). Items with DeletedAt set are excluded from the List*ByUser
+	// methods; a nil deletedAt restores the item.
+	SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error
+	SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error
+	ListTrashedPostMeta(ctx context.Context, q TrashQuery) ([]models.Post, error)
+	ListTrashedCodeFileMeta(ctx context.Context, q TrashQuery) ([]models.CodeFile, error)
+
+	// Archive. Items with ArchivedAt set are excluded from the List*ByUser and
+	// List*ByWorkspace methods unless includeArchived; a nil archivedAt unarchives.
+	SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error
+	SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error
+
+	// Retained bytes. RetainedBytes counts an item's retained versions and snapshots,
+	// which are charged to its owner along with Size; these atomically add delta to it.
+	AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error
+	AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error
+
+	// Placement of posts in their owner's listing (see order.go). Neither bumps Version.
+	SetPostPinned(ctx context.Context, postID string, pinned bool) error
+	SetPostRank(ctx context.Context, postID string, rank int) error // 0 removes the rank
+
+	// Item statistics (daily rollups keyed by UTC date, YYYY-MM-DD)
+	IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error            // Creates the day if needed
+	ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) // Inclusive, oldest first; missing days are omitted
+	DeleteItemStats(ctx context.Context, itemID, itemType string) error
+
+	// API usage of users (daily rollups keyed by UTC date, YYYY-MM-DD, and API key).
+	// ListUsage returns one entry per day and key.
+	IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error // Creates the day if needed
+	ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error)         // Inclusive, oldest first; missing days are omitted
+
+	// Write intents (outbox for content writes). ListWriteIntents returns the oldest
+	// first; DeleteWriteIntent ignores intents that are already gone.
+	CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) // Returns new intent ID
+	ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error)
+	DeleteWriteIntent(ctx context.Context, intentID string) error
+
+	// Change journal (the changes of each version, for reconstructing versions and
+	// catching clients up). AppendJournal replaces any entry for the same item and
+	// version; ListJournal returns entries after afterVersion, oldest first (limit 0 for
+	// all); DeleteJournal drops the entries before beforeVersion.
+	AppendJournal(ctx context.Context, entry *models.JournalEntry) error
+	ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error)
+	DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error
+
 	// History logging
-	LogAction(ctx context.Context, log *models.HistoryLog) (string, error) // Returns log ID
+	LogAction(ctx context.Context, log *models.HistoryLog) (string, error) // Returns log ID; a preset log.ID makes retries idempotent
 	GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error)
+	// GetActionHistoryUntil pages back through an item's history: entries at or before
+	// until, newest first. Entries written in the same instant may span pages, so callers
+	// pass the last timestamp they got and skip the entries they already have.
+	GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error)
+	// ListHistoryByUser pages back through the entries userID wrote, on any item, like
+	// GetActionHistoryUntil.
+	ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error)
+	ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) // Entries of every item from since on, newest first
+	// NextEventSeq allocates the next EventSeq of userID's item events, counting from 1.
+	NextEventSeq(ctx context.Context, userID string) (int64, error)
+	// ListHistoryEvents lists the entries logged as events of ownerID's items (see
+	// HistoryLog.OwnerID) with an EventSeq above afterSeq, in EventSeq order.
+	ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error)
+	GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error)
+	DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error // Entries that are already gone are ignored
+
+	// Backups. RestoreRecord writes a record read from a backup as it is, keeping the ID,
+	// version and timestamps the Create methods would assign anew, and replaces a record
+	// with the same ID. It takes a *models.User, *models.Post, *models.CodeFile,
+	// *models.OwnershipTransfer, *models.Workspace, *models.Template, *models.Project,
+	// *models.Asset, *models.Comment or *models.Report; other records restore through
+	// their usual methods, which keep what they're given.
+	RestoreRecord(ctx context.Context, record interface{}) error
 
 	// Cleanup
 	Close(ctx context.Context) error
@@ -49,26 +281,29 @@ func NewDBAdapter(ctx context.Context, cfg *config.DBConfig) (DBAdapter, error)
 	switch cfg.Type {
 	case "mongodb":
 		if cfg.MongoURI == "" || cfg.MongoDBName == "" {
-			return nil, errors.New("MongoDB selected but MONGO_URI or MONGO_DB_NAME is missing")
+			return nil, fmt.Errorf("%w: MongoDB selected but MONGO_URI or MONGO_DB_NAME is missing", ErrDBConfig)
 		}
 		return mongodb.NewMongoClient(ctx, cfg.MongoURI, cfg.MongoDBName)
 	case "dynamodb":
 		if cfg.DynamoRegion == "" || cfg.DynamoTable == "" {
-			return nil, errors.New("DynamoDB selected but AWS_REGION or DYNAMO_TABLE_NAME is missing")
+			return nil, fmt.Errorf("%w: DynamoDB selected but AWS_REGION or DYNAMO_TABLE_NAME is missing", ErrDBConfig)
 		}
 		return dynamodb.NewDynamoDBClient(ctx, cfg.DynamoRegion, cfg.DynamoTable)
 	case "firestore":
 		if cfg.FirestoreProjectID == "" {
 			// Credentials file path is optional if running in GCP environment with default credentials
-			return nil, errors.New("Firestore selected but FIRESTORE_PROJECT_ID is missing")
+			return nil, fmt.Errorf("%w: Firestore selected but FIRESTORE_PROJECT_ID is missing", ErrDBConfig)
 		}
 		return firestore.NewFirestoreClient(ctx, cfg.FirestoreProjectID, cfg.FirestoreCredentials)
+	case "memory":
+		// Data is lost on restart; for development (DEV_MODE) and tests
+		return memory.NewMemoryDB(), nil
 	default:
 		// Only error if a type is specified but not supported
 		if cfg.Type != "" {
-			return nil, errors.New("unsupported database type: " + cfg.Type)
+			return nil, fmt.Errorf("%w: unsupported database type %q", ErrDBConfig, cfg.Type)
 		}
 		// If no DB type is configured, it's an error for this app
-		return nil, errors.New("DB_TYPE must be configured (e.g., 'mongodb', 'dynamodb', 'firestore')")
+		return nil, fmt.Errorf("%w: DB_TYPE must be configured (e.g., 'mongodb', 'dynamodb', 'firestore', 'memory')", ErrDBConfig)
 	}
 }
@@ -7,7 +7,9 @@ import (
 	"github.com/kkuzar/blog_system/internal/database"
 	"github.com/kkuzar/blog_system/internal/models"
 	"github.com/kkuzar/blog_system/uitls/pointer" // Use pointer helper
-	"log"
+	"log/slog"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -30,22 +32,84 @@ const (
 	gsi1Name = "gsi1" // For listing items by user
 	gsi1PK   = "userId"
 	gsi1SK   = "createdAt" // Use createdAt for sorting within user items
+	gsi2Name = "gsi2"      // For listing code files by project (sparse: only files with a projectId)
+	gsi2PK   = "projectId"
+	gsi3Name = "gsi3" // For feeds across items by time (sparse: history items, by author or not, and scheduled posts)
+	gsi3PK   = "feed"
+	gsi3SK   = "timestamp"
 
 	// Define item type prefixes/values used in keys
 	userPrefix       = "USER#"
 	postPrefix       = "POST#"
 	codefilePrefix   = "CODEFILE#"
+	projectPrefix    = "PROJECT#"
+	workspacePrefix  = "WORKSPACE#"
+	collabPrefix     = "COLLAB#"   // Collaborators of an item: COLLAB#itemType#itemID
+	tagPrefix        = "TAG#"      // Version tags of an item: TAG#itemType#itemID
+	hookPrefix       = "HOOK#"     // Hook results of an item: HOOK#itemType#itemID
+	commentPrefix    = "COMMENT#"  // Comments on an item: COMMENT#itemType#itemID
+	bookmarkPrefix   = "BOOKMARK#" // Bookmarks of a post: BOOKMARK#postID
+	templatePrefix   = "TEMPLATE#"
+	assetPrefix      = "ASSET#"
+	transferPrefix   = "TRANSFER#"
+	reportPrefix     = "REPORT#"
+	slugPrefix       = "SLUG#"       // Slug reservations: SLUG#userID#slug
+	domainPrefix     = "DOMAIN#"     // Custom domains: DOMAIN#host
+	pushPrefix       = "PUSH#"       // Push subscriptions: PUSH#subscriptionID
+	sharePrefix      = "SHARE#"      // Share links: SHARE#linkID
+	statsPrefix      = "STATS#"      // Daily item stats: STATS#itemType#itemID
+	usagePrefix      = "USAGE#"      // Daily API usage of a user: USAGE#userID
+	intentPK         = "WRITEINTENT" // All write intents share one partition; there are only a few at a time
+	journalPrefix    = "JOURNAL#"    // Change journal of an item: JOURNAL#itemType#itemID
 	historyPrefix    = "HISTORY#"    // Prefix for history item PK
 	historyLogPrefix = "HISTORYLOG#" // Prefix for direct history log lookup PK
+	eventsPrefix     = "EVENTS#"     // Item events of a user, and its event counter: EVENTS#userID
 
 	// Define SK values for different item types
 	userTypeSK          = "USER"
 	postTypeSK          = "POST"
 	codefileTypeSK      = "CODEFILE"
-	historyTypeSKPrefix = "HISTORY#"   // SK for history items: HISTORY#timestamp
+	projectTypeSK       = "PROJECT"
+	workspaceTypeSK     = "WORKSPACE"
+	collabSKPrefix      = "USER#" // SK for collaborator items: USER#userID
+	tagSKPrefix         = "NAME#" // SK for version tags: NAME#name
+	hookSKPrefix        = "HOOK#" // SK for hook results: HOOK#hook
+	commentSKPrefix     = "ID#"   // SK for comments: ID#commentID
+	bookmarkSKPrefix    = "USER#" // SK for bookmarks: USER#userID
+	templateTypeSK      = "TEMPLATE"
+	assetTypeSK         = "ASSET"
+	systemTemplateOwner = "SYSTEM#" // GSI key of system-wide templates, which have no user
+	transferTypeSK      = "TRANSFER"
+	reportTypeSK        = "REPORT"
+	reportQueueOwner    = "REPORTS#" // GSI key of abuse reports, which are listed across users
+	domainTypeSK        = "DOMAIN"
+	pushTypeSK          = "PUSH"
+	shareTypeSK         = "SHARE"
+	slugTypeSK          = "SLUG"
+	redirectTypeSK      = "REDIRECT"   // Slug redirects share the partition of the slug's reservation
+	statsSKPrefix       = "DAY#"       // SK for daily item stats and API usage: DAY#YYYY-MM-DD
+	intentSKPrefix      = "INTENT#"    // SK for write intents: INTENT#intentID
+	journalSKPrefix     = "VERSION#"   // SK for journal entries: VERSION#<zero-padded version>
+	historyTypeSKPrefix = "HISTORY#"   // SK for history items: HISTORY#timestamp#logID
 	historyLogTypeSK    = "HISTORYLOG" // SK for direct history log lookup
+	historyFeed         = "HISTORY"    // GSI key of history log lookup items, which are listed across items
+	eventSKPrefix       = "SEQ#"       // SK for item events: SEQ#<zero-padded EventSeq>
+	eventCounterSK      = "COUNTER"    // SK of a user's last EventSeq
+	scheduledFeed       = "SCHEDULED"  // GSI key of scheduled posts, listed by when they're due
 
-	defaultLimit = 50
+	defaultLimit     = 50
+	maxWorkspaceScan = 1000 // Upper bound on workspaces returned per user
+	maxTransferScan  = 1000 // Upper bound on pending transfers returned per user
+	maxTemplateScan  = 1000 // Upper bound on templates returned per user (or system-wide)
+	maxAssetScan     = 1000 // Upper bound on assets read per user, to sort them by path
+	maxPlacedScan    = 1000 // Upper bound on pinned and ranked posts read per user
+	maxVariantScan   = 1000 // Upper bound on translations read per post
+	maxDomainScan    = 1000 // Upper bound on custom domains returned per user
+	maxPushScan      = 1000 // Upper bound on push subscriptions returned per user
+	maxShareScan     = 1000 // Upper bound on share links returned per user
+	maxProjectScan   = 1000 // Upper bound on projects read per user, to sort them by name
+	maxBatchWrite    = 25   // BatchWriteItem request limit
+	maxBatchRetries  = 5    // Attempts at writing a batch's unprocessed items
 )
 
 type DynamoDBClient struct {
@@ -73,7 +137,7 @@ func NewDynamoDBClient(ctx context.Context, region, tableName string) (*DynamoDB
 	// 	return nil, fmt.Errorf("failed to describe dynamodb table %s: %w", tableName, err)
 	// }
 
-	log.Printf("DynamoDB client initialized for table %s in region %s", tableName, region)
+	slog.InfoContext(ctx, "DynamoDB client initialized", "table", tableName, "region", region)
 
 	return &DynamoDBClient{
 		client:    client,
@@ -81,20 +145,73 @@ func NewDynamoDBClient(ctx context.Context, region, tableName string) (*DynamoDB
 	}, nil
 }
 
+// ForTenant returns a client for the tenant's table, named <table>-<tenantID>. The table
+// must be created like the main one beforehand.
+func (c *DynamoDBClient) ForTenant(ctx context.Context, tenantID string) (database.DBAdapter, error) {
+	return &DynamoDBClient{client: c.client, tableName: c.tableName + "-" + tenantID}, nil
+}
+
 // Close is a no-op for the DynamoDB client as the SDK manages connections.
 func (c *DynamoDBClient) Close(ctx context.Context) error {
-	log.Println("DynamoDB client Close() called (no-op)")
+	slog.InfoContext(ctx, "DynamoDB client Close called (no-op)")
 	return nil
 }
 
 // --- Key Generation Helpers ---
-func userPK(username string) string      { return userPrefix + username }
-func postPK(postID string) string        { return postPrefix + postID }
-func codefilePK(fileID string) string    { return codefilePrefix + fileID }
+func userPK(username string) string       { return userPrefix + username }
+func postPK(postID string) string         { return postPrefix + postID }
+func codefilePK(fileID string) string     { return codefilePrefix + fileID }
+func projectPK(projectID string) string   { return projectPrefix + projectID }
+func workspacePK(wsID string) string      { return workspacePrefix + wsID }
+func transferPK(transferID string) string { return transferPrefix + transferID }
+func reportPK(reportID string) string     { return reportPrefix + reportID }
+func templatePK(templateID string) string { return templatePrefix + templateID }
+func assetPK(assetID string) string       { return assetPrefix + assetID }
+func slugPK(userID, slug string) string   { return slugPrefix + userID + "#" + slug }
+func domainPK(host string) string         { return domainPrefix + host }
+func pushPK(subscriptionID string) string { return pushPrefix + subscriptionID }
+func sharePK(linkID string) string        { return sharePrefix + linkID }
+func collabPK(itemID, itemType string) string {
+	return collabPrefix + itemType + "#" + itemID
+}
+func tagPK(itemID, itemType string) string {
+	return tagPrefix + itemType + "#" + itemID
+}
+func hookPK(itemID, itemType string) string {
+	return hookPrefix + itemType + "#" + itemID
+}
+func commentPK(itemID, itemType string) string {
+	return commentPrefix + itemType + "#" + itemID
+}
+func bookmarkPK(postID string) string {
+	return bookmarkPrefix + postID
+}
+func statsPK(itemID, itemType string) string {
+	return statsPrefix + itemType + "#" + itemID
+}
+func usagePK(userID string) string {
+	return usagePrefix + userID
+}
+func journalPK(itemID, itemType string) string {
+	return journalPrefix + itemType + "#" + itemID
+}
+func journalSK(version int) string {
+	return fmt.Sprintf("%s%019d", journalSKPrefix, version) // Padded so keys sort by version
+}
 func historyItemPK(itemID string) string { return historyPrefix + itemID }   // PK for querying history of an item
 func historyLogPK(logID string) string   { return historyLogPrefix + logID } // PK for direct log lookup
-func historySK(timestamp time.Time) string {
-	return historyTypeSKPrefix + timestamp.UTC().Format(time.RFC3339Nano)
+func historySK(timestamp time.Time, logID string) string {
+	// Log ID suffix keeps entries written in the same instant (e.g. a batch of patches) distinct
+	return historyTypeSKPrefix + timestamp.UTC().Format(time.RFC3339Nano) + "#" + logID
+}
+func historyUserFeed(userID string) string {
+	return historyFeed + "#" + userID // GSI key of the history items a user wrote
+}
+func eventsPK(userID string) string {
+	return eventsPrefix + userID
+}
+func eventSK(seq int64) string {
+	return fmt.Sprintf("%s%019d", eventSKPrefix, seq) // Padded so keys sort by number
 }
 
 // --- User Methods ---
@@ -115,7 +232,7 @@ func (c *DynamoDBClient) GetUserByUsername(ctx context.Context, username string)
 
 	result, err := c.client.GetItem(ctx, input)
 	if err != nil {
-		log.Printf("DynamoDB error getting user %s: %v", username, err)
+		slog.ErrorContext(ctx, "DynamoDB error getting user", "username", username, "error", err)
 		return nil, err
 	}
 	if result.Item == nil {
@@ -124,7 +241,7 @@ func (c *DynamoDBClient) GetUserByUsername(ctx context.Context, username string)
 
 	var user models.User
 	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
-		log.Printf("DynamoDB error unmarshalling user %s: %v", username, err)
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling user", "username", username, "error", err)
 		return nil, err
 	}
 	user.ID = username // Set ID from username
@@ -159,12 +276,237 @@ func (c *DynamoDBClient) CreateUser(ctx context.Context, user *models.User) erro
 		if errors.As(err, &condCheckFailed) {
 			return database.ErrDuplicateUser
 		}
-		log.Printf("DynamoDB error creating user %s: %v", user.Username, err)
+		slog.ErrorContext(ctx, "DynamoDB error creating user", "username", user.Username, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for AdjustUserStorage: %w", err)
+	}
+
+	// ADD treats a missing attribute as 0, so existing users start counting from here
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Add(expression.Name("storageBytes"), expression.Value(delta))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error adjusting storage for user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for SetUserPasswordHash: %w", err)
+	}
+
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Set(expression.Name("passwordHash"), expression.Value(passwordHash))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting password of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for SetUserSiteTheme: %w", err)
+	}
+
+	update := expression.Set(expression.Name("siteTheme"), expression.Value(theme))
+	if theme == "" {
+		update = expression.Remove(expression.Name("siteTheme"))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting site theme of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for SetUserTimezone: %w", err)
+	}
+
+	update := expression.Set(expression.Name("timezone"), expression.Value(timezone))
+	if timezone == "" {
+		update = expression.Remove(expression.Name("timezone"))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting time zone of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetUserEmail(ctx context.Context, userID, email string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for SetUserEmail: %w", err)
+	}
+
+	update := expression.Set(expression.Name("email"), expression.Value(email))
+	if email == "" {
+		update = expression.Remove(expression.Name("email"))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting email address of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetUserMuted(ctx context.Context, userID string, muted []string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: userPK(userID), skName: userTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key for SetUserMuted: %w", err)
+	}
+
+	update := expression.Set(expression.Name("mutedNotifications"), expression.Value(muted))
+	if len(muted) == 0 {
+		update = expression.Remove(expression.Name("mutedNotifications"))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting muted notifications of user", "userID", userID, "error", err)
 		return err
 	}
 	return nil
 }
 
+func (c *DynamoDBClient) ListUserIDs(ctx context.Context) ([]string, error) {
+	filter := expression.Name(skName).Equal(expression.Value(userTypeSK))
+	proj := expression.NamesList(expression.Name(pkName))
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(proj).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scan expression: %w", err)
+	}
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName), FilterExpression: expr.Filter(), ProjectionExpression: expr.Projection(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+
+	var userIDs []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error scanning users", "error", err)
+			return nil, err
+		}
+		for _, item := range page.Items {
+			if pk, ok := item[pkName].(*types.AttributeValueMemberS); ok {
+				userIDs = append(userIDs, strings.TrimPrefix(pk.Value, userPrefix))
+			}
+		}
+	}
+	return userIDs, nil
+}
+
 // --- Post Methods ---
 
 func (c *DynamoDBClient) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
@@ -184,6 +526,24 @@ func (c *DynamoDBClient) CreatePostMeta(ctx context.Context, post *models.Post)
 	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: post.UserID}
 	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: post.CreatedAt.UTC().Format(time.RFC3339Nano)}
 
+	if post.Slug != "" {
+		// Write the post and claim its slug together so neither exists without the other
+		_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Put: &types.Put{TableName: aws.String(c.tableName), Item: itemMap}},
+				c.claimSlug(post.UserID, post.Slug, post.ID),
+			},
+		})
+		if err != nil {
+			if slugConflict(err, 1) {
+				return "", database.ErrDuplicateSlug
+			}
+			slog.ErrorContext(ctx, "DynamoDB error creating post meta", "postID", post.ID, "error", err)
+			return "", err
+		}
+		return post.ID, nil
+	}
+
 	input := &dynamodb.PutItemInput{
 		TableName: aws.String(c.tableName),
 		Item:      itemMap,
@@ -192,12 +552,47 @@ func (c *DynamoDBClient) CreatePostMeta(ctx context.Context, post *models.Post)
 
 	_, err = c.client.PutItem(ctx, input)
 	if err != nil {
-		log.Printf("DynamoDB error creating post meta %s: %v", post.ID, err)
+		slog.ErrorContext(ctx, "DynamoDB error creating post meta", "postID", post.ID, "error", err)
 		return "", err
 	}
 	return post.ID, nil
 }
 
+// claimSlug returns a transaction step that reserves slug among userID's posts for
+// postID. It fails with a conditional check if the slug is taken.
+func (c *DynamoDBClient) claimSlug(userID, slug, postID string) types.TransactWriteItem {
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName: aws.String(c.tableName),
+		Item: map[string]types.AttributeValue{
+			pkName:   &types.AttributeValueMemberS{Value: slugPK(userID, slug)},
+			skName:   &types.AttributeValueMemberS{Value: slugTypeSK},
+			"postId": &types.AttributeValueMemberS{Value: postID},
+		},
+		ConditionExpression: aws.String(fmt.Sprintf("attribute_not_exists(%s)", pkName)),
+	}}
+}
+
+// releaseSlug returns a transaction step that drops a slug reservation.
+func (c *DynamoDBClient) releaseSlug(userID, slug string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName: aws.String(c.tableName),
+		Key: map[string]types.AttributeValue{
+			pkName: &types.AttributeValueMemberS{Value: slugPK(userID, slug)},
+			skName: &types.AttributeValueMemberS{Value: slugTypeSK},
+		},
+	}}
+}
+
+// slugConflict reports whether a transaction was cancelled by a failed condition on
+// its step at index i.
+func slugConflict(err error, i int) bool {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) || i >= len(cancelled.CancellationReasons) {
+		return false
+	}
+	return aws.ToString(cancelled.CancellationReasons[i].Code) == "ConditionalCheckFailed"
+}
+
 func (c *DynamoDBClient) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
 	key, err := attributevalue.MarshalMap(map[string]string{
 		pkName: postPK(postID),
@@ -214,7 +609,7 @@ func (c *DynamoDBClient) GetPostMetaByID(ctx context.Context, postID string) (*m
 
 	result, err := c.client.GetItem(ctx, input)
 	if err != nil {
-		log.Printf("DynamoDB error getting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "DynamoDB error getting post meta", "postID", postID, "error", err)
 		return nil, err
 	}
 	if result.Item == nil {
@@ -223,80 +618,77 @@ func (c *DynamoDBClient) GetPostMetaByID(ctx context.Context, postID string) (*m
 
 	var post models.Post
 	if err := attributevalue.UnmarshalMap(result.Item, &post); err != nil {
-		log.Printf("DynamoDB error unmarshalling post %s: %v", postID, err)
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling post", "postID", postID, "error", err)
 		return nil, err
 	}
 	post.ID = postID // Set ID
 	return &post, nil
 }
 
-func (c *DynamoDBClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.Post, error) {
-	// Note: DynamoDB Query doesn't support offset directly.
-	// Pagination is handled via LastEvaluatedKey. Implementing offset requires
-	// potentially fetching and discarding items, which is inefficient.
-	// We'll implement limit and basic pagination, ignoring offset for simplicity here.
-	if offset > 0 {
-		log.Printf("WARN: DynamoDB ListPostMetaByUser does not efficiently support offset. Offset %d ignored.", offset)
+// GetPostMetaBySlug finds the post through its slug reservation.
+func (c *DynamoDBClient) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: slugPK(userID, slug), skName: slugTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting slug reservation", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	postID, ok := result.Item["postId"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	post, err := c.GetPostMetaByID(ctx, postID.Value)
+	if err != nil {
+		return nil, err
 	}
+	if post.UserID != userID || post.Slug != slug {
+		return nil, database.ErrNotFound // Changed since the read above
+	}
+	return post, nil
+}
+
+func (c *DynamoDBClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
 	if limit <= 0 {
 		limit = defaultLimit
 	}
 
-	keyCond := expression.Key(gsi1PK).Equal(expression.Value(userID))
-	// We need to filter SK to only get Posts, but GSI1SK is createdAt.
-	// We must add itemType to the GSI projection or filter after querying.
-	// Let's assume itemType IS projected onto the GSI or filter afterwards.
-	// For simplicity, let's filter afterwards.
-
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	// The GSI sorts by createdAt only, so placed posts are read separately and go first
+	placedFilter := expression.Name("pinned").Equal(expression.Value(true)).
+		Or(expression.Name("rank").GreaterThan(expression.Value(0)))
+	placed, err := c.queryPosts(ctx, userID, listFilter(includeArchived).And(placedFilter), maxPlacedScan, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query expression: %w", err)
+		return nil, err
+	}
+	database.SortPlacedPosts(placed)
+	posts, restLimit, restOffset := database.PlacedPage(placed, limit, offset)
+	if restLimit == 0 {
+		return posts, nil
 	}
 
-	input := &dynamodb.QueryInput{
-		TableName:                 aws.String(c.tableName),
-		IndexName:                 aws.String(gsi1Name),
-		KeyConditionExpression:    expr.KeyCondition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		Limit:                     pointer.To(int32(limit)),
-		ScanIndexForward:          pointer.To(false), // Sort by createdAt descending
+	rest, err := c.queryPosts(ctx, userID, listFilter(includeArchived).And(expression.Not(placedFilter)), restLimit, restOffset)
+	if err != nil {
+		return nil, err
 	}
+	return append(posts, rest...), nil
+}
 
+// queryPosts returns a page of a user's posts matching filter, newest first.
+func (c *DynamoDBClient) queryPosts(ctx context.Context, userID string, filter expression.ConditionBuilder, limit, offset int) ([]models.Post, error) {
+	items, err := c.queryUserItems(ctx, userID, postPrefix, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
 	var posts []models.Post
-	paginator := dynamodb.NewQueryPaginator(c.client, input)
-
-	// Iterate through pages until limit is reached or no more pages
-	itemsFetched := 0
-	for paginator.HasMorePages() && itemsFetched < limit {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			log.Printf("DynamoDB error querying posts for user %s: %v", userID, err)
-			return nil, err
-		}
-
-		var pagePosts []models.Post
-		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pagePosts); err != nil {
-			log.Printf("DynamoDB error unmarshalling posts page: %v", err)
-			return nil, err
-		}
-
-		for _, p := range pagePosts {
-			// Filter for actual posts (if itemType wasn't part of GSI key)
-			// This assumes the base item has an 'itemType' field or similar.
-			// Our model doesn't explicitly have it at the top level for Post/CodeFile.
-			// We rely on the SK of the base item. Let's assume UnmarshalListOfMaps works based on fields present.
-			// A better GSI design might include itemType in the GSI SK (e.g., POST#createdAt).
-			// For now, assume unmarshalling works.
-			p.ID = strings.TrimPrefix(p.ID, postPrefix) // Clean up ID if PK was unmarshalled into it
-			posts = append(posts, p)
-			itemsFetched++
-			if itemsFetched >= limit {
-				break
-			}
-		}
+	if err := attributevalue.UnmarshalListOfMaps(items, &posts); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling posts of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].ID = strings.TrimPrefix(posts[i].ID, postPrefix)
 	}
-
 	return posts, nil
 }
 
@@ -312,10 +704,25 @@ func (c *DynamoDBClient) UpdatePostMeta(ctx context.Context, post *models.Post)
 	// Use expression builder for clarity
 	cond := expression.Name("version").Equal(expression.Value(post.Version))
 	update := expression.Set(expression.Name("title"), expression.Value(post.Title)).
-		Set(expression.Name("slug"), expression.Value(post.Slug)).
 		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano))).
 		Set(expression.Name("s3Path"), expression.Value(post.S3Path)).
+		Set(expression.Name("size"), expression.Value(post.Size)).
+		Set(expression.Name("contentHash"), expression.Value(post.ContentHash)).
+		Set(expression.Name("wordCount"), expression.Value(post.WordCount)).
+		Set(expression.Name("readingTimeMinutes"), expression.Value(post.ReadingTimeMinutes)).
+		Set(expression.Name("draft"), expression.Value(post.Draft)).
 		Add(expression.Name("version"), expression.Value(1)) // Increment version
+	// Front-matter fields are omitted when unset, as on create
+	if post.Tags != nil {
+		update = update.Set(expression.Name("tags"), expression.Value(post.Tags))
+	} else {
+		update = update.Remove(expression.Name("tags"))
+	}
+	if post.Date != nil {
+		update = update.Set(expression.Name("date"), expression.Value(post.Date))
+	} else {
+		update = update.Remove(expression.Name("date"))
+	}
 
 	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
 	if err != nil {
@@ -343,7 +750,7 @@ func (c *DynamoDBClient) UpdatePostMeta(ctx context.Context, post *models.Post)
 			}
 			return database.ErrVersionMismatch // Assume version mismatch if item exists
 		}
-		log.Printf("DynamoDB error updating post meta %s: %v", post.ID, err)
+		slog.ErrorContext(ctx, "DynamoDB error updating post meta", "postID", post.ID, "error", err)
 		return err
 	}
 	return nil
@@ -363,171 +770,3200 @@ func (c *DynamoDBClient) DeletePostMeta(ctx context.Context, postID string) erro
 		Key:       key,
 		// Optional: Add ConditionExpression to ensure item exists before deleting
 		// ConditionExpression: aws.String(fmt.Sprintf("attribute_exists(%s)", pkName)),
+		ReturnValues: types.ReturnValueAllOld, // To find the slug reservation
 	}
 
-	_, err = c.client.DeleteItem(ctx, input)
+	result, err := c.client.DeleteItem(ctx, input)
 	if err != nil {
 		// Check if conditional check failed (if added) - might mean already deleted (not found)
 		// var condCheckFailed *types.ConditionalCheckFailedException
 		// if errors.As(err, &condCheckFailed) { return database.ErrNotFound }
-		log.Printf("DynamoDB error deleting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "DynamoDB error deleting post meta", "postID", postID, "error", err)
 		return err
 	}
+	var old models.Post
+	if err := attributevalue.UnmarshalMap(result.Attributes, &old); err == nil && old.Slug != "" {
+		release := c.releaseSlug(old.UserID, old.Slug).Delete
+		_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: release.TableName, Key: release.Key,
+			ConditionExpression:       aws.String("postId = :postId"), // Only our own reservation
+			ExpressionAttributeValues: map[string]types.AttributeValue{":postId": &types.AttributeValueMemberS{Value: postID}},
+		})
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &condCheckFailed) {
+			slog.WarnContext(ctx, "DynamoDB error releasing slug of deleted post", "slug", old.Slug, "postID", postID, "error", err)
+		}
+	}
 	// Note: DeleteItem doesn't error if the item doesn't exist unless a condition fails.
 	// If strict "not found" is needed, perform a GetItem first or use a condition.
 	return nil
 }
 
-// --- CodeFile Methods (Similar structure to Post methods) ---
-// Implement CreateCodeFileMeta, GetCodeFileMetaByID, ListCodeFileMetaByUser, UpdateCodeFileMeta, DeleteCodeFileMeta
-// using codefilePK, codefileTypeSK, and the GSI for listing. Remember OCC for Update.
-
-func (c *DynamoDBClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
-	file.ID = uuid.NewString()
-	file.CreatedAt = time.Now().UTC()
-	file.UpdatedAt = file.CreatedAt
-	file.Version = 1
-
-	itemMap, err := attributevalue.MarshalMap(file)
+func (c *DynamoDBClient) SetPostSlug(ctx context.Context, postID, slug string) error {
+	post, err := c.GetPostMetaByID(ctx, postID)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal codefile: %w", err)
+		return err
+	}
+	if post.Slug == slug {
+		return nil
+	}
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
 	}
 
-	itemMap[pkName] = &types.AttributeValueMemberS{Value: codefilePK(file.ID)}
-	itemMap[skName] = &types.AttributeValueMemberS{Value: codefileTypeSK}
-	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: file.UserID}
-	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: file.CreatedAt.UTC().Format(time.RFC3339Nano)}
+	// Only apply if neither the slug nor the owner changed since the read above
+	cond := expression.Name("slug").Equal(expression.Value(post.Slug)).
+		And(expression.Name(gsi1PK).Equal(expression.Value(post.UserID)))
+	update := expression.Set(expression.Name("slug"), expression.Value(slug)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano)))
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
 
-	input := &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap}
-	_, err = c.client.PutItem(ctx, input)
+	items := []types.TransactWriteItem{
+		c.claimSlug(post.UserID, slug, postID),
+		{Update: &types.Update{
+			TableName: aws.String(c.tableName), Key: key,
+			ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+			ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		}},
+	}
+	if post.Slug != "" {
+		items = append(items, c.releaseSlug(post.UserID, post.Slug))
+	}
+	_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
 	if err != nil {
-		log.Printf("DynamoDB error creating codefile meta %s: %v", file.ID, err)
-		return "", err
+		if slugConflict(err, 0) {
+			return database.ErrDuplicateSlug
+		}
+		if slugConflict(err, 1) {
+			return database.ErrVersionMismatch // Changed concurrently
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting slug of post", "postID", postID, "error", err)
+		return err
 	}
-	return file.ID, nil
+	return nil
 }
 
-func (c *DynamoDBClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
-	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+func (c *DynamoDBClient) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("publishedVersion"), expression.Value(version)).
+		Set(expression.Name("publishedAt"), expression.Value(publishedAt.UTC().Format(time.RFC3339Nano))).
+		Set(expression.Name("excerpt"), expression.Value(excerpt))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error publishing post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostUnpublished(ctx context.Context, postID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("publishedVersion")).
+		Remove(expression.Name("publishedAt"))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error unpublishing post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	return c.setPostField(ctx, postID, "pinned", pinned)
+}
+
+func (c *DynamoDBClient) SetPostRank(ctx context.Context, postID string, rank int) error {
+	return c.setPostField(ctx, postID, "rank", rank)
+}
+
+func (c *DynamoDBClient) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	return c.setPostField(ctx, postID, "coAuthors", coAuthors)
+}
+
+func (c *DynamoDBClient) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("language"), expression.Value(language)).
+		Set(expression.Name("translationOf"), expression.Value(translationOf))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting language of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("scheduledAt")).Remove(expression.Name("scheduledVersion")).
+		Remove(expression.Name(gsi3PK)).Remove(expression.Name(gsi3SK))
+	if scheduledAt != nil {
+		update = expression.Set(expression.Name("scheduledAt"), expression.Value(*scheduledAt)).
+			Set(expression.Name("scheduledVersion"), expression.Value(version)).
+			Set(expression.Name(gsi3PK), expression.Value(scheduledFeed)).
+			Set(expression.Name(gsi3SK), expression.Value(scheduledAt.UTC().Format(time.RFC3339Nano)))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting schedule of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("takenDownAt"))
+	if takenDownAt != nil {
+		update = expression.Set(expression.Name("takenDownAt"), expression.Value(*takenDownAt))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting takedown of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	keyCond := expression.Key(gsi3PK).Equal(expression.Value(scheduledFeed)).
+		And(expression.Key(gsi3SK).LessThanEqual(expression.Value(before.UTC().Format(time.RFC3339Nano))))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+	input := &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi3Name),
+		KeyConditionExpression: expr.KeyCondition(), ExpressionAttributeNames: expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(min(limit, math.MaxInt32)))
+	}
+	paginator := dynamodb.NewQueryPaginator(c.client, input)
+
+	var posts []models.Post
+	for paginator.HasMorePages() && (limit <= 0 || len(posts) < limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying due posts", "error", err)
+			return nil, err
+		}
+		var pagePosts []models.Post
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pagePosts); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling due posts", "error", err)
+			return nil, err
+		}
+		posts = append(posts, pagePosts...)
+	}
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+	for i := range posts {
+		posts[i].ID = strings.TrimPrefix(posts[i].ID, postPrefix)
+	}
+	return posts, nil
+}
+
+func (c *DynamoDBClient) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	filter := expression.Name("translationOf").Equal(expression.Value(postID))
+	posts, err := c.queryPosts(ctx, userID, filter, maxVariantScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.Before(posts[j].CreatedAt) })
+	return posts, nil
+}
+
+// --- Slug Redirect Methods ---
+
+func (c *DynamoDBClient) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	if redirect.CreatedAt.IsZero() {
+		redirect.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(redirect)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slug redirect: %w", err)
+	}
+	delete(itemMap, gsi1PK) // Keep redirects out of the user GSI; the key has the user
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: slugPK(redirect.UserID, redirect.Slug)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: redirectTypeSK}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error putting slug redirect", "userID", redirect.UserID, "slug", redirect.Slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: slugPK(userID, slug), skName: redirectTypeSK})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal key: %w", err)
 	}
-	input := &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key}
-	result, err := c.client.GetItem(ctx, input)
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
 	if err != nil {
-		log.Printf("DynamoDB error getting codefile meta %s: %v", fileID, err)
+		slog.ErrorContext(ctx, "DynamoDB error getting slug redirect", "userID", userID, "slug", slug, "error", err)
 		return nil, err
 	}
 	if result.Item == nil {
 		return nil, database.ErrNotFound
 	}
-	var file models.CodeFile
-	if err := attributevalue.UnmarshalMap(result.Item, &file); err != nil {
-		log.Printf("DynamoDB error unmarshalling codefile %s: %v", fileID, err)
+	var redirect models.SlugRedirect
+	if err := attributevalue.UnmarshalMap(result.Item, &redirect); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling slug redirect", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	redirect.UserID = userID
+	return &redirect, nil
+}
+
+// ListSlugRedirectsByUser scans the table: redirects are kept out of the user GSI.
+func (c *DynamoDBClient) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	filter := expression.Name(pkName).BeginsWith(slugPK(userID, "")).And(expression.Name(skName).Equal(expression.Value(redirectTypeSK)))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scan expression: %w", err)
+	}
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+
+	var redirects []models.SlugRedirect
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error scanning slug redirects", "userID", userID, "error", err)
+			return nil, err
+		}
+		var batch []models.SlugRedirect
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling slug redirects", "userID", userID, "error", err)
+			return nil, err
+		}
+		redirects = append(redirects, batch...)
+	}
+	for i := range redirects {
+		redirects[i].UserID = userID
+	}
+	sort.Slice(redirects, func(i, j int) bool { return redirects[i].CreatedAt.Before(redirects[j].CreatedAt) })
+	return redirects, nil
+}
+
+func (c *DynamoDBClient) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: slugPK(userID, slug), skName: redirectTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error deleting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Domain Methods ---
+// Domains are keyed by host, so a host can only be claimed once, and listed by user
+// through the user GSI.
+
+func (c *DynamoDBClient) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	if domain.CreatedAt.IsZero() {
+		domain.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(domain)
+	if err != nil {
+		return fmt.Errorf("failed to marshal domain: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: domainPK(domain.Host)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: domainTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: domain.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: domain.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.tableName), Item: itemMap,
+		ConditionExpression: aws.String(fmt.Sprintf("attribute_not_exists(%s)", pkName)),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrDuplicateDomain
+		}
+		slog.ErrorContext(ctx, "DynamoDB error creating domain", "host", domain.Host, "userID", domain.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: domainPK(host), skName: domainTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting domain", "host", host, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var domain models.Domain
+	if err := attributevalue.UnmarshalMap(result.Item, &domain); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling domain", "host", host, "error", err)
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *DynamoDBClient) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	items, err := c.queryUserItems(ctx, userID, domainPrefix, expression.AttributeExists(expression.Name(pkName)), maxDomainScan, 0)
+	if err != nil {
 		return nil, err
 	}
-	file.ID = fileID
-	return &file, nil
+	var domains []models.Domain
+	if err := attributevalue.UnmarshalListOfMaps(items, &domains); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling domains", "error", err)
+		return nil, err
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+// ListVerifiedDomains scans the table: it is for the periodic re-verification, not
+// request paths.
+func (c *DynamoDBClient) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	filter := expression.Name(skName).Equal(expression.Value(domainTypeSK)).
+		And(expression.AttributeExists(expression.Name("verifiedAt")))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scan expression: %w", err)
+	}
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+
+	var domains []models.Domain
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error scanning domains", "error", err)
+			return nil, err
+		}
+		var batch []models.Domain
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling domains", "error", err)
+			return nil, err
+		}
+		domains = append(domains, batch...)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (c *DynamoDBClient) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: domainPK(host), skName: domainTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	update := expression.Set(expression.Name("verifiedAt"), expression.Value(verifiedAt))
+	if verifiedAt.IsZero() {
+		update = expression.Remove(expression.Name("verifiedAt"))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error verifying domain", "host", host, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteDomain(ctx context.Context, host string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: domainPK(host), skName: domainTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error deleting domain", "host", host, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Push Subscription Methods ---
+// Push subscriptions are keyed by ID and listed by user through the user GSI.
+
+func (c *DynamoDBClient) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(sub)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push subscription: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: pushPK(sub.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: pushTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: sub.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: sub.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error saving push subscription", "subscriptionID", sub.ID, "userID", sub.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	items, err := c.queryUserItems(ctx, userID, pushPrefix, expression.AttributeExists(expression.Name(pkName)), maxPushScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	var subs []models.PushSubscription
+	if err := attributevalue.UnmarshalListOfMaps(items, &subs); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling push subscriptions", "error", err)
+		return nil, err
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (c *DynamoDBClient) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pushPK(subscriptionID), skName: pushTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error deleting push subscription", "subscriptionID", subscriptionID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Share Link Methods ---
+// Share links are keyed by link ID and listed by user through the user GSI.
+
+func (c *DynamoDBClient) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal share link: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: sharePK(link.LinkID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: shareTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: link.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: link.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating share link", "linkID", link.LinkID, "itemID", link.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: sharePK(linkID), skName: shareTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting share link", "linkID", linkID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var link models.ShareLink
+	if err := attributevalue.UnmarshalMap(result.Item, &link); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling share link", "linkID", linkID, "error", err)
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (c *DynamoDBClient) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	items, err := c.queryUserItems(ctx, userID, sharePrefix, expression.AttributeExists(expression.Name(pkName)), maxShareScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	var links []models.ShareLink
+	if err := attributevalue.UnmarshalListOfMaps(items, &links); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling share links", "error", err)
+		return nil, err
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links, nil
+}
+
+func (c *DynamoDBClient) DeleteShareLink(ctx context.Context, linkID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: sharePK(linkID), skName: shareTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error deleting share link", "linkID", linkID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// setPostField sets a single attribute of a post without bumping its version.
+func (c *DynamoDBClient) setPostField(ctx context.Context, postID, field string, value interface{}) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Set(expression.Name(field), expression.Value(value))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting field of post", "field", field, "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("excerpt"), expression.Value(excerpt)).
+		Set(expression.Name("excerptManual"), expression.Value(manual))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting excerpt of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("canonicalUrl"), expression.Value(canonicalURL)).
+		Set(expression.Name("metaDescription"), expression.Value(metaDescription)).
+		Set(expression.Name("noIndex"), expression.Value(noIndex))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting SEO metadata of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("coverImage"))
+	if assetID != "" {
+		update = expression.Set(expression.Name("coverImage"), expression.Value(assetID))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting cover image of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- CodeFile Methods (Similar structure to Post methods) ---
+// Implement CreateCodeFileMeta, GetCodeFileMetaByID, ListCodeFileMetaByUser, UpdateCodeFileMeta, DeleteCodeFileMeta
+// using codefilePK, codefileTypeSK, and the GSI for listing. Remember OCC for Update.
+
+func (c *DynamoDBClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	file.ID = uuid.NewString()
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.Version = 1
+
+	itemMap, err := attributevalue.MarshalMap(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal codefile: %w", err)
+	}
+
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: codefilePK(file.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: codefileTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: file.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: file.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	input := &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap}
+	_, err = c.client.PutItem(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating codefile meta", "fileID", file.ID, "error", err)
+		return "", err
+	}
+	return file.ID, nil
+}
+
+func (c *DynamoDBClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	input := &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key}
+	result, err := c.client.GetItem(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting codefile meta", "fileID", fileID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var file models.CodeFile
+	if err := attributevalue.UnmarshalMap(result.Item, &file); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling codefile", "fileID", fileID, "error", err)
+		return nil, err
+	}
+	file.ID = fileID
+	return &file, nil
+}
+
+func (c *DynamoDBClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	// The filter runs after each page is read, so pages are read until this one is full
+	items, err := c.queryUserItems(ctx, userID, codefilePrefix, listFilter(includeArchived), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var files []models.CodeFile
+	if err := attributevalue.UnmarshalListOfMaps(items, &files); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling codefiles of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	for i := range files {
+		files[i].ID = strings.TrimPrefix(files[i].ID, codefilePrefix)
+	}
+	return files, nil
+}
+
+func (c *DynamoDBClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(file.ID), skName: codefileTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	cond := expression.Name("version").Equal(expression.Value(file.Version))
+	update := expression.Set(expression.Name("language"), expression.Value(file.Language)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano))).
+		Set(expression.Name("s3Path"), expression.Value(file.S3Path)).
+		Set(expression.Name("size"), expression.Value(file.Size)).
+		Set(expression.Name("contentHash"), expression.Value(file.ContentHash)).
+		Add(expression.Name("version"), expression.Value(1))
+
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ReturnValues: types.ReturnValueNone,
+	}
+
+	_, err = c.client.UpdateItem(ctx, input)
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			_, getErr := c.GetCodeFileMetaByID(ctx, file.ID)
+			if errors.Is(getErr, database.ErrNotFound) {
+				return database.ErrNotFound
+			}
+			return database.ErrVersionMismatch
+		}
+		slog.ErrorContext(ctx, "DynamoDB error updating codefile meta", "fileID", file.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	input := &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key}
+	_, err = c.client.DeleteItem(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error deleting codefile meta", "fileID", fileID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("fileName"), expression.Value(fileName)).
+		Set(expression.Name("path"), expression.Value(path)).
+		Set(expression.Name("language"), expression.Value(language)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano)))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error renaming codefile", "fileID", fileID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Ownership Transfer Methods ---
+
+func (c *DynamoDBClient) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	transfer.ID = uuid.NewString()
+	transfer.CreatedAt = time.Now().UTC()
+
+	itemMap, err := attributevalue.MarshalMap(transfer)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal transfer: %w", err)
+	}
+
+	// Indexed under the recipient so their pending offers can be listed
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: transferPK(transfer.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: transferTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: transfer.ToUserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: transfer.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating transfer", "transferID", transfer.ID, "error", err)
+		return "", err
+	}
+	return transfer.ID, nil
+}
+
+func (c *DynamoDBClient) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: transferPK(transferID), skName: transferTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting transfer", "transferID", transferID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var transfer models.OwnershipTransfer
+	if err := attributevalue.UnmarshalMap(result.Item, &transfer); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling transfer", "transferID", transferID, "error", err)
+		return nil, err
+	}
+	transfer.ID = transferID
+	return &transfer, nil
+}
+
+func (c *DynamoDBClient) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	pending := expression.Name("status").Equal(expression.Value(models.TransferPending))
+	items, err := c.queryUserItems(ctx, toUserID, transferPrefix, pending, maxTransferScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	var transfers []models.OwnershipTransfer
+	if err := attributevalue.UnmarshalListOfMaps(items, &transfers); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling transfers", "error", err)
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// ListTransfersByUser scans the table: transfers are indexed by their recipient only.
+func (c *DynamoDBClient) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	filter := expression.Name(pkName).BeginsWith(transferPrefix).
+		And(expression.Name("fromUserId").Equal(expression.Value(userID)).Or(expression.Name("toUserId").Equal(expression.Value(userID))))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scan expression: %w", err)
+	}
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+
+	var transfers []models.OwnershipTransfer
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error scanning transfers of user", "userID", userID, "error", err)
+			return nil, err
+		}
+		var batch []models.OwnershipTransfer
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling transfers", "error", err)
+			return nil, err
+		}
+		transfers = append(transfers, batch...)
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt.After(transfers[j].CreatedAt) })
+	return transfers, nil
+}
+
+func (c *DynamoDBClient) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: transferPK(transferID), skName: transferTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("status"), expression.Value(status)).
+		Set(expression.Name("resolvedAt"), expression.Value(resolvedAt.UTC().Format(time.RFC3339Nano)))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.Name("status").Equal(expression.Value(models.TransferPending))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound // Missing or no longer pending
+		}
+		slog.ErrorContext(ctx, "DynamoDB error resolving transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ReopenTransfer(ctx context.Context, transferID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: transferPK(transferID), skName: transferTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("status"), expression.Value(models.TransferPending)).
+		Remove(expression.Name("resolvedAt"))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.Name("status").Equal(expression.Value(models.TransferAccepted))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound // Missing or not accepted
+		}
+		slog.ErrorContext(ctx, "DynamoDB error reopening transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// setOwner hands an item to userID. Workspace and project belong to the previous owner,
+// so the item lands in the new owner's default workspace outside any project. Changing
+// userId also moves the item to the new owner's partition of the user index.
+func (c *DynamoDBClient) setOwner(ctx context.Context, pk, sk, userID, s3Path string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pk, skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := ownerExpression(userID, s3Path, expression.AttributeExists(expression.Name(pkName)))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error transferring item", "key", pk, "toUserID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ownerExpression builds the update applied by setOwner, guarded by cond.
+func ownerExpression(userID, s3Path string, cond expression.ConditionBuilder) (expression.Expression, error) {
+	update := expression.Set(expression.Name(gsi1PK), expression.Value(userID)).
+		Set(expression.Name("s3Path"), expression.Value(s3Path)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano))).
+		Remove(expression.Name("workspaceId")).
+		Remove(expression.Name(gsi2PK))
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return expression.Expression{}, fmt.Errorf("failed to build update expression: %w", err)
+	}
+	return expr, nil
+}
+
+func (c *DynamoDBClient) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	post, err := c.GetPostMetaByID(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if post.Slug == "" {
+		return c.setOwner(ctx, postPK(postID), postTypeSK, userID, s3Path)
+	}
+
+	// The slug reservation moves to the new owner along with the post
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: postPK(postID), skName: postTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	cond := expression.Name(gsi1PK).Equal(expression.Value(post.UserID)).
+		And(expression.Name("slug").Equal(expression.Value(post.Slug)))
+	expr, err := ownerExpression(userID, s3Path, cond)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			c.claimSlug(userID, post.Slug, postID),
+			{Update: &types.Update{
+				TableName: aws.String(c.tableName), Key: key,
+				ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+				ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+			}},
+			c.releaseSlug(post.UserID, post.Slug),
+		},
+	})
+	if err != nil {
+		if slugConflict(err, 0) {
+			return database.ErrDuplicateSlug // The new owner has a post with this slug
+		}
+		if slugConflict(err, 1) {
+			return database.ErrNotFound // Changed owner or slug concurrently
+		}
+		slog.ErrorContext(ctx, "DynamoDB error transferring post to user", "postID", postID, "toUserID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	return c.setOwner(ctx, codefilePK(fileID), codefileTypeSK, userID, s3Path)
+}
+
+// --- Collaborator Methods ---
+
+func (c *DynamoDBClient) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	if collab.CreatedAt.IsZero() {
+		collab.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(collab)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collaborator: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: collabPK(collab.ItemID, collab.ItemType)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: collabSKPrefix + collab.UserID}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error saving collaborator", "userID", collab.UserID, "itemType", collab.ItemType, "itemID", collab.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: collabPK(itemID, itemType), skName: collabSKPrefix + userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var collab models.Collaborator
+	if err := attributevalue.UnmarshalMap(result.Item, &collab); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return &collab, nil
+}
+
+func (c *DynamoDBClient) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(collabPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var collabs []models.Collaborator
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying collaborators", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageCollabs []models.Collaborator
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageCollabs); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling collaborators page", "error", err)
+			return nil, err
+		}
+		collabs = append(collabs, pageCollabs...)
+	}
+	return collabs, nil
+}
+
+func (c *DynamoDBClient) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: collabPK(itemID, itemType), skName: collabSKPrefix + userID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Version Tag Methods ---
+
+func (c *DynamoDBClient) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(tag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal version tag: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: tagPK(tag.ItemID, tag.ItemType)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: tagSKPrefix + tag.Name}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.tableName), Item: itemMap,
+		ConditionExpression: aws.String(fmt.Sprintf("attribute_not_exists(%s)", pkName)), // Names are unique per item
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrDuplicateTag
+		}
+		slog.ErrorContext(ctx, "DynamoDB error creating tag", "tag", tag.Name, "itemType", tag.ItemType, "itemID", tag.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: tagPK(itemID, itemType), skName: tagSKPrefix + name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var tag models.VersionTag
+	if err := attributevalue.UnmarshalMap(result.Item, &tag); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (c *DynamoDBClient) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(tagPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var tags []models.VersionTag
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying tags", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageTags []models.VersionTag
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageTags); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling tags page", "error", err)
+			return nil, err
+		}
+		tags = append(tags, pageTags...)
+	}
+	// Sorted by name by the SK; match the other adapters (newest version first)
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Version > tags[j].Version })
+	return tags, nil
+}
+
+func (c *DynamoDBClient) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: tagPK(itemID, itemType), skName: tagSKPrefix + name})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Comment Methods ---
+// Comments share their item's partition and are sorted by time after reading. They are
+// keyed in the user GSI by the item's owner, for the moderation queue; the author is
+// stored as authorId.
+
+func (c *DynamoDBClient) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	comment.ID = uuid.NewString()
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(comment)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal comment: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: commentPK(comment.ItemID, comment.ItemType)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: commentSKPrefix + comment.ID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: comment.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating comment", "itemType", comment.ItemType, "itemID", comment.ItemID, "error", err)
+		return "", err
+	}
+	return comment.ID, nil
+}
+
+func (c *DynamoDBClient) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: commentPK(itemID, itemType), skName: commentSKPrefix + commentID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var comment models.Comment
+	if err := attributevalue.UnmarshalMap(result.Item, &comment); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling comment", "commentID", commentID, "error", err)
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// commentStatusFilter matches comments with status, or any comment if it is empty.
+func commentStatusFilter(status models.CommentStatus) expression.ConditionBuilder {
+	switch status {
+	case "":
+		return expression.AttributeExists(expression.Name(pkName))
+	case models.CommentApproved: // See models.CommentStatus.Is
+		return expression.Name("status").In(expression.Value(status), expression.Value("")).
+			Or(expression.AttributeNotExists(expression.Name("status")))
+	}
+	return expression.Name("status").Equal(expression.Value(status))
+}
+
+func (c *DynamoDBClient) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(commentPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(commentStatusFilter(status)).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var comments []models.Comment
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying comments", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageComments []models.Comment
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageComments); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling comments page", "error", err)
+			return nil, err
+		}
+		comments = append(comments, pageComments...)
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+	if offset >= len(comments) {
+		return nil, nil
+	}
+	comments = comments[offset:]
+	if limit > 0 && limit < len(comments) {
+		comments = comments[:limit]
+	}
+	return comments, nil
+}
+
+func (c *DynamoDBClient) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	items, err := c.queryUserItems(ctx, ownerUserID, commentPrefix, commentStatusFilter(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var comments []models.Comment
+	if err := attributevalue.UnmarshalListOfMaps(items, &comments); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling comments of owner", "error", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+// ListCommentsByAuthor scans the table: comments are indexed by their item's owner, not
+// their author.
+func (c *DynamoDBClient) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	filter := expression.Name(pkName).BeginsWith(commentPrefix).And(expression.Name("authorId").Equal(expression.Value(userID)))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build scan expression: %w", err)
+	}
+	paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+		TableName: aws.String(c.tableName), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+
+	var comments []models.Comment
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error scanning comments of author", "userID", userID, "error", err)
+			return nil, err
+		}
+		var batch []models.Comment
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &batch); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling comments of author", "error", err)
+			return nil, err
+		}
+		comments = append(comments, batch...)
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return comments, nil
+}
+
+func (c *DynamoDBClient) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: commentPK(itemID, itemType), skName: commentSKPrefix + commentID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Set(expression.Name("status"), expression.Value(status))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting comment status", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: commentPK(itemID, itemType), skName: commentSKPrefix + commentID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Set(expression.Name("anchor"), expression.Value(anchor))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting comment anchor", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(commentPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+	update, err := expression.NewBuilder().WithUpdate(expression.Set(expression.Name(gsi1PK), expression.Value(ownerUserID))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying comments", "itemType", itemType, "itemID", itemID, "error", err)
+			return err
+		}
+		for _, key := range page.Items {
+			_, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(c.tableName), Key: key, UpdateExpression: update.Update(),
+				ExpressionAttributeNames: update.Names(), ExpressionAttributeValues: update.Values(),
+			})
+			if err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error setting owner of comment", "itemType", itemType, "itemID", itemID, "error", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: commentPK(itemID, itemType), skName: commentSKPrefix + commentID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(commentPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying comments", "itemType", itemType, "itemID", itemID, "error", err)
+			return err
+		}
+		requests := make([]types.WriteRequest, len(page.Items))
+		for i, item := range page.Items {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}}
+		}
+		for start := 0; start < len(requests); start += maxBatchWrite {
+			if err := c.batchWrite(ctx, requests[start:min(start+maxBatchWrite, len(requests))]); err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error deleting comments", "itemType", itemType, "itemID", itemID, "error", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// --- Report Methods ---
+
+func (c *DynamoDBClient) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	report.ID = uuid.NewString()
+	report.CreatedAt = time.Now().UTC()
+
+	itemMap, err := attributevalue.MarshalMap(report)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	// All reports share one GSI key so the admin queue can be listed newest first
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: reportPK(report.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: reportTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: reportQueueOwner}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: report.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating report", "reportID", report.ID, "error", err)
+		return "", err
+	}
+	return report.ID, nil
+}
+
+func (c *DynamoDBClient) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: reportPK(reportID), skName: reportTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting report", "reportID", reportID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var report models.Report
+	if err := attributevalue.UnmarshalMap(result.Item, &report); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling report", "reportID", reportID, "error", err)
+		return nil, err
+	}
+	report.ID = reportID
+	return &report, nil
+}
+
+func (c *DynamoDBClient) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	filter := expression.AttributeExists(expression.Name(pkName))
+	if status != "" {
+		filter = expression.Name("status").Equal(expression.Value(status))
+	}
+	items, err := c.queryUserItems(ctx, reportQueueOwner, reportPrefix, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var reports []models.Report
+	if err := attributevalue.UnmarshalListOfMaps(items, &reports); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling reports", "error", err)
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (c *DynamoDBClient) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: reportPK(reportID), skName: reportTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Set(expression.Name("status"), expression.Value(status)).
+		Set(expression.Name("resolvedBy"), expression.Value(resolvedBy)).
+		Set(expression.Name("resolvedAt"), expression.Value(resolvedAt.UTC().Format(time.RFC3339Nano)))
+	if note != "" {
+		update = update.Set(expression.Name("note"), expression.Value(note))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.Name("status").Equal(expression.Value(models.ReportOpen))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound // Missing or already resolved
+		}
+		slog.ErrorContext(ctx, "DynamoDB error resolving report", "reportID", reportID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Hook Result Methods ---
+
+func (c *DynamoDBClient) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	itemMap, err := attributevalue.MarshalMap(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook result: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: hookPK(result.ItemID, result.ItemType)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: hookSKPrefix + result.Hook}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error saving hook result", "hook", result.Hook, "itemType", result.ItemType, "itemID", result.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(hookPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	// The SK sorts results by hook name
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var results []models.HookResult
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying hook results", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageResults []models.HookResult
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageResults); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling hook results page", "error", err)
+			return nil, err
+		}
+		results = append(results, pageResults...)
+	}
+	return results, nil
+}
+
+func (c *DynamoDBClient) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(hookPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying hook results", "itemType", itemType, "itemID", itemID, "error", err)
+			return err
+		}
+		requests := make([]types.WriteRequest, len(page.Items))
+		for i, item := range page.Items {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}}
+		}
+		for start := 0; start < len(requests); start += maxBatchWrite {
+			if err := c.batchWrite(ctx, requests[start:min(start+maxBatchWrite, len(requests))]); err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error deleting hook results", "itemType", itemType, "itemID", itemID, "error", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// --- Bookmark Methods ---
+// Bookmarks live in their post's partition for counting, and carry the reader's userId
+// and createdAt so the user GSI lists a reader's bookmarks newest first.
+
+func (c *DynamoDBClient) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	if bookmark.CreatedAt.IsZero() {
+		bookmark.CreatedAt = time.Now().UTC()
+	}
+	itemMap, err := attributevalue.MarshalMap(bookmark)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bookmark: %w", err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: bookmarkPK(bookmark.PostID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: bookmarkSKPrefix + bookmark.UserID}
+
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.tableName), Item: itemMap,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return nil // Already bookmarked
+		}
+		slog.ErrorContext(ctx, "DynamoDB error bookmarking post for user", "postID", bookmark.PostID, "userID", bookmark.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: bookmarkPK(postID), skName: bookmarkSKPrefix + userID})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting bookmark of post for user", "postID", postID, "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	items, err := c.queryUserItems(ctx, userID, bookmarkPrefix, expression.AttributeExists(expression.Name("postId")), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var bookmarks []models.Bookmark
+	if err := attributevalue.UnmarshalListOfMaps(items, &bookmarks); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling bookmarks of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+func (c *DynamoDBClient) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(bookmarkPK(postID)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		Select: types.SelectCount,
+	})
+	var count int64
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error counting bookmarks of post", "postID", postID, "error", err)
+			return 0, err
+		}
+		count += int64(page.Count)
+	}
+	return count, nil
+}
+
+func (c *DynamoDBClient) DeletePostBookmarks(ctx context.Context, postID string) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(bookmarkPK(postID)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying bookmarks of post", "postID", postID, "error", err)
+			return err
+		}
+		requests := make([]types.WriteRequest, len(page.Items))
+		for i, item := range page.Items {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}}
+		}
+		for start := 0; start < len(requests); start += maxBatchWrite {
+			if err := c.batchWrite(ctx, requests[start:min(start+maxBatchWrite, len(requests))]); err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error deleting bookmarks of post", "postID", postID, "error", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// --- Workspace Methods ---
+
+func (c *DynamoDBClient) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	workspace.ID = uuid.NewString()
+	workspace.CreatedAt = time.Now().UTC()
+	workspace.UpdatedAt = workspace.CreatedAt
+
+	itemMap, err := attributevalue.MarshalMap(workspace)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal workspace: %w", err)
+	}
+
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: workspacePK(workspace.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: workspaceTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: workspace.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: workspace.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating workspace", "workspaceID", workspace.ID, "error", err)
+		return "", err
+	}
+	return workspace.ID, nil
+}
+
+func (c *DynamoDBClient) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: workspacePK(workspaceID), skName: workspaceTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var workspace models.Workspace
+	if err := attributevalue.UnmarshalMap(result.Item, &workspace); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	workspace.ID = workspaceID
+	return &workspace, nil
+}
+
+// queryUserItems queries the user GSI for items whose PK starts with pkPrefix and that
+// match filter, skipping offset matches and returning at most limit (newest first).
+func (c *DynamoDBClient) queryUserItems(ctx context.Context, userID, pkPrefix string, filter expression.ConditionBuilder, limit, offset int) ([]map[string]types.AttributeValue, error) {
+	keyCond := expression.Key(gsi1PK).Equal(expression.Value(userID))
+	filter = expression.Name(pkName).BeginsWith(pkPrefix).And(filter)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi1Name),
+		KeyConditionExpression: expr.KeyCondition(), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward: pointer.To(false),
+	})
+	var items []map[string]types.AttributeValue
+	for paginator.HasMorePages() && len(items) < offset+limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying items for user", "keyPrefix", pkPrefix, "userID", userID, "error", err)
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+	if offset >= len(items) {
+		return nil, nil
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (c *DynamoDBClient) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	items, err := c.queryUserItems(ctx, userID, workspacePrefix, expression.AttributeExists(expression.Name(pkName)), maxWorkspaceScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []models.Workspace
+	if err := attributevalue.UnmarshalListOfMaps(items, &workspaces); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling workspaces", "error", err)
+		return nil, err
+	}
+	for i := range workspaces {
+		workspaces[i].ID = strings.TrimPrefix(workspaces[i].ID, workspacePrefix)
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces, nil
+}
+
+// setWorkspace moves an item into workspaceID, or back to the default workspace when empty.
+func (c *DynamoDBClient) setWorkspace(ctx context.Context, pk, sk, workspaceID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pk, skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("workspaceId"))
+	if workspaceID != "" {
+		update = expression.Set(expression.Name("workspaceId"), expression.Value(workspaceID))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error moving item to workspace", "key", pk, "workspaceID", workspaceID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	return c.setWorkspace(ctx, postPK(postID), postTypeSK, workspaceID)
+}
+
+func (c *DynamoDBClient) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	return c.setWorkspace(ctx, codefilePK(fileID), codefileTypeSK, workspaceID)
+}
+
+// listFilter matches non-trashed items, leaving out archived ones unless includeArchived.
+func listFilter(includeArchived bool) expression.ConditionBuilder {
+	filter := expression.AttributeNotExists(expression.Name("deletedAt"))
+	if !includeArchived {
+		filter = filter.And(expression.AttributeNotExists(expression.Name("archivedAt")))
+	}
+	return filter
+}
+
+// workspaceFilter matches listed items in workspaceID (empty: the default workspace).
+func workspaceFilter(workspaceID string, includeArchived bool) expression.ConditionBuilder {
+	if workspaceID == "" {
+		return listFilter(includeArchived).And(expression.AttributeNotExists(expression.Name("workspaceId")))
+	}
+	return listFilter(includeArchived).And(expression.Name("workspaceId").Equal(expression.Value(workspaceID)))
+}
+
+func (c *DynamoDBClient) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	items, err := c.queryUserItems(ctx, userID, postPrefix, workspaceFilter(workspaceID, includeArchived), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	if err := attributevalue.UnmarshalListOfMaps(items, &posts); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling posts in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].ID = strings.TrimPrefix(posts[i].ID, postPrefix)
+	}
+	return posts, nil
+}
+
+func (c *DynamoDBClient) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	items, err := c.queryUserItems(ctx, userID, codefilePrefix, workspaceFilter(workspaceID, includeArchived), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var files []models.CodeFile
+	if err := attributevalue.UnmarshalListOfMaps(items, &files); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling codefiles in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	for i := range files {
+		files[i].ID = strings.TrimPrefix(files[i].ID, codefilePrefix)
+	}
+	return files, nil
+}
+
+// --- Template Methods ---
+
+// templateOwnerKey is the user GSI key of templates owned by userID. GSI keys can't be
+// empty, so system-wide templates get a key no user ID can take.
+func templateOwnerKey(userID string) string {
+	if userID == "" {
+		return systemTemplateOwner
+	}
+	return userID
+}
+
+// unmarshalTemplate decodes a template item, undoing templateOwnerKey.
+func unmarshalTemplate(item map[string]types.AttributeValue, template *models.Template) error {
+	if err := attributevalue.UnmarshalMap(item, template); err != nil {
+		return err
+	}
+	if template.UserID == systemTemplateOwner {
+		template.UserID = ""
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	template.ID = uuid.NewString()
+	template.CreatedAt = time.Now().UTC()
+	template.UpdatedAt = template.CreatedAt
+
+	itemMap, err := attributevalue.MarshalMap(template)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal template: %w", err)
+	}
+
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: templatePK(template.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: templateTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: templateOwnerKey(template.UserID)}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: template.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating template", "templateID", template.ID, "error", err)
+		return "", err
+	}
+	return template.ID, nil
+}
+
+func (c *DynamoDBClient) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: templatePK(templateID), skName: templateTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting template", "templateID", templateID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var template models.Template
+	if err := unmarshalTemplate(result.Item, &template); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling template", "templateID", templateID, "error", err)
+		return nil, err
+	}
+	template.ID = templateID
+	return &template, nil
+}
+
+func (c *DynamoDBClient) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	items, err := c.queryUserItems(ctx, templateOwnerKey(userID), templatePrefix, expression.AttributeExists(expression.Name(pkName)), maxTemplateScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]models.Template, 0, len(items))
+	for _, item := range items {
+		var template models.Template
+		if err := unmarshalTemplate(item, &template); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling template in list", "error", err)
+			continue
+		}
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (c *DynamoDBClient) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: templatePK(template.ID), skName: templateTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	template.UpdatedAt = time.Now().UTC()
+	update := expression.Set(expression.Name("name"), expression.Value(template.Name)).
+		Set(expression.Name("content"), expression.Value(template.Content)).
+		Set(expression.Name("updatedAt"), expression.Value(template.UpdatedAt))
+	// Optional fields are omitted when empty, as on create
+	for name, value := range map[string]string{"title": template.Title, "fileName": template.FileName, "language": template.Language} {
+		if value == "" {
+			update = update.Remove(expression.Name(name))
+		} else {
+			update = update.Set(expression.Name(name), expression.Value(value))
+		}
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error updating template", "templateID", template.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteTemplate(ctx context.Context, templateID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: templatePK(templateID), skName: templateTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting template", "templateID", templateID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Project Methods ---
+
+func (c *DynamoDBClient) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	project.ID = uuid.NewString()
+	project.CreatedAt = time.Now().UTC()
+	project.UpdatedAt = project.CreatedAt
+
+	itemMap, err := attributevalue.MarshalMap(project)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal project: %w", err)
+	}
+
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: projectPK(project.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: projectTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: project.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: project.CreatedAt.UTC().Format(time.RFC3339Nano)}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating project", "projectID", project.ID, "error", err)
+		return "", err
+	}
+	return project.ID, nil
+}
+
+func (c *DynamoDBClient) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: projectPK(projectID), skName: projectTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var project models.Project
+	if err := attributevalue.UnmarshalMap(result.Item, &project); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	project.ID = projectID
+	return &project, nil
+}
+
+func (c *DynamoDBClient) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	// The GSI sorts by createdAt; projects are listed by name like on the other backends
+	items, err := c.queryUserItems(ctx, userID, projectPrefix, expression.AttributeExists(expression.Name(pkName)), maxProjectScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]models.Project, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &projects); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling projects for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	for i := range projects {
+		projects[i].ID = strings.TrimPrefix(projects[i].ID, projectPrefix)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	if offset >= len(projects) {
+		return nil, nil
+	}
+	projects = projects[offset:]
+	if len(projects) > limit {
+		projects = projects[:limit]
+	}
+	return projects, nil
+}
+
+func (c *DynamoDBClient) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name(gsi2PK)) // Leaves the sparse project index
+	if projectID != "" {
+		update = expression.Set(expression.Name(gsi2PK), expression.Value(projectID))
+	}
+	update = update.Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano)))
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error moving codefile to project", "fileID", fileID, "projectID", projectID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	keyCond := expression.Key(gsi2PK).Equal(expression.Value(projectID))
+	isCodeFile := expression.Name(pkName).BeginsWith(codefilePrefix) // Assets share the project index
+	notTrashed := expression.AttributeNotExists(expression.Name("deletedAt"))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(isCodeFile.And(notTrashed)).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi2Name),
+		KeyConditionExpression: expr.KeyCondition(), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var files []models.CodeFile
+	for paginator.HasMorePages() && len(files) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying codefiles for project", "projectID", projectID, "error", err)
+			return nil, err
+		}
+		var pageFiles []models.CodeFile
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageFiles); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling codefiles page", "error", err)
+			return nil, err
+		}
+		for _, f := range pageFiles {
+			f.ID = strings.TrimPrefix(f.ID, codefilePrefix)
+			files = append(files, f)
+		}
+	}
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+// --- Asset Methods ---
+
+// Assets are indexed by owner (GSI1) and, when in a project, by project (GSI2, shared
+// with code files).
+
+func (c *DynamoDBClient) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	asset.ID = uuid.NewString()
+	asset.CreatedAt = time.Now().UTC()
+	asset.UpdatedAt = asset.CreatedAt
+
+	itemMap, err := attributevalue.MarshalMap(asset)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal asset: %w", err)
+	}
+
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: assetPK(asset.ID)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: assetTypeSK}
+	itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: asset.UserID}
+	itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: asset.CreatedAt.UTC().Format(time.RFC3339Nano)}
+	if asset.ProjectID != "" {
+		itemMap[gsi2PK] = &types.AttributeValueMemberS{Value: asset.ProjectID}
+	}
+
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error creating asset", "assetID", asset.ID, "error", err)
+		return "", err
+	}
+	return asset.ID, nil
+}
+
+func (c *DynamoDBClient) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: assetPK(assetID), skName: assetTypeSK})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	result, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String(c.tableName), Key: key})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error getting asset", "assetID", assetID, "error", err)
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, database.ErrNotFound
+	}
+	var asset models.Asset
+	if err := attributevalue.UnmarshalMap(result.Item, &asset); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling asset", "assetID", assetID, "error", err)
+		return nil, err
+	}
+	asset.ID = assetID
+	return &asset, nil
+}
+
+func (c *DynamoDBClient) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	items, err := c.queryUserItems(ctx, userID, assetPrefix, expression.AttributeExists(expression.Name(pkName)), maxAssetScan, 0)
+	if err != nil {
+		return nil, err
+	}
+	assets := make([]models.Asset, 0, len(items))
+	if err := attributevalue.UnmarshalListOfMaps(items, &assets); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling assets for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+	if offset >= len(assets) {
+		return nil, nil
+	}
+	assets = assets[offset:]
+	if len(assets) > limit {
+		assets = assets[:limit]
+	}
+	return assets, nil
+}
+
+func (c *DynamoDBClient) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	keyCond := expression.Key(gsi2PK).Equal(expression.Value(projectID))
+	isAsset := expression.Name(pkName).BeginsWith(assetPrefix)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(isAsset).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi2Name),
+		KeyConditionExpression: expr.KeyCondition(), FilterExpression: expr.Filter(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var assets []models.Asset
+	for paginator.HasMorePages() && len(assets) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying assets for project", "projectID", projectID, "error", err)
+			return nil, err
+		}
+		var pageAssets []models.Asset
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageAssets); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling assets page", "error", err)
+			return nil, err
+		}
+		assets = append(assets, pageAssets...)
+	}
+	if len(assets) > limit {
+		assets = assets[:limit]
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+	return assets, nil
+}
+
+func (c *DynamoDBClient) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: assetPK(asset.ID), skName: assetTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	cond := expression.Name("version").Equal(expression.Value(asset.Version))
+	update := expression.Set(expression.Name("contentType"), expression.Value(asset.ContentType)).
+		Set(expression.Name("s3Path"), expression.Value(asset.S3Path)).
+		Set(expression.Name("size"), expression.Value(asset.Size)).
+		Set(expression.Name("contentHash"), expression.Value(asset.ContentHash)).
+		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano))).
+		Add(expression.Name("version"), expression.Value(1))
+	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			_, getErr := c.GetAssetByID(ctx, asset.ID)
+			if errors.Is(getErr, database.ErrNotFound) {
+				return database.ErrNotFound
+			}
+			return database.ErrVersionMismatch
+		}
+		slog.ErrorContext(ctx, "DynamoDB error updating asset", "assetID", asset.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) DeleteAsset(ctx context.Context, assetID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: assetPK(assetID), skName: assetTypeSK})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name(pkName))).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build condition expression: %w", err)
+	}
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), ExpressionAttributeNames: expr.Names(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error deleting asset", "assetID", assetID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Trash Methods ---
+
+func (c *DynamoDBClient) setDeletedAt(ctx context.Context, pk, sk string, deletedAt *time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pk, skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("deletedAt")) // Restore
+	if deletedAt != nil {
+		update = expression.Set(expression.Name("deletedAt"), expression.Value(deletedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting deletedAt", "key", pk, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, postPK(postID), postTypeSK, deletedAt)
+}
+
+func (c *DynamoDBClient) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, codefilePK(fileID), codefileTypeSK, deletedAt)
+}
+
+func (c *DynamoDBClient) setArchivedAt(ctx context.Context, pk, sk string, archivedAt *time.Time) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pk, skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	update := expression.Remove(expression.Name("archivedAt")) // Unarchive
+	if archivedAt != nil {
+		update = expression.Set(expression.Name("archivedAt"), expression.Value(archivedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(update).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error setting archivedAt", "key", pk, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, postPK(postID), postTypeSK, archivedAt)
+}
+
+func (c *DynamoDBClient) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, codefilePK(fileID), codefileTypeSK, archivedAt)
+}
+
+func (c *DynamoDBClient) adjustRetainedBytes(ctx context.Context, pk, sk string, delta int64) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: pk, skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+
+	// ADD treats a missing attribute as 0, so items written before this count from here
+	expr, err := expression.NewBuilder().
+		WithCondition(expression.AttributeExists(expression.Name(pkName))).
+		WithUpdate(expression.Add(expression.Name("retainedBytes"), expression.Value(delta))).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key,
+		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		var condCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &condCheckFailed) {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "DynamoDB error adjusting retained bytes", "key", pk, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, postPK(postID), postTypeSK, delta)
+}
+
+func (c *DynamoDBClient) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, codefilePK(fileID), codefileTypeSK, delta)
+}
+
+// queryTrash returns raw trashed items whose PK starts with pkPrefix. With a UserID it
+// queries the user GSI; without one (e.g. the retention purge) it has to scan the table.
+func (c *DynamoDBClient) queryTrash(ctx context.Context, q database.TrashQuery, pkPrefix string) ([]map[string]types.AttributeValue, error) {
+	filter := expression.Name(pkName).BeginsWith(pkPrefix).
+		And(expression.AttributeExists(expression.Name("deletedAt")))
+	if !q.DeletedBefore.IsZero() {
+		filter = filter.And(expression.Name("deletedAt").LessThan(expression.Value(q.DeletedBefore.UTC().Format(time.RFC3339Nano))))
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	var items []map[string]types.AttributeValue
+	if q.UserID != "" {
+		keyCond := expression.Key(gsi1PK).Equal(expression.Value(q.UserID))
+		expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filter).Build()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build query expression: %w", err)
+		}
+		paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+			TableName: aws.String(c.tableName), IndexName: aws.String(gsi1Name),
+			KeyConditionExpression: expr.KeyCondition(), FilterExpression: expr.Filter(),
+			ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		})
+		for paginator.HasMorePages() && len(items) < limit {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error querying trash for user", "userID", q.UserID, "error", err)
+				return nil, err
+			}
+			items = append(items, page.Items...)
+		}
+	} else {
+		expr, err := expression.NewBuilder().WithFilter(filter).Build()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build scan expression: %w", err)
+		}
+		paginator := dynamodb.NewScanPaginator(c.client, &dynamodb.ScanInput{
+			TableName: aws.String(c.tableName), FilterExpression: expr.Filter(),
+			ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		})
+		for paginator.HasMorePages() && len(items) < limit {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error scanning trash", "error", err)
+				return nil, err
+			}
+			items = append(items, page.Items...)
+		}
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (c *DynamoDBClient) ListTrashedPostMeta(ctx context.Context, q database.TrashQuery) ([]models.Post, error) {
+	items, err := c.queryTrash(ctx, q, postPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	if err := attributevalue.UnmarshalListOfMaps(items, &posts); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling trashed posts", "error", err)
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].ID = strings.TrimPrefix(posts[i].ID, postPrefix)
+	}
+	return posts, nil
+}
+
+func (c *DynamoDBClient) ListTrashedCodeFileMeta(ctx context.Context, q database.TrashQuery) ([]models.CodeFile, error) {
+	items, err := c.queryTrash(ctx, q, codefilePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var files []models.CodeFile
+	if err := attributevalue.UnmarshalListOfMaps(items, &files); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling trashed codefiles", "error", err)
+		return nil, err
+	}
+	for i := range files {
+		files[i].ID = strings.TrimPrefix(files[i].ID, codefilePrefix)
+	}
+	return files, nil
+}
+
+// --- Item Stats Methods ---
+
+func (c *DynamoDBClient) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: statsPK(itemID, itemType), skName: statsSKPrefix + day})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	update := expression.Add(expression.Name("views"), expression.Value(views)).
+		Add(expression.Name("edits"), expression.Value(edits)).
+		Set(expression.Name("day"), expression.Value(day))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key, UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error incrementing stats", "itemType", itemType, "itemID", itemID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(statsPK(itemID, itemType))).
+		And(expression.Key(skName).Between(expression.Value(statsSKPrefix+fromDay), expression.Value(statsSKPrefix+toDay)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var days []models.ItemStatsDay
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying stats", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageDays []models.ItemStatsDay
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageDays); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling stats page", "error", err)
+			return nil, err
+		}
+		days = append(days, pageDays...)
+	}
+	return days, nil
+}
+
+func (c *DynamoDBClient) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(statsPK(itemID, itemType)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying stats", "itemType", itemType, "itemID", itemID, "error", err)
+			return err
+		}
+		requests := make([]types.WriteRequest, len(page.Items))
+		for i, item := range page.Items {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}}
+		}
+		for start := 0; start < len(requests); start += maxBatchWrite {
+			if err := c.batchWrite(ctx, requests[start:min(start+maxBatchWrite, len(requests))]); err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error deleting stats", "itemType", itemType, "itemID", itemID, "error", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// --- API Usage Methods ---
+
+func (c *DynamoDBClient) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	sk := statsSKPrefix + day
+	if keyID != "" {
+		sk += "#" + keyID // Days counted without a key keep their keys
+	}
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: usagePK(userID), skName: sk})
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	update := expression.Add(expression.Name("requests"), expression.Value(requests)).
+		Add(expression.Name("wsMessages"), expression.Value(wsMessages)).
+		Set(expression.Name("day"), expression.Value(day))
+	if keyID != "" {
+		update = update.Set(expression.Name("keyId"), expression.Value(keyID))
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	_, err = c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key, UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error incrementing API usage", "userID", userID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *DynamoDBClient) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	// Sort keys are DAY#day or DAY#day#keyID; "~" sorts after every key ID character
+	keyCond := expression.Key(pkName).Equal(expression.Value(usagePK(userID))).
+		And(expression.Key(skName).Between(expression.Value(statsSKPrefix+fromDay), expression.Value(statsSKPrefix+toDay+"#~")))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var days []models.UsageDay
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying API usage", "userID", userID, "error", err)
+			return nil, err
+		}
+		var pageDays []models.UsageDay
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageDays); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling API usage page", "error", err)
+			return nil, err
+		}
+		days = append(days, pageDays...)
+	}
+	return days, nil
 }
 
-func (c *DynamoDBClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.CodeFile, error) {
-	// Similar GSI query as ListPostMetaByUser, filter/unmarshal into CodeFile
-	if offset > 0 {
-		log.Printf("WARN: DynamoDB ListCodeFileMetaByUser does not efficiently support offset. Offset %d ignored.", offset)
-	}
-	if limit <= 0 {
-		limit = defaultLimit
+// --- Write Intent Methods ---
+
+func (c *DynamoDBClient) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	intent.ID = uuid.NewString()
+	intent.CreatedAt = time.Now().UTC()
+
+	itemMap, err := attributevalue.MarshalMap(intent)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal write intent: %w", err)
 	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: intentPK}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: intentSKPrefix + intent.ID}
 
-	keyCond := expression.Key(gsi1PK).Equal(expression.Value(userID))
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query expression: %w", err)
+		slog.ErrorContext(ctx, "DynamoDB error creating write intent", "itemType", intent.ItemType, "itemID", intent.ItemID, "error", err)
+		return "", err
 	}
+	return intent.ID, nil
+}
 
-	input := &dynamodb.QueryInput{
-		TableName: aws.String(c.tableName), IndexName: aws.String(gsi1Name),
-		KeyConditionExpression: expr.KeyCondition(), ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
-		Limit: pointer.To(int32(limit)), ScanIndexForward: pointer.To(false),
+func (c *DynamoDBClient) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(intentPK))
+	filter := expression.Name("createdAt").LessThan(expression.Value(createdBefore.UTC().Format(time.RFC3339Nano)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithFilter(filter).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
 	}
 
-	var files []models.CodeFile
-	paginator := dynamodb.NewQueryPaginator(c.client, input)
-	itemsFetched := 0
-	for paginator.HasMorePages() && itemsFetched < limit {
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		FilterExpression: expr.Filter(), ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	})
+	var intents []models.WriteIntent
+	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			log.Printf("DynamoDB error querying codefiles for user %s: %v", userID, err)
+			slog.ErrorContext(ctx, "DynamoDB error querying write intents", "error", err)
 			return nil, err
 		}
-		var pageFiles []models.CodeFile
-		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageFiles); err != nil {
-			log.Printf("DynamoDB error unmarshalling codefiles page: %v", err)
+		var pageIntents []models.WriteIntent
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageIntents); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling write intents", "error", err)
 			return nil, err
 		}
-		for _, f := range pageFiles {
-			f.ID = strings.TrimPrefix(f.ID, codefilePrefix)
-			files = append(files, f)
-			itemsFetched++
-			if itemsFetched >= limit {
-				break
-			}
-		}
+		intents = append(intents, pageIntents...)
 	}
-	return files, nil
+
+	// Keys are random, so order by creation here
+	sort.Slice(intents, func(i, j int) bool { return intents[i].CreatedAt.Before(intents[j].CreatedAt) })
+	if limit > 0 && len(intents) > limit {
+		intents = intents[:limit]
+	}
+	return intents, nil
 }
 
-func (c *DynamoDBClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
-	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(file.ID), skName: codefileTypeSK})
+func (c *DynamoDBClient) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: intentPK, skName: intentSKPrefix + intentID})
 	if err != nil {
 		return fmt.Errorf("failed to marshal key: %w", err)
 	}
-
-	cond := expression.Name("version").Equal(expression.Value(file.Version))
-	update := expression.Set(expression.Name("fileName"), expression.Value(file.FileName)).
-		Set(expression.Name("language"), expression.Value(file.Language)).
-		Set(expression.Name("updatedAt"), expression.Value(time.Now().UTC().Format(time.RFC3339Nano))).
-		Set(expression.Name("s3Path"), expression.Value(file.S3Path)).
-		Add(expression.Name("version"), expression.Value(1))
-
-	expr, err := expression.NewBuilder().WithCondition(cond).WithUpdate(update).Build()
+	_, err = c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key})
 	if err != nil {
-		return fmt.Errorf("failed to build update expression: %w", err)
+		slog.ErrorContext(ctx, "DynamoDB error deleting write intent", "intentID", intentID, "error", err)
+		return err
 	}
+	return nil
+}
 
-	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String(c.tableName), Key: key,
-		ConditionExpression: expr.Condition(), UpdateExpression: expr.Update(),
-		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
-		ReturnValues: types.ReturnValueNone,
+// --- Journal Methods ---
+
+func (c *DynamoDBClient) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	itemMap, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
 	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: journalPK(entry.ItemID, entry.ItemType)}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: journalSK(entry.Version)}
 
-	_, err = c.client.UpdateItem(ctx, input)
+	_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
 	if err != nil {
-		var condCheckFailed *types.ConditionalCheckFailedException
-		if errors.As(err, &condCheckFailed) {
-			_, getErr := c.GetCodeFileMetaByID(ctx, file.ID)
-			if errors.Is(getErr, database.ErrNotFound) {
-				return database.ErrNotFound
-			}
-			return database.ErrVersionMismatch
-		}
-		log.Printf("DynamoDB error updating codefile meta %s: %v", file.ID, err)
+		slog.ErrorContext(ctx, "DynamoDB error appending journal entry", "itemType", entry.ItemType, "itemID", entry.ItemID, "version", entry.Version, "error", err)
 		return err
 	}
 	return nil
 }
 
-func (c *DynamoDBClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
-	key, err := attributevalue.MarshalMap(map[string]string{pkName: codefilePK(fileID), skName: codefileTypeSK})
+func (c *DynamoDBClient) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(journalPK(itemID, itemType))).
+		And(expression.Key(skName).GreaterThan(expression.Value(journalSK(afterVersion))))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
 	if err != nil {
-		return fmt.Errorf("failed to marshal key: %w", err)
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
 	}
-	input := &dynamodb.DeleteItemInput{TableName: aws.String(c.tableName), Key: key}
-	_, err = c.client.DeleteItem(ctx, input)
+
+	input := &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(min(limit, math.MaxInt32)))
+	}
+	paginator := dynamodb.NewQueryPaginator(c.client, input)
+	var entries []models.JournalEntry
+	for paginator.HasMorePages() && (limit <= 0 || len(entries) < limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying journal", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageEntries []models.JournalEntry
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEntries); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling journal page", "error", err)
+			return nil, err
+		}
+		entries = append(entries, pageEntries...)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (c *DynamoDBClient) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	keyCond := expression.Key(pkName).Equal(expression.Value(journalPK(itemID, itemType))).
+		And(expression.Key(skName).LessThan(expression.Value(journalSK(beforeVersion))))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
 	if err != nil {
-		log.Printf("DynamoDB error deleting codefile meta %s: %v", fileID, err)
-		return err
+		return fmt.Errorf("failed to build query expression: %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ProjectionExpression: aws.String(pkName + ", " + skName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying journal", "itemType", itemType, "itemID", itemID, "error", err)
+			return err
+		}
+		requests := make([]types.WriteRequest, len(page.Items))
+		for i, item := range page.Items {
+			requests[i] = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}}
+		}
+		for start := 0; start < len(requests); start += maxBatchWrite {
+			if err := c.batchWrite(ctx, requests[start:min(start+maxBatchWrite, len(requests))]); err != nil {
+				slog.ErrorContext(ctx, "DynamoDB error deleting journal", "itemType", itemType, "itemID", itemID, "error", err)
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -535,7 +3971,9 @@ func (c *DynamoDBClient) DeleteCodeFileMeta(ctx context.Context, fileID string)
 // --- History Methods ---
 
 func (c *DynamoDBClient) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
-	logEntry.ID = uuid.NewString() // Generate ID
+	if logEntry.ID == "" { // Set when retrying a write; the puts below are idempotent
+		logEntry.ID = uuid.NewString() // Generate ID
+	}
 	if logEntry.Timestamp.IsZero() {
 		logEntry.Timestamp = time.Now().UTC()
 	}
@@ -554,14 +3992,27 @@ func (c *DynamoDBClient) LogAction(ctx context.Context, logEntry *models.History
 		historyItemMap[k] = v
 	} // Copy base data
 	historyItemMap[pkName] = &types.AttributeValueMemberS{Value: historyItemPK(logEntry.ItemID)}
-	historyItemMap[skName] = &types.AttributeValueMemberS{Value: historySK(logEntry.Timestamp)}
+	historyItemMap[skName] = &types.AttributeValueMemberS{Value: historySK(logEntry.Timestamp, logEntry.ID)}
+	// An item event gets a third copy in its owner's partition, numbered by EventSeq
+	var eventItemMap map[string]types.AttributeValue
+	if logEntry.EventSeq > 0 {
+		eventItemMap = make(map[string]types.AttributeValue, len(itemMap))
+		for k, v := range itemMap {
+			eventItemMap[k] = v
+		}
+		eventItemMap[pkName] = &types.AttributeValueMemberS{Value: eventsPK(logEntry.OwnerID)}
+		eventItemMap[skName] = &types.AttributeValueMemberS{Value: eventSK(logEntry.EventSeq)}
+	}
+	// The lookup item joins the feed of every item, and the per-item copy its author's
+	itemMap[gsi3PK] = &types.AttributeValueMemberS{Value: historyFeed}
+	historyItemMap[gsi3PK] = &types.AttributeValueMemberS{Value: historyUserFeed(logEntry.UserID)}
 
 	// Use BatchWriteItem or TransactWriteItems if atomicity is critical between the two items
 	// For simplicity, use two PutItem calls. Failure of the second is less critical.
 	inputLog := &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap}
 	_, err = c.client.PutItem(ctx, inputLog)
 	if err != nil {
-		log.Printf("DynamoDB error logging history log item %s: %v", logEntry.ID, err)
+		slog.ErrorContext(ctx, "DynamoDB error logging history log", "logID", logEntry.ID, "error", err)
 		return "", err
 	}
 
@@ -569,7 +4020,14 @@ func (c *DynamoDBClient) LogAction(ctx context.Context, logEntry *models.History
 	_, err = c.client.PutItem(ctx, inputHistory)
 	if err != nil {
 		// Log warning, but don't fail the whole operation as the main log entry succeeded.
-		log.Printf("DynamoDB WARN: Failed to log history query item for log %s, item %s: %v", logEntry.ID, logEntry.ItemID, err)
+		slog.WarnContext(ctx, "DynamoDB failed to write history query item", "logID", logEntry.ID, "itemID", logEntry.ItemID, "error", err)
+	}
+	if eventItemMap != nil {
+		_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: eventItemMap})
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error writing item event", "logID", logEntry.ID, "ownerID", logEntry.OwnerID, "error", err)
+			return "", err // Retried with the same ID and number, which the puts above survive
+		}
 	}
 
 	return logEntry.ID, nil
@@ -611,12 +4069,12 @@ func (c *DynamoDBClient) GetActionHistory(ctx context.Context, itemID string, it
 	for paginator.HasMorePages() && itemsFetched < limit {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			log.Printf("DynamoDB error querying history for item %s: %v", itemID, err)
+			slog.ErrorContext(ctx, "DynamoDB error querying history", "itemID", itemID, "error", err)
 			return nil, err
 		}
 		var pageHistory []models.HistoryLog
 		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageHistory); err != nil {
-			log.Printf("DynamoDB error unmarshalling history page: %v", err)
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling history page", "error", err)
 			return nil, err
 		}
 		for _, h := range pageHistory {
@@ -634,6 +4092,183 @@ func (c *DynamoDBClient) GetActionHistory(ctx context.Context, itemID string, it
 	return history, nil
 }
 
+func (c *DynamoDBClient) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	// Sort keys are HISTORY#timestamp#logID; "~" sorts after every log ID character
+	upper := historyTypeSKPrefix + until.UTC().Format(time.RFC3339Nano) + "#~"
+	keyCond := expression.Key(pkName).Equal(expression.Value(historyItemPK(itemID))).
+		And(expression.Key(skName).Between(expression.Value(historyTypeSKPrefix), expression.Value(upper)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build history query expression: %w", err)
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(c.tableName),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     pointer.To(int32(limit)),
+		ScanIndexForward:          pointer.To(false), // Newest first
+	}
+
+	var history []models.HistoryLog
+	paginator := dynamodb.NewQueryPaginator(c.client, input)
+	for paginator.HasMorePages() && len(history) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying history", "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var pageHistory []models.HistoryLog
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageHistory); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling history page", "error", err)
+			return nil, err
+		}
+		for _, h := range pageHistory {
+			if h.ItemType == itemType && len(history) < limit {
+				h.ID = strings.TrimPrefix(h.ID, historyLogPrefix)
+				history = append(history, h)
+			}
+		}
+	}
+	return history, nil
+}
+
+// ListHistoryByUser queries the author feed of the per-item history items. Entries
+// logged before the feed existed aren't in it.
+func (c *DynamoDBClient) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	keyCond := expression.Key(gsi3PK).Equal(expression.Value(historyUserFeed(userID))).
+		And(expression.Key(gsi3SK).LessThanEqual(expression.Value(until.UTC().Format(time.RFC3339Nano))))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+	paginator := dynamodb.NewQueryPaginator(c.client, &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi3Name),
+		KeyConditionExpression: expr.KeyCondition(), ExpressionAttributeNames: expr.Names(),
+		ExpressionAttributeValues: expr.Values(), ScanIndexForward: pointer.To(false), // Newest first
+		Limit: pointer.To(int32(limit)),
+	})
+
+	var history []models.HistoryLog
+	for paginator.HasMorePages() && len(history) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying history of user", "userID", userID, "error", err)
+			return nil, err
+		}
+		var pageHistory []models.HistoryLog
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageHistory); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling history page", "error", err)
+			return nil, err
+		}
+		history = append(history, pageHistory...)
+	}
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (c *DynamoDBClient) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	// Entries are partitioned by item, so this queries the feed index of the lookup items
+	keyCond := expression.Key(gsi3PK).Equal(expression.Value(historyFeed)).
+		And(expression.Key(gsi3SK).GreaterThanEqual(expression.Value(since.UTC().Format(time.RFC3339Nano))))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query expression: %w", err)
+	}
+	input := &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), IndexName: aws.String(gsi3Name),
+		KeyConditionExpression: expr.KeyCondition(), ExpressionAttributeNames: expr.Names(),
+		ExpressionAttributeValues: expr.Values(), ScanIndexForward: pointer.To(false), // Newest first
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(min(limit, math.MaxInt32)))
+	}
+	paginator := dynamodb.NewQueryPaginator(c.client, input)
+
+	var history []models.HistoryLog
+	for paginator.HasMorePages() && (limit <= 0 || len(history) < limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error querying recent history", "error", err)
+			return nil, err
+		}
+		var pageHistory []models.HistoryLog
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageHistory); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error unmarshalling history page", "error", err)
+			return nil, err
+		}
+		history = append(history, pageHistory...)
+	}
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (c *DynamoDBClient) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{pkName: eventsPK(userID), skName: eventCounterSK})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	expr, err := expression.NewBuilder().WithUpdate(expression.Add(expression.Name("seq"), expression.Value(1))).Build()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build update expression: %w", err)
+	}
+
+	out, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.tableName), Key: key, UpdateExpression: expr.Update(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error allocating event number", "userID", userID, "error", err)
+		return 0, err
+	}
+	var counter struct {
+		Seq int64 `dynamodbav:"seq"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Attributes, &counter); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal event counter: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+func (c *DynamoDBClient) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	keyCond := expression.Key(pkName).Equal(expression.Value(eventsPK(ownerID))).
+		And(expression.Key(skName).Between(expression.Value(eventSK(afterSeq+1)), expression.Value(eventSKPrefix+"~")))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build item events query expression: %w", err)
+	}
+	input := &dynamodb.QueryInput{
+		TableName: aws.String(c.tableName), KeyConditionExpression: expr.KeyCondition(),
+		ExpressionAttributeNames: expr.Names(), ExpressionAttributeValues: expr.Values(),
+	}
+	if limit > 0 {
+		input.Limit = pointer.To(int32(limit))
+	}
+
+	out, err := c.client.Query(ctx, input)
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error listing item events", "ownerID", ownerID, "error", err)
+		return nil, err
+	}
+	var history []models.HistoryLog
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &history); err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling item events", "ownerID", ownerID, "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
 func (c *DynamoDBClient) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
 	key, err := attributevalue.MarshalMap(map[string]string{
 		pkName: historyLogPK(logID),
@@ -650,7 +4285,7 @@ func (c *DynamoDBClient) GetHistoryLogByID(ctx context.Context, logID string) (*
 
 	result, err := c.client.GetItem(ctx, input)
 	if err != nil {
-		log.Printf("DynamoDB error getting history log %s: %v", logID, err)
+		slog.ErrorContext(ctx, "DynamoDB error getting history log", "logID", logID, "error", err)
 		return nil, err
 	}
 	if result.Item == nil {
@@ -659,9 +4294,136 @@ func (c *DynamoDBClient) GetHistoryLogByID(ctx context.Context, logID string) (*
 
 	var logEntry models.HistoryLog
 	if err := attributevalue.UnmarshalMap(result.Item, &logEntry); err != nil {
-		log.Printf("DynamoDB error unmarshalling history log %s: %v", logID, err)
+		slog.ErrorContext(ctx, "DynamoDB error unmarshalling history log", "logID", logID, "error", err)
 		return nil, err
 	}
 	logEntry.ID = logID // Set ID
 	return &logEntry, nil
 }
+
+// DeleteHistoryLogs removes both items written per entry: the direct lookup item and the
+// per-item history item.
+func (c *DynamoDBClient) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	var requests []types.WriteRequest
+	for _, entry := range logs {
+		keys := [][2]string{
+			{historyLogPK(entry.ID), historyLogTypeSK},
+			{historyItemPK(entry.ItemID), historySK(entry.Timestamp, entry.ID)},
+		}
+		if entry.EventSeq > 0 {
+			keys = append(keys, [2]string{eventsPK(entry.OwnerID), eventSK(entry.EventSeq)})
+		}
+		for _, k := range keys {
+			key, err := attributevalue.MarshalMap(map[string]string{pkName: k[0], skName: k[1]})
+			if err != nil {
+				return fmt.Errorf("failed to marshal key for history log %s: %w", entry.ID, err)
+			}
+			requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+		}
+	}
+
+	for start := 0; start < len(requests); start += maxBatchWrite {
+		end := min(start+maxBatchWrite, len(requests))
+		if err := c.batchWrite(ctx, requests[start:end]); err != nil {
+			slog.ErrorContext(ctx, "DynamoDB error deleting history logs", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// batchWrite sends up to maxBatchWrite requests, retrying unprocessed ones with backoff.
+func (c *DynamoDBClient) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	pending := map[string][]types.WriteRequest{c.tableName: requests}
+	for attempt := 0; attempt < maxBatchRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+			}
+		}
+		out, err := c.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+		if err != nil {
+			return err
+		}
+		if len(out.UnprocessedItems[c.tableName]) == 0 {
+			return nil
+		}
+		pending = out.UnprocessedItems
+	}
+	return fmt.Errorf("%d batch write requests still unprocessed after %d attempts", len(pending[c.tableName]), maxBatchRetries)
+}
+
+// --- Backup Methods ---
+
+// RestoreRecord puts the record with the same keys its Create method writes. A post's
+// slug reservation is put along with it.
+func (c *DynamoDBClient) RestoreRecord(ctx context.Context, record interface{}) error {
+	var pk, sk, owner, id string
+	var createdAt time.Time
+	switch r := record.(type) {
+	case *models.User:
+		r.ID = r.Username // Users are keyed by username
+		pk, sk, id = userPK(r.Username), userTypeSK, r.Username
+	case *models.Post:
+		pk, sk, owner, createdAt, id = postPK(r.ID), postTypeSK, r.UserID, r.CreatedAt, r.ID
+	case *models.CodeFile:
+		pk, sk, owner, createdAt, id = codefilePK(r.ID), codefileTypeSK, r.UserID, r.CreatedAt, r.ID
+	case *models.OwnershipTransfer:
+		pk, sk, owner, createdAt, id = transferPK(r.ID), transferTypeSK, r.ToUserID, r.CreatedAt, r.ID // Indexed under the recipient
+	case *models.Workspace:
+		pk, sk, owner, createdAt, id = workspacePK(r.ID), workspaceTypeSK, r.UserID, r.CreatedAt, r.ID
+	case *models.Template:
+		pk, sk, owner, createdAt, id = templatePK(r.ID), templateTypeSK, templateOwnerKey(r.UserID), r.CreatedAt, r.ID
+	case *models.Project:
+		pk, sk, owner, createdAt, id = projectPK(r.ID), projectTypeSK, r.UserID, r.CreatedAt, r.ID
+	case *models.Asset:
+		pk, sk, owner, createdAt, id = assetPK(r.ID), assetTypeSK, r.UserID, r.CreatedAt, r.ID
+	case *models.Comment:
+		pk, sk, owner, createdAt, id = commentPK(r.ItemID, r.ItemType), commentSKPrefix+r.ID, r.ItemOwnerID, r.CreatedAt, r.ID // Indexed under the item's owner
+	case *models.Report:
+		pk, sk, owner, createdAt, id = reportPK(r.ID), reportTypeSK, reportQueueOwner, r.CreatedAt, r.ID
+	default:
+		return fmt.Errorf("cannot restore record of type %T", record)
+	}
+	if id == "" {
+		return fmt.Errorf("cannot restore %T without an ID", record)
+	}
+
+	itemMap, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T for RestoreRecord: %w", record, err)
+	}
+	itemMap[pkName] = &types.AttributeValueMemberS{Value: pk}
+	itemMap[skName] = &types.AttributeValueMemberS{Value: sk}
+	if owner != "" {
+		itemMap[gsi1PK] = &types.AttributeValueMemberS{Value: owner}
+		itemMap[gsi1SK] = &types.AttributeValueMemberS{Value: createdAt.UTC().Format(time.RFC3339Nano)}
+	}
+	if asset, ok := record.(*models.Asset); ok && asset.ProjectID != "" {
+		itemMap[gsi2PK] = &types.AttributeValueMemberS{Value: asset.ProjectID}
+	}
+	if post, ok := record.(*models.Post); ok && post.ScheduledAt != nil {
+		itemMap[gsi3PK] = &types.AttributeValueMemberS{Value: scheduledFeed}
+		itemMap[gsi3SK] = &types.AttributeValueMemberS{Value: post.ScheduledAt.UTC().Format(time.RFC3339Nano)}
+	}
+
+	if post, ok := record.(*models.Post); ok && post.Slug != "" {
+		slug := c.claimSlug(post.UserID, post.Slug, post.ID)
+		slug.Put.ConditionExpression = nil // Replace a reservation restored earlier
+		_, err = c.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{Put: &types.Put{TableName: aws.String(c.tableName), Item: itemMap}},
+				slug,
+			},
+		})
+	} else {
+		_, err = c.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(c.tableName), Item: itemMap})
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "DynamoDB error restoring record", "type", fmt.Sprintf("%T", record), "id", id, "error", err)
+		return err
+	}
+	return nil
+}
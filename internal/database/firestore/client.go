@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"github.com/kkuzar/blog_system/internal/database"
 	"github.com/kkuzar/blog_system/internal/models"
-	"log"
+	"log/slog"
+	"sort"
+	"strconv"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc/codes"
@@ -17,15 +20,40 @@ import (
 )
 
 const (
-	usersCollection     = "users"
-	postsCollection     = "posts"
-	codefilesCollection = "codefiles"
-	historyCollection   = "history"
-	defaultLimit        = 50
+	usersCollection         = "users"
+	postsCollection         = "posts"
+	codefilesCollection     = "codefiles"
+	projectsCollection      = "projects"
+	workspacesCollection    = "workspaces"
+	collaboratorsCollection = "collaborators"
+	transfersCollection     = "transfers"
+	tagsCollection          = "version_tags" // Keyed by itemType_itemID_name
+	hookResultsCollection   = "hook_results" // Keyed by itemType_itemID_hook
+	bookmarksCollection     = "bookmarks"    // Keyed by userID_postID
+	templatesCollection     = "templates"
+	assetsCollection        = "assets"
+	slugsCollection         = "slugs"          // Slug reservations, keyed by userID:slug
+	redirectsCollection     = "slug_redirects" // Keyed by userID:slug
+	domainsCollection       = "domains"        // Keyed by host
+	statsCollection         = "item_stats"     // Daily view/edit rollups, keyed by itemType_itemID_day
+	usageCollection         = "api_usage"      // Daily request/message rollups, keyed by userID_day
+	intentsCollection       = "write_intents"
+	journalCollection       = "change_journal" // Keyed by itemType_itemID_version
+	historyCollection       = "history"
+	eventSeqsCollection     = "event_seqs" // Last EventSeq of each user, keyed by userID
+	commentsCollection      = "comments"
+	reportsCollection       = "reports"
+	pushCollection          = "push_subscriptions"
+	shareLinksCollection    = "share_links"
+	tenantsCollection       = "tenants" // Parent documents of each tenant's collections
+	defaultLimit            = 50
+	maxPlacedScan           = 1000 // Upper bound on pinned and ranked posts read per user
+	maxVariantScan          = 1000 // Upper bound on translations read per post
 )
 
 type FirestoreClient struct {
 	client *firestore.Client
+	tenant *firestore.DocumentRef // Set by ForTenant; its subcollections hold the tenant's data
 }
 
 // NewFirestoreClient creates a new Firestore client.
@@ -52,17 +80,32 @@ func NewFirestoreClient(ctx context.Context, projectID, credentialsFile string)
 	// 	return nil, fmt.Errorf("failed initial firestore read: %w", err)
 	// }
 
-	log.Printf("Firestore client initialized for project %s", projectID)
+	slog.InfoContext(ctx, "Firestore client initialized", "projectID", projectID)
 
 	return &FirestoreClient{
 		client: client,
 	}, nil
 }
 
-// Close closes the Firestore client.
+// ForTenant returns a client keeping the tenant's data in the subcollections of
+// tenants/<tenantID>, on the same connection.
+func (c *FirestoreClient) ForTenant(ctx context.Context, tenantID string) (database.DBAdapter, error) {
+	return &FirestoreClient{client: c.client, tenant: c.client.Collection(tenantsCollection).Doc(tenantID)}, nil
+}
+
+// collection returns the named collection, in the tenant's tree if there is one.
+func (c *FirestoreClient) collection(name string) *firestore.CollectionRef {
+	if c.tenant != nil {
+		return c.tenant.Collection(name)
+	}
+	return c.client.Collection(name)
+}
+
+// Close closes the Firestore client. Clients made by ForTenant share the connection and
+// leave it open.
 func (c *FirestoreClient) Close(ctx context.Context) error {
-	if c.client != nil {
-		log.Println("Closing Firestore client...")
+	if c.client != nil && c.tenant == nil {
+		slog.InfoContext(ctx, "Closing Firestore client")
 		return c.client.Close()
 	}
 	return nil
@@ -71,18 +114,18 @@ func (c *FirestoreClient) Close(ctx context.Context) error {
 // --- User Methods ---
 
 func (c *FirestoreClient) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
-	docSnap, err := c.client.Collection(usersCollection).Doc(username).Get(ctx)
+	docSnap, err := c.collection(usersCollection).Doc(username).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return nil, database.ErrNotFound
 		}
-		log.Printf("Firestore error getting user %s: %v", username, err)
+		slog.ErrorContext(ctx, "Firestore error getting user", "username", username, "error", err)
 		return nil, err
 	}
 
 	var user models.User
 	if err := docSnap.DataTo(&user); err != nil {
-		log.Printf("Firestore error decoding user %s: %v", username, err)
+		slog.ErrorContext(ctx, "Firestore error decoding user", "username", username, "error", err)
 		return nil, err
 	}
 	user.ID = docSnap.Ref.ID // Set ID from doc ID
@@ -98,21 +141,134 @@ func (c *FirestoreClient) CreateUser(ctx context.Context, user *models.User) err
 
 	// Exclude ID field explicitly if needed, though DataTo usually handles it.
 	// Use Create to ensure it doesn't overwrite an existing user.
-	_, err := c.client.Collection(usersCollection).Doc(user.Username).Create(ctx, user)
+	_, err := c.collection(usersCollection).Doc(user.Username).Create(ctx, user)
 	if err != nil {
 		if status.Code(err) == codes.AlreadyExists {
 			return database.ErrDuplicateUser
 		}
-		log.Printf("Firestore error creating user %s: %v", user.Username, err)
+		slog.ErrorContext(ctx, "Firestore error creating user", "username", user.Username, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "storageBytes", Value: firestore.Increment(delta)},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error adjusting storage for user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "passwordHash", Value: passwordHash},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting password of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	var value interface{} = theme
+	if theme == "" {
+		value = firestore.Delete
+	}
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "siteTheme", Value: value},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting site theme of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	var value interface{} = timezone
+	if timezone == "" {
+		value = firestore.Delete
+	}
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "timezone", Value: value},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting time zone of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetUserEmail(ctx context.Context, userID, email string) error {
+	var value interface{} = email
+	if email == "" {
+		value = firestore.Delete
+	}
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "email", Value: value},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting email address of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	var value interface{} = types
+	if len(types) == 0 {
+		value = firestore.Delete
+	}
+	_, err := c.collection(usersCollection).Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "mutedNotifications", Value: value},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting muted notifications of user", "userID", userID, "error", err)
 		return err
 	}
 	return nil
 }
 
+func (c *FirestoreClient) ListUserIDs(ctx context.Context) ([]string, error) {
+	refs, err := c.collection(usersCollection).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing users", "error", err)
+		return nil, err
+	}
+	userIDs := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		userIDs = append(userIDs, ref.ID)
+	}
+	return userIDs, nil
+}
+
 // --- Post Methods ---
 
 func (c *FirestoreClient) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
-	collRef := c.client.Collection(postsCollection)
+	collRef := c.collection(postsCollection)
 	docRef := collRef.NewDoc() // Auto-generate ID
 
 	post.ID = docRef.ID // Store the generated ID
@@ -120,72 +276,182 @@ func (c *FirestoreClient) CreatePostMeta(ctx context.Context, post *models.Post)
 	post.UpdatedAt = post.CreatedAt
 	post.Version = 1
 
-	_, err := docRef.Set(ctx, post)
+	var err error
+	if post.Slug != "" {
+		// Create the post and claim its slug together so neither exists without the other
+		err = c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			if err := c.claimSlug(tx, post.UserID, post.Slug, post.ID); err != nil {
+				return err
+			}
+			return tx.Create(docRef, post)
+		})
+	} else {
+		_, err = docRef.Set(ctx, post)
+	}
 	if err != nil {
-		log.Printf("Firestore error creating post meta: %v", err)
+		if errors.Is(err, database.ErrDuplicateSlug) {
+			return "", err
+		}
+		slog.ErrorContext(ctx, "Firestore error creating post meta", "error", err)
 		return "", err
 	}
 	return post.ID, nil
 }
 
+func (c *FirestoreClient) slugRef(userID, slug string) *firestore.DocumentRef {
+	return c.collection(slugsCollection).Doc(userID + ":" + slug)
+}
+
+// claimSlug reserves slug among userID's posts for postID within tx. It reads before
+// writing, so callers must do their own reads first.
+func (c *FirestoreClient) claimSlug(tx *firestore.Transaction, userID, slug, postID string) error {
+	ref := c.slugRef(userID, slug)
+	if _, err := tx.Get(ref); err == nil {
+		return database.ErrDuplicateSlug
+	} else if status.Code(err) != codes.NotFound {
+		return err
+	}
+	return tx.Create(ref, map[string]interface{}{"postId": postID})
+}
+
 func (c *FirestoreClient) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
-	docSnap, err := c.client.Collection(postsCollection).Doc(postID).Get(ctx)
+	docSnap, err := c.collection(postsCollection).Doc(postID).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return nil, database.ErrNotFound
 		}
-		log.Printf("Firestore error getting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "Firestore error getting post meta", "postID", postID, "error", err)
 		return nil, err
 	}
 	var post models.Post
 	if err := docSnap.DataTo(&post); err != nil {
-		log.Printf("Firestore error decoding post %s: %v", postID, err)
+		slog.ErrorContext(ctx, "Firestore error decoding post", "postID", postID, "error", err)
 		return nil, err
 	}
 	post.ID = docSnap.Ref.ID
 	return &post, nil
 }
 
-func (c *FirestoreClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.Post, error) {
+// GetPostMetaBySlug finds the post through its slug reservation.
+func (c *FirestoreClient) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	docSnap, err := c.slugRef(userID, slug).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting slug reservation", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	postID, ok := docSnap.Data()["postId"].(string)
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	post, err := c.GetPostMetaByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != userID || post.Slug != slug {
+		return nil, database.ErrNotFound // Changed since the read above
+	}
+	return post, nil
+}
+
+func (c *FirestoreClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
 	if limit <= 0 {
 		limit = defaultLimit
 	}
-	query := c.client.Collection(postsCollection).
-		Where("UserID", "==", userID).        // Ensure field name matches struct tag exactly
-		OrderBy("CreatedAt", firestore.Desc). // Ensure field name matches struct tag
-		Limit(limit)
 
-	if offset > 0 {
-		query = query.Offset(offset)
+	// Documents without the placement fields can't be ordered by them, so placed posts
+	// are read separately and go first
+	placed, err := c.listPlacedPosts(ctx, userID, includeArchived)
+	if err != nil {
+		return nil, err
 	}
+	database.SortPlacedPosts(placed)
+	posts, restLimit, restOffset := database.PlacedPage(placed, limit, offset)
+	if restLimit == 0 {
+		return posts, nil
+	}
+
+	// The date-ordered query includes the placed posts, so read past them and skip them
+	query := c.collection(postsCollection).
+		Where("UserID", "==", userID).        // Ensure field name matches struct tag exactly
+		OrderBy("CreatedAt", firestore.Desc). // Ensure field name matches struct tag
+		Limit(restOffset + restLimit + len(placed))
 
 	iter := query.Documents(ctx)
 	defer iter.Stop()
 
-	var posts []models.Post
-	for {
+	skipped := 0
+	for len(posts) < limit {
 		docSnap, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			log.Printf("Firestore error iterating posts for user %s: %v", userID, err)
+			slog.ErrorContext(ctx, "Firestore error iterating posts for user", "userID", userID, "error", err)
 			return nil, err
 		}
 
 		var post models.Post
 		if err := docSnap.DataTo(&post); err != nil {
-			log.Printf("Firestore error decoding post %s in list: %v", docSnap.Ref.ID, err)
+			slog.ErrorContext(ctx, "Firestore error decoding post in list", "docID", docSnap.Ref.ID, "error", err)
 			continue
 		} // Skip bad doc
+		if post.DeletedAt != nil {
+			continue // Trashed; Firestore can't query for a missing field, so filter here
+		}
+		if (post.ArchivedAt != nil && !includeArchived) || database.IsPlaced(&post) {
+			continue
+		}
+		if skipped < restOffset {
+			skipped++
+			continue
+		}
 		post.ID = docSnap.Ref.ID
 		posts = append(posts, post)
 	}
 	return posts, nil
 }
 
+// listPlacedPosts returns a user's pinned and ranked posts, unsorted.
+func (c *FirestoreClient) listPlacedPosts(ctx context.Context, userID string, includeArchived bool) ([]models.Post, error) {
+	coll := c.collection(postsCollection)
+	queries := []firestore.Query{
+		coll.Where("userId", "==", userID).Where("pinned", "==", true).Limit(maxPlacedScan),
+		coll.Where("userId", "==", userID).Where("rank", ">", 0).Limit(maxPlacedScan),
+	}
+
+	var posts []models.Post
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error listing placed posts for user", "userID", userID, "error", err)
+			return nil, err
+		}
+		for _, docSnap := range docs {
+			if seen[docSnap.Ref.ID] {
+				continue // Both pinned and ranked
+			}
+			seen[docSnap.Ref.ID] = true
+			var post models.Post
+			if err := docSnap.DataTo(&post); err != nil {
+				slog.ErrorContext(ctx, "Firestore error decoding post in list", "docID", docSnap.Ref.ID, "error", err)
+				continue
+			}
+			if post.DeletedAt != nil || (post.ArchivedAt != nil && !includeArchived) {
+				continue
+			}
+			post.ID = docSnap.Ref.ID
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
 func (c *FirestoreClient) UpdatePostMeta(ctx context.Context, post *models.Post) error {
-	docRef := c.client.Collection(postsCollection).Doc(post.ID)
+	docRef := c.collection(postsCollection).Doc(post.ID)
 
 	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		docSnap, err := tx.Get(docRef) // Use tx.Get
@@ -209,11 +475,26 @@ func (c *FirestoreClient) UpdatePostMeta(ctx context.Context, post *models.Post)
 		// Prepare updates
 		updates := []firestore.Update{
 			{Path: "Title", Value: post.Title},
-			{Path: "Slug", Value: post.Slug},
 			{Path: "UpdatedAt", Value: time.Now().UTC()},
 			{Path: "S3Path", Value: post.S3Path},
+			{Path: "size", Value: post.Size},
+			{Path: "contentHash", Value: post.ContentHash},
+			{Path: "wordCount", Value: post.WordCount},
+			{Path: "readingTimeMinutes", Value: post.ReadingTimeMinutes},
+			{Path: "draft", Value: post.Draft},
 			{Path: "Version", Value: firestore.Increment(1)}, // Increment version
 		}
+		// Front-matter fields are omitted when unset, as on create
+		if post.Tags != nil {
+			updates = append(updates, firestore.Update{Path: "tags", Value: post.Tags})
+		} else {
+			updates = append(updates, firestore.Update{Path: "tags", Value: firestore.Delete})
+		}
+		if post.Date != nil {
+			updates = append(updates, firestore.Update{Path: "date", Value: *post.Date})
+		} else {
+			updates = append(updates, firestore.Update{Path: "date", Value: firestore.Delete})
+		}
 
 		return tx.Update(docRef, updates) // Use tx.Update
 	}) // End Transaction
@@ -222,7 +503,7 @@ func (c *FirestoreClient) UpdatePostMeta(ctx context.Context, post *models.Post)
 		if errors.Is(err, database.ErrVersionMismatch) || errors.Is(err, database.ErrNotFound) {
 			return err // Return specific errors directly
 		}
-		log.Printf("Firestore transaction error updating post meta %s: %v", post.ID, err)
+		slog.ErrorContext(ctx, "Firestore transaction error updating post meta", "postID", post.ID, "error", err)
 		// Check if the error is a GRPC error code for concurrency/retry issues
 		if stat, ok := status.FromError(err); ok {
 			if stat.Code() == codes.Aborted || stat.Code() == codes.FailedPrecondition {
@@ -236,13 +517,42 @@ func (c *FirestoreClient) UpdatePostMeta(ctx context.Context, post *models.Post)
 }
 
 func (c *FirestoreClient) DeletePostMeta(ctx context.Context, postID string) error {
-	_, err := c.client.Collection(postsCollection).Doc(postID).Delete(ctx)
+	docRef := c.collection(postsCollection).Doc(postID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil // Already gone
+			}
+			return err
+		}
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			return fmt.Errorf("failed to decode post in transaction: %w", err)
+		}
+		var releaseRef *firestore.DocumentRef
+		if post.Slug != "" {
+			slugSnap, err := tx.Get(c.slugRef(post.UserID, post.Slug))
+			if err == nil && slugSnap.Data()["postId"] == postID {
+				releaseRef = slugSnap.Ref // Only release our own reservation
+			} else if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+		}
+		if err := tx.Delete(docRef); err != nil {
+			return err
+		}
+		if releaseRef != nil {
+			return tx.Delete(releaseRef)
+		}
+		return nil
+	})
 	if err != nil {
 		// Delete doesn't typically return NotFound, but check just in case API changes
 		if status.Code(err) == codes.NotFound {
 			return database.ErrNotFound
 		}
-		log.Printf("Firestore error deleting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "Firestore error deleting post meta", "postID", postID, "error", err)
 		return err
 	}
 	// To strictly return ErrNotFound, we'd need a Get before Delete or check error code.
@@ -250,77 +560,8 @@ func (c *FirestoreClient) DeletePostMeta(ctx context.Context, postID string) err
 	return nil
 }
 
-// --- CodeFile Methods (Similar structure to Post methods) ---
-
-func (c *FirestoreClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
-	docRef := c.client.Collection(codefilesCollection).NewDoc()
-	file.ID = docRef.ID
-	file.CreatedAt = time.Now().UTC()
-	file.UpdatedAt = file.CreatedAt
-	file.Version = 1
-	_, err := docRef.Set(ctx, file)
-	if err != nil {
-		log.Printf("Firestore error creating codefile meta: %v", err)
-		return "", err
-	}
-	return file.ID, nil
-}
-
-func (c *FirestoreClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
-	docSnap, err := c.client.Collection(codefilesCollection).Doc(fileID).Get(ctx)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			return nil, database.ErrNotFound
-		}
-		log.Printf("Firestore error getting codefile meta %s: %v", fileID, err)
-		return nil, err
-	}
-	var file models.CodeFile
-	if err := docSnap.DataTo(&file); err != nil {
-		log.Printf("Firestore error decoding codefile %s: %v", fileID, err)
-		return nil, err
-	}
-	file.ID = docSnap.Ref.ID
-	return &file, nil
-}
-
-func (c *FirestoreClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.CodeFile, error) {
-	if limit <= 0 {
-		limit = defaultLimit
-	}
-	query := c.client.Collection(codefilesCollection).
-		Where("UserID", "==", userID).
-		OrderBy("CreatedAt", firestore.Desc).
-		Limit(limit)
-	if offset > 0 {
-		query = query.Offset(offset)
-	}
-
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-	var files []models.CodeFile
-	for {
-		docSnap, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Printf("Firestore error iterating codefiles for user %s: %v", userID, err)
-			return nil, err
-		}
-		var file models.CodeFile
-		if err := docSnap.DataTo(&file); err != nil {
-			log.Printf("Firestore error decoding codefile %s in list: %v", docSnap.Ref.ID, err)
-			continue
-		}
-		file.ID = docSnap.Ref.ID
-		files = append(files, file)
-	}
-	return files, nil
-}
-
-func (c *FirestoreClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
-	docRef := c.client.Collection(codefilesCollection).Doc(file.ID)
+func (c *FirestoreClient) SetPostSlug(ctx context.Context, postID, slug string) error {
+	docRef := c.collection(postsCollection).Doc(postID)
 	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		docSnap, err := tx.Get(docRef)
 		if err != nil {
@@ -329,73 +570,2330 @@ func (c *FirestoreClient) UpdateCodeFileMeta(ctx context.Context, file *models.C
 			}
 			return err
 		}
-		var existingFile models.CodeFile
-		if err := docSnap.DataTo(&existingFile); err != nil {
-			return fmt.Errorf("failed to decode existing codefile: %w", err)
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			return fmt.Errorf("failed to decode post in transaction: %w", err)
 		}
-		if existingFile.Version != file.Version {
-			return database.ErrVersionMismatch
+		if post.Slug == slug {
+			return nil
 		}
-
-		updates := []firestore.Update{
-			{Path: "FileName", Value: file.FileName},
-			{Path: "Language", Value: file.Language},
-			{Path: "UpdatedAt", Value: time.Now().UTC()},
-			{Path: "S3Path", Value: file.S3Path},
-			{Path: "Version", Value: firestore.Increment(1)},
+		if err := c.claimSlug(tx, post.UserID, slug, postID); err != nil {
+			return err
 		}
-		return tx.Update(docRef, updates)
-	}) // End Transaction
+		if err := tx.Update(docRef, []firestore.Update{
+			{Path: "slug", Value: slug},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+		}); err != nil {
+			return err
+		}
+		if post.Slug != "" {
+			return tx.Delete(c.slugRef(post.UserID, post.Slug))
+		}
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, database.ErrVersionMismatch) || errors.Is(err, database.ErrNotFound) {
+		if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrDuplicateSlug) {
 			return err
 		}
-		log.Printf("Firestore transaction error updating codefile meta %s: %v", file.ID, err)
-		if stat, ok := status.FromError(err); ok && (stat.Code() == codes.Aborted || stat.Code() == codes.FailedPrecondition) {
-			return database.ErrVersionMismatch
+		slog.ErrorContext(ctx, "Firestore error setting slug of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{
+		{Path: "publishedVersion", Value: version},
+		{Path: "publishedAt", Value: publishedAt},
+		{Path: "excerpt", Value: excerpt},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
 		}
+		slog.ErrorContext(ctx, "Firestore error publishing post", "postID", postID, "error", err)
 		return err
 	}
 	return nil
 }
 
-func (c *FirestoreClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
-	_, err := c.client.Collection(codefilesCollection).Doc(fileID).Delete(ctx)
+func (c *FirestoreClient) SetPostUnpublished(ctx context.Context, postID string) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{
+		{Path: "publishedVersion", Value: firestore.Delete},
+		{Path: "publishedAt", Value: firestore.Delete},
+	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return database.ErrNotFound
 		}
-		log.Printf("Firestore error deleting codefile meta %s: %v", fileID, err)
+		slog.ErrorContext(ctx, "Firestore error unpublishing post", "postID", postID, "error", err)
 		return err
 	}
 	return nil
 }
 
-// --- History Methods ---
+func (c *FirestoreClient) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	return c.setPostField(ctx, postID, "pinned", pinned)
+}
 
-func (c *FirestoreClient) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
-	docRef := c.client.Collection(historyCollection).NewDoc()
-	logEntry.ID = docRef.ID
-	if logEntry.Timestamp.IsZero() {
-		logEntry.Timestamp = time.Now().UTC()
-	}
+func (c *FirestoreClient) SetPostRank(ctx context.Context, postID string, rank int) error {
+	return c.setPostField(ctx, postID, "rank", rank)
+}
 
-	_, err := docRef.Set(ctx, logEntry)
+func (c *FirestoreClient) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	return c.setPostField(ctx, postID, "coAuthors", coAuthors)
+}
+
+func (c *FirestoreClient) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{
+		{Path: "language", Value: language},
+		{Path: "translationOf", Value: translationOf},
+	})
 	if err != nil {
-		log.Printf("Firestore error logging action: %v", err)
-		return "", err
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting language of post", "postID", postID, "error", err)
+		return err
 	}
-	return logEntry.ID, nil
+	return nil
 }
 
-func (c *FirestoreClient) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
-	if limit <= 0 {
-		limit = defaultLimit
+func (c *FirestoreClient) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	updates := []firestore.Update{{Path: "scheduledAt", Value: firestore.Delete}, {Path: "scheduledVersion", Value: firestore.Delete}}
+	if scheduledAt != nil {
+		updates = []firestore.Update{{Path: "scheduledAt", Value: *scheduledAt}, {Path: "scheduledVersion", Value: version}}
 	}
-	query := c.client.Collection(historyCollection).
-		Where("ItemID", "==", itemID). // Ensure field names match struct tags
-		Where("ItemType", "==", itemType).
-		OrderBy("Timestamp", firestore.Desc).
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, updates)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting schedule of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	update := firestore.Update{Path: "takenDownAt", Value: firestore.Delete}
+	if takenDownAt != nil {
+		update.Value = *takenDownAt
+	}
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{update})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting takedown of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	docs, err := c.collection(postsCollection).
+		Where("userId", "==", userID).
+		Where("translationOf", "==", postID).
+		Limit(maxVariantScan).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing translations of post", "postID", postID, "error", err)
+		return nil, err
+	}
+	var posts []models.Post
+	for _, docSnap := range docs {
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding post in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		post.ID = docSnap.Ref.ID
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.Before(posts[j].CreatedAt) })
+	return posts, nil
+}
+
+func (c *FirestoreClient) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	query := c.collection(postsCollection).Where("scheduledAt", "<=", before).OrderBy("scheduledAt", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing due posts", "error", err)
+		return nil, err
+	}
+	var posts []models.Post
+	for _, docSnap := range docs {
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding post in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		post.ID = docSnap.Ref.ID
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+// --- Slug Redirect Methods ---
+
+func (c *FirestoreClient) redirectRef(userID, slug string) *firestore.DocumentRef {
+	return c.collection(redirectsCollection).Doc(userID + ":" + slug)
+}
+
+func (c *FirestoreClient) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	if redirect.CreatedAt.IsZero() {
+		redirect.CreatedAt = time.Now().UTC()
+	}
+	if _, err := c.redirectRef(redirect.UserID, redirect.Slug).Set(ctx, redirect); err != nil {
+		slog.ErrorContext(ctx, "Firestore error putting slug redirect", "userID", redirect.UserID, "slug", redirect.Slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	docSnap, err := c.redirectRef(userID, slug).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	var redirect models.SlugRedirect
+	if err := docSnap.DataTo(&redirect); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding slug redirect", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	return &redirect, nil
+}
+
+func (c *FirestoreClient) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	iter := c.collection(redirectsCollection).Where("userId", "==", userID).OrderBy("createdAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+	var redirects []models.SlugRedirect
+	for {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error listing slug redirects", "userID", userID, "error", err)
+			return nil, err
+		}
+		var redirect models.SlugRedirect
+		if err := docSnap.DataTo(&redirect); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding slug redirect", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		redirects = append(redirects, redirect)
+	}
+	return redirects, nil
+}
+
+func (c *FirestoreClient) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	if _, err := c.redirectRef(userID, slug).Delete(ctx); err != nil {
+		slog.ErrorContext(ctx, "Firestore error deleting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Domain Methods ---
+
+func (c *FirestoreClient) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	if domain.CreatedAt.IsZero() {
+		domain.CreatedAt = time.Now().UTC()
+	}
+	// Create fails if the host is taken instead of moving the domain
+	if _, err := c.collection(domainsCollection).Doc(domain.Host).Create(ctx, domain); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return database.ErrDuplicateDomain
+		}
+		slog.ErrorContext(ctx, "Firestore error creating domain", "host", domain.Host, "userID", domain.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	docSnap, err := c.collection(domainsCollection).Doc(host).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting domain", "host", host, "error", err)
+		return nil, err
+	}
+	var domain models.Domain
+	if err := docSnap.DataTo(&domain); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding domain", "host", host, "error", err)
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *FirestoreClient) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	docs, err := c.collection(domainsCollection).Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing domains", "userID", userID, "error", err)
+		return nil, err
+	}
+	domains := make([]models.Domain, 0, len(docs))
+	for _, docSnap := range docs {
+		var domain models.Domain
+		if err := docSnap.DataTo(&domain); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding domain in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (c *FirestoreClient) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	// Unverified domains have no verifiedAt field, which the inequality leaves out
+	docs, err := c.collection(domainsCollection).Where("verifiedAt", ">", time.Time{}).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing verified domains", "error", err)
+		return nil, err
+	}
+	domains := make([]models.Domain, 0, len(docs))
+	for _, docSnap := range docs {
+		var domain models.Domain
+		if err := docSnap.DataTo(&domain); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding domain in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (c *FirestoreClient) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	var value interface{} = verifiedAt
+	if verifiedAt.IsZero() {
+		value = firestore.Delete
+	}
+	_, err := c.collection(domainsCollection).Doc(host).Update(ctx, []firestore.Update{{Path: "verifiedAt", Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error verifying domain", "host", host, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteDomain(ctx context.Context, host string) error {
+	if _, err := c.collection(domainsCollection).Doc(host).Delete(ctx); err != nil {
+		slog.ErrorContext(ctx, "Firestore error deleting domain", "host", host, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Push Subscription Methods ---
+
+func (c *FirestoreClient) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+	if _, err := c.collection(pushCollection).Doc(sub.ID).Set(ctx, sub); err != nil {
+		slog.ErrorContext(ctx, "Firestore error saving push subscription", "subscriptionID", sub.ID, "userID", sub.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	docs, err := c.collection(pushCollection).Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing push subscriptions", "userID", userID, "error", err)
+		return nil, err
+	}
+	subs := make([]models.PushSubscription, 0, len(docs))
+	for _, docSnap := range docs {
+		var sub models.PushSubscription
+		if err := docSnap.DataTo(&sub); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding push subscription in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (c *FirestoreClient) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	if _, err := c.collection(pushCollection).Doc(subscriptionID).Delete(ctx); err != nil {
+		slog.ErrorContext(ctx, "Firestore error deleting push subscription", "subscriptionID", subscriptionID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Share Link Methods ---
+
+func (c *FirestoreClient) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	if _, err := c.collection(shareLinksCollection).Doc(link.LinkID).Create(ctx, link); err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating share link", "linkID", link.LinkID, "itemID", link.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	docSnap, err := c.collection(shareLinksCollection).Doc(linkID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting share link", "linkID", linkID, "error", err)
+		return nil, err
+	}
+	var link models.ShareLink
+	if err := docSnap.DataTo(&link); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding share link", "linkID", linkID, "error", err)
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (c *FirestoreClient) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	docs, err := c.collection(shareLinksCollection).Where("userId", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing share links", "userID", userID, "error", err)
+		return nil, err
+	}
+	links := make([]models.ShareLink, 0, len(docs))
+	for _, docSnap := range docs {
+		var link models.ShareLink
+		if err := docSnap.DataTo(&link); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding share link in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links, nil
+}
+
+func (c *FirestoreClient) DeleteShareLink(ctx context.Context, linkID string) error {
+	if _, err := c.collection(shareLinksCollection).Doc(linkID).Delete(ctx); err != nil {
+		slog.ErrorContext(ctx, "Firestore error deleting share link", "linkID", linkID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// setPostField sets a single field of a post without bumping its version.
+func (c *FirestoreClient) setPostField(ctx context.Context, postID, field string, value interface{}) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{{Path: field, Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting field of post", "field", field, "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{
+		{Path: "excerpt", Value: excerpt},
+		{Path: "excerptManual", Value: manual},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting excerpt of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{
+		{Path: "canonicalUrl", Value: canonicalURL},
+		{Path: "metaDescription", Value: metaDescription},
+		{Path: "noIndex", Value: noIndex},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting SEO metadata of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	var value interface{} = assetID
+	if assetID == "" {
+		value = firestore.Delete
+	}
+	_, err := c.collection(postsCollection).Doc(postID).Update(ctx, []firestore.Update{{Path: "coverImage", Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting cover image of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- CodeFile Methods (Similar structure to Post methods) ---
+
+func (c *FirestoreClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	docRef := c.collection(codefilesCollection).NewDoc()
+	file.ID = docRef.ID
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.Version = 1
+	_, err := docRef.Set(ctx, file)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating codefile meta", "error", err)
+		return "", err
+	}
+	return file.ID, nil
+}
+
+func (c *FirestoreClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	docSnap, err := c.collection(codefilesCollection).Doc(fileID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting codefile meta", "fileID", fileID, "error", err)
+		return nil, err
+	}
+	var file models.CodeFile
+	if err := docSnap.DataTo(&file); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding codefile", "fileID", fileID, "error", err)
+		return nil, err
+	}
+	file.ID = docSnap.Ref.ID
+	return &file, nil
+}
+
+func (c *FirestoreClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(codefilesCollection).
+		Where("UserID", "==", userID).
+		OrderBy("CreatedAt", firestore.Desc).
+		Limit(limit)
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	var files []models.CodeFile
+	for {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error iterating codefiles for user", "userID", userID, "error", err)
+			return nil, err
+		}
+		var file models.CodeFile
+		if err := docSnap.DataTo(&file); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding codefile in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		if file.DeletedAt != nil {
+			continue // Trashed
+		}
+		if file.ArchivedAt != nil && !includeArchived {
+			continue
+		}
+		file.ID = docSnap.Ref.ID
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (c *FirestoreClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	docRef := c.collection(codefilesCollection).Doc(file.ID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return database.ErrNotFound
+			}
+			return err
+		}
+		var existingFile models.CodeFile
+		if err := docSnap.DataTo(&existingFile); err != nil {
+			return fmt.Errorf("failed to decode existing codefile: %w", err)
+		}
+		if existingFile.Version != file.Version {
+			return database.ErrVersionMismatch
+		}
+
+		updates := []firestore.Update{
+			{Path: "Language", Value: file.Language},
+			{Path: "UpdatedAt", Value: time.Now().UTC()},
+			{Path: "S3Path", Value: file.S3Path},
+			{Path: "size", Value: file.Size},
+			{Path: "contentHash", Value: file.ContentHash},
+			{Path: "Version", Value: firestore.Increment(1)},
+		}
+		return tx.Update(docRef, updates)
+	}) // End Transaction
+	if err != nil {
+		if errors.Is(err, database.ErrVersionMismatch) || errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore transaction error updating codefile meta", "fileID", file.ID, "error", err)
+		if stat, ok := status.FromError(err); ok && (stat.Code() == codes.Aborted || stat.Code() == codes.FailedPrecondition) {
+			return database.ErrVersionMismatch
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	_, err := c.collection(codefilesCollection).Doc(fileID).Delete(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting codefile meta", "fileID", fileID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	_, err := c.collection(codefilesCollection).Doc(fileID).Update(ctx, []firestore.Update{
+		{Path: "fileName", Value: fileName},
+		{Path: "path", Value: path},
+		{Path: "language", Value: language},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error renaming codefile", "fileID", fileID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Ownership Transfer Methods ---
+
+func (c *FirestoreClient) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	docRef := c.collection(transfersCollection).NewDoc()
+	transfer.ID = docRef.ID
+	transfer.CreatedAt = time.Now().UTC()
+	_, err := docRef.Set(ctx, transfer)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating transfer", "itemType", transfer.ItemType, "itemID", transfer.ItemID, "error", err)
+		return "", err
+	}
+	return transfer.ID, nil
+}
+
+func (c *FirestoreClient) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	docSnap, err := c.collection(transfersCollection).Doc(transferID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting transfer", "transferID", transferID, "error", err)
+		return nil, err
+	}
+	var transfer models.OwnershipTransfer
+	if err := docSnap.DataTo(&transfer); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding transfer", "transferID", transferID, "error", err)
+		return nil, err
+	}
+	transfer.ID = docSnap.Ref.ID
+	return &transfer, nil
+}
+
+func (c *FirestoreClient) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	docs, err := c.collection(transfersCollection).
+		Where("toUserId", "==", toUserID).
+		Where("status", "==", string(models.TransferPending)).
+		OrderBy("createdAt", firestore.Desc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing transfers for user", "toUserID", toUserID, "error", err)
+		return nil, err
+	}
+	transfers := make([]models.OwnershipTransfer, 0, len(docs))
+	for _, docSnap := range docs {
+		var transfer models.OwnershipTransfer
+		if err := docSnap.DataTo(&transfer); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding transfer in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		transfer.ID = docSnap.Ref.ID
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// ListTransfersByUser runs one query per side: Firestore can't OR fields without
+// composite indexes on both.
+func (c *FirestoreClient) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	var transfers []models.OwnershipTransfer
+	for _, field := range []string{"fromUserId", "toUserId"} {
+		docs, err := c.collection(transfersCollection).Where(field, "==", userID).Documents(ctx).GetAll()
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error listing transfers of user", "userID", userID, "error", err)
+			return nil, err
+		}
+		for _, docSnap := range docs {
+			var transfer models.OwnershipTransfer
+			if err := docSnap.DataTo(&transfer); err != nil {
+				slog.ErrorContext(ctx, "Firestore error decoding transfer in list", "docID", docSnap.Ref.ID, "error", err)
+				continue
+			}
+			if field == "toUserId" && transfer.FromUserID == userID {
+				continue // Listed already
+			}
+			transfer.ID = docSnap.Ref.ID
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt.After(transfers[j].CreatedAt) })
+	return transfers, nil
+}
+
+func (c *FirestoreClient) ResolveTransfer(ctx context.Context, transferID string, newStatus models.TransferStatus, resolvedAt time.Time) error {
+	docRef := c.collection(transfersCollection).Doc(transferID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var transfer models.OwnershipTransfer
+		if err := docSnap.DataTo(&transfer); err != nil {
+			return err
+		}
+		if transfer.Status != models.TransferPending {
+			return database.ErrNotFound // No longer pending
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "status", Value: string(newStatus)},
+			{Path: "resolvedAt", Value: resolvedAt},
+		})
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore error resolving transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ReopenTransfer(ctx context.Context, transferID string) error {
+	docRef := c.collection(transfersCollection).Doc(transferID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var transfer models.OwnershipTransfer
+		if err := docSnap.DataTo(&transfer); err != nil {
+			return err
+		}
+		if transfer.Status != models.TransferAccepted {
+			return database.ErrNotFound // Not accepted
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "status", Value: string(models.TransferPending)},
+			{Path: "resolvedAt", Value: firestore.Delete},
+		})
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore error reopening transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// setOwner hands an item to userID. Workspace and project belong to the previous owner,
+// so the item lands in the new owner's default workspace outside any project.
+func (c *FirestoreClient) setOwner(ctx context.Context, collName, id, userID, s3Path string) error {
+	updates := []firestore.Update{
+		{Path: "userId", Value: userID},
+		{Path: "s3Path", Value: s3Path},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+		{Path: "workspaceId", Value: firestore.Delete},
+	}
+	if collName == codefilesCollection {
+		updates = append(updates, firestore.Update{Path: "projectId", Value: firestore.Delete})
+	}
+	_, err := c.collection(collName).Doc(id).Update(ctx, updates)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error transferring item", "collection", collName, "itemID", id, "toUserID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// SetPostOwner moves the post's slug reservation to the new owner along with the post.
+func (c *FirestoreClient) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	docRef := c.collection(postsCollection).Doc(postID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return database.ErrNotFound
+			}
+			return err
+		}
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			return fmt.Errorf("failed to decode post in transaction: %w", err)
+		}
+		if post.Slug != "" {
+			if err := c.claimSlug(tx, userID, post.Slug, postID); err != nil {
+				return err
+			}
+			if err := tx.Delete(c.slugRef(post.UserID, post.Slug)); err != nil {
+				return err
+			}
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "userId", Value: userID},
+			{Path: "s3Path", Value: s3Path},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+			{Path: "workspaceId", Value: firestore.Delete},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrDuplicateSlug) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore error transferring post to user", "postID", postID, "toUserID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	return c.setOwner(ctx, codefilesCollection, fileID, userID, s3Path)
+}
+
+// --- Collaborator Methods ---
+
+// collaboratorDocID is the document ID of a collaborator; one per user and item.
+func collaboratorDocID(itemID, itemType, userID string) string {
+	return itemType + "_" + itemID + "_" + userID
+}
+
+func (c *FirestoreClient) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	if collab.CreatedAt.IsZero() {
+		collab.CreatedAt = time.Now().UTC()
+	}
+	docRef := c.collection(collaboratorsCollection).Doc(collaboratorDocID(collab.ItemID, collab.ItemType, collab.UserID))
+	if _, err := docRef.Set(ctx, collab); err != nil {
+		slog.ErrorContext(ctx, "Firestore error saving collaborator", "userID", collab.UserID, "itemType", collab.ItemType, "itemID", collab.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	docSnap, err := c.collection(collaboratorsCollection).Doc(collaboratorDocID(itemID, itemType, userID)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	var collab models.Collaborator
+	if err := docSnap.DataTo(&collab); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding collaborator", "docID", docSnap.Ref.ID, "error", err)
+		return nil, err
+	}
+	return &collab, nil
+}
+
+func (c *FirestoreClient) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	docs, err := c.collection(collaboratorsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing collaborators", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	collabs := make([]models.Collaborator, 0, len(docs))
+	for _, docSnap := range docs {
+		var collab models.Collaborator
+		if err := docSnap.DataTo(&collab); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding collaborator in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		collabs = append(collabs, collab)
+	}
+	return collabs, nil
+}
+
+func (c *FirestoreClient) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	docRef := c.collection(collaboratorsCollection).Doc(collaboratorDocID(itemID, itemType, userID))
+	// Delete with an Exists precondition so a missing collaborator reports NotFound
+	if _, err := docRef.Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Version Tag Methods ---
+
+// versionTagDocID is the document ID of a version tag; names are unique per item.
+func versionTagDocID(itemID, itemType, name string) string {
+	return itemType + "_" + itemID + "_" + name
+}
+
+func (c *FirestoreClient) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = time.Now().UTC()
+	}
+	docRef := c.collection(tagsCollection).Doc(versionTagDocID(tag.ItemID, tag.ItemType, tag.Name))
+	// Create fails if the name is taken instead of moving the tag
+	if _, err := docRef.Create(ctx, tag); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return database.ErrDuplicateTag
+		}
+		slog.ErrorContext(ctx, "Firestore error creating tag", "tag", tag.Name, "itemType", tag.ItemType, "itemID", tag.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	docSnap, err := c.collection(tagsCollection).Doc(versionTagDocID(itemID, itemType, name)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	var tag models.VersionTag
+	if err := docSnap.DataTo(&tag); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding tag", "docID", docSnap.Ref.ID, "error", err)
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (c *FirestoreClient) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	docs, err := c.collection(tagsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing tags", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	tags := make([]models.VersionTag, 0, len(docs))
+	for _, docSnap := range docs {
+		var tag models.VersionTag
+		if err := docSnap.DataTo(&tag); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding tag in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	// Sorted here rather than in the query to avoid needing a composite index
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Version != tags[j].Version {
+			return tags[i].Version > tags[j].Version
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+func (c *FirestoreClient) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	docRef := c.collection(tagsCollection).Doc(versionTagDocID(itemID, itemType, name))
+	if _, err := docRef.Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Comment Methods ---
+
+func (c *FirestoreClient) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	docRef := c.collection(commentsCollection).NewDoc()
+	comment.ID = docRef.ID
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now().UTC()
+	}
+	if _, err := docRef.Set(ctx, comment); err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating comment", "itemType", comment.ItemType, "itemID", comment.ItemID, "error", err)
+		return "", err
+	}
+	return comment.ID, nil
+}
+
+func (c *FirestoreClient) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	docSnap, err := c.collection(commentsCollection).Doc(commentID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting comment", "commentID", commentID, "error", err)
+		return nil, err
+	}
+	var comment models.Comment
+	if err := docSnap.DataTo(&comment); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding comment", "commentID", commentID, "error", err)
+		return nil, err
+	}
+	if comment.ItemID != itemID || comment.ItemType != itemType {
+		return nil, database.ErrNotFound // A comment on another item
+	}
+	comment.ID = docSnap.Ref.ID
+	return &comment, nil
+}
+
+func (c *FirestoreClient) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	query := c.collection(commentsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType)
+	if status == models.CommentApproved {
+		query = query.Where("status", "in", []string{string(status), ""}) // See models.CommentStatus.Is
+	} else if status != "" {
+		query = query.Where("status", "==", string(status))
+	}
+	comments, err := c.getComments(ctx, query)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	// Sorted and paged here rather than in the query to avoid needing a composite index
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+	return pageComments(comments, limit, offset), nil
+}
+
+func (c *FirestoreClient) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	query := c.collection(commentsCollection).Where("itemOwnerId", "==", ownerUserID)
+	if status == models.CommentApproved {
+		query = query.Where("status", "in", []string{string(status), ""}) // See models.CommentStatus.Is
+	} else if status != "" {
+		query = query.Where("status", "==", string(status))
+	}
+	comments, err := c.getComments(ctx, query)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing comments of owner", "ownerUserID", ownerUserID, "status", status, "error", err)
+		return nil, err
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return pageComments(comments, limit, offset), nil
+}
+
+func (c *FirestoreClient) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	comments, err := c.getComments(ctx, c.collection(commentsCollection).Where("userId", "==", userID))
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing comments of author", "userID", userID, "error", err)
+		return nil, err
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return comments, nil
+}
+
+// getComments runs a comment query and decodes the results.
+func (c *FirestoreClient) getComments(ctx context.Context, query firestore.Query) ([]models.Comment, error) {
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]models.Comment, 0, len(docs))
+	for _, docSnap := range docs {
+		var comment models.Comment
+		if err := docSnap.DataTo(&comment); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding comment in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		comment.ID = docSnap.Ref.ID
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// pageComments returns the page of sorted comments after offset.
+func pageComments(comments []models.Comment, limit, offset int) []models.Comment {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if offset >= len(comments) {
+		return []models.Comment{}
+	}
+	return comments[offset:min(offset+limit, len(comments))]
+}
+
+func (c *FirestoreClient) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, newStatus models.CommentStatus) error {
+	if _, err := c.GetComment(ctx, itemID, itemType, commentID); err != nil {
+		return err
+	}
+	docRef := c.collection(commentsCollection).Doc(commentID)
+	if _, err := docRef.Update(ctx, []firestore.Update{{Path: "status", Value: string(newStatus)}}); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting comment status", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	if _, err := c.GetComment(ctx, itemID, itemType, commentID); err != nil {
+		return err
+	}
+	docRef := c.collection(commentsCollection).Doc(commentID)
+	if _, err := docRef.Update(ctx, []firestore.Update{{Path: "anchor", Value: anchor}}); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting comment anchor", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	docs, err := c.collection(commentsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Update(docSnap.Ref, []firestore.Update{{Path: "itemOwnerId", Value: ownerUserID}}); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue update of comment %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+func (c *FirestoreClient) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	if _, err := c.GetComment(ctx, itemID, itemType, commentID); err != nil {
+		return err
+	}
+	if _, err := c.collection(commentsCollection).Doc(commentID).Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	docs, err := c.collection(commentsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Delete(docSnap.Ref); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of comment %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+// --- Report Methods ---
+
+func (c *FirestoreClient) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	docRef := c.collection(reportsCollection).NewDoc()
+	report.ID = docRef.ID
+	report.CreatedAt = time.Now().UTC()
+	if _, err := docRef.Set(ctx, report); err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating report", "itemType", report.ItemType, "itemID", report.ItemID, "error", err)
+		return "", err
+	}
+	return report.ID, nil
+}
+
+func (c *FirestoreClient) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	docSnap, err := c.collection(reportsCollection).Doc(reportID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting report", "reportID", reportID, "error", err)
+		return nil, err
+	}
+	var report models.Report
+	if err := docSnap.DataTo(&report); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding report", "reportID", reportID, "error", err)
+		return nil, err
+	}
+	report.ID = docSnap.Ref.ID
+	return &report, nil
+}
+
+func (c *FirestoreClient) ListReports(ctx context.Context, reportStatus models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(reportsCollection).Query
+	if reportStatus != "" {
+		query = query.Where("status", "==", string(reportStatus))
+	}
+	docs, err := query.OrderBy("createdAt", firestore.Desc).Offset(offset).Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing reports", "status", reportStatus, "error", err)
+		return nil, err
+	}
+	reports := make([]models.Report, 0, len(docs))
+	for _, docSnap := range docs {
+		var report models.Report
+		if err := docSnap.DataTo(&report); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding report in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		report.ID = docSnap.Ref.ID
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (c *FirestoreClient) ResolveReport(ctx context.Context, reportID string, newStatus models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	docRef := c.collection(reportsCollection).Doc(reportID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var report models.Report
+		if err := docSnap.DataTo(&report); err != nil {
+			return err
+		}
+		if report.Status != models.ReportOpen {
+			return database.ErrNotFound // Already resolved
+		}
+		updates := []firestore.Update{
+			{Path: "status", Value: string(newStatus)},
+			{Path: "resolvedBy", Value: resolvedBy},
+			{Path: "resolvedAt", Value: resolvedAt},
+		}
+		if note != "" {
+			updates = append(updates, firestore.Update{Path: "note", Value: note})
+		}
+		return tx.Update(docRef, updates)
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore error resolving report", "reportID", reportID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Hook Result Methods ---
+
+// hookResultDocID is the document ID of a hook result; each hook keeps one per item.
+func hookResultDocID(itemID, itemType, hook string) string {
+	return itemType + "_" + itemID + "_" + hook
+}
+
+func (c *FirestoreClient) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	docRef := c.collection(hookResultsCollection).Doc(hookResultDocID(result.ItemID, result.ItemType, result.Hook))
+	if _, err := docRef.Set(ctx, result); err != nil {
+		slog.ErrorContext(ctx, "Firestore error saving hook result", "hook", result.Hook, "itemType", result.ItemType, "itemID", result.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	docs, err := c.collection(hookResultsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	results := make([]models.HookResult, 0, len(docs))
+	for _, docSnap := range docs {
+		var result models.HookResult
+		if err := docSnap.DataTo(&result); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding hook result in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		results = append(results, result)
+	}
+	// Sorted here rather than in the query to avoid needing a composite index
+	sort.Slice(results, func(i, j int) bool { return results[i].Hook < results[j].Hook })
+	return results, nil
+}
+
+func (c *FirestoreClient) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	docs, err := c.collection(hookResultsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Delete(docSnap.Ref); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of hook result %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+// --- Bookmark Methods ---
+
+// bookmarkDocID is the document ID of a bookmark; a user bookmarks a post at most once.
+func bookmarkDocID(userID, postID string) string {
+	return userID + "_" + postID
+}
+
+func (c *FirestoreClient) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	if bookmark.CreatedAt.IsZero() {
+		bookmark.CreatedAt = time.Now().UTC()
+	}
+	docRef := c.collection(bookmarksCollection).Doc(bookmarkDocID(bookmark.UserID, bookmark.PostID))
+	if _, err := docRef.Create(ctx, bookmark); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return nil
+		}
+		slog.ErrorContext(ctx, "Firestore error bookmarking post for user", "postID", bookmark.PostID, "userID", bookmark.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	docRef := c.collection(bookmarksCollection).Doc(bookmarkDocID(userID, postID))
+	if _, err := docRef.Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting bookmark of post for user", "postID", postID, "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(bookmarksCollection).
+		Where("userId", "==", userID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(limit)
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing bookmarks of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	bookmarks := make([]models.Bookmark, 0, len(docs))
+	for _, docSnap := range docs {
+		var bookmark models.Bookmark
+		if err := docSnap.DataTo(&bookmark); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding bookmark in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks, nil
+}
+
+func (c *FirestoreClient) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	query := c.collection(bookmarksCollection).Where("postId", "==", postID)
+	result, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error counting bookmarks of post", "postID", postID, "error", err)
+		return 0, err
+	}
+	count, ok := result["count"].(*firestorepb.Value)
+	if !ok {
+		return 0, fmt.Errorf("unexpected count result %T", result["count"])
+	}
+	return count.GetIntegerValue(), nil
+}
+
+func (c *FirestoreClient) DeletePostBookmarks(ctx context.Context, postID string) error {
+	docs, err := c.collection(bookmarksCollection).Where("postId", "==", postID).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing bookmarks of post", "postID", postID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Delete(docSnap.Ref); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of bookmark %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+// --- Workspace Methods ---
+
+func (c *FirestoreClient) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	docRef := c.collection(workspacesCollection).NewDoc()
+	workspace.ID = docRef.ID
+	workspace.CreatedAt = time.Now().UTC()
+	workspace.UpdatedAt = workspace.CreatedAt
+	_, err := docRef.Set(ctx, workspace)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating workspace", "error", err)
+		return "", err
+	}
+	return workspace.ID, nil
+}
+
+func (c *FirestoreClient) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	docSnap, err := c.collection(workspacesCollection).Doc(workspaceID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	var workspace models.Workspace
+	if err := docSnap.DataTo(&workspace); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	workspace.ID = docSnap.Ref.ID
+	return &workspace, nil
+}
+
+func (c *FirestoreClient) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	docs, err := c.collection(workspacesCollection).
+		Where("userId", "==", userID).
+		OrderBy("name", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing workspaces for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	workspaces := make([]models.Workspace, 0, len(docs))
+	for _, docSnap := range docs {
+		var workspace models.Workspace
+		if err := docSnap.DataTo(&workspace); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding workspace in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		workspace.ID = docSnap.Ref.ID
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
+
+// setWorkspace moves an item into workspaceID, or back to the default workspace when empty.
+func (c *FirestoreClient) setWorkspace(ctx context.Context, collName, id, workspaceID string) error {
+	var value interface{} = firestore.Delete
+	if workspaceID != "" {
+		value = workspaceID
+	}
+	_, err := c.collection(collName).Doc(id).Update(ctx, []firestore.Update{{Path: "workspaceId", Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error moving item to workspace", "collection", collName, "itemID", id, "workspaceID", workspaceID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	return c.setWorkspace(ctx, postsCollection, postID, workspaceID)
+}
+
+func (c *FirestoreClient) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	return c.setWorkspace(ctx, codefilesCollection, fileID, workspaceID)
+}
+
+// workspaceDocs returns the user's non-trashed documents in collName that belong to
+// workspaceID. Firestore can't query for a missing field, so the default workspace
+// (and trash) is filtered on the client; offset and limit are applied afterwards.
+func (c *FirestoreClient) workspaceDocs(ctx context.Context, collName, userID, workspaceID string, limit, offset int, includeArchived bool) ([]*firestore.DocumentSnapshot, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(collName).Where("userId", "==", userID)
+	if workspaceID != "" {
+		query = query.Where("workspaceId", "==", workspaceID)
+	}
+	iter := query.OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+
+	var docs []*firestore.DocumentSnapshot
+	skipped := 0
+	for len(docs) < limit {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error iterating items in workspace", "collection", collName, "workspaceID", workspaceID, "userID", userID, "error", err)
+			return nil, err
+		}
+		data := docSnap.Data()
+		if _, trashed := data["deletedAt"]; trashed {
+			continue
+		}
+		if _, archived := data["archivedAt"]; archived && !includeArchived {
+			continue
+		}
+		if _, inWorkspace := data["workspaceId"]; workspaceID == "" && inWorkspace {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		docs = append(docs, docSnap)
+	}
+	return docs, nil
+}
+
+func (c *FirestoreClient) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	docs, err := c.workspaceDocs(ctx, postsCollection, userID, workspaceID, limit, offset, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]models.Post, 0, len(docs))
+	for _, docSnap := range docs {
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding post in workspace list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		post.ID = docSnap.Ref.ID
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (c *FirestoreClient) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	docs, err := c.workspaceDocs(ctx, codefilesCollection, userID, workspaceID, limit, offset, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]models.CodeFile, 0, len(docs))
+	for _, docSnap := range docs {
+		var file models.CodeFile
+		if err := docSnap.DataTo(&file); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding codefile in workspace list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		file.ID = docSnap.Ref.ID
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// --- Template Methods ---
+
+func (c *FirestoreClient) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	docRef := c.collection(templatesCollection).NewDoc()
+	template.ID = docRef.ID
+	template.CreatedAt = time.Now().UTC()
+	template.UpdatedAt = template.CreatedAt
+	_, err := docRef.Set(ctx, template)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating template", "error", err)
+		return "", err
+	}
+	return template.ID, nil
+}
+
+func (c *FirestoreClient) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	docSnap, err := c.collection(templatesCollection).Doc(templateID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting template", "templateID", templateID, "error", err)
+		return nil, err
+	}
+	var template models.Template
+	if err := docSnap.DataTo(&template); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding template", "templateID", templateID, "error", err)
+		return nil, err
+	}
+	template.ID = docSnap.Ref.ID
+	return &template, nil
+}
+
+func (c *FirestoreClient) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	docs, err := c.collection(templatesCollection).
+		Where("userId", "==", userID).
+		OrderBy("name", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing templates for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	templates := make([]models.Template, 0, len(docs))
+	for _, docSnap := range docs {
+		var template models.Template
+		if err := docSnap.DataTo(&template); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding template in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		template.ID = docSnap.Ref.ID
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+func (c *FirestoreClient) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	template.UpdatedAt = time.Now().UTC()
+	optional := func(value string) interface{} {
+		if value == "" {
+			return firestore.Delete // Omitted when empty, as on create
+		}
+		return value
+	}
+	_, err := c.collection(templatesCollection).Doc(template.ID).Update(ctx, []firestore.Update{
+		{Path: "name", Value: template.Name},
+		{Path: "title", Value: optional(template.Title)},
+		{Path: "fileName", Value: optional(template.FileName)},
+		{Path: "language", Value: optional(template.Language)},
+		{Path: "content", Value: template.Content},
+		{Path: "updatedAt", Value: template.UpdatedAt},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error updating template", "templateID", template.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteTemplate(ctx context.Context, templateID string) error {
+	docRef := c.collection(templatesCollection).Doc(templateID)
+	if _, err := docRef.Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting template", "templateID", templateID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Project Methods ---
+
+func (c *FirestoreClient) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	docRef := c.collection(projectsCollection).NewDoc()
+	project.ID = docRef.ID
+	project.CreatedAt = time.Now().UTC()
+	project.UpdatedAt = project.CreatedAt
+	_, err := docRef.Set(ctx, project)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating project", "error", err)
+		return "", err
+	}
+	return project.ID, nil
+}
+
+func (c *FirestoreClient) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	docSnap, err := c.collection(projectsCollection).Doc(projectID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	var project models.Project
+	if err := docSnap.DataTo(&project); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	project.ID = docSnap.Ref.ID
+	return &project, nil
+}
+
+func (c *FirestoreClient) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(projectsCollection).
+		Where("userId", "==", userID).
+		OrderBy("name", firestore.Asc).
+		Limit(limit)
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing projects for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	projects := make([]models.Project, 0, len(docs))
+	for _, docSnap := range docs {
+		var project models.Project
+		if err := docSnap.DataTo(&project); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding project in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		project.ID = docSnap.Ref.ID
+		projects = append(projects, project)
+	}
+	return projects, nil
+}
+
+func (c *FirestoreClient) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	var value interface{} = firestore.Delete // Remove from project
+	if projectID != "" {
+		value = projectID
+	}
+	_, err := c.collection(codefilesCollection).Doc(fileID).Update(ctx, []firestore.Update{
+		{Path: "projectId", Value: value},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error moving codefile to project", "fileID", fileID, "projectID", projectID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	docs, err := c.collection(codefilesCollection).
+		Where("projectId", "==", projectID).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing codefiles for project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	files := make([]models.CodeFile, 0, len(docs))
+	for _, docSnap := range docs {
+		var file models.CodeFile
+		if err := docSnap.DataTo(&file); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding codefile in project list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		if file.DeletedAt != nil {
+			continue // Trashed
+		}
+		file.ID = docSnap.Ref.ID
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// --- Asset Methods ---
+
+func (c *FirestoreClient) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	docRef := c.collection(assetsCollection).NewDoc()
+	asset.ID = docRef.ID
+	asset.CreatedAt = time.Now().UTC()
+	asset.UpdatedAt = asset.CreatedAt
+	_, err := docRef.Set(ctx, asset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating asset", "error", err)
+		return "", err
+	}
+	return asset.ID, nil
+}
+
+func (c *FirestoreClient) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	docSnap, err := c.collection(assetsCollection).Doc(assetID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error getting asset", "assetID", assetID, "error", err)
+		return nil, err
+	}
+	var asset models.Asset
+	if err := docSnap.DataTo(&asset); err != nil {
+		slog.ErrorContext(ctx, "Firestore error decoding asset", "assetID", assetID, "error", err)
+		return nil, err
+	}
+	asset.ID = docSnap.Ref.ID
+	return &asset, nil
+}
+
+func (c *FirestoreClient) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(assetsCollection).
+		Where("userId", "==", userID).
+		OrderBy("path", firestore.Asc).
+		Limit(limit)
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+	return c.listAssets(ctx, query, "userID", userID)
+}
+
+func (c *FirestoreClient) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(assetsCollection).
+		Where("projectId", "==", projectID).
+		OrderBy("path", firestore.Asc).
+		Limit(limit)
+	return c.listAssets(ctx, query, "projectID", projectID)
+}
+
+// listAssets runs an asset listing query; key and value name what it lists by, for logs.
+func (c *FirestoreClient) listAssets(ctx context.Context, query firestore.Query, key, value string) ([]models.Asset, error) {
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing assets", key, value, "error", err)
+		return nil, err
+	}
+	assets := make([]models.Asset, 0, len(docs))
+	for _, docSnap := range docs {
+		var asset models.Asset
+		if err := docSnap.DataTo(&asset); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding asset in list", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		asset.ID = docSnap.Ref.ID
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+func (c *FirestoreClient) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	docRef := c.collection(assetsCollection).Doc(asset.ID)
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return database.ErrNotFound
+			}
+			return err
+		}
+		var existing models.Asset
+		if err := docSnap.DataTo(&existing); err != nil {
+			return fmt.Errorf("failed to decode existing asset: %w", err)
+		}
+		if existing.Version != asset.Version {
+			return database.ErrVersionMismatch
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "contentType", Value: asset.ContentType},
+			{Path: "s3Path", Value: asset.S3Path},
+			{Path: "size", Value: asset.Size},
+			{Path: "contentHash", Value: asset.ContentHash},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+			{Path: "version", Value: firestore.Increment(1)},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrVersionMismatch) || errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		slog.ErrorContext(ctx, "Firestore transaction error updating asset", "assetID", asset.ID, "error", err)
+		if stat, ok := status.FromError(err); ok && (stat.Code() == codes.Aborted || stat.Code() == codes.FailedPrecondition) {
+			return database.ErrVersionMismatch
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) DeleteAsset(ctx context.Context, assetID string) error {
+	docRef := c.collection(assetsCollection).Doc(assetID)
+	if _, err := docRef.Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error deleting asset", "assetID", assetID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Trash Methods ---
+
+func (c *FirestoreClient) setDeletedAt(ctx context.Context, collName, id string, deletedAt *time.Time) error {
+	var value interface{} = firestore.Delete // Restore removes the field
+	if deletedAt != nil {
+		value = *deletedAt
+	}
+	_, err := c.collection(collName).Doc(id).Update(ctx, []firestore.Update{{Path: "deletedAt", Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting deletedAt", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, postsCollection, postID, deletedAt)
+}
+
+func (c *FirestoreClient) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, codefilesCollection, fileID, deletedAt)
+}
+
+func (c *FirestoreClient) setArchivedAt(ctx context.Context, collName, id string, archivedAt *time.Time) error {
+	var value interface{} = firestore.Delete // Unarchive removes the field
+	if archivedAt != nil {
+		value = *archivedAt
+	}
+	_, err := c.collection(collName).Doc(id).Update(ctx, []firestore.Update{{Path: "archivedAt", Value: value}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error setting archivedAt", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, postsCollection, postID, archivedAt)
+}
+
+func (c *FirestoreClient) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, codefilesCollection, fileID, archivedAt)
+}
+
+func (c *FirestoreClient) adjustRetainedBytes(ctx context.Context, collName, id string, delta int64) error {
+	_, err := c.collection(collName).Doc(id).Update(ctx, []firestore.Update{{Path: "retainedBytes", Value: firestore.Increment(delta)}})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return database.ErrNotFound
+		}
+		slog.ErrorContext(ctx, "Firestore error adjusting retained bytes", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, postsCollection, postID, delta)
+}
+
+func (c *FirestoreClient) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, codefilesCollection, fileID, delta)
+}
+
+// trashQuery builds the query shared by the ListTrashed* methods. Filtering by user
+// and deletedAt together needs a composite index on (userId, deletedAt).
+func (c *FirestoreClient) trashQuery(collName string, q database.TrashQuery) firestore.Query {
+	query := c.collection(collName).Query
+	if q.UserID != "" {
+		query = query.Where("userId", "==", q.UserID)
+	}
+	if !q.DeletedBefore.IsZero() {
+		query = query.Where("deletedAt", "<", q.DeletedBefore)
+	} else {
+		query = query.Where("deletedAt", ">", time.Time{}) // Any trashed item
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	return query.OrderBy("deletedAt", firestore.Desc).Limit(limit)
+}
+
+func (c *FirestoreClient) ListTrashedPostMeta(ctx context.Context, q database.TrashQuery) ([]models.Post, error) {
+	docs, err := c.trashQuery(postsCollection, q).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing trashed posts", "error", err)
+		return nil, err
+	}
+	posts := make([]models.Post, 0, len(docs))
+	for _, docSnap := range docs {
+		var post models.Post
+		if err := docSnap.DataTo(&post); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding trashed post", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		post.ID = docSnap.Ref.ID
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (c *FirestoreClient) ListTrashedCodeFileMeta(ctx context.Context, q database.TrashQuery) ([]models.CodeFile, error) {
+	docs, err := c.trashQuery(codefilesCollection, q).Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing trashed codefiles", "error", err)
+		return nil, err
+	}
+	files := make([]models.CodeFile, 0, len(docs))
+	for _, docSnap := range docs {
+		var file models.CodeFile
+		if err := docSnap.DataTo(&file); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding trashed codefile", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		file.ID = docSnap.Ref.ID
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// --- Item Stats Methods ---
+
+func (c *FirestoreClient) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	docRef := c.collection(statsCollection).Doc(itemType + "_" + itemID + "_" + day)
+	_, err := docRef.Set(ctx, map[string]interface{}{
+		"itemId":   itemID,
+		"itemType": itemType,
+		"day":      day,
+		"views":    firestore.Increment(views),
+		"edits":    firestore.Increment(edits),
+	}, firestore.MergeAll)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error incrementing stats", "itemType", itemType, "itemID", itemID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	iter := c.collection(statsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Where("day", ">=", fromDay).
+		Where("day", "<=", toDay).
+		OrderBy("day", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var days []models.ItemStatsDay
+	for {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error iterating stats", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+		var day models.ItemStatsDay
+		if err := docSnap.DataTo(&day); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding stats", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func (c *FirestoreClient) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	docs, err := c.collection(statsCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing stats", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Delete(docSnap.Ref); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of stats %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+// --- API Usage Methods ---
+
+func (c *FirestoreClient) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	docID := userID + "_" + day
+	if keyID != "" {
+		docID += "_" + keyID // Days counted without a key keep their IDs
+	}
+	_, err := c.collection(usageCollection).Doc(docID).Set(ctx, map[string]interface{}{
+		"userId":     userID,
+		"day":        day,
+		"keyId":      keyID,
+		"requests":   firestore.Increment(requests),
+		"wsMessages": firestore.Increment(wsMessages),
+	}, firestore.MergeAll)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error incrementing API usage", "userID", userID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	iter := c.collection(usageCollection).
+		Where("userId", "==", userID).
+		Where("day", ">=", fromDay).
+		Where("day", "<=", toDay).
+		OrderBy("day", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var days []models.UsageDay
+	for {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error iterating API usage", "userID", userID, "error", err)
+			return nil, err
+		}
+		var day models.UsageDay
+		if err := docSnap.DataTo(&day); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding API usage", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// --- Write Intent Methods ---
+
+func (c *FirestoreClient) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	docRef := c.collection(intentsCollection).NewDoc()
+	intent.ID = docRef.ID
+	intent.CreatedAt = time.Now().UTC()
+	_, err := docRef.Set(ctx, intent)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error creating write intent", "itemType", intent.ItemType, "itemID", intent.ItemID, "error", err)
+		return "", err
+	}
+	return intent.ID, nil
+}
+
+func (c *FirestoreClient) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	query := c.collection(intentsCollection).Where("createdAt", "<", createdBefore).OrderBy("createdAt", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing write intents", "error", err)
+		return nil, err
+	}
+	intents := make([]models.WriteIntent, 0, len(docs))
+	for _, docSnap := range docs {
+		var intent models.WriteIntent
+		if err := docSnap.DataTo(&intent); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding write intent", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		intent.ID = docSnap.Ref.ID
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+func (c *FirestoreClient) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	_, err := c.collection(intentsCollection).Doc(intentID).Delete(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error deleting write intent", "intentID", intentID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Journal Methods ---
+
+func (c *FirestoreClient) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	docRef := c.collection(journalCollection).Doc(entry.ItemType + "_" + entry.ItemID + "_" + strconv.Itoa(entry.Version))
+	_, err := docRef.Set(ctx, entry)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error appending journal entry", "itemType", entry.ItemType, "itemID", entry.ItemID, "version", entry.Version, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *FirestoreClient) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	query := c.collection(journalCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Where("version", ">", afterVersion).
+		OrderBy("version", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing journal", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	entries := make([]models.JournalEntry, 0, len(docs))
+	for _, docSnap := range docs {
+		var entry models.JournalEntry
+		if err := docSnap.DataTo(&entry); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding journal entry", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (c *FirestoreClient) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	docs, err := c.collection(journalCollection).
+		Where("itemId", "==", itemID).
+		Where("itemType", "==", itemType).
+		Where("version", "<", beforeVersion).
+		Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing journal", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	for _, docSnap := range docs {
+		if _, err := bw.Delete(docSnap.Ref); err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of journal entry %s: %w", docSnap.Ref.ID, err)
+		}
+	}
+	bw.End()
+	return nil
+}
+
+// --- History Methods ---
+
+func (c *FirestoreClient) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
+	docRef := c.collection(historyCollection).NewDoc()
+	if logEntry.ID != "" { // Retrying a write; Set is idempotent
+		docRef = c.collection(historyCollection).Doc(logEntry.ID)
+	}
+	logEntry.ID = docRef.ID
+	if logEntry.Timestamp.IsZero() {
+		logEntry.Timestamp = time.Now().UTC()
+	}
+
+	_, err := docRef.Set(ctx, logEntry)
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error logging action", "error", err)
+		return "", err
+	}
+	return logEntry.ID, nil
+}
+
+func (c *FirestoreClient) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	query := c.collection(historyCollection).
+		Where("ItemID", "==", itemID). // Ensure field names match struct tags
+		Where("ItemType", "==", itemType).
+		OrderBy("Timestamp", firestore.Desc).
 		Limit(limit)
 
 	iter := query.Documents(ctx)
@@ -408,13 +2906,148 @@ func (c *FirestoreClient) GetActionHistory(ctx context.Context, itemID string, i
 			break
 		}
 		if err != nil {
-			log.Printf("Firestore error iterating history for %s %s: %v", itemType, itemID, err)
+			slog.ErrorContext(ctx, "Firestore error iterating history", "itemType", itemType, "itemID", itemID, "error", err)
+			return nil, err
+		}
+
+		var logEntry models.HistoryLog
+		if err := docSnap.DataTo(&logEntry); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding history log", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		logEntry.ID = docSnap.Ref.ID
+		history = append(history, logEntry)
+	}
+	return history, nil
+}
+
+func (c *FirestoreClient) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	iter := c.collection(historyCollection).
+		Where("ItemID", "==", itemID).
+		Where("ItemType", "==", itemType).
+		Where("Timestamp", "<=", until).
+		OrderBy("Timestamp", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var history []models.HistoryLog
+	for {
+		docSnap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Firestore error iterating history", "itemType", itemType, "itemID", itemID, "error", err)
 			return nil, err
 		}
+		var logEntry models.HistoryLog
+		if err := docSnap.DataTo(&logEntry); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding history log", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		logEntry.ID = docSnap.Ref.ID
+		history = append(history, logEntry)
+	}
+	return history, nil
+}
+
+func (c *FirestoreClient) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	query := c.collection(historyCollection).
+		Where("userId", "==", userID).
+		Where("timestamp", "<=", until).
+		OrderBy("timestamp", firestore.Desc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing history of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	history := make([]models.HistoryLog, 0, len(docs))
+	for _, docSnap := range docs {
+		var logEntry models.HistoryLog
+		if err := docSnap.DataTo(&logEntry); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding history log", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		logEntry.ID = docSnap.Ref.ID
+		history = append(history, logEntry)
+	}
+	return history, nil
+}
+
+func (c *FirestoreClient) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	query := c.collection(historyCollection).
+		Where("timestamp", ">=", since).
+		OrderBy("timestamp", firestore.Desc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing recent history", "error", err)
+		return nil, err
+	}
+	history := make([]models.HistoryLog, 0, len(docs))
+	for _, docSnap := range docs {
+		var logEntry models.HistoryLog
+		if err := docSnap.DataTo(&logEntry); err != nil {
+			slog.ErrorContext(ctx, "Firestore error decoding history log", "docID", docSnap.Ref.ID, "error", err)
+			continue
+		}
+		logEntry.ID = docSnap.Ref.ID
+		history = append(history, logEntry)
+	}
+	return history, nil
+}
+
+func (c *FirestoreClient) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	docRef := c.collection(eventSeqsCollection).Doc(userID)
+	var seq int64
+	err := c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		seq = 0 // The function may be run more than once
+		docSnap, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if last, ok := docSnap.Data()["seq"].(int64); ok {
+				seq = last
+			}
+		}
+		seq++
+		return tx.Set(docRef, map[string]interface{}{"seq": seq})
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error allocating event number", "userID", userID, "error", err)
+		return 0, err
+	}
+	return seq, nil
+}
 
+func (c *FirestoreClient) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	query := c.collection(historyCollection).
+		Where("ownerId", "==", ownerID).
+		Where("eventSeq", ">", afterSeq).
+		OrderBy("eventSeq", firestore.Asc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error listing item events", "ownerID", ownerID, "error", err)
+		return nil, err
+	}
+	history := make([]models.HistoryLog, 0, len(docs))
+	for _, docSnap := range docs {
 		var logEntry models.HistoryLog
 		if err := docSnap.DataTo(&logEntry); err != nil {
-			log.Printf("Firestore error decoding history log %s: %v", docSnap.Ref.ID, err)
+			slog.ErrorContext(ctx, "Firestore error decoding history log", "docID", docSnap.Ref.ID, "error", err)
 			continue
 		}
 		logEntry.ID = docSnap.Ref.ID
@@ -424,19 +3057,97 @@ func (c *FirestoreClient) GetActionHistory(ctx context.Context, itemID string, i
 }
 
 func (c *FirestoreClient) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
-	docSnap, err := c.client.Collection(historyCollection).Doc(logID).Get(ctx)
+	docSnap, err := c.collection(historyCollection).Doc(logID).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return nil, database.ErrNotFound
 		}
-		log.Printf("Firestore error getting history log %s: %v", logID, err)
+		slog.ErrorContext(ctx, "Firestore error getting history log", "logID", logID, "error", err)
 		return nil, err
 	}
 	var logEntry models.HistoryLog
 	if err := docSnap.DataTo(&logEntry); err != nil {
-		log.Printf("Firestore error decoding history log %s: %v", logID, err)
+		slog.ErrorContext(ctx, "Firestore error decoding history log", "logID", logID, "error", err)
 		return nil, err
 	}
 	logEntry.ID = docSnap.Ref.ID
 	return &logEntry, nil
 }
+
+func (c *FirestoreClient) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	bw := c.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(logs))
+	for _, entry := range logs {
+		job, err := bw.Delete(c.collection(historyCollection).Doc(entry.ID))
+		if err != nil {
+			bw.End()
+			return fmt.Errorf("failed to queue delete of history log %s: %w", entry.ID, err)
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End() // Flushes and waits for all jobs
+
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil && status.Code(err) != codes.NotFound {
+			slog.ErrorContext(ctx, "Firestore error deleting history log", "logID", logs[i].ID, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Backup Methods ---
+
+// RestoreRecord sets the record's document, and a post's slug reservation along with it.
+func (c *FirestoreClient) RestoreRecord(ctx context.Context, record interface{}) error {
+	var collName, id string
+	switch r := record.(type) {
+	case *models.User:
+		r.ID = r.Username // Users are keyed by username
+		collName, id = usersCollection, r.Username
+	case *models.Post:
+		collName, id = postsCollection, r.ID
+	case *models.CodeFile:
+		collName, id = codefilesCollection, r.ID
+	case *models.OwnershipTransfer:
+		collName, id = transfersCollection, r.ID
+	case *models.Workspace:
+		collName, id = workspacesCollection, r.ID
+	case *models.Template:
+		collName, id = templatesCollection, r.ID
+	case *models.Project:
+		collName, id = projectsCollection, r.ID
+	case *models.Asset:
+		collName, id = assetsCollection, r.ID
+	case *models.Comment:
+		collName, id = commentsCollection, r.ID
+	case *models.Report:
+		collName, id = reportsCollection, r.ID
+	default:
+		return fmt.Errorf("cannot restore record of type %T", record)
+	}
+	if id == "" {
+		return fmt.Errorf("cannot restore %T without an ID", record)
+	}
+
+	docRef := c.collection(collName).Doc(id)
+	var err error
+	if post, ok := record.(*models.Post); ok && post.Slug != "" {
+		err = c.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			if err := tx.Set(c.slugRef(post.UserID, post.Slug), map[string]interface{}{"postId": post.ID}); err != nil {
+				return err
+			}
+			return tx.Set(docRef, post)
+		})
+	} else {
+		_, err = docRef.Set(ctx, record)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Firestore error restoring record", "collection", collName, "id", id, "error", err)
+		return err
+	}
+	return nil
+}
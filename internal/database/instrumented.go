@@ -0,0 +1,1024 @@
+// internal/database/instrumented.go
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"github.com/kkuzar/blog_system/internal/models"
+	"time"
+)
+
+// Instrument wraps db so the latency and failures of every call are recorded in the
+// metrics registry, labelled with backend (the configured DB_TYPE) and the method called.
+// ErrNotFound results are expected outcomes and don't count as failures.
+func Instrument(db DBAdapter, backend string) DBAdapter {
+	return &instrumentedAdapter{db: db, backend: backend}
+}
+
+type instrumentedAdapter struct {
+	db      DBAdapter
+	backend string
+}
+
+func (a *instrumentedAdapter) observe(operation string, start time.Time, err error) {
+	metrics.ObserveCall("database", a.backend, operation, start, err != nil && !errors.Is(err, ErrNotFound))
+}
+
+func (a *instrumentedAdapter) Close(ctx context.Context) error {
+	return a.db.Close(ctx)
+}
+
+func (a *instrumentedAdapter) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	start := time.Now()
+	user, err := a.db.GetUserByUsername(ctx, username)
+	a.observe("GetUserByUsername", start, err)
+	return user, err
+}
+
+func (a *instrumentedAdapter) CreateUser(ctx context.Context, user *models.User) error {
+	start := time.Now()
+	err := a.db.CreateUser(ctx, user)
+	a.observe("CreateUser", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	start := time.Now()
+	err := a.db.AdjustUserStorage(ctx, userID, delta)
+	a.observe("AdjustUserStorage", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	start := time.Now()
+	err := a.db.SetUserPasswordHash(ctx, userID, passwordHash)
+	a.observe("SetUserPasswordHash", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	start := time.Now()
+	err := a.db.SetUserSiteTheme(ctx, userID, theme)
+	a.observe("SetUserSiteTheme", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	start := time.Now()
+	err := a.db.SetUserTimezone(ctx, userID, timezone)
+	a.observe("SetUserTimezone", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetUserEmail(ctx context.Context, userID, email string) error {
+	start := time.Now()
+	err := a.db.SetUserEmail(ctx, userID, email)
+	a.observe("SetUserEmail", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	start := time.Now()
+	err := a.db.SetUserMuted(ctx, userID, types)
+	a.observe("SetUserMuted", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListUserIDs(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	ids, err := a.db.ListUserIDs(ctx)
+	a.observe("ListUserIDs", start, err)
+	return ids, err
+}
+
+func (a *instrumentedAdapter) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreatePostMeta(ctx, post)
+	a.observe("CreatePostMeta", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
+	start := time.Now()
+	post, err := a.db.GetPostMetaByID(ctx, postID)
+	a.observe("GetPostMetaByID", start, err)
+	return post, err
+}
+
+func (a *instrumentedAdapter) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	start := time.Now()
+	post, err := a.db.GetPostMetaBySlug(ctx, userID, slug)
+	a.observe("GetPostMetaBySlug", start, err)
+	return post, err
+}
+
+func (a *instrumentedAdapter) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	start := time.Now()
+	posts, err := a.db.ListPostMetaByUser(ctx, userID, limit, offset, includeArchived)
+	a.observe("ListPostMetaByUser", start, err)
+	return posts, err
+}
+
+func (a *instrumentedAdapter) UpdatePostMeta(ctx context.Context, post *models.Post) error {
+	start := time.Now()
+	err := a.db.UpdatePostMeta(ctx, post)
+	a.observe("UpdatePostMeta", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostSlug(ctx context.Context, postID, slug string) error {
+	start := time.Now()
+	err := a.db.SetPostSlug(ctx, postID, slug)
+	a.observe("SetPostSlug", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeletePostMeta(ctx context.Context, postID string) error {
+	start := time.Now()
+	err := a.db.DeletePostMeta(ctx, postID)
+	a.observe("DeletePostMeta", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	start := time.Now()
+	err := a.db.SetPostPublished(ctx, postID, version, publishedAt, excerpt)
+	a.observe("SetPostPublished", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostUnpublished(ctx context.Context, postID string) error {
+	start := time.Now()
+	err := a.db.SetPostUnpublished(ctx, postID)
+	a.observe("SetPostUnpublished", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	start := time.Now()
+	err := a.db.SetPostExcerpt(ctx, postID, excerpt, manual)
+	a.observe("SetPostExcerpt", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	start := time.Now()
+	err := a.db.SetPostSEO(ctx, postID, canonicalURL, metaDescription, noIndex)
+	a.observe("SetPostSEO", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	start := time.Now()
+	err := a.db.SetPostCoverImage(ctx, postID, assetID)
+	a.observe("SetPostCoverImage", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	start := time.Now()
+	err := a.db.SetPostCoAuthors(ctx, postID, coAuthors)
+	a.observe("SetPostCoAuthors", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	start := time.Now()
+	err := a.db.SetPostLanguage(ctx, postID, language, translationOf)
+	a.observe("SetPostLanguage", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	start := time.Now()
+	err := a.db.SetPostSchedule(ctx, postID, scheduledAt, version)
+	a.observe("SetPostSchedule", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	start := time.Now()
+	posts, err := a.db.ListDuePosts(ctx, before, limit)
+	a.observe("ListDuePosts", start, err)
+	return posts, err
+}
+
+func (a *instrumentedAdapter) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	start := time.Now()
+	err := a.db.SetPostTakenDown(ctx, postID, takenDownAt)
+	a.observe("SetPostTakenDown", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	start := time.Now()
+	posts, err := a.db.ListPostTranslations(ctx, userID, postID)
+	a.observe("ListPostTranslations", start, err)
+	return posts, err
+}
+
+func (a *instrumentedAdapter) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	start := time.Now()
+	err := a.db.PutSlugRedirect(ctx, redirect)
+	a.observe("PutSlugRedirect", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	start := time.Now()
+	redirect, err := a.db.GetSlugRedirect(ctx, userID, slug)
+	a.observe("GetSlugRedirect", start, err)
+	return redirect, err
+}
+
+func (a *instrumentedAdapter) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	start := time.Now()
+	redirects, err := a.db.ListSlugRedirectsByUser(ctx, userID)
+	a.observe("ListSlugRedirectsByUser", start, err)
+	return redirects, err
+}
+
+func (a *instrumentedAdapter) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	start := time.Now()
+	err := a.db.DeleteSlugRedirect(ctx, userID, slug)
+	a.observe("DeleteSlugRedirect", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	start := time.Now()
+	err := a.db.CreateDomain(ctx, domain)
+	a.observe("CreateDomain", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	start := time.Now()
+	domain, err := a.db.GetDomain(ctx, host)
+	a.observe("GetDomain", start, err)
+	return domain, err
+}
+
+func (a *instrumentedAdapter) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	start := time.Now()
+	domains, err := a.db.ListDomainsByUser(ctx, userID)
+	a.observe("ListDomainsByUser", start, err)
+	return domains, err
+}
+
+func (a *instrumentedAdapter) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	start := time.Now()
+	domains, err := a.db.ListVerifiedDomains(ctx)
+	a.observe("ListVerifiedDomains", start, err)
+	return domains, err
+}
+
+func (a *instrumentedAdapter) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	start := time.Now()
+	err := a.db.SetDomainVerified(ctx, host, verifiedAt)
+	a.observe("SetDomainVerified", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteDomain(ctx context.Context, host string) error {
+	start := time.Now()
+	err := a.db.DeleteDomain(ctx, host)
+	a.observe("DeleteDomain", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	start := time.Now()
+	err := a.db.PutPushSubscription(ctx, sub)
+	a.observe("PutPushSubscription", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	start := time.Now()
+	pushSubscriptions, err := a.db.ListPushSubscriptions(ctx, userID)
+	a.observe("ListPushSubscriptions", start, err)
+	return pushSubscriptions, err
+}
+
+func (a *instrumentedAdapter) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	start := time.Now()
+	err := a.db.DeletePushSubscription(ctx, subscriptionID)
+	a.observe("DeletePushSubscription", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateCodeFileMeta(ctx, file)
+	a.observe("CreateCodeFileMeta", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	start := time.Now()
+	codeFile, err := a.db.GetCodeFileMetaByID(ctx, fileID)
+	a.observe("GetCodeFileMetaByID", start, err)
+	return codeFile, err
+}
+
+func (a *instrumentedAdapter) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	start := time.Now()
+	codeFiles, err := a.db.ListCodeFileMetaByUser(ctx, userID, limit, offset, includeArchived)
+	a.observe("ListCodeFileMetaByUser", start, err)
+	return codeFiles, err
+}
+
+func (a *instrumentedAdapter) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	start := time.Now()
+	err := a.db.UpdateCodeFileMeta(ctx, file)
+	a.observe("UpdateCodeFileMeta", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	start := time.Now()
+	err := a.db.RenameCodeFile(ctx, fileID, fileName, path, language)
+	a.observe("RenameCodeFile", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	start := time.Now()
+	err := a.db.DeleteCodeFileMeta(ctx, fileID)
+	a.observe("DeleteCodeFileMeta", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateTransfer(ctx, transfer)
+	a.observe("CreateTransfer", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	start := time.Now()
+	ownershipTransfer, err := a.db.GetTransferByID(ctx, transferID)
+	a.observe("GetTransferByID", start, err)
+	return ownershipTransfer, err
+}
+
+func (a *instrumentedAdapter) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	start := time.Now()
+	ownershipTransfers, err := a.db.ListPendingTransfersByRecipient(ctx, toUserID)
+	a.observe("ListPendingTransfersByRecipient", start, err)
+	return ownershipTransfers, err
+}
+
+func (a *instrumentedAdapter) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	start := time.Now()
+	transfers, err := a.db.ListTransfersByUser(ctx, userID)
+	a.observe("ListTransfersByUser", start, err)
+	return transfers, err
+}
+
+func (a *instrumentedAdapter) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	start := time.Now()
+	err := a.db.ResolveTransfer(ctx, transferID, status, resolvedAt)
+	a.observe("ResolveTransfer", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ReopenTransfer(ctx context.Context, transferID string) error {
+	start := time.Now()
+	err := a.db.ReopenTransfer(ctx, transferID)
+	a.observe("ReopenTransfer", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	start := time.Now()
+	err := a.db.SetPostOwner(ctx, postID, userID, s3Path)
+	a.observe("SetPostOwner", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	start := time.Now()
+	err := a.db.SetCodeFileOwner(ctx, fileID, userID, s3Path)
+	a.observe("SetCodeFileOwner", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	start := time.Now()
+	err := a.db.PutCollaborator(ctx, collab)
+	a.observe("PutCollaborator", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	start := time.Now()
+	collaborator, err := a.db.GetCollaborator(ctx, itemID, itemType, userID)
+	a.observe("GetCollaborator", start, err)
+	return collaborator, err
+}
+
+func (a *instrumentedAdapter) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	start := time.Now()
+	collaborators, err := a.db.ListCollaborators(ctx, itemID, itemType)
+	a.observe("ListCollaborators", start, err)
+	return collaborators, err
+}
+
+func (a *instrumentedAdapter) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	start := time.Now()
+	err := a.db.DeleteCollaborator(ctx, itemID, itemType, userID)
+	a.observe("DeleteCollaborator", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	start := time.Now()
+	err := a.db.CreateVersionTag(ctx, tag)
+	a.observe("CreateVersionTag", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	start := time.Now()
+	versionTag, err := a.db.GetVersionTag(ctx, itemID, itemType, name)
+	a.observe("GetVersionTag", start, err)
+	return versionTag, err
+}
+
+func (a *instrumentedAdapter) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	start := time.Now()
+	versionTags, err := a.db.ListVersionTags(ctx, itemID, itemType)
+	a.observe("ListVersionTags", start, err)
+	return versionTags, err
+}
+
+func (a *instrumentedAdapter) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	start := time.Now()
+	err := a.db.DeleteVersionTag(ctx, itemID, itemType, name)
+	a.observe("DeleteVersionTag", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	start := time.Now()
+	commentID, err := a.db.CreateComment(ctx, comment)
+	a.observe("CreateComment", start, err)
+	return commentID, err
+}
+
+func (a *instrumentedAdapter) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	start := time.Now()
+	comment, err := a.db.GetComment(ctx, itemID, itemType, commentID)
+	a.observe("GetComment", start, err)
+	return comment, err
+}
+
+func (a *instrumentedAdapter) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	start := time.Now()
+	comments, err := a.db.ListComments(ctx, itemID, itemType, status, limit, offset)
+	a.observe("ListComments", start, err)
+	return comments, err
+}
+
+func (a *instrumentedAdapter) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	start := time.Now()
+	comments, err := a.db.ListCommentsByOwner(ctx, ownerUserID, status, limit, offset)
+	a.observe("ListCommentsByOwner", start, err)
+	return comments, err
+}
+
+func (a *instrumentedAdapter) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	start := time.Now()
+	comments, err := a.db.ListCommentsByAuthor(ctx, userID)
+	a.observe("ListCommentsByAuthor", start, err)
+	return comments, err
+}
+
+func (a *instrumentedAdapter) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	start := time.Now()
+	err := a.db.SetCommentStatus(ctx, itemID, itemType, commentID, status)
+	a.observe("SetCommentStatus", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	start := time.Now()
+	err := a.db.SetCommentAnchor(ctx, itemID, itemType, commentID, anchor)
+	a.observe("SetCommentAnchor", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	start := time.Now()
+	err := a.db.SetCommentsOwner(ctx, itemID, itemType, ownerUserID)
+	a.observe("SetCommentsOwner", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	start := time.Now()
+	err := a.db.DeleteComment(ctx, itemID, itemType, commentID)
+	a.observe("DeleteComment", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	start := time.Now()
+	err := a.db.DeleteComments(ctx, itemID, itemType)
+	a.observe("DeleteComments", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	start := time.Now()
+	reportID, err := a.db.CreateReport(ctx, report)
+	a.observe("CreateReport", start, err)
+	return reportID, err
+}
+
+func (a *instrumentedAdapter) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	start := time.Now()
+	report, err := a.db.GetReport(ctx, reportID)
+	a.observe("GetReport", start, err)
+	return report, err
+}
+
+func (a *instrumentedAdapter) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	start := time.Now()
+	reports, err := a.db.ListReports(ctx, status, limit, offset)
+	a.observe("ListReports", start, err)
+	return reports, err
+}
+
+func (a *instrumentedAdapter) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	start := time.Now()
+	err := a.db.ResolveReport(ctx, reportID, status, resolvedBy, note, resolvedAt)
+	a.observe("ResolveReport", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	start := time.Now()
+	err := a.db.SaveHookResult(ctx, result)
+	a.observe("SaveHookResult", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	start := time.Now()
+	hookResults, err := a.db.ListHookResults(ctx, itemID, itemType)
+	a.observe("ListHookResults", start, err)
+	return hookResults, err
+}
+
+func (a *instrumentedAdapter) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	start := time.Now()
+	err := a.db.DeleteHookResults(ctx, itemID, itemType)
+	a.observe("DeleteHookResults", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	start := time.Now()
+	err := a.db.AddBookmark(ctx, bookmark)
+	a.observe("AddBookmark", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	start := time.Now()
+	err := a.db.DeleteBookmark(ctx, userID, postID)
+	a.observe("DeleteBookmark", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	start := time.Now()
+	bookmarks, err := a.db.ListBookmarksByUser(ctx, userID, limit, offset)
+	a.observe("ListBookmarksByUser", start, err)
+	return bookmarks, err
+}
+
+func (a *instrumentedAdapter) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	start := time.Now()
+	count, err := a.db.CountPostBookmarks(ctx, postID)
+	a.observe("CountPostBookmarks", start, err)
+	return count, err
+}
+
+func (a *instrumentedAdapter) DeletePostBookmarks(ctx context.Context, postID string) error {
+	start := time.Now()
+	err := a.db.DeletePostBookmarks(ctx, postID)
+	a.observe("DeletePostBookmarks", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateWorkspace(ctx, workspace)
+	a.observe("CreateWorkspace", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	start := time.Now()
+	workspace, err := a.db.GetWorkspaceByID(ctx, workspaceID)
+	a.observe("GetWorkspaceByID", start, err)
+	return workspace, err
+}
+
+func (a *instrumentedAdapter) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	start := time.Now()
+	workspaces, err := a.db.ListWorkspacesByUser(ctx, userID)
+	a.observe("ListWorkspacesByUser", start, err)
+	return workspaces, err
+}
+
+func (a *instrumentedAdapter) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	start := time.Now()
+	err := a.db.SetPostWorkspace(ctx, postID, workspaceID)
+	a.observe("SetPostWorkspace", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	start := time.Now()
+	err := a.db.SetCodeFileWorkspace(ctx, fileID, workspaceID)
+	a.observe("SetCodeFileWorkspace", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	start := time.Now()
+	posts, err := a.db.ListPostMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+	a.observe("ListPostMetaByWorkspace", start, err)
+	return posts, err
+}
+
+func (a *instrumentedAdapter) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	start := time.Now()
+	codeFiles, err := a.db.ListCodeFileMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+	a.observe("ListCodeFileMetaByWorkspace", start, err)
+	return codeFiles, err
+}
+
+func (a *instrumentedAdapter) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateTemplate(ctx, template)
+	a.observe("CreateTemplate", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	start := time.Now()
+	template, err := a.db.GetTemplateByID(ctx, templateID)
+	a.observe("GetTemplateByID", start, err)
+	return template, err
+}
+
+func (a *instrumentedAdapter) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	start := time.Now()
+	templates, err := a.db.ListTemplatesByUser(ctx, userID)
+	a.observe("ListTemplatesByUser", start, err)
+	return templates, err
+}
+
+func (a *instrumentedAdapter) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	start := time.Now()
+	err := a.db.UpdateTemplate(ctx, template)
+	a.observe("UpdateTemplate", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteTemplate(ctx context.Context, templateID string) error {
+	start := time.Now()
+	err := a.db.DeleteTemplate(ctx, templateID)
+	a.observe("DeleteTemplate", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateProject(ctx, project)
+	a.observe("CreateProject", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	start := time.Now()
+	project, err := a.db.GetProjectByID(ctx, projectID)
+	a.observe("GetProjectByID", start, err)
+	return project, err
+}
+
+func (a *instrumentedAdapter) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	start := time.Now()
+	projects, err := a.db.ListProjectsByUser(ctx, userID, limit, offset)
+	a.observe("ListProjectsByUser", start, err)
+	return projects, err
+}
+
+func (a *instrumentedAdapter) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	start := time.Now()
+	err := a.db.SetCodeFileProject(ctx, fileID, projectID)
+	a.observe("SetCodeFileProject", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	start := time.Now()
+	codeFiles, err := a.db.ListCodeFileMetaByProject(ctx, projectID, limit)
+	a.observe("ListCodeFileMetaByProject", start, err)
+	return codeFiles, err
+}
+
+func (a *instrumentedAdapter) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateAsset(ctx, asset)
+	a.observe("CreateAsset", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	start := time.Now()
+	asset, err := a.db.GetAssetByID(ctx, assetID)
+	a.observe("GetAssetByID", start, err)
+	return asset, err
+}
+
+func (a *instrumentedAdapter) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	start := time.Now()
+	assets, err := a.db.ListAssetsByUser(ctx, userID, limit, offset)
+	a.observe("ListAssetsByUser", start, err)
+	return assets, err
+}
+
+func (a *instrumentedAdapter) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	start := time.Now()
+	assets, err := a.db.ListAssetsByProject(ctx, projectID, limit)
+	a.observe("ListAssetsByProject", start, err)
+	return assets, err
+}
+
+func (a *instrumentedAdapter) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	start := time.Now()
+	err := a.db.UpdateAsset(ctx, asset)
+	a.observe("UpdateAsset", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) DeleteAsset(ctx context.Context, assetID string) error {
+	start := time.Now()
+	err := a.db.DeleteAsset(ctx, assetID)
+	a.observe("DeleteAsset", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	start := time.Now()
+	err := a.db.SetPostDeletedAt(ctx, postID, deletedAt)
+	a.observe("SetPostDeletedAt", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	start := time.Now()
+	err := a.db.SetCodeFileDeletedAt(ctx, fileID, deletedAt)
+	a.observe("SetCodeFileDeletedAt", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListTrashedPostMeta(ctx context.Context, q TrashQuery) ([]models.Post, error) {
+	start := time.Now()
+	posts, err := a.db.ListTrashedPostMeta(ctx, q)
+	a.observe("ListTrashedPostMeta", start, err)
+	return posts, err
+}
+
+func (a *instrumentedAdapter) ListTrashedCodeFileMeta(ctx context.Context, q TrashQuery) ([]models.CodeFile, error) {
+	start := time.Now()
+	codeFiles, err := a.db.ListTrashedCodeFileMeta(ctx, q)
+	a.observe("ListTrashedCodeFileMeta", start, err)
+	return codeFiles, err
+}
+
+func (a *instrumentedAdapter) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	start := time.Now()
+	err := a.db.SetPostArchivedAt(ctx, postID, archivedAt)
+	a.observe("SetPostArchivedAt", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	start := time.Now()
+	err := a.db.SetCodeFileArchivedAt(ctx, fileID, archivedAt)
+	a.observe("SetCodeFileArchivedAt", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	start := time.Now()
+	err := a.db.AdjustPostRetainedBytes(ctx, postID, delta)
+	a.observe("AdjustPostRetainedBytes", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	start := time.Now()
+	err := a.db.AdjustCodeFileRetainedBytes(ctx, fileID, delta)
+	a.observe("AdjustCodeFileRetainedBytes", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	start := time.Now()
+	err := a.db.CreateShareLink(ctx, link)
+	a.observe("CreateShareLink", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	start := time.Now()
+	link, err := a.db.GetShareLink(ctx, linkID)
+	a.observe("GetShareLink", start, err)
+	return link, err
+}
+
+func (a *instrumentedAdapter) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	start := time.Now()
+	links, err := a.db.ListShareLinksByUser(ctx, userID)
+	a.observe("ListShareLinksByUser", start, err)
+	return links, err
+}
+
+func (a *instrumentedAdapter) DeleteShareLink(ctx context.Context, linkID string) error {
+	start := time.Now()
+	err := a.db.DeleteShareLink(ctx, linkID)
+	a.observe("DeleteShareLink", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	start := time.Now()
+	err := a.db.SetPostPinned(ctx, postID, pinned)
+	a.observe("SetPostPinned", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) SetPostRank(ctx context.Context, postID string, rank int) error {
+	start := time.Now()
+	err := a.db.SetPostRank(ctx, postID, rank)
+	a.observe("SetPostRank", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	start := time.Now()
+	err := a.db.IncrementItemStats(ctx, itemID, itemType, day, views, edits)
+	a.observe("IncrementItemStats", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	start := time.Now()
+	itemStatsDays, err := a.db.ListItemStats(ctx, itemID, itemType, fromDay, toDay)
+	a.observe("ListItemStats", start, err)
+	return itemStatsDays, err
+}
+
+func (a *instrumentedAdapter) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	start := time.Now()
+	err := a.db.DeleteItemStats(ctx, itemID, itemType)
+	a.observe("DeleteItemStats", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	start := time.Now()
+	err := a.db.IncrementUsage(ctx, userID, keyID, day, requests, wsMessages)
+	a.observe("IncrementUsage", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	start := time.Now()
+	days, err := a.db.ListUsage(ctx, userID, fromDay, toDay)
+	a.observe("ListUsage", start, err)
+	return days, err
+}
+
+func (a *instrumentedAdapter) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	start := time.Now()
+	id, err := a.db.CreateWriteIntent(ctx, intent)
+	a.observe("CreateWriteIntent", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	start := time.Now()
+	writeIntents, err := a.db.ListWriteIntents(ctx, createdBefore, limit)
+	a.observe("ListWriteIntents", start, err)
+	return writeIntents, err
+}
+
+func (a *instrumentedAdapter) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	start := time.Now()
+	err := a.db.DeleteWriteIntent(ctx, intentID)
+	a.observe("DeleteWriteIntent", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	start := time.Now()
+	err := a.db.AppendJournal(ctx, entry)
+	a.observe("AppendJournal", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	start := time.Now()
+	journalEntries, err := a.db.ListJournal(ctx, itemID, itemType, afterVersion, limit)
+	a.observe("ListJournal", start, err)
+	return journalEntries, err
+}
+
+func (a *instrumentedAdapter) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	start := time.Now()
+	err := a.db.DeleteJournal(ctx, itemID, itemType, beforeVersion)
+	a.observe("DeleteJournal", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) LogAction(ctx context.Context, log *models.HistoryLog) (string, error) {
+	start := time.Now()
+	id, err := a.db.LogAction(ctx, log)
+	a.observe("LogAction", start, err)
+	return id, err
+}
+
+func (a *instrumentedAdapter) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	start := time.Now()
+	historyLogs, err := a.db.GetActionHistory(ctx, itemID, itemType, limit)
+	a.observe("GetActionHistory", start, err)
+	return historyLogs, err
+}
+
+func (a *instrumentedAdapter) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	start := time.Now()
+	historyLogs, err := a.db.GetActionHistoryUntil(ctx, itemID, itemType, until, limit)
+	a.observe("GetActionHistoryUntil", start, err)
+	return historyLogs, err
+}
+
+func (a *instrumentedAdapter) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	start := time.Now()
+	history, err := a.db.ListHistoryByUser(ctx, userID, until, limit)
+	a.observe("ListHistoryByUser", start, err)
+	return history, err
+}
+
+func (a *instrumentedAdapter) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	start := time.Now()
+	historyLogs, err := a.db.ListRecentHistory(ctx, since, limit)
+	a.observe("ListRecentHistory", start, err)
+	return historyLogs, err
+}
+
+func (a *instrumentedAdapter) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	start := time.Now()
+	seq, err := a.db.NextEventSeq(ctx, userID)
+	a.observe("NextEventSeq", start, err)
+	return seq, err
+}
+
+func (a *instrumentedAdapter) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	start := time.Now()
+	historyLogs, err := a.db.ListHistoryEvents(ctx, ownerID, afterSeq, limit)
+	a.observe("ListHistoryEvents", start, err)
+	return historyLogs, err
+}
+
+func (a *instrumentedAdapter) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
+	start := time.Now()
+	historyLog, err := a.db.GetHistoryLogByID(ctx, logID)
+	a.observe("GetHistoryLogByID", start, err)
+	return historyLog, err
+}
+
+func (a *instrumentedAdapter) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	start := time.Now()
+	err := a.db.DeleteHistoryLogs(ctx, logs)
+	a.observe("DeleteHistoryLogs", start, err)
+	return err
+}
+
+func (a *instrumentedAdapter) RestoreRecord(ctx context.Context, record interface{}) error {
+	start := time.Now()
+	err := a.db.RestoreRecord(ctx, record)
+	a.observe("RestoreRecord", start, err)
+	return err
+}
@@ -0,0 +1,1951 @@
+// internal/database/memory/client.go
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryDB keeps all data in process memory, so it is lost on restart. It behaves like
+// the MongoDB adapter (ordering, uniqueness, optimistic concurrency) and is meant for
+// development and tests, not production.
+type MemoryDB struct {
+	mu            sync.RWMutex
+	users         map[string]models.User // Keyed by username
+	posts         map[string]models.Post
+	codeFiles     map[string]models.CodeFile
+	transfers     map[string]models.OwnershipTransfer
+	collaborators map[string]models.Collaborator // Keyed by itemType:itemID:userID
+	tags          map[string]models.VersionTag   // Keyed by itemType:itemID:name
+	comments      map[string]models.Comment      // Keyed by itemType:itemID:commentID
+	reports       map[string]models.Report
+	hookResults   map[string]models.HookResult   // Keyed by itemType:itemID:hook
+	bookmarks     map[string]models.Bookmark     // Keyed by userID:postID
+	redirects     map[string]models.SlugRedirect // Keyed by userID:slug
+	domains       map[string]models.Domain       // Keyed by host
+	subscriptions map[string]models.PushSubscription
+	shareLinks    map[string]models.ShareLink
+	workspaces    map[string]models.Workspace
+	templates     map[string]models.Template
+	projects      map[string]models.Project
+	assets        map[string]models.Asset
+	stats         map[string]itemStats // Keyed by itemType:itemID:day
+	usage         map[string]userUsage // Keyed by userID:day
+	intents       map[string]models.WriteIntent
+	journal       map[string]models.JournalEntry // Keyed by itemType:itemID:version
+	history       map[string]models.HistoryLog
+	eventSeqs     map[string]int64 // Last EventSeq of each user
+}
+
+type itemStats struct {
+	itemID   string
+	itemType string
+	day      models.ItemStatsDay
+}
+
+type userUsage struct {
+	userID string
+	day    models.UsageDay
+}
+
+// NewMemoryDB creates an empty in-memory database.
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:         make(map[string]models.User),
+		posts:         make(map[string]models.Post),
+		codeFiles:     make(map[string]models.CodeFile),
+		transfers:     make(map[string]models.OwnershipTransfer),
+		collaborators: make(map[string]models.Collaborator),
+		tags:          make(map[string]models.VersionTag),
+		comments:      make(map[string]models.Comment),
+		reports:       make(map[string]models.Report),
+		hookResults:   make(map[string]models.HookResult),
+		bookmarks:     make(map[string]models.Bookmark),
+		redirects:     make(map[string]models.SlugRedirect),
+		domains:       make(map[string]models.Domain),
+		subscriptions: make(map[string]models.PushSubscription),
+		shareLinks:    make(map[string]models.ShareLink),
+		workspaces:    make(map[string]models.Workspace),
+		templates:     make(map[string]models.Template),
+		projects:      make(map[string]models.Project),
+		assets:        make(map[string]models.Asset),
+		stats:         make(map[string]itemStats),
+		usage:         make(map[string]userUsage),
+		intents:       make(map[string]models.WriteIntent),
+		journal:       make(map[string]models.JournalEntry),
+		history:       make(map[string]models.HistoryLog),
+		eventSeqs:     make(map[string]int64),
+	}
+}
+
+// ForTenant returns an empty database for the tenant. The tenant router keeps it for the
+// life of the process.
+func (m *MemoryDB) ForTenant(ctx context.Context, tenantID string) (database.DBAdapter, error) {
+	return NewMemoryDB(), nil
+}
+
+func (m *MemoryDB) Close(ctx context.Context) error {
+	return nil
+}
+
+// newID returns an ID for a new record.
+func newID() string {
+	return uuid.NewString()
+}
+
+// page applies offset and limit (0 for no limit) to a sorted listing.
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// Records are copied in and out, so callers can't change stored data behind the lock.
+
+func clonePost(p models.Post) models.Post {
+	p.Tags = slices.Clone(p.Tags)
+	p.CoAuthors = slices.Clone(p.CoAuthors)
+	return p
+}
+
+func cloneHistoryLog(l models.HistoryLog) models.HistoryLog {
+	if l.ChangeData != nil {
+		change := *l.ChangeData
+		l.ChangeData = &change
+	}
+	l.CoAuthorsBefore = slices.Clone(l.CoAuthorsBefore)
+	l.CoAuthorsAfter = slices.Clone(l.CoAuthorsAfter)
+	return l
+}
+
+// --- User Methods ---
+
+func (m *MemoryDB) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[username]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *MemoryDB) CreateUser(ctx context.Context, user *models.User) error {
+	if user.Username == "" {
+		return errors.New("username cannot be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.Username]; ok {
+		return database.ErrDuplicateUser
+	}
+	user.CreatedAt = time.Now().UTC()
+	m.users[user.Username] = models.User{
+		ID:           user.Username, // The username is the ID
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		CreatedAt:    user.CreatedAt,
+	}
+	return nil
+}
+
+func (m *MemoryDB) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.StorageBytes += delta
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.SiteTheme = theme
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.Timezone = timezone
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) SetUserEmail(ctx context.Context, userID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.Email = email
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.MutedNotifications = append([]string(nil), types...)
+	m.users[userID] = user
+	return nil
+}
+
+func (m *MemoryDB) ListUserIDs(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	userIDs := make([]string, 0, len(m.users))
+	for id := range m.users {
+		userIDs = append(userIDs, id)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+// --- Post Methods ---
+
+// slugTaken reports whether another of the user's posts, trashed ones included, uses slug.
+func (m *MemoryDB) slugTaken(userID, slug, exceptID string) bool {
+	if slug == "" {
+		return false
+	}
+	for id, post := range m.posts {
+		if id != exceptID && post.UserID == userID && post.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// listed reports whether an item belongs in its owner's default listings.
+func listed(userID string, deletedAt, archivedAt *time.Time, wantUserID string, includeArchived bool) bool {
+	return userID == wantUserID && deletedAt == nil && (includeArchived || archivedAt == nil)
+}
+
+func (m *MemoryDB) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.slugTaken(post.UserID, post.Slug, "") {
+		return "", database.ErrDuplicateSlug
+	}
+	post.ID = newID()
+	post.CreatedAt = time.Now().UTC()
+	post.UpdatedAt = post.CreatedAt
+	post.Version = 1 // Initial version
+	m.posts[post.ID] = clonePost(*post)
+	return post.ID, nil
+}
+
+func (m *MemoryDB) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	post, ok := m.posts[postID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	post = clonePost(post)
+	return &post, nil
+}
+
+func (m *MemoryDB) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, post := range m.posts {
+		if post.UserID == userID && post.Slug == slug {
+			post = clonePost(post)
+			return &post, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+func (m *MemoryDB) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var posts []models.Post
+	for _, post := range m.posts {
+		if listed(post.UserID, post.DeletedAt, post.ArchivedAt, userID, includeArchived) {
+			posts = append(posts, clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { // Placed posts first, then newest first
+		a, b := posts[i], posts[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	return page(posts, limit, offset), nil
+}
+
+func (m *MemoryDB) UpdatePostMeta(ctx context.Context, post *models.Post) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.posts[post.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if stored.Version != post.Version { // OCC check
+		return database.ErrVersionMismatch
+	}
+	stored.Title = post.Title
+	stored.UpdatedAt = time.Now().UTC()
+	stored.S3Path = post.S3Path
+	stored.Size = post.Size
+	stored.ContentHash = post.ContentHash
+	stored.WordCount = post.WordCount
+	stored.ReadingTimeMinutes = post.ReadingTimeMinutes
+	stored.Tags = slices.Clone(post.Tags)
+	stored.Date = post.Date
+	stored.Draft = post.Draft
+	stored.Version++
+	m.posts[post.ID] = stored
+	return nil
+}
+
+func (m *MemoryDB) DeletePostMeta(ctx context.Context, postID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.posts[postID]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.posts, postID)
+	return nil
+}
+
+// updatePost applies update to a stored post, returning ErrNotFound if it is missing.
+func (m *MemoryDB) updatePost(postID string, update func(post *models.Post) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	post, ok := m.posts[postID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if err := update(&post); err != nil {
+		return err
+	}
+	m.posts[postID] = post
+	return nil
+}
+
+func (m *MemoryDB) SetPostSlug(ctx context.Context, postID, slug string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		if m.slugTaken(post.UserID, slug, postID) {
+			return database.ErrDuplicateSlug
+		}
+		post.Slug = slug
+		post.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.PublishedVersion = version
+		post.PublishedAt = &publishedAt
+		post.Excerpt = excerpt
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostUnpublished(ctx context.Context, postID string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.PublishedVersion = 0
+		post.PublishedAt = nil
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.Excerpt = excerpt
+		post.ExcerptManual = manual
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.CanonicalURL = canonicalURL
+		post.MetaDescription = metaDescription
+		post.NoIndex = noIndex
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.CoverImage = assetID
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.CoAuthors = slices.Clone(coAuthors)
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.Language = language
+		post.TranslationOf = translationOf
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.ScheduledAt, post.ScheduledVersion = nil, version
+		if scheduledAt != nil {
+			at := *scheduledAt
+			post.ScheduledAt = &at
+		}
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.TakenDownAt = nil
+		if takenDownAt != nil {
+			at := *takenDownAt
+			post.TakenDownAt = &at
+		}
+		return nil
+	})
+}
+
+func (m *MemoryDB) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var posts []models.Post
+	for _, post := range m.posts {
+		if post.UserID == userID && post.TranslationOf == postID {
+			posts = append(posts, clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.Before(posts[j].CreatedAt) })
+	return posts, nil
+}
+
+func (m *MemoryDB) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var posts []models.Post
+	for _, post := range m.posts {
+		if post.ScheduledAt != nil && !post.ScheduledAt.After(before) {
+			posts = append(posts, clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ScheduledAt.Before(*posts[j].ScheduledAt) })
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+// --- Slug Redirect Methods ---
+
+func (m *MemoryDB) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if redirect.CreatedAt.IsZero() {
+		redirect.CreatedAt = time.Now().UTC()
+	}
+	m.redirects[redirect.UserID+":"+redirect.Slug] = *redirect
+	return nil
+}
+
+func (m *MemoryDB) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	redirect, ok := m.redirects[userID+":"+slug]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &redirect, nil
+}
+
+func (m *MemoryDB) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var redirects []models.SlugRedirect
+	for _, redirect := range m.redirects {
+		if redirect.UserID == userID {
+			redirects = append(redirects, redirect)
+		}
+	}
+	sort.Slice(redirects, func(i, j int) bool { return redirects[i].CreatedAt.Before(redirects[j].CreatedAt) })
+	return redirects, nil
+}
+
+func (m *MemoryDB) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.redirects, userID+":"+slug)
+	return nil
+}
+
+// --- Domain Methods ---
+
+func (m *MemoryDB) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.domains[domain.Host]; ok {
+		return database.ErrDuplicateDomain
+	}
+	if domain.CreatedAt.IsZero() {
+		domain.CreatedAt = time.Now().UTC()
+	}
+	m.domains[domain.Host] = *domain
+	return nil
+}
+
+func (m *MemoryDB) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	domain, ok := m.domains[host]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &domain, nil
+}
+
+func (m *MemoryDB) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var domains []models.Domain
+	for _, domain := range m.domains {
+		if domain.UserID == userID {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (m *MemoryDB) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var domains []models.Domain
+	for _, domain := range m.domains {
+		if domain.VerifiedAt != nil {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+	return domains, nil
+}
+
+func (m *MemoryDB) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	domain, ok := m.domains[host]
+	if !ok {
+		return database.ErrNotFound
+	}
+	domain.VerifiedAt = nil
+	if !verifiedAt.IsZero() {
+		domain.VerifiedAt = &verifiedAt
+	}
+	m.domains[host] = domain
+	return nil
+}
+
+func (m *MemoryDB) DeleteDomain(ctx context.Context, host string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.domains, host)
+	return nil
+}
+
+// --- Push Subscription Methods ---
+
+func (m *MemoryDB) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+	m.subscriptions[sub.ID] = *sub
+	return nil
+}
+
+func (m *MemoryDB) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var subs []models.PushSubscription
+	for _, sub := range m.subscriptions {
+		if sub.UserID == userID {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (m *MemoryDB) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscriptions, subscriptionID)
+	return nil
+}
+
+// --- Share Link Methods ---
+
+func (m *MemoryDB) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	m.shareLinks[link.LinkID] = *link
+	return nil
+}
+
+func (m *MemoryDB) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	link, ok := m.shareLinks[linkID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &link, nil
+}
+
+func (m *MemoryDB) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var links []models.ShareLink
+	for _, link := range m.shareLinks {
+		if link.UserID == userID {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.Before(links[j].CreatedAt) })
+	return links, nil
+}
+
+func (m *MemoryDB) DeleteShareLink(ctx context.Context, linkID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.shareLinks, linkID)
+	return nil
+}
+
+func (m *MemoryDB) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.Pinned = pinned
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetPostRank(ctx context.Context, postID string, rank int) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.Rank = rank
+		return nil
+	})
+}
+
+// --- CodeFile Methods ---
+
+func (m *MemoryDB) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file.ID = newID()
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.Version = 1
+	m.codeFiles[file.ID] = *file
+	return file.ID, nil
+}
+
+func (m *MemoryDB) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	file, ok := m.codeFiles[fileID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &file, nil
+}
+
+// sortNewestFirst orders code files by creation time, newest first.
+func sortNewestFirst(files []models.CodeFile) {
+	sort.Slice(files, func(i, j int) bool { return files[i].CreatedAt.After(files[j].CreatedAt) })
+}
+
+func (m *MemoryDB) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.CodeFile
+	for _, file := range m.codeFiles {
+		if listed(file.UserID, file.DeletedAt, file.ArchivedAt, userID, includeArchived) {
+			files = append(files, file)
+		}
+	}
+	sortNewestFirst(files)
+	return page(files, limit, offset), nil
+}
+
+func (m *MemoryDB) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.codeFiles[file.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if stored.Version != file.Version {
+		return database.ErrVersionMismatch
+	}
+	stored.Language = file.Language
+	stored.UpdatedAt = time.Now().UTC()
+	stored.S3Path = file.S3Path
+	stored.Size = file.Size
+	stored.ContentHash = file.ContentHash
+	stored.Version++
+	m.codeFiles[file.ID] = stored
+	return nil
+}
+
+func (m *MemoryDB) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.codeFiles[fileID]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.codeFiles, fileID)
+	return nil
+}
+
+// updateCodeFile applies update to a stored code file, returning ErrNotFound if it is
+// missing.
+func (m *MemoryDB) updateCodeFile(fileID string, update func(file *models.CodeFile)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.codeFiles[fileID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	update(&file)
+	m.codeFiles[fileID] = file
+	return nil
+}
+
+func (m *MemoryDB) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.FileName = fileName
+		file.Path = path
+		file.Language = language
+		file.UpdatedAt = time.Now().UTC()
+	})
+}
+
+// --- Ownership Transfer Methods ---
+
+func (m *MemoryDB) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfer.ID = newID()
+	transfer.CreatedAt = time.Now().UTC()
+	m.transfers[transfer.ID] = *transfer
+	return transfer.ID, nil
+}
+
+func (m *MemoryDB) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	transfer, ok := m.transfers[transferID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &transfer, nil
+}
+
+func (m *MemoryDB) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var transfers []models.OwnershipTransfer
+	for _, transfer := range m.transfers {
+		if transfer.ToUserID == toUserID && transfer.Status == models.TransferPending {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt.After(transfers[j].CreatedAt) })
+	return transfers, nil
+}
+
+func (m *MemoryDB) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var transfers []models.OwnershipTransfer
+	for _, transfer := range m.transfers {
+		if transfer.FromUserID == userID || transfer.ToUserID == userID {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt.After(transfers[j].CreatedAt) })
+	return transfers, nil
+}
+
+func (m *MemoryDB) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfer, ok := m.transfers[transferID]
+	if !ok || transfer.Status != models.TransferPending {
+		return database.ErrNotFound // Missing or no longer pending
+	}
+	transfer.Status = status
+	transfer.ResolvedAt = &resolvedAt
+	m.transfers[transferID] = transfer
+	return nil
+}
+
+func (m *MemoryDB) ReopenTransfer(ctx context.Context, transferID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	transfer, ok := m.transfers[transferID]
+	if !ok || transfer.Status != models.TransferAccepted {
+		return database.ErrNotFound
+	}
+	transfer.Status = models.TransferPending
+	transfer.ResolvedAt = nil
+	m.transfers[transferID] = transfer
+	return nil
+}
+
+// SetPostOwner hands a post to userID. Its workspace belongs to the previous owner, so it
+// lands in the new owner's default workspace.
+func (m *MemoryDB) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		if m.slugTaken(userID, post.Slug, postID) {
+			return database.ErrDuplicateSlug // The new owner has a post with this slug
+		}
+		post.UserID = userID
+		post.S3Path = s3Path
+		post.UpdatedAt = time.Now().UTC()
+		post.WorkspaceID = ""
+		return nil
+	})
+}
+
+// SetCodeFileOwner hands a code file to userID, outside any workspace or project of the
+// previous owner.
+func (m *MemoryDB) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.UserID = userID
+		file.S3Path = s3Path
+		file.UpdatedAt = time.Now().UTC()
+		file.WorkspaceID = ""
+		file.ProjectID = ""
+	})
+}
+
+// --- Collaborator Methods ---
+
+// itemKey keys a record that belongs to an item, e.g. one collaborator or tag of it.
+func itemKey(itemID, itemType, name string) string {
+	return itemType + ":" + itemID + ":" + name
+}
+
+func (m *MemoryDB) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if collab.CreatedAt.IsZero() {
+		collab.CreatedAt = time.Now().UTC()
+	}
+	m.collaborators[itemKey(collab.ItemID, collab.ItemType, collab.UserID)] = *collab
+	return nil
+}
+
+func (m *MemoryDB) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	collab, ok := m.collaborators[itemKey(itemID, itemType, userID)]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &collab, nil
+}
+
+func (m *MemoryDB) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var collabs []models.Collaborator
+	for _, collab := range m.collaborators {
+		if collab.ItemID == itemID && collab.ItemType == itemType {
+			collabs = append(collabs, collab)
+		}
+	}
+	sort.Slice(collabs, func(i, j int) bool { return collabs[i].CreatedAt.Before(collabs[j].CreatedAt) })
+	return collabs, nil
+}
+
+func (m *MemoryDB) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, userID)
+	if _, ok := m.collaborators[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.collaborators, key)
+	return nil
+}
+
+// --- Version Tag Methods ---
+
+func (m *MemoryDB) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(tag.ItemID, tag.ItemType, tag.Name)
+	if _, ok := m.tags[key]; ok {
+		return database.ErrDuplicateTag
+	}
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = time.Now().UTC()
+	}
+	m.tags[key] = *tag
+	return nil
+}
+
+func (m *MemoryDB) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tag, ok := m.tags[itemKey(itemID, itemType, name)]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &tag, nil
+}
+
+func (m *MemoryDB) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var tags []models.VersionTag
+	for _, tag := range m.tags {
+		if tag.ItemID == itemID && tag.ItemType == itemType {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { // Newest version first
+		if tags[i].Version != tags[j].Version {
+			return tags[i].Version > tags[j].Version
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+func (m *MemoryDB) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, name)
+	if _, ok := m.tags[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.tags, key)
+	return nil
+}
+
+// --- Comment Methods ---
+
+func (m *MemoryDB) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	comment.ID = newID()
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now().UTC()
+	}
+	m.comments[itemKey(comment.ItemID, comment.ItemType, comment.ID)] = cloneComment(*comment)
+	return comment.ID, nil
+}
+
+func (m *MemoryDB) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	comment, ok := m.comments[itemKey(itemID, itemType, commentID)]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	comment = cloneComment(comment)
+	return &comment, nil
+}
+
+func (m *MemoryDB) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var comments []models.Comment
+	for _, comment := range m.comments {
+		if comment.ItemID == itemID && comment.ItemType == itemType && comment.Status.Is(status) {
+			comments = append(comments, cloneComment(comment))
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+	return page(comments, limit, offset), nil
+}
+
+func (m *MemoryDB) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var comments []models.Comment
+	for _, comment := range m.comments {
+		if comment.ItemOwnerID == ownerUserID && comment.Status.Is(status) {
+			comments = append(comments, cloneComment(comment))
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return page(comments, limit, offset), nil
+}
+
+func (m *MemoryDB) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var comments []models.Comment
+	for _, comment := range m.comments {
+		if comment.UserID == userID {
+			comments = append(comments, cloneComment(comment))
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	return comments, nil
+}
+
+func (m *MemoryDB) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, commentID)
+	comment, ok := m.comments[key]
+	if !ok {
+		return database.ErrNotFound
+	}
+	comment.Status = status
+	m.comments[key] = comment
+	return nil
+}
+
+func (m *MemoryDB) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, commentID)
+	comment, ok := m.comments[key]
+	if !ok {
+		return database.ErrNotFound
+	}
+	comment.Anchor = anchor
+	m.comments[key] = cloneComment(comment)
+	return nil
+}
+
+func (m *MemoryDB) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, comment := range m.comments {
+		if comment.ItemID == itemID && comment.ItemType == itemType {
+			comment.ItemOwnerID = ownerUserID
+			m.comments[key] = comment
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, commentID)
+	if _, ok := m.comments[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.comments, key)
+	return nil
+}
+
+func (m *MemoryDB) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, comment := range m.comments {
+		if comment.ItemID == itemID && comment.ItemType == itemType {
+			delete(m.comments, key)
+		}
+	}
+	return nil
+}
+
+// cloneComment copies a comment so callers can't modify the stored one's mentions.
+func cloneComment(comment models.Comment) models.Comment {
+	comment.Mentions = slices.Clone(comment.Mentions)
+	if comment.Anchor != nil {
+		anchor := *comment.Anchor
+		comment.Anchor = &anchor
+	}
+	return comment
+}
+
+// --- Report Methods ---
+
+func (m *MemoryDB) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report.ID = newID()
+	report.CreatedAt = time.Now().UTC()
+	m.reports[report.ID] = *report
+	return report.ID, nil
+}
+
+func (m *MemoryDB) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	report, ok := m.reports[reportID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &report, nil
+}
+
+func (m *MemoryDB) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var reports []models.Report
+	for _, report := range m.reports {
+		if status == "" || report.Status == status {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CreatedAt.After(reports[j].CreatedAt) })
+	return page(reports, limit, offset), nil
+}
+
+func (m *MemoryDB) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report, ok := m.reports[reportID]
+	if !ok || report.Status != models.ReportOpen {
+		return database.ErrNotFound // Missing or already resolved
+	}
+	report.Status = status
+	report.ResolvedBy = resolvedBy
+	report.ResolvedAt = &resolvedAt
+	report.Note = note
+	m.reports[reportID] = report
+	return nil
+}
+
+// --- Hook Result Methods ---
+
+func (m *MemoryDB) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *result
+	stored.Findings = slices.Clone(result.Findings)
+	m.hookResults[itemKey(result.ItemID, result.ItemType, result.Hook)] = stored
+	return nil
+}
+
+func (m *MemoryDB) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var results []models.HookResult
+	for _, result := range m.hookResults {
+		if result.ItemID == itemID && result.ItemType == itemType {
+			result.Findings = slices.Clone(result.Findings)
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Hook < results[j].Hook })
+	return results, nil
+}
+
+func (m *MemoryDB) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, result := range m.hookResults {
+		if result.ItemID == itemID && result.ItemType == itemType {
+			delete(m.hookResults, key)
+		}
+	}
+	return nil
+}
+
+// --- Bookmark Methods ---
+
+func (m *MemoryDB) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bookmark.CreatedAt.IsZero() {
+		bookmark.CreatedAt = time.Now().UTC()
+	}
+	key := bookmark.UserID + ":" + bookmark.PostID
+	if _, ok := m.bookmarks[key]; !ok { // Keep the original bookmark time
+		m.bookmarks[key] = *bookmark
+	}
+	return nil
+}
+
+func (m *MemoryDB) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := userID + ":" + postID
+	if _, ok := m.bookmarks[key]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.bookmarks, key)
+	return nil
+}
+
+func (m *MemoryDB) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var bookmarks []models.Bookmark
+	for _, bookmark := range m.bookmarks {
+		if bookmark.UserID == userID {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].CreatedAt.After(bookmarks[j].CreatedAt) })
+	return page(bookmarks, limit, offset), nil
+}
+
+func (m *MemoryDB) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var count int64
+	for _, bookmark := range m.bookmarks {
+		if bookmark.PostID == postID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryDB) DeletePostBookmarks(ctx context.Context, postID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, bookmark := range m.bookmarks {
+		if bookmark.PostID == postID {
+			delete(m.bookmarks, key)
+		}
+	}
+	return nil
+}
+
+// --- Workspace Methods ---
+
+func (m *MemoryDB) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workspace.ID = newID()
+	workspace.CreatedAt = time.Now().UTC()
+	workspace.UpdatedAt = workspace.CreatedAt
+	m.workspaces[workspace.ID] = *workspace
+	return workspace.ID, nil
+}
+
+func (m *MemoryDB) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	workspace, ok := m.workspaces[workspaceID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &workspace, nil
+}
+
+func (m *MemoryDB) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var workspaces []models.Workspace
+	for _, workspace := range m.workspaces {
+		if workspace.UserID == userID {
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces, nil
+}
+
+func (m *MemoryDB) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.WorkspaceID = workspaceID
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.WorkspaceID = workspaceID
+	})
+}
+
+func (m *MemoryDB) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var posts []models.Post
+	for _, post := range m.posts {
+		if post.WorkspaceID == workspaceID && listed(post.UserID, post.DeletedAt, post.ArchivedAt, userID, includeArchived) {
+			posts = append(posts, clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.After(posts[j].CreatedAt) })
+	return page(posts, limit, offset), nil
+}
+
+func (m *MemoryDB) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.CodeFile
+	for _, file := range m.codeFiles {
+		if file.WorkspaceID == workspaceID && listed(file.UserID, file.DeletedAt, file.ArchivedAt, userID, includeArchived) {
+			files = append(files, file)
+		}
+	}
+	sortNewestFirst(files)
+	return page(files, limit, offset), nil
+}
+
+// --- Template Methods ---
+
+func (m *MemoryDB) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template.ID = newID()
+	template.CreatedAt = time.Now().UTC()
+	template.UpdatedAt = template.CreatedAt
+	m.templates[template.ID] = *template
+	return template.ID, nil
+}
+
+func (m *MemoryDB) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	template, ok := m.templates[templateID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &template, nil
+}
+
+func (m *MemoryDB) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var templates []models.Template
+	for _, template := range m.templates {
+		if template.UserID == userID {
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (m *MemoryDB) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.templates[template.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	template.UpdatedAt = time.Now().UTC()
+	stored.Name = template.Name
+	stored.Title = template.Title
+	stored.FileName = template.FileName
+	stored.Language = template.Language
+	stored.Content = template.Content
+	stored.UpdatedAt = template.UpdatedAt
+	m.templates[template.ID] = stored
+	return nil
+}
+
+func (m *MemoryDB) DeleteTemplate(ctx context.Context, templateID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.templates[templateID]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.templates, templateID)
+	return nil
+}
+
+// --- Project Methods ---
+
+func (m *MemoryDB) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	project.ID = newID()
+	project.CreatedAt = time.Now().UTC()
+	project.UpdatedAt = project.CreatedAt
+	m.projects[project.ID] = *project
+	return project.ID, nil
+}
+
+func (m *MemoryDB) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	project, ok := m.projects[projectID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &project, nil
+}
+
+func (m *MemoryDB) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var projects []models.Project
+	for _, project := range m.projects {
+		if project.UserID == userID {
+			projects = append(projects, project)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	return page(projects, limit, offset), nil
+}
+
+func (m *MemoryDB) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.ProjectID = projectID
+		file.UpdatedAt = time.Now().UTC()
+	})
+}
+
+func (m *MemoryDB) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.CodeFile
+	for _, file := range m.codeFiles {
+		if file.ProjectID == projectID && file.DeletedAt == nil {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return page(files, limit, 0), nil
+}
+
+// --- Asset Methods ---
+
+func (m *MemoryDB) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	asset.ID = newID()
+	asset.CreatedAt = time.Now().UTC()
+	asset.UpdatedAt = asset.CreatedAt
+	m.assets[asset.ID] = *asset
+	return asset.ID, nil
+}
+
+func (m *MemoryDB) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	asset, ok := m.assets[assetID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &asset, nil
+}
+
+func (m *MemoryDB) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var assets []models.Asset
+	for _, asset := range m.assets {
+		if asset.UserID == userID {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+	return page(assets, limit, offset), nil
+}
+
+func (m *MemoryDB) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var assets []models.Asset
+	for _, asset := range m.assets {
+		if asset.ProjectID == projectID {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Path < assets[j].Path })
+	return page(assets, limit, 0), nil
+}
+
+func (m *MemoryDB) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.assets[asset.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if stored.Version != asset.Version {
+		return database.ErrVersionMismatch
+	}
+	stored.ContentType = asset.ContentType
+	stored.S3Path = asset.S3Path
+	stored.Size = asset.Size
+	stored.ContentHash = asset.ContentHash
+	stored.UpdatedAt = time.Now().UTC()
+	stored.Version++
+	m.assets[asset.ID] = stored
+	return nil
+}
+
+func (m *MemoryDB) DeleteAsset(ctx context.Context, assetID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.assets[assetID]; !ok {
+		return database.ErrNotFound
+	}
+	delete(m.assets, assetID)
+	return nil
+}
+
+// --- Trash Methods ---
+
+func (m *MemoryDB) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.DeletedAt = deletedAt // nil restores
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.DeletedAt = deletedAt
+	})
+}
+
+func (m *MemoryDB) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.ArchivedAt = archivedAt // nil unarchives
+		return nil
+	})
+}
+
+func (m *MemoryDB) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.ArchivedAt = archivedAt
+	})
+}
+
+func (m *MemoryDB) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	return m.updatePost(postID, func(post *models.Post) error {
+		post.RetainedBytes += delta
+		return nil
+	})
+}
+
+func (m *MemoryDB) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	return m.updateCodeFile(fileID, func(file *models.CodeFile) {
+		file.RetainedBytes += delta
+	})
+}
+
+// trashed reports whether an item is in the trash and selected by q.
+func trashed(userID string, deletedAt *time.Time, q database.TrashQuery) bool {
+	if deletedAt == nil || (q.UserID != "" && userID != q.UserID) {
+		return false
+	}
+	return q.DeletedBefore.IsZero() || deletedAt.Before(q.DeletedBefore)
+}
+
+func (m *MemoryDB) ListTrashedPostMeta(ctx context.Context, q database.TrashQuery) ([]models.Post, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var posts []models.Post
+	for _, post := range m.posts {
+		if trashed(post.UserID, post.DeletedAt, q) {
+			posts = append(posts, clonePost(post))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].DeletedAt.After(*posts[j].DeletedAt) }) // Most recently deleted first
+	return page(posts, q.Limit, 0), nil
+}
+
+func (m *MemoryDB) ListTrashedCodeFileMeta(ctx context.Context, q database.TrashQuery) ([]models.CodeFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var files []models.CodeFile
+	for _, file := range m.codeFiles {
+		if trashed(file.UserID, file.DeletedAt, q) {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].DeletedAt.After(*files[j].DeletedAt) })
+	return page(files, q.Limit, 0), nil
+}
+
+// --- Item Stats Methods ---
+
+func (m *MemoryDB) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := itemKey(itemID, itemType, day)
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = itemStats{itemID: itemID, itemType: itemType, day: models.ItemStatsDay{Day: day}}
+	}
+	stats.day.Views += views
+	stats.day.Edits += edits
+	m.stats[key] = stats
+	return nil
+}
+
+func (m *MemoryDB) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var days []models.ItemStatsDay
+	for _, stats := range m.stats {
+		if stats.itemID == itemID && stats.itemType == itemType && stats.day.Day >= fromDay && stats.day.Day <= toDay {
+			days = append(days, stats.day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+func (m *MemoryDB) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, stats := range m.stats {
+		if stats.itemID == itemID && stats.itemType == itemType {
+			delete(m.stats, key)
+		}
+	}
+	return nil
+}
+
+// --- API Usage Methods ---
+
+func (m *MemoryDB) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := userID + ":" + day + ":" + keyID
+	usage, ok := m.usage[key]
+	if !ok {
+		usage = userUsage{userID: userID, day: models.UsageDay{Day: day, KeyID: keyID}}
+	}
+	usage.day.Requests += requests
+	usage.day.WSMessages += wsMessages
+	m.usage[key] = usage
+	return nil
+}
+
+func (m *MemoryDB) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var days []models.UsageDay
+	for _, usage := range m.usage {
+		if usage.userID == userID && usage.day.Day >= fromDay && usage.day.Day <= toDay {
+			days = append(days, usage.day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Day != days[j].Day {
+			return days[i].Day < days[j].Day
+		}
+		return days[i].KeyID < days[j].KeyID
+	})
+	return days, nil
+}
+
+// --- Write Intent Methods ---
+
+func (m *MemoryDB) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intent.ID = newID()
+	intent.CreatedAt = time.Now().UTC()
+	stored := *intent
+	stored.Changes = slices.Clone(intent.Changes)
+	m.intents[intent.ID] = stored
+	return intent.ID, nil
+}
+
+func (m *MemoryDB) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var intents []models.WriteIntent
+	for _, intent := range m.intents {
+		if intent.CreatedAt.Before(createdBefore) {
+			intent.Changes = slices.Clone(intent.Changes)
+			intents = append(intents, intent)
+		}
+	}
+	sort.Slice(intents, func(i, j int) bool { return intents[i].CreatedAt.Before(intents[j].CreatedAt) }) // Oldest first
+	return page(intents, limit, 0), nil
+}
+
+func (m *MemoryDB) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.intents, intentID)
+	return nil
+}
+
+// --- Journal Methods ---
+
+func (m *MemoryDB) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *entry
+	stored.Changes = slices.Clone(entry.Changes)
+	m.journal[itemKey(entry.ItemID, entry.ItemType, strconv.Itoa(entry.Version))] = stored
+	return nil
+}
+
+func (m *MemoryDB) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var entries []models.JournalEntry
+	for _, entry := range m.journal {
+		if entry.ItemID == itemID && entry.ItemType == itemType && entry.Version > afterVersion {
+			entry.Changes = slices.Clone(entry.Changes)
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Version < entries[j].Version })
+	return page(entries, limit, 0), nil
+}
+
+func (m *MemoryDB) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, entry := range m.journal {
+		if entry.ItemID == itemID && entry.ItemType == itemType && entry.Version < beforeVersion {
+			delete(m.journal, key)
+		}
+	}
+	return nil
+}
+
+// --- History Methods ---
+
+func (m *MemoryDB) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if logEntry.ID == "" { // Set when retrying a write
+		logEntry.ID = newID()
+	} else if _, ok := m.history[logEntry.ID]; ok {
+		return logEntry.ID, nil // An earlier attempt got through
+	}
+	if logEntry.Timestamp.IsZero() {
+		logEntry.Timestamp = time.Now().UTC()
+	}
+	m.history[logEntry.ID] = cloneHistoryLog(*logEntry)
+	return logEntry.ID, nil
+}
+
+func (m *MemoryDB) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var history []models.HistoryLog
+	for _, entry := range m.history {
+		if entry.ItemID == itemID && entry.ItemType == itemType {
+			history = append(history, cloneHistoryLog(entry))
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Timestamp.After(history[j].Timestamp) }) // Newest first
+	return page(history, limit, 0), nil
+}
+
+func (m *MemoryDB) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var history []models.HistoryLog
+	for _, entry := range m.history {
+		if entry.ItemID == itemID && entry.ItemType == itemType && !entry.Timestamp.After(until) {
+			history = append(history, cloneHistoryLog(entry))
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Timestamp.After(history[j].Timestamp) }) // Newest first
+	return page(history, limit, 0), nil
+}
+
+func (m *MemoryDB) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var history []models.HistoryLog
+	for _, entry := range m.history {
+		if entry.UserID == userID && !entry.Timestamp.After(until) {
+			history = append(history, cloneHistoryLog(entry))
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Timestamp.After(history[j].Timestamp) }) // Newest first
+	return page(history, limit, 0), nil
+}
+
+func (m *MemoryDB) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var history []models.HistoryLog
+	for _, entry := range m.history {
+		if !entry.Timestamp.Before(since) {
+			history = append(history, cloneHistoryLog(entry))
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Timestamp.After(history[j].Timestamp) }) // Newest first
+	return page(history, limit, 0), nil
+}
+
+func (m *MemoryDB) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventSeqs[userID]++
+	return m.eventSeqs[userID], nil
+}
+
+func (m *MemoryDB) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var history []models.HistoryLog
+	for _, entry := range m.history {
+		if entry.OwnerID == ownerID && entry.EventSeq > afterSeq {
+			history = append(history, cloneHistoryLog(entry))
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].EventSeq < history[j].EventSeq })
+	return page(history, limit, 0), nil
+}
+
+func (m *MemoryDB) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.history[logID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	entry = cloneHistoryLog(entry)
+	return &entry, nil
+}
+
+func (m *MemoryDB) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range logs {
+		delete(m.history, entry.ID)
+	}
+	return nil
+}
+
+// --- Backup Methods ---
+
+func (m *MemoryDB) RestoreRecord(ctx context.Context, record interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch r := record.(type) {
+	case *models.User:
+		if r.Username == "" {
+			return errors.New("username cannot be empty")
+		}
+		r.ID = r.Username // The username is the ID
+		m.users[r.Username] = *r
+		return nil
+	case *models.Post:
+		if r.ID == "" {
+			break
+		}
+		if m.slugTaken(r.UserID, r.Slug, r.ID) {
+			return database.ErrDuplicateSlug
+		}
+		m.posts[r.ID] = clonePost(*r)
+		return nil
+	case *models.CodeFile:
+		if r.ID == "" {
+			break
+		}
+		m.codeFiles[r.ID] = *r
+		return nil
+	case *models.OwnershipTransfer:
+		if r.ID == "" {
+			break
+		}
+		m.transfers[r.ID] = *r
+		return nil
+	case *models.Workspace:
+		if r.ID == "" {
+			break
+		}
+		m.workspaces[r.ID] = *r
+		return nil
+	case *models.Template:
+		if r.ID == "" {
+			break
+		}
+		m.templates[r.ID] = *r
+		return nil
+	case *models.Project:
+		if r.ID == "" {
+			break
+		}
+		m.projects[r.ID] = *r
+		return nil
+	case *models.Asset:
+		if r.ID == "" {
+			break
+		}
+		m.assets[r.ID] = *r
+		return nil
+	case *models.Comment:
+		if r.ID == "" {
+			break
+		}
+		m.comments[itemKey(r.ItemID, r.ItemType, r.ID)] = cloneComment(*r)
+		return nil
+	case *models.Report:
+		if r.ID == "" {
+			break
+		}
+		m.reports[r.ID] = *r
+		return nil
+	default:
+		return fmt.Errorf("cannot restore record of type %T", record)
+	}
+	return fmt.Errorf("cannot restore %T without an ID", record)
+}
@@ -6,7 +6,8 @@ import (
 	"fmt"
 	"github.com/kkuzar/blog_system/internal/database"
 	"github.com/kkuzar/blog_system/internal/models"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,17 +18,38 @@ import (
 )
 
 const (
-	connectTimeout         = 10 * time.Second
-	serverSelectionTimeout = 10 * time.Second
-	usersCollection        = "users"
-	postsCollection        = "posts"
-	codefilesCollection    = "codefiles"
-	historyCollection      = "history"
+	connectTimeout          = 10 * time.Second
+	serverSelectionTimeout  = 10 * time.Second
+	usersCollection         = "users"
+	postsCollection         = "posts"
+	codefilesCollection     = "codefiles"
+	projectsCollection      = "projects"
+	workspacesCollection    = "workspaces"
+	collaboratorsCollection = "collaborators"
+	transfersCollection     = "transfers"
+	tagsCollection          = "version_tags"   // Keyed by itemType:itemID:name
+	hookResultsCollection   = "hook_results"   // Keyed by itemType:itemID:hook
+	bookmarksCollection     = "bookmarks"      // Keyed by userID:postID
+	redirectsCollection     = "slug_redirects" // Keyed by userID:slug
+	domainsCollection       = "domains"        // Keyed by host
+	templatesCollection     = "templates"
+	assetsCollection        = "assets"
+	statsCollection         = "item_stats" // Daily view/edit rollups, keyed by itemType:itemID:day
+	usageCollection         = "api_usage"  // Daily request/message rollups, keyed by userID:day
+	intentsCollection       = "write_intents"
+	journalCollection       = "change_journal" // Keyed by itemType:itemID:version
+	historyCollection       = "history"
+	eventSeqsCollection     = "event_seqs" // Last EventSeq of each user, keyed by userID
+	pushCollection          = "push_subscriptions"
+	shareLinksCollection    = "share_links" // Keyed by link ID
+	commentsCollection      = "comments"
+	reportsCollection       = "reports"
 )
 
 type MongoClient struct {
 	client *mongo.Client
 	db     *mongo.Database
+	shared bool // Made by ForTenant; the connection belongs to another client
 }
 
 // NewMongoClient creates a new MongoDB client and establishes connection.
@@ -58,12 +80,14 @@ func NewMongoClient(ctx context.Context, uri, dbName string) (*MongoClient, erro
 		return nil, fmt.Errorf("failed to ping mongodb: %w", err)
 	}
 
-	log.Println("Successfully connected and pinged MongoDB.")
+	slog.InfoContext(ctx, "Successfully connected and pinged MongoDB")
 
 	db := client.Database(dbName)
 
 	// Optional: Create indexes here if they don't exist
-	// createIndexes(ctx, db)
+	if err := ensureIndexes(ctx, db); err != nil {
+		slog.WarnContext(ctx, "Failed to create MongoDB indexes", "error", err)
+	}
 
 	return &MongoClient{
 		client: client,
@@ -71,10 +95,114 @@ func NewMongoClient(ctx context.Context, uri, dbName string) (*MongoClient, erro
 	}, nil
 }
 
+// ensureIndexes creates the indexes that enforce uniqueness constraints. Creating an
+// index that already exists is a no-op.
+func ensureIndexes(ctx context.Context, db *mongo.Database) error {
+	// A user's posts can't share a slug; posts without one are exempt
+	_, err := db.Collection(postsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "slug", Value: 1}},
+		Options: options.Index().SetName("userId_slug_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create post slug index: %w", err)
+	}
+	_, err = db.Collection(statsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "itemType", Value: 1}, {Key: "day", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create item stats index: %w", err)
+	}
+	_, err = db.Collection(usageCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "day", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API usage index: %w", err)
+	}
+	_, err = db.Collection(intentsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create write intent index: %w", err)
+	}
+	_, err = db.Collection(journalCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "itemType", Value: 1}, {Key: "version", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create change journal index: %w", err)
+	}
+	_, err = db.Collection(domainsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create domain index: %w", err)
+	}
+	_, err = db.Collection(pushCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create push subscription index: %w", err)
+	}
+	_, err = db.Collection(shareLinksCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create share link index: %w", err)
+	}
+	_, err = db.Collection(commentsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "itemType", Value: 1}, {Key: "createdAt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create comment index: %w", err)
+	}
+	_, err = db.Collection(commentsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "itemOwnerId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create comment moderation index: %w", err)
+	}
+	_, err = db.Collection(commentsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create comment author index: %w", err)
+	}
+	_, err = db.Collection(reportsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report index: %w", err)
+	}
+	_, err = db.Collection(historyCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "timestamp", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create history author index: %w", err)
+	}
+	_, err = db.Collection(historyCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ownerId", Value: 1}, {Key: "eventSeq", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"eventSeq": bson.M{"$gt": 0}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create history event index: %w", err)
+	}
+	return nil
+}
+
+// ForTenant returns a client for the tenant's database, named <db>_<tenantID>, on the
+// same connection.
+func (c *MongoClient) ForTenant(ctx context.Context, tenantID string) (database.DBAdapter, error) {
+	db := c.client.Database(c.db.Name() + "_" + tenantID)
+	if err := ensureIndexes(ctx, db); err != nil {
+		slog.WarnContext(ctx, "Failed to create MongoDB indexes", "tenantID", tenantID, "error", err)
+	}
+	return &MongoClient{client: c.client, db: db, shared: true}, nil
+}
+
 // Close disconnects the MongoDB client.
 func (c *MongoClient) Close(ctx context.Context) error {
-	if c.client != nil {
-		log.Println("Disconnecting MongoDB client...")
+	if c.client != nil && !c.shared {
+		slog.InfoContext(ctx, "Disconnecting MongoDB client")
 		return c.client.Disconnect(ctx)
 	}
 	return nil
@@ -90,7 +218,7 @@ func (c *MongoClient) GetUserByUsername(ctx context.Context, username string) (*
 	if err == mongo.ErrNoDocuments {
 		return nil, database.ErrNotFound
 	} else if err != nil {
-		log.Printf("MongoDB error getting user %s: %v", username, err)
+		slog.ErrorContext(ctx, "MongoDB error getting user", "username", username, "error", err)
 		return nil, err
 	}
 	// Ensure ID field is populated from _id
@@ -117,12 +245,130 @@ func (c *MongoClient) CreateUser(ctx context.Context, user *models.User) error {
 		if mongo.IsDuplicateKeyError(err) {
 			return database.ErrDuplicateUser
 		}
-		log.Printf("MongoDB error creating user %s: %v", user.Username, err)
+		slog.ErrorContext(ctx, "MongoDB error creating user", "username", user.Username, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	coll := c.db.Collection(usersCollection)
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"storageBytes": delta}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error adjusting storage for user", "userID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	coll := c.db.Collection(usersCollection)
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"passwordHash": passwordHash}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting password of user", "userID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	coll := c.db.Collection(usersCollection)
+	update := bson.M{"$set": bson.M{"siteTheme": theme}}
+	if theme == "" {
+		update = bson.M{"$unset": bson.M{"siteTheme": ""}}
+	}
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting site theme of user", "userID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	coll := c.db.Collection(usersCollection)
+	update := bson.M{"$set": bson.M{"timezone": timezone}}
+	if timezone == "" {
+		update = bson.M{"$unset": bson.M{"timezone": ""}}
+	}
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting time zone of user", "userID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetUserEmail(ctx context.Context, userID, email string) error {
+	coll := c.db.Collection(usersCollection)
+	update := bson.M{"$set": bson.M{"email": email}}
+	if email == "" {
+		update = bson.M{"$unset": bson.M{"email": ""}}
+	}
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting email address of user", "userID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	coll := c.db.Collection(usersCollection)
+	update := bson.M{"$set": bson.M{"mutedNotifications": types}}
+	if len(types) == 0 {
+		update = bson.M{"$unset": bson.M{"mutedNotifications": ""}}
+	}
+	result, err := coll.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting muted notifications of user", "userID", userID, "error", err)
 		return err
 	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
 	return nil
 }
 
+func (c *MongoClient) ListUserIDs(ctx context.Context) ([]string, error) {
+	coll := c.db.Collection(usersCollection)
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"_id": 1})
+	cursor, err := coll.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing users", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var userIDs []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			slog.ErrorContext(ctx, "MongoDB error decoding user", "error", err)
+			return nil, err
+		}
+		userIDs = append(userIDs, doc.ID)
+	}
+	return userIDs, cursor.Err()
+}
+
 // --- Post Methods ---
 
 func (c *MongoClient) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
@@ -139,7 +385,10 @@ func (c *MongoClient) CreatePostMeta(ctx context.Context, post *models.Post) (st
 	// Use bson.Raw to handle _id correctly if needed, or just insert struct
 	_, err = coll.InsertOne(ctx, post) // Insert the struct directly
 	if err != nil {
-		log.Printf("MongoDB error creating post meta: %v", err)
+		if mongo.IsDuplicateKeyError(err) {
+			return "", database.ErrDuplicateSlug
+		}
+		slog.ErrorContext(ctx, "MongoDB error creating post meta", "error", err)
 		return "", err
 	}
 	return post.ID, nil
@@ -157,30 +406,42 @@ func (c *MongoClient) GetPostMetaByID(ctx context.Context, postID string) (*mode
 	if err == mongo.ErrNoDocuments {
 		return nil, database.ErrNotFound
 	} else if err != nil {
-		log.Printf("MongoDB error getting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "MongoDB error getting post meta", "postID", postID, "error", err)
 		return nil, err
 	}
 	post.ID = postID // Ensure string ID is set
 	return &post, nil
 }
 
-func (c *MongoClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.Post, error) {
+func (c *MongoClient) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	var post models.Post
+	err := c.db.Collection(postsCollection).FindOne(ctx, bson.M{"userId": userID, "slug": slug}).Decode(&post) // The unique slug index serves this
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	} else if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting post by slug", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (c *MongoClient) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
 	coll := c.db.Collection(postsCollection)
 	findOptions := options.Find().
 		SetLimit(int64(limit)).
 		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "createdAt", Value: -1}}) // Sort by newest first
+		SetSort(bson.D{{Key: "pinned", Value: -1}, {Key: "rank", Value: -1}, {Key: "createdAt", Value: -1}}) // Placed posts first, then newest first
 
-	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+	cursor, err := coll.Find(ctx, listFilter(userID, includeArchived), findOptions)
 	if err != nil {
-		log.Printf("MongoDB error listing posts for user %s: %v", userID, err)
+		slog.ErrorContext(ctx, "MongoDB error listing posts for user", "userID", userID, "error", err)
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
 	var posts []models.Post
 	if err = cursor.All(ctx, &posts); err != nil {
-		log.Printf("MongoDB error decoding posts for user %s: %v", userID, err)
+		slog.ErrorContext(ctx, "MongoDB error decoding posts for user", "userID", userID, "error", err)
 		return nil, err
 	}
 	// Ensure string IDs are set
@@ -210,10 +471,16 @@ func (c *MongoClient) UpdatePostMeta(ctx context.Context, post *models.Post) err
 	}
 	update := bson.M{
 		"$set": bson.M{
-			"title":     post.Title,
-			"slug":      post.Slug,
-			"updatedAt": time.Now().UTC(),
-			"s3Path":    post.S3Path,
+			"title":              post.Title,
+			"updatedAt":          time.Now().UTC(),
+			"s3Path":             post.S3Path,
+			"size":               post.Size,
+			"contentHash":        post.ContentHash,
+			"wordCount":          post.WordCount,
+			"readingTimeMinutes": post.ReadingTimeMinutes,
+			"tags":               post.Tags,
+			"date":               post.Date,
+			"draft":              post.Draft,
 			// Add other updatable fields here
 		},
 		"$inc": bson.M{"version": 1}, // Increment version atomically
@@ -221,7 +488,7 @@ func (c *MongoClient) UpdatePostMeta(ctx context.Context, post *models.Post) err
 
 	result, err := coll.UpdateOne(ctx, filter, update)
 	if err != nil {
-		log.Printf("MongoDB error updating post meta %s: %v", post.ID, err)
+		slog.ErrorContext(ctx, "MongoDB error updating post meta", "postID", post.ID, "error", err)
 		return err
 	}
 
@@ -251,7 +518,7 @@ func (c *MongoClient) DeletePostMeta(ctx context.Context, postID string) error {
 
 	result, err := coll.DeleteOne(ctx, bson.M{"_id": oid})
 	if err != nil {
-		log.Printf("MongoDB error deleting post meta %s: %v", postID, err)
+		slog.ErrorContext(ctx, "MongoDB error deleting post meta", "postID", postID, "error", err)
 		return err
 	}
 	if result.DeletedCount == 0 {
@@ -261,162 +528,2061 @@ func (c *MongoClient) DeletePostMeta(ctx context.Context, postID string) error {
 	return nil
 }
 
-// --- CodeFile Methods (Similar structure to Post methods) ---
-
-func (c *MongoClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
-	coll := c.db.Collection(codefilesCollection)
-	file.ID = primitive.NewObjectID().Hex()
-	file.CreatedAt = time.Now().UTC()
-	file.UpdatedAt = file.CreatedAt
-	file.Version = 1
+func (c *MongoClient) SetPostSlug(ctx context.Context, postID, slug string) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
+	}
 
-	_, err := coll.InsertOne(ctx, file)
+	update := bson.M{"$set": bson.M{"slug": slug, "updatedAt": time.Now().UTC()}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
-		log.Printf("MongoDB error creating codefile meta: %v", err)
-		return "", err
+		if mongo.IsDuplicateKeyError(err) {
+			return database.ErrDuplicateSlug
+		}
+		slog.ErrorContext(ctx, "MongoDB error setting slug of post", "postID", postID, "error", err)
+		return err
 	}
-	return file.ID, nil
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
 }
 
-func (c *MongoClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
-	coll := c.db.Collection(codefilesCollection)
-	oid, err := primitive.ObjectIDFromHex(fileID)
+func (c *MongoClient) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid codefile ID format: %w", err)
+		return fmt.Errorf("invalid post ID format: %w", err)
 	}
 
-	var file models.CodeFile
-	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&file)
-	if err == mongo.ErrNoDocuments {
-		return nil, database.ErrNotFound
-	}
+	update := bson.M{"$set": bson.M{"publishedVersion": version, "publishedAt": publishedAt, "excerpt": excerpt}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
-		log.Printf("MongoDB error getting codefile meta %s: %v", fileID, err)
-		return nil, err
+		slog.ErrorContext(ctx, "MongoDB error publishing post", "postID", postID, "error", err)
+		return err
 	}
-	file.ID = fileID
-	return &file, nil
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
 }
 
-func (c *MongoClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int) ([]models.CodeFile, error) {
-	coll := c.db.Collection(codefilesCollection)
-	findOptions := options.Find().
-		SetLimit(int64(limit)).
-		SetSkip(int64(offset)).
-		SetSort(bson.D{{Key: "createdAt", Value: -1}})
-
-	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+func (c *MongoClient) SetPostUnpublished(ctx context.Context, postID string) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
-		log.Printf("MongoDB error listing codefiles for user %s: %v", userID, err)
-		return nil, err
+		return fmt.Errorf("invalid post ID format: %w", err)
 	}
-	defer cursor.Close(ctx)
 
-	var files []models.CodeFile
-	if err = cursor.All(ctx, &files); err != nil {
-		log.Printf("MongoDB error decoding codefiles for user %s: %v", userID, err)
-		return nil, err
+	update := bson.M{"$unset": bson.M{"publishedVersion": "", "publishedAt": ""}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error unpublishing post", "postID", postID, "error", err)
+		return err
 	}
-	// Ensure string IDs are set
-	for i := range files {
-		if oid, ok := files[i].ID.(primitive.ObjectID); ok {
-			files[i].ID = oid.Hex()
-		}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
 	}
-	return files, nil
+	return nil
 }
 
-func (c *MongoClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
-	coll := c.db.Collection(codefilesCollection)
-	oid, err := primitive.ObjectIDFromHex(file.ID)
-	if err != nil {
-		return fmt.Errorf("invalid codefile ID format: %w", err)
-	}
+func (c *MongoClient) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	return c.setPostField(ctx, postID, "pinned", pinned)
+}
 
-	filter := bson.M{"_id": oid, "version": file.Version}
-	update := bson.M{
-		"$set": bson.M{
-			"fileName":  file.FileName,
-			"language":  file.Language,
-			"updatedAt": time.Now().UTC(),
-			"s3Path":    file.S3Path,
-		},
-		"$inc": bson.M{"version": 1},
+func (c *MongoClient) SetPostRank(ctx context.Context, postID string, rank int) error {
+	return c.setPostField(ctx, postID, "rank", rank)
+}
+
+func (c *MongoClient) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	return c.setPostField(ctx, postID, "coAuthors", coAuthors)
+}
+
+func (c *MongoClient) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
 	}
 
-	result, err := coll.UpdateOne(ctx, filter, update)
+	update := bson.M{"$set": bson.M{"language": language, "translationOf": translationOf}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
-		log.Printf("MongoDB error updating codefile meta %s: %v", file.ID, err)
+		slog.ErrorContext(ctx, "MongoDB error setting language of post", "postID", postID, "error", err)
 		return err
 	}
-
 	if result.MatchedCount == 0 {
-		existsCount, _ := coll.CountDocuments(ctx, bson.M{"_id": oid})
-		if existsCount > 0 {
-			return database.ErrVersionMismatch
-		}
 		return database.ErrNotFound
 	}
 	return nil
 }
 
-func (c *MongoClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
-	coll := c.db.Collection(codefilesCollection)
-	oid, err := primitive.ObjectIDFromHex(fileID)
+func (c *MongoClient) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
 	if err != nil {
-		return fmt.Errorf("invalid codefile ID format: %w", err)
+		return fmt.Errorf("invalid post ID format: %w", err)
 	}
 
-	result, err := coll.DeleteOne(ctx, bson.M{"_id": oid})
+	update := bson.M{"$set": bson.M{"scheduledAt": scheduledAt, "scheduledVersion": version}}
+	if scheduledAt == nil {
+		update = bson.M{"$unset": bson.M{"scheduledAt": "", "scheduledVersion": ""}}
+	}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
-		log.Printf("MongoDB error deleting codefile meta %s: %v", fileID, err)
+		slog.ErrorContext(ctx, "MongoDB error setting schedule of post", "postID", postID, "error", err)
 		return err
 	}
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		return database.ErrNotFound
 	}
 	return nil
 }
 
-// --- History Methods ---
-
-func (c *MongoClient) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
-	coll := c.db.Collection(historyCollection)
-	logEntry.ID = primitive.NewObjectID().Hex() // Generate ID
-	// Ensure timestamp is set if not already
-	if logEntry.Timestamp.IsZero() {
-		logEntry.Timestamp = time.Now().UTC()
+func (c *MongoClient) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
 	}
 
-	_, err := coll.InsertOne(ctx, logEntry)
+	update := bson.M{"$set": bson.M{"takenDownAt": takenDownAt}}
+	if takenDownAt == nil {
+		update = bson.M{"$unset": bson.M{"takenDownAt": ""}}
+	}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
 	if err != nil {
-		log.Printf("MongoDB error logging action: %v", err)
-		return "", err
+		slog.ErrorContext(ctx, "MongoDB error setting takedown of post", "postID", postID, "error", err)
+		return err
 	}
-	return logEntry.ID, nil
-}
-
-func (c *MongoClient) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
-	coll := c.db.Collection(historyCollection)
-	findOptions := options.Find().
-		SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Newest first
-	if limit > 0 {
-		findOptions.SetLimit(int64(limit))
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
 	}
+	return nil
+}
 
-	filter := bson.M{"itemId": itemID, "itemType": itemType}
-
-	cursor, err := coll.Find(ctx, filter, findOptions)
+func (c *MongoClient) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := c.db.Collection(postsCollection).Find(ctx, bson.M{"userId": userID, "translationOf": postID}, findOptions)
 	if err != nil {
-		log.Printf("MongoDB error getting history for %s %s: %v", itemType, itemID, err)
+		slog.ErrorContext(ctx, "MongoDB error listing translations of post", "postID", postID, "error", err)
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var history []models.HistoryLog
-	if err = cursor.All(ctx, &history); err != nil {
-		log.Printf("MongoDB error decoding history for %s %s: %v", itemType, itemID, err)
-		return nil, err
+	var posts []models.Post
+	if err = cursor.All(ctx, &posts); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding translations of post", "postID", postID, "error", err)
+		return nil, err
+	}
+	for i := range posts {
+		if oid, ok := posts[i].ID.(primitive.ObjectID); ok {
+			posts[i].ID = oid.Hex()
+		}
+	}
+	return posts, nil
+}
+
+func (c *MongoClient) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "scheduledAt", Value: 1}})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	cursor, err := c.db.Collection(postsCollection).Find(ctx, bson.M{"scheduledAt": bson.M{"$lte": before}}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing due posts", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err = cursor.All(ctx, &posts); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding due posts", "error", err)
+		return nil, err
+	}
+	return posts, nil // IDs decode as hex strings
+}
+
+// --- Slug Redirect Methods ---
+
+// redirectDocID is the _id of a slug redirect; a user's slug redirects to one post.
+func redirectDocID(userID, slug string) string {
+	return userID + ":" + slug
+}
+
+func (c *MongoClient) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	if redirect.CreatedAt.IsZero() {
+		redirect.CreatedAt = time.Now().UTC()
+	}
+	_, err := c.db.Collection(redirectsCollection).ReplaceOne(ctx,
+		bson.M{"_id": redirectDocID(redirect.UserID, redirect.Slug)}, redirect,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error putting slug redirect", "userID", redirect.UserID, "slug", redirect.Slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	var redirect models.SlugRedirect
+	err := c.db.Collection(redirectsCollection).FindOne(ctx, bson.M{"_id": redirectDocID(userID, slug)}).Decode(&redirect)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	} else if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return nil, err
+	}
+	return &redirect, nil
+}
+
+func (c *MongoClient) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := c.db.Collection(redirectsCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing slug redirects", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var redirects []models.SlugRedirect
+	if err := cursor.All(ctx, &redirects); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding slug redirects", "userID", userID, "error", err)
+		return nil, err
+	}
+	return redirects, nil
+}
+
+func (c *MongoClient) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	_, err := c.db.Collection(redirectsCollection).DeleteOne(ctx, bson.M{"_id": redirectDocID(userID, slug)})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Domain Methods ---
+
+func (c *MongoClient) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	if domain.CreatedAt.IsZero() {
+		domain.CreatedAt = time.Now().UTC()
+	}
+	_, err := c.db.Collection(domainsCollection).InsertOne(ctx, domain)
+	if mongo.IsDuplicateKeyError(err) {
+		return database.ErrDuplicateDomain
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating domain", "host", domain.Host, "userID", domain.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	var domain models.Domain
+	err := c.db.Collection(domainsCollection).FindOne(ctx, bson.M{"_id": host}).Decode(&domain)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	} else if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting domain", "host", host, "error", err)
+		return nil, err
+	}
+	return &domain, nil
+}
+
+func (c *MongoClient) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := c.db.Collection(domainsCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing domains", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var domains []models.Domain
+	if err = cursor.All(ctx, &domains); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding domains", "userID", userID, "error", err)
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (c *MongoClient) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := c.db.Collection(domainsCollection).Find(ctx, bson.M{"verifiedAt": bson.M{"$exists": true}}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing verified domains", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var domains []models.Domain
+	if err = cursor.All(ctx, &domains); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding verified domains", "error", err)
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (c *MongoClient) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	update := bson.M{"$set": bson.M{"verifiedAt": verifiedAt}}
+	if verifiedAt.IsZero() {
+		update = bson.M{"$unset": bson.M{"verifiedAt": ""}}
+	}
+	result, err := c.db.Collection(domainsCollection).UpdateOne(ctx, bson.M{"_id": host}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error verifying domain", "host", host, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteDomain(ctx context.Context, host string) error {
+	_, err := c.db.Collection(domainsCollection).DeleteOne(ctx, bson.M{"_id": host})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting domain", "host", host, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Push Subscription Methods ---
+
+func (c *MongoClient) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+	_, err := c.db.Collection(pushCollection).ReplaceOne(ctx, bson.M{"_id": sub.ID}, sub, options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error saving push subscription", "subscriptionID", sub.ID, "userID", sub.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := c.db.Collection(pushCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing push subscriptions", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subs []models.PushSubscription
+	if err = cursor.All(ctx, &subs); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding push subscriptions", "userID", userID, "error", err)
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (c *MongoClient) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	_, err := c.db.Collection(pushCollection).DeleteOne(ctx, bson.M{"_id": subscriptionID})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting push subscription", "subscriptionID", subscriptionID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Share Link Methods ---
+
+func (c *MongoClient) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now().UTC()
+	}
+	if _, err := c.db.Collection(shareLinksCollection).InsertOne(ctx, link); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating share link", "linkID", link.LinkID, "itemID", link.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := c.db.Collection(shareLinksCollection).FindOne(ctx, bson.M{"_id": linkID}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	} else if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting share link", "linkID", linkID, "error", err)
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (c *MongoClient) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := c.db.Collection(shareLinksCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing share links", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var links []models.ShareLink
+	if err = cursor.All(ctx, &links); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding share links", "userID", userID, "error", err)
+		return nil, err
+	}
+	return links, nil
+}
+
+func (c *MongoClient) DeleteShareLink(ctx context.Context, linkID string) error {
+	_, err := c.db.Collection(shareLinksCollection).DeleteOne(ctx, bson.M{"_id": linkID})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting share link", "linkID", linkID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// setPostField sets a single field of a post without bumping its version.
+func (c *MongoClient) setPostField(ctx context.Context, postID, field string, value interface{}) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
+	}
+
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": bson.M{field: value}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting field of post", "field", field, "postID", postID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
+	}
+
+	update := bson.M{"$set": bson.M{"excerpt": excerpt, "excerptManual": manual}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting excerpt of post", "postID", postID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
+	}
+
+	update := bson.M{"$set": bson.M{"canonicalUrl": canonicalURL, "metaDescription": metaDescription, "noIndex": noIndex}}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting SEO metadata of post", "postID", postID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	oid, err := primitive.ObjectIDFromHex(postID)
+	if err != nil {
+		return fmt.Errorf("invalid post ID format: %w", err)
+	}
+
+	update := bson.M{"$unset": bson.M{"coverImage": ""}}
+	if assetID != "" {
+		update = bson.M{"$set": bson.M{"coverImage": assetID}}
+	}
+	result, err := c.db.Collection(postsCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting cover image of post", "postID", postID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- CodeFile Methods (Similar structure to Post methods) ---
+
+func (c *MongoClient) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	coll := c.db.Collection(codefilesCollection)
+	file.ID = primitive.NewObjectID().Hex()
+	file.CreatedAt = time.Now().UTC()
+	file.UpdatedAt = file.CreatedAt
+	file.Version = 1
+
+	_, err := coll.InsertOne(ctx, file)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating codefile meta", "error", err)
+		return "", err
+	}
+	return file.ID, nil
+}
+
+func (c *MongoClient) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	coll := c.db.Collection(codefilesCollection)
+	oid, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid codefile ID format: %w", err)
+	}
+
+	var file models.CodeFile
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting codefile meta", "fileID", fileID, "error", err)
+		return nil, err
+	}
+	file.ID = fileID
+	return &file, nil
+}
+
+func (c *MongoClient) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	coll := c.db.Collection(codefilesCollection)
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := coll.Find(ctx, listFilter(userID, includeArchived), findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing codefiles for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []models.CodeFile
+	if err = cursor.All(ctx, &files); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding codefiles for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	// Ensure string IDs are set
+	for i := range files {
+		if oid, ok := files[i].ID.(primitive.ObjectID); ok {
+			files[i].ID = oid.Hex()
+		}
+	}
+	return files, nil
+}
+
+func (c *MongoClient) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	coll := c.db.Collection(codefilesCollection)
+	oid, err := primitive.ObjectIDFromHex(file.ID)
+	if err != nil {
+		return fmt.Errorf("invalid codefile ID format: %w", err)
+	}
+
+	filter := bson.M{"_id": oid, "version": file.Version}
+	update := bson.M{
+		"$set": bson.M{
+			"language":    file.Language,
+			"updatedAt":   time.Now().UTC(),
+			"s3Path":      file.S3Path,
+			"size":        file.Size,
+			"contentHash": file.ContentHash,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error updating codefile meta", "fileID", file.ID, "error", err)
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		existsCount, _ := coll.CountDocuments(ctx, bson.M{"_id": oid})
+		if existsCount > 0 {
+			return database.ErrVersionMismatch
+		}
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	coll := c.db.Collection(codefilesCollection)
+	oid, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return fmt.Errorf("invalid codefile ID format: %w", err)
+	}
+
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting codefile meta", "fileID", fileID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	oid, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return fmt.Errorf("invalid codefile ID format: %w", err)
+	}
+
+	update := bson.M{"$set": bson.M{"fileName": fileName, "path": path, "language": language, "updatedAt": time.Now().UTC()}}
+	result, err := c.db.Collection(codefilesCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error renaming codefile", "fileID", fileID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- Ownership Transfer Methods ---
+
+func (c *MongoClient) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	coll := c.db.Collection(transfersCollection)
+	transfer.ID = primitive.NewObjectID().Hex()
+	transfer.CreatedAt = time.Now().UTC()
+
+	_, err := coll.InsertOne(ctx, transfer)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating transfer", "itemType", transfer.ItemType, "itemID", transfer.ItemID, "error", err)
+		return "", err
+	}
+	return transfer.ID, nil
+}
+
+func (c *MongoClient) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	coll := c.db.Collection(transfersCollection)
+	oid, err := primitive.ObjectIDFromHex(transferID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer ID format: %w", err)
+	}
+
+	var transfer models.OwnershipTransfer
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&transfer)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting transfer", "transferID", transferID, "error", err)
+		return nil, err
+	}
+	transfer.ID = transferID
+	return &transfer, nil
+}
+
+func (c *MongoClient) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	coll := c.db.Collection(transfersCollection)
+	filter := bson.M{"toUserId": toUserID, "status": models.TransferPending}
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := coll.Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing transfers for user", "toUserID", toUserID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transfers []models.OwnershipTransfer
+	if err = cursor.All(ctx, &transfers); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding transfers for user", "toUserID", toUserID, "error", err)
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (c *MongoClient) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"fromUserId": userID}, bson.M{"toUserId": userID}}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := c.db.Collection(transfersCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing transfers of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transfers []models.OwnershipTransfer
+	if err = cursor.All(ctx, &transfers); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding transfers of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (c *MongoClient) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(transferID)
+	if err != nil {
+		return fmt.Errorf("invalid transfer ID format: %w", err)
+	}
+
+	filter := bson.M{"_id": oid, "status": models.TransferPending}
+	update := bson.M{"$set": bson.M{"status": status, "resolvedAt": resolvedAt}}
+	result, err := c.db.Collection(transfersCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error resolving transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound // Missing or no longer pending
+	}
+	return nil
+}
+
+func (c *MongoClient) ReopenTransfer(ctx context.Context, transferID string) error {
+	oid, err := primitive.ObjectIDFromHex(transferID)
+	if err != nil {
+		return fmt.Errorf("invalid transfer ID format: %w", err)
+	}
+
+	filter := bson.M{"_id": oid, "status": models.TransferAccepted}
+	update := bson.M{"$set": bson.M{"status": models.TransferPending}, "$unset": bson.M{"resolvedAt": ""}}
+	result, err := c.db.Collection(transfersCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error reopening transfer", "transferID", transferID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound // Missing or not accepted
+	}
+	return nil
+}
+
+// setOwner hands an item to userID. Workspace and project belong to the previous owner,
+// so the item lands in the new owner's default workspace outside any project.
+func (c *MongoClient) setOwner(ctx context.Context, collName, id, userID, s3Path string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"userId": userID, "s3Path": s3Path, "updatedAt": time.Now().UTC()},
+		"$unset": bson.M{"workspaceId": "", "projectId": ""},
+	}
+	result, err := c.db.Collection(collName).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return database.ErrDuplicateSlug // The new owner has a post with this slug
+		}
+		slog.ErrorContext(ctx, "MongoDB error transferring item", "collection", collName, "itemID", id, "toUserID", userID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	return c.setOwner(ctx, postsCollection, postID, userID, s3Path)
+}
+
+func (c *MongoClient) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	return c.setOwner(ctx, codefilesCollection, fileID, userID, s3Path)
+}
+
+// --- Collaborator Methods ---
+
+// collaboratorDocID is the _id of a collaborator document; one per user and item.
+func collaboratorDocID(itemID, itemType, userID string) string {
+	return itemType + ":" + itemID + ":" + userID
+}
+
+func (c *MongoClient) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	coll := c.db.Collection(collaboratorsCollection)
+	if collab.CreatedAt.IsZero() {
+		collab.CreatedAt = time.Now().UTC()
+	}
+	filter := bson.M{"_id": collaboratorDocID(collab.ItemID, collab.ItemType, collab.UserID)}
+	_, err := coll.ReplaceOne(ctx, filter, collab, options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error saving collaborator", "userID", collab.UserID, "itemType", collab.ItemType, "itemID", collab.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	coll := c.db.Collection(collaboratorsCollection)
+	var collab models.Collaborator
+	err := coll.FindOne(ctx, bson.M{"_id": collaboratorDocID(itemID, itemType, userID)}).Decode(&collab)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return &collab, nil
+}
+
+func (c *MongoClient) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	coll := c.db.Collection(collaboratorsCollection)
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := coll.Find(ctx, bson.M{"itemId": itemID, "itemType": itemType}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing collaborators", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var collabs []models.Collaborator
+	if err = cursor.All(ctx, &collabs); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding collaborators", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return collabs, nil
+}
+
+func (c *MongoClient) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	coll := c.db.Collection(collaboratorsCollection)
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": collaboratorDocID(itemID, itemType, userID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- Version Tag Methods ---
+
+// versionTagDocID is the _id of a version tag; names are unique per item.
+func versionTagDocID(itemID, itemType, name string) string {
+	return itemType + ":" + itemID + ":" + name
+}
+
+func (c *MongoClient) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	if tag.CreatedAt.IsZero() {
+		tag.CreatedAt = time.Now().UTC()
+	}
+	doc := struct {
+		ID                 string `bson:"_id"`
+		*models.VersionTag `bson:",inline"`
+	}{versionTagDocID(tag.ItemID, tag.ItemType, tag.Name), tag}
+	_, err := c.db.Collection(tagsCollection).InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return database.ErrDuplicateTag
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating tag", "tag", tag.Name, "itemType", tag.ItemType, "itemID", tag.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	var tag models.VersionTag
+	err := c.db.Collection(tagsCollection).FindOne(ctx, bson.M{"_id": versionTagDocID(itemID, itemType, name)}).Decode(&tag)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func (c *MongoClient) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: -1}, {Key: "name", Value: 1}})
+	cursor, err := c.db.Collection(tagsCollection).Find(ctx, bson.M{"itemId": itemID, "itemType": itemType}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing tags", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tags []models.VersionTag
+	if err = cursor.All(ctx, &tags); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding tags", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (c *MongoClient) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	result, err := c.db.Collection(tagsCollection).DeleteOne(ctx, bson.M{"_id": versionTagDocID(itemID, itemType, name)})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- Comment Methods ---
+
+func (c *MongoClient) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	comment.ID = primitive.NewObjectID().Hex()
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = time.Now().UTC()
+	}
+	if _, err := c.db.Collection(commentsCollection).InsertOne(ctx, comment); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating comment", "itemType", comment.ItemType, "itemID", comment.ItemID, "error", err)
+		return "", err
+	}
+	return comment.ID, nil
+}
+
+func (c *MongoClient) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	var comment models.Comment
+	filter := bson.M{"_id": commentID, "itemId": itemID, "itemType": itemType}
+	err := c.db.Collection(commentsCollection).FindOne(ctx, filter).Decode(&comment)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// commentStatusFilter matches comments with status; see models.CommentStatus.Is.
+func commentStatusFilter(status models.CommentStatus) interface{} {
+	if status == models.CommentApproved {
+		return bson.M{"$in": bson.A{status, "", nil}} // nil matches a missing field
+	}
+	return status
+}
+
+func (c *MongoClient) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetSkip(int64(offset))
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"itemId": itemID, "itemType": itemType}
+	if status != "" {
+		filter["status"] = commentStatusFilter(status)
+	}
+	cursor, err := c.db.Collection(commentsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err = cursor.All(ctx, &comments); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (c *MongoClient) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetSkip(int64(offset))
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"itemOwnerId": ownerUserID}
+	if status != "" {
+		filter["status"] = commentStatusFilter(status)
+	}
+	cursor, err := c.db.Collection(commentsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing comments of owner", "ownerUserID", ownerUserID, "status", status, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err = cursor.All(ctx, &comments); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding comments of owner", "ownerUserID", ownerUserID, "error", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (c *MongoClient) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := c.db.Collection(commentsCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing comments of author", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err = cursor.All(ctx, &comments); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding comments of author", "userID", userID, "error", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (c *MongoClient) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	filter := bson.M{"_id": commentID, "itemId": itemID, "itemType": itemType}
+	result, err := c.db.Collection(commentsCollection).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting comment status", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	filter := bson.M{"_id": commentID, "itemId": itemID, "itemType": itemType}
+	result, err := c.db.Collection(commentsCollection).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"anchor": anchor}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting comment anchor", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	filter := bson.M{"itemId": itemID, "itemType": itemType}
+	_, err := c.db.Collection(commentsCollection).UpdateMany(ctx, filter, bson.M{"$set": bson.M{"itemOwnerId": ownerUserID}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting owner of comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	filter := bson.M{"_id": commentID, "itemId": itemID, "itemType": itemType}
+	result, err := c.db.Collection(commentsCollection).DeleteOne(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	_, err := c.db.Collection(commentsCollection).DeleteMany(ctx, bson.M{"itemId": itemID, "itemType": itemType})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Report Methods ---
+
+func (c *MongoClient) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	report.ID = primitive.NewObjectID().Hex()
+	report.CreatedAt = time.Now().UTC()
+	if _, err := c.db.Collection(reportsCollection).InsertOne(ctx, report); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating report", "itemType", report.ItemType, "itemID", report.ItemID, "error", err)
+		return "", err
+	}
+	return report.ID, nil
+}
+
+func (c *MongoClient) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	var report models.Report
+	err := c.db.Collection(reportsCollection).FindOne(ctx, bson.M{"_id": reportID}).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting report", "reportID", reportID, "error", err)
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *MongoClient) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetSkip(int64(offset))
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := c.db.Collection(reportsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing reports", "status", status, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var reports []models.Report
+	if err = cursor.All(ctx, &reports); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding reports", "error", err)
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (c *MongoClient) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	filter := bson.M{"_id": reportID, "status": models.ReportOpen}
+	set := bson.M{"status": status, "resolvedBy": resolvedBy, "resolvedAt": resolvedAt}
+	if note != "" {
+		set["note"] = note
+	}
+	result, err := c.db.Collection(reportsCollection).UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error resolving report", "reportID", reportID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound // Missing or already resolved
+	}
+	return nil
+}
+
+// --- Hook Result Methods ---
+
+// hookResultDocID is the _id of a hook result; each hook keeps one per item.
+func hookResultDocID(itemID, itemType, hook string) string {
+	return itemType + ":" + itemID + ":" + hook
+}
+
+func (c *MongoClient) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	_, err := c.db.Collection(hookResultsCollection).ReplaceOne(ctx,
+		bson.M{"_id": hookResultDocID(result.ItemID, result.ItemType, result.Hook)}, result,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error saving hook result", "hook", result.Hook, "itemType", result.ItemType, "itemID", result.ItemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "hook", Value: 1}})
+	cursor, err := c.db.Collection(hookResultsCollection).Find(ctx, bson.M{"itemId": itemID, "itemType": itemType}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []models.HookResult
+	if err = cursor.All(ctx, &results); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *MongoClient) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	_, err := c.db.Collection(hookResultsCollection).DeleteMany(ctx, bson.M{"itemId": itemID, "itemType": itemType})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Bookmark Methods ---
+
+// bookmarkDocID is the _id of a bookmark; a user bookmarks a post at most once.
+func bookmarkDocID(userID, postID string) string {
+	return userID + ":" + postID
+}
+
+func (c *MongoClient) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	if bookmark.CreatedAt.IsZero() {
+		bookmark.CreatedAt = time.Now().UTC()
+	}
+	_, err := c.db.Collection(bookmarksCollection).UpdateOne(ctx,
+		bson.M{"_id": bookmarkDocID(bookmark.UserID, bookmark.PostID)},
+		bson.M{"$setOnInsert": bookmark},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error bookmarking post for user", "postID", bookmark.PostID, "userID", bookmark.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	result, err := c.db.Collection(bookmarksCollection).DeleteOne(ctx, bson.M{"_id": bookmarkDocID(userID, postID)})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting bookmark of post for user", "postID", postID, "userID", userID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := c.db.Collection(bookmarksCollection).Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing bookmarks of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var bookmarks []models.Bookmark
+	if err = cursor.All(ctx, &bookmarks); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding bookmarks of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+func (c *MongoClient) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	count, err := c.db.Collection(bookmarksCollection).CountDocuments(ctx, bson.M{"postId": postID})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error counting bookmarks of post", "postID", postID, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (c *MongoClient) DeletePostBookmarks(ctx context.Context, postID string) error {
+	_, err := c.db.Collection(bookmarksCollection).DeleteMany(ctx, bson.M{"postId": postID})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting bookmarks of post", "postID", postID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Workspace Methods ---
+
+func (c *MongoClient) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	coll := c.db.Collection(workspacesCollection)
+	workspace.ID = primitive.NewObjectID().Hex()
+	workspace.CreatedAt = time.Now().UTC()
+	workspace.UpdatedAt = workspace.CreatedAt
+
+	_, err := coll.InsertOne(ctx, workspace)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating workspace", "error", err)
+		return "", err
+	}
+	return workspace.ID, nil
+}
+
+func (c *MongoClient) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	coll := c.db.Collection(workspacesCollection)
+	oid, err := primitive.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace ID format: %w", err)
+	}
+
+	var workspace models.Workspace
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	workspace.ID = workspaceID
+	return &workspace, nil
+}
+
+func (c *MongoClient) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	coll := c.db.Collection(workspacesCollection)
+	findOptions := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing workspaces for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var workspaces []models.Workspace
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding workspaces for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// setWorkspace moves an item into workspaceID, or back to the default workspace when empty.
+func (c *MongoClient) setWorkspace(ctx context.Context, collName, id, workspaceID string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	update := bson.M{"$unset": bson.M{"workspaceId": ""}}
+	if workspaceID != "" {
+		update = bson.M{"$set": bson.M{"workspaceId": workspaceID}}
+	}
+	result, err := c.db.Collection(collName).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error moving item to workspace", "collection", collName, "itemID", id, "workspaceID", workspaceID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	return c.setWorkspace(ctx, postsCollection, postID, workspaceID)
+}
+
+func (c *MongoClient) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	return c.setWorkspace(ctx, codefilesCollection, fileID, workspaceID)
+}
+
+// workspaceFind builds the filter and options shared by the List*ByWorkspace methods.
+// listFilter matches a user's non-trashed items, leaving out archived ones unless
+// includeArchived.
+func listFilter(userID string, includeArchived bool) bson.M {
+	filter := bson.M{"userId": userID, "deletedAt": bson.M{"$exists": false}}
+	if !includeArchived {
+		filter["archivedAt"] = bson.M{"$exists": false}
+	}
+	return filter
+}
+
+func workspaceFind(userID, workspaceID string, limit, offset int, includeArchived bool) (bson.M, *options.FindOptions) {
+	filter := listFilter(userID, includeArchived)
+	if workspaceID != "" {
+		filter["workspaceId"] = workspaceID
+	} else {
+		filter["workspaceId"] = bson.M{"$exists": false}
+	}
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	return filter, findOptions
+}
+
+func (c *MongoClient) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	filter, findOptions := workspaceFind(userID, workspaceID, limit, offset, includeArchived)
+	cursor, err := c.db.Collection(postsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing posts in workspace for user", "workspaceID", workspaceID, "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err = cursor.All(ctx, &posts); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding posts in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (c *MongoClient) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	filter, findOptions := workspaceFind(userID, workspaceID, limit, offset, includeArchived)
+	cursor, err := c.db.Collection(codefilesCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing codefiles in workspace for user", "workspaceID", workspaceID, "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []models.CodeFile
+	if err = cursor.All(ctx, &files); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding codefiles in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// --- Template Methods ---
+
+func (c *MongoClient) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	coll := c.db.Collection(templatesCollection)
+	template.ID = primitive.NewObjectID().Hex()
+	template.CreatedAt = time.Now().UTC()
+	template.UpdatedAt = template.CreatedAt
+
+	_, err := coll.InsertOne(ctx, template)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating template", "error", err)
+		return "", err
+	}
+	return template.ID, nil
+}
+
+func (c *MongoClient) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	coll := c.db.Collection(templatesCollection)
+	oid, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template ID format: %w", err)
+	}
+
+	var template models.Template
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting template", "templateID", templateID, "error", err)
+		return nil, err
+	}
+	template.ID = templateID
+	return &template, nil
+}
+
+func (c *MongoClient) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	coll := c.db.Collection(templatesCollection)
+	findOptions := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing templates for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var templates []models.Template
+	if err = cursor.All(ctx, &templates); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding templates for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (c *MongoClient) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	oid, err := primitive.ObjectIDFromHex(template.ID)
+	if err != nil {
+		return fmt.Errorf("invalid template ID format: %w", err)
+	}
+
+	template.UpdatedAt = time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		"name": template.Name, "title": template.Title, "fileName": template.FileName,
+		"language": template.Language, "content": template.Content, "updatedAt": template.UpdatedAt,
+	}}
+	result, err := c.db.Collection(templatesCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error updating template", "templateID", template.ID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteTemplate(ctx context.Context, templateID string) error {
+	oid, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return fmt.Errorf("invalid template ID format: %w", err)
+	}
+
+	result, err := c.db.Collection(templatesCollection).DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting template", "templateID", templateID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- Project Methods ---
+
+func (c *MongoClient) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	coll := c.db.Collection(projectsCollection)
+	project.ID = primitive.NewObjectID().Hex()
+	project.CreatedAt = time.Now().UTC()
+	project.UpdatedAt = project.CreatedAt
+
+	_, err := coll.InsertOne(ctx, project)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating project", "error", err)
+		return "", err
+	}
+	return project.ID, nil
+}
+
+func (c *MongoClient) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	coll := c.db.Collection(projectsCollection)
+	oid, err := primitive.ObjectIDFromHex(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project ID format: %w", err)
+	}
+
+	var project models.Project
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&project)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	project.ID = projectID
+	return &project, nil
+}
+
+func (c *MongoClient) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	coll := c.db.Collection(projectsCollection)
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing projects for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var projects []models.Project
+	if err = cursor.All(ctx, &projects); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding projects for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (c *MongoClient) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	oid, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return fmt.Errorf("invalid codefile ID format: %w", err)
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{"$unset": bson.M{"projectId": ""}, "$set": bson.M{"updatedAt": now}}
+	if projectID != "" {
+		update = bson.M{"$set": bson.M{"projectId": projectID, "updatedAt": now}}
+	}
+	result, err := c.db.Collection(codefilesCollection).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error moving codefile to project", "fileID", fileID, "projectID", projectID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	coll := c.db.Collection(codefilesCollection)
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "path", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"projectId": projectID, "deletedAt": bson.M{"$exists": false}}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing codefiles for project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []models.CodeFile
+	if err = cursor.All(ctx, &files); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding codefiles for project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// --- Asset Methods ---
+
+func (c *MongoClient) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	coll := c.db.Collection(assetsCollection)
+	asset.ID = primitive.NewObjectID().Hex()
+	asset.CreatedAt = time.Now().UTC()
+	asset.UpdatedAt = asset.CreatedAt
+
+	_, err := coll.InsertOne(ctx, asset)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating asset", "error", err)
+		return "", err
+	}
+	return asset.ID, nil
+}
+
+func (c *MongoClient) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	coll := c.db.Collection(assetsCollection)
+	oid, err := primitive.ObjectIDFromHex(assetID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset ID format: %w", err)
+	}
+
+	var asset models.Asset
+	err = coll.FindOne(ctx, bson.M{"_id": oid}).Decode(&asset)
+	if err == mongo.ErrNoDocuments {
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting asset", "assetID", assetID, "error", err)
+		return nil, err
+	}
+	asset.ID = assetID
+	return &asset, nil
+}
+
+func (c *MongoClient) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	coll := c.db.Collection(assetsCollection)
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset)).
+		SetSort(bson.D{{Key: "path", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"userId": userID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing assets for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var assets []models.Asset
+	if err = cursor.All(ctx, &assets); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding assets for user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (c *MongoClient) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	coll := c.db.Collection(assetsCollection)
+	findOptions := options.Find().
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "path", Value: 1}})
+
+	cursor, err := coll.Find(ctx, bson.M{"projectId": projectID}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing assets for project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var assets []models.Asset
+	if err = cursor.All(ctx, &assets); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding assets for project", "projectID", projectID, "error", err)
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (c *MongoClient) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	coll := c.db.Collection(assetsCollection)
+	oid, err := primitive.ObjectIDFromHex(asset.ID)
+	if err != nil {
+		return fmt.Errorf("invalid asset ID format: %w", err)
+	}
+
+	filter := bson.M{"_id": oid, "version": asset.Version}
+	update := bson.M{
+		"$set": bson.M{
+			"contentType": asset.ContentType,
+			"s3Path":      asset.S3Path,
+			"size":        asset.Size,
+			"contentHash": asset.ContentHash,
+			"updatedAt":   time.Now().UTC(),
+		},
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error updating asset", "assetID", asset.ID, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		existsCount, _ := coll.CountDocuments(ctx, bson.M{"_id": oid})
+		if existsCount > 0 {
+			return database.ErrVersionMismatch
+		}
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) DeleteAsset(ctx context.Context, assetID string) error {
+	oid, err := primitive.ObjectIDFromHex(assetID)
+	if err != nil {
+		return fmt.Errorf("invalid asset ID format: %w", err)
+	}
+
+	result, err := c.db.Collection(assetsCollection).DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting asset", "assetID", assetID, "error", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// --- Trash Methods ---
+
+func (c *MongoClient) setDeletedAt(ctx context.Context, collName, id string, deletedAt *time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	update := bson.M{"$unset": bson.M{"deletedAt": ""}} // Restore
+	if deletedAt != nil {
+		update = bson.M{"$set": bson.M{"deletedAt": *deletedAt}}
+	}
+	result, err := c.db.Collection(collName).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting deletedAt", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, postsCollection, postID, deletedAt)
+}
+
+func (c *MongoClient) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	return c.setDeletedAt(ctx, codefilesCollection, fileID, deletedAt)
+}
+
+func (c *MongoClient) setArchivedAt(ctx context.Context, collName, id string, archivedAt *time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %w", err)
+	}
+
+	update := bson.M{"$unset": bson.M{"archivedAt": ""}} // Unarchive
+	if archivedAt != nil {
+		update = bson.M{"$set": bson.M{"archivedAt": *archivedAt}}
+	}
+	result, err := c.db.Collection(collName).UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error setting archivedAt", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, postsCollection, postID, archivedAt)
+}
+
+func (c *MongoClient) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	return c.setArchivedAt(ctx, codefilesCollection, fileID, archivedAt)
+}
+
+func (c *MongoClient) adjustRetainedBytes(ctx context.Context, collName, id string, delta int64) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid ID format: %w", err)
+	}
+	result, err := c.db.Collection(collName).UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$inc": bson.M{"retainedBytes": delta}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error adjusting retained bytes", "collection", collName, "itemID", id, "error", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (c *MongoClient) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, postsCollection, postID, delta)
+}
+
+func (c *MongoClient) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	return c.adjustRetainedBytes(ctx, codefilesCollection, fileID, delta)
+}
+
+// trashFind builds the filter and options shared by the ListTrashed* methods.
+func trashFind(q database.TrashQuery) (bson.M, *options.FindOptions) {
+	deleted := bson.M{"$exists": true}
+	if !q.DeletedBefore.IsZero() {
+		deleted["$lt"] = q.DeletedBefore
+	}
+	filter := bson.M{"deletedAt": deleted}
+	if q.UserID != "" {
+		filter["userId"] = q.UserID
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}}) // Most recently deleted first
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit))
+	}
+	return filter, findOptions
+}
+
+func (c *MongoClient) ListTrashedPostMeta(ctx context.Context, q database.TrashQuery) ([]models.Post, error) {
+	filter, findOptions := trashFind(q)
+	cursor, err := c.db.Collection(postsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing trashed posts", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []models.Post
+	if err = cursor.All(ctx, &posts); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding trashed posts", "error", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (c *MongoClient) ListTrashedCodeFileMeta(ctx context.Context, q database.TrashQuery) ([]models.CodeFile, error) {
+	filter, findOptions := trashFind(q)
+	cursor, err := c.db.Collection(codefilesCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing trashed codefiles", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var files []models.CodeFile
+	if err = cursor.All(ctx, &files); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding trashed codefiles", "error", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// --- Item Stats Methods ---
+
+func (c *MongoClient) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	coll := c.db.Collection(statsCollection)
+	update := bson.M{
+		"$inc":         bson.M{"views": views, "edits": edits},
+		"$setOnInsert": bson.M{"itemId": itemID, "itemType": itemType, "day": day},
+	}
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": itemType + ":" + itemID + ":" + day}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error incrementing stats", "itemType", itemType, "itemID", itemID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	coll := c.db.Collection(statsCollection)
+	filter := bson.M{"itemId": itemID, "itemType": itemType, "day": bson.M{"$gte": fromDay, "$lte": toDay}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "day", Value: 1}}))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing stats", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var days []models.ItemStatsDay
+	if err = cursor.All(ctx, &days); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding stats", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return days, nil
+}
+
+func (c *MongoClient) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	_, err := c.db.Collection(statsCollection).DeleteMany(ctx, bson.M{"itemId": itemID, "itemType": itemType})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting stats", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- API Usage Methods ---
+
+func (c *MongoClient) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	coll := c.db.Collection(usageCollection)
+	update := bson.M{
+		"$inc":         bson.M{"requests": requests, "wsMessages": wsMessages},
+		"$setOnInsert": bson.M{"userId": userID, "day": day, "keyId": keyID},
+	}
+	id := userID + ":" + day
+	if keyID != "" {
+		id += ":" + keyID // Days counted without a key keep their IDs
+	}
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": id}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error incrementing API usage", "userID", userID, "day", day, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	coll := c.db.Collection(usageCollection)
+	filter := bson.M{"userId": userID, "day": bson.M{"$gte": fromDay, "$lte": toDay}}
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "day", Value: 1}, {Key: "keyId", Value: 1}}))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing API usage", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var days []models.UsageDay
+	if err = cursor.All(ctx, &days); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding API usage", "userID", userID, "error", err)
+		return nil, err
+	}
+	return days, nil
+}
+
+// --- Write Intent Methods ---
+
+func (c *MongoClient) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	intent.ID = primitive.NewObjectID().Hex()
+	intent.CreatedAt = time.Now().UTC()
+
+	_, err := c.db.Collection(intentsCollection).InsertOne(ctx, intent)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error creating write intent", "itemType", intent.ItemType, "itemID", intent.ItemID, "error", err)
+		return "", err
+	}
+	return intent.ID, nil
+}
+
+func (c *MongoClient) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}) // Oldest first
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	cursor, err := c.db.Collection(intentsCollection).Find(ctx, bson.M{"createdAt": bson.M{"$lt": createdBefore}}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing write intents", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var intents []models.WriteIntent
+	if err = cursor.All(ctx, &intents); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding write intents", "error", err)
+		return nil, err
+	}
+	return intents, nil
+}
+
+func (c *MongoClient) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	_, err := c.db.Collection(intentsCollection).DeleteOne(ctx, bson.M{"_id": intentID})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting write intent", "intentID", intentID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Journal Methods ---
+
+func (c *MongoClient) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	_, err := c.db.Collection(journalCollection).ReplaceOne(ctx,
+		bson.M{"_id": entry.ItemType + ":" + entry.ItemID + ":" + strconv.Itoa(entry.Version)}, entry,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error appending journal entry", "itemType", entry.ItemType, "itemID", entry.ItemID, "version", entry.Version, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (c *MongoClient) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"itemId": itemID, "itemType": itemType, "version": bson.M{"$gt": afterVersion}}
+	cursor, err := c.db.Collection(journalCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing journal", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.JournalEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding journal", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *MongoClient) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	filter := bson.M{"itemId": itemID, "itemType": itemType, "version": bson.M{"$lt": beforeVersion}}
+	_, err := c.db.Collection(journalCollection).DeleteMany(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting journal", "itemType", itemType, "itemID", itemID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- History Methods ---
+
+func (c *MongoClient) LogAction(ctx context.Context, logEntry *models.HistoryLog) (string, error) {
+	coll := c.db.Collection(historyCollection)
+	if logEntry.ID == "" { // Set when retrying a write
+		logEntry.ID = primitive.NewObjectID().Hex() // Generate ID
+	}
+	// Ensure timestamp is set if not already
+	if logEntry.Timestamp.IsZero() {
+		logEntry.Timestamp = time.Now().UTC()
+	}
+
+	_, err := coll.InsertOne(ctx, logEntry)
+	if mongo.IsDuplicateKeyError(err) {
+		return logEntry.ID, nil // An earlier attempt got through
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error logging action", "error", err)
+		return "", err
+	}
+	return logEntry.ID, nil
+}
+
+func (c *MongoClient) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	coll := c.db.Collection(historyCollection)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Newest first
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	filter := bson.M{"itemId": itemID, "itemType": itemType}
+
+	cursor, err := coll.Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting history", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var history []models.HistoryLog
+	if err = cursor.All(ctx, &history); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding history", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
 	}
 	// Ensure string IDs are set
 	for i := range history {
@@ -427,6 +2593,104 @@ func (c *MongoClient) GetActionHistory(ctx context.Context, itemID string, itemT
 	return history, nil
 }
 
+func (c *MongoClient) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Newest first
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"itemId": itemID, "itemType": itemType, "timestamp": bson.M{"$lte": until}}
+	cursor, err := c.db.Collection(historyCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error getting history", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var history []models.HistoryLog
+	if err = cursor.All(ctx, &history); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding history", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+func (c *MongoClient) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Newest first
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"userId": userID, "timestamp": bson.M{"$lte": until}}
+	cursor, err := c.db.Collection(historyCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing history of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var history []models.HistoryLog
+	if err = cursor.All(ctx, &history); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding history of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+func (c *MongoClient) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}) // Newest first
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	cursor, err := c.db.Collection(historyCollection).Find(ctx, bson.M{"timestamp": bson.M{"$gte": since}}, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing recent history", "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var history []models.HistoryLog
+	if err = cursor.All(ctx, &history); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding recent history", "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+func (c *MongoClient) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := c.db.Collection(eventSeqsCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": userID}, bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error allocating event number", "userID", userID, "error", err)
+		return 0, err
+	}
+	return counter.Seq, nil
+}
+
+func (c *MongoClient) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "eventSeq", Value: 1}})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+	filter := bson.M{"ownerId": ownerID, "eventSeq": bson.M{"$gt": afterSeq}}
+	cursor, err := c.db.Collection(historyCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error listing item events", "ownerID", ownerID, "error", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var history []models.HistoryLog
+	if err = cursor.All(ctx, &history); err != nil {
+		slog.ErrorContext(ctx, "MongoDB error decoding item events", "ownerID", ownerID, "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
 func (c *MongoClient) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
 	coll := c.db.Collection(historyCollection)
 	oid, err := primitive.ObjectIDFromHex(logID)
@@ -439,13 +2703,77 @@ func (c *MongoClient) GetHistoryLogByID(ctx context.Context, logID string) (*mod
 	if err == mongo.ErrNoDocuments {
 		return nil, database.ErrNotFound
 	} else if err != nil {
-		log.Printf("MongoDB error getting history log %s: %v", logID, err)
+		slog.ErrorContext(ctx, "MongoDB error getting history log", "logID", logID, "error", err)
 		return nil, err
 	}
 	logEntry.ID = logID
 	return &logEntry, nil
 }
 
+func (c *MongoClient) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	// LogAction stores the hex string as _id; match ObjectIDs too for older entries
+	ids := make([]interface{}, 0, 2*len(logs))
+	for _, entry := range logs {
+		ids = append(ids, entry.ID)
+		if oid, err := primitive.ObjectIDFromHex(entry.ID); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+	_, err := c.db.Collection(historyCollection).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		slog.ErrorContext(ctx, "MongoDB error deleting history logs", "count", len(logs), "error", err)
+		return err
+	}
+	return nil
+}
+
+// --- Backup Methods ---
+
+func (c *MongoClient) RestoreRecord(ctx context.Context, record interface{}) error {
+	var collName, id string
+	switch r := record.(type) {
+	case *models.User:
+		r.ID = r.Username // Users are keyed by username
+		collName, id = usersCollection, r.Username
+	case *models.Post:
+		collName, id = postsCollection, r.ID
+	case *models.CodeFile:
+		collName, id = codefilesCollection, r.ID
+	case *models.OwnershipTransfer:
+		collName, id = transfersCollection, r.ID
+	case *models.Workspace:
+		collName, id = workspacesCollection, r.ID
+	case *models.Template:
+		collName, id = templatesCollection, r.ID
+	case *models.Project:
+		collName, id = projectsCollection, r.ID
+	case *models.Asset:
+		collName, id = assetsCollection, r.ID
+	case *models.Comment:
+		collName, id = commentsCollection, r.ID
+	case *models.Report:
+		collName, id = reportsCollection, r.ID
+	default:
+		return fmt.Errorf("cannot restore record of type %T", record)
+	}
+	if id == "" {
+		return fmt.Errorf("cannot restore %T without an ID", record)
+	}
+
+	_, err := c.db.Collection(collName).ReplaceOne(ctx, bson.M{"_id": id}, record, options.Replace().SetUpsert(true))
+	if err != nil {
+		if collName == postsCollection && mongo.IsDuplicateKeyError(err) {
+			return database.ErrDuplicateSlug
+		}
+		slog.ErrorContext(ctx, "MongoDB error restoring record", "collection", collName, "id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
 // Optional: Helper function to create indexes
 // func createIndexes(ctx context.Context, db *mongo.Database) {
 // 	// Example: Index for listing posts/codefiles by user
@@ -0,0 +1,45 @@
+// internal/database/order.go
+package database
+
+import (
+	"sort"
+
+	"github.com/kkuzar/blog_system/internal/models"
+)
+
+// A user's post listing (ListPostMetaByUser) puts placed posts first: pinned ones, then
+// ranked ones, each by Rank (higher first) and then newest first. The remaining posts
+// follow, newest first. Users place few posts, so adapters that can't sort on the
+// placement fields load the placed posts separately and page through the rest.
+
+// IsPlaced reports whether a post has a manual placement in its owner's listing.
+func IsPlaced(post *models.Post) bool {
+	return post.Pinned || post.Rank > 0
+}
+
+// SortPlacedPosts sorts placed posts into listing order.
+func SortPlacedPosts(posts []models.Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := &posts[i], &posts[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+}
+
+// PlacedPage returns the part of a listing page taken by placed posts (sorted), and
+// the limit and offset to read the rest of the page with from the unplaced posts.
+func PlacedPage(placed []models.Post, limit, offset int) (page []models.Post, restLimit, restOffset int) {
+	if offset >= len(placed) {
+		return nil, limit, offset - len(placed)
+	}
+	page = placed[offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	return page, limit - len(page), 0
+}
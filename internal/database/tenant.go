@@ -0,0 +1,1196 @@
+// internal/database/tenant.go
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"sync"
+	"time"
+)
+
+// TenantScoper is implemented by adapters that can keep each tenant's data in a
+// namespace of its own (a database, table or collection tree).
+type TenantScoper interface {
+	// ForTenant returns an adapter for the tenant's namespace. It shares the receiver's
+	// connection, so closing it is a no-op.
+	ForTenant(ctx context.Context, tenantID string) (DBAdapter, error)
+}
+
+// ForTenants wraps db so every call goes to the namespace of the tenant in its context.
+// Calls without a tenant use db itself. db must implement TenantScoper.
+func ForTenants(db DBAdapter) (DBAdapter, error) {
+	scoper, ok := db.(TenantScoper)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T does not support tenants", ErrDBConfig, db)
+	}
+	return &tenantRouter{base: db, scoper: scoper, tenants: make(map[string]DBAdapter)}, nil
+}
+
+type tenantRouter struct {
+	base   DBAdapter
+	scoper TenantScoper
+
+	mu      sync.Mutex
+	tenants map[string]DBAdapter // Opened on first use
+}
+
+// adapter returns the adapter for the tenant of ctx.
+func (r *tenantRouter) adapter(ctx context.Context) (DBAdapter, error) {
+	tenantID := tenant.ID(ctx)
+	if tenantID == "" {
+		return r.base, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if db, ok := r.tenants[tenantID]; ok {
+		return db, nil
+	}
+	db, err := r.scoper.ForTenant(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database of tenant %s: %w", tenantID, err)
+	}
+	r.tenants[tenantID] = db
+	return db, nil
+}
+
+func (r *tenantRouter) Close(ctx context.Context) error {
+	return r.base.Close(ctx)
+}
+
+func (r *tenantRouter) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetUserByUsername(ctx, username)
+}
+
+func (r *tenantRouter) CreateUser(ctx context.Context, user *models.User) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.CreateUser(ctx, user)
+}
+
+func (r *tenantRouter) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AdjustUserStorage(ctx, userID, delta)
+}
+
+func (r *tenantRouter) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetUserPasswordHash(ctx, userID, passwordHash)
+}
+
+func (r *tenantRouter) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetUserSiteTheme(ctx, userID, theme)
+}
+
+func (r *tenantRouter) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetUserTimezone(ctx, userID, timezone)
+}
+
+func (r *tenantRouter) SetUserEmail(ctx context.Context, userID, email string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetUserEmail(ctx, userID, email)
+}
+
+func (r *tenantRouter) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetUserMuted(ctx, userID, types)
+}
+
+func (r *tenantRouter) ListUserIDs(ctx context.Context) ([]string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListUserIDs(ctx)
+}
+
+func (r *tenantRouter) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreatePostMeta(ctx, post)
+}
+
+func (r *tenantRouter) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPostMetaByID(ctx, postID)
+}
+
+func (r *tenantRouter) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPostMetaBySlug(ctx, userID, slug)
+}
+
+func (r *tenantRouter) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListPostMetaByUser(ctx, userID, limit, offset, includeArchived)
+}
+
+func (r *tenantRouter) UpdatePostMeta(ctx context.Context, post *models.Post) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.UpdatePostMeta(ctx, post)
+}
+
+func (r *tenantRouter) SetPostSlug(ctx context.Context, postID, slug string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostSlug(ctx, postID, slug)
+}
+
+func (r *tenantRouter) DeletePostMeta(ctx context.Context, postID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeletePostMeta(ctx, postID)
+}
+
+func (r *tenantRouter) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostPublished(ctx, postID, version, publishedAt, excerpt)
+}
+
+func (r *tenantRouter) SetPostUnpublished(ctx context.Context, postID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostUnpublished(ctx, postID)
+}
+
+func (r *tenantRouter) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostExcerpt(ctx, postID, excerpt, manual)
+}
+
+func (r *tenantRouter) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostSEO(ctx, postID, canonicalURL, metaDescription, noIndex)
+}
+
+func (r *tenantRouter) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostCoverImage(ctx, postID, assetID)
+}
+
+func (r *tenantRouter) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostCoAuthors(ctx, postID, coAuthors)
+}
+
+func (r *tenantRouter) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostLanguage(ctx, postID, language, translationOf)
+}
+
+func (r *tenantRouter) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostSchedule(ctx, postID, scheduledAt, version)
+}
+
+func (r *tenantRouter) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListDuePosts(ctx, before, limit)
+}
+
+func (r *tenantRouter) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostTakenDown(ctx, postID, takenDownAt)
+}
+
+func (r *tenantRouter) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListPostTranslations(ctx, userID, postID)
+}
+
+func (r *tenantRouter) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.PutSlugRedirect(ctx, redirect)
+}
+
+func (r *tenantRouter) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetSlugRedirect(ctx, userID, slug)
+}
+
+func (r *tenantRouter) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListSlugRedirectsByUser(ctx, userID)
+}
+
+func (r *tenantRouter) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteSlugRedirect(ctx, userID, slug)
+}
+
+func (r *tenantRouter) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.CreateDomain(ctx, domain)
+}
+
+func (r *tenantRouter) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetDomain(ctx, host)
+}
+
+func (r *tenantRouter) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListDomainsByUser(ctx, userID)
+}
+
+func (r *tenantRouter) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListVerifiedDomains(ctx)
+}
+
+func (r *tenantRouter) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetDomainVerified(ctx, host, verifiedAt)
+}
+
+func (r *tenantRouter) DeleteDomain(ctx context.Context, host string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteDomain(ctx, host)
+}
+
+func (r *tenantRouter) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.PutPushSubscription(ctx, sub)
+}
+
+func (r *tenantRouter) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListPushSubscriptions(ctx, userID)
+}
+
+func (r *tenantRouter) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeletePushSubscription(ctx, subscriptionID)
+}
+
+func (r *tenantRouter) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateCodeFileMeta(ctx, file)
+}
+
+func (r *tenantRouter) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetCodeFileMetaByID(ctx, fileID)
+}
+
+func (r *tenantRouter) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCodeFileMetaByUser(ctx, userID, limit, offset, includeArchived)
+}
+
+func (r *tenantRouter) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.UpdateCodeFileMeta(ctx, file)
+}
+
+func (r *tenantRouter) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.RenameCodeFile(ctx, fileID, fileName, path, language)
+}
+
+func (r *tenantRouter) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteCodeFileMeta(ctx, fileID)
+}
+
+func (r *tenantRouter) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateTransfer(ctx, transfer)
+}
+
+func (r *tenantRouter) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetTransferByID(ctx, transferID)
+}
+
+func (r *tenantRouter) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListPendingTransfersByRecipient(ctx, toUserID)
+}
+
+func (r *tenantRouter) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListTransfersByUser(ctx, userID)
+}
+
+func (r *tenantRouter) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.ResolveTransfer(ctx, transferID, status, resolvedAt)
+}
+
+func (r *tenantRouter) ReopenTransfer(ctx context.Context, transferID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.ReopenTransfer(ctx, transferID)
+}
+
+func (r *tenantRouter) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostOwner(ctx, postID, userID, s3Path)
+}
+
+func (r *tenantRouter) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCodeFileOwner(ctx, fileID, userID, s3Path)
+}
+
+func (r *tenantRouter) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.PutCollaborator(ctx, collab)
+}
+
+func (r *tenantRouter) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetCollaborator(ctx, itemID, itemType, userID)
+}
+
+func (r *tenantRouter) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCollaborators(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteCollaborator(ctx, itemID, itemType, userID)
+}
+
+func (r *tenantRouter) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.CreateVersionTag(ctx, tag)
+}
+
+func (r *tenantRouter) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetVersionTag(ctx, itemID, itemType, name)
+}
+
+func (r *tenantRouter) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListVersionTags(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteVersionTag(ctx, itemID, itemType, name)
+}
+
+func (r *tenantRouter) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateComment(ctx, comment)
+}
+
+func (r *tenantRouter) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetComment(ctx, itemID, itemType, commentID)
+}
+
+func (r *tenantRouter) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListComments(ctx, itemID, itemType, status, limit, offset)
+}
+
+func (r *tenantRouter) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCommentsByOwner(ctx, ownerUserID, status, limit, offset)
+}
+
+func (r *tenantRouter) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCommentsByAuthor(ctx, userID)
+}
+
+func (r *tenantRouter) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCommentStatus(ctx, itemID, itemType, commentID, status)
+}
+
+func (r *tenantRouter) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCommentAnchor(ctx, itemID, itemType, commentID, anchor)
+}
+
+func (r *tenantRouter) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCommentsOwner(ctx, itemID, itemType, ownerUserID)
+}
+
+func (r *tenantRouter) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteComment(ctx, itemID, itemType, commentID)
+}
+
+func (r *tenantRouter) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteComments(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateReport(ctx, report)
+}
+
+func (r *tenantRouter) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetReport(ctx, reportID)
+}
+
+func (r *tenantRouter) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListReports(ctx, status, limit, offset)
+}
+
+func (r *tenantRouter) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.ResolveReport(ctx, reportID, status, resolvedBy, note, resolvedAt)
+}
+
+func (r *tenantRouter) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SaveHookResult(ctx, result)
+}
+
+func (r *tenantRouter) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListHookResults(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteHookResults(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AddBookmark(ctx, bookmark)
+}
+
+func (r *tenantRouter) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteBookmark(ctx, userID, postID)
+}
+
+func (r *tenantRouter) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListBookmarksByUser(ctx, userID, limit, offset)
+}
+
+func (r *tenantRouter) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.CountPostBookmarks(ctx, postID)
+}
+
+func (r *tenantRouter) DeletePostBookmarks(ctx context.Context, postID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeletePostBookmarks(ctx, postID)
+}
+
+func (r *tenantRouter) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateWorkspace(ctx, workspace)
+}
+
+func (r *tenantRouter) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetWorkspaceByID(ctx, workspaceID)
+}
+
+func (r *tenantRouter) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListWorkspacesByUser(ctx, userID)
+}
+
+func (r *tenantRouter) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostWorkspace(ctx, postID, workspaceID)
+}
+
+func (r *tenantRouter) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCodeFileWorkspace(ctx, fileID, workspaceID)
+}
+
+func (r *tenantRouter) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListPostMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+}
+
+func (r *tenantRouter) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCodeFileMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+}
+
+func (r *tenantRouter) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateTemplate(ctx, template)
+}
+
+func (r *tenantRouter) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetTemplateByID(ctx, templateID)
+}
+
+func (r *tenantRouter) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListTemplatesByUser(ctx, userID)
+}
+
+func (r *tenantRouter) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.UpdateTemplate(ctx, template)
+}
+
+func (r *tenantRouter) DeleteTemplate(ctx context.Context, templateID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteTemplate(ctx, templateID)
+}
+
+func (r *tenantRouter) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateProject(ctx, project)
+}
+
+func (r *tenantRouter) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetProjectByID(ctx, projectID)
+}
+
+func (r *tenantRouter) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListProjectsByUser(ctx, userID, limit, offset)
+}
+
+func (r *tenantRouter) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCodeFileProject(ctx, fileID, projectID)
+}
+
+func (r *tenantRouter) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListCodeFileMetaByProject(ctx, projectID, limit)
+}
+
+func (r *tenantRouter) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateAsset(ctx, asset)
+}
+
+func (r *tenantRouter) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAssetByID(ctx, assetID)
+}
+
+func (r *tenantRouter) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListAssetsByUser(ctx, userID, limit, offset)
+}
+
+func (r *tenantRouter) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListAssetsByProject(ctx, projectID, limit)
+}
+
+func (r *tenantRouter) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.UpdateAsset(ctx, asset)
+}
+
+func (r *tenantRouter) DeleteAsset(ctx context.Context, assetID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteAsset(ctx, assetID)
+}
+
+func (r *tenantRouter) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostDeletedAt(ctx, postID, deletedAt)
+}
+
+func (r *tenantRouter) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCodeFileDeletedAt(ctx, fileID, deletedAt)
+}
+
+func (r *tenantRouter) ListTrashedPostMeta(ctx context.Context, q TrashQuery) ([]models.Post, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListTrashedPostMeta(ctx, q)
+}
+
+func (r *tenantRouter) ListTrashedCodeFileMeta(ctx context.Context, q TrashQuery) ([]models.CodeFile, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListTrashedCodeFileMeta(ctx, q)
+}
+
+func (r *tenantRouter) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostArchivedAt(ctx, postID, archivedAt)
+}
+
+func (r *tenantRouter) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetCodeFileArchivedAt(ctx, fileID, archivedAt)
+}
+
+func (r *tenantRouter) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AdjustPostRetainedBytes(ctx, postID, delta)
+}
+
+func (r *tenantRouter) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AdjustCodeFileRetainedBytes(ctx, fileID, delta)
+}
+
+func (r *tenantRouter) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.CreateShareLink(ctx, link)
+}
+
+func (r *tenantRouter) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetShareLink(ctx, linkID)
+}
+
+func (r *tenantRouter) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListShareLinksByUser(ctx, userID)
+}
+
+func (r *tenantRouter) DeleteShareLink(ctx context.Context, linkID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteShareLink(ctx, linkID)
+}
+
+func (r *tenantRouter) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostPinned(ctx, postID, pinned)
+}
+
+func (r *tenantRouter) SetPostRank(ctx context.Context, postID string, rank int) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.SetPostRank(ctx, postID, rank)
+}
+
+func (r *tenantRouter) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.IncrementItemStats(ctx, itemID, itemType, day, views, edits)
+}
+
+func (r *tenantRouter) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListItemStats(ctx, itemID, itemType, fromDay, toDay)
+}
+
+func (r *tenantRouter) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteItemStats(ctx, itemID, itemType)
+}
+
+func (r *tenantRouter) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.IncrementUsage(ctx, userID, keyID, day, requests, wsMessages)
+}
+
+func (r *tenantRouter) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListUsage(ctx, userID, fromDay, toDay)
+}
+
+func (r *tenantRouter) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.CreateWriteIntent(ctx, intent)
+}
+
+func (r *tenantRouter) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListWriteIntents(ctx, createdBefore, limit)
+}
+
+func (r *tenantRouter) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteWriteIntent(ctx, intentID)
+}
+
+func (r *tenantRouter) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.AppendJournal(ctx, entry)
+}
+
+func (r *tenantRouter) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListJournal(ctx, itemID, itemType, afterVersion, limit)
+}
+
+func (r *tenantRouter) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteJournal(ctx, itemID, itemType, beforeVersion)
+}
+
+func (r *tenantRouter) LogAction(ctx context.Context, log *models.HistoryLog) (string, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return db.LogAction(ctx, log)
+}
+
+func (r *tenantRouter) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetActionHistory(ctx, itemID, itemType, limit)
+}
+
+func (r *tenantRouter) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetActionHistoryUntil(ctx, itemID, itemType, until, limit)
+}
+
+func (r *tenantRouter) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListHistoryByUser(ctx, userID, until, limit)
+}
+
+func (r *tenantRouter) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListRecentHistory(ctx, since, limit)
+}
+
+func (r *tenantRouter) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.NextEventSeq(ctx, userID)
+}
+
+func (r *tenantRouter) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.ListHistoryEvents(ctx, ownerID, afterSeq, limit)
+}
+
+func (r *tenantRouter) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetHistoryLogByID(ctx, logID)
+}
+
+func (r *tenantRouter) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.DeleteHistoryLogs(ctx, logs)
+}
+
+func (r *tenantRouter) RestoreRecord(ctx context.Context, record interface{}) error {
+	db, err := r.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	return db.RestoreRecord(ctx, record)
+}
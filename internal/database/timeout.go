@@ -0,0 +1,879 @@
+// internal/database/timeout.go
+package database
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+	"time"
+)
+
+// WithTimeout wraps db so every call gives up after timeout, even if its context has a
+// later deadline (or none), so a slow or unreachable database fails the operation with
+// context.DeadlineExceeded instead of hanging it. A timeout of 0 returns db unchanged.
+func WithTimeout(db DBAdapter, timeout time.Duration) DBAdapter {
+	if timeout <= 0 {
+		return db
+	}
+	return &timeoutAdapter{db: db, timeout: timeout}
+}
+
+type timeoutAdapter struct {
+	db      DBAdapter
+	timeout time.Duration
+}
+
+func (a *timeoutAdapter) Close(ctx context.Context) error {
+	return a.db.Close(ctx)
+}
+
+func (a *timeoutAdapter) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetUserByUsername(ctx, username)
+}
+
+func (a *timeoutAdapter) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateUser(ctx, user)
+}
+
+func (a *timeoutAdapter) AdjustUserStorage(ctx context.Context, userID string, delta int64) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.AdjustUserStorage(ctx, userID, delta)
+}
+
+func (a *timeoutAdapter) SetUserPasswordHash(ctx context.Context, userID, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetUserPasswordHash(ctx, userID, passwordHash)
+}
+
+func (a *timeoutAdapter) SetUserSiteTheme(ctx context.Context, userID, theme string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetUserSiteTheme(ctx, userID, theme)
+}
+
+func (a *timeoutAdapter) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetUserTimezone(ctx, userID, timezone)
+}
+
+func (a *timeoutAdapter) SetUserEmail(ctx context.Context, userID, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetUserEmail(ctx, userID, email)
+}
+
+func (a *timeoutAdapter) SetUserMuted(ctx context.Context, userID string, types []string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetUserMuted(ctx, userID, types)
+}
+
+func (a *timeoutAdapter) ListUserIDs(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListUserIDs(ctx)
+}
+
+func (a *timeoutAdapter) CreatePostMeta(ctx context.Context, post *models.Post) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreatePostMeta(ctx, post)
+}
+
+func (a *timeoutAdapter) GetPostMetaByID(ctx context.Context, postID string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetPostMetaByID(ctx, postID)
+}
+
+func (a *timeoutAdapter) GetPostMetaBySlug(ctx context.Context, userID, slug string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetPostMetaBySlug(ctx, userID, slug)
+}
+
+func (a *timeoutAdapter) ListPostMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListPostMetaByUser(ctx, userID, limit, offset, includeArchived)
+}
+
+func (a *timeoutAdapter) UpdatePostMeta(ctx context.Context, post *models.Post) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.UpdatePostMeta(ctx, post)
+}
+
+func (a *timeoutAdapter) SetPostSlug(ctx context.Context, postID, slug string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostSlug(ctx, postID, slug)
+}
+
+func (a *timeoutAdapter) DeletePostMeta(ctx context.Context, postID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeletePostMeta(ctx, postID)
+}
+
+func (a *timeoutAdapter) SetPostPublished(ctx context.Context, postID string, version int, publishedAt time.Time, excerpt string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostPublished(ctx, postID, version, publishedAt, excerpt)
+}
+
+func (a *timeoutAdapter) SetPostUnpublished(ctx context.Context, postID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostUnpublished(ctx, postID)
+}
+
+func (a *timeoutAdapter) SetPostExcerpt(ctx context.Context, postID, excerpt string, manual bool) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostExcerpt(ctx, postID, excerpt, manual)
+}
+
+func (a *timeoutAdapter) SetPostSEO(ctx context.Context, postID, canonicalURL, metaDescription string, noIndex bool) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostSEO(ctx, postID, canonicalURL, metaDescription, noIndex)
+}
+
+func (a *timeoutAdapter) SetPostCoverImage(ctx context.Context, postID, assetID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostCoverImage(ctx, postID, assetID)
+}
+
+func (a *timeoutAdapter) SetPostCoAuthors(ctx context.Context, postID string, coAuthors []string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostCoAuthors(ctx, postID, coAuthors)
+}
+
+func (a *timeoutAdapter) SetPostLanguage(ctx context.Context, postID, language, translationOf string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostLanguage(ctx, postID, language, translationOf)
+}
+
+func (a *timeoutAdapter) SetPostSchedule(ctx context.Context, postID string, scheduledAt *time.Time, version int) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostSchedule(ctx, postID, scheduledAt, version)
+}
+
+func (a *timeoutAdapter) ListDuePosts(ctx context.Context, before time.Time, limit int) ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListDuePosts(ctx, before, limit)
+}
+
+func (a *timeoutAdapter) SetPostTakenDown(ctx context.Context, postID string, takenDownAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostTakenDown(ctx, postID, takenDownAt)
+}
+
+func (a *timeoutAdapter) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListPostTranslations(ctx, userID, postID)
+}
+
+func (a *timeoutAdapter) PutSlugRedirect(ctx context.Context, redirect *models.SlugRedirect) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.PutSlugRedirect(ctx, redirect)
+}
+
+func (a *timeoutAdapter) GetSlugRedirect(ctx context.Context, userID, slug string) (*models.SlugRedirect, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetSlugRedirect(ctx, userID, slug)
+}
+
+func (a *timeoutAdapter) ListSlugRedirectsByUser(ctx context.Context, userID string) ([]models.SlugRedirect, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListSlugRedirectsByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) DeleteSlugRedirect(ctx context.Context, userID, slug string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteSlugRedirect(ctx, userID, slug)
+}
+
+func (a *timeoutAdapter) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateDomain(ctx, domain)
+}
+
+func (a *timeoutAdapter) GetDomain(ctx context.Context, host string) (*models.Domain, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetDomain(ctx, host)
+}
+
+func (a *timeoutAdapter) ListDomainsByUser(ctx context.Context, userID string) ([]models.Domain, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListDomainsByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) ListVerifiedDomains(ctx context.Context) ([]models.Domain, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListVerifiedDomains(ctx)
+}
+
+func (a *timeoutAdapter) SetDomainVerified(ctx context.Context, host string, verifiedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetDomainVerified(ctx, host, verifiedAt)
+}
+
+func (a *timeoutAdapter) DeleteDomain(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteDomain(ctx, host)
+}
+
+func (a *timeoutAdapter) PutPushSubscription(ctx context.Context, sub *models.PushSubscription) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.PutPushSubscription(ctx, sub)
+}
+
+func (a *timeoutAdapter) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListPushSubscriptions(ctx, userID)
+}
+
+func (a *timeoutAdapter) DeletePushSubscription(ctx context.Context, subscriptionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeletePushSubscription(ctx, subscriptionID)
+}
+
+func (a *timeoutAdapter) CreateCodeFileMeta(ctx context.Context, file *models.CodeFile) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateCodeFileMeta(ctx, file)
+}
+
+func (a *timeoutAdapter) GetCodeFileMetaByID(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetCodeFileMetaByID(ctx, fileID)
+}
+
+func (a *timeoutAdapter) ListCodeFileMetaByUser(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCodeFileMetaByUser(ctx, userID, limit, offset, includeArchived)
+}
+
+func (a *timeoutAdapter) UpdateCodeFileMeta(ctx context.Context, file *models.CodeFile) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.UpdateCodeFileMeta(ctx, file)
+}
+
+func (a *timeoutAdapter) RenameCodeFile(ctx context.Context, fileID, fileName, path, language string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.RenameCodeFile(ctx, fileID, fileName, path, language)
+}
+
+func (a *timeoutAdapter) DeleteCodeFileMeta(ctx context.Context, fileID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteCodeFileMeta(ctx, fileID)
+}
+
+func (a *timeoutAdapter) CreateTransfer(ctx context.Context, transfer *models.OwnershipTransfer) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateTransfer(ctx, transfer)
+}
+
+func (a *timeoutAdapter) GetTransferByID(ctx context.Context, transferID string) (*models.OwnershipTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetTransferByID(ctx, transferID)
+}
+
+func (a *timeoutAdapter) ListPendingTransfersByRecipient(ctx context.Context, toUserID string) ([]models.OwnershipTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListPendingTransfersByRecipient(ctx, toUserID)
+}
+
+func (a *timeoutAdapter) ListTransfersByUser(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListTransfersByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) ResolveTransfer(ctx context.Context, transferID string, status models.TransferStatus, resolvedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ResolveTransfer(ctx, transferID, status, resolvedAt)
+}
+
+func (a *timeoutAdapter) ReopenTransfer(ctx context.Context, transferID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ReopenTransfer(ctx, transferID)
+}
+
+func (a *timeoutAdapter) SetPostOwner(ctx context.Context, postID, userID, s3Path string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostOwner(ctx, postID, userID, s3Path)
+}
+
+func (a *timeoutAdapter) SetCodeFileOwner(ctx context.Context, fileID, userID, s3Path string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCodeFileOwner(ctx, fileID, userID, s3Path)
+}
+
+func (a *timeoutAdapter) PutCollaborator(ctx context.Context, collab *models.Collaborator) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.PutCollaborator(ctx, collab)
+}
+
+func (a *timeoutAdapter) GetCollaborator(ctx context.Context, itemID, itemType, userID string) (*models.Collaborator, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetCollaborator(ctx, itemID, itemType, userID)
+}
+
+func (a *timeoutAdapter) ListCollaborators(ctx context.Context, itemID, itemType string) ([]models.Collaborator, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCollaborators(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) DeleteCollaborator(ctx context.Context, itemID, itemType, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteCollaborator(ctx, itemID, itemType, userID)
+}
+
+func (a *timeoutAdapter) CreateVersionTag(ctx context.Context, tag *models.VersionTag) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateVersionTag(ctx, tag)
+}
+
+func (a *timeoutAdapter) GetVersionTag(ctx context.Context, itemID, itemType, name string) (*models.VersionTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetVersionTag(ctx, itemID, itemType, name)
+}
+
+func (a *timeoutAdapter) ListVersionTags(ctx context.Context, itemID, itemType string) ([]models.VersionTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListVersionTags(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) DeleteVersionTag(ctx context.Context, itemID, itemType, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteVersionTag(ctx, itemID, itemType, name)
+}
+
+func (a *timeoutAdapter) CreateComment(ctx context.Context, comment *models.Comment) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateComment(ctx, comment)
+}
+
+func (a *timeoutAdapter) GetComment(ctx context.Context, itemID, itemType, commentID string) (*models.Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetComment(ctx, itemID, itemType, commentID)
+}
+
+func (a *timeoutAdapter) ListComments(ctx context.Context, itemID, itemType string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListComments(ctx, itemID, itemType, status, limit, offset)
+}
+
+func (a *timeoutAdapter) ListCommentsByOwner(ctx context.Context, ownerUserID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCommentsByOwner(ctx, ownerUserID, status, limit, offset)
+}
+
+func (a *timeoutAdapter) ListCommentsByAuthor(ctx context.Context, userID string) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCommentsByAuthor(ctx, userID)
+}
+
+func (a *timeoutAdapter) SetCommentStatus(ctx context.Context, itemID, itemType, commentID string, status models.CommentStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCommentStatus(ctx, itemID, itemType, commentID, status)
+}
+
+func (a *timeoutAdapter) SetCommentAnchor(ctx context.Context, itemID, itemType, commentID string, anchor *models.CommentAnchor) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCommentAnchor(ctx, itemID, itemType, commentID, anchor)
+}
+
+func (a *timeoutAdapter) SetCommentsOwner(ctx context.Context, itemID, itemType, ownerUserID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCommentsOwner(ctx, itemID, itemType, ownerUserID)
+}
+
+func (a *timeoutAdapter) DeleteComment(ctx context.Context, itemID, itemType, commentID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteComment(ctx, itemID, itemType, commentID)
+}
+
+func (a *timeoutAdapter) DeleteComments(ctx context.Context, itemID, itemType string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteComments(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) CreateReport(ctx context.Context, report *models.Report) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateReport(ctx, report)
+}
+
+func (a *timeoutAdapter) GetReport(ctx context.Context, reportID string) (*models.Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetReport(ctx, reportID)
+}
+
+func (a *timeoutAdapter) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListReports(ctx, status, limit, offset)
+}
+
+func (a *timeoutAdapter) ResolveReport(ctx context.Context, reportID string, status models.ReportStatus, resolvedBy, note string, resolvedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ResolveReport(ctx, reportID, status, resolvedBy, note, resolvedAt)
+}
+
+func (a *timeoutAdapter) SaveHookResult(ctx context.Context, result *models.HookResult) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SaveHookResult(ctx, result)
+}
+
+func (a *timeoutAdapter) ListHookResults(ctx context.Context, itemID, itemType string) ([]models.HookResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListHookResults(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) DeleteHookResults(ctx context.Context, itemID, itemType string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteHookResults(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) AddBookmark(ctx context.Context, bookmark *models.Bookmark) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.AddBookmark(ctx, bookmark)
+}
+
+func (a *timeoutAdapter) DeleteBookmark(ctx context.Context, userID, postID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteBookmark(ctx, userID, postID)
+}
+
+func (a *timeoutAdapter) ListBookmarksByUser(ctx context.Context, userID string, limit, offset int) ([]models.Bookmark, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListBookmarksByUser(ctx, userID, limit, offset)
+}
+
+func (a *timeoutAdapter) CountPostBookmarks(ctx context.Context, postID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CountPostBookmarks(ctx, postID)
+}
+
+func (a *timeoutAdapter) DeletePostBookmarks(ctx context.Context, postID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeletePostBookmarks(ctx, postID)
+}
+
+func (a *timeoutAdapter) CreateWorkspace(ctx context.Context, workspace *models.Workspace) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateWorkspace(ctx, workspace)
+}
+
+func (a *timeoutAdapter) GetWorkspaceByID(ctx context.Context, workspaceID string) (*models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetWorkspaceByID(ctx, workspaceID)
+}
+
+func (a *timeoutAdapter) ListWorkspacesByUser(ctx context.Context, userID string) ([]models.Workspace, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListWorkspacesByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) SetPostWorkspace(ctx context.Context, postID, workspaceID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostWorkspace(ctx, postID, workspaceID)
+}
+
+func (a *timeoutAdapter) SetCodeFileWorkspace(ctx context.Context, fileID, workspaceID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCodeFileWorkspace(ctx, fileID, workspaceID)
+}
+
+func (a *timeoutAdapter) ListPostMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListPostMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+}
+
+func (a *timeoutAdapter) ListCodeFileMetaByWorkspace(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCodeFileMetaByWorkspace(ctx, userID, workspaceID, limit, offset, includeArchived)
+}
+
+func (a *timeoutAdapter) CreateTemplate(ctx context.Context, template *models.Template) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateTemplate(ctx, template)
+}
+
+func (a *timeoutAdapter) GetTemplateByID(ctx context.Context, templateID string) (*models.Template, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetTemplateByID(ctx, templateID)
+}
+
+func (a *timeoutAdapter) ListTemplatesByUser(ctx context.Context, userID string) ([]models.Template, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListTemplatesByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.UpdateTemplate(ctx, template)
+}
+
+func (a *timeoutAdapter) DeleteTemplate(ctx context.Context, templateID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteTemplate(ctx, templateID)
+}
+
+func (a *timeoutAdapter) CreateProject(ctx context.Context, project *models.Project) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateProject(ctx, project)
+}
+
+func (a *timeoutAdapter) GetProjectByID(ctx context.Context, projectID string) (*models.Project, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetProjectByID(ctx, projectID)
+}
+
+func (a *timeoutAdapter) ListProjectsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListProjectsByUser(ctx, userID, limit, offset)
+}
+
+func (a *timeoutAdapter) SetCodeFileProject(ctx context.Context, fileID, projectID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCodeFileProject(ctx, fileID, projectID)
+}
+
+func (a *timeoutAdapter) ListCodeFileMetaByProject(ctx context.Context, projectID string, limit int) ([]models.CodeFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListCodeFileMetaByProject(ctx, projectID, limit)
+}
+
+func (a *timeoutAdapter) CreateAsset(ctx context.Context, asset *models.Asset) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateAsset(ctx, asset)
+}
+
+func (a *timeoutAdapter) GetAssetByID(ctx context.Context, assetID string) (*models.Asset, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetAssetByID(ctx, assetID)
+}
+
+func (a *timeoutAdapter) ListAssetsByUser(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListAssetsByUser(ctx, userID, limit, offset)
+}
+
+func (a *timeoutAdapter) ListAssetsByProject(ctx context.Context, projectID string, limit int) ([]models.Asset, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListAssetsByProject(ctx, projectID, limit)
+}
+
+func (a *timeoutAdapter) UpdateAsset(ctx context.Context, asset *models.Asset) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.UpdateAsset(ctx, asset)
+}
+
+func (a *timeoutAdapter) DeleteAsset(ctx context.Context, assetID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteAsset(ctx, assetID)
+}
+
+func (a *timeoutAdapter) SetPostDeletedAt(ctx context.Context, postID string, deletedAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostDeletedAt(ctx, postID, deletedAt)
+}
+
+func (a *timeoutAdapter) SetCodeFileDeletedAt(ctx context.Context, fileID string, deletedAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCodeFileDeletedAt(ctx, fileID, deletedAt)
+}
+
+func (a *timeoutAdapter) ListTrashedPostMeta(ctx context.Context, q TrashQuery) ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListTrashedPostMeta(ctx, q)
+}
+
+func (a *timeoutAdapter) ListTrashedCodeFileMeta(ctx context.Context, q TrashQuery) ([]models.CodeFile, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListTrashedCodeFileMeta(ctx, q)
+}
+
+func (a *timeoutAdapter) SetPostArchivedAt(ctx context.Context, postID string, archivedAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostArchivedAt(ctx, postID, archivedAt)
+}
+
+func (a *timeoutAdapter) SetCodeFileArchivedAt(ctx context.Context, fileID string, archivedAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetCodeFileArchivedAt(ctx, fileID, archivedAt)
+}
+
+func (a *timeoutAdapter) AdjustPostRetainedBytes(ctx context.Context, postID string, delta int64) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.AdjustPostRetainedBytes(ctx, postID, delta)
+}
+
+func (a *timeoutAdapter) AdjustCodeFileRetainedBytes(ctx context.Context, fileID string, delta int64) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.AdjustCodeFileRetainedBytes(ctx, fileID, delta)
+}
+
+func (a *timeoutAdapter) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateShareLink(ctx, link)
+}
+
+func (a *timeoutAdapter) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetShareLink(ctx, linkID)
+}
+
+func (a *timeoutAdapter) ListShareLinksByUser(ctx context.Context, userID string) ([]models.ShareLink, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListShareLinksByUser(ctx, userID)
+}
+
+func (a *timeoutAdapter) DeleteShareLink(ctx context.Context, linkID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteShareLink(ctx, linkID)
+}
+
+func (a *timeoutAdapter) SetPostPinned(ctx context.Context, postID string, pinned bool) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostPinned(ctx, postID, pinned)
+}
+
+func (a *timeoutAdapter) SetPostRank(ctx context.Context, postID string, rank int) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.SetPostRank(ctx, postID, rank)
+}
+
+func (a *timeoutAdapter) IncrementItemStats(ctx context.Context, itemID, itemType, day string, views, edits int64) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.IncrementItemStats(ctx, itemID, itemType, day, views, edits)
+}
+
+func (a *timeoutAdapter) ListItemStats(ctx context.Context, itemID, itemType, fromDay, toDay string) ([]models.ItemStatsDay, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListItemStats(ctx, itemID, itemType, fromDay, toDay)
+}
+
+func (a *timeoutAdapter) DeleteItemStats(ctx context.Context, itemID, itemType string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteItemStats(ctx, itemID, itemType)
+}
+
+func (a *timeoutAdapter) IncrementUsage(ctx context.Context, userID, keyID, day string, requests, wsMessages int64) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.IncrementUsage(ctx, userID, keyID, day, requests, wsMessages)
+}
+
+func (a *timeoutAdapter) ListUsage(ctx context.Context, userID, fromDay, toDay string) ([]models.UsageDay, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListUsage(ctx, userID, fromDay, toDay)
+}
+
+func (a *timeoutAdapter) CreateWriteIntent(ctx context.Context, intent *models.WriteIntent) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.CreateWriteIntent(ctx, intent)
+}
+
+func (a *timeoutAdapter) ListWriteIntents(ctx context.Context, createdBefore time.Time, limit int) ([]models.WriteIntent, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListWriteIntents(ctx, createdBefore, limit)
+}
+
+func (a *timeoutAdapter) DeleteWriteIntent(ctx context.Context, intentID string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteWriteIntent(ctx, intentID)
+}
+
+func (a *timeoutAdapter) AppendJournal(ctx context.Context, entry *models.JournalEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.AppendJournal(ctx, entry)
+}
+
+func (a *timeoutAdapter) ListJournal(ctx context.Context, itemID, itemType string, afterVersion, limit int) ([]models.JournalEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListJournal(ctx, itemID, itemType, afterVersion, limit)
+}
+
+func (a *timeoutAdapter) DeleteJournal(ctx context.Context, itemID, itemType string, beforeVersion int) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteJournal(ctx, itemID, itemType, beforeVersion)
+}
+
+func (a *timeoutAdapter) LogAction(ctx context.Context, log *models.HistoryLog) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.LogAction(ctx, log)
+}
+
+func (a *timeoutAdapter) GetActionHistory(ctx context.Context, itemID string, itemType string, limit int) ([]models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetActionHistory(ctx, itemID, itemType, limit)
+}
+
+func (a *timeoutAdapter) GetActionHistoryUntil(ctx context.Context, itemID, itemType string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetActionHistoryUntil(ctx, itemID, itemType, until, limit)
+}
+
+func (a *timeoutAdapter) ListHistoryByUser(ctx context.Context, userID string, until time.Time, limit int) ([]models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListHistoryByUser(ctx, userID, until, limit)
+}
+
+func (a *timeoutAdapter) ListRecentHistory(ctx context.Context, since time.Time, limit int) ([]models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListRecentHistory(ctx, since, limit)
+}
+
+func (a *timeoutAdapter) NextEventSeq(ctx context.Context, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.NextEventSeq(ctx, userID)
+}
+
+func (a *timeoutAdapter) ListHistoryEvents(ctx context.Context, ownerID string, afterSeq int64, limit int) ([]models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.ListHistoryEvents(ctx, ownerID, afterSeq, limit)
+}
+
+func (a *timeoutAdapter) GetHistoryLogByID(ctx context.Context, logID string) (*models.HistoryLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.GetHistoryLogByID(ctx, logID)
+}
+
+func (a *timeoutAdapter) DeleteHistoryLogs(ctx context.Context, logs []models.HistoryLog) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.DeleteHistoryLogs(ctx, logs)
+}
+
+func (a *timeoutAdapter) RestoreRecord(ctx context.Context, record interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.db.RestoreRecord(ctx, record)
+}
@@ -0,0 +1,301 @@
+// internal/diff/diff.go
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OpKind describes how a line changed between two texts.
+type OpKind string
+
+const (
+	OpEqual  OpKind = "equal"
+	OpInsert OpKind = "insert"
+	OpDelete OpKind = "delete"
+)
+
+// Line is a single line in a hunk. OldLine/NewLine are 1-based and 0 when
+// the line doesn't exist on that side (inserts have no OldLine, deletes no NewLine).
+type Line struct {
+	Kind    OpKind `json:"kind"`
+	Text    string `json:"text"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+// Hunk is a contiguous region of changes plus surrounding context, as in unified diff.
+type Hunk struct {
+	OldStart int    `json:"oldStart"`
+	OldLines int    `json:"oldLines"`
+	NewStart int    `json:"newStart"`
+	NewLines int    `json:"newLines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Result is a structured line diff together with its unified-diff rendering.
+type Result struct {
+	Hunks   []Hunk `json:"hunks"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Unified string `json:"unified"`
+}
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+// Lines computes a line-based diff between oldText and newText.
+// oldName/newName label the unified output headers (e.g. "v3", "v5").
+func Lines(oldText, newText, oldName, newName string, context int) *Result {
+	if context < 0 {
+		context = DefaultContext
+	}
+	ops := lineOps(splitLines(oldText), splitLines(newText))
+
+	res := &Result{Hunks: buildHunks(ops, context)}
+	for _, op := range ops {
+		switch op.Kind {
+		case OpInsert:
+			res.Added++
+		case OpDelete:
+			res.Removed++
+		}
+	}
+	res.Unified = renderUnified(res.Hunks, oldName, newName)
+	return res
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps returns the full edit script (including equal lines) turning a into b.
+func lineOps(a, b []string) []Line {
+	// Strip common prefix and suffix; Myers only needs to run on the middle.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]Line, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, Line{Kind: OpEqual, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+	for _, op := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if op.OldLine > 0 {
+			op.OldLine += prefix
+		}
+		if op.NewLine > 0 {
+			op.NewLine += prefix
+		}
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		oi, ni := len(a)-suffix+i, len(b)-suffix+i
+		ops = append(ops, Line{Kind: OpEqual, Text: a[oi], OldLine: oi + 1, NewLine: ni + 1})
+	}
+	return ops
+}
+
+// Limits on the middle part (after the common prefix and suffix) that myers diffs. Its
+// trace keeps O(D^2) ints for edit distance D, so beyond them the middle is replaced as a
+// whole: the diff is still correct, just not minimal.
+const (
+	maxDiffLines    = 20000 // Lines on either side
+	maxEditDistance = 1000  // Inserted plus deleted lines
+)
+
+// myers implements the greedy O(ND) shortest edit script algorithm, falling back to
+// replaceAll beyond maxDiffLines or maxEditDistance.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	if n > maxDiffLines || m > maxDiffLines {
+		return replaceAll(a, b)
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= min(max, maxEditDistance); d++ {
+		// Only v[-d-1..d+1] can be read back at this d; see backtrack
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Move down (insert)
+			} else {
+				x = v[offset+k-1] + 1 // Move right (delete)
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return replaceAll(a, b)
+}
+
+// backtrack walks trace, where trace[d] holds v[-d-1..d+1] before step d, back from the
+// end of a and b to the start.
+func backtrack(trace [][]int, a, b []string) []Line {
+	x, y := len(a), len(b)
+	var rev []Line
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, Line{Kind: OpEqual, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, Line{Kind: OpInsert, Text: b[y-1], NewLine: y})
+			} else {
+				rev = append(rev, Line{Kind: OpDelete, Text: a[x-1], OldLine: x})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]Line, len(rev))
+	for i := range rev {
+		ops[i] = rev[len(rev)-1-i]
+	}
+	return ops
+}
+
+// replaceAll returns the edit script deleting all of a, then inserting all of b.
+func replaceAll(a, b []string) []Line {
+	ops := make([]Line, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, Line{Kind: OpDelete, Text: line, OldLine: i + 1})
+	}
+	for i, line := range b {
+		ops = append(ops, Line{Kind: OpInsert, Text: line, NewLine: i + 1})
+	}
+	return ops
+}
+
+// buildHunks groups changes that are within 2*context lines of each other.
+func buildHunks(ops []Line, context int) []Hunk {
+	var hunks []Hunk
+	i := 0
+	for i < len(ops) {
+		// Find the next change
+		for i < len(ops) && ops[i].Kind == OpEqual {
+			i++
+		}
+		if i >= len(ops) {
+			break
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend while the gap between changes stays within 2*context equal lines
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != OpEqual {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(ops) && ops[gap].Kind == OpEqual {
+				gap++
+			}
+			if gap == len(ops) || gap-end > 2*context {
+				end += min(context, gap-end)
+				break
+			}
+			end = gap
+		}
+
+		hunks = append(hunks, newHunk(ops[start:end]))
+		i = end
+	}
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.OldLine > 0 {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldLine
+			}
+			h.OldLines++
+		}
+		if l.NewLine > 0 {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+func renderUnified(hunks []Hunk, oldName, newName string) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case OpEqual:
+				sb.WriteByte(' ')
+			case OpInsert:
+				sb.WriteByte('+')
+			case OpDelete:
+				sb.WriteByte('-')
+			}
+			sb.WriteString(l.Text)
+			if !strings.HasSuffix(l.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
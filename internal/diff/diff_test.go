@@ -0,0 +1,47 @@
+// internal/diff/diff_test.go
+package diff
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func numberedLines(prefix string, n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%s %d\n", prefix, i)
+	}
+	return sb.String()
+}
+
+func TestLinesDisjointInputsBoundedMemory(t *testing.T) {
+	const n = 10000
+	oldText, newText := numberedLines("old", n), numberedLines("new", n)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	res := Lines(oldText, newText, "a", "b", DefaultContext)
+	runtime.ReadMemStats(&after)
+
+	if res.Added != n || res.Removed != n {
+		t.Fatalf("got +%d -%d, want +%d -%d", res.Added, res.Removed, n, n)
+	}
+	if len(res.Hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(res.Hunks))
+	}
+	const limit = 64 << 20
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > limit {
+		t.Fatalf("allocated %d MB, want at most %d MB", allocated>>20, limit>>20)
+	}
+}
+
+func TestLinesSmallEdit(t *testing.T) {
+	res := Lines("a\nb\nc\n", "a\nx\nc\n", "a", "b", DefaultContext)
+	want := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"
+	if res.Unified != want {
+		t.Fatalf("got %q, want %q", res.Unified, want)
+	}
+}
@@ -0,0 +1,151 @@
+// internal/diff/merge.go
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict is a region that both sides changed differently relative to base.
+// BaseStart is the 1-based line in base where the region starts.
+type Conflict struct {
+	BaseStart int      `json:"baseStart"`
+	Base      []string `json:"base"`
+	Ours      []string `json:"ours"`
+	Theirs    []string `json:"theirs"`
+}
+
+// MergeResult is the outcome of a three-way merge. When Conflicts is non-empty,
+// Merged contains both sides of each conflict wrapped in git-style markers.
+type MergeResult struct {
+	Merged    string     `json:"merged"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+}
+
+// Clean reports whether the merge completed without conflicts.
+func (r *MergeResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// Merge3 performs a line-based three-way merge (diff3) of ours and theirs,
+// both derived from base. oursName/theirsName label the conflict markers.
+func Merge3(base, ours, theirs, oursName, theirsName string) *MergeResult {
+	a, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchO, matchT := matchLines(a, o), matchLines(a, t)
+
+	res := &MergeResult{}
+	var sb strings.Builder
+	i, jo, jt := 0, 0, 0
+	for i < len(a) || jo < len(o) || jt < len(t) {
+		// Base line kept unchanged on both sides: copy it through
+		if i < len(a) && matchO[i] == jo && matchT[i] == jt {
+			sb.WriteString(a[i])
+			i, jo, jt = i+1, jo+1, jt+1
+			continue
+		}
+
+		// Find the next base line both sides kept; everything before it is a changed chunk
+		ni, no, nt := len(a), len(o), len(t)
+		for k := i; k < len(a); k++ {
+			if matchO[k] >= 0 && matchT[k] >= 0 {
+				ni, no, nt = k, matchO[k], matchT[k]
+				break
+			}
+		}
+		baseChunk, oursChunk, theirsChunk := a[i:ni], o[jo:no], t[jt:nt]
+
+		switch {
+		case slices.Equal(oursChunk, baseChunk):
+			writeLines(&sb, theirsChunk)
+		case slices.Equal(theirsChunk, baseChunk), slices.Equal(oursChunk, theirsChunk):
+			writeLines(&sb, oursChunk)
+		default:
+			res.Conflicts = append(res.Conflicts, Conflict{
+				BaseStart: i + 1,
+				Base:      baseChunk,
+				Ours:      oursChunk,
+				Theirs:    theirsChunk,
+			})
+			writeMarker(&sb, "<<<<<<< "+oursName)
+			writeLines(&sb, oursChunk)
+			writeMarker(&sb, "=======")
+			writeLines(&sb, theirsChunk)
+			writeMarker(&sb, ">>>>>>> "+theirsName)
+		}
+		i, jo, jt = ni, no, nt
+	}
+
+	res.Merged = sb.String()
+	return res
+}
+
+// matchLines maps each line of a to the 0-based index of the line in b it is
+// kept as, or -1 if it was deleted.
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, op := range lineOps(a, b) {
+		if op.Kind == OpEqual {
+			match[op.OldLine-1] = op.NewLine - 1
+		}
+	}
+	return match
+}
+
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, l := range lines {
+		sb.WriteString(l)
+	}
+}
+
+// writeMarker writes a conflict marker on its own line, terminating any
+// preceding line that lacked a trailing newline.
+func writeMarker(sb *strings.Builder, marker string) {
+	if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(marker)
+	sb.WriteByte('\n')
+}
+
+// Edit replaces the old-text lines starting at 0-based line Start with NewText.
+// OldText is the exact text being replaced (possibly empty for pure inserts).
+type Edit struct {
+	Start   int    `json:"start"`
+	OldText string `json:"oldText"`
+	NewText string `json:"newText"`
+}
+
+// Edits returns the line-level edits that turn oldText into newText, in
+// ascending order of Start. Applying them last-to-first keeps earlier
+// line numbers valid.
+func Edits(oldText, newText string) []Edit {
+	var edits []Edit
+	var cur *Edit
+	oldLine := 0
+	for _, op := range lineOps(splitLines(oldText), splitLines(newText)) {
+		if op.Kind == OpEqual {
+			if cur != nil {
+				edits = append(edits, *cur)
+				cur = nil
+			}
+			oldLine++
+			continue
+		}
+		if cur == nil {
+			cur = &Edit{Start: oldLine}
+		}
+		if op.Kind == OpDelete {
+			cur.OldText += op.Text
+			oldLine++
+		} else {
+			cur.NewText += op.Text
+		}
+	}
+	if cur != nil {
+		edits = append(edits, *cur)
+	}
+	return edits
+}
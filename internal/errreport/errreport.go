@@ -0,0 +1,249 @@
+// Package errreport sends incidents that need someone's attention (panics, 5xx responses
+// and inconsistencies between the database and storage) to an error tracker or a webhook,
+// in addition to the log, so they page someone instead of scrolling by.
+package errreport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Levels of an event.
+const (
+	LevelError = "error"
+	LevelFatal = "fatal" // Panics
+)
+
+const (
+	queueSize      = 256              // Events waiting to be sent; more are dropped
+	sendTimeout    = 10 * time.Second // Per event and sink
+	repeatInterval = time.Minute      // Repeats of an incident within this are dropped
+)
+
+// Event is an incident to report.
+type Event struct {
+	ID          string                 `json:"id"`
+	Time        time.Time              `json:"time"`
+	Level       string                 `json:"level"`
+	Message     string                 `json:"message"`
+	Error       string                 `json:"error,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`  // Request fields: requestID, tenantID, userID, action
+	Extra       map[string]interface{} `json:"extra,omitempty"` // Details, e.g. the item involved
+	Environment string                 `json:"environment,omitempty"`
+	ServerName  string                 `json:"serverName,omitempty"`
+
+	fingerprint string // Identifies repeats; defaults to the level, message and error
+}
+
+// Sink delivers events to an error tracker or alerting system.
+type Sink interface {
+	Send(ctx context.Context, event *Event) error
+}
+
+// Reporter queues events and sends them to its sinks in the background, so reporting
+// never holds up the request or write that ran into the problem.
+type Reporter struct {
+	sinks       []Sink
+	environment string
+	serverName  string
+	report5xx   bool
+	client      *http.Client
+
+	queue chan *Event
+	done  chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	lastSent map[string]time.Time // By fingerprint
+}
+
+// NewReporter creates a reporter for the sinks cfg configures and starts sending, or
+// returns nil if none is configured.
+func NewReporter(cfg *config.ErrorReportConfig) (*Reporter, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	r := &Reporter{
+		environment: cfg.Environment,
+		report5xx:   cfg.Report5xx,
+		client:      &http.Client{Timeout: sendTimeout},
+		queue:       make(chan *Event, queueSize),
+		done:        make(chan struct{}),
+		lastSent:    make(map[string]time.Time),
+	}
+	r.serverName, _ = os.Hostname()
+	if cfg.SentryDSN != "" {
+		sink, err := NewSentrySink(cfg.SentryDSN, r.client)
+		if err != nil {
+			return nil, err
+		}
+		r.sinks = append(r.sinks, sink)
+	}
+	if cfg.WebhookURL != "" {
+		r.sinks = append(r.sinks, NewWebhookSink(cfg.WebhookURL, r.client))
+	}
+	go r.run()
+	return r, nil
+}
+
+// Report queues event, filling in its ID, time, request fields (from ctx) and origin.
+// Repeats of an incident sent less than a minute ago are dropped.
+func (r *Reporter) Report(ctx context.Context, event *Event) {
+	event.ID = newEventID()
+	event.Time = time.Now().UTC()
+	event.Tags = logging.Fields(ctx)
+	event.Environment = r.environment
+	event.ServerName = r.serverName
+	if event.fingerprint == "" {
+		event.fingerprint = event.Level + "|" + event.Message + "|" + event.Error
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if last, ok := r.lastSent[event.fingerprint]; ok && event.Time.Sub(last) < repeatInterval {
+		return
+	}
+	select {
+	case r.queue <- event:
+		r.lastSent[event.fingerprint] = event.Time
+		r.forgetOld(event.Time)
+	default:
+		slog.WarnContext(ctx, "Error report queue full, dropping event", "message", event.Message)
+	}
+}
+
+// forgetOld drops fingerprints no longer needed to spot repeats, once there are many.
+func (r *Reporter) forgetOld(now time.Time) {
+	if len(r.lastSent) < 1024 {
+		return
+	}
+	for fingerprint, last := range r.lastSent {
+		if now.Sub(last) >= repeatInterval {
+			delete(r.lastSent, fingerprint)
+		}
+	}
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	for event := range r.queue {
+		for _, sink := range r.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			if err := sink.Send(ctx, event); err != nil {
+				slog.Warn("Failed to send error report", "eventID", event.ID, "message", event.Message, "sink", fmt.Sprintf("%T", sink), "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be sent, until ctx is
+// done.
+func (r *Reporter) Close(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("error reports still queued")
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// defaultReporter receives the events of the package-level functions; nil discards them.
+var defaultReporter atomic.Pointer[Reporter]
+
+// SetDefault makes r the reporter of the package-level functions (nil to stop reporting).
+func SetDefault(r *Reporter) {
+	defaultReporter.Store(r)
+}
+
+// Error reports err, met while doing what message describes, with details given as
+// key-value pairs like a log line's.
+func Error(ctx context.Context, message string, err error, args ...any) {
+	r := defaultReporter.Load()
+	if r == nil {
+		return
+	}
+	event := &Event{Level: LevelError, Message: message, Extra: extra(args)}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	r.Report(ctx, event)
+}
+
+// Panic reports a recovered panic with the stack it was raised on.
+func Panic(ctx context.Context, message string, value any, stack []byte, args ...any) {
+	r := defaultReporter.Load()
+	if r == nil {
+		return
+	}
+	r.Report(ctx, &Event{
+		Level: LevelFatal, Message: message, Error: fmt.Sprint(value), Stack: string(stack), Extra: extra(args),
+	})
+}
+
+// Response reports that a request got a 5xx response, if that is enabled. Repeats are
+// told apart by the request's method and path.
+func Response(ctx context.Context, method, path string, status int) {
+	r := defaultReporter.Load()
+	if r == nil || !r.report5xx {
+		return
+	}
+	event := &Event{
+		Level: LevelError, Message: "Server error response", Error: fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Extra: map[string]interface{}{"method": method, "path": path, "status": status},
+	}
+	event.fingerprint = fmt.Sprintf("%d %s %s", status, method, path)
+	r.Report(ctx, event)
+}
+
+// extra turns key-value pairs into event details; values that don't marshal to JSON as
+// themselves are formatted as text.
+func extra(args []any) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	details := make(map[string]interface{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			continue
+		}
+		switch value := args[i+1].(type) {
+		case string, bool, int, int64, float64:
+			details[key] = value
+		default:
+			details[key] = fmt.Sprint(value)
+		}
+	}
+	return details
+}
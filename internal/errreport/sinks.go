@@ -0,0 +1,146 @@
+// internal/errreport/sinks.go
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SentrySink sends events to Sentry, or a service speaking its store API (e.g.
+// GlitchTip), without the SDK.
+type SentrySink struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+// NewSentrySink creates a sink for the project a DSN such as
+// https://<key>@o0.ingest.sentry.io/<project> names.
+func NewSentrySink(dsn string, client *http.Client) (*SentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN %q: want <scheme>://<key>@<host>/<project>", redactDSN(dsn))
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	projectID := path[slash+1:]
+	if slash < 0 || projectID == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN %q: no project ID", redactDSN(dsn))
+	}
+	auth := "Sentry sentry_version=7, sentry_client=blog_system/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret // Only older DSNs have one
+	}
+	return &SentrySink{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:slash], projectID),
+		auth:     auth,
+		client:   client,
+	}, nil
+}
+
+// redactDSN drops the key from a DSN, for error messages.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		u.User = url.User("REDACTED")
+		return u.String()
+	}
+	return "REDACTED"
+}
+
+// sentryEvent is an event in the format of Sentry's store API.
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	Message     string                 `json:"message"`
+	Exception   *sentryExceptions      `json:"exception,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (s *SentrySink) Send(ctx context.Context, event *Event) error {
+	payload := sentryEvent{
+		EventID:     event.ID,
+		Timestamp:   event.Time.Format(time.RFC3339),
+		Level:       event.Level,
+		Logger:      "blog_system",
+		Platform:    "go",
+		Message:     event.Message,
+		Tags:        event.Tags,
+		Extra:       event.Extra,
+		Environment: event.Environment,
+		ServerName:  event.ServerName,
+	}
+	if event.Error != "" {
+		payload.Exception = &sentryExceptions{Values: []sentryException{{Type: event.Message, Value: event.Error}}}
+	}
+	if event.Stack != "" {
+		// Go stacks don't map onto Sentry's frames without the SDK; keep the text
+		payload.Extra = make(map[string]interface{}, len(event.Extra)+1)
+		for key, value := range event.Extra {
+			payload.Extra[key] = value
+		}
+		payload.Extra["stack"] = event.Stack
+	}
+	return postJSON(ctx, s.client, s.endpoint, payload, map[string]string{"X-Sentry-Auth": s.auth})
+}
+
+// WebhookSink POSTs each event as JSON to a URL, e.g. an alerting gateway's.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	return &WebhookSink{url: url, client: client}
+}
+
+func (s *WebhookSink) Send(ctx context.Context, event *Event) error {
+	return postJSON(ctx, s.client, s.url, event, nil)
+}
+
+// postJSON POSTs payload as JSON and fails on any status but 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package formatter reformats code file content with gofmt or external commands such as
+// prettier, chosen by the file's language.
+package formatter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"go/format"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SourceError is returned when a formatter rejects the content, typically because of a
+// syntax error.
+type SourceError struct {
+	Message string // The formatter's complaint, truncated
+}
+
+func (e *SourceError) Error() string {
+	return "formatter rejected the content: " + e.Message
+}
+
+// maxMessageLength bounds how much formatter output is passed back to clients.
+const maxMessageLength = 1024
+
+// Formatter reformats the content of one language.
+type Formatter interface {
+	Format(ctx context.Context, fileName, content string) (string, error)
+}
+
+// GoFormatter formats Go source in-process, like gofmt.
+type GoFormatter struct{}
+
+func (GoFormatter) Format(ctx context.Context, fileName, content string) (string, error) {
+	formatted, err := format.Source([]byte(content))
+	if err != nil {
+		return "", &SourceError{Message: truncate(err.Error())}
+	}
+	return string(formatted), nil
+}
+
+// CommandFormatter runs an external program that reads content on stdin and writes the
+// formatted content to stdout. "{file}" in Args is replaced by the file's path, which
+// formatters like prettier use to pick a parser.
+type CommandFormatter struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration // 0 for none
+}
+
+// NewCommandFormatter parses a command line. Arguments are split on whitespace; quoting
+// is not supported.
+func NewCommandFormatter(commandLine string, timeout time.Duration) (*CommandFormatter, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, errors.New("empty formatter command")
+	}
+	return &CommandFormatter{Path: fields[0], Args: fields[1:], Timeout: timeout}, nil
+}
+
+func (f *CommandFormatter) Format(ctx context.Context, fileName, content string) (string, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = strings.ReplaceAll(arg, "{file}", fileName)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Path, args...)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("formatter %s timed out: %w", f.Path, ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) { // The formatter ran and refused the input
+			return "", &SourceError{Message: truncate(strings.TrimSpace(stderr.String()))}
+		}
+		return "", fmt.Errorf("failed to run formatter %s: %w", f.Path, err)
+	}
+	return stdout.String(), nil
+}
+
+// Registry picks a formatter by language.
+type Registry struct {
+	formatters map[string]Formatter
+}
+
+// NewRegistry returns the formatters in cfg, plus the built-in Go formatter unless cfg
+// configures a command for Go.
+func NewRegistry(cfg *config.FormatConfig) (*Registry, error) {
+	r := &Registry{formatters: map[string]Formatter{"go": GoFormatter{}}}
+	for language, commandLine := range cfg.Commands {
+		f, err := NewCommandFormatter(commandLine, cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("formatter for %s: %w", language, err)
+		}
+		r.formatters[language] = f
+	}
+	return r, nil
+}
+
+// Lookup returns the formatter for language, or nil if there is none.
+func (r *Registry) Lookup(language string) Formatter {
+	return r.formatters[strings.ToLower(language)]
+}
+
+func truncate(message string) string {
+	if len(message) > maxMessageLength {
+		return message[:maxMessageLength] + "..."
+	}
+	return message
+}
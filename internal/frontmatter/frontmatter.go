@@ -0,0 +1,290 @@
+// Package frontmatter reads the metadata block at the top of Markdown files written for
+// static-site generators: YAML between "---" lines (Jekyll, Hugo, Eleventy) or TOML
+// between "+++" lines (Hugo, Zola).
+package frontmatter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a front-matter block.
+type Format string
+
+const (
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+var ErrInvalid = errors.New("invalid front-matter")
+
+var errUnterminatedArray = errors.New("unterminated array")
+
+// Fields are the front-matter fields the blog understands. Nil means the block doesn't
+// set the field; other keys are ignored.
+type Fields struct {
+	Format Format
+	Title  *string
+	Tags   []string // Nil if absent
+	Date   *time.Time
+	Draft  *bool
+}
+
+// dateLayouts are the date formats accepted in string values, most specific first.
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// Split separates a leading front-matter block from the rest of the content. ok is false
+// if the content doesn't start with a complete block.
+func Split(content string) (format Format, block, body string, ok bool) {
+	var delim string
+	switch {
+	case strings.HasPrefix(content, "---"):
+		format, delim = YAML, "---"
+	case strings.HasPrefix(content, "+++"):
+		format, delim = TOML, "+++"
+	default:
+		return "", "", content, false
+	}
+	open := strings.IndexByte(content, '\n')
+	if open < 0 || strings.TrimRight(content[:open], "\r") != delim {
+		return "", "", content, false // The opening line must be the delimiter alone
+	}
+	rest := content[open+1:]
+
+	for offset := 0; ; {
+		line, next := rest[offset:], len(rest)
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line, next = line[:end], offset+end+1
+		}
+		line = strings.TrimRight(line, "\r")
+		if line == delim || (format == YAML && line == "...") {
+			return format, rest[:offset], rest[next:], true
+		}
+		if next == len(rest) {
+			return "", "", content, false // No closing delimiter
+		}
+		offset = next
+	}
+}
+
+// Strip returns content without its front-matter block, if it has one.
+func Strip(content string) string {
+	_, _, body, ok := Split(content)
+	if !ok {
+		return content
+	}
+	return strings.TrimLeft(body, "\r\n")
+}
+
+// Parse reads the front-matter block at the start of content. It returns nil if there
+// is none, and ErrInvalid if the block can't be parsed.
+func Parse(content string) (*Fields, error) {
+	format, block, _, ok := Split(content)
+	if !ok {
+		return nil, nil
+	}
+	var values map[string]interface{}
+	var err error
+	if format == YAML {
+		err = yaml.Unmarshal([]byte(block), &values)
+	} else {
+		values, err = parseTOML(block)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	fields := &Fields{Format: format}
+	for key, value := range values {
+		switch strings.ToLower(key) {
+		case "title":
+			if s, ok := value.(string); ok {
+				fields.Title = &s
+			}
+		case "tags":
+			fields.Tags = toStrings(value)
+		case "date":
+			fields.Date = toTime(value)
+		case "draft":
+			if b, ok := value.(bool); ok {
+				fields.Draft = &b
+			}
+		}
+	}
+	return fields, nil
+}
+
+// toStrings accepts a list of tags or a single comma-separated string.
+func toStrings(value interface{}) []string {
+	tags := []string{}
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			tags = append(tags, s)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			add(s)
+		}
+	case []interface{}:
+		for _, item := range v {
+			add(fmt.Sprint(item))
+		}
+	}
+	return tags
+}
+
+func toTime(value interface{}) *time.Time {
+	switch v := value.(type) {
+	case time.Time:
+		t := v.UTC()
+		return &t
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				t = t.UTC()
+				return &t
+			}
+		}
+	}
+	return nil
+}
+
+// parseTOML reads the top-level keys of a TOML document: strings, booleans, numbers,
+// dates and arrays of those, which may span lines. Keys inside tables are skipped, which
+// is where generators keep their own settings.
+func parseTOML(block string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	inTable := false
+	lines := strings.Split(block, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inTable = true
+			continue
+		}
+		if inTable {
+			continue
+		}
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		start := i
+		raw = strings.TrimSpace(raw)
+		value, err := tomlValue(raw)
+		for errors.Is(err, errUnterminatedArray) && i+1 < len(lines) {
+			i++ // The array continues on the next line
+			raw += "\n" + lines[i]
+			value, err = tomlValue(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", start+1, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// tomlValue parses a TOML scalar or array, ignoring comments. It returns
+// errUnterminatedArray if raw ends inside an array.
+func tomlValue(raw string) (interface{}, error) {
+	switch {
+	case raw == "":
+		return nil, errors.New("missing value")
+	case raw[0] == '"' || raw[0] == '\'':
+		s, _, err := tomlString(raw)
+		return s, err
+	case raw[0] == '[':
+		var items []interface{}
+		rest := strings.TrimSpace(raw[1:])
+		for !strings.HasPrefix(rest, "]") {
+			if strings.HasPrefix(rest, "#") { // A comment runs to the end of its line
+				end := strings.IndexByte(rest, '\n')
+				if end < 0 {
+					return nil, errUnterminatedArray
+				}
+				rest = strings.TrimSpace(rest[end:])
+				continue
+			}
+			if rest == "" {
+				return nil, errUnterminatedArray
+			}
+			var item interface{}
+			if rest[0] == '"' || rest[0] == '\'' {
+				s, n, err := tomlString(rest)
+				if err != nil {
+					return nil, err
+				}
+				item, rest = s, rest[n:]
+			} else {
+				end := strings.IndexAny(rest, ",]\n#")
+				if end < 0 {
+					return nil, errUnterminatedArray
+				}
+				v, err := tomlValue(strings.TrimSpace(rest[:end]))
+				if err != nil {
+					return nil, err
+				}
+				item, rest = v, rest[end:]
+			}
+			items = append(items, item)
+			rest = strings.TrimSpace(rest)
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+		}
+		return items, nil
+	}
+
+	if i := strings.Index(raw, "#"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if t := toTime(raw); t != nil {
+		return *t, nil
+	}
+	if n, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported value %q", raw)
+}
+
+// tomlString parses the quoted string at the start of raw and returns it and the number
+// of bytes it took up.
+func tomlString(raw string) (string, int, error) {
+	quote := raw[0]
+	if quote == '\'' { // Literal string: no escapes
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", 0, errors.New("unterminated string")
+		}
+		return raw[1 : end+1], end + 2, nil
+	}
+	for i := 1; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(raw[:i+1])
+			if err != nil {
+				return "", 0, err
+			}
+			return s, i + 1, nil
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
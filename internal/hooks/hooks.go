@@ -0,0 +1,46 @@
+// Package hooks defines content-processing hooks: integrations (spell-checking, link
+// checking, summarization, ...) that look at an item's content whenever it is created or
+// updated and report findings about it.
+package hooks
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+)
+
+// Finding severities
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Event actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update" // Edits and reverts
+)
+
+// Event describes a version of an item for hooks to process.
+type Event struct {
+	ItemID   string
+	ItemType models.ItemType
+	Version  int
+	Action   string
+	UserID   string // Who made the change
+	Name     string // Post title or code file path
+	Language string // Code files only
+	Content  string
+}
+
+// Hook processes item content. Sync hooks run inside the write that triggered them and
+// should be fast and local; async hooks run later as background jobs, so they may call
+// out to other services, and are retried on error.
+//
+// A hook's findings for an item replace its previous ones.
+type Hook interface {
+	Name() string // Unique; identifies the hook's results
+	Async() bool
+	Handles(itemType models.ItemType) bool // Whether to run the hook for items of this type
+	Process(ctx context.Context, ev *Event) ([]models.HookFinding, error)
+}
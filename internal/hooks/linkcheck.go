@@ -0,0 +1,190 @@
+// internal/hooks/linkcheck.go
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	maxCheckedLinks   = 100 // Per item; the rest are skipped
+	linkCheckWorkers  = 8
+	linkCheckMaxHops  = 5
+	linkCheckUA       = "blog_system-linkcheck/1.0"
+	trailingLinkPunct = ".,;:!?'\""
+)
+
+// linkPattern finds absolute http(s) URLs in Markdown and plain text. Closing brackets
+// are excluded so "[text](https://example.com)" yields the bare URL.
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `)\]]+`)
+
+// errBlockedAddress is returned for links to loopback, private and other non-public
+// addresses, which the checker refuses to contact.
+var errBlockedAddress = errors.New("address is not public")
+
+// LinkChecker reports links in posts that can't be fetched. It runs asynchronously and
+// only contacts public addresses, so users can't make the server probe its own network.
+type LinkChecker struct {
+	client *http.Client
+}
+
+// NewLinkChecker creates a link checker that gives each link timeout to respond.
+func NewLinkChecker(timeout time.Duration) *LinkChecker {
+	dialer := &net.Dialer{Timeout: timeout, Control: rejectNonPublic}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConnsPerHost:   2,
+	}
+	return &LinkChecker{client: &http.Client{
+		Transport: transport,
+		Timeout:   2 * timeout, // Headers plus whatever body is read
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= linkCheckMaxHops {
+				return fmt.Errorf("stopped after %d redirects", linkCheckMaxHops)
+			}
+			return nil
+		},
+	}}
+}
+
+func (l *LinkChecker) Name() string { return "linkcheck" }
+
+func (l *LinkChecker) Async() bool { return true }
+
+// Handles reports true for posts only; URLs in code are often placeholders.
+func (l *LinkChecker) Handles(itemType models.ItemType) bool { return itemType == models.ItemTypePost }
+
+func (l *LinkChecker) Process(ctx context.Context, ev *Event) ([]models.HookFinding, error) {
+	links, lines := extractLinks(ev.Content)
+	var findings []models.HookFinding
+	if len(links) > maxCheckedLinks {
+		findings = append(findings, models.HookFinding{
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("Only the first %d of %d links were checked", maxCheckedLinks, len(links)),
+		})
+		links = links[:maxCheckedLinks]
+	}
+
+	results := make([]*models.HookFinding, len(links))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < linkCheckWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = l.check(ctx, links[i], lines[links[i]])
+			}
+		}()
+	}
+	for i := range links {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err // Incomplete; let the job retry
+	}
+	for _, finding := range results {
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// check fetches link and returns a finding if it is broken, or nil.
+func (l *LinkChecker) check(ctx context.Context, link string, line int) *models.HookFinding {
+	status, err := l.fetch(ctx, link, http.MethodHead)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = l.fetch(ctx, link, http.MethodGet) // Some servers don't do HEAD
+	}
+	switch {
+	case err != nil && errors.Is(err, errBlockedAddress):
+		return nil // Not ours to check
+	case err != nil:
+		if ctx.Err() != nil {
+			return nil
+		}
+		return &models.HookFinding{Severity: SeverityWarning, Line: line, Message: fmt.Sprintf("%s: %v", link, unwrapURLError(err))}
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return &models.HookFinding{Severity: SeverityError, Line: line, Message: fmt.Sprintf("%s: %d %s", link, status, http.StatusText(status))}
+	case status >= 400 && status != http.StatusTooManyRequests && status != http.StatusUnauthorized && status != http.StatusForbidden:
+		// Rate limits and auth walls say nothing about whether the page exists
+		return &models.HookFinding{Severity: SeverityWarning, Line: line, Message: fmt.Sprintf("%s: %d %s", link, status, http.StatusText(status))}
+	}
+	return nil
+}
+
+func (l *LinkChecker) fetch(ctx context.Context, link, method string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", linkCheckUA)
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// extractLinks returns the distinct links in content in order of appearance, and the
+// 1-based line each first appears on.
+func extractLinks(content string) ([]string, map[string]int) {
+	var links []string
+	lines := make(map[string]int)
+	for i, line := range strings.Split(content, "\n") {
+		for _, link := range linkPattern.FindAllString(line, -1) {
+			link = strings.TrimRight(link, trailingLinkPunct)
+			if _, seen := lines[link]; seen {
+				continue
+			}
+			lines[link] = i + 1
+			links = append(links, link)
+		}
+	}
+	return links, lines
+}
+
+// rejectNonPublic is a net.Dialer Control function refusing connections to addresses
+// that aren't on the public internet. It runs after DNS resolution, so hostnames that
+// resolve to internal addresses are caught too.
+func rejectNonPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// unwrapURLError drops the "Head \"url\":" prefix http.Client puts on errors, since
+// findings already name the link.
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
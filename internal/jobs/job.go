@@ -0,0 +1,87 @@
+// internal/jobs/job.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job is a unit of background work.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Attempts    int             `json:"attempts"` // Runs started so far
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	LastError   string          `json:"lastError,omitempty"`
+	Tenant      string          `json:"tenant,omitempty"` // Tenant the job runs for; see Enqueue
+	// Progress is the last state a run of the job saved with Checkpoint
+	Progress json.RawMessage `json:"progress,omitempty"`
+}
+
+// Decode unmarshals the job's payload into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler runs a job. A returned error schedules a retry unless it is Permanent or the
+// job is out of attempts, or Postpone.
+type Handler func(ctx context.Context, job *Job) error
+
+// Store holds jobs until they are due and claimed by a worker.
+type Store interface {
+	// Push adds a job to run at job.RunAt. It reports false, without error, if a job
+	// with the same ID is already queued or running.
+	Push(ctx context.Context, job *Job) (bool, error)
+	// Claim returns a due job, hiding it from other workers for lease, or nil if none
+	// is due. A job whose worker dies reappears once its lease runs out.
+	Claim(ctx context.Context, lease time.Duration) (*Job, error)
+	// Renew keeps a claimed job hidden for another lease from now and saves its current
+	// state (e.g. Progress). It does nothing if the job was completed.
+	Renew(ctx context.Context, job *Job, lease time.Duration) error
+	// Retry puts a claimed job back, to run again at job.RunAt.
+	Retry(ctx context.Context, job *Job) error
+	// Complete removes a claimed job.
+	Complete(ctx context.Context, job *Job) error
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+type postponedError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *postponedError) Error() string { return e.err.Error() }
+func (e *postponedError) Unwrap() error { return e.err }
+
+// Postpone marks a handler error (err says why) as a reason to run the job again after
+// delay without spending an attempt, e.g. while the work it does is paused. A run of a
+// scheduled job is dropped instead, as the next one is due anyway.
+func Postpone(err error, delay time.Duration) error {
+	return &postponedError{err: err, delay: delay}
+}
+
+func isPostponed(err error) (time.Duration, bool) {
+	var postponed *postponedError
+	if errors.As(err, &postponed) {
+		return postponed.delay, true
+	}
+	return 0, false
+}
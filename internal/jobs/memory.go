@@ -0,0 +1,77 @@
+// internal/jobs/memory.go
+package jobs
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs in process memory. Queued jobs are lost on restart.
+type MemoryStore struct {
+	mu     sync.Mutex
+	queue  jobHeap
+	active map[string]bool // IDs queued or running
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{active: make(map[string]bool)}
+}
+
+func (m *MemoryStore) Push(ctx context.Context, job *Job) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active[job.ID] {
+		return false, nil
+	}
+	m.active[job.ID] = true
+	heap.Push(&m.queue, job)
+	return true, nil
+}
+
+// Claim pops the earliest due job. Leases don't apply: a job can only be lost with the
+// process that holds it.
+func (m *MemoryStore) Claim(ctx context.Context, lease time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == 0 || m.queue[0].RunAt.After(time.Now()) {
+		return nil, nil
+	}
+	return heap.Pop(&m.queue).(*Job), nil
+}
+
+// Renew does nothing: leases don't apply, and the claimed job is the stored one.
+func (m *MemoryStore) Renew(ctx context.Context, job *Job, lease time.Duration) error {
+	return nil
+}
+
+func (m *MemoryStore) Retry(ctx context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	heap.Push(&m.queue, job)
+	return nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, job.ID)
+	return nil
+}
+
+// jobHeap orders jobs by RunAt (implements heap.Interface).
+type jobHeap []*Job
+
+func (h jobHeap) Len() int            { return len(h) }
+func (h jobHeap) Less(i, j int) bool  { return h[i].RunAt.Before(h[j].RunAt) }
+func (h jobHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x interface{}) { *h = append(*h, x.(*Job)) }
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return job
+}
@@ -0,0 +1,429 @@
+// internal/jobs/queue.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers      = 4
+	DefaultMaxAttempts  = 5
+	DefaultPollInterval = time.Second
+	// DefaultLease is how long a claimed job is hidden from other workers. The worker
+	// renews it while the handler runs, so a job is never run twice concurrently. It is
+	// also the handler's timeout unless the handler was registered WithTimeout.
+	DefaultLease = 5 * time.Minute
+
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 10 * time.Minute
+)
+
+// Options configure a Queue. Zero values take the defaults.
+type Options struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	Tenants      []string // With multi-tenancy, scheduled jobs run once for each tenant
+}
+
+// Queue runs jobs from a Store on a pool of workers, retrying failures with exponential
+// backoff, and enqueues recurring jobs on a schedule.
+type Queue struct {
+	store Store
+	seen  cache.Deduper // Claims scheduled runs, so replicas sharing the store run each once
+	opts  Options
+
+	mu        sync.RWMutex
+	handlers  map[string]handler
+	schedules map[string]time.Duration
+
+	wake chan struct{} // Nudges an idle worker when a job is enqueued locally
+}
+
+// NewQueue creates a queue over store. seen deduplicates scheduled runs; it should be
+// shared by all replicas using the same store (e.g. Redis-backed).
+func NewQueue(store Store, seen cache.Deduper, opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLease
+	}
+	return &Queue{
+		store:     store,
+		seen:      seen,
+		opts:      opts,
+		handlers:  make(map[string]handler),
+		schedules: make(map[string]time.Duration),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// handler is a registered Handler and its options.
+type handler struct {
+	fn      Handler
+	timeout time.Duration
+}
+
+// HandleOption customizes a registered handler.
+type HandleOption func(*handler)
+
+// WithTimeout lets the handler run for up to d instead of the lease, for long jobs such
+// as sweeps over every user. Such jobs should Checkpoint their progress: a scheduled run
+// is retried like any other job, and resumes from its last checkpoint.
+func WithTimeout(d time.Duration) HandleOption {
+	return func(h *handler) { h.timeout = d }
+}
+
+// Handle registers the handler for jobs of jobType.
+func (q *Queue) Handle(jobType string, h Handler, opts ...HandleOption) {
+	reg := handler{fn: h}
+	for _, opt := range opts {
+		opt(&reg)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = reg
+}
+
+// Every enqueues a jobType job (with no payload) every interval once Run starts. A
+// non-positive interval disables the schedule.
+func (q *Queue) Every(jobType string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.schedules[jobType] = interval
+}
+
+// EnqueueOption customizes an enqueued job.
+type EnqueueOption func(*Job)
+
+// WithID sets the job ID. A job is not enqueued while another with its ID is queued or
+// running, which makes enqueueing idempotent.
+func WithID(id string) EnqueueOption {
+	return func(j *Job) { j.ID = id }
+}
+
+// WithDelay runs the job no earlier than d from now.
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(j *Job) { j.RunAt = j.RunAt.Add(d) }
+}
+
+// WithMaxAttempts limits how many times the job runs before it is dropped.
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(j *Job) { j.MaxAttempts = n }
+}
+
+// Enqueue adds a job of jobType with payload (marshalled to JSON; may be nil). The job
+// runs for the tenant of ctx, if any.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...EnqueueOption) error {
+	job := &Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       time.Now().UTC(),
+		Tenant:      tenant.ID(ctx),
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s job payload: %w", jobType, err)
+		}
+		job.Payload = data
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	if job.Tenant != "" {
+		job.ID = job.Tenant + "/" + job.ID // IDs given by WithID are unique per tenant
+	}
+
+	if _, err := q.store.Push(ctx, job); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run starts the workers and schedules and blocks until ctx is cancelled and the
+// running jobs have finished.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	q.mu.RLock()
+	for jobType, interval := range q.schedules {
+		wg.Add(1)
+		go func(jobType string, interval time.Duration) {
+			defer wg.Done()
+			q.runSchedule(ctx, jobType, interval)
+		}(jobType, interval)
+	}
+	q.mu.RUnlock()
+
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	slog.InfoContext(ctx, "Job queue started", "workers", q.opts.Workers)
+	wg.Wait()
+}
+
+// runSchedule enqueues jobType at every interval boundary. Each run is claimed through
+// the deduper first, so only one replica enqueues it.
+func (q *Queue) runSchedule(ctx context.Context, jobType string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runID := fmt.Sprintf("%s@%d", jobType, now.Truncate(interval).Unix())
+			first, err := q.seen.FirstSeen(ctx, "job:"+runID, interval)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to claim scheduled job", "jobType", jobType, "error", err)
+				continue
+			}
+			if !first {
+				continue // Another replica has it
+			}
+			q.enqueueScheduled(ctx, jobType, runID)
+		}
+	}
+}
+
+// enqueueScheduled enqueues a run of a scheduled job, one for each tenant if there are any.
+func (q *Queue) enqueueScheduled(ctx context.Context, jobType, runID string) {
+	contexts := []context.Context{ctx}
+	if len(q.opts.Tenants) > 0 {
+		contexts = contexts[:0]
+		for _, tenantID := range q.opts.Tenants {
+			contexts = append(contexts, tenant.WithID(ctx, tenantID))
+		}
+	}
+	// A failed run is dropped, as the next one is due soon, unless the job is long enough
+	// to have its own timeout: then it resumes from its checkpoint instead of starting over
+	maxAttempts := 1
+	q.mu.RLock()
+	if h, ok := q.handlers[jobType]; ok && h.timeout > 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	q.mu.RUnlock()
+	for _, runCtx := range contexts {
+		if err := q.Enqueue(runCtx, jobType, nil, WithID(runID), WithMaxAttempts(maxAttempts)); err != nil {
+			slog.ErrorContext(runCtx, "Failed to enqueue scheduled job", "jobType", jobType, "tenantID", tenant.ID(runCtx), "error", err)
+		}
+	}
+}
+
+// work claims and runs jobs until ctx is cancelled.
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := q.store.Claim(ctx, q.opts.Lease)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to claim job", "error", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue // Look for more work right away
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// run executes one claimed job and completes or reschedules it.
+func (q *Queue) run(ctx context.Context, job *Job) {
+	q.mu.RLock()
+	h, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	job.Attempts++
+	var err error
+	if !ok {
+		err = Permanent(fmt.Errorf("no handler for job type %q", job.Type))
+	} else {
+		timeout := q.opts.Lease
+		if h.timeout > 0 {
+			timeout = h.timeout
+		}
+		run := &running{job: job}
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		jobCtx = context.WithValue(jobCtx, runningKey{}, run)
+		if job.Tenant != "" {
+			jobCtx = logging.WithTenantID(tenant.WithID(jobCtx, job.Tenant), job.Tenant)
+		}
+		stop := q.renewLease(ctx, run)
+		err = runHandler(jobCtx, h.fn, job)
+		stop()
+		cancel()
+	}
+
+	// Use a fresh context: the job's outcome must be recorded even during shutdown
+	storeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err == nil {
+		if cerr := q.store.Complete(storeCtx, job); cerr != nil {
+			slog.ErrorContext(ctx, "Failed to complete job", "jobType", job.Type, "jobID", job.ID, "error", cerr)
+		}
+		return
+	}
+
+	if delay, ok := isPostponed(err); ok {
+		q.postpone(ctx, storeCtx, job, delay, err)
+		return
+	}
+	if isPermanent(err) || job.Attempts >= job.MaxAttempts {
+		slog.ErrorContext(ctx, "Job failed permanently", "jobType", job.Type, "jobID", job.ID, "attempts", job.Attempts, "error", err)
+		if cerr := q.store.Complete(storeCtx, job); cerr != nil {
+			slog.ErrorContext(ctx, "Failed to drop job", "jobType", job.Type, "jobID", job.ID, "error", cerr)
+		}
+		return
+	}
+	job.LastError = err.Error()
+	job.RunAt = time.Now().UTC().Add(retryDelay(job.Attempts))
+	slog.WarnContext(ctx, "Job failed, retrying", "jobType", job.Type, "jobID", job.ID, "attempts", job.Attempts, "maxAttempts", job.MaxAttempts, "runAt", job.RunAt.Format(time.RFC3339), "error", err)
+	if rerr := q.store.Retry(storeCtx, job); rerr != nil {
+		slog.ErrorContext(ctx, "Failed to reschedule job", "jobType", job.Type, "jobID", job.ID, "error", rerr)
+	}
+}
+
+// postpone reschedules a job whose handler returned Postpone, giving back its attempt,
+// or drops it if it is a run of a scheduled job.
+func (q *Queue) postpone(ctx, storeCtx context.Context, job *Job, delay time.Duration, reason error) {
+	if strings.HasPrefix(job.ID, job.Type+"@") { // A run ID; see runSchedule
+		slog.InfoContext(ctx, "Scheduled job skipped", "jobType", job.Type, "jobID", job.ID, "reason", reason)
+		if cerr := q.store.Complete(storeCtx, job); cerr != nil {
+			slog.ErrorContext(ctx, "Failed to drop job", "jobType", job.Type, "jobID", job.ID, "error", cerr)
+		}
+		return
+	}
+	job.Attempts--
+	job.RunAt = time.Now().UTC().Add(delay)
+	slog.InfoContext(ctx, "Job postponed", "jobType", job.Type, "jobID", job.ID, "runAt", job.RunAt.Format(time.RFC3339), "reason", reason)
+	if rerr := q.store.Retry(storeCtx, job); rerr != nil {
+		slog.ErrorContext(ctx, "Failed to reschedule job", "jobType", job.Type, "jobID", job.ID, "error", rerr)
+	}
+}
+
+// renewLease renews the lease of a running job every third of a lease, saving its
+// progress, until the returned func is called.
+func (q *Queue) renewLease(ctx context.Context, run *running) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(q.opts.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			run.mu.Lock()
+			snapshot := *run.job
+			run.mu.Unlock()
+			renewCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			if err := q.store.Renew(renewCtx, &snapshot, q.opts.Lease); err != nil {
+				slog.ErrorContext(ctx, "Failed to renew job lease", "jobType", snapshot.Type, "jobID", snapshot.ID, "error", err)
+			}
+			cancel()
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// running is the job a handler is running, reachable from its context for Checkpoint.
+type running struct {
+	mu  sync.Mutex // Guards job.Progress against the lease renewal
+	job *Job
+}
+
+type runningKey struct{}
+
+// Checkpoint records v (marshalled to JSON) as the progress of the job running in ctx.
+// It is saved with the job's next lease renewal or retry, and a later attempt can read
+// it with LoadProgress. It does nothing outside a job.
+func Checkpoint(ctx context.Context, v interface{}) error {
+	run, ok := ctx.Value(runningKey{}).(*running)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job progress: %w", err)
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.job.Progress = data
+	return nil
+}
+
+// LoadProgress unmarshals the last Checkpoint of the job running in ctx into v. It
+// reports false if there is none, e.g. on the first attempt or outside a job.
+func LoadProgress(ctx context.Context, v interface{}) bool {
+	run, ok := ctx.Value(runningKey{}).(*running)
+	if !ok {
+		return false
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if len(run.job.Progress) == 0 {
+		return false
+	}
+	return json.Unmarshal(run.job.Progress, v) == nil
+}
+
+// runHandler calls h, turning a panic into an error so one bad job can't kill a worker.
+// The panic is reported with its stack, which the error loses.
+func runHandler(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			errreport.Panic(ctx, "Panic running job", r, debug.Stack(), "jobType", job.Type, "jobID", job.ID)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// retryDelay returns the backoff before the next attempt: 5s, 10s, 20s, ... up to 10 minutes.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
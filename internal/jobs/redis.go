@@ -0,0 +1,124 @@
+// internal/jobs/redis.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore keeps jobs in Redis so they survive restarts and are shared by every
+// replica. A sorted set orders job IDs by when they may next run; a hash holds the jobs.
+// Claiming a job pushes its score out by the lease instead of removing it, so the job of
+// a worker that dies is picked up again once the lease expires.
+type RedisStore struct {
+	client   *redis.Client
+	queueKey string
+	dataKey  string
+}
+
+// NewRedisStore returns a store using keys under prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, queueKey: prefix + "jobs:queue", dataKey: prefix + "jobs:data"}
+}
+
+var pushScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[2], ARGV[1], ARGV[3]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// claimScript leases the earliest due job: KEYS = queue, data; ARGV = now, lease end (ms).
+var claimScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #ids == 0 then
+	return false
+end
+local data = redis.call("HGET", KEYS[2], ids[1])
+if not data then
+	redis.call("ZREM", KEYS[1], ids[1])
+	return false
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ids[1])
+return data
+`)
+
+// renewScript pushes out the lease of a job that is still queued and saves it: KEYS =
+// queue, data; ARGV = ID, lease end (ms), job.
+var renewScript = redis.NewScript(`
+if not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[3])
+return 1
+`)
+
+func (r *RedisStore) Push(ctx context.Context, job *Job) (bool, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+	added, err := pushScript.Run(ctx, r.client, []string{r.queueKey, r.dataKey}, job.ID, job.RunAt.UnixMilli(), data).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to push job %s: %w", job.ID, err)
+	}
+	return added == 1, nil
+}
+
+func (r *RedisStore) Claim(ctx context.Context, lease time.Duration) (*Job, error) {
+	now := time.Now()
+	data, err := claimScript.Run(ctx, r.client, []string{r.queueKey, r.dataKey}, now.UnixMilli(), now.Add(lease).UnixMilli()).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+func (r *RedisStore) Renew(ctx context.Context, job *Job, lease time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+	leaseEnd := time.Now().Add(lease).UnixMilli()
+	if err := renewScript.Run(ctx, r.client, []string{r.queueKey, r.dataKey}, job.ID, leaseEnd, data).Err(); err != nil {
+		return fmt.Errorf("failed to renew job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (r *RedisStore) Retry(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, r.dataKey, job.ID, data)
+	pipe.ZAdd(ctx, r.queueKey, &redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to reschedule job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (r *RedisStore) Complete(ctx context.Context, job *Job) error {
+	pipe := r.client.TxPipeline()
+	pipe.ZRem(ctx, r.queueKey, job.ID)
+	pipe.HDel(ctx, r.dataKey, job.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to complete job %s: %w", job.ID, err)
+	}
+	return nil
+}
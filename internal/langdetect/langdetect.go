@@ -0,0 +1,123 @@
+// Package langdetect guesses the programming language of a code file from its name and,
+// failing that, its content. Languages are named with the lowercase identifiers editors
+// and highlighters use ("go", "python", "typescript", ...).
+package langdetect
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// byExtension maps lowercase file extensions to languages.
+var byExtension = map[string]string{
+	".go": "go", ".py": "python", ".pyw": "python", ".rb": "ruby", ".rs": "rust",
+	".js": "javascript", ".mjs": "javascript", ".cjs": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".mts": "typescript", ".cts": "typescript", ".tsx": "typescript",
+	".java": "java", ".kt": "kotlin", ".kts": "kotlin", ".scala": "scala", ".groovy": "groovy",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hh": "cpp", ".hpp": "cpp", ".hxx": "cpp",
+	".cs": "csharp", ".fs": "fsharp", ".vb": "vb", ".swift": "swift", ".m": "objective-c", ".mm": "objective-c",
+	".php": "php", ".pl": "perl", ".pm": "perl", ".lua": "lua", ".r": "r", ".jl": "julia",
+	".dart": "dart", ".ex": "elixir", ".exs": "elixir", ".erl": "erlang", ".hs": "haskell",
+	".clj": "clojure", ".ml": "ocaml", ".zig": "zig", ".nim": "nim", ".v": "verilog", ".sv": "systemverilog",
+	".sh": "shell", ".bash": "shell", ".zsh": "shell", ".fish": "shell", ".ps1": "powershell", ".bat": "bat", ".cmd": "bat",
+	".sql": "sql", ".graphql": "graphql", ".gql": "graphql", ".proto": "protobuf",
+	".html": "html", ".htm": "html", ".css": "css", ".scss": "scss", ".sass": "sass", ".less": "less",
+	".vue": "vue", ".svelte": "svelte", ".xml": "xml", ".svg": "xml",
+	".json": "json", ".jsonc": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".ini": "ini", ".cfg": "ini",
+	".md": "markdown", ".markdown": "markdown", ".rst": "restructuredtext", ".tex": "latex",
+	".tf": "hcl", ".hcl": "hcl", ".dockerfile": "dockerfile", ".mk": "makefile", ".cmake": "cmake",
+	".txt": "plaintext",
+}
+
+// byName maps well-known extensionless (or unusual) file names to languages.
+var byName = map[string]string{
+	"dockerfile": "dockerfile", "containerfile": "dockerfile", "makefile": "makefile", "gnumakefile": "makefile",
+	"cmakelists.txt": "cmake", "gemfile": "ruby", "rakefile": "ruby", "vagrantfile": "ruby",
+	"jenkinsfile": "groovy", "go.mod": "go", "go.sum": "plaintext", ".bashrc": "shell", ".zshrc": "shell",
+	".gitignore": "ignore", ".dockerignore": "ignore", ".env": "dotenv",
+}
+
+// byInterpreter maps the program named in a "#!" line to languages.
+var byInterpreter = map[string]string{
+	"sh": "shell", "bash": "shell", "zsh": "shell", "dash": "shell", "ksh": "shell", "fish": "shell",
+	"python": "python", "python2": "python", "python3": "python", "ruby": "ruby", "perl": "perl",
+	"node": "javascript", "deno": "typescript", "ts-node": "typescript", "php": "php", "lua": "lua",
+	"Rscript": "r", "pwsh": "powershell",
+}
+
+// contentRules are checked in order against the start of files whose name gave nothing
+// away. Each must be distinctive enough not to need a score.
+var contentRules = []struct {
+	pattern  *regexp.Regexp
+	language string
+}{
+	{regexp.MustCompile(`^\s*<\?php`), "php"},
+	{regexp.MustCompile(`(?i)^\s*(<!doctype html|<html)`), "html"},
+	{regexp.MustCompile(`^\s*<\?xml`), "xml"},
+	{regexp.MustCompile(`(?m)^package \w+\s*$[\s\S]*^func `), "go"},
+	{regexp.MustCompile(`(?m)^#include\s*[<"]`), "cpp"},
+	{regexp.MustCompile(`(?m)^(import \w+|from [\w.]+ import |def \w+\(.*\):\s*$)`), "python"},
+	{regexp.MustCompile(`(?m)^\s*(public\s+)?(final\s+)?class \w+[\s\S]*public static void main\(`), "java"},
+	{regexp.MustCompile(`(?m)^\s*fn main\(\)`), "rust"},
+	{regexp.MustCompile(`(?m)^\s*(const|let|var) \w+\s*=\s*require\(|^\s*module\.exports\s*=`), "javascript"},
+	{regexp.MustCompile(`(?m)^\s*(interface|type) \w+\s*(=|\{)[\s\S]*:\s*(string|number|boolean)\b`), "typescript"},
+	{regexp.MustCompile(`(?im)^\s*(select|insert into|create table|update \w+ set)\b`), "sql"},
+	{regexp.MustCompile(`(?m)^FROM \S+[\s\S]*^(RUN|CMD|ENTRYPOINT|COPY) `), "dockerfile"},
+}
+
+// sniffLength bounds how much content the rules look at.
+const sniffLength = 4096
+
+// FromFileName returns the language a file name implies, or "" if it implies none.
+// fileName may be a path.
+func FromFileName(fileName string) string {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(fileName, "\\", "/")))
+	if language, ok := byName[base]; ok {
+		return language
+	}
+	if strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return "dockerfile"
+	}
+	return byExtension[path.Ext(base)]
+}
+
+// FromContent returns the language content looks like, or "" if it can't tell.
+func FromContent(content string) string {
+	if len(content) > sniffLength {
+		content = content[:sniffLength]
+	}
+	if strings.HasPrefix(content, "#!") {
+		line, _, _ := strings.Cut(content[2:], "\n")
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			interpreter := path.Base(fields[0])
+			if interpreter == "env" { // "#!/usr/bin/env -S deno run": the first non-flag argument
+				for _, field := range fields[1:] {
+					if !strings.HasPrefix(field, "-") {
+						interpreter = field
+						break
+					}
+				}
+			}
+			if language, ok := byInterpreter[interpreter]; ok {
+				return language
+			}
+		}
+	}
+	for _, rule := range contentRules {
+		if rule.pattern.MatchString(content) {
+			return rule.language
+		}
+	}
+	return ""
+}
+
+// Detect returns the language of a file, preferring what its name implies over what
+// its content looks like. It returns "" if neither gives it away.
+func Detect(fileName, content string) string {
+	if language := FromFileName(fileName); language != "" {
+		return language
+	}
+	return FromContent(content)
+}
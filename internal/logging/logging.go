@@ -0,0 +1,164 @@
+// Package logging sets up the process-wide structured logger (log/slog) and carries
+// request-scoped fields in contexts, so every line logged while handling a request can be
+// tied back to it by the log aggregator.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey string
+
+// Request fields, in the order they are added to log lines
+var contextFields = []contextKey{"requestID", "tenantID", "userID", "itemID", "action"}
+
+// level is the default logger's level; SetLevel changes it at runtime.
+var level slog.LevelVar
+
+// Setup makes a logger configured by cfg the default one for log/slog and package log,
+// writing to stderr.
+func Setup(cfg *config.LogConfig) error {
+	l, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(os.Stderr, cfg.Format, &level)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the level of the logger made by Setup, e.g. on a config reload.
+func SetLevel(s string) error {
+	l, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// NewHandler creates a handler writing lines of the configured format and level to w.
+// Lines logged with a context (slog.InfoContext etc.) get its request fields added.
+func NewHandler(w io.Writer, cfg *config.LogConfig) (slog.Handler, error) {
+	l, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(w, cfg.Format, l)
+}
+
+func newHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"; "" is info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+	}
+}
+
+// WithRequestID returns a context whose log lines carry requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey("requestID"), requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey("requestID")).(string)
+	return id
+}
+
+// WithTenantID returns a context whose log lines carry the tenant the request is for.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey("tenantID"), tenantID)
+}
+
+// WithUserID returns a context whose log lines carry the ID of the acting user.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, contextKey("userID"), userID)
+}
+
+// WithItemID returns a context whose log lines carry the ID of the item being acted on.
+func WithItemID(ctx context.Context, itemID string) context.Context {
+	return context.WithValue(ctx, contextKey("itemID"), itemID)
+}
+
+// WithAction returns a context whose log lines carry the action being performed, e.g.
+// the WebSocket message being handled.
+func WithAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, contextKey("action"), action)
+}
+
+// Fields returns the request fields stored in ctx by name, e.g. for an error report.
+func Fields(ctx context.Context) map[string]string {
+	fields := make(map[string]string)
+	for _, key := range contextFields {
+		if value, ok := ctx.Value(key).(string); ok && value != "" {
+			fields[string(key)] = value
+		}
+	}
+	return fields
+}
+
+// contextHandler adds the request fields of a record's context to it.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		for _, key := range contextFields {
+			if value, ok := ctx.Value(key).(string); ok && value != "" && !hasAttr(r, string(key)) {
+				r.AddAttrs(slog.String(string(key), value))
+			}
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// hasAttr reports whether r already has a top-level attribute named key, so a request
+// field isn't repeated when a line names it explicitly (e.g. the user a change is about).
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
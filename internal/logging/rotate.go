@@ -0,0 +1,123 @@
+// internal/logging/rotate.go
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedSuffix is appended to a file's name when it is rotated out.
+const rotatedSuffix = "-2006-01-02T15-04-05.000"
+
+// RotatingFile is an append-only log file that is rotated out once it reaches a size:
+// it is renamed with the time appended and a new one started. Rotated files beyond the
+// newest maxBackups, or older than maxAge, are deleted.
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int           // 0 keeps any number
+	maxAge     time.Duration // 0 keeps them forever
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens (or creates) the file at path for appending. A maxBytes of 0
+// never rotates it.
+func OpenRotatingFile(path string, maxBytes int64, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, maxAge: maxAge}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("creating log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past its size limit.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.path+time.Now().Format(rotatedSuffix)); err != nil {
+		if openErr := f.open(); openErr != nil { // Keep writing to the old file
+			return openErr
+		}
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.prune() // Don't hold up the write
+	return nil
+}
+
+// prune deletes the rotated files that are too many or too old.
+func (f *RotatingFile) prune() {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(f.path + "-*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, name := range matches {
+		if _, err := time.Parse(rotatedSuffix, strings.TrimPrefix(name, f.path)); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // Newest first; the suffix sorts by time
+	for i, name := range backups {
+		tooMany := f.maxBackups > 0 && i >= f.maxBackups
+		tooOld := false
+		if f.maxAge > 0 {
+			if info, err := os.Stat(name); err == nil {
+				tooOld = time.Since(info.ModTime()) > f.maxAge
+			}
+		}
+		if tooMany || tooOld {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,161 @@
+// Package mail sends plain-text email through an SMTP server.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const sendTimeout = 30 * time.Second
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+var sentMessages = metrics.Default.Counter("blog_mail_messages_total",
+	"Email messages handed to the SMTP server, by result: sent or failed.", "result")
+
+// Message is a plain-text email to one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages through the configured SMTP server.
+type Mailer struct {
+	addr     string
+	host     string
+	from     *mail.Address
+	username string
+	password string
+}
+
+// NewMailer returns a mailer for cfg, or nil if email isn't configured.
+func NewMailer(cfg *config.MailConfig) (*Mailer, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP address must be host:port: %w", err)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+	return &Mailer{addr: cfg.SMTPAddr, host: host, from: from, username: cfg.Username, password: cfg.Password}, nil
+}
+
+// ParseAddress checks that address is a single bare email address, such as
+// someone@example.com, and returns it.
+func ParseAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || parsed.Name != "" {
+		return "", ErrInvalidAddress
+	}
+	return address, nil
+}
+
+// Send delivers msg to the SMTP server.
+func (m *Mailer) Send(ctx context.Context, msg *Message) error {
+	err := m.send(ctx, msg)
+	if err != nil {
+		sentMessages.Inc("failed")
+		return err
+	}
+	sentMessages.Inc("sent")
+	return nil
+}
+
+func (m *Mailer) send(ctx context.Context, msg *Message) error {
+	to, err := ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	data, err := m.compose(to, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if m.username != "" {
+		// PlainAuth refuses to send credentials unencrypted, except to localhost
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose renders msg with its headers, the body quoted-printable so any text fits.
+func (m *Mailer) compose(to string, msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", m.from.String())
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.ReplaceAll(msg.Subject, "\n", " ")))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,305 @@
+// Package markdown renders the Markdown of posts to HTML for the public blog pages. It
+// covers the common subset: headings, paragraphs, emphasis, code spans and blocks, links,
+// images, lists, blockquotes and rules. Raw HTML in the source is escaped, not passed
+// through, and links and images only keep http, https, mailto and relative URLs, so the
+// output is safe to embed in a page.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	atxHeading  = regexp.MustCompile(`^(#{1,6})(\s+(.*?))?\s*#*\s*$`)
+	horizRule   = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	setextUnder = regexp.MustCompile(`^\s*(=+|-+)\s*$`)
+	listMarker  = regexp.MustCompile(`^\s{0,3}([-*+]|(\d{1,9})[.)])\s+`)
+)
+
+// Render converts Markdown to HTML.
+func Render(src string) string {
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n"))
+	return b.String()
+}
+
+// renderBlocks renders a sequence of lines as block elements.
+func renderBlocks(b *strings.Builder, lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = paragraph[:0]
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:3]
+			lang := firstOr(strings.Fields(strings.TrimLeft(trimmed, fence[:1])), "")
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			writeCode(b, code, lang)
+		case len(paragraph) > 0 && setextUnder.MatchString(trimmed):
+			level := 1
+			if trimmed[0] == '-' {
+				level = 2
+			}
+			text := strings.Join(paragraph, " ")
+			paragraph = paragraph[:0]
+			writeHeading(b, level, text)
+		case atxHeading.MatchString(trimmed):
+			flush()
+			m := atxHeading.FindStringSubmatch(trimmed)
+			writeHeading(b, len(m[1]), m[3])
+		case horizRule.MatchString(trimmed):
+			flush()
+			b.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted)
+			b.WriteString("</blockquote>\n")
+		case listMarker.MatchString(line):
+			flush()
+			i = renderList(b, lines, i) - 1
+		case len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			var code []string
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, strings.TrimPrefix(strings.TrimPrefix(lines[i], "\t"), "    "))
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			writeCode(b, code, "")
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+}
+
+// renderList renders the list starting at lines[start] and returns the index of the
+// first line after it. Items are flat: indented lines continue the item before them.
+func renderList(b *strings.Builder, lines []string, start int) int {
+	m := listMarker.FindStringSubmatch(lines[start])
+	ordered := m[2] != ""
+	if ordered {
+		if n, _ := strconv.Atoi(m[2]); n != 1 {
+			b.WriteString(`<ol start="` + strconv.Itoa(n) + `">` + "\n")
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	var item []string
+	flushItem := func() {
+		if item != nil {
+			b.WriteString("<li>" + renderInline(strings.Join(item, "\n")) + "</li>\n")
+			item = nil
+		}
+	}
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := listMarker.FindStringSubmatch(line); m != nil && (m[2] != "") == ordered {
+			flushItem()
+			item = []string{strings.TrimSpace(line[len(m[0]):])}
+			continue
+		}
+		if strings.TrimSpace(line) == "" || !(strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) {
+			break
+		}
+		item = append(item, strings.TrimSpace(line))
+	}
+	flushItem()
+
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+func writeHeading(b *strings.Builder, level int, text string) {
+	tag := "h" + strconv.Itoa(level)
+	b.WriteString("<" + tag + ">" + renderInline(strings.TrimSpace(text)) + "</" + tag + ">\n")
+}
+
+func writeCode(b *strings.Builder, code []string, lang string) {
+	if lang != "" {
+		b.WriteString(`<pre><code class="language-` + html.EscapeString(lang) + `">`)
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	b.WriteString("</code></pre>\n")
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return fallback
+}
+
+// renderInline renders the inline elements of a block's text.
+func renderInline(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		switch {
+		case s[0] == '\\' && len(s) > 1 && strings.IndexByte("\\`*_{}[]()#+-.!~>|", s[1]) >= 0:
+			b.WriteString(html.EscapeString(s[1:2]))
+			s = s[2:]
+			continue
+		case s[0] == '`':
+			if end := strings.IndexByte(s[1:], '`'); end >= 0 {
+				b.WriteString("<code>" + html.EscapeString(s[1:1+end]) + "</code>")
+				s = s[end+2:]
+				continue
+			}
+		case s[0] == '!' && strings.HasPrefix(s[1:], "["):
+			if text, dest, rest, ok := parseLink(s[1:]); ok {
+				b.WriteString(`<img src="` + html.EscapeString(safeURL(dest)) + `" alt="` + html.EscapeString(text) + `">`)
+				s = rest
+				continue
+			}
+		case s[0] == '[':
+			if text, dest, rest, ok := parseLink(s); ok {
+				if dest = safeURL(dest); dest != "" {
+					b.WriteString(`<a href="` + html.EscapeString(dest) + `">` + renderInline(text) + "</a>")
+				} else {
+					b.WriteString(renderInline(text))
+				}
+				s = rest
+				continue
+			}
+		case strings.HasPrefix(s, "**"), strings.HasPrefix(s, "__"):
+			if inner, rest, ok := delimited(s, s[:2]); ok {
+				b.WriteString("<strong>" + renderInline(inner) + "</strong>")
+				s = rest
+				continue
+			}
+		case strings.HasPrefix(s, "~~"):
+			if inner, rest, ok := delimited(s, "~~"); ok {
+				b.WriteString("<del>" + renderInline(inner) + "</del>")
+				s = rest
+				continue
+			}
+		case s[0] == '*', s[0] == '_' && !wordChar(b.String()):
+			if inner, rest, ok := delimited(s, s[:1]); ok {
+				b.WriteString("<em>" + renderInline(inner) + "</em>")
+				s = rest
+				continue
+			}
+		}
+		b.WriteString(html.EscapeString(s[:1]))
+		s = s[1:]
+	}
+	return b.String()
+}
+
+// delimited finds the text between delim at the start of s and its closing match. The
+// text must not start or end with a space, so stray asterisks stay literal.
+func delimited(s, delim string) (inner, rest string, ok bool) {
+	end := strings.Index(s[len(delim):], delim)
+	if end <= 0 {
+		return "", "", false
+	}
+	inner = s[len(delim) : len(delim)+end]
+	if strings.TrimSpace(inner) != inner {
+		return "", "", false
+	}
+	return inner, s[len(delim)+end+len(delim):], true
+}
+
+// parseLink parses "[text](destination)" at the start of s. A title after the
+// destination is ignored.
+func parseLink(s string) (text, dest, rest string, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if !strings.HasPrefix(s[i+1:], "(") {
+				return "", "", "", false
+			}
+			end := closingParen(s[i+2:])
+			if end < 0 {
+				return "", "", "", false
+			}
+			fields := strings.Fields(s[i+2 : i+2+end])
+			return s[1:i], firstOr(fields, ""), s[i+2+end+1:], true
+		}
+	}
+	return "", "", "", false
+}
+
+// closingParen returns the index of the ")" closing a link destination, skipping
+// balanced pairs inside it, or -1.
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// wordChar reports whether the output so far ends inside a word, where "_" doesn't start
+// emphasis (snake_case names stay as they are).
+func wordChar(out string) bool {
+	if out == "" {
+		return false
+	}
+	c := out[len(out)-1]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// safeURL returns dest if it is relative or an http, https or mailto URL, and "" for
+// other schemes (javascript:, data:, ...).
+func safeURL(dest string) string {
+	scheme, _, found := strings.Cut(dest, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return dest // Relative
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return dest
+	}
+	return ""
+}
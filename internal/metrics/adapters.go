@@ -0,0 +1,21 @@
+// internal/metrics/adapters.go
+package metrics
+
+import "time"
+
+// Calls to the database, storage and cache adapters, labelled by adapter ("database",
+// "storage" or "cache"), backend type (e.g. "mongodb") and operation (the method called).
+var (
+	adapterCallDuration = Default.Histogram("blog_adapter_call_duration_seconds",
+		"Latency of database, storage and cache adapter calls.", DefaultBuckets, "adapter", "backend", "operation")
+	adapterCallErrors = Default.Counter("blog_adapter_call_errors_total",
+		"Failed database, storage and cache adapter calls. Not-found results don't count as failures.", "adapter", "backend", "operation")
+)
+
+// ObserveCall records an adapter call that began at start.
+func ObserveCall(adapter, backend, operation string, start time.Time, failed bool) {
+	adapterCallDuration.Observe(time.Since(start).Seconds(), adapter, backend, operation)
+	if failed {
+		adapterCallErrors.Inc(adapter, backend, operation)
+	}
+}
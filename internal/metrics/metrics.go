@@ -0,0 +1,221 @@
+// Package metrics is a small in-process metrics registry: labelled counters and
+// histograms, exposed in the Prometheus text format so any Prometheus-compatible scraper
+// can collect them and compute rates and percentiles.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds for latencies, in seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the application's metrics are recorded in.
+var Default = NewRegistry()
+
+// Registry holds metric families by name.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+type family interface {
+	write(w io.Writer, name string)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// Counter registers a counter family, or returns the one already registered as name.
+func (r *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name].(*CounterVec); ok {
+		return f
+	}
+	c := &CounterVec{meta: meta{help: help, labelNames: labelNames}, values: make(map[string]*counterSeries)}
+	r.families[name] = c
+	return c
+}
+
+// Histogram registers a histogram family with the given bucket upper bounds (ascending),
+// or returns the one already registered as name.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name].(*HistogramVec); ok {
+		return f
+	}
+	h := &HistogramVec{meta: meta{help: help, labelNames: labelNames}, buckets: buckets, values: make(map[string]*histogramSeries)}
+	r.families[name] = h
+	return h
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := sortedKeys(r.families)
+	families := make([]family, len(names))
+	for i, name := range names {
+		families[i] = r.families[name]
+	}
+	r.mu.Unlock()
+
+	for i, name := range names {
+		families[i].write(w, name)
+	}
+}
+
+// Handler serves the registry's metrics. A non-empty token must be presented as a
+// bearer token, so metrics can be exposed on a public listener.
+func (r *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+type meta struct {
+	help       string
+	labelNames []string
+}
+
+func (m *meta) header(w io.Writer, name, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, kind)
+}
+
+// labels formats label pairs, plus an extra one if extraName isn't empty.
+func (m *meta) labels(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, m.labelNames[i]+"="+strconv.Quote(value))
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+strconv.Quote(extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// CounterVec is a family of counters, one per combination of label values.
+type CounterVec struct {
+	meta
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc adds 1 to the counter with the given label values (in registration order).
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta (>= 0) to the counter with the given label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.value += delta
+}
+
+func (c *CounterVec) write(w io.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, name, "counter")
+	for _, key := range sortedKeys(c.values) {
+		s := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", name, c.labels(s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+// HistogramVec is a family of histograms, one per combination of label values.
+type HistogramVec struct {
+	meta
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// Observe records a value in the histogram with the given label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, name, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		s := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.labels(s.labelValues, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, h.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, h.labels(s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, h.labels(s.labelValues, "", ""), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
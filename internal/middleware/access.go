@@ -0,0 +1,154 @@
+// internal/middleware/access.go
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// combinedTimeFormat is the timestamp format of the Apache combined log format.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogger writes one line per HTTP request, as a JSON object or in the Apache
+// combined log format, to stdout or a rotated file.
+type AccessLogger struct {
+	format string
+	out    io.Writer
+	closer io.Closer
+
+	mu sync.Mutex // Serializes lines
+}
+
+// NewAccessLogger creates the access logger cfg configures, or returns nil if requests
+// are logged to the application log instead (no access log format) or not at all.
+func NewAccessLogger(cfg *config.LogConfig) (*AccessLogger, error) {
+	switch cfg.AccessFormat {
+	case "":
+		return nil, nil
+	case "off":
+		return &AccessLogger{format: "off"}, nil
+	case "json", "combined":
+	default:
+		return nil, fmt.Errorf("unknown access log format %q (want json, combined or off)", cfg.AccessFormat)
+	}
+	a := &AccessLogger{format: cfg.AccessFormat, out: os.Stdout}
+	if cfg.AccessFile != "" {
+		f, err := logging.OpenRotatingFile(cfg.AccessFile, cfg.AccessMaxSize, cfg.AccessMaxBackups, cfg.AccessMaxAge)
+		if err != nil {
+			return nil, err
+		}
+		a.out, a.closer = f, f
+	}
+	return a, nil
+}
+
+// Close closes the access log file, if any.
+func (a *AccessLogger) Close() error {
+	if a == nil || a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// accessEntry is a JSON access log line.
+type accessEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"requestId"`
+	RemoteAddr string  `json:"remoteAddr"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Query      string  `json:"query,omitempty"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"durationMs"`
+	UserID     string  `json:"userId,omitempty"`
+	TenantID   string  `json:"tenantId,omitempty"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"userAgent,omitempty"`
+}
+
+func (a *AccessLogger) log(r *http.Request, requestID string, info *requestInfo, status int, bytes int64, start time.Time, duration time.Duration) {
+	var line []byte
+	switch a.format {
+	case "json":
+		entry := accessEntry{
+			Time:       start.UTC().Format(time.RFC3339Nano),
+			RequestID:  requestID,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      redactQuery(r),
+			Proto:      r.Proto,
+			Status:     status,
+			Bytes:      bytes,
+			DurationMS: float64(duration.Microseconds()) / 1000,
+			UserID:     info.userID,
+			TenantID:   info.tenantID,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return
+		}
+		line = append(line, '\n')
+	case "combined":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		uri := r.URL.Path
+		if q := redactQuery(r); q != "" {
+			uri += "?" + q
+		}
+		line = fmt.Appendf(nil, "%s - %s [%s] %s %d %d %s %s\n",
+			host, orDash(info.userID), start.Format(combinedTimeFormat),
+			strconv.Quote(r.Method+" "+uri+" "+r.Proto), status, bytes,
+			strconv.Quote(orDash(r.Referer())), strconv.Quote(orDash(r.UserAgent())))
+	default:
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = a.out.Write(line)
+}
+
+// secretParams are query parameters that carry credentials (e.g. WebSocket tickets) and
+// are masked in the access log.
+var secretParams = []string{"ticket", "token"}
+
+// redactQuery returns the request's query string with credentials masked.
+func redactQuery(r *http.Request) string {
+	if r.URL.RawQuery == "" {
+		return ""
+	}
+	query := r.URL.Query()
+	redacted := false
+	for _, name := range secretParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return r.URL.RawQuery
+	}
+	return query.Encode()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
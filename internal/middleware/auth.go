@@ -4,15 +4,21 @@ package middleware
 import (
 	"context"
 	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/tenant"
 	"net/http"
 	"strings"
 )
 
 type contextKey string
 
-const UserIDContextKey contextKey = "userID"
+const (
+	UserIDContextKey contextKey = "userID"
+	KeyIDContextKey  contextKey = "keyID" // ID of the API key (bearer token) of the request; see auth.KeyID
+)
 
-// AuthMiddleware validates JWT token from Authorization header.
+// AuthMiddleware validates JWT token from Authorization header, and counts the request
+// towards the user's API usage (see UsageMiddleware).
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -33,13 +39,43 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
+		if tenantID, _ := auth.TokenTenant(tokenString); tenantID != tenant.ID(r.Context()) {
+			http.Error(w, "Token was issued for another tenant", http.StatusUnauthorized)
+			return
+		}
+
+		keyID, _ := auth.KeyID(tokenString)
 
-		// Add user ID to context
+		// Add user ID to context (and to the request's log lines)
 		ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, KeyIDContextKey, keyID)
+		ctx = logging.WithUserID(ctx, userID)
+		if itemID := itemPathID(r); itemID != "" {
+			ctx = logging.WithItemID(ctx, itemID)
+		}
+		noteUser(ctx, userID)
+		if !countUsage(ctx, w, userID, keyID) {
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
+// itemPathID returns the ID of the post, code file or item that r's route is about, or ""
+// for other routes.
+func itemPathID(r *http.Request) string {
+	pattern := r.Pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = pattern[i+1:] // Drop the method
+	}
+	for _, prefix := range []string{"/api/v1/posts/{id}", "/api/v1/code/{id}", "/api/v1/items/{type}/{id}"} {
+		if strings.HasPrefix(pattern, prefix) {
+			return r.PathValue("id")
+		}
+	}
+	return ""
+}
+
 // GetUserIDFromContext retrieves the user ID stored in the context by AuthMiddleware.
 // Returns empty string if not found (should not happen if middleware is applied correctly).
 func GetUserIDFromContext(ctx context.Context) string {
@@ -49,3 +85,10 @@ func GetUserIDFromContext(ctx context.Context) string {
 	}
 	return userID
 }
+
+// GetKeyIDFromContext retrieves the API key ID stored in the context by AuthMiddleware,
+// "" if there is none.
+func GetKeyIDFromContext(ctx context.Context) string {
+	keyID, _ := ctx.Value(KeyIDContextKey).(string)
+	return keyID
+}
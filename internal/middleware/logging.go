@@ -2,29 +2,205 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/audit"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 )
 
-func LoggingMiddleware(next http.Handler) http.Handler {
+// RequestIDHeader carries the ID of a request. A valid incoming one (e.g. set by a load
+// balancer) is kept, otherwise one is generated; either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// LoggingMiddleware gives each request an ID, attaches it to the request's context so
+// everything logged while handling it carries the ID (and audit events the client), and
+// logs the request once done: to access if it's set, else as a line of the application
+// log. 5xx responses are reported (see package errreport).
+func LoggingMiddleware(access *AccessLogger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("--> %s %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = audit.WithClient(ctx, ClientIP(r), r.UserAgent())
+		info := &requestInfo{}
+		ctx = context.WithValue(ctx, requestInfoKey, info)
+		slog.DebugContext(ctx, "Request started", "method", r.Method, "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
 
-		// Use a custom response writer to capture status code
+		// Use a custom response writer to capture status code and size
 		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK} // Default to 200
 
-		next.ServeHTTP(lrw, r)
+		next.ServeHTTP(lrw, r.WithContext(ctx))
 
-		log.Printf("<-- %s %s %d %s", r.Method, r.URL.Path, lrw.statusCode, time.Since(start))
+		duration := time.Since(start)
+		if lrw.statusCode >= 500 && !info.panicked {
+			errreport.Response(withNotedFields(ctx), r.Method, r.URL.Path, lrw.statusCode)
+		}
+		if access != nil {
+			access.log(r, requestID, info, lrw.statusCode, lrw.bytes, start, duration)
+			return
+		}
+		slog.InfoContext(ctx, "Request handled", "method", r.Method, "path", r.URL.Path, "status", lrw.statusCode,
+			"bytes", lrw.bytes, "duration", duration, "userID", info.userID, "remoteAddr", r.RemoteAddr)
 	})
 }
 
-// loggingResponseWriter wraps http.ResponseWriter to capture status code
+// trustedProxies are the reverse proxies whose X-Forwarded-For ClientIP believes. See
+// SetTrustedProxies.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the reverse proxies (CIDRs or addresses) whose X-Forwarded-For
+// ClientIP believes. Call it before serving requests.
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := config.ParseProxy(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+// ClientIP returns the address of the client. Requests from a trusted proxy are
+// attributed to the last X-Forwarded-For hop that isn't one itself; anyone else could
+// put anything in the header, so for them it's the connection's address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host // Only proxies all the way
+}
+
+// ViewerKey identifies an anonymous viewer for view deduplication without storing their
+// address: a hash of the client IP and user agent.
+func ViewerKey(r *http.Request) string {
+	sum := sha256.Sum256([]byte(ClientIP(r) + "|" + r.UserAgent()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// isTrustedProxy reports whether addr is one of the trusted proxies.
+func isTrustedProxy(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestInfo collects what handlers learn about a request that its log line needs, such
+// as the user AuthMiddleware authenticates further in.
+type requestInfo struct {
+	userID   string
+	tenantID string
+	panicked bool // RecoverMiddleware reported a panic
+}
+
+const requestInfoKey contextKey = "requestInfo"
+
+// noteUser records the user a request acts for, for its access log line.
+func noteUser(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// noteTenant records the tenant a request is for, for its access log line.
+func noteTenant(ctx context.Context, tenantID string) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.tenantID = tenantID
+	}
+}
+
+// notePanic records that a request's handler panicked.
+func notePanic(ctx context.Context) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.panicked = true
+	}
+}
+
+// withNotedFields adds the tenant and user noted for the request of ctx, which handlers
+// further in learned, to its log fields.
+func withNotedFields(ctx context.Context) context.Context {
+	info, ok := ctx.Value(requestInfoKey).(*requestInfo)
+	if !ok {
+		return ctx
+	}
+	if info.tenantID != "" {
+		ctx = logging.WithTenantID(ctx, info.tenantID)
+	}
+	if info.userID != "" {
+		ctx = logging.WithUserID(ctx, info.userID)
+	}
+	return ctx
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so a client can't inject
+// anything odd into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loggingResponseWriter wraps http.ResponseWriter to capture status code and size
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
@@ -32,8 +208,24 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// Optional: Override Write to capture size if needed
-// func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
-// 	// capture size
-// 	return lrw.ResponseWriter.Write(b)
-// }
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += int64(n)
+	return n, err
+}
+
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades take over the connection.
+func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lrw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	lrw.statusCode = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
@@ -0,0 +1,37 @@
+// internal/middleware/maintenance.go
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"net/http"
+)
+
+// WriteGuard tells whether requests may change data.
+type WriteGuard interface {
+	// CheckWritable returns an error with an apperr code while changes are paused.
+	CheckWritable() error
+}
+
+// ReadOnlyMiddleware answers requests that may change data (any method but GET, HEAD and
+// OPTIONS) with guard's error while it has one, e.g. 503 READ_ONLY in maintenance mode.
+// Reads, WebSocket upgrades and paths under exemptPrefixes (e.g. the admin API, so the
+// mode can be switched off) go on.
+func ReadOnlyMiddleware(guard WriteGuard, next http.Handler, exemptPrefixes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		err := guard.CheckWritable()
+		if err == nil || hasAnyPrefix(r.URL.Path, exemptPrefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		code := apperr.CodeOf(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(apperr.HTTPStatus(code))
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": apperr.Message(err), "code": string(code)})
+	})
+}
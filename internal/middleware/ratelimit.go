@@ -0,0 +1,61 @@
+// internal/middleware/ratelimit.go
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/config"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// authPaths are the endpoints that take a password, limited more strictly to slow down
+// guessing.
+var authPaths = map[string]bool{
+	"/api/v1/auth/login":    true,
+	"/api/v1/auth/register": true,
+}
+
+// RateLimits tells the rate limits in force, which may change at runtime.
+type RateLimits interface {
+	RateLimits() config.RateLimitConfig
+}
+
+// RateLimitMiddleware rejects requests from clients (by IP) over the current rate with
+// 429 and a Retry-After header. Login and registration have a stricter limit on top. If
+// the limiter fails, requests are let through rather than failing the API with it.
+func RateLimitMiddleware(limiter cache.RateLimiter, limits RateLimits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := limits.RateLimits()
+		requests := cache.RateLimit{Rate: cfg.RequestsPerMinute, Period: time.Minute, Burst: cfg.RequestBurst}
+		authAttempts := cache.RateLimit{Rate: cfg.AuthPerMinute, Period: time.Minute, Burst: cfg.AuthBurst}
+		ip := ClientIP(r)
+		if !allowRequest(w, r, limiter, "http:"+ip, requests) {
+			return
+		}
+		if r.Method == http.MethodPost && authPaths[r.URL.Path] && !allowRequest(w, r, limiter, "auth:"+ip, authAttempts) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest reports whether limit allows the request now, answering it with 429 if not.
+func allowRequest(w http.ResponseWriter, r *http.Request, limiter cache.RateLimiter, key string, limit cache.RateLimit) bool {
+	allowed, retryAfter, err := limiter.Allow(r.Context(), key, limit)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rate limiter failed, allowing request", "error", err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "Too many requests"})
+	return false
+}
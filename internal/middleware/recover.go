@@ -0,0 +1,91 @@
+// internal/middleware/recover.go
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+)
+
+// RecoverMiddleware turns a panic in a handler into a 500 response instead of a dropped
+// connection, and logs it with its stack and the request's context (request ID, tenant
+// and the authenticated user), and reports it (see package errreport). It should sit inside LoggingMiddleware and wrap
+// TimeoutMiddleware, which hands on panics from the goroutine it runs handlers in.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p) // Deliberate abort; net/http handles it quietly
+			}
+			value, stack := p, debug.Stack()
+			if hp, ok := p.(*handlerPanic); ok {
+				value, stack = hp.value, hp.stack
+			}
+
+			ctx := withNotedFields(r.Context())
+			slog.ErrorContext(ctx, "Panic handling request", "method", r.Method, "path", r.URL.Path, "panic", value, "stack", string(stack))
+			errreport.Panic(ctx, "Panic handling request", value, stack, "method", r.Method, "path", r.URL.Path)
+			notePanic(ctx) // Reported; not again as a 5xx response
+			if rw.wroteHeader {
+				return // Too late for an error response
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// handlerPanic carries a panic out of the goroutine it happened in, with that goroutine's
+// stack.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// recoverWriter records whether the response has started.
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoverWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoverWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recoverWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	rw.wroteHeader = true
+	return h.Hijack()
+}
@@ -0,0 +1,52 @@
+// internal/middleware/tenant.go
+package middleware
+
+import (
+	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"net/http"
+	"strings"
+)
+
+// TenantMiddleware finds the tenant each request is for and adds it to the request's
+// context: the tenant served at the request's host, else the one its bearer token (or
+// WebSocket ticket) was issued for, else the default tenant. Requests for no known tenant
+// are rejected with 404, so they can't reach any tenant's data.
+func TenantMiddleware(resolver *tenant.Resolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID := resolver.FromHost(r.Host)
+		if tenantID == "" {
+			tenantID = tokenTenant(r)
+		}
+		if tenantID == "" {
+			tenantID = resolver.Default()
+		}
+		if !resolver.Known(tenantID) {
+			http.Error(w, "Unknown tenant", http.StatusNotFound)
+			return
+		}
+
+		ctx := tenant.WithID(r.Context(), tenantID)
+		ctx = logging.WithTenantID(ctx, tenantID)
+		noteTenant(ctx, tenantID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenTenant returns the tenant of the request's bearer token or WebSocket ticket, or ""
+// if it has neither or the token is invalid.
+func tokenTenant(r *http.Request) string {
+	token := r.URL.Query().Get("ticket")
+	if scheme, bearer, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "bearer") {
+		token = bearer
+	}
+	if token == "" {
+		return ""
+	}
+	tenantID, err := auth.TokenTenant(token)
+	if err != nil {
+		return ""
+	}
+	return tenantID
+}
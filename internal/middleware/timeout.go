@@ -0,0 +1,140 @@
+// internal/middleware/timeout.go
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeoutMiddleware bounds how long a request may take. The request's context gets the
+// deadline, so the database and storage calls it makes give up too; if the handler
+// hasn't responded by then, the client gets a 504 with a JSON error and the handler's
+// later writes are discarded. WebSocket upgrades and paths under exemptPrefixes (e.g.
+// long-running admin tasks) aren't limited. A timeout of 0 disables it.
+func TimeoutMiddleware(timeout time.Duration, next http.Handler, exemptPrefixes ...string) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || hasAnyPrefix(r.URL.Path, exemptPrefixes) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{w: w, header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						p = &handlerPanic{value: p, stack: debug.Stack()}
+					}
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+					if tw.timedOut { // The middleware has returned; no one else will see it
+						slog.ErrorContext(ctx, "Panic handling request after it timed out", "method", r.Method, "path", r.URL.Path, "panic", p)
+						return
+					}
+					panicked <- p // Buffered; checked under the lock if the request times out
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p) // Let RecoverMiddleware (or the server) handle it as usual
+		case <-done:
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			select {
+			case p := <-panicked:
+				panic(p) // It panicked just as the deadline passed
+			default:
+			}
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) || tw.wroteHeader {
+				return // Client gone, or the response already started
+			}
+			slog.WarnContext(ctx, "Request timed out", "method", r.Method, "path", r.URL.Path, "timeout", timeout)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "request timed out"})
+		}
+	})
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutWriter passes the handler's response through until the request times out. The
+// handler gets its own header map, copied when the response starts, so it never touches
+// the real one while the middleware may be writing the timeout response.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if f, ok := tw.w.(http.Flusher); ok && !tw.timedOut {
+		f.Flush()
+	}
+}
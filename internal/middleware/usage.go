@@ -0,0 +1,45 @@
+// internal/middleware/usage.go
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UsageMeter counts users' authenticated requests against their daily quota.
+type UsageMeter interface {
+	// CountRequest counts a request by userID with API key keyID and reports whether
+	// their quota allows it.
+	CountRequest(ctx context.Context, userID, keyID string) bool
+}
+
+const usageMeterKey contextKey = "usageMeter"
+
+// UsageMiddleware has AuthMiddleware count each request it authenticates with meter,
+// answering 429 to users whose daily quota is used up. The quota renews at midnight UTC.
+func UsageMiddleware(meter UsageMeter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), usageMeterKey, meter)))
+	})
+}
+
+// countUsage counts the request of ctx by userID with API key keyID with the UsageMeter
+// set up by UsageMiddleware, if any. It reports whether the request may go on, answering
+// it with 429 if not.
+func countUsage(ctx context.Context, w http.ResponseWriter, userID, keyID string) bool {
+	meter, ok := ctx.Value(usageMeterKey).(UsageMeter)
+	if !ok || meter.CountRequest(ctx, userID, keyID) {
+		return true
+	}
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(midnight.Sub(now).Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "Daily request quota exceeded"})
+	return false
+}
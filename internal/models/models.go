@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/kkuzar/blog_system/internal/diff"
 )
 
 // HistoryAction defines the type of action logged.
@@ -10,11 +12,24 @@ type HistoryAction string
 // ... (ItemType, User, Post, CodeFile, Change, HistoryAction constants remain same) ...
 // Add ActionRevert constant
 const (
-	ActionCreate   HistoryAction = "create"
-	ActionDelete   HistoryAction = "delete"
-	ActionPatch    HistoryAction = "patch"
-	ActionSnapshot HistoryAction = "snapshot"
-	ActionRevert   HistoryAction = "revert" // Added
+	ActionCreate    HistoryAction = "create"
+	ActionDelete    HistoryAction = "delete"
+	ActionPatch     HistoryAction = "patch"
+	ActionSnapshot  HistoryAction = "snapshot"
+	ActionRevert    HistoryAction = "revert"    // Added
+	ActionRestore   HistoryAction = "restore"   // Item restored from the trash
+	ActionRename    HistoryAction = "rename"    // Code file renamed or moved
+	ActionTransfer  HistoryAction = "transfer"  // Ownership handed to another user
+	ActionPublish   HistoryAction = "publish"   // Post draft promoted to published content
+	ActionSlug      HistoryAction = "slug"      // Post slug changed
+	ActionArchive   HistoryAction = "archive"   // Item hidden from default listings
+	ActionUnarchive HistoryAction = "unarchive" // Item listed again
+	ActionAuthors   HistoryAction = "authors"   // Post co-authors changed
+	ActionUnpublish HistoryAction = "unpublish" // Published post taken down by an admin
+	ActionPurge     HistoryAction = "purge"     // Trashed item removed for good; its history is kept
+	// ActionSettings reports a change to what a published post shows besides its content
+	// (title, tags, excerpt, cover, SEO metadata, language, placement) to item hooks. It isn't logged.
+	ActionSettings HistoryAction = "settings"
 )
 
 type HistoryLog struct {
@@ -29,6 +44,24 @@ type HistoryLog struct {
 	S3PathBefore string `json:"-" bson:"s3PathBefore,omitempty" dynamodbav:"s3PathBefore,omitempty" firestore:"s3PathBefore,omitempty"` // Path before delete/revert
 	S3PathAfter  string `json:"-" bson:"s3PathAfter,omitempty" dynamodbav:"s3PathAfter,omitempty" firestore:"s3PathAfter,omitempty"`    // Path after create/snapshot/revert
 	ItemVersion  int    `json:"itemVersion" bson:"itemVersion" dynamodbav:"itemVersion" firestore:"itemVersion"`
+	// ChangeIndex orders patch entries that share an ItemVersion (one batch of changes)
+	ChangeIndex int `json:"changeIndex,omitempty" bson:"changeIndex,omitempty" dynamodbav:"changeIndex,omitempty" firestore:"changeIndex,omitempty"`
+	// PathBefore/After record the old and new path of a rename
+	PathBefore string `json:"pathBefore,omitempty" bson:"pathBefore,omitempty" dynamodbav:"pathBefore,omitempty" firestore:"pathBefore,omitempty"`
+	PathAfter  string `json:"pathAfter,omitempty" bson:"pathAfter,omitempty" dynamodbav:"pathAfter,omitempty" firestore:"pathAfter,omitempty"`
+	// SlugBefore/After record the old and new slug of a post
+	SlugBefore string `json:"slugBefore,omitempty" bson:"slugBefore,omitempty" dynamodbav:"slugBefore,omitempty" firestore:"slugBefore,omitempty"`
+	SlugAfter  string `json:"slugAfter,omitempty" bson:"slugAfter,omitempty" dynamodbav:"slugAfter,omitempty" firestore:"slugAfter,omitempty"`
+	// CoAuthorsBefore/After record the old and new co-authors of a post
+	CoAuthorsBefore []string `json:"coAuthorsBefore,omitempty" bson:"coAuthorsBefore,omitempty" dynamodbav:"coAuthorsBefore,omitempty" firestore:"coAuthorsBefore,omitempty"`
+	CoAuthorsAfter  []string `json:"coAuthorsAfter,omitempty" bson:"coAuthorsAfter,omitempty" dynamodbav:"coAuthorsAfter,omitempty" firestore:"coAuthorsAfter,omitempty"`
+	// Label names a snapshot taken on request
+	Label string `json:"label,omitempty" bson:"label,omitempty" dynamodbav:"label,omitempty" firestore:"label,omitempty"`
+	// OwnerID is who owned the item when an item event (see GET /events) was logged, and
+	// EventSeq the entry's number among that user's events, counting from 1. Both are
+	// unset on entries that aren't events, such as snapshots.
+	OwnerID  string `json:"ownerId,omitempty" bson:"ownerId,omitempty" dynamodbav:"ownerId,omitempty" firestore:"ownerId,omitempty"`
+	EventSeq int64  `json:"-" bson:"eventSeq,omitempty" dynamodbav:"eventSeq,omitempty" firestore:"eventSeq,omitempty"`
 	// Optional: Add field to link revert action to the log entry being reverted to
 	RevertedToLogID *string `json:"revertedToLogId,omitempty" bson:"revertedToLogId,omitempty" dynamodbav:"revertedToLogId,omitempty" firestore:"revertedToLogId,omitempty"` // Added
 }
@@ -50,6 +83,268 @@ type LoginResponse struct {
 	User  User   `json:"user"`
 }
 
+// CloneItemRequest is the optional body of POST /items/{type}/{id}/clone.
+type CloneItemRequest struct {
+	Name string `json:"name,omitempty"` // Title or file name of the copy; derived from the source if empty
+}
+
+// RenameCodeFileRequest is the body of PATCH /code/{id}.
+type RenameCodeFileRequest struct {
+	Path string `json:"path"` // New path; the file name is its last element
+}
+
+// FormatCodeRequest is the body of POST /code/{id}/format.
+type FormatCodeRequest struct {
+	BaseVersion int `json:"baseVersion,omitempty"` // If set, must be the current version
+}
+
+// FormatCodeResponse reports the outcome of formatting a code file.
+type FormatCodeResponse struct {
+	ItemID     string `json:"itemId"`
+	NewVersion int    `json:"newVersion"`
+	Changed    bool   `json:"changed"` // False if the file was already formatted
+}
+
+// ReplaceContentResponse reports the outcome of overwriting a code file with an upload.
+type ReplaceContentResponse struct {
+	ItemID     string `json:"itemId"`
+	NewVersion int    `json:"newVersion"`
+	Changed    bool   `json:"changed"` // False if the upload matched the current content
+}
+
+// RunCodeRequest is the body of POST /code/{id}/run.
+type RunCodeRequest struct {
+	Stdin string `json:"stdin,omitempty"`
+}
+
+// SetPostSlugRequest is the body of PUT /posts/{id}/slug.
+type SetPostSlugRequest struct {
+	Slug string `json:"slug"` // Lowercase letters, digits and single hyphens
+}
+
+// CreateSnapshotRequest is the optional body of POST /items/{type}/{id}/snapshots.
+type CreateSnapshotRequest struct {
+	Label string `json:"label,omitempty"` // Shown in the history; at most 100 characters
+}
+
+// CreateVersionTagRequest is the body of POST /items/{type}/{id}/tags. The tag points at
+// the version of LogID if set, else at Version, else at the current version.
+type CreateVersionTagRequest struct {
+	Name    string `json:"name"`
+	Version int    `json:"version,omitempty"`
+	LogID   string `json:"logId,omitempty"` // A history entry of the item
+}
+
+// CommentRequest is the body of POST /items/{type}/{id}/comments. With Anchor the
+// comment is on a selection of the item's content rather than the whole item; its
+// Version may be left out for the current version, and Detached and Published are
+// ignored. Users who can't edit a post select its published content: their Version may
+// only be the post's PublishedVersion, which is also what leaving it out means.
+type CommentRequest struct {
+	Body   string         `json:"body"`
+	Anchor *CommentAnchor `json:"anchor,omitempty"`
+}
+
+// CommentStatusRequest is the body of PUT /items/{type}/{id}/comments/{commentId}/status.
+type CommentStatusRequest struct {
+	Status CommentStatus `json:"status"`
+}
+
+// ReportRequest is the body of POST /reports. Without CommentID it reports a published
+// post; with it, the comment on the item.
+type ReportRequest struct {
+	ItemID    string `json:"itemId"`
+	ItemType  string `json:"itemType"`            // "post", or "codefile" for a comment on one
+	CommentID string `json:"commentId,omitempty"` // Optional: the comment reported
+	Reason    string `json:"reason"`              // One of ReportReasons
+	Details   string `json:"details,omitempty"`
+}
+
+// ResolveReportRequest is the body of POST /admin/reports/{id}/resolve.
+type ResolveReportRequest struct {
+	Action string `json:"action"`         // "dismiss", or "unpublish" to take the content down
+	Note   string `json:"note,omitempty"` // Optional: why, for other admins
+}
+
+// TemplateRequest is the body of POST /templates and PUT /templates/{id}. An update
+// replaces every field but ItemType, which is fixed at creation.
+type TemplateRequest struct {
+	Name     string `json:"name"`
+	ItemType string `json:"itemType"`           // "post" or "codefile"
+	Title    string `json:"title,omitempty"`    // Posts
+	FileName string `json:"fileName,omitempty"` // Code files; may include directories
+	Language string `json:"language,omitempty"` // Code files
+	Content  string `json:"content"`
+}
+
+// SaveDraftRequest is the body of PUT /posts/{id}/draft. The draft is replaced as a whole.
+type SaveDraftRequest struct {
+	BaseVersion int    `json:"baseVersion"`
+	Content     string `json:"content"`
+}
+
+// PublishPostRequest is the optional body of POST /posts/{id}/publish.
+type PublishPostRequest struct {
+	Version int `json:"version,omitempty"` // Draft version to publish; must be current if set
+}
+
+// DraftSavedResponse reports the draft version after a save or discard.
+type DraftSavedResponse struct {
+	Version int `json:"version"`
+}
+
+// PostDraft is the draft of a post along with its publishing state.
+type PostDraft struct {
+	PostID           string     `json:"postId"`
+	Content          string     `json:"content"`
+	Version          int        `json:"version"`
+	PublishedVersion int        `json:"publishedVersion,omitempty"` // 0 if never published
+	PublishedAt      *time.Time `json:"publishedAt,omitempty"`
+	ScheduledAt      *time.Time `json:"scheduledAt,omitempty"`
+	Unpublished      bool       `json:"unpublishedChanges"` // Draft has changed since it was last published
+	ContentHash      string     `json:"contentHash"`        // Hex SHA-256 of Content
+}
+
+// PublishedPost is the published content of a post.
+type PublishedPost struct {
+	PostID      string     `json:"postId"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Content     string     `json:"content"`
+	Excerpt     string     `json:"excerpt,omitempty"`
+	Authors     []string   `json:"authors"` // Owner first, then co-authors
+	Tags        []string   `json:"tags,omitempty"`
+	CoverImage  string     `json:"coverImage,omitempty"` // Asset ID
+	Version     int        `json:"version"`              // Draft version that was published
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"` // The owner's, which PublishedAt is in; empty for UTC
+	// Search engine metadata; MetaDescription falls back to the excerpt
+	CanonicalURL    string `json:"canonicalUrl,omitempty"`
+	MetaDescription string `json:"metaDescription,omitempty"`
+	NoIndex         bool   `json:"noIndex,omitempty"`
+	// Language variants: the post's language, the post it translates, and its other
+	// published variants (for hreflang links)
+	Language      string        `json:"language,omitempty"`
+	TranslationOf string        `json:"translationOf,omitempty"`
+	Translations  []PostVariant `json:"translations,omitempty"`
+}
+
+// PostVariant is a published language variant of a post.
+type PostVariant struct {
+	PostID    string `json:"postId"`
+	Language  string `json:"language"`
+	Slug      string `json:"slug"`
+	Title     string `json:"title"`
+	Canonical bool   `json:"canonical,omitempty"` // The post the others translate
+}
+
+// PublicPostSummary is a published post in a public listing of a user's blog.
+type PublicPostSummary struct {
+	PostID      string     `json:"postId"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Excerpt     string     `json:"excerpt,omitempty"`
+	Authors     []string   `json:"authors"` // Owner first, then co-authors
+	Tags        []string   `json:"tags,omitempty"`
+	CoverImage  string     `json:"coverImage,omitempty"` // Asset ID
+	Language    string     `json:"language,omitempty"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+}
+
+// SetPostAuthorsRequest is the body of PUT /posts/{id}/authors.
+type SetPostAuthorsRequest struct {
+	CoAuthors []string `json:"coAuthors"` // User IDs of editors, in byline order; empty for none
+}
+
+// SetPostOrderRequest is the body of PUT /posts/order.
+type SetPostOrderRequest struct {
+	PostIDs []string `json:"postIds"` // Posts to list first, in order; the rest follow by date
+}
+
+// SetPostExcerptRequest is the body of PUT /posts/{id}/excerpt.
+type SetPostExcerptRequest struct {
+	Excerpt string `json:"excerpt"` // Empty to go back to the generated excerpt
+}
+
+// SetPostCoverImageRequest is the body of PUT /posts/{id}/cover.
+type SetPostCoverImageRequest struct {
+	AssetID string `json:"assetId"` // An image asset of the post's owner; empty removes the cover
+}
+
+// SetPostLanguageRequest is the body of PUT /posts/{id}/language.
+type SetPostLanguageRequest struct {
+	Language      string `json:"language"`                // Language tag such as en or pt-BR; empty to unset
+	TranslationOf string `json:"translationOf,omitempty"` // ID of the post this one translates; empty for none
+}
+
+// SchedulePostRequest is the body of PUT /posts/{id}/schedule.
+type SchedulePostRequest struct {
+	PublishAt string `json:"publishAt"`          // Local time such as 2026-10-20T09:00, or RFC 3339 with an offset
+	Timezone  string `json:"timezone,omitempty"` // Zone of a local PublishAt; defaults to the author's
+	Version   int    `json:"version,omitempty"`  // Draft version to publish; 0 for the draft as it is then
+}
+
+// UpdatePostRequest is the body of PATCH /posts/{id}. Omitted fields are left as they are.
+type UpdatePostRequest struct {
+	Slug       *string `json:"slug,omitempty"`
+	Excerpt    *string `json:"excerpt,omitempty"`    // Empty to go back to the generated excerpt
+	CoverImage *string `json:"coverImage,omitempty"` // Asset ID; empty removes the cover
+	// Search engine metadata; empty strings clear them
+	CanonicalURL    *string `json:"canonicalUrl,omitempty"`
+	MetaDescription *string `json:"metaDescription,omitempty"`
+	NoIndex         *bool   `json:"noIndex,omitempty"`
+}
+
+// CreateTransferRequest is the body of POST /items/{type}/{id}/transfer.
+type CreateTransferRequest struct {
+	ToUserID string `json:"toUserId"`
+}
+
+// CreateShareLinkRequest is the body of POST /items/{type}/{id}/share.
+type CreateShareLinkRequest struct {
+	Access           string `json:"access"`                     // "read", the default and only level
+	ExpiresInSeconds int64  `json:"expiresInSeconds,omitempty"` // 0 creates a link that never expires
+}
+
+// SubscribeSharedPayload subscribes a (possibly anonymous) WebSocket client to an item
+// through a share link. Such subscriptions are read-only.
+type SubscribeSharedPayload struct {
+	Token string `json:"token"`
+}
+
+// SetCollaboratorRequest is the body of PUT /items/{type}/{id}/collaborators/{userId}.
+type SetCollaboratorRequest struct {
+	Role Role `json:"role"` // "editor" or "viewer"
+}
+
+// CreateWorkspaceRequest is the body of POST /workspaces.
+type CreateWorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// MoveToWorkspaceRequest is the body of POST /items/{type}/{id}/workspace.
+type MoveToWorkspaceRequest struct {
+	WorkspaceID string `json:"workspaceId"` // "default" (or empty) for the default workspace
+}
+
+// CreateProjectRequest is the body of POST /projects.
+type CreateProjectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// MoveCodeFileRequest is the body of POST /code/{id}/move.
+type MoveCodeFileRequest struct {
+	ProjectID string `json:"projectId"`      // Target project; empty removes the file from its project
+	Path      string `json:"path,omitempty"` // Optional new path within the project
+}
+
+// WSTicketResponse carries a one-time ticket for opening an authenticated WebSocket.
+type WSTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 // WebSocket Messages
 type WebSocketMessage struct {
 	Action  string      `json:"action"`
@@ -57,6 +352,24 @@ type WebSocketMessage struct {
 	Seq     int64       `json:"seq,omitempty"`
 }
 
+// ChunkPayload carries one part of a message too large to send in one frame (action
+// "chunk"). Joining the Data of a transfer's chunks in Index order gives the JSON of the
+// original message, which a "chunk_end" frame announces as complete.
+type ChunkPayload struct {
+	TransferID int64  `json:"transferId"`
+	Index      int    `json:"index"`
+	Data       string `json:"data"`
+}
+
+// ChunkEndPayload ends a chunked transfer (action "chunk_end"); Action is the action of
+// the reassembled message, and Size its length in bytes.
+type ChunkEndPayload struct {
+	TransferID int64  `json:"transferId"`
+	Action     string `json:"action"`
+	Chunks     int    `json:"chunks"`
+	Size       int    `json:"size"`
+}
+
 type AuthPayload struct {
 	Token string `json:"token"`
 }
@@ -64,10 +377,11 @@ type AuthPayload struct {
 // ... (LoginRequest, RegisterRequest, LoginResponse, WebSocketMessage, AuthPayload, ErrorPayload, ContentRequestPayload, ContentResponsePayload, IncrementalUpdatePayload, CreatePostPayload, CreateCodeFilePayload, DeleteItemPayload, SuccessPayload, ApplyChangesSuccessPayload remain same) ...
 
 type ErrorPayload struct {
-	Message string `json:"message"`
-	Code    string `json:"code,omitempty"` // Optional error code (e.g., "CONFLICT", "NOT_FOUND")
-	Action  string `json:"action,omitempty"`
-	Seq     int64  `json:"seq,omitempty"`
+	Message  string                  `json:"message"`
+	Code     string                  `json:"code,omitempty"` // Optional error code (e.g., "CONFLICT", "NOT_FOUND")
+	Action   string                  `json:"action,omitempty"`
+	Seq      int64                   `json:"seq,omitempty"`
+	Conflict *VersionConflictPayload `json:"conflict,omitempty"` // Server state, with code "CONFLICT" for stale changes
 }
 
 type ContentRequestPayload struct {
@@ -92,20 +406,32 @@ type ContentResponsePayload struct {
 // IncrementalUpdatePayload is used for the 'apply_changes' action
 type IncrementalUpdatePayload struct {
 	ItemID      string   `json:"itemId"`
-	ItemType    string   `json:"itemType"`    // Expect "post" or "codefile" string
-	BaseVersion int      `json:"baseVersion"` // The version the client based the changes on
-	Changes     []Change `json:"changes"`     // List of changes in this update
+	ItemType    string   `json:"itemType"`        // Expect "post" or "codefile" string
+	BaseVersion int      `json:"baseVersion"`     // The version the client based the changes on
+	Changes     []Change `json:"changes"`         // List of changes in this update
+	Merge       bool     `json:"merge,omitempty"` // Three-way merge with the server head if BaseVersion is stale
+}
+
+// ApplyChangesRequest is the body of PATCH /posts/{id}/content and /code/{id}/content,
+// an apply_changes payload for the item in the path.
+type ApplyChangesRequest struct {
+	BaseVersion int      `json:"baseVersion"`
+	Changes     []Change `json:"changes"`
+	Merge       bool     `json:"merge,omitempty"`
 }
 
 type CreatePostPayload struct {
 	Title          string `json:"title"`
+	Slug           string `json:"slug,omitempty"` // Generated from the title if empty
 	InitialContent string `json:"initialContent"`
+	TemplateID     string `json:"templateId,omitempty"` // Pre-fills empty fields from a post template
 }
 
 type CreateCodeFilePayload struct {
 	FileName       string `json:"fileName"`
 	Language       string `json:"language"`
 	InitialContent string `json:"initialContent"`
+	TemplateID     string `json:"templateId,omitempty"` // Pre-fills empty fields from a code file template
 }
 
 type DeleteItemPayload struct {
@@ -126,6 +452,37 @@ type ApplyChangesSuccessPayload struct {
 	ItemType   string `json:"itemType"`
 	NewVersion int    `json:"newVersion"`
 	Message    string `json:"message"`
+	Merged     bool   `json:"merged,omitempty"`  // Changes were merged onto a newer server version
+	Content    string `json:"content,omitempty"` // Full merged content, set when Merged is true
+}
+
+// VersionChanges is the batch of changes that produced a version.
+type VersionChanges struct {
+	Version int      `json:"version"`
+	Changes []Change `json:"changes"`
+}
+
+// VersionConflictPayload is the server state returned with a version conflict, so the
+// client can rebase its edits without fetching it: either the batches of changes from
+// BaseVersion to CurrentVersion, oldest first, or the full current content when those
+// aren't all in the history (e.g. a revert in between) or there are too many.
+type VersionConflictPayload struct {
+	ItemID         string           `json:"itemId"`
+	ItemType       string           `json:"itemType"`
+	BaseVersion    int              `json:"baseVersion"`
+	CurrentVersion int              `json:"currentVersion"`
+	Changes        []VersionChanges `json:"changes,omitempty"`
+	Content        *string          `json:"content,omitempty"` // Set instead of Changes; may be empty
+}
+
+// MergeConflictPayload is sent when stale changes couldn't be merged automatically
+type MergeConflictPayload struct {
+	ItemID         string          `json:"itemId"`
+	ItemType       string          `json:"itemType"`
+	BaseVersion    int             `json:"baseVersion"`
+	CurrentVersion int             `json:"currentVersion"`
+	Content        string          `json:"content"` // Merged content with conflict markers
+	Conflicts      []diff.Conflict `json:"conflicts"`
 }
 
 // --- New WebSocket Payloads ---
@@ -146,10 +503,96 @@ type GetHistoryPayload struct {
 	Limit    int    `json:"limit,omitempty"` // Optional limit
 }
 
+// GetVersionPayload is used for the 'get_content_at_version' action
+type GetVersionPayload struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Version  int    `json:"version"`
+}
+
+// GetDiffPayload is used for the 'get_diff' action. ToVersion 0 means the current version.
+type GetDiffPayload struct {
+	ItemID      string `json:"itemId"`
+	ItemType    string `json:"itemType"`
+	FromVersion int    `json:"fromVersion"`
+	ToVersion   int    `json:"toVersion,omitempty"`
+}
+
+// GetChangesPayload is used for the 'get_changes' action.
+type GetChangesPayload struct {
+	ItemID       string `json:"itemId"`
+	ItemType     string `json:"itemType"`
+	SinceVersion int    `json:"sinceVersion"`
+}
+
+// ChangesSincePayload lists the batches of changes that took an item from SinceVersion
+// to CurrentVersion, oldest first. Applying them in order to the content at SinceVersion
+// gives the current content.
+type ChangesSincePayload struct {
+	ItemID         string           `json:"itemId"`
+	ItemType       string           `json:"itemType"`
+	SinceVersion   int              `json:"sinceVersion"`
+	CurrentVersion int              `json:"currentVersion"`
+	Versions       []VersionChanges `json:"versions"` // Empty if SinceVersion is current
+}
+
+// Units of a content range.
+const (
+	RangeBytes = "bytes"
+	RangeLines = "lines"
+)
+
+// GetContentRangePayload asks for part of an item's current content, so editors can load
+// large files lazily. Start and End are inclusive: 0-based byte offsets, or 1-based line
+// numbers. Without End, the range runs to the end of the content.
+type GetContentRangePayload struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Unit     string `json:"unit"` // "bytes" or "lines"
+	Start    int    `json:"start"`
+	End      *int   `json:"end,omitempty"`
+}
+
+// ContentRangePayload is part of an item's current content. End is the last byte or line
+// actually returned, and Total the size of the whole content in the same unit.
+type ContentRangePayload struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Version  int    `json:"version"`
+	Unit     string `json:"unit"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Total    int    `json:"total"`
+	Content  string `json:"content"`
+}
+
+// VersionDiffPayload is the server-computed diff between two versions of an item.
+type VersionDiffPayload struct {
+	ItemID      string       `json:"itemId"`
+	ItemType    string       `json:"itemType"`
+	FromVersion int          `json:"fromVersion"`
+	ToVersion   int          `json:"toVersion"`
+	Diff        *diff.Result `json:"diff"`
+}
+
+// CreateSnapshotPayload is used for the 'create_snapshot' action
+type CreateSnapshotPayload struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Label    string `json:"label,omitempty"`
+}
+
 type RevertActionPayload struct {
 	TargetLogID string `json:"targetLogId"` // The ID of the HistoryLog entry to revert TO
 }
 
+// RevertToTagPayload is used for the 'revert_to_tag' action
+type RevertToTagPayload struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Tag      string `json:"tag"` // Name of a VersionTag of the item
+}
+
 // BroadcastChangePayload is sent to subscribed clients when content changes
 type BroadcastChangePayload struct {
 	ItemID     string   `json:"itemId"`
@@ -159,12 +602,74 @@ type BroadcastChangePayload struct {
 	Originator string   `json:"originator"` // UserID of the client who made the change (optional, for client-side logic)
 }
 
+// BroadcastCommentPayload is sent when a comment on an item is shown (posted or approved,
+// with Comment) or hidden (deleted or taken back into moderation, with only CommentID).
+type BroadcastCommentPayload struct {
+	ItemID     string   `json:"itemId"`
+	ItemType   string   `json:"itemType"`
+	CommentID  string   `json:"commentId"`
+	Comment    *Comment `json:"comment,omitempty"`
+	Originator string   `json:"originator,omitempty"`
+}
+
 // BroadcastDeletePayload is sent when an item is deleted
 type BroadcastDeletePayload struct {
 	ItemID   string `json:"itemId"`
 	ItemType string `json:"itemType"`
 }
 
+// FormatCodePayload is used for the 'format_code' action
+type FormatCodePayload struct {
+	ItemID      string `json:"itemId"`
+	BaseVersion int    `json:"baseVersion,omitempty"` // If set, must be the current version
+}
+
+// RunCodePayload is used for the 'run_code' action
+type RunCodePayload struct {
+	ItemID string `json:"itemId"`
+	Stdin  string `json:"stdin,omitempty"`
+}
+
+// RenameCodeFilePayload is sent by clients to rename or move a code file.
+type RenameCodeFilePayload struct {
+	ItemID string `json:"itemId"`
+	Path   string `json:"path"`
+}
+
+// BroadcastSlugPayload is sent when a post's slug changes
+type BroadcastSlugPayload struct {
+	ItemID     string `json:"itemId"`
+	Slug       string `json:"slug"`
+	Originator string `json:"originator,omitempty"`
+}
+
+// BroadcastSnapshotPayload is sent when a user checkpoints an item
+type BroadcastSnapshotPayload struct {
+	ItemID     string `json:"itemId"`
+	ItemType   string `json:"itemType"`
+	LogID      string `json:"logId"` // The snapshot's history entry
+	Version    int    `json:"version"`
+	Label      string `json:"label,omitempty"`
+	Originator string `json:"originator,omitempty"`
+}
+
+// BroadcastArchivePayload is sent when an item is archived or unarchived
+type BroadcastArchivePayload struct {
+	ItemID     string `json:"itemId"`
+	Archived   bool   `json:"archived"`
+	Originator string `json:"originator,omitempty"`
+}
+
+// BroadcastRenamePayload is sent when a code file is renamed or moved
+type BroadcastRenamePayload struct {
+	ItemID     string `json:"itemId"`
+	ItemType   string `json:"itemType"`
+	FileName   string `json:"fileName"`
+	Path       string `json:"path"`
+	ProjectID  string `json:"projectId,omitempty"`
+	Originator string `json:"originator,omitempty"`
+}
+
 // ItemType defines the type of content item (Post or CodeFile).
 type ItemType string
 
@@ -191,32 +696,895 @@ func (it ItemType) IsValid() bool {
 type User struct {
 	ID           string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
 	Username     string    `json:"username" bson:"username" dynamodbav:"username" firestore:"username"`
+	TenantID     string    `json:"tenantId,omitempty" bson:"tenantId,omitempty" dynamodbav:"tenantId,omitempty" firestore:"tenantId,omitempty"` // Empty without multi-tenancy
 	PasswordHash string    `json:"-" bson:"passwordHash" dynamodbav:"passwordHash" firestore:"passwordHash"`
 	CreatedAt    time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	StorageBytes int64     `json:"storageBytes" bson:"storageBytes" dynamodbav:"storageBytes" firestore:"storageBytes"` // Sum of Size over the user's items
+	// Theme of their public pages (blog and static export); empty for the default
+	SiteTheme string `json:"siteTheme,omitempty" bson:"siteTheme,omitempty" dynamodbav:"siteTheme,omitempty" firestore:"siteTheme,omitempty"`
+	// IANA name of their time zone, e.g. "Europe/Helsinki": dates on their public pages are
+	// shown in it, and scheduled times without an offset are read in it. Empty for UTC.
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty" dynamodbav:"timezone,omitempty" firestore:"timezone,omitempty"`
+	// Where their activity digests are sent; empty for none
+	Email string `json:"email,omitempty" bson:"email,omitempty" dynamodbav:"email,omitempty" firestore:"email,omitempty"`
+	// Notification types they turned off (see NotificationTypes)
+	MutedNotifications []string `json:"mutedNotifications,omitempty" bson:"mutedNotifications,omitempty" dynamodbav:"mutedNotifications,omitempty" firestore:"mutedNotifications,omitempty"`
+}
+
+// DataExportStatus is where a user's data export is.
+type DataExportStatus string
+
+const (
+	DataExportPending DataExportStatus = "pending" // Queued or being built
+	DataExportReady   DataExportStatus = "ready"   // The archive can be downloaded
+	DataExportFailed  DataExportStatus = "failed"  // Building the archive gave up
+)
+
+// DataExport is a user's latest request for an archive of their data, and its progress.
+type DataExport struct {
+	Status      DataExportStatus `json:"status"`
+	RequestedAt time.Time        `json:"requestedAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time       `json:"expiresAt,omitempty"` // When a ready archive is deleted
+	SizeBytes   int64            `json:"sizeBytes,omitempty"` // Of a ready archive
+}
+
+// StaticSiteOptions describes a static site archive of a user's blog.
+type StaticSiteOptions struct {
+	Format  string `json:"format"`            // hugo, jekyll or html
+	Title   string `json:"title,omitempty"`   // The blog's title; defaults to the user ID
+	BaseURL string `json:"baseUrl,omitempty"` // Optional: public address of the exported site, e.g. https://blog.example.com
+	Theme   string `json:"theme,omitempty"`   // Theme of HTML pages; defaults to the user's
+}
+
+// StaticSiteExport is a user's latest request for a static site archive of their blog,
+// and its progress. It goes through the same states as a DataExport.
+type StaticSiteExport struct {
+	StaticSiteOptions
+	Status      DataExportStatus `json:"status"`
+	Save        bool             `json:"save,omitempty"` // Stored as one of the user's assets once built
+	RequestedAt time.Time        `json:"requestedAt"`
+	CompletedAt *time.Time       `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time       `json:"expiresAt,omitempty"` // When a ready archive is deleted
+	SizeBytes   int64            `json:"sizeBytes,omitempty"` // Of a ready archive
+	AssetID     string           `json:"assetId,omitempty"`   // The saved copy, if Save
+	Error       string           `json:"error,omitempty"`     // Why a ready archive wasn't saved, e.g. over the storage quota
+}
+
+// StorageUsage reports a user's stored bytes against their quota
+type StorageUsage struct {
+	UsedBytes  int64 `json:"usedBytes"`
+	QuotaBytes int64 `json:"quotaBytes"` // 0 means unlimited
+}
+
+// UserTimezone is a user's time zone. It is also the body of PUT /users/me/timezone.
+type UserTimezone struct {
+	Timezone string `json:"timezone"` // IANA name such as Europe/Helsinki; empty for UTC
+}
+
+// UserEmail is a user's email address. It is also the body of PUT /users/me/email.
+type UserEmail struct {
+	Email string `json:"email"` // Empty for none
+}
+
+// SiteTheme is the theme of a user's public pages and the themes they can pick from. It
+// is also the body of PUT /users/me/theme, which only reads Theme.
+type SiteTheme struct {
+	Theme     string   `json:"theme"`               // Empty for the built-in theme
+	Available []string `json:"available,omitempty"` // Besides the built-in theme
+}
+
+// Domain maps a custom host name to a user's blog. It is served once verified, which
+// takes publishing VerificationToken in a DNS TXT record, to prove the user controls it.
+// Host names are the deployment's, so domains of every tenant are kept together.
+type Domain struct {
+	Host              string     `json:"host" bson:"_id" dynamodbav:"host" firestore:"host"` // Lower-case, without a port
+	UserID            string     `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	TenantID          string     `json:"tenantId,omitempty" bson:"tenantId,omitempty" dynamodbav:"tenantId,omitempty" firestore:"tenantId,omitempty"` // The user's; empty without multi-tenancy
+	VerificationToken string     `json:"verificationToken" bson:"verificationToken" dynamodbav:"verificationToken" firestore:"verificationToken"`
+	VerifiedAt        *time.Time `json:"verifiedAt,omitempty" bson:"verifiedAt,omitempty" dynamodbav:"verifiedAt,omitempty" firestore:"verifiedAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	// The DNS record to create to verify the domain; set in responses while it is unverified
+	VerificationRecord *DNSRecord `json:"verificationRecord,omitempty" bson:"-" dynamodbav:"-" firestore:"-"`
+}
+
+// AddDomainRequest is the body of POST /users/me/domains.
+type AddDomainRequest struct {
+	Host string `json:"host"` // e.g. blog.example.com
+}
+
+// DNSRecord is a DNS record a user has to create.
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Notification types. Users get notifications of every type unless they turn it off.
+const (
+	NotifyEdit     = "edit"     // A collaborator edited one of your items
+	NotifyShare    = "share"    // You were made a collaborator on an item
+	NotifyTransfer = "transfer" // Someone offered you ownership of an item
+	NotifyPublish  = "publish"  // One of your scheduled posts was published
+	NotifyDigest   = "digest"   // The periodic activity digest, by email
+	NotifyMention  = "mention"  // Someone mentioned you in a comment; also sent by email
+)
+
+// NotificationTypes lists the notification types.
+var NotificationTypes = []string{NotifyEdit, NotifyShare, NotifyTransfer, NotifyPublish, NotifyDigest, NotifyMention}
+
+// Notification is what a Web Push message carries, for the app's service worker to show.
+type Notification struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body,omitempty"`
+	ItemID   string    `json:"itemId,omitempty"`
+	ItemType ItemType  `json:"itemType,omitempty"`
+	ActorID  string    `json:"actorId,omitempty"` // Who caused it
+	Tag      string    `json:"tag,omitempty"`     // A notification replaces any shown with the same tag
+	Time     time.Time `json:"time"`
+}
+
+// NotificationPreferences says which notification types a user gets. It is also the body
+// of PUT /users/me/notifications, where types left out keep their setting.
+type NotificationPreferences struct {
+	Types map[string]bool `json:"types"` // Keyed by type, e.g. "edit"
+}
+
+// PushSubscription is a browser's Web Push subscription: the push service endpoint a
+// user's notifications are sent to, and the keys that encrypt them for the browser. Its
+// ID is derived from the endpoint, which is unique to the subscription.
+type PushSubscription struct {
+	ID        string    `json:"id" bson:"_id" dynamodbav:"id" firestore:"id"`
+	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	Endpoint  string    `json:"endpoint" bson:"endpoint" dynamodbav:"endpoint" firestore:"endpoint"`
+	P256dh    string    `json:"-" bson:"p256dh" dynamodbav:"p256dh" firestore:"p256dh"`
+	Auth      string    `json:"-" bson:"auth" dynamodbav:"auth" firestore:"auth"`
+	UserAgent string    `json:"userAgent,omitempty" bson:"userAgent,omitempty" dynamodbav:"userAgent,omitempty" firestore:"userAgent,omitempty"` // Of the browser that subscribed
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// PushSubscriptionRequest is the body of POST /users/me/push/subscriptions: a browser's
+// PushSubscription, as its toJSON method gives it.
+type PushSubscriptionRequest struct {
+	Endpoint string   `json:"endpoint"`
+	Keys     PushKeys `json:"keys"`
+}
+
+// PushKeys are the keys of a browser's push subscription, base64url-encoded.
+type PushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
 }
 
 // Post represents blog post metadata
 type Post struct {
-	ID        string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	ID          string     `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID      string     `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	TenantID    string     `json:"tenantId,omitempty" bson:"tenantId,omitempty" dynamodbav:"tenantId,omitempty" firestore:"tenantId,omitempty"` // Empty without multi-tenancy
+	Title       string     `json:"title" bson:"title" dynamodbav:"title" firestore:"title"`
+	Slug        string     `json:"slug" bson:"slug" dynamodbav:"slug" firestore:"slug"`
+	WorkspaceID string     `json:"workspaceId,omitempty" bson:"workspaceId,omitempty" dynamodbav:"workspaceId,omitempty" firestore:"workspaceId,omitempty"` // Empty for the default workspace
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
+	S3Path      string     `json:"-" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
+	Size        int64      `json:"size" bson:"size" dynamodbav:"size" firestore:"size"`                                                                 // Content size in bytes
+	Version     int        `json:"-" bson:"version" dynamodbav:"version" firestore:"version"`                                                           // For OCC
+	DeletedAt   *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty" firestore:"deletedAt,omitempty"`     // Set while in the trash
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty" bson:"archivedAt,omitempty" dynamodbav:"archivedAt,omitempty" firestore:"archivedAt,omitempty"` // Set while archived: readable but hidden from default listings
+	// Hex SHA-256 of the content at Version, recorded on every content write. Empty for
+	// content last written before hashes were recorded.
+	ContentHash string `json:"contentHash,omitempty" bson:"contentHash,omitempty" dynamodbav:"contentHash,omitempty" firestore:"contentHash,omitempty"`
+	// Bytes of the retained versions and snapshots, charged to the owner along with Size
+	RetainedBytes int64 `json:"retainedBytes,omitempty" bson:"retainedBytes,omitempty" dynamodbav:"retainedBytes,omitempty" firestore:"retainedBytes,omitempty"`
+	// Reading stats of the draft, refreshed on every content write
+	WordCount          int `json:"wordCount" bson:"wordCount" dynamodbav:"wordCount" firestore:"wordCount"`
+	ReadingTimeMinutes int `json:"readingTimeMinutes" bson:"readingTimeMinutes" dynamodbav:"readingTimeMinutes" firestore:"readingTimeMinutes"`
+	// Synced from the content's front-matter (YAML or TOML) on every write that has a
+	// front-matter block; along with Title, which the block's title overrides
+	Tags  []string   `json:"tags,omitempty" bson:"tags,omitempty" dynamodbav:"tags,omitempty" firestore:"tags,omitempty"`
+	Date  *time.Time `json:"date,omitempty" bson:"date,omitempty" dynamodbav:"date,omitempty" firestore:"date,omitempty"`     // Authored date, independent of CreatedAt
+	Draft bool       `json:"draft,omitempty" bson:"draft,omitempty" dynamodbav:"draft,omitempty" firestore:"draft,omitempty"` // "draft: true" in the front-matter
+	// The live content at S3Path is the draft edited over WebSocket. Publishing copies a
+	// draft version to a separate object; PublishedVersion is 0 until the first publish.
+	PublishedVersion int        `json:"publishedVersion,omitempty" bson:"publishedVersion,omitempty" dynamodbav:"publishedVersion,omitempty" firestore:"publishedVersion,omitempty"`
+	PublishedAt      *time.Time `json:"publishedAt,omitempty" bson:"publishedAt,omitempty" dynamodbav:"publishedAt,omitempty" firestore:"publishedAt,omitempty"`
+	// A scheduled publish: the draft is published at ScheduledAt, at ScheduledVersion if
+	// that isn't 0 (else whatever the draft is then). Cleared by any publish.
+	ScheduledAt      *time.Time `json:"scheduledAt,omitempty" bson:"scheduledAt,omitempty" dynamodbav:"scheduledAt,omitempty" firestore:"scheduledAt,omitempty"`
+	ScheduledVersion int        `json:"scheduledVersion,omitempty" bson:"scheduledVersion,omitempty" dynamodbav:"scheduledVersion,omitempty" firestore:"scheduledVersion,omitempty"`
+	// Set when an admin took the post down on a report; it can't be published again until
+	// an admin reinstates it
+	TakenDownAt *time.Time `json:"takenDownAt,omitempty" bson:"takenDownAt,omitempty" dynamodbav:"takenDownAt,omitempty" firestore:"takenDownAt,omitempty"`
+	// Short plain-text summary for lists and feeds. Generated from the first paragraph on
+	// every publish unless ExcerptManual is set, in which case it is left as set.
+	Excerpt       string `json:"excerpt,omitempty" bson:"excerpt,omitempty" dynamodbav:"excerpt,omitempty" firestore:"excerpt,omitempty"`
+	ExcerptManual bool   `json:"excerptManual,omitempty" bson:"excerptManual,omitempty" dynamodbav:"excerptManual,omitempty" firestore:"excerptManual,omitempty"`
+	// Search engine metadata: the URL search engines should credit if the post is also
+	// published elsewhere, the description shown in results (else the excerpt), and
+	// whether to keep the post out of search indexes altogether
+	CanonicalURL    string `json:"canonicalUrl,omitempty" bson:"canonicalUrl,omitempty" dynamodbav:"canonicalUrl,omitempty" firestore:"canonicalUrl,omitempty"`
+	MetaDescription string `json:"metaDescription,omitempty" bson:"metaDescription,omitempty" dynamodbav:"metaDescription,omitempty" firestore:"metaDescription,omitempty"`
+	NoIndex         bool   `json:"noIndex,omitempty" bson:"noIndex,omitempty" dynamodbav:"noIndex,omitempty" firestore:"noIndex,omitempty"`
+	// ID of an image asset of the owner's, shown at the top of the post and in previews
+	CoverImage string `json:"coverImage,omitempty" bson:"coverImage,omitempty" dynamodbav:"coverImage,omitempty" firestore:"coverImage,omitempty"`
+	// Placement in the owner's post listing: pinned posts come first, then posts with a
+	// Rank (higher first), then the rest by date
+	Pinned bool `json:"pinned,omitempty" bson:"pinned,omitempty" dynamodbav:"pinned,omitempty" firestore:"pinned,omitempty"`
+	Rank   int  `json:"rank,omitempty" bson:"rank,omitempty" dynamodbav:"rank,omitempty" firestore:"rank,omitempty"`
+	// Editors credited alongside the owner, in byline order. Who made each change is in
+	// the history (HistoryLog.UserID).
+	CoAuthors []string `json:"coAuthors,omitempty" bson:"coAuthors,omitempty" dynamodbav:"coAuthors,omitempty" firestore:"coAuthors,omitempty"`
+	// Language of the post, a tag such as "en" or "pt-BR". A translation names the post it
+	// translates, the canonical post of its variants, which translates none; each variant
+	// has a slug of its own.
+	Language      string `json:"language,omitempty" bson:"language,omitempty" dynamodbav:"language,omitempty" firestore:"language,omitempty"`
+	TranslationOf string `json:"translationOf,omitempty" bson:"translationOf,omitempty" dynamodbav:"translationOf,omitempty" firestore:"translationOf,omitempty"`
+}
+
+// CodeFile represents coding workspace file metadata
+type CodeFile struct {
+	ID          string     `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID      string     `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	TenantID    string     `json:"tenantId,omitempty" bson:"tenantId,omitempty" dynamodbav:"tenantId,omitempty" firestore:"tenantId,omitempty"`             // Empty without multi-tenancy
+	FileName    string     `json:"fileName" bson:"fileName" dynamodbav:"fileName" firestore:"fileName"`                                                     // Last element of Path
+	Path        string     `json:"path" bson:"path" dynamodbav:"path" firestore:"path"`                                                                     // Project-relative path, e.g. "src/main.go"
+	ProjectID   string     `json:"projectId,omitempty" bson:"projectId,omitempty" dynamodbav:"projectId,omitempty" firestore:"projectId,omitempty"`         // Empty if not in a project
+	WorkspaceID string     `json:"workspaceId,omitempty" bson:"workspaceId,omitempty" dynamodbav:"workspaceId,omitempty" firestore:"workspaceId,omitempty"` // Empty for the default workspace
+	Language    string     `json:"language" bson:"language" dynamodbav:"language" firestore:"language"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
+	S3Path      string     `json:"-" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
+	Size        int64      `json:"size" bson:"size" dynamodbav:"size" firestore:"size"`                                                                 // Content size in bytes
+	Version     int        `json:"-" bson:"version" dynamodbav:"version" firestore:"version"`                                                           // For OCC
+	DeletedAt   *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty" firestore:"deletedAt,omitempty"`     // Set while in the trash
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty" bson:"archivedAt,omitempty" dynamodbav:"archivedAt,omitempty" firestore:"archivedAt,omitempty"` // Set while archived: readable but hidden from default listings
+	// Hex SHA-256 of the content at Version, recorded on every content write. Empty for
+	// content last written before hashes were recorded.
+	ContentHash string `json:"contentHash,omitempty" bson:"contentHash,omitempty" dynamodbav:"contentHash,omitempty" firestore:"contentHash,omitempty"`
+	// Bytes of the retained versions and snapshots, charged to the owner along with Size
+	RetainedBytes int64 `json:"retainedBytes,omitempty" bson:"retainedBytes,omitempty" dynamodbav:"retainedBytes,omitempty" firestore:"retainedBytes,omitempty"`
+}
+
+// ItemMeta is the metadata of an item of any type, a *Post or a *CodeFile, with
+// accessors for what all types have.
+type ItemMeta interface {
+	Type() ItemType
+	GetID() string
+	GetUserID() string // The owner
+	GetTenantID() string
+	GetVersion() int
+	GetSize() int64
+	GetS3Path() string
+	GetContentHash() string
+	IsTrashed() bool
+	IsArchived() bool
+	Label() string // How to name the item to people: a post's title or a file's path
+	// CopyMeta returns a shallow copy, to modify without changing a cached value.
+	CopyMeta() ItemMeta
+}
+
+var (
+	_ ItemMeta = (*Post)(nil)
+	_ ItemMeta = (*CodeFile)(nil)
+)
+
+// NewItemMeta returns empty meta of itemType to decode into, or nil for an unknown type.
+func NewItemMeta(itemType ItemType) ItemMeta {
+	switch itemType {
+	case ItemTypePost:
+		return &Post{}
+	case ItemTypeCodeFile:
+		return &CodeFile{}
+	}
+	return nil
+}
+
+func (p *Post) Type() ItemType         { return ItemTypePost }
+func (p *Post) GetID() string          { return p.ID }
+func (p *Post) GetUserID() string      { return p.UserID }
+func (p *Post) GetTenantID() string    { return p.TenantID }
+func (p *Post) GetVersion() int        { return p.Version }
+func (p *Post) GetSize() int64         { return p.Size }
+func (p *Post) GetS3Path() string      { return p.S3Path }
+func (p *Post) GetContentHash() string { return p.ContentHash }
+func (p *Post) IsTrashed() bool        { return p.DeletedAt != nil }
+func (p *Post) IsArchived() bool       { return p.ArchivedAt != nil }
+func (p *Post) Label() string          { return p.Title }
+func (p *Post) CopyMeta() ItemMeta     { c := *p; return &c }
+
+func (f *CodeFile) Type() ItemType         { return ItemTypeCodeFile }
+func (f *CodeFile) GetID() string          { return f.ID }
+func (f *CodeFile) GetUserID() string      { return f.UserID }
+func (f *CodeFile) GetTenantID() string    { return f.TenantID }
+func (f *CodeFile) GetVersion() int        { return f.Version }
+func (f *CodeFile) GetSize() int64         { return f.Size }
+func (f *CodeFile) GetS3Path() string      { return f.S3Path }
+func (f *CodeFile) GetContentHash() string { return f.ContentHash }
+func (f *CodeFile) IsTrashed() bool        { return f.DeletedAt != nil }
+func (f *CodeFile) IsArchived() bool       { return f.ArchivedAt != nil }
+func (f *CodeFile) Label() string          { return f.Path }
+func (f *CodeFile) CopyMeta() ItemMeta     { c := *f; return &c }
+
+// Role is a user's level of access to an item. Each role includes the ones below it.
+type Role string
+
+const (
+	RoleViewer Role = "viewer" // Read content and history
+	RoleEditor Role = "editor" // Also apply changes, revert and rename
+	RoleOwner  Role = "owner"  // Also delete, move and manage collaborators
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// IsValid checks if the role is one of the defined roles.
+func (r Role) IsValid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the access of required.
+func (r Role) Includes(required Role) bool {
+	return r.IsValid() && roleRank[r] >= roleRank[required]
+}
+
+// TransferStatus is the state of an ownership transfer.
+type TransferStatus string
+
+const (
+	TransferPending   TransferStatus = "pending"   // Waiting for the recipient
+	TransferAccepted  TransferStatus = "accepted"  // Recipient now owns the item
+	TransferDeclined  TransferStatus = "declined"  // Rejected by the recipient
+	TransferCancelled TransferStatus = "cancelled" // Withdrawn by the sender
+)
+
+// OwnershipTransfer is an offer to hand an item to another user. The item only changes
+// owner once the recipient accepts.
+type OwnershipTransfer struct {
+	ID         string         `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	ItemID     string         `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType   string         `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	FromUserID string         `json:"fromUserId" bson:"fromUserId" dynamodbav:"fromUserId" firestore:"fromUserId"`
+	ToUserID   string         `json:"toUserId" bson:"toUserId" dynamodbav:"toUserId" firestore:"toUserId"`
+	Status     TransferStatus `json:"status" bson:"status" dynamodbav:"status" firestore:"status"`
+	CreatedAt  time.Time      `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	ResolvedAt *time.Time     `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty" dynamodbav:"resolvedAt,omitempty" firestore:"resolvedAt,omitempty"`
+}
+
+// Access levels a share link can grant
+const (
+	ShareAccessRead = "read" // View content
+)
+
+// ShareLink is a signed link giving access to one item without an account. It is stored
+// without its token, which is only returned when the link is created; a link stops
+// working once it is revoked, i.e. its record is deleted.
+type ShareLink struct {
+	Token     string     `json:"token,omitempty" bson:"-" dynamodbav:"-" firestore:"-"`
+	LinkID    string     `json:"linkId" bson:"_id" dynamodbav:"linkId" firestore:"linkId"`
+	UserID    string     `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"` // Owner who created it
+	ItemID    string     `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType  string     `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Access    string     `json:"access" bson:"access" dynamodbav:"access" firestore:"access"`
+	URL       string     `json:"url,omitempty" bson:"-" dynamodbav:"-" firestore:"-"` // Public API path serving the item; with Token only
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty" firestore:"expiresAt,omitempty"` // Nil if the link never expires
+}
+
+// SharedItemPayload is what a share link resolves to
+type SharedItemPayload struct {
+	ItemID    string     `json:"itemId"`
+	ItemType  string     `json:"itemType"`
+	Name      string     `json:"name"` // Post title or code file path
+	Content   string     `json:"content"`
+	Version   int        `json:"version"`
+	Access    string     `json:"access"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Summary of a post for link previews: its excerpt, or one generated from Content
+	Excerpt string `json:"excerpt,omitempty"`
+	// Public path serving a post's cover image through the same link; empty without one
+	CoverImageURL string `json:"coverImageUrl,omitempty"`
+}
+
+// SlugRedirect points a former slug of a post to the post, so links to it keep working
+// after the slug changes. Slugs are per owner, so are their redirects.
+type SlugRedirect struct {
+	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	Slug      string    `json:"slug" bson:"slug" dynamodbav:"slug" firestore:"slug"` // The former slug
+	PostID    string    `json:"postId" bson:"postId" dynamodbav:"postId" firestore:"postId"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// Bookmark saves a published post to a user's reading list
+type Bookmark struct {
+	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	PostID    string    `json:"postId" bson:"postId" dynamodbav:"postId" firestore:"postId"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// BookmarkedPost is an entry of a user's reading list.
+type BookmarkedPost struct {
+	PostID       string     `json:"postId"`
+	Title        string     `json:"title"`
+	Slug         string     `json:"slug"`
+	Excerpt      string     `json:"excerpt,omitempty"`
+	Authors      []string   `json:"authors"` // Owner first, then co-authors
+	PublishedAt  *time.Time `json:"publishedAt,omitempty"`
+	BookmarkedAt time.Time  `json:"bookmarkedAt"`
+}
+
+// Collaborator grants a user other than the owner access to a post or code file
+type Collaborator struct {
+	ItemID    string    `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType  string    `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
 	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
-	Title     string    `json:"title" bson:"title" dynamodbav:"title" firestore:"title"`
-	Slug      string    `json:"slug" bson:"slug" dynamodbav:"slug" firestore:"slug"`
+	Role      Role      `json:"role" bson:"role" dynamodbav:"role" firestore:"role"`
+	AddedBy   string    `json:"addedBy,omitempty" bson:"addedBy,omitempty" dynamodbav:"addedBy,omitempty" firestore:"addedBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// CommentStatus is where a comment is in moderation. Only approved comments are listed
+// on their item.
+type CommentStatus string
+
+const (
+	CommentPending  CommentStatus = "pending"  // Held for the item's owner to review
+	CommentApproved CommentStatus = "approved" // Shown to everyone who can read the item
+	CommentSpam     CommentStatus = "spam"     // Flagged by the spam checker or the owner
+)
+
+// IsValid reports whether s is a known comment status.
+func (s CommentStatus) IsValid() bool {
+	return s == CommentPending || s == CommentApproved || s == CommentSpam
+}
+
+// Is reports whether a comment with status s has status want; an empty want matches any.
+// Comments from before moderation have no status, and count as approved.
+func (s CommentStatus) Is(want CommentStatus) bool {
+	return want == "" || s == want || (s == "" && want == CommentApproved)
+}
+
+// Comment is a user's comment on an item. Published posts take comments from any user;
+// other items only from their owner and collaborators.
+type Comment struct {
+	ID       string `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	ItemID   string `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType string `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	// The owner's moderation queue is listed by ItemOwnerID, kept up to date on transfers.
+	// In DynamoDB it is the user GSI's key, so the author goes under another name there.
+	ItemOwnerID string         `json:"-" bson:"itemOwnerId" dynamodbav:"userId" firestore:"itemOwnerId"`
+	UserID      string         `json:"userId" bson:"userId" dynamodbav:"authorId" firestore:"userId"` // Author
+	Body        string         `json:"body" bson:"body" dynamodbav:"body" firestore:"body"`
+	Mentions    []Mention      `json:"mentions,omitempty" bson:"mentions,omitempty" dynamodbav:"mentions,omitempty" firestore:"mentions,omitempty"`
+	Anchor      *CommentAnchor `json:"anchor,omitempty" bson:"anchor,omitempty" dynamodbav:"anchor,omitempty" firestore:"anchor,omitempty"` // Unset for comments on the whole item
+	Status      CommentStatus  `json:"status" bson:"status" dynamodbav:"status" firestore:"status"`
+	CreatedAt   time.Time      `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// CommentAnchor is the selection of an item's content a comment is on, from the start
+// position up to (not including) the end position, in the content of Version. Lines and
+// columns are 0-based and columns count characters, as in Change. As the content is
+// edited the anchor is moved along with the text it selects; once all of that text is
+// removed it is Detached, and stays at the place the text was. An anchor that can't be
+// followed through the edits (e.g. its version is no longer retained) is Detached at its
+// Version. Anchors are moved in the background after each edit, so Version can lag
+// behind the item's for a short while. A Published anchor is on the published content of
+// a post and only moves when the post is published again.
+type CommentAnchor struct {
+	Version     int  `json:"version" bson:"version" dynamodbav:"version" firestore:"version"`
+	StartLine   int  `json:"startLine" bson:"startLine" dynamodbav:"startLine" firestore:"startLine"`
+	StartColumn int  `json:"startColumn" bson:"startColumn" dynamodbav:"startColumn" firestore:"startColumn"`
+	EndLine     int  `json:"endLine" bson:"endLine" dynamodbav:"endLine" firestore:"endLine"`
+	EndColumn   int  `json:"endColumn" bson:"endColumn" dynamodbav:"endColumn" firestore:"endColumn"`
+	Detached    bool `json:"detached,omitempty" bson:"detached,omitempty" dynamodbav:"detached,omitempty" firestore:"detached,omitempty"`
+	Published   bool `json:"published,omitempty" bson:"published,omitempty" dynamodbav:"published,omitempty" firestore:"published,omitempty"`
+}
+
+// Mention is an @username in a comment's body that names a user who can read the comment
+// and is notified of it once it is approved. Offset and Length count characters (Unicode code points) and
+// cover the "@".
+type Mention struct {
+	UserID string `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	Offset int    `json:"offset" bson:"offset" dynamodbav:"offset" firestore:"offset"`
+	Length int    `json:"length" bson:"length" dynamodbav:"length" firestore:"length"`
+}
+
+// Reasons a report can give
+const (
+	ReportSpam       = "spam"
+	ReportHarassment = "harassment"
+	ReportIllegal    = "illegal"
+	ReportOther      = "other"
+)
+
+// ReportReasons lists the reasons a report can give.
+var ReportReasons = []string{ReportSpam, ReportHarassment, ReportIllegal, ReportOther}
+
+// ReportStatus is where an abuse report is in review.
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"      // Waiting for an admin
+	ReportActioned  ReportStatus = "actioned"  // The content was taken down
+	ReportDismissed ReportStatus = "dismissed" // Reviewed, nothing taken down
+)
+
+// IsValid reports whether s is a known report status.
+func (s ReportStatus) IsValid() bool {
+	return s == ReportOpen || s == ReportActioned || s == ReportDismissed
+}
+
+// Report flags a published post or a comment as abusive, for admins to review. It keeps
+// an excerpt of what was reported, since taking a comment down deletes it.
+type Report struct {
+	ID         string `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	ReporterID string `json:"reporterId" bson:"reporterId" dynamodbav:"reporterId" firestore:"reporterId"`
+	ItemID     string `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType   string `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	CommentID  string `json:"commentId,omitempty" bson:"commentId,omitempty" dynamodbav:"commentId,omitempty" firestore:"commentId,omitempty"`
+	// Who wrote what was reported: the post's owner or the comment's author
+	AuthorID   string       `json:"authorId" bson:"authorId" dynamodbav:"authorId" firestore:"authorId"`
+	Excerpt    string       `json:"excerpt" bson:"excerpt" dynamodbav:"excerpt" firestore:"excerpt"`
+	Reason     string       `json:"reason" bson:"reason" dynamodbav:"reason" firestore:"reason"`
+	Details    string       `json:"details,omitempty" bson:"details,omitempty" dynamodbav:"details,omitempty" firestore:"details,omitempty"`
+	Status     ReportStatus `json:"status" bson:"status" dynamodbav:"status" firestore:"status"`
+	CreatedAt  time.Time    `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	ResolvedBy string       `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty" dynamodbav:"resolvedBy,omitempty" firestore:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time   `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty" dynamodbav:"resolvedAt,omitempty" firestore:"resolvedAt,omitempty"`
+	Note       string       `json:"note,omitempty" bson:"note,omitempty" dynamodbav:"note,omitempty" firestore:"note,omitempty"`
+}
+
+// VersionTag names a version of an item ("v1.0 published", "before refactor") so it
+// can be found and reverted to without knowing its number. Names are unique per item.
+type VersionTag struct {
+	ItemID    string    `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType  string    `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Name      string    `json:"name" bson:"name" dynamodbav:"name" firestore:"name"`
+	Version   int       `json:"version" bson:"version" dynamodbav:"version" firestore:"version"`
+	LogID     string    `json:"logId" bson:"logId" dynamodbav:"logId" firestore:"logId"`     // History entry at Version; reverting to the tag reverts to it
+	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"` // Who created the tag
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// HookFinding is one thing a content hook reported about an item, e.g. a broken link.
+type HookFinding struct {
+	Severity string `json:"severity" bson:"severity" dynamodbav:"severity" firestore:"severity"`                         // "info", "warning" or "error"
+	Line     int    `json:"line,omitempty" bson:"line,omitempty" dynamodbav:"line,omitempty" firestore:"line,omitempty"` // 1-based; 0 if not tied to a line
+	Message  string `json:"message" bson:"message" dynamodbav:"message" firestore:"message"`
+}
+
+// HookResult is the latest output of one content hook for an item. Each hook keeps one
+// result per item, replaced whenever the hook runs again.
+type HookResult struct {
+	ItemID    string        `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType  string        `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Hook      string        `json:"hook" bson:"hook" dynamodbav:"hook" firestore:"hook"`
+	Version   int           `json:"version" bson:"version" dynamodbav:"version" firestore:"version"` // Item version the hook looked at
+	Findings  []HookFinding `json:"findings" bson:"findings" dynamodbav:"findings" firestore:"findings"`
+	Error     string        `json:"error,omitempty" bson:"error,omitempty" dynamodbav:"error,omitempty" firestore:"error,omitempty"` // Set if the hook itself failed
+	CheckedAt time.Time     `json:"checkedAt" bson:"checkedAt" dynamodbav:"checkedAt" firestore:"checkedAt"`
+}
+
+// Template pre-fills new posts or code files: fields left empty on create are taken from
+// the template. Templates without a UserID are system-wide and available to everyone.
+type Template struct {
+	ID        string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID    string    `json:"userId,omitempty" bson:"userId" dynamodbav:"userId" firestore:"userId"` // Empty for system-wide templates
+	Name      string    `json:"name" bson:"name" dynamodbav:"name" firestore:"name"`
+	ItemType  string    `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Title     string    `json:"title,omitempty" bson:"title,omitempty" dynamodbav:"title,omitempty" firestore:"title,omitempty"`             // Posts
+	FileName  string    `json:"fileName,omitempty" bson:"fileName,omitempty" dynamodbav:"fileName,omitempty" firestore:"fileName,omitempty"` // Code files
+	Language  string    `json:"language,omitempty" bson:"language,omitempty" dynamodbav:"language,omitempty" firestore:"language,omitempty"` // Code files
+	Content   string    `json:"content" bson:"content" dynamodbav:"content" firestore:"content"`
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
-	S3Path    string    `json:"-" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
-	Version   int       `json:"-" bson:"version" dynamodbav:"version" firestore:"version"` // For OCC
 }
 
-// CodeFile represents coding workspace file metadata
-type CodeFile struct {
+// Workspace separates a user's posts and code files into contexts such as "blog" and
+// "interview-prep". Every user also has an implicit default workspace holding items
+// without a WorkspaceID.
+type Workspace struct {
 	ID        string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
 	UserID    string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
-	FileName  string    `json:"fileName" bson:"fileName" dynamodbav:"fileName" firestore:"fileName"`
-	Language  string    `json:"language" bson:"language" dynamodbav:"language" firestore:"language"`
+	Name      string    `json:"name" bson:"name" dynamodbav:"name" firestore:"name"`
+	Default   bool      `json:"default,omitempty" bson:"-" dynamodbav:"-" firestore:"-"` // Set on the implicit default workspace
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
-	S3Path    string    `json:"-" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
-	Version   int       `json:"-" bson:"version" dynamodbav:"version" firestore:"version"` // For OCC
+}
+
+// WorkspaceItems lists the posts and code files in a workspace
+type WorkspaceItems struct {
+	WorkspaceID string     `json:"workspaceId"`
+	Posts       []Post     `json:"posts"`
+	CodeFiles   []CodeFile `json:"codeFiles"`
+}
+
+// Project groups a user's code files; their paths form the project's folder tree
+type Project struct {
+	ID          string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID      string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	Name        string    `json:"name" bson:"name" dynamodbav:"name" firestore:"name"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty" dynamodbav:"description,omitempty" firestore:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
+}
+
+// ProjectTreeNode is a folder or file in a project's tree listing. A file is a code file
+// (FileID set) or a binary asset (AssetID set).
+type ProjectTreeNode struct {
+	Name        string             `json:"name"`
+	Path        string             `json:"path"` // Empty for the project root
+	Type        string             `json:"type"` // "dir" or "file"
+	FileID      string             `json:"fileId,omitempty"`
+	Language    string             `json:"language,omitempty"`
+	AssetID     string             `json:"assetId,omitempty"`
+	ContentType string             `json:"contentType,omitempty"` // Of an asset
+	Children    []*ProjectTreeNode `json:"children,omitempty"`
+}
+
+// Asset is a binary file in a user's code workspace, such as an image or a font. Unlike
+// a code file it isn't an item: its content is replaced whole rather than edited through
+// changes, so it has no history, collaborators or search entry.
+type Asset struct {
+	ID          string    `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID      string    `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	TenantID    string    `json:"tenantId,omitempty" bson:"tenantId,omitempty" dynamodbav:"tenantId,omitempty" firestore:"tenantId,omitempty"`     // Empty without multi-tenancy
+	FileName    string    `json:"fileName" bson:"fileName" dynamodbav:"fileName" firestore:"fileName"`                                             // Last element of Path
+	Path        string    `json:"path" bson:"path" dynamodbav:"path" firestore:"path"`                                                             // Project-relative path, e.g. "img/logo.png"
+	ProjectID   string    `json:"projectId,omitempty" bson:"projectId,omitempty" dynamodbav:"projectId,omitempty" firestore:"projectId,omitempty"` // Empty if not in a project
+	ContentType string    `json:"contentType" bson:"contentType" dynamodbav:"contentType" firestore:"contentType"`
+	Size        int64     `json:"size" bson:"size" dynamodbav:"size" firestore:"size"` // Content size in bytes
+	ContentHash string    `json:"contentHash" bson:"contentHash" dynamodbav:"contentHash" firestore:"contentHash"`
+	S3Path      string    `json:"-" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
+	Version     int       `json:"version" bson:"version" dynamodbav:"version" firestore:"version"` // Incremented on every content replace
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt" dynamodbav:"updatedAt" firestore:"updatedAt"`
+}
+
+// TrashedItem summarizes a post or code file in the trash
+type TrashedItem struct {
+	ItemID    string    `json:"itemId"`
+	ItemType  string    `json:"itemType"`
+	Name      string    `json:"name"` // Post title or code file name
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt,omitempty"` // Zero if trash is kept indefinitely
+}
+
+// HistoryCompactionReport summarizes a history compaction run. On a dry run the counts
+// are what a real run would do.
+type HistoryCompactionReport struct {
+	DryRun           bool      `json:"dryRun"`
+	Cutoff           time.Time `json:"cutoff"` // Patch entries older than this are collapsed
+	ItemsScanned     int       `json:"itemsScanned"`
+	ItemsCompacted   int       `json:"itemsCompacted"`
+	ItemsSkipped     int       `json:"itemsSkipped"` // Items whose history couldn't be collapsed safely
+	PatchesRemoved   int       `json:"patchesRemoved"`
+	SnapshotsCreated int       `json:"snapshotsCreated"`
+}
+
+// VersionCompactionReport summarizes a compaction of retained version content. On a dry
+// run the counts are what a real run would do.
+type VersionCompactionReport struct {
+	DryRun            bool  `json:"dryRun"`
+	ItemsScanned      int   `json:"itemsScanned"`
+	ItemsCompacted    int   `json:"itemsCompacted"`
+	ItemsSkipped      int   `json:"itemsSkipped"`      // Items whose versions couldn't be read
+	VersionsRewritten int   `json:"versionsRewritten"` // Full copies delta-encoded, or deltas rebased
+	BytesSaved        int64 `json:"bytesSaved"`        // Storage freed (negative if it grew)
+}
+
+// ConfigReloadResult lists the settings a config reload changed, by environment variable
+// name. Settings that can only change on a restart are not reloaded.
+type ConfigReloadResult struct {
+	Changed []string `json:"changed"`
+}
+
+// MaintenanceRequest is the body of PUT /admin/maintenance. Message is what clients are
+// told while it lasts; a default is used if it is empty.
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// MaintenanceStatus tells whether the server is in maintenance mode, in which it rejects
+// changes and serves reads. It is also the payload of the "maintenance" WebSocket
+// message sent when the mode changes, and to clients connecting while it is on.
+type MaintenanceStatus struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since,omitempty"` // When the mode was last switched
+	By      string    `json:"by,omitempty"`    // Admin who switched it; "" if set at startup
+}
+
+// AnnouncementRequest is the body of POST /admin/broadcast. Without Items the message
+// goes to every connected client, else to the subscribers of those items.
+type AnnouncementRequest struct {
+	Message string    `json:"message"`
+	Level   string    `json:"level,omitempty"` // "info" (default), "warning" or "critical"
+	Items   []ItemKey `json:"items,omitempty"`
+}
+
+// ItemKey names an item by type and ID.
+type ItemKey struct {
+	ItemType string `json:"itemType"`
+	ItemID   string `json:"itemId"`
+}
+
+// Announcement levels, for clients to pick how prominently to show one
+const (
+	AnnouncementInfo     = "info"
+	AnnouncementWarning  = "warning"
+	AnnouncementCritical = "critical"
+)
+
+// AnnouncementPayload is the payload of the "announcement" WebSocket message an admin
+// broadcasts. ItemID and ItemType are set when it was sent to the item's subscribers.
+type AnnouncementPayload struct {
+	Message  string    `json:"message"`
+	Level    string    `json:"level"`
+	SentAt   time.Time `json:"sentAt"`
+	ItemID   string    `json:"itemId,omitempty"`
+	ItemType string    `json:"itemType,omitempty"`
+}
+
+// Kinds of problem found by a consistency check
+const (
+	FsckMissingPath     = "missing_path"     // Item has content versions but no storage path
+	FsckMissingObject   = "missing_object"   // The live object at the item's path is gone
+	FsckMissingSnapshot = "missing_snapshot" // A snapshot entry points at an object that is gone
+	FsckVersionGap      = "version_gap"      // No history entry produced a version
+	FsckHistoryAhead    = "history_ahead"    // History has entries for versions the item never reached
+	FsckContentMismatch = "content_mismatch" // Live content differs from the version rebuilt from history
+	FsckSizeMismatch    = "size_mismatch"    // The item's recorded size differs from its live content
+	FsckHashMismatch    = "hash_mismatch"    // The item's recorded content hash differs from its live content
+	FsckPendingWrite    = "pending_write"    // An interrupted content write is waiting for repair
+)
+
+// FsckIssue is one problem found by a consistency check.
+type FsckIssue struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	Kind     string `json:"kind"`
+	Version  int    `json:"version,omitempty"` // The version concerned, where there is one
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+// FsckReport is the result of cross-checking item metadata, stored objects and history.
+type FsckReport struct {
+	Repair       bool        `json:"repair"` // Whether repairable issues were fixed
+	Deep         bool        `json:"deep"`   // Whether live content was compared with history
+	ItemsChecked int         `json:"itemsChecked"`
+	Issues       []FsckIssue `json:"issues"`
+	Repaired     int         `json:"repaired"`
+}
+
+// BackupReport counts what a backup wrote, or a restore read, by kind of record
+// ("users", "posts", "history", ...) and storage object.
+type BackupReport struct {
+	CreatedAt      time.Time      `json:"createdAt"` // When the backup was taken
+	Records        map[string]int `json:"records"`
+	Objects        int            `json:"objects"`
+	ObjectsMissing int            `json:"objectsMissing"` // Referenced by a record but not in storage; left out
+}
+
+// WriteIntent records a content write that is in flight: the object at S3Path is being
+// replaced before the item's metadata moves from BaseVersion to BaseVersion+1. It is
+// deleted once the metadata update lands; entries left behind are repaired in the
+// background.
+type WriteIntent struct {
+	ID              string        `json:"id" bson:"_id,omitempty" dynamodbav:"id" firestore:"-"`
+	UserID          string        `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"` // Who made the change
+	ItemID          string        `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType        string        `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Action          HistoryAction `json:"action" bson:"action" dynamodbav:"action" firestore:"action"` // ActionPatch or ActionRevert
+	S3Path          string        `json:"s3Path" bson:"s3Path" dynamodbav:"s3Path" firestore:"s3Path"`
+	BaseVersion     int           `json:"baseVersion" bson:"baseVersion" dynamodbav:"baseVersion" firestore:"baseVersion"`
+	ContentHash     string        `json:"contentHash" bson:"contentHash" dynamodbav:"contentHash" firestore:"contentHash"` // Hex SHA-256 of the new content
+	Size            int64         `json:"size" bson:"size" dynamodbav:"size" firestore:"size"`
+	Changes         []Change      `json:"changes,omitempty" bson:"changes,omitempty" dynamodbav:"changes,omitempty" firestore:"changes,omitempty"`                                 // Patch: the batch applied
+	RevertedToLogID string        `json:"revertedToLogId,omitempty" bson:"revertedToLogId,omitempty" dynamodbav:"revertedToLogId,omitempty" firestore:"revertedToLogId,omitempty"` // Revert: its target
+	CreatedAt       time.Time     `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// JournalEntry records how one version of an item was produced: the batch of changes
+// applied to the previous version, or the earlier version a revert restored. The change
+// journal is keyed by item and version and kept apart from the history log, which is for
+// people and is compacted to snapshots.
+type JournalEntry struct {
+	ItemID     string        `json:"itemId" bson:"itemId" dynamodbav:"itemId" firestore:"itemId"`
+	ItemType   string        `json:"itemType" bson:"itemType" dynamodbav:"itemType" firestore:"itemType"`
+	Version    int           `json:"version" bson:"version" dynamodbav:"version" firestore:"version"` // The version this entry produced
+	UserID     string        `json:"userId" bson:"userId" dynamodbav:"userId" firestore:"userId"`
+	Action     HistoryAction `json:"action" bson:"action" dynamodbav:"action" firestore:"action"`                                                         // ActionPatch or ActionRevert
+	Changes    []Change      `json:"changes,omitempty" bson:"changes,omitempty" dynamodbav:"changes,omitempty" firestore:"changes,omitempty"`             // Patch: the batch, in order
+	RevertedTo int           `json:"revertedTo,omitempty" bson:"revertedTo,omitempty" dynamodbav:"revertedTo,omitempty" firestore:"revertedTo,omitempty"` // Revert: the version restored
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt" dynamodbav:"createdAt" firestore:"createdAt"`
+}
+
+// ItemStatsDay holds one day's view and edit counts of an item
+type ItemStatsDay struct {
+	Day   string `json:"day" bson:"day" dynamodbav:"day" firestore:"day"` // UTC date, YYYY-MM-DD
+	Views int64  `json:"views" bson:"views" dynamodbav:"views" firestore:"views"`
+	Edits int64  `json:"edits" bson:"edits" dynamodbav:"edits" firestore:"edits"`
+}
+
+// ItemStats reports an item's daily views and edits over a period, oldest day first
+type ItemStats struct {
+	ItemID     string         `json:"itemId"`
+	ItemType   string         `json:"itemType"`
+	From       string         `json:"from"` // First day included
+	To         string         `json:"to"`   // Last day included (today)
+	TotalViews int64          `json:"totalViews"`
+	TotalEdits int64          `json:"totalEdits"`
+	Bookmarks  int64          `json:"bookmarks"` // Readers with the post in their reading list; 0 for code files
+	Days       []ItemStatsDay `json:"days"`      // One entry per day, zero days included
+}
+
+// UsageDay holds one day's API usage of a user
+type UsageDay struct {
+	Day        string `json:"day" bson:"day" dynamodbav:"day" firestore:"day"`                                       // UTC date, YYYY-MM-DD
+	KeyID      string `json:"keyId,omitempty" bson:"keyId,omitempty" dynamodbav:"keyId,omitempty" firestore:"keyId"` // API key used; "" for tokens without an ID, or all keys
+	Requests   int64  `json:"requests" bson:"requests" dynamodbav:"requests" firestore:"requests"`                   // Authenticated HTTP requests
+	WSMessages int64  `json:"wsMessages" bson:"wsMessages" dynamodbav:"wsMessages" firestore:"wsMessages"`           // WebSocket messages after authenticating
+}
+
+// KeyUsage is a user's API usage with one API key (bearer token) over a period
+type KeyUsage struct {
+	KeyID      string `json:"keyId"` // "" for tokens issued without an ID
+	Requests   int64  `json:"requests"`
+	WSMessages int64  `json:"wsMessages"`
+}
+
+// Usage reports a user's daily API usage over a period, oldest day first, and their
+// daily quotas
+type Usage struct {
+	UserID              string     `json:"userId"`
+	From                string     `json:"from"` // First day included
+	To                  string     `json:"to"`   // Last day included (today)
+	TotalRequests       int64      `json:"totalRequests"`
+	TotalWSMessages     int64      `json:"totalWsMessages"`
+	DailyRequestQuota   int        `json:"dailyRequestQuota"`   // 0 for unlimited
+	DailyWSMessageQuota int        `json:"dailyWsMessageQuota"` // 0 for unlimited
+	Days                []UsageDay `json:"days"`                // One entry per day, zero days included, all keys together
+	Keys                []KeyUsage `json:"keys"`                // Totals per API key over the period, most requests first
+}
+
+// ItemEventType is the kind of an ItemLifecycleEvent.
+type ItemEventType string
+
+const (
+	ItemEventCreated     ItemEventType = "created"
+	ItemEventUpdated     ItemEventType = "updated" // Content, path, slug, co-authors or archiving changed
+	ItemEventDeleted     ItemEventType = "deleted" // Moved to the trash
+	ItemEventRestored    ItemEventType = "restored"
+	ItemEventPublished   ItemEventType = "published"
+	ItemEventUnpublished ItemEventType = "unpublished"
+	ItemEventPurged      ItemEventType = "purged" // Removed from the trash for good
+)
+
+// ItemLifecycleEvent is something that happened to one of a user's items, as listed by
+// GET /events. It is derived from the item's history entry.
+type ItemLifecycleEvent struct {
+	ID       string        `json:"id"` // Of the history entry
+	Type     ItemEventType `json:"type"`
+	Action   HistoryAction `json:"action"` // The history action behind it, for detail
+	ItemID   string        `json:"itemId"`
+	ItemType string        `json:"itemType"`
+	Version  int           `json:"version"` // The item's version after the event
+	UserID   string        `json:"userId"`  // Who caused it
+	Time     time.Time     `json:"time"`
+	// Seq numbers the user's events in the order they were logged; see ItemEventsPage
+	Seq int64 `json:"seq"`
+}
+
+// ItemEventsPage is a page of a user's item events, in the order they were numbered. Next
+// is the cursor to pass as since for the events after them: the last one's Seq, or since
+// again if there were none.
+type ItemEventsPage struct {
+	Events []ItemLifecycleEvent `json:"events"`
+	Next   string               `json:"next"`
+	More   bool                 `json:"more"` // More events may follow right away; poll again without waiting
 }
 
 // Change represents a single modification within a file for incremental updates.go
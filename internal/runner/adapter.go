@@ -0,0 +1,95 @@
+// internal/runner/adapter.go
+package runner
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+	"time"
+)
+
+// ErrUnsupportedLanguage is returned for languages the runner can't execute.
+var ErrUnsupportedLanguage = errors.New("language is not supported by the code runner")
+
+// Runner executes a code file in isolation and reports its output. Implementations
+// enforce Limits themselves; a program that exceeds them is stopped and reported in the
+// Result, not as an error.
+type Runner interface {
+	Run(ctx context.Context, req *Request) (*Result, error)
+	Close() error
+}
+
+// Request is a single program run.
+type Request struct {
+	Language string // As langdetect names it
+	FileName string // Base name of the file, e.g. "main.py"
+	Content  string
+	Stdin    string
+}
+
+// Limits bound a run.
+type Limits struct {
+	Timeout        time.Duration
+	MemoryMB       int
+	MaxOutputBytes int // Per stream
+}
+
+// Result is what a run produced.
+type Result struct {
+	Language    string `json:"language"`
+	Stdout      string `json:"stdout"`
+	Stderr      string `json:"stderr"`
+	ExitCode    int    `json:"exitCode"`
+	TimedOut    bool   `json:"timedOut,omitempty"`
+	OutOfMemory bool   `json:"outOfMemory,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"` // Output was cut off at the limit
+	DurationMs  int64  `json:"durationMs"`
+}
+
+// NewRunner creates a runner based on the configuration. It returns nil (and no error)
+// when code execution is disabled.
+func NewRunner(cfg *config.RunnerConfig) (Runner, error) {
+	limits := Limits{Timeout: cfg.Timeout, MemoryMB: cfg.MemoryMB, MaxOutputBytes: cfg.MaxOutputBytes}
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "docker":
+		return NewDockerRunner(cfg.DockerBinary, limits)
+	case "piston":
+		if cfg.PistonURL == "" {
+			return nil, errors.New("Piston selected but RUNNER_PISTON_URL is missing")
+		}
+		return NewPistonRunner(cfg.PistonURL, limits), nil
+	default:
+		return nil, errors.New("unsupported runner type: " + cfg.Type)
+	}
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest.
+type limitedBuffer struct {
+	data      []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.data); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.data = append(b.data, p[:room]...)
+		}
+		return len(p), nil // Keep the program running; it just isn't heard anymore
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string { return string(b.data) }
+
+// truncate cuts s to max bytes, reporting whether it did.
+func truncate(s string, max int) (string, bool) {
+	if max > 0 && len(s) > max {
+		return s[:max], true
+	}
+	return s, false
+}
@@ -0,0 +1,143 @@
+// internal/runner/docker.go
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerLanguage describes how to run one language: the image, the file name the code
+// is mounted as under /code and the command that runs it.
+type dockerLanguage struct {
+	image   string
+	file    string
+	command []string
+}
+
+var dockerLanguages = map[string]dockerLanguage{
+	"python":     {"python:3.12-alpine", "main.py", []string{"python", "/code/main.py"}},
+	"javascript": {"node:20-alpine", "main.js", []string{"node", "/code/main.js"}},
+	"typescript": {"denoland/deno:alpine", "main.ts", []string{"deno", "run", "--quiet", "/code/main.ts"}},
+	"go":         {"golang:1.22-alpine", "main.go", []string{"go", "run", "/code/main.go"}},
+	"ruby":       {"ruby:3.3-alpine", "main.rb", []string{"ruby", "/code/main.rb"}},
+	"php":        {"php:8.3-cli-alpine", "main.php", []string{"php", "/code/main.php"}},
+	"lua":        {"nickblah/lua:5.4-alpine", "main.lua", []string{"lua", "/code/main.lua"}},
+	"shell":      {"alpine:3.20", "main.sh", []string{"sh", "/code/main.sh"}},
+	"c":          {"gcc:14", "main.c", []string{"sh", "-c", "gcc -O2 -o /tmp/main /code/main.c && /tmp/main"}},
+	"cpp":        {"gcc:14", "main.cpp", []string{"sh", "-c", "g++ -O2 -o /tmp/main /code/main.cpp && /tmp/main"}},
+	"rust":       {"rust:1-alpine", "main.rs", []string{"sh", "-c", "rustc -O -o /tmp/main /code/main.rs && /tmp/main"}},
+}
+
+// DockerRunner runs each program in a fresh container with no network, a read-only root
+// file system and limits on memory, CPU and process count. The code is mounted read-only
+// from a temporary directory; /tmp is the only writable location.
+type DockerRunner struct {
+	binary string
+	limits Limits
+}
+
+// NewDockerRunner checks that the Docker CLI is available.
+func NewDockerRunner(binary string, limits Limits) (*DockerRunner, error) {
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("docker CLI not found: %w", err)
+	}
+	return &DockerRunner{binary: binary, limits: limits}, nil
+}
+
+func (d *DockerRunner) Run(ctx context.Context, req *Request) (*Result, error) {
+	lang, ok := dockerLanguages[req.Language]
+	if !ok {
+		return nil, ErrUnsupportedLanguage
+	}
+
+	dir, err := os.MkdirTemp("", "blog-run-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, lang.file), []byte(req.Content), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write code: %w", err)
+	}
+	if err := os.Chmod(dir, 0o755); err != nil { // The container user may not be us
+		return nil, fmt.Errorf("failed to prepare run directory: %w", err)
+	}
+
+	name, err := containerName()
+	if err != nil {
+		return nil, err
+	}
+	memory := strconv.Itoa(d.limits.MemoryMB) + "m"
+	args := []string{
+		"run", "--rm", "-i", "--name", name,
+		"--network", "none", "--read-only", "--tmpfs", "/tmp:rw,exec,size=64m",
+		"--memory", memory, "--memory-swap", memory, "--cpus", "1", "--pids-limit", "64",
+		"--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"--env", "HOME=/tmp", "--env", "GOCACHE=/tmp/go-cache", "--env", "GOPATH=/tmp/go", "--env", "DENO_DIR=/tmp/deno",
+		"-v", dir + ":/code:ro", "-w", "/tmp",
+		lang.image,
+	}
+	args = append(args, lang.command...)
+
+	runCtx, cancel := context.WithTimeout(ctx, d.limits.Timeout)
+	defer cancel()
+	stdout := &limitedBuffer{max: d.limits.MaxOutputBytes}
+	stderr := &limitedBuffer{max: d.limits.MaxOutputBytes}
+	cmd := exec.CommandContext(runCtx, d.binary, args...)
+	cmd.Stdin = strings.NewReader(req.Stdin)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	start := time.Now()
+	runErr := cmd.Run()
+	result := &Result{
+		Language:   req.Language,
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		Truncated:  stdout.truncated || stderr.truncated,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	if runCtx.Err() != nil {
+		// Killing the CLI leaves the container running; stop it explicitly
+		killCtx, killCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_ = exec.CommandContext(killCtx, d.binary, "kill", name).Run()
+		killCancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // The caller gave up, not the program
+		}
+		result.TimedOut, result.ExitCode = true, -1
+		return result, nil
+	}
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, fmt.Errorf("failed to run docker: %w", runErr)
+	}
+	if exitErr != nil {
+		result.ExitCode = exitErr.ExitCode()
+		switch result.ExitCode {
+		case 125: // Docker itself failed, e.g. the image couldn't be pulled
+			return nil, fmt.Errorf("docker run failed: %s", strings.TrimSpace(result.Stderr))
+		case 137: // SIGKILL, which within the limits means the OOM killer
+			result.OutOfMemory = true
+		}
+	}
+	return result, nil
+}
+
+func (d *DockerRunner) Close() error { return nil }
+
+func containerName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate container name: %w", err)
+	}
+	return "blog-run-" + hex.EncodeToString(b), nil
+}
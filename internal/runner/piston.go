@@ -0,0 +1,132 @@
+// internal/runner/piston.go
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pistonLanguages maps langdetect names to Piston's where they differ.
+var pistonLanguages = map[string]string{"shell": "bash", "cpp": "c++"}
+
+// maxPistonResponse bounds how much of a response is read. Piston caps output itself,
+// so this only guards against a misbehaving service.
+const maxPistonResponse = 16 << 20
+
+// PistonRunner runs programs on a Piston execution service
+// (https://github.com/engineer-man/piston), which sandboxes each run itself.
+type PistonRunner struct {
+	baseURL string
+	limits  Limits
+	client  *http.Client
+}
+
+func NewPistonRunner(baseURL string, limits Limits) *PistonRunner {
+	return &PistonRunner{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		limits:  limits,
+		client:  &http.Client{Timeout: limits.Timeout + 30*time.Second}, // Compilation and queueing come on top
+	}
+}
+
+type pistonFile struct {
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content"`
+}
+
+type pistonRequest struct {
+	Language       string       `json:"language"`
+	Version        string       `json:"version"`
+	Files          []pistonFile `json:"files"`
+	Stdin          string       `json:"stdin"`
+	RunTimeout     int64        `json:"run_timeout"`      // Milliseconds
+	RunMemoryLimit int64        `json:"run_memory_limit"` // Bytes
+}
+
+type pistonStage struct {
+	Stdout string  `json:"stdout"`
+	Stderr string  `json:"stderr"`
+	Code   *int    `json:"code"`   // Nil if killed by a signal
+	Signal *string `json:"signal"` // E.g. "SIGKILL" on timeout or memory exhaustion
+}
+
+type pistonResponse struct {
+	Message string       `json:"message"` // Set on errors
+	Compile *pistonStage `json:"compile"`
+	Run     pistonStage  `json:"run"`
+}
+
+func (p *PistonRunner) Run(ctx context.Context, req *Request) (*Result, error) {
+	language := req.Language
+	if mapped, ok := pistonLanguages[language]; ok {
+		language = mapped
+	}
+	body, err := json.Marshal(pistonRequest{
+		Language: language, Version: "*",
+		Files:          []pistonFile{{Name: req.FileName, Content: req.Content}},
+		Stdin:          req.Stdin,
+		RunTimeout:     p.limits.Timeout.Milliseconds(),
+		RunMemoryLimit: int64(p.limits.MemoryMB) << 20,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/v2/execute", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("piston request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out pistonResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPistonResponse)).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid piston response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusBadRequest && strings.Contains(out.Message, "runtime is unknown") {
+			return nil, ErrUnsupportedLanguage
+		}
+		return nil, fmt.Errorf("piston returned %s: %s", resp.Status, out.Message)
+	}
+
+	result := &Result{Language: req.Language, DurationMs: time.Since(start).Milliseconds()}
+	stage := &out.Run
+	if out.Compile != nil && (out.Compile.Code == nil || *out.Compile.Code != 0) {
+		stage = out.Compile // Report the compiler's complaint instead of an empty run
+	}
+	var stdoutCut, stderrCut bool
+	result.Stdout, stdoutCut = truncate(stage.Stdout, p.limits.MaxOutputBytes)
+	result.Stderr, stderrCut = truncate(stage.Stderr, p.limits.MaxOutputBytes)
+	result.Truncated = stdoutCut || stderrCut
+	if stage.Code != nil {
+		result.ExitCode = *stage.Code
+	} else {
+		result.ExitCode = -1
+		if stage.Signal != nil && *stage.Signal == "SIGKILL" {
+			// Piston doesn't say which limit was hit; assume time if the run took that long
+			if time.Since(start) >= p.limits.Timeout {
+				result.TimedOut = true
+			} else {
+				result.OutOfMemory = true
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p *PistonRunner) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,33 @@
+// internal/search/adapter.go
+package search
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+)
+
+// SearchAdapter defines the interface for full-text index backends.
+type SearchAdapter interface {
+	Index(ctx context.Context, doc *Document) error   // Adds or replaces doc
+	Bulk(ctx context.Context, docs []*Document) error // Adds or replaces docs in one round trip
+	Delete(ctx context.Context, id string) error      // Deleting a missing document is not an error
+	Search(ctx context.Context, q Query) (*Results, error)
+	Reset(ctx context.Context) error // Drops every document and recreates the index
+	Close() error
+}
+
+// NewSearchAdapter creates a search adapter based on the configuration.
+func NewSearchAdapter(ctx context.Context, cfg *config.SearchConfig) (SearchAdapter, error) {
+	switch cfg.Type {
+	case "", "bleve":
+		return NewBleveIndex(cfg.IndexPath)
+	case "elasticsearch", "opensearch":
+		if len(cfg.ElasticURLs) == 0 {
+			return nil, errors.New("Elasticsearch selected but SEARCH_ELASTIC_URLS is missing")
+		}
+		return NewElasticIndex(ctx, cfg)
+	default:
+		return nil, errors.New("unsupported search type: " + cfg.Type)
+	}
+}
@@ -0,0 +1,183 @@
+// internal/search/bleve.go
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+	titleBoost   = 2.0 // Title matches rank above body matches
+
+	// lockTimeout bounds the wait for an index another process has open; only one
+	// process can open an on-disk index at a time
+	lockTimeout = "5s"
+)
+
+// pageSize clamps a requested page size to the supported range.
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+// BleveIndex is a full-text index stored on local disk, or in memory. It suits
+// single-instance deployments; use ElasticIndex when several servers share one index.
+type BleveIndex struct {
+	path  string // Empty for an in-memory index
+	index bleve.Index
+}
+
+// NewBleveIndex opens the index at path, creating it if it doesn't exist. An empty path
+// keeps the index in memory, so it is lost on restart. It fails if another process
+// (e.g. a running server) has the index open.
+func NewBleveIndex(path string) (*BleveIndex, error) {
+	if path == "" {
+		index, err := bleve.NewMemOnly(newIndexMapping())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create in-memory search index: %w", err)
+		}
+		return &BleveIndex{index: index}, nil
+	}
+	index, err := bleve.OpenUsing(path, map[string]interface{}{"bolt_timeout": lockTimeout})
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, newIndexMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index at %s: %w", path, err)
+	}
+	return &BleveIndex{path: path, index: index}, nil
+}
+
+// newIndexMapping analyzes title and content as text and keeps the identifying fields
+// as exact keywords for filtering.
+func newIndexMapping() mapping.IndexMapping {
+	keyword := bleve.NewKeywordFieldMapping()
+	text := bleve.NewTextFieldMapping() // Stored with term vectors, needed for snippets
+
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("itemId", keyword)
+	doc.AddFieldMappingsAt("itemType", keyword)
+	doc.AddFieldMappingsAt("userId", keyword)
+	doc.AddFieldMappingsAt("tenantId", keyword)
+	doc.AddFieldMappingsAt("title", text)
+	doc.AddFieldMappingsAt("content", text)
+	doc.AddFieldMappingsAt("updatedAt", bleve.NewDateTimeFieldMapping())
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = doc
+	return indexMapping
+}
+
+// Index adds or replaces a document.
+func (b *BleveIndex) Index(ctx context.Context, doc *Document) error {
+	return b.index.Index(doc.ID, doc)
+}
+
+// Bulk adds or replaces documents in a single batch.
+func (b *BleveIndex) Bulk(ctx context.Context, docs []*Document) error {
+	batch := b.index.NewBatch()
+	for _, doc := range docs {
+		if err := batch.Index(doc.ID, doc); err != nil {
+			return fmt.Errorf("failed to add %s to batch: %w", doc.ID, err)
+		}
+	}
+	return b.index.Batch(batch)
+}
+
+// Delete removes a document. Deleting a missing document is not an error.
+func (b *BleveIndex) Delete(ctx context.Context, id string) error {
+	return b.index.Delete(id)
+}
+
+// Reset deletes the index from disk and creates an empty one in its place.
+func (b *BleveIndex) Reset(ctx context.Context) error {
+	if err := b.index.Close(); err != nil {
+		return fmt.Errorf("failed to close search index: %w", err)
+	}
+	if b.path == "" {
+		index, err := bleve.NewMemOnly(newIndexMapping())
+		if err != nil {
+			return fmt.Errorf("failed to create in-memory search index: %w", err)
+		}
+		b.index = index
+		return nil
+	}
+	if err := os.RemoveAll(b.path); err != nil {
+		return fmt.Errorf("failed to remove search index at %s: %w", b.path, err)
+	}
+	index, err := bleve.New(b.path, newIndexMapping())
+	if err != nil {
+		return fmt.Errorf("failed to create search index at %s: %w", b.path, err)
+	}
+	b.index = index
+	return nil
+}
+
+// Search returns the user's items matching q.Text, ranked by relevance.
+func (b *BleveIndex) Search(ctx context.Context, q Query) (*Results, error) {
+	limit := pageSize(q.Limit)
+
+	title := bleve.NewMatchQuery(q.Text)
+	title.SetField("title")
+	title.SetBoost(titleBoost)
+	content := bleve.NewMatchQuery(q.Text)
+	content.SetField("content")
+	owner := bleve.NewTermQuery(q.UserID)
+	owner.SetField("userId")
+	must := []query.Query{bleve.NewDisjunctionQuery(title, content), owner}
+	if q.ItemType != "" {
+		itemType := bleve.NewTermQuery(q.ItemType)
+		itemType.SetField("itemType")
+		must = append(must, itemType)
+	}
+	if q.TenantID != "" {
+		tenantID := bleve.NewTermQuery(q.TenantID)
+		tenantID.SetField("tenantId")
+		must = append(must, tenantID)
+	}
+
+	req := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(must...), limit, q.Offset, false)
+	req.Fields = []string{"itemId", "itemType", "title"}
+	req.Highlight = bleve.NewHighlightWithStyle("html") // Escapes the content around its <mark> tags
+	req.Highlight.AddField("content")
+
+	res, err := b.index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	results := &Results{Total: res.Total, Hits: make([]Hit, 0, len(res.Hits))}
+	for _, match := range res.Hits {
+		results.Hits = append(results.Hits, Hit{
+			ItemID:   stringField(match.Fields, "itemId"),
+			ItemType: stringField(match.Fields, "itemType"),
+			Title:    stringField(match.Fields, "title"),
+			Score:    match.Score,
+			Snippets: match.Fragments["content"],
+		})
+	}
+	return results, nil
+}
+
+// Close flushes and closes the index.
+func (b *BleveIndex) Close() error {
+	return b.index.Close()
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	s, _ := fields[name].(string)
+	return s
+}
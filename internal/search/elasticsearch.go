@@ -0,0 +1,329 @@
+// internal/search/elasticsearch.go
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ElasticIndex stores documents in an Elasticsearch (or OpenSearch) cluster through its
+// REST API. Writes don't force a refresh, so changes become searchable within the
+// index's refresh interval.
+type ElasticIndex struct {
+	nodes    []string // Base URLs; requests fail over to the next node on connection errors
+	index    string
+	username string
+	password string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewElasticIndex connects to the cluster and creates the index if it doesn't exist.
+func NewElasticIndex(ctx context.Context, cfg *config.SearchConfig) (*ElasticIndex, error) {
+	e := &ElasticIndex{
+		index:    cfg.ElasticIndex,
+		username: cfg.ElasticUsername,
+		password: cfg.ElasticPassword,
+		apiKey:   cfg.ElasticAPIKey,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, node := range cfg.ElasticURLs {
+		e.nodes = append(e.nodes, strings.TrimSuffix(node, "/"))
+	}
+	if err := e.ensureIndex(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// indexSettings mirrors the Bleve mapping: title and content are analyzed text and the
+// identifying fields are exact keywords for filtering.
+var indexSettings = map[string]interface{}{
+	"settings": map[string]interface{}{
+		"index": map[string]interface{}{"refresh_interval": "1s"},
+	},
+	"mappings": map[string]interface{}{
+		"dynamic": "strict",
+		"properties": map[string]interface{}{
+			"itemId":    map[string]string{"type": "keyword"},
+			"itemType":  map[string]string{"type": "keyword"},
+			"userId":    map[string]string{"type": "keyword"},
+			"tenantId":  map[string]string{"type": "keyword"},
+			"title":     map[string]string{"type": "text"},
+			"content":   map[string]string{"type": "text", "term_vector": "with_positions_offsets"}, // Faster highlighting of long files
+			"updatedAt": map[string]string{"type": "date"},
+		},
+	},
+}
+
+// ensureIndex creates the index with its mapping unless it already exists.
+func (e *ElasticIndex) ensureIndex(ctx context.Context) error {
+	resp, err := e.do(ctx, http.MethodHead, "/"+e.index, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return e.createIndex(ctx)
+	default:
+		return fmt.Errorf("failed to check search index %s: %s", e.index, resp.Status)
+	}
+}
+
+func (e *ElasticIndex) createIndex(ctx context.Context) error {
+	body, err := json.Marshal(indexSettings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index settings: %w", err)
+	}
+	resp, err := e.do(ctx, http.MethodPut, "/"+e.index, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		// Another server may have created it first
+		respBody, _ := io.ReadAll(resp.Body)
+		if bytes.Contains(respBody, []byte("resource_already_exists_exception")) {
+			return nil
+		}
+		return fmt.Errorf("failed to create search index %s: %s: %s", e.index, resp.Status, respBody)
+	}
+	return checkResponse(resp, "create search index "+e.index)
+}
+
+// Index adds or replaces a document.
+func (e *ElasticIndex) Index(ctx context.Context, doc *Document) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", doc.ID, err)
+	}
+	resp, err := e.do(ctx, http.MethodPut, e.docPath(doc.ID), body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "index "+doc.ID)
+}
+
+// Bulk adds or replaces documents with a single _bulk request.
+func (e *ElasticIndex) Bulk(ctx context.Context, docs []*Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body) // Encode terminates each value with the newline NDJSON needs
+	for _, doc := range docs {
+		action := map[string]interface{}{"index": map[string]string{"_index": e.index, "_id": doc.ID}}
+		if err := enc.Encode(action); err != nil {
+			return fmt.Errorf("failed to marshal bulk action for %s: %w", doc.ID, err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", doc.ID, err)
+		}
+	}
+
+	resp, err := e.do(ctx, http.MethodPost, "/_bulk", body.Bytes(), "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, "bulk index"); err != nil {
+		return err
+	}
+
+	// A 200 response can still carry per-document failures
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID    string          `json:"_id"`
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, op := range item {
+			if len(op.Error) > 0 {
+				if failed == 0 {
+					first = fmt.Sprintf("%s: %s", op.ID, op.Error)
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("bulk index failed for %d of %d documents (first: %s)", failed, len(docs), first)
+}
+
+// Delete removes a document. Deleting a missing document is not an error.
+func (e *ElasticIndex) Delete(ctx context.Context, id string) error {
+	resp, err := e.do(ctx, http.MethodDelete, e.docPath(id), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkResponse(resp, "delete "+id)
+}
+
+// Reset deletes the index and creates an empty one with the current mapping.
+func (e *ElasticIndex) Reset(ctx context.Context) error {
+	resp, err := e.do(ctx, http.MethodDelete, "/"+e.index, nil, "")
+	if err != nil {
+		return err
+	}
+	err = checkResponse(resp, "delete search index "+e.index)
+	resp.Body.Close()
+	if err != nil && resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+	return e.createIndex(ctx)
+}
+
+// Search returns the user's items matching q.Text, ranked by relevance.
+func (e *ElasticIndex) Search(ctx context.Context, q Query) (*Results, error) {
+	filter := []interface{}{
+		map[string]interface{}{"term": map[string]string{"userId": q.UserID}},
+	}
+	if q.ItemType != "" {
+		filter = append(filter, map[string]interface{}{"term": map[string]string{"itemType": q.ItemType}})
+	}
+	if q.TenantID != "" {
+		filter = append(filter, map[string]interface{}{"term": map[string]string{"tenantId": q.TenantID}})
+	}
+	request := map[string]interface{}{
+		"from":             q.Offset,
+		"size":             pageSize(q.Limit),
+		"track_total_hits": true,
+		"_source":          []string{"itemId", "itemType", "title"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":  q.Text,
+						"fields": []string{fmt.Sprintf("title^%g", titleBoost), "content"},
+					},
+				},
+				"filter": filter,
+			},
+		},
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{"<mark>"},
+			"post_tags": []string{"</mark>"},
+			"encoder":   "html", // Escape the content around the tags; snippets are rendered as HTML
+			"fields":    map[string]interface{}{"content": map[string]interface{}{}},
+		},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search request: %w", err)
+	}
+
+	resp, err := e.do(ctx, http.MethodPost, "/"+e.index+"/_search", body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, "search"); err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value uint64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Score     float64             `json:"_score"`
+				Source    Document            `json:"_source"`
+				Highlight map[string][]string `json:"highlight"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	results := &Results{Total: result.Hits.Total.Value, Hits: make([]Hit, 0, len(result.Hits.Hits))}
+	for _, match := range result.Hits.Hits {
+		results.Hits = append(results.Hits, Hit{
+			ItemID:   match.Source.ItemID,
+			ItemType: match.Source.ItemType,
+			Title:    match.Source.Title,
+			Score:    match.Score,
+			Snippets: match.Highlight["content"],
+		})
+	}
+	return results, nil
+}
+
+// Close releases idle connections to the cluster.
+func (e *ElasticIndex) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func (e *ElasticIndex) docPath(id string) string {
+	return "/" + e.index + "/_doc/" + url.PathEscape(id)
+}
+
+// do sends a request to the first node that accepts the connection. HTTP error
+// statuses are returned to the caller, not retried.
+func (e *ElasticIndex) do(ctx context.Context, method, path string, body []byte, contentType string) (*http.Response, error) {
+	var lastErr error
+	for _, node := range e.nodes {
+		req, err := http.NewRequestWithContext(ctx, method, node+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build search request: %w", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if e.apiKey != "" {
+			req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+		} else if e.username != "" {
+			req.SetBasicAuth(e.username, e.password)
+		}
+
+		resp, err := e.client.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no search nodes configured")
+	}
+	return nil, fmt.Errorf("search cluster unreachable: %w", lastErr)
+}
+
+// checkResponse turns a non-2xx response into an error carrying the cluster's reason.
+func checkResponse(resp *http.Response, op string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("failed to %s: %s: %s", op, resp.Status, bytes.TrimSpace(body))
+}
@@ -0,0 +1,139 @@
+// internal/search/search.go
+package search
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Document is the searchable view of a post or code file.
+type Document struct {
+	ID        string    `json:"-"` // DocumentID(ItemType, ItemID)
+	ItemID    string    `json:"itemId"`
+	ItemType  string    `json:"itemType"`
+	UserID    string    `json:"userId"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	Title     string    `json:"title"` // Post title or code file path
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DocumentID returns the index key of an item.
+func DocumentID(itemType, itemID string) string {
+	return itemType + ":" + itemID
+}
+
+// Query selects a user's items matching free text.
+type Query struct {
+	UserID   string
+	TenantID string // Set with multi-tenancy
+	Text     string
+	ItemType string // Optional: "post" or "codefile"
+	Limit    int
+	Offset   int
+}
+
+// Hit is one matching item. Snippets are HTML fragments with matched terms wrapped in
+// <mark>; the content's own text, markup included, is HTML-escaped, so they are safe to
+// render as HTML.
+type Hit struct {
+	ItemID   string   `json:"itemId"`
+	ItemType string   `json:"itemType"`
+	Title    string   `json:"title"`
+	Score    float64  `json:"score"`
+	Snippets []string `json:"snippets,omitempty"`
+}
+
+// Results is a page of hits, best match first.
+type Results struct {
+	Total uint64 `json:"total"` // Matches across all pages
+	Hits  []Hit  `json:"hits"`
+}
+
+// LoadFunc returns the current document for an item, or nil if the item no longer exists
+// (or is in the trash) and should be dropped from the index.
+type LoadFunc func(ctx context.Context, itemID, itemType string) (*Document, error)
+
+type itemRef struct {
+	itemID   string
+	itemType string
+	tenantID string
+}
+
+// Indexer applies index updates in the background so writes don't wait for indexing.
+// Updates only name the item; the worker loads its latest state when it gets to it, so
+// a burst of edits to one item collapses into a single reindex.
+type Indexer struct {
+	index SearchAdapter
+	load  LoadFunc
+	queue chan itemRef
+
+	mu      sync.Mutex
+	pending map[string]bool // Document IDs waiting in queue
+}
+
+// NewIndexer creates an indexer holding at most queueSize pending items.
+func NewIndexer(index SearchAdapter, load LoadFunc, queueSize int) *Indexer {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	return &Indexer{index: index, load: load, queue: make(chan itemRef, queueSize), pending: make(map[string]bool)}
+}
+
+// Enqueue schedules an item to be reindexed. It never blocks; if the queue is full the
+// update is dropped and the item is picked up again on its next change. The item is
+// loaded for the tenant of ctx.
+func (ix *Indexer) Enqueue(ctx context.Context, itemID, itemType string) {
+	tenantID := tenant.ID(ctx)
+	id := DocumentID(itemType, itemID)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.pending[id] {
+		return // Already queued; the worker will read the latest state
+	}
+	select {
+	case ix.queue <- itemRef{itemID: itemID, itemType: itemType, tenantID: tenantID}:
+		ix.pending[id] = true
+	default:
+		slog.WarnContext(ctx, "Search index queue full, dropping update", "id", id)
+	}
+}
+
+// Run processes queued updates until ctx is cancelled.
+func (ix *Indexer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ref := <-ix.queue:
+			id := DocumentID(ref.itemType, ref.itemID)
+			ix.mu.Lock()
+			delete(ix.pending, id) // Changes from now on queue it again
+			ix.mu.Unlock()
+			ix.process(ctx, ref, id)
+		}
+	}
+}
+
+func (ix *Indexer) process(ctx context.Context, ref itemRef, id string) {
+	if ref.tenantID != "" {
+		ctx = tenant.WithID(ctx, ref.tenantID)
+	}
+	doc, err := ix.load(ctx, ref.itemID, ref.itemType)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load for search indexing", "id", id, "error", err)
+		return
+	}
+	if doc == nil {
+		err = ix.index.Delete(ctx, id)
+	} else {
+		doc.ID = id
+		err = ix.index.Index(ctx, doc)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to update search index", "id", id, "error", err)
+	}
+}
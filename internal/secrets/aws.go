@@ -0,0 +1,87 @@
+// internal/secrets/aws.go
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. Names are secret names or
+// ARNs; the region is the ARN's, or else the SDK's default (AWS_REGION, the shared
+// config file). Credentials come from the SDK's default chain, e.g. an instance role.
+// Only secrets stored as strings are supported.
+type AWSSecretsManager struct {
+	Client *http.Client // Nil means a client with a 30s timeout
+}
+
+func (a *AWSSecretsManager) Secret(ctx context.Context, name string) (string, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if arn := strings.Split(name, ":"); len(arn) > 3 && arn[0] == "arn" {
+		opts = append(opts, awsconfig.WithRegion(arn[3]))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return "", fmt.Errorf("loading AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return "", errors.New("no AWS region configured")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("retrieving AWS credentials: %w", err)
+	}
+
+	// The SDK's Secrets Manager client isn't a dependency, so call GetSecretValue directly
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", cfg.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", cfg.Region, time.Now()); err != nil {
+		return "", fmt.Errorf("signing request: %w", err)
+	}
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("secrets manager returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	if out.SecretString == nil {
+		return "", errors.New("secret is binary, not a string")
+	}
+	return *out.SecretString, nil
+}
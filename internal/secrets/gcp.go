@@ -0,0 +1,39 @@
+// internal/secrets/gcp.go
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// GCPSecretManager reads secrets from Google Cloud Secret Manager, authenticating with
+// the application default credentials. Names are resource names,
+// projects/<project>/secrets/<secret>[/versions/<version>]; without a version the
+// latest one is read.
+type GCPSecretManager struct{}
+
+func (g *GCPSecretManager) Secret(ctx context.Context, name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	svc, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return "", fmt.Errorf("creating secret manager client: %w", err)
+	}
+	resp, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if resp.Payload == nil {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret payload: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,97 @@
+// Package secrets resolves references to secrets kept in a secret store, so settings like
+// the JWT secret or database URIs don't have to be given as plaintext. A reference is
+// "<scheme>://<name>" or "<scheme>://<name>#<key>"; with a key, the secret must be a JSON
+// object and the reference stands for the key's value. The built-in schemes are
+//
+//	awssm://prod/blog#jwt_secret                       AWS Secrets Manager (name or ARN)
+//	gcpsm://projects/my-project/secrets/mongo-uri      GCP Secret Manager (latest version unless given)
+//	vault://secret/data/blog#jwt_secret                HashiCorp Vault (KV v1 or v2 path)
+//
+// and others can be added with Register.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Provider fetches secrets from a secret store.
+type Provider interface {
+	// Secret returns the secret called name, in the store's own naming scheme.
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		"awssm": &AWSSecretsManager{},
+		"gcpsm": &GCPSecretManager{},
+		"vault": &Vault{},
+	}
+)
+
+// Register makes p resolve references with the given scheme, replacing any provider
+// registered for it before.
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[scheme] = p
+}
+
+func lookup(value string) (Provider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, "", false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[scheme]
+	return p, ref, ok
+}
+
+// IsReference reports whether value refers to a secret of a registered provider. Other
+// URLs, e.g. mongodb://..., are not references.
+func IsReference(value string) bool {
+	_, _, ok := lookup(value)
+	return ok
+}
+
+// Resolve returns the secret value refers to.
+func Resolve(ctx context.Context, value string) (string, error) {
+	p, ref, ok := lookup(value)
+	if !ok {
+		return "", errors.New("not a secret reference")
+	}
+	name, key, hasKey := strings.Cut(ref, "#")
+	if name == "" {
+		return "", errors.New("secret reference without a name")
+	}
+	secret, err := p.Secret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("fetching secret %s: %w", name, err)
+	}
+	if !hasKey {
+		return secret, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, so it has no key %s", name, key)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", name, key)
+	}
+	switch v := field.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("secret %s: key %s doesn't hold a plain value", name, key)
+	}
+}
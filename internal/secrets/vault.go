@@ -0,0 +1,75 @@
+// internal/secrets/vault.go
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Vault reads secrets from a HashiCorp Vault KV engine through its HTTP API. The server
+// and token are taken from Vault's usual environment variables, VAULT_ADDR, VAULT_TOKEN
+// and (for Vault Enterprise) VAULT_NAMESPACE. Names are API paths below /v1, e.g.
+// secret/data/blog for KV v2; the secret is the path's data as a JSON object, so
+// references normally pick a key from it.
+type Vault struct {
+	Client *http.Client // Nil means a client with a 30s timeout
+}
+
+func (v *Vault) Secret(ctx context.Context, name string) (string, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+strings.TrimPrefix(name, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := out.Data
+	// KV v2 wraps the secret in data.data, next to its metadata
+	if inner, ok := data["data"]; ok {
+		if _, versioned := data["metadata"]; versioned {
+			return string(inner), nil
+		}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,164 @@
+// Package seed creates sample users, posts and code files, with their edit history, from
+// JSON fixtures. It goes through the service layer, so seeded data is indistinguishable
+// from data created through the API, and demos and integration tests start from a known
+// state.
+package seed
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/database/memory"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/storage/local"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// DemoName names the built-in fixtures in place of a file, e.g. SEED_FILE=demo.
+const DemoName = "demo"
+
+//go:embed fixtures/demo.json
+var demoFixtures []byte
+
+// Fixtures is the JSON fixture format. Users are created first, so posts and code files
+// can belong to them.
+type Fixtures struct {
+	Users     []User     `json:"users"`
+	Posts     []Post     `json:"posts"`
+	CodeFiles []CodeFile `json:"codeFiles"`
+}
+
+type User struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Post is created with Content and then saved with each of Revisions in turn, one
+// version (and history entry) each.
+type Post struct {
+	User      string   `json:"user"`
+	Title     string   `json:"title"`
+	Slug      string   `json:"slug,omitempty"` // Generated from the title if empty
+	Content   string   `json:"content"`
+	Revisions []string `json:"revisions,omitempty"`
+	Publish   bool     `json:"publish,omitempty"` // Publish the last revision
+}
+
+// CodeFile is created with Content and then saved with each of Revisions in turn.
+type CodeFile struct {
+	User      string   `json:"user"`
+	Path      string   `json:"path"`               // e.g. "src/main.go"
+	Language  string   `json:"language,omitempty"` // Detected if empty
+	Content   string   `json:"content"`
+	Revisions []string `json:"revisions,omitempty"`
+}
+
+// Result is what Load created, in fixture order. Items are at their final version.
+type Result struct {
+	Users     []*models.User
+	Posts     []*models.Post
+	CodeFiles []*models.CodeFile
+}
+
+// Parse reads fixtures from JSON. Unknown fields are errors, to catch typos.
+func Parse(r io.Reader) (*Fixtures, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var f Fixtures
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid fixtures: %w", err)
+	}
+	return &f, nil
+}
+
+// ReadFile reads fixtures from the file at path, or the built-in ones if path is DemoName.
+func ReadFile(path string) (*Fixtures, error) {
+	if path == DemoName {
+		return Demo(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Demo returns the built-in fixtures: a few users with posts and code files that have
+// some history.
+func Demo() *Fixtures {
+	f, err := Parse(bytes.NewReader(demoFixtures))
+	if err != nil {
+		panic("seed: invalid built-in fixtures: " + err.Error())
+	}
+	return f
+}
+
+// Load creates the fixtures through svc, for the tenant in ctx. It stops at the first
+// error; a user that already exists fails with service.ErrUsernameTaken before anything
+// of theirs is created.
+func Load(ctx context.Context, svc *service.Service, f *Fixtures) (*Result, error) {
+	result := &Result{}
+	for _, u := range f.Users {
+		user, err := svc.RegisterUser(ctx, u.Username, u.Password)
+		if err != nil {
+			return result, fmt.Errorf("failed to create user %q: %w", u.Username, err)
+		}
+		result.Users = append(result.Users, user)
+	}
+
+	for _, p := range f.Posts {
+		post, err := svc.CreatePost(ctx, p.User, p.Title, p.Slug, p.Content)
+		if err != nil {
+			return result, fmt.Errorf("failed to create post %q: %w", p.Title, err)
+		}
+		version := post.Version
+		for i, revision := range p.Revisions {
+			if version, _, err = svc.SaveDraft(ctx, p.User, post.ID, version, revision); err != nil {
+				return result, fmt.Errorf("failed to save revision %d of post %q: %w", i+1, p.Title, err)
+			}
+		}
+		if p.Publish {
+			if _, err := svc.PublishPost(ctx, p.User, post.ID, version); err != nil {
+				return result, fmt.Errorf("failed to publish post %q: %w", p.Title, err)
+			}
+		}
+		if post, err = svc.GetPostDetails(ctx, post.ID); err != nil {
+			return result, fmt.Errorf("failed to reload post %q: %w", p.Title, err)
+		}
+		result.Posts = append(result.Posts, post)
+	}
+
+	for _, c := range f.CodeFiles {
+		file, err := svc.CreateCodeFile(ctx, c.User, c.Path, c.Language, c.Content)
+		if err != nil {
+			return result, fmt.Errorf("failed to create code file %q: %w", c.Path, err)
+		}
+		version, content := file.Version, c.Content
+		for i, revision := range c.Revisions {
+			change := models.Change{Removed: utf8.RuneCountInString(content), Text: revision} // Replaces everything
+			if version, _, err = svc.ApplyItemChanges(ctx, c.User, file.ID, string(models.ItemTypeCodeFile), version, []models.Change{change}); err != nil {
+				return result, fmt.Errorf("failed to save revision %d of code file %q: %w", i+1, c.Path, err)
+			}
+			content = revision
+		}
+		if file, err = svc.GetCodeFileDetails(ctx, file.ID); err != nil {
+			return result, fmt.Errorf("failed to reload code file %q: %w", c.Path, err)
+		}
+		result.CodeFiles = append(result.CodeFiles, file)
+	}
+	return result, nil
+}
+
+// NewMemoryService returns a service on an empty in-memory database and storage with no
+// cache, e.g. for an integration test to Load fixtures into.
+func NewMemoryService(cfg *config.Config) *service.Service {
+	return service.NewService(memory.NewMemoryDB(), local.NewMemoryStorage(), cache.NewNoOpCache(), cfg)
+}
@@ -0,0 +1,9 @@
+// internal/service/admin.go
+package service
+
+import "slices"
+
+// IsAdmin reports whether userID may use the admin API.
+func (s *Service) IsAdmin(userID string) bool {
+	return userID != "" && slices.Contains(s.cfg.Admin.UserIDs, userID)
+}
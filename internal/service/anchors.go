@@ -0,0 +1,380 @@
+// internal/service/anchors.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"log/slog"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// A comment can be anchored to a selection of its item's content (see
+// models.CommentAnchor). Anchors are stored as of the version they were last moved to,
+// and brought up to the version they follow after each change, by a background job:
+// through the changes made since, from the journal or the history, or, if those aren't
+// all there (e.g. across a revert), by diffing the anchor's version against the one it
+// follows. Anchors follow the item's current version, except those of readers of a
+// published post, who can't see its draft: theirs follow the published version.
+
+const (
+	// maxAnchorChanges bounds the changes walked to move anchors; past it they are moved
+	// by diffing the content instead.
+	maxAnchorChanges = 5000
+	// anchorMoveDelay is how long after a change the anchors of its item are moved, so a
+	// run of edits is walked through once.
+	anchorMoveDelay = time.Minute
+)
+
+var ErrInvalidAnchor = apperr.New(apperr.Validation, "anchor must select some of the item's content, at its current or an earlier version, or for readers of a post its published version")
+
+// anchorsJob is the payload of an anchors.move job.
+type anchorsJob struct {
+	ItemID   string          `json:"itemId"`
+	ItemType models.ItemType `json:"itemType"`
+}
+
+// newCommentAnchor checks the anchor of userID's new comment against the content it
+// selects and returns a copy moved up to the version it follows.
+func (s *Service) newCommentAnchor(ctx context.Context, userID, itemID string, itemType models.ItemType, meta models.ItemMeta, req *models.CommentAnchor) (*models.CommentAnchor, error) {
+	anchor := &models.CommentAnchor{
+		Version:   req.Version,
+		StartLine: req.StartLine, StartColumn: req.StartColumn,
+		EndLine: req.EndLine, EndColumn: req.EndColumn,
+	}
+	if post, ok := meta.(*models.Post); ok && post.PublishedVersion > 0 {
+		role, err := s.itemRole(ctx, userID, post.UserID, itemID, itemType)
+		if err != nil {
+			return nil, err
+		}
+		if !role.Includes(models.RoleViewer) { // A reader, who only sees the published content
+			if anchor.Version != 0 && anchor.Version != post.PublishedVersion {
+				return nil, ErrInvalidAnchor
+			}
+			anchor.Version, anchor.Published = post.PublishedVersion, true
+		}
+	}
+	if anchor.Version == 0 {
+		anchor.Version = meta.GetVersion()
+	}
+	if anchor.Version < 1 || anchor.Version > meta.GetVersion() ||
+		anchor.StartLine > anchor.EndLine || (anchor.StartLine == anchor.EndLine && anchor.StartColumn >= anchor.EndColumn) {
+		return nil, ErrInvalidAnchor
+	}
+	content, err := s.anchorContent(ctx, itemID, itemType, meta, anchor.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !newAnchorTracker(content).add(anchor) {
+		return nil, ErrInvalidAnchor
+	}
+	s.remapAnchors(ctx, itemID, itemType, meta, []*models.CommentAnchor{anchor})
+	return anchor, nil
+}
+
+// queueAnchorMove schedules the comment anchors of an item to be moved after a change to
+// it. Changes made while the job is queued are picked up by it.
+func (s *Service) queueAnchorMove(ctx context.Context, itemID string, itemType models.ItemType) {
+	payload := anchorsJob{ItemID: itemID, ItemType: itemType}
+	err := s.enqueueJob(ctx, jobMoveAnchors, payload,
+		jobs.WithID(jobMoveAnchors+":"+string(itemType)+":"+itemID), jobs.WithDelay(anchorMoveDelay))
+	if err != nil && !errors.Is(err, errNoJobQueue) {
+		slog.WarnContext(ctx, "Failed to queue moving comment anchors", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+}
+
+func (s *Service) runMoveAnchorsJob(ctx context.Context, job *jobs.Job) error {
+	var payload anchorsJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	meta, err := s.getItemMetaWithCache(ctx, payload.ItemID, payload.ItemType)
+	if errors.Is(err, ErrItemNotFound) {
+		return nil // Trashed or gone; moved once it's restored and changed again
+	}
+	if err != nil {
+		return err
+	}
+	for offset := 0; ; offset += itemPageSize {
+		comments, err := s.db.ListComments(ctx, payload.ItemID, string(payload.ItemType), "", itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		s.moveCommentAnchors(ctx, payload.ItemID, payload.ItemType, meta, comments)
+		if len(comments) < itemPageSize {
+			return nil
+		}
+	}
+}
+
+// moveCommentAnchors brings the anchors of comments on an item up to the versions they
+// follow, and saves the ones that changed.
+func (s *Service) moveCommentAnchors(ctx context.Context, itemID string, itemType models.ItemType, meta models.ItemMeta, comments []models.Comment) {
+	var anchors []*models.CommentAnchor
+	var before []models.CommentAnchor
+	var anchored []*models.Comment
+	for i := range comments {
+		if a := comments[i].Anchor; a != nil && a.Version < anchorTarget(meta, a) && !a.Detached {
+			anchors = append(anchors, a)
+			before = append(before, *a)
+			anchored = append(anchored, &comments[i])
+		}
+	}
+	if len(anchors) == 0 {
+		return
+	}
+
+	s.remapAnchors(ctx, itemID, itemType, meta, anchors)
+	for i, comment := range anchored {
+		if *comment.Anchor == before[i] {
+			continue
+		}
+		err := s.db.SetCommentAnchor(ctx, itemID, string(itemType), comment.ID, comment.Anchor)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			slog.WarnContext(ctx, "Failed to save moved comment anchor", "commentID", comment.ID, "itemType", itemType, "itemID", itemID, "error", err)
+		}
+	}
+}
+
+// anchorTarget returns the version an anchor follows: the item's current one, or for a
+// Published anchor the post's published one.
+func anchorTarget(meta models.ItemMeta, anchor *models.CommentAnchor) int {
+	if post, ok := meta.(*models.Post); ok && anchor.Published && post.PublishedVersion > 0 {
+		return post.PublishedVersion
+	}
+	return meta.GetVersion()
+}
+
+// remapAnchors moves anchors of earlier versions up to the versions they follow.
+func (s *Service) remapAnchors(ctx context.Context, itemID string, itemType models.ItemType, meta models.ItemMeta, anchors []*models.CommentAnchor) {
+	stale := make(map[int][]*models.CommentAnchor) // Keyed by the version they follow
+	for _, a := range anchors {
+		if target := anchorTarget(meta, a); a.Version < target && !a.Detached {
+			stale[target] = append(stale[target], a)
+		}
+	}
+	for target, group := range stale {
+		s.remapAnchorsTo(ctx, itemID, itemType, meta, group, target)
+	}
+}
+
+// remapAnchorsTo moves anchors of versions before head up to head. An anchor that can't
+// be followed there, because the content of its version is no longer retained or it
+// doesn't fit that content, is detached at its version. Other failures (e.g. storage
+// being unreachable) leave anchors as they were, to be tried again.
+func (s *Service) remapAnchorsTo(ctx context.Context, itemID string, itemType models.ItemType, meta models.ItemMeta, stale []*models.CommentAnchor, head int) {
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Version < stale[j].Version })
+
+	// 1. Through the changes made since the oldest anchor's version
+	from := stale[0].Version
+	content, err := s.anchorContent(ctx, itemID, itemType, meta, from)
+	if err == nil {
+		var batches []models.VersionChanges
+		if batches, err = s.changesSince(ctx, itemID, itemType, from, head, maxAnchorChanges); err == nil {
+			if err = replayAnchors(content, stale, batches, head); err == nil {
+				return
+			}
+		}
+	}
+	if !anchorContentGone(err) {
+		slog.WarnContext(ctx, "Failed to move comment anchors", "itemType", itemType, "itemID", itemID, "error", err)
+		return
+	}
+
+	// 2. Otherwise by diffing each anchor's version against head's content
+	headContent, err := s.anchorContent(ctx, itemID, itemType, meta, head)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to move comment anchors", "itemType", itemType, "itemID", itemID, "error", err)
+		return
+	}
+	for len(stale) > 0 {
+		n := 1
+		for n < len(stale) && stale[n].Version == stale[0].Version {
+			n++
+		}
+		group := stale[:n]
+		stale = stale[n:]
+
+		content, err := s.anchorContent(ctx, itemID, itemType, meta, group[0].Version)
+		if err == nil {
+			err = replayAnchors(content, group, []models.VersionChanges{{
+				Version: head, Changes: changesFromEdits(diff.Edits(content, headContent)),
+			}}, head)
+		}
+		switch {
+		case err == nil:
+		case anchorContentGone(err):
+			slog.InfoContext(ctx, "Detaching comment anchors", "itemType", itemType, "itemID", itemID, "version", group[0].Version, "error", err)
+			for _, a := range group {
+				a.Detached = true
+			}
+		default:
+			slog.WarnContext(ctx, "Failed to move comment anchors", "itemType", itemType, "itemID", itemID, "version", group[0].Version, "error", err)
+		}
+	}
+}
+
+// anchorContentGone reports whether err says the changes or content needed to move an
+// anchor are gone for good, rather than out of reach for now.
+func anchorContentGone(err error) bool {
+	return errors.Is(err, ErrVersionNotAvailable) || errors.Is(err, ErrApplyChange) ||
+		errors.Is(err, ErrIntegrity) || errors.Is(err, storage.ErrFileNotFound)
+}
+
+// anchorContent returns the content of an item at version, its current one or earlier.
+func (s *Service) anchorContent(ctx context.Context, itemID string, itemType models.ItemType, meta models.ItemMeta, version int) (string, error) {
+	if version == meta.GetVersion() {
+		content, err := s.loadItemContent(ctx, itemID, itemType, version, meta.GetS3Path(), meta.GetContentHash())
+		if !errors.Is(err, errContentMoved) {
+			return content, err
+		}
+		// Written since; the version is in the history now
+	}
+	if post, ok := meta.(*models.Post); ok && version == post.PublishedVersion {
+		return s.downloadContent(ctx, generatePublishedPath(itemID)) // Kept when the version may not be
+	}
+	return s.reconstructVersion(ctx, itemID, itemType, version)
+}
+
+// replayAnchors moves anchors, sorted by version, through batches applied to content, the
+// content of the first anchor's version. Each anchor joins in once its version is
+// reached. The anchors are only updated if all the changes apply, and then one that
+// doesn't fit the content of its version is detached at it.
+func replayAnchors(content string, anchors []*models.CommentAnchor, batches []models.VersionChanges, head int) error {
+	t := newAnchorTracker(content)
+	var misfits []*models.CommentAnchor
+	next := 0
+	join := func(version int) {
+		for ; next < len(anchors) && anchors[next].Version <= version; next++ {
+			if !t.add(anchors[next]) {
+				misfits = append(misfits, anchors[next])
+			}
+		}
+	}
+
+	join(anchors[0].Version)
+	for _, batch := range batches {
+		for i, change := range batch.Changes {
+			if err := t.apply(change); err != nil {
+				return &ChangeValidationError{Index: i, Reason: err.Error()}
+			}
+		}
+		join(batch.Version)
+	}
+	t.finish(head)
+	for _, a := range misfits {
+		a.Detached = true
+	}
+	return nil
+}
+
+// anchorTracker moves anchors along with the text they select as changes are made to
+// it, holding their ends as character offsets into the content.
+type anchorTracker struct {
+	buf     *lineBuffer
+	anchors []*models.CommentAnchor
+	starts  []int
+	ends    []int
+}
+
+func newAnchorTracker(content string) *anchorTracker {
+	return &anchorTracker{buf: newLineBuffer(content)}
+}
+
+// add starts tracking anchor from the current content. It returns false if the anchor
+// doesn't select a range of it.
+func (t *anchorTracker) add(anchor *models.CommentAnchor) bool {
+	start, ok := t.offset(anchor.StartLine, anchor.StartColumn)
+	if !ok {
+		return false
+	}
+	end, ok := t.offset(anchor.EndLine, anchor.EndColumn)
+	if !ok || end < start {
+		return false
+	}
+	t.anchors = append(t.anchors, anchor)
+	t.starts = append(t.starts, start)
+	t.ends = append(t.ends, end)
+	return true
+}
+
+// apply makes a change to the content and moves the anchors' ends past it. Text inserted
+// at either end of a selection stays out of it.
+func (t *anchorTracker) apply(change models.Change) error {
+	at, _ := t.offset(change.Line, change.Column) // If it's outside the content, apply fails
+	if err := t.buf.apply(change); err != nil {
+		return err
+	}
+	inserted := utf8.RuneCountInString(change.Text)
+	for i := range t.anchors {
+		t.starts[i] = moveOffset(t.starts[i], at, change.Removed, inserted, true)
+		t.ends[i] = moveOffset(t.ends[i], at, change.Removed, inserted, false)
+	}
+	return nil
+}
+
+// moveOffset returns where the character offset p of a selection's start or end is after
+// removed characters at offset at are replaced by inserted ones. An end inside the
+// removed text moves to the side of it that keeps the rest of the selection.
+func moveOffset(p, at, removed, inserted int, isStart bool) int {
+	switch {
+	case p < at || (p == at && !isStart):
+		return p
+	case p >= at+removed:
+		return p + inserted - removed
+	case isStart:
+		return at + inserted
+	default:
+		return at
+	}
+}
+
+// finish updates the tracked anchors to their place in the current content, that of
+// version. Anchors whose text is all gone are detached where it was.
+func (t *anchorTracker) finish(version int) {
+	for i, a := range t.anchors {
+		start, end := t.starts[i], t.ends[i]
+		if start >= end {
+			start, end = min(start, end), min(start, end)
+			a.Detached = true
+		}
+		a.Version = version
+		a.StartLine, a.StartColumn = t.position(start)
+		a.EndLine, a.EndColumn = t.position(end)
+	}
+}
+
+// offset returns the character offset of a position in the content, or false if the
+// content has no such position.
+func (t *anchorTracker) offset(line, column int) (int, bool) {
+	if line < 0 || column < 0 || line >= len(t.buf.lines) || column > utf8.RuneCountInString(t.buf.lines[line]) {
+		return 0, false
+	}
+	off := column
+	for _, l := range t.buf.lines[:line] {
+		off += utf8.RuneCountInString(l) + 1 // The line and its '\n'
+	}
+	return off, true
+}
+
+// position returns the line and column of a character offset in the content, the end of
+// the content for offsets past it.
+func (t *anchorTracker) position(offset int) (line, column int) {
+	last := len(t.buf.lines) - 1
+	for i, l := range t.buf.lines {
+		n := utf8.RuneCountInString(l)
+		if offset <= n || i == last {
+			return i, min(offset, n)
+		}
+		offset -= n + 1
+	}
+	return last, 0 // Not reached: content has at least one line
+}
@@ -0,0 +1,78 @@
+// internal/service/archive.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"time"
+)
+
+// ArchiveItem hides a post or code file from default listings. Archived items stay
+// readable and editable; archiving an archived item is a no-op.
+func (s *Service) ArchiveItem(ctx context.Context, userID, itemID, itemTypeStr string) (models.ItemMeta, error) {
+	now := s.now().UTC()
+	return s.setItemArchived(ctx, userID, itemID, itemTypeStr, &now)
+}
+
+// UnarchiveItem returns an archived post or code file to default listings.
+func (s *Service) UnarchiveItem(ctx context.Context, userID, itemID, itemTypeStr string) (models.ItemMeta, error) {
+	return s.setItemArchived(ctx, userID, itemID, itemTypeStr, nil)
+}
+
+// setItemArchived sets (or, with nil, clears) an item's archivedAt and records the change
+// in its history. It returns the updated metadata.
+func (s *Service) setItemArchived(ctx context.Context, userID, itemID, itemTypeStr string, archivedAt *time.Time) (models.ItemMeta, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+
+	// 1. Get Metadata (checks existence and ownership)
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	if meta.IsArchived() == (archivedAt != nil) {
+		return meta, nil // Already in the requested state
+	}
+	version := meta.GetVersion()
+	updated := meta.CopyMeta() // The cached value must not be modified
+	switch m := updated.(type) {
+	case *models.Post:
+		m.ArchivedAt = archivedAt
+	case *models.CodeFile:
+		m.ArchivedAt = archivedAt
+	}
+
+	// 2. Update Metadata
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.SetPostArchivedAt(ctx, itemID, archivedAt)
+	case models.ItemTypeCodeFile:
+		err = s.db.SetCodeFileArchivedAt(ctx, itemID, archivedAt)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error setting archive state", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, mapDBError(err, itemType, itemID)
+	}
+
+	// 3. Log Action History
+	action := models.ActionArchive
+	if archivedAt == nil {
+		action = models.ActionUnarchive
+	}
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: itemID, ItemType: string(itemType),
+		Action: action, Timestamp: s.now().UTC(), ItemVersion: version,
+	}
+	s.logAction(ctx, historyLog)
+
+	// 4. Invalidate Cache
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+	return updated, nil
+}
@@ -0,0 +1,207 @@
+// internal/service/assets.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+)
+
+var (
+	ErrAssetNotFound = apperr.New(apperr.NotFound, "asset not found")
+	ErrInvalidAsset  = apperr.New(apperr.Validation, "asset must not be empty")
+)
+
+// generateAssetPath returns a fresh storage key for asset content. Each content replace
+// gets a new key, so readers of the old metadata never see half-written content.
+func (s *Service) generateAssetPath() string {
+	return "assets/" + s.newID()
+}
+
+// assetContentType returns the content type to store an asset with: the declared one
+// if it is specific, else one from the file extension, else one sniffed from the content.
+func assetContentType(filePath, declared string, content []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil && mediaType != "application/octet-stream" {
+		return declared
+	}
+	if byExt := mime.TypeByExtension(path.Ext(filePath)); byExt != "" {
+		return byExt
+	}
+	return http.DetectContentType(content)
+}
+
+func assetHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// getOwnedAsset loads an asset and checks that userID owns it. Assets have no
+// collaborators.
+func (s *Service) getOwnedAsset(ctx context.Context, userID, assetID string) (*models.Asset, error) {
+	asset, err := s.db.GetAssetByID(ctx, assetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting asset", "assetID", assetID, "error", err)
+		return nil, errors.New("failed to get asset")
+	}
+	if asset.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	return asset, nil
+}
+
+// UploadAsset stores a binary file, such as an image or a font, in the user's code
+// workspace, optionally in one of their projects. An empty contentType is worked out
+// from the file name and content. Assets count towards the storage quota but, not being
+// text, stay out of editing, history and search.
+func (s *Service) UploadAsset(ctx context.Context, userID, filePath, projectID, contentType string, content []byte) (*models.Asset, error) {
+	filePath, err := normalizeCodePath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, ErrInvalidAsset
+	}
+	if projectID != "" {
+		if _, err := s.getOwnedProject(ctx, userID, projectID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkQuota(ctx, userID, int64(len(content))); err != nil {
+		return nil, err
+	}
+
+	asset := &models.Asset{
+		UserID: userID, TenantID: tenant.ID(ctx), FileName: path.Base(filePath), Path: filePath, ProjectID: projectID,
+		ContentType: assetContentType(filePath, contentType, content), Size: int64(len(content)),
+		ContentHash: assetHash(content), S3Path: s.generateAssetPath(), Version: 1,
+	}
+	if err := s.storage.UploadFile(ctx, asset.S3Path, bytes.NewReader(content), asset.ContentType); err != nil {
+		slog.ErrorContext(ctx, "Error uploading asset to storage", "s3Path", asset.S3Path, "error", err)
+		return nil, errors.New("failed to store asset")
+	}
+	if _, err := s.db.CreateAsset(ctx, asset); err != nil {
+		slog.ErrorContext(ctx, "Error creating asset for user", "userID", userID, "error", err)
+		s.deleteAssetObject(ctx, asset.S3Path)
+		return nil, errors.New("failed to create asset")
+	}
+	s.adjustStorageUsage(ctx, userID, asset.Size)
+	return asset, nil
+}
+
+// ReplaceAsset replaces an asset's content, keeping its name and place. A non-zero
+// baseVersion must be the current version.
+func (s *Service) ReplaceAsset(ctx context.Context, userID, assetID string, baseVersion int, contentType string, content []byte) (*models.Asset, error) {
+	if len(content) == 0 {
+		return nil, ErrInvalidAsset
+	}
+	asset, err := s.getOwnedAsset(ctx, userID, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if baseVersion != 0 && baseVersion != asset.Version {
+		return nil, ErrVersionConflict
+	}
+	delta := int64(len(content)) - asset.Size
+	if err := s.checkQuota(ctx, userID, delta); err != nil {
+		return nil, err
+	}
+
+	oldPath := asset.S3Path
+	asset.ContentType = assetContentType(asset.Path, contentType, content)
+	asset.Size, asset.ContentHash, asset.S3Path = int64(len(content)), assetHash(content), s.generateAssetPath()
+	if err := s.storage.UploadFile(ctx, asset.S3Path, bytes.NewReader(content), asset.ContentType); err != nil {
+		slog.ErrorContext(ctx, "Error uploading asset to storage", "s3Path", asset.S3Path, "error", err)
+		return nil, errors.New("failed to store asset")
+	}
+	if err := s.db.UpdateAsset(ctx, asset); err != nil {
+		s.deleteAssetObject(ctx, asset.S3Path)
+		switch {
+		case errors.Is(err, database.ErrVersionMismatch):
+			return nil, ErrVersionConflict
+		case errors.Is(err, database.ErrNotFound):
+			return nil, ErrAssetNotFound
+		}
+		slog.ErrorContext(ctx, "Error updating asset", "assetID", assetID, "error", err)
+		return nil, errors.New("failed to update asset")
+	}
+	asset.Version++
+	s.deleteAssetObject(ctx, oldPath)
+	s.adjustStorageUsage(ctx, userID, delta)
+	return asset, nil
+}
+
+// GetAsset returns an asset's metadata.
+func (s *Service) GetAsset(ctx context.Context, userID, assetID string) (*models.Asset, error) {
+	return s.getOwnedAsset(ctx, userID, assetID)
+}
+
+// ListAssets returns the user's assets, sorted by path.
+func (s *Service) ListAssets(ctx context.Context, userID string, limit, offset int) ([]models.Asset, error) {
+	assets, err := s.db.ListAssetsByUser(ctx, userID, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing assets for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list assets")
+	}
+	return assets, nil
+}
+
+// DownloadAsset returns an asset's content, streamed from storage.
+func (s *Service) DownloadAsset(ctx context.Context, userID, assetID string) (*ItemDownload, error) {
+	asset, err := s.getOwnedAsset(ctx, userID, assetID)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.storage.DownloadFile(ctx, asset.S3Path)
+	if errors.Is(err, storage.ErrFileNotFound) {
+		slog.ErrorContext(ctx, "Asset content missing from storage", "assetID", assetID, "s3Path", asset.S3Path)
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error downloading asset from storage", "s3Path", asset.S3Path, "error", err)
+		return nil, errors.New("failed to retrieve asset")
+	}
+	return &ItemDownload{
+		Body: body, Size: asset.Size, ContentType: asset.ContentType, FileName: asset.FileName,
+		Version: asset.Version, ContentHash: asset.ContentHash,
+	}, nil
+}
+
+// DeleteAsset deletes an asset and its content. Assets don't go through the trash.
+func (s *Service) DeleteAsset(ctx context.Context, userID, assetID string) error {
+	asset, err := s.getOwnedAsset(ctx, userID, assetID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteAsset(ctx, assetID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil // Deleted concurrently
+		}
+		slog.ErrorContext(ctx, "Error deleting asset", "assetID", assetID, "error", err)
+		return errors.New("failed to delete asset")
+	}
+	s.deleteAssetObject(ctx, asset.S3Path)
+	s.adjustStorageUsage(ctx, userID, -asset.Size)
+	return nil
+}
+
+// deleteAssetObject removes asset content that is no longer referenced. Failures only
+// leave an orphaned object behind, so they are logged and not returned.
+func (s *Service) deleteAssetObject(ctx context.Context, s3Path string) {
+	if err := s.storage.DeleteFile(ctx, s3Path); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		slog.WarnContext(ctx, "Failed to delete asset content from storage", "s3Path", s3Path, "error", err)
+	}
+}
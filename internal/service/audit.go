@@ -0,0 +1,34 @@
+// internal/service/audit.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/audit"
+)
+
+// UseAuditExporter streams history entries and authentication events to e's sinks from
+// then on. Call it before serving requests.
+func (s *Service) UseAuditExporter(e *audit.Exporter) {
+	s.auditLog = e
+}
+
+// auditAuth exports the outcome of an authentication attempt for username. A failed
+// login is exported as AuthLoginFailed with the reason; other failures aren't exported.
+func (s *Service) auditAuth(ctx context.Context, eventType, username string, err error) {
+	if s.auditLog == nil {
+		return
+	}
+	event := audit.Event{Type: eventType, UserID: username}
+	if err != nil {
+		if eventType != audit.AuthLogin {
+			return
+		}
+		event.Type = audit.AuthLoginFailed
+		event.Reason = "error"
+		if errors.Is(err, ErrInvalidCredentials) {
+			event.Reason = "invalid credentials"
+		}
+	}
+	s.auditLog.Export(ctx, event)
+}
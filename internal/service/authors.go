@@ -0,0 +1,118 @@
+// internal/service/authors.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"slices"
+)
+
+// A post's byline is its owner followed by its co-authors: collaborators with the editor
+// role the owner chose to credit. Losing the editor role (or access) drops the credit.
+
+const maxCoAuthors = 10
+
+var ErrInvalidCoAuthors = apperr.New(apperr.Validation, "co-authors must be at most 10 distinct editors of the post")
+
+// postAuthors returns the byline of a post.
+func postAuthors(post *models.Post) []string {
+	return append([]string{post.UserID}, post.CoAuthors...)
+}
+
+// SetPostCoAuthors replaces the co-authors of a post with coAuthors, in byline order.
+// Each must currently be an editor of the post. The change is recorded in the post's
+// history. Only the owner can credit co-authors.
+func (s *Service) SetPostCoAuthors(ctx context.Context, userID, postID string, coAuthors []string) (*models.Post, error) {
+	if len(coAuthors) > maxCoAuthors {
+		return nil, ErrInvalidCoAuthors
+	}
+
+	// 1. Get Metadata (checks existence and ownership)
+	cached, err := getItemMetaAs[*models.Post](ctx, s, postID)
+	if err != nil {
+		return nil, err
+	}
+	post := *cached // Copy; the cached value must not be modified
+	if post.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	// 2. Every co-author must be a distinct editor
+	for i, coAuthor := range coAuthors {
+		if coAuthor == post.UserID || slices.Contains(coAuthors[:i], coAuthor) {
+			return nil, ErrInvalidCoAuthors
+		}
+		collab, err := s.db.GetCollaborator(ctx, postID, string(models.ItemTypePost), coAuthor)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return nil, ErrInvalidCoAuthors
+			}
+			slog.ErrorContext(ctx, "Error looking up collaborator on post", "coAuthor", coAuthor, "postID", postID, "error", err)
+			return nil, errors.New("failed to check co-authors")
+		}
+		if !collab.Role.Includes(models.RoleEditor) {
+			return nil, ErrInvalidCoAuthors
+		}
+	}
+	if len(coAuthors) == 0 {
+		coAuthors = nil
+	}
+	oldCoAuthors := post.CoAuthors
+	if slices.Equal(oldCoAuthors, coAuthors) {
+		return &post, nil // Nothing to do
+	}
+
+	// 3. Update Metadata
+	if err := s.db.SetPostCoAuthors(ctx, postID, coAuthors); err != nil {
+		slog.ErrorContext(ctx, "Error setting co-authors of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	post.CoAuthors = coAuthors
+
+	// 4. Log Action History
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: postID, ItemType: string(models.ItemTypePost),
+		Action: models.ActionAuthors, Timestamp: s.now().UTC(), ItemVersion: post.Version,
+		CoAuthorsBefore: oldCoAuthors, CoAuthorsAfter: coAuthors,
+	}
+	s.logAction(ctx, historyLog)
+
+	// 5. Invalidate Cache
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	return &post, nil
+}
+
+// dropCoAuthor removes a user's co-author credit from a post, e.g. when they lose
+// editor access. It does nothing for code files or users who aren't credited.
+func (s *Service) dropCoAuthor(ctx context.Context, actorID, itemID string, itemType models.ItemType, coAuthor string) {
+	if itemType != models.ItemTypePost {
+		return
+	}
+	post, err := getItemMetaAs[*models.Post](ctx, s, itemID)
+	if err != nil {
+		return
+	}
+	if !slices.Contains(post.CoAuthors, coAuthor) {
+		return
+	}
+
+	coAuthors := slices.DeleteFunc(slices.Clone(post.CoAuthors), func(id string) bool { return id == coAuthor })
+	if len(coAuthors) == 0 {
+		coAuthors = nil
+	}
+	if err := s.db.SetPostCoAuthors(ctx, itemID, coAuthors); err != nil {
+		slog.WarnContext(ctx, "Failed to drop co-author from post", "coAuthor", coAuthor, "itemID", itemID, "error", err)
+		return
+	}
+	historyLog := &models.HistoryLog{
+		UserID: actorID, ItemID: itemID, ItemType: string(models.ItemTypePost),
+		Action: models.ActionAuthors, Timestamp: s.now().UTC(), ItemVersion: post.Version,
+		CoAuthorsBefore: post.CoAuthors, CoAuthorsAfter: coAuthors,
+	}
+	s.logAction(ctx, historyLog)
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+}
@@ -0,0 +1,822 @@
+// internal/service/backup.go
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+)
+
+// A backup is a gzipped tar archive holding, in order:
+//
+//	manifest.json             backupManifest
+//	db/<kind>/<n>.jsonl       records of one kind, one JSON object per line
+//	objects/<itemType>/<key>  storage objects the records refer to ("asset" for assets)
+//
+// Records are read and restored through the DBAdapter, so a backup taken from one
+// database type restores into any other.
+const backupFormatVersion = 1
+
+var (
+	ErrInvalidBackup         = apperr.New(apperr.Validation, "invalid backup archive")
+	ErrRestoreTargetNotEmpty = apperr.New(apperr.Conflict, "database to restore into already has users")
+)
+
+// Kinds of backup record, named after their files in the archive
+const (
+	backupUsers         = "users"
+	backupPosts         = "posts"
+	backupCodeFiles     = "codefiles"
+	backupTransfers     = "transfers"
+	backupWorkspaces    = "workspaces"
+	backupTemplates     = "templates"
+	backupProjects      = "projects"
+	backupAssets        = "assets"
+	backupCollaborators = "collaborators"
+	backupVersionTags   = "version_tags"
+	backupHookResults   = "hook_results"
+	backupBookmarks     = "bookmarks"
+	backupItemStats     = "item_stats"
+	backupHistory       = "history"
+	backupSlugRedirects = "slug_redirects"
+	backupDomains       = "domains"
+	backupPushSubs      = "push_subscriptions"
+	backupComments      = "comments"
+	backupReports       = "reports"
+	backupJournal       = "journal"
+)
+
+// backupAssetObjects names the archive directory of asset content. Assets aren't items;
+// their objects are restored with a generic content type.
+const backupAssetObjects models.ItemType = "asset"
+
+const (
+	backupHistoryPage = maxReplayHistory // History entries read at a time
+	backupStatsFrom   = "0000-01-01"
+	backupStatsTo     = "9999-12-31"
+)
+
+type backupManifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	TenantID      string    `json:"tenantId,omitempty"` // Tenant the backup was taken of
+}
+
+// Records of models that leave fields out of JSON carry them alongside.
+
+type backupUser struct {
+	models.User
+	PasswordHash string `json:"passwordHash"`
+}
+
+type backupPost struct {
+	models.Post
+	S3Path  string `json:"s3Path"`
+	Version int    `json:"version"`
+}
+
+type backupCodeFile struct {
+	models.CodeFile
+	S3Path  string `json:"s3Path"`
+	Version int    `json:"version"`
+}
+
+type backupAsset struct {
+	models.Asset
+	S3Path string `json:"s3Path"`
+}
+
+type backupHistoryLog struct {
+	models.HistoryLog
+	S3PathBefore string `json:"s3PathBefore,omitempty"`
+	S3PathAfter  string `json:"s3PathAfter,omitempty"`
+}
+
+type backupComment struct {
+	models.Comment
+	ItemOwnerID string `json:"itemOwnerId"`
+}
+
+type backupPushSubscription struct {
+	models.PushSubscription
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+type backupStatsDay struct {
+	ItemID   string `json:"itemId"`
+	ItemType string `json:"itemType"`
+	models.ItemStatsDay
+}
+
+// backupWriter adds files to a backup archive and counts them in report.
+type backupWriter struct {
+	tw      *tar.Writer
+	report  *models.BackupReport
+	files   map[string]int  // Records files written, by kind
+	objects map[string]bool // Storage keys already handled
+}
+
+func (w *backupWriter) writeFile(name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: w.report.CreatedAt}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// writeBackupRecords adds records of kind to the archive as a file of their own.
+func writeBackupRecords[T any](w *backupWriter, kind string, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return fmt.Errorf("failed to encode %s record: %w", kind, err)
+		}
+	}
+	w.files[kind]++
+	if err := w.writeFile(fmt.Sprintf("db/%s/%d.jsonl", kind, w.files[kind]), buf.Bytes()); err != nil {
+		return err
+	}
+	w.report.Records[kind] += len(records)
+	return nil
+}
+
+// Backup writes every user's records, and the storage objects they refer to, to out as
+// a backup archive. Transient records are left out: write intents (run a consistency
+// check with repair first to settle them), resolved ownership transfers, the search
+// index and the cache. The server can keep running, but writes made during the backup
+// may be caught only partly.
+func (s *Service) Backup(ctx context.Context, out io.Writer) (*models.BackupReport, error) {
+	report := &models.BackupReport{CreatedAt: s.now().UTC(), Records: make(map[string]int)}
+	gz := gzip.NewWriter(out)
+	w := &backupWriter{tw: tar.NewWriter(gz), report: report, files: make(map[string]int), objects: make(map[string]bool)}
+
+	manifest, err := json.Marshal(backupManifest{FormatVersion: backupFormatVersion, CreatedAt: report.CreatedAt, TenantID: tenant.ID(ctx)})
+	if err != nil {
+		return report, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := w.writeFile("manifest.json", manifest); err != nil {
+		return report, err
+	}
+
+	userIDs, err := s.db.ListUserIDs(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := s.backupUser(ctx, w, userID); err != nil {
+			return report, fmt.Errorf("failed to back up user %s: %w", userID, err)
+		}
+	}
+	templates, err := s.db.ListTemplatesByUser(ctx, "") // System-wide
+	if err != nil {
+		return report, fmt.Errorf("failed to list system templates: %w", err)
+	}
+	if err := writeBackupRecords(w, backupTemplates, templates); err != nil {
+		return report, err
+	}
+	for offset := 0; ; offset += itemPageSize {
+		reports, err := s.db.ListReports(ctx, "", itemPageSize, offset)
+		if err != nil {
+			return report, fmt.Errorf("failed to list reports: %w", err)
+		}
+		if err := writeBackupRecords(w, backupReports, reports); err != nil {
+			return report, err
+		}
+		if len(reports) < itemPageSize {
+			break
+		}
+	}
+
+	if err := w.tw.Close(); err != nil {
+		return report, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return report, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return report, nil
+}
+
+// backupUser writes a user and everything the user owns: items (archived and trashed
+// ones included), slug redirects, custom domains, push subscriptions, workspaces,
+// projects, assets, templates, bookmarks and offers received.
+func (s *Service) backupUser(ctx context.Context, w *backupWriter, userID string) error {
+	user, err := s.db.GetUserByUsername(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if err := writeBackupRecords(w, backupUsers, []backupUser{{User: *user, PasswordHash: user.PasswordHash}}); err != nil {
+		return err
+	}
+
+	for offset := 0; ; offset += itemPageSize {
+		posts, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, offset, true)
+		if err != nil {
+			return fmt.Errorf("failed to list posts: %w", err)
+		}
+		if err := s.backupPosts(ctx, w, posts); err != nil {
+			return err
+		}
+		if len(posts) < itemPageSize {
+			break
+		}
+	}
+	err = forEachTrashPage(ctx, userID, s.db.ListTrashedPostMeta, func(p models.Post) (string, *time.Time) { return p.ID, p.DeletedAt }, func(posts []models.Post) error {
+		return s.backupPosts(ctx, w, posts)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up trashed posts: %w", err)
+	}
+
+	for offset := 0; ; offset += itemPageSize {
+		files, err := s.db.ListCodeFileMetaByUser(ctx, userID, itemPageSize, offset, true)
+		if err != nil {
+			return fmt.Errorf("failed to list code files: %w", err)
+		}
+		if err := s.backupCodeFiles(ctx, w, files); err != nil {
+			return err
+		}
+		if len(files) < itemPageSize {
+			break
+		}
+	}
+	err = forEachTrashPage(ctx, userID, s.db.ListTrashedCodeFileMeta, func(f models.CodeFile) (string, *time.Time) { return f.ID, f.DeletedAt }, func(files []models.CodeFile) error {
+		return s.backupCodeFiles(ctx, w, files)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up trashed code files: %w", err)
+	}
+
+	redirects, err := s.db.ListSlugRedirectsByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list slug redirects: %w", err)
+	}
+	if err := writeBackupRecords(w, backupSlugRedirects, redirects); err != nil {
+		return err
+	}
+
+	allDomains, err := s.db.ListDomainsByUser(domainsContext(ctx), userID)
+	if err != nil {
+		return fmt.Errorf("failed to list domains: %w", err)
+	}
+	var domains []models.Domain
+	for _, domain := range allDomains {
+		if domain.TenantID == tenant.ID(ctx) { // Another tenant may have a user of the same name
+			domains = append(domains, domain)
+		}
+	}
+	if err := writeBackupRecords(w, backupDomains, domains); err != nil {
+		return err
+	}
+
+	subs, err := s.db.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+	subRecords := make([]backupPushSubscription, len(subs))
+	for i, sub := range subs {
+		subRecords[i] = backupPushSubscription{PushSubscription: sub, P256dh: sub.P256dh, Auth: sub.Auth}
+	}
+	if err := writeBackupRecords(w, backupPushSubs, subRecords); err != nil {
+		return err
+	}
+
+	workspaces, err := s.db.ListWorkspacesByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	stored := workspaces[:0]
+	for _, ws := range workspaces {
+		if !ws.Default && ws.ID != "" { // The default workspace is implicit
+			stored = append(stored, ws)
+		}
+	}
+	if err := writeBackupRecords(w, backupWorkspaces, stored); err != nil {
+		return err
+	}
+
+	for offset := 0; ; offset += itemPageSize {
+		projects, err := s.db.ListProjectsByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list projects: %w", err)
+		}
+		if err := writeBackupRecords(w, backupProjects, projects); err != nil {
+			return err
+		}
+		if len(projects) < itemPageSize {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += itemPageSize {
+		assets, err := s.db.ListAssetsByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list assets: %w", err)
+		}
+		if err := s.backupAssets(ctx, w, assets); err != nil {
+			return err
+		}
+		if len(assets) < itemPageSize {
+			break
+		}
+	}
+
+	templates, err := s.db.ListTemplatesByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+	if err := writeBackupRecords(w, backupTemplates, templates); err != nil {
+		return err
+	}
+
+	for offset := 0; ; offset += itemPageSize {
+		bookmarks, err := s.db.ListBookmarksByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list bookmarks: %w", err)
+		}
+		if err := writeBackupRecords(w, backupBookmarks, bookmarks); err != nil {
+			return err
+		}
+		if len(bookmarks) < itemPageSize {
+			break
+		}
+	}
+
+	transfers, err := s.db.ListPendingTransfersByRecipient(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list transfers: %w", err)
+	}
+	return writeBackupRecords(w, backupTransfers, transfers)
+}
+
+// forEachTrashPage calls fn with each page of a user's trashed items, most recently
+// deleted first, until the trash is exhausted. Trash listings page by deletion time, so
+// each page starts at the last one's oldest deletion again, in case items deleted in the
+// same instant straddle the boundary; the repeats are dropped. A page holding nothing
+// new (more items deleted in one instant than fit it) is read again twice the size.
+func forEachTrashPage[T any](ctx context.Context, userID string, list func(context.Context, database.TrashQuery) ([]T, error), key func(T) (string, *time.Time), fn func([]T) error) error {
+	seen := make(map[string]bool)
+	q := database.TrashQuery{UserID: userID, Limit: itemPageSize}
+	for {
+		items, err := list(ctx, q)
+		if err != nil {
+			return err
+		}
+		var fresh []T
+		var oldest *time.Time
+		for _, item := range items {
+			id, deletedAt := key(item)
+			if deletedAt != nil {
+				oldest = deletedAt
+			}
+			if !seen[id] {
+				seen[id] = true
+				fresh = append(fresh, item)
+			}
+		}
+		if err := fn(fresh); err != nil {
+			return err
+		}
+		if len(items) < q.Limit || oldest == nil {
+			return nil
+		}
+		if len(fresh) == 0 {
+			q.Limit *= 2
+			continue
+		}
+		q.Limit = itemPageSize
+		q.DeletedBefore = oldest.Add(time.Microsecond)
+	}
+}
+
+func (s *Service) backupPosts(ctx context.Context, w *backupWriter, posts []models.Post) error {
+	records := make([]backupPost, len(posts))
+	for i, p := range posts {
+		records[i] = backupPost{Post: p, S3Path: p.S3Path, Version: p.Version}
+	}
+	if err := writeBackupRecords(w, backupPosts, records); err != nil {
+		return err
+	}
+	for _, p := range posts {
+		if err := s.backupObject(ctx, w, models.ItemTypePost, p.S3Path, true); err != nil {
+			return err
+		}
+		if p.PublishedVersion > 0 {
+			if err := s.backupObject(ctx, w, models.ItemTypePost, generatePublishedPath(p.ID), true); err != nil {
+				return err
+			}
+		}
+		if err := s.backupItem(ctx, w, p.ID, models.ItemTypePost, p.Version); err != nil {
+			return fmt.Errorf("failed to back up post %s: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) backupCodeFiles(ctx context.Context, w *backupWriter, files []models.CodeFile) error {
+	records := make([]backupCodeFile, len(files))
+	for i, f := range files {
+		records[i] = backupCodeFile{CodeFile: f, S3Path: f.S3Path, Version: f.Version}
+	}
+	if err := writeBackupRecords(w, backupCodeFiles, records); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := s.backupObject(ctx, w, models.ItemTypeCodeFile, f.S3Path, true); err != nil {
+			return err
+		}
+		if err := s.backupItem(ctx, w, f.ID, models.ItemTypeCodeFile, f.Version); err != nil {
+			return fmt.Errorf("failed to back up codefile %s: %w", f.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) backupAssets(ctx context.Context, w *backupWriter, assets []models.Asset) error {
+	records := make([]backupAsset, len(assets))
+	for i, a := range assets {
+		records[i] = backupAsset{Asset: a, S3Path: a.S3Path}
+	}
+	if err := writeBackupRecords(w, backupAssets, records); err != nil {
+		return err
+	}
+	for _, a := range assets {
+		if err := s.backupObject(ctx, w, backupAssetObjects, a.S3Path, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupItem writes the records attached to an item and the snapshot and version
+// objects of its history.
+func (s *Service) backupItem(ctx context.Context, w *backupWriter, itemID string, itemType models.ItemType, version int) error {
+	collaborators, err := s.db.ListCollaborators(ctx, itemID, string(itemType))
+	if err != nil {
+		return fmt.Errorf("failed to list collaborators: %w", err)
+	}
+	if err := writeBackupRecords(w, backupCollaborators, collaborators); err != nil {
+		return err
+	}
+	tags, err := s.db.ListVersionTags(ctx, itemID, string(itemType))
+	if err != nil {
+		return fmt.Errorf("failed to list version tags: %w", err)
+	}
+	if err := writeBackupRecords(w, backupVersionTags, tags); err != nil {
+		return err
+	}
+	results, err := s.db.ListHookResults(ctx, itemID, string(itemType))
+	if err != nil {
+		return fmt.Errorf("failed to list hook results: %w", err)
+	}
+	if err := writeBackupRecords(w, backupHookResults, results); err != nil {
+		return err
+	}
+	for offset := 0; ; offset += itemPageSize {
+		comments, err := s.db.ListComments(ctx, itemID, string(itemType), "", itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		records := make([]backupComment, len(comments))
+		for i, comment := range comments {
+			records[i] = backupComment{Comment: comment, ItemOwnerID: comment.ItemOwnerID}
+		}
+		if err := writeBackupRecords(w, backupComments, records); err != nil {
+			return err
+		}
+		if len(comments) < itemPageSize {
+			break
+		}
+	}
+
+	days, err := s.db.ListItemStats(ctx, itemID, string(itemType), backupStatsFrom, backupStatsTo)
+	if err != nil {
+		return fmt.Errorf("failed to list stats: %w", err)
+	}
+	stats := make([]backupStatsDay, len(days))
+	for i, day := range days {
+		stats[i] = backupStatsDay{ItemID: itemID, ItemType: string(itemType), ItemStatsDay: day}
+	}
+	if err := writeBackupRecords(w, backupItemStats, stats); err != nil {
+		return err
+	}
+
+	if err := s.backupHistory(ctx, w, itemID, itemType); err != nil {
+		return err
+	}
+	for after := 0; ; {
+		entries, err := s.db.ListJournal(ctx, itemID, string(itemType), after, backupHistoryPage)
+		if err != nil {
+			return fmt.Errorf("failed to list journal: %w", err)
+		}
+		if err := writeBackupRecords(w, backupJournal, entries); err != nil {
+			return err
+		}
+		if len(entries) < backupHistoryPage {
+			break
+		}
+		after = entries[len(entries)-1].Version
+	}
+
+	if s.cfg.Snapshot.RetainVersions {
+		for v := 1; v <= version; v++ {
+			if err := s.backupObject(ctx, w, itemType, generateVersionPath(itemID, itemType, v), false); err != nil {
+				return err
+			}
+			if err := s.backupObject(ctx, w, itemType, generateVersionDeltaPath(itemID, itemType, v), false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forEachHistoryPage calls fn with each page of an item's history, newest first, until
+// it is exhausted.
+func (s *Service) forEachHistoryPage(ctx context.Context, itemID string, itemType models.ItemType, fn func([]models.HistoryLog) error) error {
+	return s.pageHistory(func(until time.Time, limit int) ([]models.HistoryLog, error) {
+		return s.db.GetActionHistoryUntil(ctx, itemID, string(itemType), until, limit)
+	}, fn)
+}
+
+// pageHistory calls fn with each page of history entries list returns, newest first,
+// until they are exhausted. Like trash listings, pages overlap by the instant they meet
+// at, the repeats are dropped, and a page holding nothing new is read again twice the
+// size.
+func (s *Service) pageHistory(list func(until time.Time, limit int) ([]models.HistoryLog, error), fn func([]models.HistoryLog) error) error {
+	seen := make(map[string]bool)
+	until, limit := s.now().UTC(), backupHistoryPage
+	for {
+		history, err := list(until, limit)
+		if err != nil {
+			return fmt.Errorf("failed to load history: %w", err)
+		}
+		var fresh []models.HistoryLog
+		for _, entry := range history {
+			if !seen[entry.ID] {
+				seen[entry.ID] = true
+				fresh = append(fresh, entry)
+			}
+		}
+		if err := fn(fresh); err != nil {
+			return err
+		}
+		if len(history) < limit {
+			return nil
+		}
+		if len(fresh) == 0 {
+			limit *= 2
+			continue
+		}
+		limit = backupHistoryPage
+		until = history[len(history)-1].Timestamp
+	}
+}
+
+// backupHistory writes all of an item's history entries and the objects they refer to.
+func (s *Service) backupHistory(ctx context.Context, w *backupWriter, itemID string, itemType models.ItemType) error {
+	return s.forEachHistoryPage(ctx, itemID, itemType, func(history []models.HistoryLog) error {
+		entries := make([]backupHistoryLog, len(history))
+		for i, entry := range history {
+			entries[i] = backupHistoryLog{HistoryLog: entry, S3PathBefore: entry.S3PathBefore, S3PathAfter: entry.S3PathAfter}
+		}
+		if err := writeBackupRecords(w, backupHistory, entries); err != nil {
+			return err
+		}
+		for _, entry := range history {
+			// Paths before a delete or revert may have been overwritten since
+			if err := s.backupObject(ctx, w, itemType, entry.S3PathAfter, entry.Action == models.ActionSnapshot); err != nil {
+				return err
+			}
+			if err := s.backupObject(ctx, w, itemType, entry.S3PathBefore, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backupObject adds the storage object at key to the archive, once. If it doesn't exist
+// it is skipped, and counted as missing if required.
+func (s *Service) backupObject(ctx context.Context, w *backupWriter, itemType models.ItemType, key string, required bool) error {
+	if key == "" || w.objects[key] {
+		return nil
+	}
+	w.objects[key] = true
+
+	body, err := s.storage.DownloadFile(ctx, key)
+	if errors.Is(err, storage.ErrFileNotFound) {
+		if required {
+			slog.WarnContext(ctx, "Object missing from storage; leaving it out of the backup", "itemType", itemType, "key", key)
+			w.report.ObjectsMissing++
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	if err := w.writeFile("objects/"+string(itemType)+"/"+strings.TrimPrefix(key, "/"), data); err != nil {
+		return err
+	}
+	w.report.Objects++
+	return nil
+}
+
+// Restore reads a backup archive written by Backup into the database and storage,
+// keeping IDs, versions and timestamps. Records are moved to the tenant in ctx. The
+// database must have no users yet; the search index needs a reindex afterwards, and a
+// shared cache should be flushed.
+func (s *Service) Restore(ctx context.Context, in io.Reader) (*models.BackupReport, error) {
+	userIDs, err := s.db.ListUserIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	if len(userIDs) > 0 {
+		return nil, ErrRestoreTargetNotEmpty
+	}
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	report := &models.BackupReport{Records: make(map[string]int)}
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			if first {
+				return nil, fmt.Errorf("%w: archive is empty", ErrInvalidBackup)
+			}
+			return report, nil
+		}
+		if err != nil {
+			return report, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		switch {
+		case first:
+			var manifest backupManifest
+			if hdr.Name != "manifest.json" || json.NewDecoder(tr).Decode(&manifest) != nil {
+				return nil, fmt.Errorf("%w: no manifest", ErrInvalidBackup)
+			}
+			if manifest.FormatVersion != backupFormatVersion {
+				return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBackup, manifest.FormatVersion)
+			}
+			report.CreatedAt = manifest.CreatedAt
+		case strings.HasPrefix(hdr.Name, "db/"):
+			kind := path.Base(path.Dir(hdr.Name))
+			n, err := s.restoreRecords(ctx, kind, tr)
+			report.Records[kind] += n
+			if err != nil {
+				return report, fmt.Errorf("failed to restore %s: %w", kind, err)
+			}
+		case strings.HasPrefix(hdr.Name, "objects/"):
+			itemType, key, _ := strings.Cut(strings.TrimPrefix(hdr.Name, "objects/"), "/")
+			contentType := contentTypeFor(models.ItemType(itemType))
+			if models.ItemType(itemType) == backupAssetObjects {
+				contentType = "application/octet-stream"
+			}
+			if err := s.storage.UploadFile(ctx, key, tr, contentType); err != nil {
+				return report, fmt.Errorf("failed to restore object %s: %w", key, err)
+			}
+			report.Objects++
+		default:
+			slog.WarnContext(ctx, "Skipping unknown file in backup", "name", hdr.Name)
+		}
+	}
+}
+
+// restoreRecords restores the records of one file of kind and returns how many it
+// restored.
+func (s *Service) restoreRecords(ctx context.Context, kind string, r io.Reader) (int, error) {
+	tenantID := tenant.ID(ctx)
+	switch kind {
+	case backupUsers:
+		return decodeBackupRecords(r, func(rec *backupUser) error {
+			rec.User.PasswordHash, rec.User.TenantID = rec.PasswordHash, tenantID
+			return s.db.RestoreRecord(ctx, &rec.User)
+		})
+	case backupPosts:
+		return decodeBackupRecords(r, func(rec *backupPost) error {
+			rec.Post.S3Path, rec.Post.Version, rec.Post.TenantID = rec.S3Path, rec.Version, tenantID
+			return s.db.RestoreRecord(ctx, &rec.Post)
+		})
+	case backupCodeFiles:
+		return decodeBackupRecords(r, func(rec *backupCodeFile) error {
+			rec.CodeFile.S3Path, rec.CodeFile.Version, rec.CodeFile.TenantID = rec.S3Path, rec.Version, tenantID
+			return s.db.RestoreRecord(ctx, &rec.CodeFile)
+		})
+	case backupTransfers:
+		return decodeBackupRecords(r, func(rec *models.OwnershipTransfer) error { return s.db.RestoreRecord(ctx, rec) })
+	case backupWorkspaces:
+		return decodeBackupRecords(r, func(rec *models.Workspace) error { return s.db.RestoreRecord(ctx, rec) })
+	case backupTemplates:
+		return decodeBackupRecords(r, func(rec *models.Template) error { return s.db.RestoreRecord(ctx, rec) })
+	case backupProjects:
+		return decodeBackupRecords(r, func(rec *models.Project) error { return s.db.RestoreRecord(ctx, rec) })
+	case backupAssets:
+		return decodeBackupRecords(r, func(rec *backupAsset) error {
+			rec.Asset.S3Path, rec.Asset.TenantID = rec.S3Path, tenantID
+			return s.db.RestoreRecord(ctx, &rec.Asset)
+		})
+	case backupCollaborators:
+		return decodeBackupRecords(r, func(rec *models.Collaborator) error { return s.db.PutCollaborator(ctx, rec) })
+	case backupVersionTags:
+		return decodeBackupRecords(r, func(rec *models.VersionTag) error { return s.db.CreateVersionTag(ctx, rec) })
+	case backupHookResults:
+		return decodeBackupRecords(r, func(rec *models.HookResult) error { return s.db.SaveHookResult(ctx, rec) })
+	case backupBookmarks:
+		return decodeBackupRecords(r, func(rec *models.Bookmark) error { return s.db.AddBookmark(ctx, rec) })
+	case backupItemStats:
+		return decodeBackupRecords(r, func(rec *backupStatsDay) error {
+			return s.db.IncrementItemStats(ctx, rec.ItemID, rec.ItemType, rec.Day, rec.Views, rec.Edits)
+		})
+	case backupHistory:
+		return decodeBackupRecords(r, func(rec *backupHistoryLog) error {
+			rec.HistoryLog.S3PathBefore, rec.HistoryLog.S3PathAfter = rec.S3PathBefore, rec.S3PathAfter
+			_, err := s.db.LogAction(ctx, &rec.HistoryLog) // Keeps the entry's ID
+			return err
+		})
+	case backupJournal:
+		return decodeBackupRecords(r, func(rec *models.JournalEntry) error { return s.db.AppendJournal(ctx, rec) })
+	case backupSlugRedirects:
+		return decodeBackupRecords(r, func(rec *models.SlugRedirect) error { return s.db.PutSlugRedirect(ctx, rec) })
+	case backupComments:
+		return decodeBackupRecords(r, func(rec *backupComment) error {
+			rec.Comment.ItemOwnerID = rec.ItemOwnerID
+			return s.db.RestoreRecord(ctx, &rec.Comment)
+		})
+	case backupReports:
+		return decodeBackupRecords(r, func(rec *models.Report) error { return s.db.RestoreRecord(ctx, rec) })
+	case backupPushSubs:
+		return decodeBackupRecords(r, func(rec *backupPushSubscription) error {
+			rec.PushSubscription.P256dh, rec.PushSubscription.Auth = rec.P256dh, rec.Auth
+			return s.db.PutPushSubscription(ctx, &rec.PushSubscription)
+		})
+	case backupDomains:
+		return decodeBackupRecords(r, func(rec *models.Domain) error {
+			rec.TenantID = tenantID
+			err := s.db.CreateDomain(domainsContext(ctx), rec)
+			if errors.Is(err, database.ErrDuplicateDomain) {
+				// Domains live outside tenants, so the host may still be claimed, by anyone
+				slog.WarnContext(ctx, "Domain in backup is already claimed; leaving it out", "host", rec.Host, "userID", rec.UserID)
+				return nil
+			}
+			return err
+		})
+	}
+	return 0, fmt.Errorf("%w: unknown record kind %q", ErrInvalidBackup, kind)
+}
+
+// decodeBackupRecords calls fn with each record of a records file, stopping at the first
+// error, and returns how many records fn took.
+func decodeBackupRecords[T any](r io.Reader, fn func(*T) error) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var rec T
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		if err := fn(&rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,80 @@
+// internal/service/bookmarks.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+var ErrBookmarkNotFound = apperr.New(apperr.NotFound, "post is not bookmarked")
+
+// AddBookmark puts a published post on userID's reading list. Any signed-in user can
+// bookmark any published post; bookmarking it again is a no-op.
+func (s *Service) AddBookmark(ctx context.Context, userID, postID string) (*models.Bookmark, error) {
+	post, err := getItemMetaAs[*models.Post](ctx, s, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.PublishedVersion == 0 {
+		return nil, ErrNotPublished
+	}
+
+	bookmark := &models.Bookmark{UserID: userID, PostID: postID, CreatedAt: s.now().UTC()}
+	if err := s.db.AddBookmark(ctx, bookmark); err != nil {
+		slog.ErrorContext(ctx, "Error bookmarking post for user", "postID", postID, "userID", userID, "error", err)
+		return nil, errors.New("failed to save bookmark")
+	}
+	return bookmark, nil
+}
+
+// RemoveBookmark takes a post off userID's reading list.
+func (s *Service) RemoveBookmark(ctx context.Context, userID, postID string) error {
+	if err := s.db.DeleteBookmark(ctx, userID, postID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrBookmarkNotFound
+		}
+		slog.ErrorContext(ctx, "Error removing bookmark of post for user", "postID", postID, "userID", userID, "error", err)
+		return errors.New("failed to remove bookmark")
+	}
+	return nil
+}
+
+// ListBookmarks returns a page of userID's reading list, most recently bookmarked first.
+// Posts that were deleted or unpublished since are left out.
+func (s *Service) ListBookmarks(ctx context.Context, userID string, limit, offset int) ([]models.BookmarkedPost, error) {
+	bookmarks, err := s.db.ListBookmarksByUser(ctx, userID, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing bookmarks of user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list bookmarks")
+	}
+
+	posts := make([]models.BookmarkedPost, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		post, err := getItemMetaAs[*models.Post](ctx, s, bookmark.PostID)
+		if err != nil {
+			if !errors.Is(err, ErrItemNotFound) {
+				slog.WarnContext(ctx, "Failed to load bookmarked post", "postID", bookmark.PostID, "error", err)
+			}
+			continue
+		}
+		if post.PublishedVersion == 0 {
+			continue
+		}
+		posts = append(posts, models.BookmarkedPost{
+			PostID: bookmark.PostID, Title: post.Title, Slug: post.Slug, Excerpt: post.Excerpt,
+			Authors: postAuthors(post), PublishedAt: post.PublishedAt, BookmarkedAt: bookmark.CreatedAt,
+		})
+	}
+	return posts, nil
+}
+
+// deletePostBookmarks removes a post from every reading list, e.g. when it is purged.
+func (s *Service) deletePostBookmarks(ctx context.Context, postID string) {
+	if err := s.db.DeletePostBookmarks(ctx, postID); err != nil {
+		slog.WarnContext(ctx, "Failed to delete bookmarks of post", "postID", postID, "error", err)
+	}
+}
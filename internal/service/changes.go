@@ -0,0 +1,184 @@
+// internal/service/changes.go
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ChangeValidationError reports a change that doesn't fit the content it is applied to.
+// It wraps ErrApplyChange so existing errors.Is checks keep working.
+type ChangeValidationError struct {
+	Index  int    // Position of the offending change within the batch
+	Reason string // Human-readable description of what is out of bounds
+}
+
+func (e *ChangeValidationError) Error() string {
+	return fmt.Sprintf("invalid change at index %d: %s", e.Index, e.Reason)
+}
+
+func (e *ChangeValidationError) Unwrap() error { return ErrApplyChange }
+
+// lineBuffer holds content split into lines (without their '\n') so a change only
+// rewrites the lines it touches instead of rebuilding the whole document.
+type lineBuffer struct {
+	lines []string
+}
+
+func newLineBuffer(content string) *lineBuffer {
+	return &lineBuffer{lines: strings.Split(content, "\n")}
+}
+
+// clone returns a copy that can be edited without affecting b. Line strings are shared.
+func (b *lineBuffer) clone() *lineBuffer {
+	return &lineBuffer{lines: slices.Clone(b.lines)}
+}
+
+func (b *lineBuffer) String() string {
+	return strings.Join(b.lines, "\n")
+}
+
+// apply performs a single change. Line and Column are 0-based; Column and Removed count
+// characters (runes), and a removal may span line breaks (each '\n' counts as one).
+func (b *lineBuffer) apply(change models.Change) error {
+	if !utf8.ValidString(change.Text) {
+		return fmt.Errorf("text is not valid UTF-8")
+	}
+	if change.Line < 0 || change.Column < 0 {
+		return fmt.Errorf("position %d:%d is negative", change.Line, change.Column)
+	}
+	if change.Removed < 0 {
+		return fmt.Errorf("removed count %d is negative", change.Removed)
+	}
+	if change.Line >= len(b.lines) {
+		return fmt.Errorf("line %d is past the end of the content (%d lines)", change.Line, len(b.lines))
+	}
+
+	line := b.lines[change.Line]
+	start, ok := runeOffset(line, change.Column)
+	if !ok {
+		return fmt.Errorf("column %d is past the end of line %d (%d characters)", change.Column, change.Line, utf8.RuneCountInString(line))
+	}
+
+	// Find where the removal ends, skipping whole lines where possible
+	endLine, endOff, remaining := change.Line, start, change.Removed
+	for remaining > 0 {
+		rest := b.lines[endLine][endOff:]
+		n := utf8.RuneCountInString(rest)
+		if remaining <= n {
+			off, _ := runeOffset(rest, remaining)
+			endOff += off
+			break
+		}
+		if endLine+1 >= len(b.lines) {
+			return fmt.Errorf("removes %d characters past the end of the content", change.Removed)
+		}
+		remaining -= n + 1 // Rest of the line plus its '\n'
+		endLine, endOff = endLine+1, 0
+	}
+
+	merged := line[:start] + change.Text + b.lines[endLine][endOff:]
+	b.lines = slices.Replace(b.lines, change.Line, endLine+1, strings.Split(merged, "\n")...)
+	return nil
+}
+
+// runeOffset returns the byte offset of the n-th rune in s, or false if s is shorter.
+func runeOffset(s string, n int) (int, bool) {
+	off := 0
+	for i := 0; i < n; i++ {
+		if off >= len(s) {
+			return 0, false
+		}
+		_, size := utf8.DecodeRuneInString(s[off:])
+		off += size
+	}
+	return off, true
+}
+
+// applyChanges applies changes in order, each against the result of the previous one.
+// Any change that falls outside the current content is rejected with a
+// *ChangeValidationError rather than clamped.
+func applyChanges(content string, changes []models.Change) (string, error) {
+	buf := newLineBuffer(content)
+	if err := buf.applyAll(changes); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (b *lineBuffer) applyAll(changes []models.Change) error {
+	for i, change := range changes {
+		if err := b.apply(change); err != nil {
+			return &ChangeValidationError{Index: i, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// maxHotBuffers bounds how many recently edited documents are kept split into lines.
+const maxHotBuffers = 64
+
+// hotBufferCache keeps the line buffers of recently edited items in process so a stream
+// of small edits doesn't re-download and re-split the document for every batch. Entries
+// are keyed by version, so edits made by other replicas simply miss the cache.
+type hotBufferCache struct {
+	mu      sync.Mutex
+	order   *list.List               // Front is most recently used
+	entries map[string]*list.Element // Key: itemType:itemID
+}
+
+type hotBuffer struct {
+	key     string
+	version int
+	buf     *lineBuffer
+}
+
+func newHotBufferCache() *hotBufferCache {
+	return &hotBufferCache{order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns a private copy of the buffer for key if it is at the given version.
+func (c *hotBufferCache) get(key string, version int) (*lineBuffer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*hotBuffer)
+	if entry.version != version {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.buf.clone(), true
+}
+
+func (c *hotBufferCache) put(key string, version int, buf *lineBuffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = &hotBuffer{key: key, version: version, buf: buf}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&hotBuffer{key: key, version: version, buf: buf})
+	if c.order.Len() > maxHotBuffers {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*hotBuffer).key)
+	}
+}
+
+func (c *hotBufferCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+}
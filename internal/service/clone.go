@@ -0,0 +1,84 @@
+// internal/service/clone.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// CloneItem copies a post or code file into a new item owned by userID. The copy
+// gets its own storage key, starts at version 1 with a fresh "create" history entry, and
+// is named newName (or "<name> (copy)" / "<base>-copy.<ext>" when empty).
+// Anyone who can view the source may clone it. It returns the new *models.Post or
+// *models.CodeFile.
+func (s *Service) CloneItem(ctx context.Context, userID, itemID, itemTypeStr, newName string) (models.ItemMeta, error) {
+	// 1. Read current content (checks type, existence and access)
+	content, _, err := s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, models.ItemType(itemTypeStr))
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Create the copy through the regular create path (quota, history, caching),
+	// then place it next to the source if the source is the user's own
+	switch src := meta.(type) {
+	case *models.Post:
+		if newName == "" {
+			newName = src.Title + " (copy)"
+		}
+		post, err := s.CreatePost(ctx, userID, newName, "", content)
+		if err != nil {
+			return nil, err
+		}
+		if src.WorkspaceID != "" && src.UserID == userID {
+			if err := s.db.SetPostWorkspace(ctx, post.ID, src.WorkspaceID); err != nil {
+				slog.WarnContext(ctx, "Failed to move clone to workspace", "postID", post.ID, "workspaceID", src.WorkspaceID, "error", err)
+			} else {
+				post.WorkspaceID = src.WorkspaceID
+			}
+		}
+		_ = s.cache.DeleteItemMeta(ctx, post.ID, models.ItemTypePost)
+		return post, nil
+	case *models.CodeFile:
+		if newName == "" {
+			newName = copyFileName(codeFilePath(src))
+		}
+		file, err := s.CreateCodeFile(ctx, userID, newName, src.Language, content)
+		if err != nil {
+			return nil, err
+		}
+		if src.WorkspaceID != "" && src.UserID == userID {
+			if err := s.db.SetCodeFileWorkspace(ctx, file.ID, src.WorkspaceID); err != nil {
+				slog.WarnContext(ctx, "Failed to move clone to workspace", "fileID", file.ID, "workspaceID", src.WorkspaceID, "error", err)
+			} else {
+				file.WorkspaceID = src.WorkspaceID
+			}
+		}
+		if src.ProjectID != "" && src.UserID == userID {
+			if err := s.db.SetCodeFileProject(ctx, file.ID, src.ProjectID); err != nil {
+				slog.WarnContext(ctx, "Failed to move clone to project", "fileID", file.ID, "projectID", src.ProjectID, "error", err)
+			} else {
+				file.ProjectID = src.ProjectID
+			}
+		}
+		_ = s.cache.DeleteItemMeta(ctx, file.ID, models.ItemTypeCodeFile)
+		return file, nil
+	}
+	return nil, ErrInvalidItemType
+}
+
+// copyFileName derives a name for a copied file, keeping the extension: src/main.go -> src/main-copy.go.
+func copyFileName(fileName string) string {
+	ext := path.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	if base == "" || strings.HasSuffix(base, "/") { // Dotfiles such as ".env"
+		return fileName + "-copy"
+	}
+	return base + "-copy" + ext
+}
@@ -0,0 +1,95 @@
+// internal/service/codefiles.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/langdetect"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// ErrInvalidPath is returned for code file paths that are empty or escape the project root.
+var ErrInvalidPath = apperr.New(apperr.Validation, "invalid file path")
+
+// maxPathLength bounds the length of a code file path in bytes.
+const maxPathLength = 1024
+
+// normalizeCodePath cleans a project-relative path such as "src/main.go". Backslashes
+// are treated as separators and a leading slash is dropped; ".." elements are rejected.
+func normalizeCodePath(p string) (string, error) {
+	p = strings.TrimSpace(strings.ReplaceAll(p, "\\", "/"))
+	if len(p) > maxPathLength {
+		return "", ErrInvalidPath
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "", ErrInvalidPath
+	}
+	return p, nil
+}
+
+// codeFilePath returns the file's path, falling back to FileName for files created
+// before paths were stored.
+func codeFilePath(file *models.CodeFile) string {
+	if file.Path != "" {
+		return file.Path
+	}
+	return file.FileName
+}
+
+// RenameCodeFile renames or moves a code file to newPath. The content and version are
+// unchanged; the rename is recorded in the item's history.
+func (s *Service) RenameCodeFile(ctx context.Context, userID, fileID, newPath string) (*models.CodeFile, error) {
+	filePath, err := normalizeCodePath(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Get Metadata (checks existence and access)
+	cached, err := getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+	if err != nil {
+		return nil, err
+	}
+	file := *cached // Copy; the cached value must not be modified
+	if err := s.authorizeItem(ctx, userID, file.UserID, fileID, models.ItemTypeCodeFile, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	oldPath := codeFilePath(&file)
+	if oldPath == filePath && file.Path != "" {
+		return &file, nil // Nothing to do
+	}
+
+	// 2. Update Metadata. A language that was unset or implied by the old name follows
+	// the new name; one the user chose is kept.
+	if newLanguage := langdetect.FromFileName(filePath); newLanguage != "" &&
+		(file.Language == "" || file.Language == langdetect.FromFileName(oldPath)) {
+		file.Language = newLanguage
+	}
+	file.FileName, file.Path = path.Base(filePath), filePath
+	if err := s.db.RenameCodeFile(ctx, fileID, file.FileName, file.Path, file.Language); err != nil {
+		slog.ErrorContext(ctx, "Error renaming codefile", "fileID", fileID, "error", err)
+		return nil, mapDBError(err, models.ItemTypeCodeFile, fileID)
+	}
+	file.UpdatedAt = s.now().UTC()
+
+	// 3. Log Action History (Rename)
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: fileID, ItemType: string(models.ItemTypeCodeFile),
+		Action: models.ActionRename, Timestamp: file.UpdatedAt, ItemVersion: file.Version,
+		PathBefore: oldPath, PathAfter: filePath,
+	}
+	s.logAction(ctx, historyLog)
+
+	// 4. Invalidate Cache
+	_ = s.cache.DeleteItemMeta(ctx, fileID, models.ItemTypeCodeFile)
+	s.queueSearchUpdate(ctx, fileID, models.ItemTypeCodeFile)
+	return &file, nil
+}
@@ -0,0 +1,180 @@
+// internal/service/collaborators.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+var (
+	ErrInvalidRole          = apperr.New(apperr.Validation, "role must be \"editor\" or \"viewer\"")
+	ErrCollaboratorNotFound = apperr.New(apperr.NotFound, "collaborator not found")
+	ErrUserNotFound         = apperr.New(apperr.NotFound, "user not found")
+)
+
+// itemRole returns userID's role on an item: owner, the stored collaborator role, or
+// "" if the user has no access.
+func (s *Service) itemRole(ctx context.Context, userID, ownerUserID, itemID string, itemType models.ItemType) (models.Role, error) {
+	if userID == "" {
+		return "", nil
+	}
+	if userID == ownerUserID {
+		return models.RoleOwner, nil
+	}
+	collab, err := s.db.GetCollaborator(ctx, itemID, string(itemType), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return "", nil
+		}
+		slog.ErrorContext(ctx, "Error looking up collaborator", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return "", errors.New("failed to check item permissions")
+	}
+	return collab.Role, nil
+}
+
+// authorizeItem returns ErrPermissionDenied unless userID's role on the item includes required.
+func (s *Service) authorizeItem(ctx context.Context, userID, ownerUserID, itemID string, itemType models.ItemType, required models.Role) error {
+	role, err := s.itemRole(ctx, userID, ownerUserID, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	if !role.Includes(required) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// CheckItemAccess returns nil if userID has at least the required role on the item.
+func (s *Service) CheckItemAccess(ctx context.Context, userID, itemID, itemTypeStr string, required models.Role) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	return s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, required)
+}
+
+// ListCollaborators returns everyone with access to an item, starting with its owner.
+// Any user with access may list them.
+func (s *Service) ListCollaborators(ctx context.Context, userID, itemID, itemTypeStr string) ([]models.Collaborator, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	ownerUserID := meta.GetUserID()
+	if err := s.authorizeItem(ctx, userID, ownerUserID, itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	collabs, err := s.db.ListCollaborators(ctx, itemID, itemTypeStr)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing collaborators", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to list collaborators")
+	}
+	owner := models.Collaborator{ItemID: itemID, ItemType: itemTypeStr, UserID: ownerUserID, Role: models.RoleOwner}
+	return append([]models.Collaborator{owner}, collabs...), nil
+}
+
+// SetCollaborator grants collaboratorID the given role (editor or viewer) on an item, or
+// changes their existing role. Only the owner can manage collaborators. Demoting a
+// co-author of a post to viewer removes their credit.
+func (s *Service) SetCollaborator(ctx context.Context, userID, itemID, itemTypeStr, collaboratorID string, role models.Role) (*models.Collaborator, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	if role != models.RoleEditor && role != models.RoleViewer {
+		return nil, ErrInvalidRole
+	}
+
+	// 1. Only the owner may share, and not with themselves
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	ownerUserID := meta.GetUserID()
+	if ownerUserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if collaboratorID == ownerUserID {
+		return nil, ErrInvalidRole // The owner's role can't be changed
+	}
+
+	// 2. The collaborator must be a registered user
+	if _, err := s.db.GetUserByUsername(ctx, collaboratorID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error looking up user", "collaboratorID", collaboratorID, "error", err)
+		return nil, errors.New("failed to look up user")
+	}
+
+	// 3. Store
+	collab := &models.Collaborator{ItemID: itemID, ItemType: itemTypeStr, UserID: collaboratorID, Role: role, AddedBy: userID}
+	if existing, err := s.db.GetCollaborator(ctx, itemID, itemTypeStr, collaboratorID); err == nil {
+		collab.CreatedAt = existing.CreatedAt // Keep when they were first added
+	}
+	if err := s.db.PutCollaborator(ctx, collab); err != nil {
+		slog.ErrorContext(ctx, "Error saving collaborator", "collaboratorID", collaboratorID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to save collaborator")
+	}
+	if role != models.RoleEditor {
+		s.dropCoAuthor(ctx, userID, itemID, itemType, collaboratorID)
+	}
+	s.notify(ctx, collaboratorID, models.Notification{
+		Type: models.NotifyShare, Title: userID + " shared a " + itemNoun(itemType) + " with you (" + string(role) + ")",
+		ItemID: itemID, ItemType: itemType, ActorID: userID, Tag: "share:" + itemID,
+	})
+	return collab, nil
+}
+
+// RemoveCollaborator revokes collaboratorID's access to an item, and their co-author
+// credit if it is a post. The owner can remove anyone; collaborators can remove themselves.
+func (s *Service) RemoveCollaborator(ctx context.Context, userID, itemID, itemTypeStr, collaboratorID string) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	if meta.GetUserID() != userID && collaboratorID != userID {
+		return ErrPermissionDenied
+	}
+
+	if err := s.db.DeleteCollaborator(ctx, itemID, itemTypeStr, collaboratorID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrCollaboratorNotFound
+		}
+		slog.ErrorContext(ctx, "Error removing collaborator", "collaboratorID", collaboratorID, "itemType", itemType, "itemID", itemID, "error", err)
+		return errors.New("failed to remove collaborator")
+	}
+	s.dropCoAuthor(ctx, userID, itemID, itemType, collaboratorID)
+	return nil
+}
+
+// deleteCollaborators removes all sharing entries of an item, e.g. when it is purged.
+func (s *Service) deleteCollaborators(ctx context.Context, itemID string, itemType models.ItemType) {
+	collabs, err := s.db.ListCollaborators(ctx, itemID, string(itemType))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to list collaborators for cleanup", "itemType", itemType, "itemID", itemID, "error", err)
+		return
+	}
+	for _, collab := range collabs {
+		if err := s.db.DeleteCollaborator(ctx, itemID, string(itemType), collab.UserID); err != nil && !errors.Is(err, database.ErrNotFound) {
+			slog.WarnContext(ctx, "Failed to delete collaborator", "userID", collab.UserID, "itemType", itemType, "itemID", itemID, "error", err)
+		}
+	}
+}
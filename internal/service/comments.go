@@ -0,0 +1,339 @@
+// internal/service/comments.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/spam"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Users with access to an item can comment on it, and any signed-in user on a published
+// post. Writing @username in a comment mentions that user: if they are the item's owner
+// or one of its collaborators they are notified, and the mention is kept with the comment
+// for clients to link. Readers of a published post can't be mentioned, so a comment can't
+// notify arbitrary users. Comments.Rate and Comments.MentionRate bound how many comments a
+// user posts and how many users they mention an hour.
+//
+// Depending on Comments.Moderation, comments wait for the item's owner to approve them,
+// as do comments with many links and, if the spam checker can't be reached, comments it
+// would have checked. Comments it flags are kept as spam. Only approved comments are
+// listed and notify the users they mention.
+//
+// A comment may be anchored to a selection of the item's content, for inline review; see
+// anchors.go for how anchors follow the content as it is edited.
+
+const (
+	maxCommentLength   = 5000 // Characters
+	maxCommentMentions = 10   // Users notified per comment; further mentions are plain text
+	maxMentionExcerpt  = 200  // Characters of the comment a mention notification shows
+)
+
+var (
+	ErrCommentNotFound      = apperr.New(apperr.NotFound, "comment not found")
+	ErrInvalidComment       = apperr.New(apperr.Validation, "comment must be 1 to 5000 characters")
+	ErrInvalidCommentStatus = apperr.New(apperr.Validation, "comment status must be \"pending\", \"approved\" or \"spam\"")
+	ErrTooManyComments      = apperr.New(apperr.RateLimited, "too many comments, try again later")
+)
+
+// mentionPattern matches @username where the @ doesn't follow a word character, so email
+// addresses aren't mentions. Group 1 is the @username.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])(@[\p{L}\p{N}_][\p{L}\p{N}_.\-]*)`)
+
+// UseSpamChecker checks new comments with c from then on.
+func (s *Service) UseSpamChecker(c spam.Checker) {
+	s.spam = c
+}
+
+// authorizeComments returns ErrPermissionDenied unless userID may read and write an
+// item's comments: anyone with access to it, or any signed-in user if it is a published
+// post.
+func (s *Service) authorizeComments(ctx context.Context, userID, itemID string, itemType models.ItemType, meta models.ItemMeta) error {
+	if userID == "" {
+		return ErrPermissionDenied
+	}
+	if post, ok := meta.(*models.Post); ok && post.PublishedVersion > 0 {
+		return nil
+	}
+	return s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer)
+}
+
+// commentItem loads the item a comment call is about and checks userID may comment on it.
+func (s *Service) commentItem(ctx context.Context, userID, itemID, itemTypeStr string) (models.ItemType, models.ItemMeta, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return "", nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType) // Skips trashed items
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.authorizeComments(ctx, userID, itemID, itemType, meta); err != nil {
+		return "", nil, err
+	}
+	return itemType, meta, nil
+}
+
+// AddComment posts a comment by userID on an item, anchored to a selection of its content
+// if req has an anchor. Unless it is held for moderation, the users it mentions are
+// notified. userIP and userAgent are for the spam checker.
+func (s *Service) AddComment(ctx context.Context, userID, itemID, itemTypeStr string, req *models.CommentRequest, userIP, userAgent string) (*models.Comment, error) {
+	body := strings.TrimSpace(req.Body)
+	if body == "" || utf8.RuneCountInString(body) > maxCommentLength {
+		return nil, ErrInvalidComment
+	}
+	itemType, meta, err := s.commentItem(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	if !s.allowUserAction(ctx, "comment", userID, s.cfg.Comments.Rate) {
+		return nil, ErrTooManyComments
+	}
+
+	comment := &models.Comment{
+		ItemID: itemID, ItemType: string(itemType), ItemOwnerID: meta.GetUserID(), UserID: userID, Body: body,
+		Mentions: s.resolveMentions(ctx, userID, body, itemID, itemType, meta),
+	}
+	if req.Anchor != nil {
+		if comment.Anchor, err = s.newCommentAnchor(ctx, userID, itemID, itemType, meta, req.Anchor); err != nil {
+			return nil, err
+		}
+	}
+	if comment.Status, err = s.commentStatus(ctx, comment, userIP, userAgent); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.CreateComment(ctx, comment); err != nil {
+		slog.ErrorContext(ctx, "Error creating comment", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to create comment")
+	}
+	if comment.Status == models.CommentApproved {
+		s.notifyMentions(ctx, comment, meta)
+	}
+	return comment, nil
+}
+
+// commentStatus decides whether a new comment is approved, held for moderation or spam.
+// The item's owner's comments are always approved.
+func (s *Service) commentStatus(ctx context.Context, comment *models.Comment, userIP, userAgent string) (models.CommentStatus, error) {
+	if comment.UserID == comment.ItemOwnerID {
+		return models.CommentApproved, nil
+	}
+	status := models.CommentApproved
+	switch s.cfg.Comments.Moderation {
+	case "all":
+		status = models.CommentPending
+	case "others":
+		role, err := s.itemRole(ctx, comment.UserID, comment.ItemOwnerID, comment.ItemID, models.ItemType(comment.ItemType))
+		if err != nil {
+			return "", err
+		}
+		if role == "" {
+			status = models.CommentPending
+		}
+	}
+	if maxLinks := s.cfg.Comments.MaxLinks; maxLinks > 0 && countLinks(comment.Body) > maxLinks {
+		status = models.CommentPending
+	}
+
+	if s.spam != nil {
+		isSpam, err := s.spam.IsSpam(ctx, &spam.Submission{
+			Type: "comment", Content: comment.Body, AuthorID: comment.UserID, UserIP: userIP, UserAgent: userAgent,
+		})
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "Spam check failed, holding comment for moderation", "itemType", comment.ItemType, "itemID", comment.ItemID, "error", err)
+			status = models.CommentPending
+		case isSpam:
+			status = models.CommentSpam
+		}
+	}
+	return status, nil
+}
+
+// countLinks counts the web addresses in a comment.
+func countLinks(body string) int {
+	lower := strings.ToLower(body)
+	return strings.Count(lower, "http://") + strings.Count(lower, "https://")
+}
+
+// notifyMentions tells the users an approved comment mentions about it.
+func (s *Service) notifyMentions(ctx context.Context, comment *models.Comment, meta models.ItemMeta) {
+	excerpt := comment.Body
+	if utf8.RuneCountInString(excerpt) > maxMentionExcerpt {
+		excerpt = string([]rune(excerpt)[:maxMentionExcerpt-1]) + "…"
+	}
+	for _, m := range comment.Mentions {
+		s.notify(ctx, m.UserID, models.Notification{
+			Type: models.NotifyMention, Title: comment.UserID + " mentioned you on " + meta.Label(), Body: excerpt,
+			ItemID: comment.ItemID, ItemType: models.ItemType(comment.ItemType), ActorID: comment.UserID, Tag: "comment:" + comment.ID,
+		})
+	}
+}
+
+// resolveMentions finds the @usernames in body, by userID, that name the item's owner or
+// collaborators, up to maxCommentMentions distinct users and as many as userID's mention
+// rate allows. Others stay plain text.
+func (s *Service) resolveMentions(ctx context.Context, userID, body, itemID string, itemType models.ItemType, meta models.ItemMeta) []models.Mention {
+	var mentions []models.Mention
+	checked := make(map[string]bool)
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		start, end := loc[2], loc[3]
+		// A mention at the end of a sentence doesn't take the full stop
+		username := strings.TrimRight(body[start+1:end], ".-")
+		if username == "" {
+			continue
+		}
+		end = start + 1 + len(username)
+		ok, seen := checked[username]
+		if !seen {
+			if len(checked) == maxCommentMentions {
+				break
+			}
+			ok = s.canBeMentioned(ctx, username, itemID, itemType, meta)
+			if ok && !s.allowUserAction(ctx, "mention", userID, s.cfg.Comments.MentionRate) {
+				slog.InfoContext(ctx, "Mention rate exceeded, leaving mention as text", "userID", userID, "username", username)
+				ok = false
+			}
+			checked[username] = ok
+		}
+		if ok {
+			mentions = append(mentions, models.Mention{
+				UserID: username,
+				Offset: utf8.RuneCountInString(body[:start]),
+				Length: utf8.RuneCountInString(body[start:end]),
+			})
+		}
+	}
+	return mentions
+}
+
+// canBeMentioned reports whether username is the item's owner or one of its
+// collaborators. Anyone else who can read a published post's comments isn't: mentions
+// would let any signed-in user notify any other.
+func (s *Service) canBeMentioned(ctx context.Context, username, itemID string, itemType models.ItemType, meta models.ItemMeta) bool {
+	user, err := s.getUserWithCache(ctx, username)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			slog.WarnContext(ctx, "Failed to look up mentioned user", "username", username, "error", err)
+		}
+		return false
+	}
+	role, err := s.itemRole(ctx, user.ID, meta.GetUserID(), itemID, itemType)
+	return err == nil && role != ""
+}
+
+// ListComments returns a page of an item's approved comments, oldest first.
+func (s *Service) ListComments(ctx context.Context, userID, itemID, itemTypeStr string, limit, offset int) ([]models.Comment, error) {
+	itemType, _, err := s.commentItem(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.db.ListComments(ctx, itemID, string(itemType), models.CommentApproved, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing comments", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to list comments")
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	return comments, nil
+}
+
+// DeleteComment removes a comment. Its author and the item's owner may delete it.
+func (s *Service) DeleteComment(ctx context.Context, userID, itemID, itemTypeStr, commentID string) error {
+	itemType, meta, err := s.commentItem(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return err
+	}
+	comment, err := s.db.GetComment(ctx, itemID, string(itemType), commentID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return errors.New("failed to delete comment")
+	}
+	if comment.UserID != userID && meta.GetUserID() != userID {
+		return ErrPermissionDenied
+	}
+	if err := s.db.DeleteComment(ctx, itemID, string(itemType), commentID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrCommentNotFound
+		}
+		slog.ErrorContext(ctx, "Error deleting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return errors.New("failed to delete comment")
+	}
+	return nil
+}
+
+// ListModerationQueue returns a page of the comments on userID's items that have status,
+// pending or spam, newest first.
+func (s *Service) ListModerationQueue(ctx context.Context, userID string, status models.CommentStatus, limit, offset int) ([]models.Comment, error) {
+	if status != models.CommentPending && status != models.CommentSpam {
+		return nil, ErrInvalidCommentStatus
+	}
+	comments, err := s.db.ListCommentsByOwner(ctx, userID, status, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing comments for moderation", "userID", userID, "status", status, "error", err)
+		return nil, errors.New("failed to list comments")
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+	return comments, nil
+}
+
+// ModerateComment sets the status of a comment on one of userID's items: approving it
+// shows it and notifies the users it mentions, if it hadn't been approved before.
+func (s *Service) ModerateComment(ctx context.Context, userID, itemID, itemTypeStr, commentID string, status models.CommentStatus) (*models.Comment, error) {
+	if !status.IsValid() {
+		return nil, ErrInvalidCommentStatus
+	}
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleOwner); err != nil {
+		return nil, err
+	}
+	comment, err := s.db.GetComment(ctx, itemID, string(itemType), commentID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting comment", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to moderate comment")
+	}
+	if comment.Status.Is(status) {
+		return comment, nil
+	}
+	if err := s.db.SetCommentStatus(ctx, itemID, string(itemType), commentID, status); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		slog.ErrorContext(ctx, "Error setting comment status", "commentID", commentID, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to moderate comment")
+	}
+	comment.Status = status
+	if status == models.CommentApproved {
+		s.notifyMentions(ctx, comment, meta)
+	}
+	return comment, nil
+}
+
+// deleteComments removes all comments on an item, e.g. when it is purged.
+func (s *Service) deleteComments(ctx context.Context, itemID string, itemType models.ItemType) {
+	if err := s.db.DeleteComments(ctx, itemID, string(itemType)); err != nil {
+		slog.WarnContext(ctx, "Failed to delete comments", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+// internal/service/cover.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+)
+
+var ErrInvalidCoverImage = apperr.New(apperr.Validation, "cover image must be an image asset of the post's owner")
+
+// sharedCoverPathSuffix follows a share link's path to serve the post's cover image.
+const sharedCoverPathSuffix = "/cover"
+
+// SetPostCoverImage sets a post's cover image to one of the owner's image assets, or
+// removes it when assetID is empty. Requires editor access; an editor can only pick from
+// the owner's assets, since the cover is served along with the owner's post.
+func (s *Service) SetPostCoverImage(ctx context.Context, userID, postID, assetID string) (*models.Post, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if assetID != "" {
+		if _, err := s.coverImageAsset(ctx, post.UserID, assetID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.SetPostCoverImage(ctx, postID, assetID); err != nil {
+		slog.ErrorContext(ctx, "Error setting cover image of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+
+	updated := *post // Copy; the cached value must not be modified
+	updated.CoverImage = assetID
+	s.notifyPostSettings(ctx, userID, &updated)
+	return &updated, nil
+}
+
+// coverImageAsset loads assetID and checks that it can be a cover image of ownerID's
+// posts: an image they own.
+func (s *Service) coverImageAsset(ctx context.Context, ownerID, assetID string) (*models.Asset, error) {
+	asset, err := s.db.GetAssetByID(ctx, assetID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidCoverImage
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting asset", "assetID", assetID, "error", err)
+		return nil, errors.New("failed to get asset")
+	}
+	if asset.UserID != ownerID || !strings.HasPrefix(asset.ContentType, "image/") {
+		return nil, ErrInvalidCoverImage
+	}
+	return asset, nil
+}
+
+// GetSharedCoverImage returns the cover image of the post a share link points to. A
+// cover whose asset has since been deleted is reported as ErrAssetNotFound.
+func (s *Service) GetSharedCoverImage(ctx context.Context, token string) (*ItemDownload, error) {
+	claims, err := s.ResolveShareToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if models.ItemType(claims.ItemType) != models.ItemTypePost {
+		return nil, ErrAssetNotFound
+	}
+	post, err := getItemMetaAs[*models.Post](ctx, s, claims.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if post.CoverImage == "" {
+		return nil, ErrAssetNotFound
+	}
+	// Read on behalf of the owner; ResolveShareToken verified they still own the post
+	download, err := s.DownloadAsset(ctx, post.UserID, post.CoverImage)
+	if errors.Is(err, ErrPermissionDenied) {
+		return nil, ErrAssetNotFound // The asset stayed with a previous owner
+	}
+	return download, err
+}
@@ -0,0 +1,578 @@
+// internal/service/dataexport.go
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/audit"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"io"
+	"log/slog"
+	"path"
+	"time"
+)
+
+// A data export is a zip archive of everything stored about a user, for them to
+// download (the right of access). It is built by a job and kept in storage, next to a
+// status object, until Config.DataExport.Retention passes. It holds:
+//
+//	manifest.json              dataExportManifest
+//	profile.json               the user's account (without the password hash)
+//	<kind>.json                records of one kind, as a JSON array (dataExport* kinds)
+//	content/posts/<id>.md      a post's draft; <id>.published.md its published content
+//	content/codefiles/<id>/<fileName>
+//	content/assets/<id>/<fileName>
+//
+// History holds every entry of the user's items and the entries they wrote on other
+// users' items. Audit events are the user's own entries among them, in the form the
+// audit export sends them. Logins and other authentication events aren't stored by the
+// server; only the configured audit sinks have them.
+const dataExportFormatVersion = 1
+
+// Kinds of record in a data export, named after their files in the archive
+const (
+	dataExportPosts       = "posts"
+	dataExportCodeFiles   = "codefiles"
+	dataExportWorkspaces  = "workspaces"
+	dataExportProjects    = "projects"
+	dataExportAssets      = "assets"
+	dataExportTemplates   = "templates"
+	dataExportBookmarks   = "bookmarks"
+	dataExportDomains     = "domains"
+	dataExportPush        = "push_subscriptions"
+	dataExportComments    = "comments"
+	dataExportReports     = "reports"
+	dataExportTransfers   = "transfers"
+	dataExportShareLinks  = "share_links"
+	dataExportUsage       = "usage"
+	dataExportHistory     = "history"
+	dataExportAuditEvents = "audit_events"
+)
+
+const dataExportStaleAfter = 24 * time.Hour // A pending export this old is assumed lost and requested again
+
+var (
+	ErrDataExportNotReady    = apperr.New(apperr.NotFound, "data export is not ready")
+	ErrDataExportUnavailable = apperr.New(apperr.Unavailable, "data exports are unavailable without the job queue")
+)
+
+type dataExportManifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	UserID        string    `json:"userId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// dataExportJob is the payload of the data export jobs. RequestedAt
+// tells a job whether its export has been superseded.
+type dataExportJob struct {
+	UserID      string    `json:"userId"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// dataExportPath returns the storage key of a user's export archive.
+func dataExportPath(userID string) string {
+	return fmt.Sprintf("data-exports/%s/export.zip", userID)
+}
+
+// dataExportStatusPath returns the storage key of a user's export status.
+func dataExportStatusPath(userID string) string {
+	return fmt.Sprintf("data-exports/%s/status.json", userID)
+}
+
+// GetDataExport returns the state of userID's data export, requesting one first unless
+// there is one pending or ready to download.
+func (s *Service) GetDataExport(ctx context.Context, userID string) (*models.DataExport, error) {
+	export, err := s.dataExportStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	switch {
+	case export == nil, export.Status == models.DataExportFailed:
+	case export.Status == models.DataExportReady && export.ExpiresAt != nil && now.After(*export.ExpiresAt):
+	case export.Status == models.DataExportPending && now.Sub(export.RequestedAt) > dataExportStaleAfter:
+	default:
+		return export, nil
+	}
+	return s.RequestDataExport(ctx, userID)
+}
+
+// RequestDataExport queues a new export of userID's data, replacing the previous one. An
+// export already pending is returned as it is.
+func (s *Service) RequestDataExport(ctx context.Context, userID string) (*models.DataExport, error) {
+	if s.jobs == nil {
+		return nil, ErrDataExportUnavailable
+	}
+	current, err := s.dataExportStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Status == models.DataExportPending && s.now().Sub(current.RequestedAt) <= dataExportStaleAfter {
+		return current, nil
+	}
+
+	export := &models.DataExport{Status: models.DataExportPending, RequestedAt: s.now().UTC()}
+	if err := s.saveDataExportStatus(ctx, userID, export); err != nil {
+		return nil, err
+	}
+	payload := dataExportJob{UserID: userID, RequestedAt: export.RequestedAt}
+	jobID := fmt.Sprintf("data-export:%s:%d", userID, export.RequestedAt.UnixNano())
+	if err := s.enqueueJob(ctx, jobBuildDataExport, payload, jobs.WithID(jobID)); err != nil {
+		slog.ErrorContext(ctx, "Error queueing data export", "userID", userID, "error", err)
+		return nil, errors.New("failed to request data export")
+	}
+	slog.InfoContext(ctx, "Data export requested", "userID", userID)
+	return export, nil
+}
+
+// OpenDataExport returns userID's export archive for download, or ErrDataExportNotReady
+// if none has been built (or it expired). The caller closes the reader.
+func (s *Service) OpenDataExport(ctx context.Context, userID string) (io.ReadCloser, *models.DataExport, error) {
+	export, err := s.dataExportStatus(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export == nil || export.Status != models.DataExportReady || s.now().After(*export.ExpiresAt) {
+		return nil, nil, ErrDataExportNotReady
+	}
+	reader, err := s.storage.DownloadFile(ctx, dataExportPath(userID))
+	if errors.Is(err, storage.ErrFileNotFound) {
+		return nil, nil, ErrDataExportNotReady
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error opening data export", "userID", userID, "error", err)
+		return nil, nil, errors.New("failed to retrieve data export")
+	}
+	return reader, export, nil
+}
+
+// dataExportStatus loads the status of userID's export, nil if there is none.
+func (s *Service) dataExportStatus(ctx context.Context, userID string) (*models.DataExport, error) {
+	data, err := s.downloadContent(ctx, dataExportStatusPath(userID))
+	if errors.Is(err, storage.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading data export status", "userID", userID, "error", err)
+		return nil, errors.New("failed to load data export")
+	}
+	var export models.DataExport
+	if err := json.Unmarshal([]byte(data), &export); err != nil {
+		slog.ErrorContext(ctx, "Invalid data export status", "userID", userID, "error", err)
+		return nil, nil // Start over
+	}
+	return &export, nil
+}
+
+func (s *Service) saveDataExportStatus(ctx context.Context, userID string, export *models.DataExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode data export status: %w", err)
+	}
+	if err := s.storage.UploadFile(ctx, dataExportStatusPath(userID), bytes.NewReader(data), "application/json"); err != nil {
+		slog.ErrorContext(ctx, "Error saving data export status", "userID", userID, "error", err)
+		return errors.New("failed to save data export")
+	}
+	return nil
+}
+
+// runBuildDataExportJob builds a user's export archive, unless a later request
+// superseded it, and schedules its deletion. Once out of attempts the export is marked
+// failed, so the next request starts over.
+func (s *Service) runBuildDataExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload dataExportJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	current, err := s.dataExportStatus(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.RequestedAt.Equal(payload.RequestedAt) {
+		return nil // Superseded
+	}
+
+	size, err := s.buildDataExport(ctx, payload.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		_ = s.storage.DeleteFile(ctx, dataExportStatusPath(payload.UserID)) // The user is gone
+		return nil
+	}
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts {
+			slog.ErrorContext(ctx, "Data export failed", "userID", payload.UserID, "error", err)
+			current.Status = models.DataExportFailed
+			_ = s.saveDataExportStatus(ctx, payload.UserID, current)
+			_ = s.storage.DeleteFile(ctx, dataExportPath(payload.UserID)) // Of an earlier export
+		}
+		return err
+	}
+
+	now := s.now().UTC()
+	expiresAt := now.Add(s.cfg.DataExport.Retention)
+	export := &models.DataExport{
+		Status: models.DataExportReady, RequestedAt: payload.RequestedAt,
+		CompletedAt: &now, ExpiresAt: &expiresAt, SizeBytes: size,
+	}
+	if err := s.saveDataExportStatus(ctx, payload.UserID, export); err != nil {
+		return err
+	}
+	if err := s.enqueueJob(ctx, jobExpireDataExport, payload, jobs.WithDelay(s.cfg.DataExport.Retention)); err != nil {
+		slog.WarnContext(ctx, "Failed to schedule deletion of data export", "userID", payload.UserID, "error", err)
+	}
+	slog.InfoContext(ctx, "Data export built", "userID", payload.UserID, "bytes", size)
+	return nil
+}
+
+// runExpireDataExportJob deletes a user's export archive and status once they expire,
+// unless a later request replaced them.
+func (s *Service) runExpireDataExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload dataExportJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	current, err := s.dataExportStatus(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.RequestedAt.Equal(payload.RequestedAt) {
+		return nil
+	}
+	if err := s.storage.DeleteFile(ctx, dataExportPath(payload.UserID)); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return err
+	}
+	if err := s.storage.DeleteFile(ctx, dataExportStatusPath(payload.UserID)); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
+
+// buildDataExport writes userID's export archive to storage as it is built and returns
+// its size.
+func (s *Service) buildDataExport(ctx context.Context, userID string) (int64, error) {
+	user, err := s.db.GetUserByUsername(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	go func() {
+		zw := zip.NewWriter(counter)
+		err := s.writeDataExport(ctx, &dataExportWriter{zw: zw}, user)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	err = s.storage.UploadFile(ctx, dataExportPath(userID), pr, "application/zip")
+	pr.CloseWithError(err) // Stops the writer if the upload gave up first
+	if err != nil {
+		return 0, fmt.Errorf("failed to store data export: %w", err)
+	}
+	return counter.n, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// dataExportWriter adds files to a data export archive.
+type dataExportWriter struct {
+	zw *zip.Writer
+}
+
+// writeJSON adds v to the archive as an indented JSON file.
+func (w *dataExportWriter) writeJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// copyObject adds the storage object at key to the archive as name. Objects that are
+// missing are left out.
+func (w *dataExportWriter) copyObject(ctx context.Context, store storage.StorageAdapter, key, name string) error {
+	if key == "" {
+		return nil
+	}
+	reader, err := store.DownloadFile(ctx, key)
+	if errors.Is(err, storage.ErrFileNotFound) {
+		slog.WarnContext(ctx, "Object missing from data export", "key", key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer reader.Close()
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+// writeDataExport writes everything stored about user to w.
+func (s *Service) writeDataExport(ctx context.Context, w *dataExportWriter, user *models.User) error {
+	userID := user.ID
+	manifest := dataExportManifest{FormatVersion: dataExportFormatVersion, UserID: userID, CreatedAt: s.now().UTC()}
+	if err := w.writeJSON("manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := w.writeJSON("profile.json", user); err != nil {
+		return err
+	}
+
+	// Items, archived and trashed ones included, with their content and history
+	var posts []models.Post
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, offset, true)
+		if err != nil {
+			return fmt.Errorf("failed to list posts: %w", err)
+		}
+		posts = append(posts, page...)
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	err := forEachTrashPage(ctx, userID, s.db.ListTrashedPostMeta, func(p models.Post) (string, *time.Time) { return p.ID, p.DeletedAt }, func(page []models.Post) error {
+		posts = append(posts, page...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list trashed posts: %w", err)
+	}
+	var files []models.CodeFile
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListCodeFileMetaByUser(ctx, userID, itemPageSize, offset, true)
+		if err != nil {
+			return fmt.Errorf("failed to list code files: %w", err)
+		}
+		files = append(files, page...)
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	err = forEachTrashPage(ctx, userID, s.db.ListTrashedCodeFileMeta, func(f models.CodeFile) (string, *time.Time) { return f.ID, f.DeletedAt }, func(page []models.CodeFile) error {
+		files = append(files, page...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list trashed code files: %w", err)
+	}
+
+	if err := w.writeJSON(dataExportPosts+".json", nonNil(posts)); err != nil {
+		return err
+	}
+	if err := w.writeJSON(dataExportCodeFiles+".json", nonNil(files)); err != nil {
+		return err
+	}
+	var history []models.HistoryLog
+	collect := func(page []models.HistoryLog) error {
+		history = append(history, page...)
+		return nil
+	}
+	for i := range posts {
+		post := &posts[i]
+		if err := w.copyObject(ctx, s.storage, post.S3Path, "content/posts/"+post.ID+".md"); err != nil {
+			return err
+		}
+		if post.PublishedVersion > 0 {
+			if err := w.copyObject(ctx, s.storage, generatePublishedPath(post.ID), "content/posts/"+post.ID+".published.md"); err != nil {
+				return err
+			}
+		}
+		if err := s.forEachHistoryPage(ctx, post.ID, models.ItemTypePost, collect); err != nil {
+			return fmt.Errorf("failed to load history of post %s: %w", post.ID, err)
+		}
+	}
+	for i := range files {
+		file := &files[i]
+		if err := w.copyObject(ctx, s.storage, file.S3Path, "content/codefiles/"+file.ID+"/"+path.Base(file.FileName)); err != nil {
+			return err
+		}
+		if err := s.forEachHistoryPage(ctx, file.ID, models.ItemTypeCodeFile, collect); err != nil {
+			return fmt.Errorf("failed to load history of code file %s: %w", file.ID, err)
+		}
+	}
+	listed := make(map[string]bool, len(history))
+	for _, entry := range history {
+		listed[entry.ID] = true
+	}
+	err = s.pageHistory(func(until time.Time, limit int) ([]models.HistoryLog, error) {
+		return s.db.ListHistoryByUser(ctx, userID, until, limit)
+	}, func(page []models.HistoryLog) error {
+		for _, entry := range page {
+			if !listed[entry.ID] { // On another user's item
+				history = append(history, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load history written by user: %w", err)
+	}
+	if err := w.writeJSON(dataExportHistory+".json", nonNil(history)); err != nil {
+		return err
+	}
+	events := []audit.Event{}
+	for i := range history {
+		if history[i].UserID == userID {
+			events = append(events, audit.HistoryEvent(&history[i]))
+		}
+	}
+	if err := w.writeJSON(dataExportAuditEvents+".json", events); err != nil {
+		return err
+	}
+
+	// Everything else the user owns or wrote
+	var assets []models.Asset
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListAssetsByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list assets: %w", err)
+		}
+		assets = append(assets, page...)
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	if err := w.writeJSON(dataExportAssets+".json", nonNil(assets)); err != nil {
+		return err
+	}
+	for i := range assets {
+		name := "content/assets/" + assets[i].ID + "/" + path.Base(assets[i].FileName)
+		if err := w.copyObject(ctx, s.storage, assets[i].S3Path, name); err != nil {
+			return err
+		}
+	}
+
+	var projects []models.Project
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListProjectsByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list projects: %w", err)
+		}
+		projects = append(projects, page...)
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	if err := w.writeJSON(dataExportProjects+".json", nonNil(projects)); err != nil {
+		return err
+	}
+	var bookmarks []models.Bookmark
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListBookmarksByUser(ctx, userID, itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list bookmarks: %w", err)
+		}
+		bookmarks = append(bookmarks, page...)
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	if err := w.writeJSON(dataExportBookmarks+".json", nonNil(bookmarks)); err != nil {
+		return err
+	}
+
+	workspaces, err := s.db.ListWorkspacesByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	templates, err := s.db.ListTemplatesByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+	domains, err := s.ListDomains(ctx, userID)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := s.db.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+	comments, err := s.db.ListCommentsByAuthor(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	var reports []models.Report
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListReports(ctx, "", itemPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list reports: %w", err)
+		}
+		for _, report := range page {
+			if report.ReporterID == userID {
+				reports = append(reports, report)
+			}
+		}
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	transfers, err := s.db.ListTransfersByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list transfers: %w", err)
+	}
+	links, err := s.db.ListShareLinksByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list share links: %w", err)
+	}
+	var usage []models.UsageDay
+	today := s.now().UTC()
+	for from := user.CreatedAt.UTC(); !from.After(today); from = from.AddDate(0, 0, maxStatsDays) {
+		to := from.AddDate(0, 0, maxStatsDays-1)
+		page, err := s.db.ListUsage(ctx, userID, from.Format(statsDayFormat), to.Format(statsDayFormat))
+		if err != nil {
+			return fmt.Errorf("failed to list API usage: %w", err)
+		}
+		usage = append(usage, page...)
+	}
+	for kind, records := range map[string]interface{}{
+		dataExportWorkspaces: nonNil(workspaces),
+		dataExportTemplates:  nonNil(templates),
+		dataExportDomains:    nonNil(domains),
+		dataExportPush:       nonNil(subscriptions),
+		dataExportComments:   nonNil(comments),
+		dataExportReports:    nonNil(reports),
+		dataExportTransfers:  nonNil(transfers),
+		dataExportShareLinks: nonNil(links),
+		dataExportUsage:      nonNil(usage),
+	} {
+		if err := w.writeJSON(kind+".json", records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nonNil returns records, or an empty slice if it is nil, so it encodes as [].
+func nonNil[T any](records []T) []T {
+	if records == nil {
+		return []T{}
+	}
+	return records
+}
@@ -0,0 +1,213 @@
+// internal/service/deltas.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"log/slog"
+	"strings"
+)
+
+// Retained versions are stored in chains: the first version of each chain in full at its
+// version path, and the others as a delta against it at their delta path, so any version
+// is read from at most two objects. A version that doesn't get smaller as a delta (e.g. a
+// rewrite of the whole content) stays in full. Versions are written in full, so writes
+// never read the chain's base; CompactVersions turns each past chain into this layout,
+// including chains stored under another interval.
+
+const versionDeltaContentType = "application/json"
+
+// versionDelta is a version's content as changes to its chain's full version.
+type versionDelta struct {
+	Base    int             `json:"base"`    // Version the changes apply to
+	Changes []models.Change `json:"changes"` // Applied in order, as applyChanges does
+	Hash    string          `json:"hash"`    // Of the resulting content
+}
+
+// generateVersionDeltaPath returns the storage key holding an item's version as a delta.
+func generateVersionDeltaPath(itemID string, itemType models.ItemType, version int) string {
+	return generateVersionPath(itemID, itemType, version) + ".delta"
+}
+
+// fullVersionOf returns the version stored in full that version's chain starts with.
+func (s *Service) fullVersionOf(version int) int {
+	n := s.cfg.Snapshot.FullVersionInterval
+	if n <= 1 {
+		return version
+	}
+	return version - (version-1)%n
+}
+
+// encodeVersionDelta returns content as a delta against baseContent (version base), or
+// false if the delta wouldn't be smaller than content itself.
+func encodeVersionDelta(base int, baseContent, content string) (string, bool) {
+	delta := versionDelta{Base: base, Changes: changesFromEdits(diff.Edits(baseContent, content)), Hash: contentHash(content)}
+	data, err := json.Marshal(delta)
+	if err != nil || len(data) >= len(content) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// loadVersionContent reads a retained version, in full or from its delta. It returns
+// storage.ErrFileNotFound if the version (or its delta's base) isn't retained, and
+// ErrIntegrity if its delta doesn't rebuild the content it was made from.
+func (s *Service) loadVersionContent(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	content, err := s.downloadContent(ctx, generateVersionPath(itemID, itemType, version))
+	if !errors.Is(err, storage.ErrFileNotFound) {
+		return content, err
+	}
+	deltaPath := generateVersionDeltaPath(itemID, itemType, version)
+	raw, err := s.downloadContent(ctx, deltaPath)
+	if err != nil {
+		return "", err
+	}
+
+	var delta versionDelta
+	if err := json.Unmarshal([]byte(raw), &delta); err != nil || delta.Base < 1 || delta.Base >= version {
+		slog.ErrorContext(ctx, "Unreadable version delta", "itemType", itemType, "itemID", itemID, "version", version, "deltaPath", deltaPath, "error", err)
+		return "", ErrIntegrity
+	}
+	base, err := s.loadVersionContent(ctx, itemID, itemType, delta.Base)
+	if err != nil {
+		return "", err
+	}
+	content, err = applyChanges(base, delta.Changes)
+	if err != nil || contentHash(content) != delta.Hash {
+		slog.ErrorContext(ctx, "Version delta doesn't apply to its base", "itemType", itemType, "itemID", itemID, "version", version, "base", delta.Base, "deltaPath", deltaPath, "error", err)
+		return "", ErrIntegrity
+	}
+	return content, nil
+}
+
+// CompactVersions rewrites the retained versions of every item's past chains (all but
+// the chain its current version belongs to) to the current layout: full copies inside a
+// chain become deltas against its first version, and deltas against another base are
+// rebased onto it. Each object is replaced only after its new form is stored, so reads
+// keep working throughout. With dryRun nothing is written.
+func (s *Service) CompactVersions(ctx context.Context, dryRun bool) (*models.VersionCompactionReport, error) {
+	report := &models.VersionCompactionReport{DryRun: dryRun}
+	if !s.cfg.Snapshot.RetainVersions {
+		return report, nil
+	}
+
+	err := s.forEachItemPage(ctx, func(metas []models.ItemMeta) error {
+		for _, meta := range metas {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			itemID, itemType := meta.GetID(), meta.Type()
+			report.ItemsScanned++
+			saved := report.BytesSaved
+			if err := s.compactItemVersions(ctx, itemID, itemType, meta.GetVersion(), report); err != nil {
+				slog.InfoContext(ctx, "Skipping version compaction", "itemType", itemType, "itemID", itemID, "error", err)
+				report.ItemsSkipped++
+			}
+			if !dryRun { // Rewrites made before a failure are kept too
+				s.chargeRetained(ctx, meta.GetUserID(), itemID, itemType, saved-report.BytesSaved)
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// compactItemVersions rewrites one item's versions before the chain of currentVersion,
+// oldest first so every chain's full version is in place before its deltas are made.
+func (s *Service) compactItemVersions(ctx context.Context, itemID string, itemType models.ItemType, currentVersion int, report *models.VersionCompactionReport) error {
+	contentType := contentTypeFor(itemType)
+	rewritten := 0
+	var chainBase int
+	var chainContent string // Content of chainBase, "" with chainBase 0 if it isn't retained
+	for v := 1; v < s.fullVersionOf(currentVersion); v++ {
+		fullPath, deltaPath := generateVersionPath(itemID, itemType, v), generateVersionDeltaPath(itemID, itemType, v)
+
+		// 1. How the version is stored now
+		full, err := s.downloadContent(ctx, fullPath)
+		isFull := err == nil
+		if err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+			return fmt.Errorf("failed to read v%d: %w", v, err)
+		}
+		var delta versionDelta
+		var raw string
+		if !isFull {
+			raw, err = s.downloadContent(ctx, deltaPath)
+			if errors.Is(err, storage.ErrFileNotFound) {
+				if s.fullVersionOf(v) == v {
+					chainBase = 0 // Not retained; nothing in its chain can be rebased
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read v%d: %w", v, err)
+			}
+			if err := json.Unmarshal([]byte(raw), &delta); err != nil {
+				return fmt.Errorf("unreadable delta of v%d: %w", v, err)
+			}
+		}
+
+		// 2. A chain's first version is stored in full
+		if s.fullVersionOf(v) == v {
+			chainBase, chainContent = v, full
+			if isFull {
+				continue
+			}
+			if chainContent, err = s.loadVersionContent(ctx, itemID, itemType, v); err != nil {
+				return fmt.Errorf("failed to rebuild v%d: %w", v, err)
+			}
+			if !report.DryRun {
+				if err := s.storage.UploadFile(ctx, fullPath, strings.NewReader(chainContent), contentType); err != nil {
+					return fmt.Errorf("failed to store v%d: %w", v, err)
+				}
+				s.deleteVersionObject(ctx, deltaPath)
+			}
+			rewritten++
+			report.BytesSaved += int64(len(raw) - len(chainContent))
+			continue
+		}
+
+		// 3. The others as deltas against it, unless they already are
+		if chainBase == 0 || (!isFull && delta.Base == chainBase) {
+			continue
+		}
+		content := full
+		if !isFull {
+			if content, err = s.loadVersionContent(ctx, itemID, itemType, v); err != nil {
+				return fmt.Errorf("failed to rebuild v%d: %w", v, err)
+			}
+		}
+		encoded, ok := encodeVersionDelta(chainBase, chainContent, content)
+		if !ok {
+			continue // No smaller as a delta; kept as it is
+		}
+		if !report.DryRun {
+			if err := s.storage.UploadFile(ctx, deltaPath, strings.NewReader(encoded), versionDeltaContentType); err != nil {
+				return fmt.Errorf("failed to store delta of v%d: %w", v, err)
+			}
+			if isFull {
+				s.deleteVersionObject(ctx, fullPath)
+			}
+		}
+		rewritten++
+		report.BytesSaved += int64(len(full) + len(raw) - len(encoded))
+	}
+
+	if rewritten > 0 {
+		report.ItemsCompacted++
+		report.VersionsRewritten += rewritten
+	}
+	return nil
+}
+
+// deleteVersionObject removes a version object replaced by another form. A failure only
+// leaves a redundant copy behind, so it's logged.
+func (s *Service) deleteVersionObject(ctx context.Context, path string) {
+	if err := s.storage.DeleteFile(ctx, path); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		slog.WarnContext(ctx, "Failed to delete replaced version object", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,339 @@
+// internal/service/digests.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/mail"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Users who set an email address get a digest of the activity on their items every
+// Digest.IntervalDays: views, edits by collaborators and comments. A scheduled sweep
+// queues one digest job per user; they opt out by turning off the "digest" notification
+// type.
+
+const (
+	maxDigestItems    = 500  // Per item type; a user's other items are left out of their digest
+	maxDigestHistory  = 200  // History entries read per item for collaborator edits
+	maxDigestComments = 1000 // Comments on the user's items read, newest first
+	maxDigestListed   = 10   // Items listed under each heading
+)
+
+var ErrInvalidEmail = apperr.New(apperr.Validation, "email must be an address such as someone@example.com")
+
+// UseMailer sends email with m from then on, e.g. activity digests. Call it before
+// UseJobQueue, which schedules digests only if there is a mailer.
+func (s *Service) UseMailer(m *mail.Mailer) {
+	s.mailer = m
+}
+
+// SetEmail sets the email address userID's digests go to, or removes it if email is
+// empty.
+func (s *Service) SetEmail(ctx context.Context, userID, email string) error {
+	if email = strings.TrimSpace(email); email != "" {
+		var err error
+		if email, err = mail.ParseAddress(email); err != nil {
+			return ErrInvalidEmail
+		}
+	}
+	if err := s.db.SetUserEmail(ctx, userID, email); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error setting email address of user", "userID", userID, "error", err)
+		return errors.New("failed to set email address")
+	}
+	_ = s.cache.DeleteUser(ctx, userID)
+	return nil
+}
+
+// GetEmail returns userID's email address, "" if they have none.
+func (s *Service) GetEmail(ctx context.Context, userID string) (string, error) {
+	user, err := s.getUserWithCache(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// digestJob is the payload of a digest.send job: the digest of the days before End.
+type digestJob struct {
+	UserID string    `json:"userId"`
+	End    time.Time `json:"end"`
+}
+
+// runDigestSweepJob queues a digest for every user, covering the days up to today
+// (UTC). Job IDs carry the period, so a sweep that runs twice sends one digest; a retry
+// resumes after the last user checkpointed.
+func (s *Service) runDigestSweepJob(ctx context.Context, job *jobs.Job) error {
+	userIDs, err := s.db.ListUserIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	end := s.now().UTC().Truncate(24 * time.Hour)
+	queued := 0
+	for _, userID := range remainingUsers(ctx, userIDs) {
+		jobID := "digest:" + userID + ":" + end.Format("2006-01-02")
+		if err := s.enqueueJob(ctx, jobSendDigest, digestJob{UserID: userID, End: end}, jobs.WithID(jobID)); err != nil {
+			slog.WarnContext(ctx, "Failed to queue digest", "userID", userID, "error", err)
+			continue
+		}
+		queued++
+		if err := jobs.Checkpoint(ctx, sweepProgress{LastUserID: userID}); err != nil {
+			return err
+		}
+	}
+	slog.InfoContext(ctx, "Queued activity digests", "count", queued)
+	return nil
+}
+
+// runSendDigestJob compiles and emails one user's digest, unless they have no email
+// address, opted out or nothing happened.
+func (s *Service) runSendDigestJob(ctx context.Context, job *jobs.Job) error {
+	var payload digestJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	if s.mailer == nil {
+		return nil
+	}
+	user, err := s.db.GetUserByUsername(ctx, payload.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == "" || slices.Contains(user.MutedNotifications, models.NotifyDigest) {
+		return nil
+	}
+
+	start := payload.End.AddDate(0, 0, -s.cfg.Digest.IntervalDays)
+	digest, err := s.compileDigest(ctx, user.ID, start, payload.End)
+	if err != nil {
+		return err
+	}
+	if digest.empty() {
+		return nil
+	}
+	loc, _ := s.userLocation(ctx, user.ID)
+	msg := &mail.Message{To: user.Email, Subject: digest.subject(loc), Body: digest.body(loc)}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send digest: %w", err)
+	}
+	return nil
+}
+
+// digestItem is the activity on one item over a digest's period.
+type digestItem struct {
+	Label    string
+	Noun     string
+	Views    int64
+	Edits    map[string]int // Versions written, by collaborator
+	Comments int            // Approved, by others
+}
+
+// digest is the activity on a user's items over [Start, End).
+type digest struct {
+	Start, End time.Time
+	Items      []digestItem // Items with any activity
+	Pending    int          // Comments awaiting the user's approval
+}
+
+// compileDigest gathers the views of userID's items, the edits collaborators made to them
+// and the comments others left on them between start and end, which are whole UTC days.
+func (s *Service) compileDigest(ctx context.Context, userID string, start, end time.Time) (*digest, error) {
+	posts, err := s.db.ListPostMetaByUser(ctx, userID, maxDigestItems, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list posts: %w", err)
+	}
+	files, err := s.db.ListCodeFileMetaByUser(ctx, userID, maxDigestItems, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list code files: %w", err)
+	}
+
+	d := &digest{Start: start, End: end}
+	comments, err := s.commentActivity(ctx, userID, d)
+	if err != nil {
+		return nil, err
+	}
+	add := func(itemID string, itemType models.ItemType, label string) error {
+		item, err := s.itemActivity(ctx, userID, itemID, itemType, start, end)
+		if err != nil {
+			return err
+		}
+		item.Comments = comments[string(itemType)+":"+itemID]
+		if item.Views > 0 || len(item.Edits) > 0 || item.Comments > 0 {
+			item.Label, item.Noun = label, itemNoun(itemType)
+			d.Items = append(d.Items, *item)
+		}
+		return nil
+	}
+	for i := range posts {
+		if err := add(posts[i].ID, models.ItemTypePost, posts[i].Title); err != nil {
+			return nil, err
+		}
+	}
+	for i := range files {
+		if err := add(files[i].ID, models.ItemTypeCodeFile, files[i].Path); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// commentActivity counts the comments others left on userID's items over d's period,
+// approved ones by item (keyed itemType:itemID), and those held for moderation in
+// d.Pending. Spam isn't counted.
+func (s *Service) commentActivity(ctx context.Context, userID string, d *digest) (map[string]int, error) {
+	counts := make(map[string]int)
+	for offset := 0; offset < maxDigestComments; offset += itemPageSize {
+		page, err := s.db.ListCommentsByOwner(ctx, userID, "", itemPageSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, comment := range page {
+			if comment.CreatedAt.Before(d.Start) {
+				return counts, nil // Newest first: the rest are older
+			}
+			if comment.UserID == userID || !comment.CreatedAt.Before(d.End) {
+				continue
+			}
+			switch {
+			case comment.Status.Is(models.CommentApproved):
+				counts[comment.ItemType+":"+comment.ItemID]++
+			case comment.Status == models.CommentPending:
+				d.Pending++
+			}
+		}
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	return counts, nil
+}
+
+// itemActivity counts an item's views and the versions others wrote between start and
+// end.
+func (s *Service) itemActivity(ctx context.Context, ownerUserID, itemID string, itemType models.ItemType, start, end time.Time) (*digestItem, error) {
+	item := &digestItem{Edits: make(map[string]int)}
+	days, err := s.db.ListItemStats(ctx, itemID, string(itemType), start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats: %w", err)
+	}
+	for _, day := range days {
+		item.Views += day.Views
+	}
+
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxDigestHistory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	seen := make(map[string]bool) // userID:version; patches of one version share it
+	for _, entry := range history {
+		if entry.UserID == ownerUserID || entry.Timestamp.Before(start) || !entry.Timestamp.Before(end) {
+			continue
+		}
+		if entry.Action != models.ActionPatch && entry.Action != models.ActionRevert {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", entry.UserID, entry.ItemVersion)
+		if !seen[key] {
+			seen[key] = true
+			item.Edits[entry.UserID]++
+		}
+	}
+	return item, nil
+}
+
+func (d *digest) empty() bool {
+	return len(d.Items) == 0 && d.Pending == 0
+}
+
+// period describes the digest's days in loc, e.g. "Mar 3 – Mar 9".
+func (d *digest) period(loc *time.Location) string {
+	last := d.End.AddDate(0, 0, -1)
+	if last.Equal(d.Start) {
+		return d.Start.In(loc).Format("Jan 2")
+	}
+	return d.Start.In(loc).Format("Jan 2") + " – " + last.In(loc).Format("Jan 2")
+}
+
+func (d *digest) subject(loc *time.Location) string {
+	return "Your blog activity, " + d.period(loc)
+}
+
+func (d *digest) body(loc *time.Location) string {
+	var b strings.Builder
+	var views int64
+	var edited, commented []digestItem
+	for _, item := range d.Items {
+		views += item.Views
+		if len(item.Edits) > 0 {
+			edited = append(edited, item)
+		}
+		if item.Comments > 0 {
+			commented = append(commented, item)
+		}
+	}
+	fmt.Fprintf(&b, "Activity on your posts and files, %s.\n\n", d.period(loc))
+
+	if views > 0 {
+		fmt.Fprintf(&b, "Views: %d\n", views)
+		viewed := slices.Clone(d.Items)
+		sort.SliceStable(viewed, func(i, j int) bool { return viewed[i].Views > viewed[j].Views })
+		for i, item := range viewed {
+			if i == maxDigestListed || item.Views == 0 {
+				break
+			}
+			fmt.Fprintf(&b, "  %s (%s): %d\n", item.Label, item.Noun, item.Views)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(edited) > 0 {
+		b.WriteString("Edits by collaborators:\n")
+		for i, item := range edited {
+			if i == maxDigestListed {
+				fmt.Fprintf(&b, "  ...and %d more\n", len(edited)-i)
+				break
+			}
+			editors := make([]string, 0, len(item.Edits))
+			for editor, versions := range item.Edits {
+				editors = append(editors, fmt.Sprintf("%s (%d)", editor, versions))
+			}
+			sort.Strings(editors)
+			fmt.Fprintf(&b, "  %s (%s): %s\n", item.Label, item.Noun, strings.Join(editors, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(commented) > 0 || d.Pending > 0 {
+		b.WriteString("Comments:\n")
+		sort.SliceStable(commented, func(i, j int) bool { return commented[i].Comments > commented[j].Comments })
+		for i, item := range commented {
+			if i == maxDigestListed {
+				fmt.Fprintf(&b, "  ...and %d more\n", len(commented)-i)
+				break
+			}
+			fmt.Fprintf(&b, "  %s (%s): %d\n", item.Label, item.Noun, item.Comments)
+		}
+		if d.Pending > 0 {
+			fmt.Fprintf(&b, "  %d awaiting your approval\n", d.Pending)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("To stop these emails, turn off the digest notification in your settings.\n")
+	return b.String()
+}
@@ -0,0 +1,319 @@
+// internal/service/domains.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	maxDomainsPerUser = 10
+	verifyRecordLabel = "_blog-verify" // A domain's verification TXT record is at _blog-verify.<host>
+	verifyValuePrefix = "blog-verify=" // and holds blog-verify=<token>
+
+	// unverifiedClaimTTL is how long an unverified domain is reserved for the user who added
+	// it. Past it, another user can claim the host, so nobody can hold on to a domain they
+	// don't control.
+	unverifiedClaimTTL = 7 * 24 * time.Hour
+
+	// domainRecheckInterval is how often verified domains are checked to still publish
+	// their verification record. One that stopped (say, its registration lapsed and someone
+	// else holds it now) is unverified, and no longer served.
+	domainRecheckInterval = 24 * time.Hour
+)
+
+var (
+	ErrInvalidDomain     = apperr.New(apperr.Validation, "domain must be a host name such as blog.example.com")
+	ErrDomainNotFound    = apperr.New(apperr.NotFound, "domain not found")
+	ErrDomainTaken       = apperr.New(apperr.Conflict, "domain is already in use")
+	ErrTooManyDomains    = apperr.New(apperr.Conflict, "too many domains (10 at most)")
+	ErrDomainNotVerified = apperr.New(apperr.Unprocessable, "verification record not found in DNS")
+	ErrDomainsDisabled   = apperr.New(apperr.Unavailable, "custom domains are disabled")
+)
+
+// domainsContext is ctx for calls about domains, which are kept outside any tenant's
+// namespace: host names are the deployment's, whichever tenant uses them.
+func domainsContext(ctx context.Context) context.Context {
+	return tenant.WithID(ctx, "")
+}
+
+// normalizeDomain lower-cases host and checks it is a host name with at least two labels.
+// IP addresses are refused: they can't carry a TXT record.
+func normalizeDomain(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	labels := strings.Split(host, ".")
+	if len(host) > 253 || len(labels) < 2 {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", ErrInvalidDomain
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return "", ErrInvalidDomain
+			}
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", ErrInvalidDomain // An IPv4 address, or not a real TLD
+	}
+	return host, nil
+}
+
+// reservedDomain reports whether host is one the server itself is reached at, which no
+// user can claim.
+func (s *Service) reservedDomain(host string) bool {
+	if u, err := url.Parse(s.cfg.Site.BaseURL); err == nil && u.Hostname() == host {
+		return true
+	}
+	for _, own := range s.cfg.Server.AutocertDomains {
+		if strings.EqualFold(own, host) {
+			return true
+		}
+	}
+	for own := range s.cfg.Tenancy.Hosts {
+		if strings.EqualFold(own, host) {
+			return true
+		}
+	}
+	base := strings.ToLower(strings.TrimPrefix(s.cfg.Tenancy.BaseDomain, "."))
+	return base != "" && (host == base || strings.HasSuffix(host, "."+base))
+}
+
+// withVerificationRecord sets the DNS record an unverified domain awaits.
+func withVerificationRecord(domain *models.Domain) *models.Domain {
+	if domain.VerifiedAt == nil {
+		domain.VerificationRecord = &models.DNSRecord{
+			Type:  "TXT",
+			Name:  verifyRecordLabel + "." + domain.Host,
+			Value: verifyValuePrefix + domain.VerificationToken,
+		}
+	}
+	return domain
+}
+
+// AddDomain claims host for userID's blog. The domain is served once verified: its
+// VerificationRecord has to be published in DNS, then VerifyDomain called. Adding a
+// domain the user already has returns it.
+func (s *Service) AddDomain(ctx context.Context, userID, host string) (*models.Domain, error) {
+	if !s.cfg.Site.CustomDomains {
+		return nil, ErrDomainsDisabled
+	}
+	host, err := normalizeDomain(host)
+	if err != nil {
+		return nil, err
+	}
+	if s.reservedDomain(host) {
+		return nil, ErrDomainTaken
+	}
+	domains, err := s.ListDomains(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range domains {
+		if domains[i].Host == host {
+			return &domains[i], nil
+		}
+	}
+	if len(domains) >= maxDomainsPerUser {
+		return nil, ErrTooManyDomains
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	domain := &models.Domain{Host: host, UserID: userID, TenantID: tenant.ID(ctx), VerificationToken: hex.EncodeToString(token)}
+	dctx := domainsContext(ctx)
+	err = s.db.CreateDomain(dctx, domain)
+	if errors.Is(err, database.ErrDuplicateDomain) {
+		// Take over a stale claim of someone else's; it was never proven
+		existing, getErr := s.db.GetDomain(dctx, host)
+		if getErr == nil && existing.VerifiedAt == nil && s.now().Sub(existing.CreatedAt) > unverifiedClaimTTL {
+			if err = s.db.DeleteDomain(dctx, host); err == nil {
+				err = s.db.CreateDomain(dctx, domain)
+			}
+		}
+	}
+	if errors.Is(err, database.ErrDuplicateDomain) {
+		return nil, ErrDomainTaken
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error adding domain", "userID", userID, "host", host, "error", err)
+		return nil, errors.New("failed to add domain")
+	}
+	slog.InfoContext(ctx, "Domain added", "userID", userID, "host", host)
+	return withVerificationRecord(domain), nil
+}
+
+// ListDomains returns userID's domains, sorted by host.
+func (s *Service) ListDomains(ctx context.Context, userID string) ([]models.Domain, error) {
+	all, err := s.db.ListDomainsByUser(domainsContext(ctx), userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing domains", "userID", userID, "error", err)
+		return nil, errors.New("failed to list domains")
+	}
+	tenantID := tenant.ID(ctx)
+	domains := make([]models.Domain, 0, len(all))
+	for _, domain := range all {
+		if domain.TenantID == tenantID { // Another tenant may have a user of the same name
+			domains = append(domains, *withVerificationRecord(&domain))
+		}
+	}
+	return domains, nil
+}
+
+// userDomain returns userID's domain of host, or ErrDomainNotFound if they have none.
+func (s *Service) userDomain(ctx context.Context, userID, host string) (*models.Domain, error) {
+	host, err := normalizeDomain(host)
+	if err != nil {
+		return nil, ErrDomainNotFound
+	}
+	domain, err := s.db.GetDomain(domainsContext(ctx), host)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting domain", "host", host, "error", err)
+		return nil, errors.New("failed to get domain")
+	}
+	if domain.UserID != userID || domain.TenantID != tenant.ID(ctx) {
+		return nil, ErrDomainNotFound
+	}
+	return domain, nil
+}
+
+// VerifyDomain checks that the verification record of userID's domain is published, and
+// if so starts serving their blog at it. It may take a while for a new record to be seen,
+// depending on the DNS zone's caching; ErrDomainNotVerified until then.
+func (s *Service) VerifyDomain(ctx context.Context, userID, host string) (*models.Domain, error) {
+	domain, err := s.userDomain(ctx, userID, host)
+	if err != nil || domain.VerifiedAt != nil {
+		return domain, err
+	}
+	if found, err := s.verificationPublished(ctx, domain); !found {
+		slog.InfoContext(ctx, "Domain verification record not found", "host", domain.Host, "error", err)
+		return nil, ErrDomainNotVerified
+	}
+
+	now := s.now().UTC()
+	if err := s.db.SetDomainVerified(domainsContext(ctx), domain.Host, now); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrDomainNotFound // Removed meanwhile
+		}
+		slog.ErrorContext(ctx, "Error verifying domain", "host", domain.Host, "error", err)
+		return nil, errors.New("failed to verify domain")
+	}
+	domain.VerifiedAt = &now
+	slog.InfoContext(ctx, "Domain verified", "userID", userID, "host", domain.Host)
+	return domain, nil
+}
+
+// verificationPublished reports whether domain's verification record is in DNS. The
+// error is set if that couldn't be found out, as opposed to the record missing.
+func (s *Service) verificationPublished(ctx context.Context, domain *models.Domain) (bool, error) {
+	records, err := s.resolver.LookupTXT(ctx, verifyRecordLabel+"."+domain.Host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == verifyValuePrefix+domain.VerificationToken {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// runRecheckDomainsJob checks that every verified domain still publishes its
+// verification record, and unverifies those that don't. A domain whose lookup fails is
+// left alone until the next run: a DNS outage mustn't take blogs down.
+func (s *Service) runRecheckDomainsJob(ctx context.Context, job *jobs.Job) error {
+	dctx := domainsContext(ctx)
+	domains, err := s.db.ListVerifiedDomains(dctx)
+	if err != nil {
+		return fmt.Errorf("failed to list verified domains: %w", err)
+	}
+	var progress domainSweepProgress
+	jobs.LoadProgress(ctx, &progress)
+	unverified := 0
+	for i := range domains {
+		domain := &domains[i]
+		if domain.Host <= progress.LastHost {
+			continue
+		}
+		found, err := s.verificationPublished(ctx, domain)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "Domain recheck lookup failed", "host", domain.Host, "error", err)
+		case !found:
+			if err := s.db.SetDomainVerified(dctx, domain.Host, time.Time{}); err != nil && !errors.Is(err, database.ErrNotFound) {
+				return fmt.Errorf("failed to unverify domain %s: %w", domain.Host, err)
+			}
+			slog.WarnContext(ctx, "Domain no longer verified", "host", domain.Host, "userID", domain.UserID, "tenantID", domain.TenantID)
+			unverified++
+		}
+		if err := jobs.Checkpoint(ctx, domainSweepProgress{LastHost: domain.Host}); err != nil {
+			return err
+		}
+	}
+	slog.InfoContext(ctx, "Rechecked custom domains", "count", len(domains), "unverified", unverified)
+	return nil
+}
+
+// domainSweepProgress is the checkpoint of a domains.recheck job.
+type domainSweepProgress struct {
+	LastHost string `json:"lastHost"`
+}
+
+// RemoveDomain stops serving userID's blog at host and releases it.
+func (s *Service) RemoveDomain(ctx context.Context, userID, host string) error {
+	domain, err := s.userDomain(ctx, userID, host)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteDomain(domainsContext(ctx), domain.Host); err != nil {
+		slog.ErrorContext(ctx, "Error removing domain", "host", domain.Host, "error", err)
+		return errors.New("failed to remove domain")
+	}
+	slog.InfoContext(ctx, "Domain removed", "userID", userID, "host", domain.Host)
+	return nil
+}
+
+// GetVerifiedDomain returns the verified domain served at host (a Host header; any port
+// is ignored), or ErrDomainNotFound. Its UserID and TenantID say whose blog it is.
+func (s *Service) GetVerifiedDomain(ctx context.Context, host string) (*models.Domain, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host, err := normalizeDomain(host)
+	if err != nil {
+		return nil, ErrDomainNotFound
+	}
+	domain, err := s.db.GetDomain(domainsContext(ctx), host)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && domain.VerifiedAt == nil) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting domain", "host", host, "error", err)
+		return nil, errors.New("failed to get domain")
+	}
+	return domain, nil
+}
@@ -0,0 +1,209 @@
+// internal/service/drafts.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/frontmatter"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// A post's live content (Post.S3Path) is its draft: WebSocket edits and autosaves change
+// it freely. Readers of the published post see a separate copy that only changes when
+// the draft is explicitly published.
+
+var ErrNotPublished = apperr.New(apperr.NotFound, "post has not been published")
+
+// generatePublishedPath returns the storage key holding a post's published content.
+func generatePublishedPath(postID string) string {
+	return fmt.Sprintf("published/%s/%s", models.ItemTypePost, postID)
+}
+
+// getPostForDraft loads a post's metadata and checks userID has the required role.
+func (s *Service) getPostForDraft(ctx context.Context, userID, postID string, required models.Role) (*models.Post, error) {
+	post, err := getItemMetaAs[*models.Post](ctx, s, postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, post.UserID, postID, models.ItemTypePost, required); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// replaceContentChange returns a single change that replaces all of oldContent with newContent.
+func replaceContentChange(oldContent, newContent string) models.Change {
+	return models.Change{Line: 0, Column: 0, Removed: utf8.RuneCountInString(oldContent), Text: newContent}
+}
+
+// SaveDraft replaces the draft of a post with content, e.g. from an autosave. It goes
+// through the same versioned path as WebSocket edits, so baseVersion must be current.
+// The returned changes are empty if the draft was already identical.
+func (s *Service) SaveDraft(ctx context.Context, userID, postID string, baseVersion int, content string) (int, []models.Change, error) {
+	current, version, err := s.GetItemContent(ctx, userID, postID, string(models.ItemTypePost))
+	if err != nil {
+		return 0, nil, err
+	}
+	if version != baseVersion {
+		return version, nil, ErrVersionConflict
+	}
+	if current == content {
+		return version, nil, nil
+	}
+	change := replaceContentChange(current, content)
+	return s.ApplyItemChanges(ctx, userID, postID, string(models.ItemTypePost), baseVersion, []models.Change{change})
+}
+
+// GetDraft returns the draft of a post for preview, along with its publishing state.
+func (s *Service) GetDraft(ctx context.Context, userID, postID string) (*models.PostDraft, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	content, version, err := s.GetItemContent(ctx, userID, postID, string(models.ItemTypePost))
+	if err != nil {
+		return nil, err
+	}
+	hash := post.ContentHash
+	if hash == "" || post.Version != version { // Written before hashes were recorded, or changed meanwhile
+		hash = contentHash(content)
+	}
+	return &models.PostDraft{
+		PostID: postID, Content: content, Version: version, ContentHash: hash,
+		PublishedVersion: post.PublishedVersion, PublishedAt: post.PublishedAt, ScheduledAt: post.ScheduledAt,
+		Unpublished: post.PublishedVersion != version,
+	}, nil
+}
+
+// GetPublishedPost returns the content a post was last published with, without its
+// front-matter block if stripFrontMatter is set (for rendering).
+func (s *Service) GetPublishedPost(ctx context.Context, userID, postID string, stripFrontMatter bool) (*models.PublishedPost, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	if post.PublishedVersion == 0 {
+		return nil, ErrNotPublished
+	}
+	return s.publishedPost(ctx, post, stripFrontMatter)
+}
+
+// publishedPost loads the published content of a post that has been published, dated in
+// its owner's time zone.
+func (s *Service) publishedPost(ctx context.Context, post *models.Post, stripFrontMatter bool) (*models.PublishedPost, error) {
+	content, err := s.downloadContent(ctx, generatePublishedPath(post.ID))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading published content of post", "postID", post.ID, "error", err)
+		return nil, errors.New("failed to retrieve published content")
+	}
+	if stripFrontMatter {
+		content = frontmatter.Strip(content)
+	}
+	metaDescription := post.MetaDescription
+	if metaDescription == "" {
+		metaDescription = post.Excerpt
+	}
+	loc, timezone := s.userLocation(ctx, post.UserID)
+	published := &models.PublishedPost{
+		PostID: post.ID, Title: post.Title, Slug: post.Slug, Excerpt: post.Excerpt, Authors: postAuthors(post), Content: content,
+		Tags: post.Tags, CoverImage: post.CoverImage, Version: post.PublishedVersion,
+		PublishedAt: inLocation(post.PublishedAt, loc), Timezone: timezone,
+		CanonicalURL: post.CanonicalURL, MetaDescription: metaDescription, NoIndex: post.NoIndex,
+		Language: post.Language, TranslationOf: post.TranslationOf,
+	}
+	if post.Language != "" {
+		variants, err := s.publishedVariants(ctx, post)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			published.Translations = append(published.Translations, models.PostVariant{
+				PostID: variant.ID, Language: variant.Language, Slug: variant.Slug, Title: variant.Title,
+				Canonical: variant.TranslationOf == "",
+			})
+		}
+	}
+	return published, nil
+}
+
+// PublishPost promotes the current draft to the published content. If version is
+// non-zero it must match the current draft, so what was previewed is what gets published.
+// The excerpt is regenerated from the published content unless it was set manually.
+func (s *Service) PublishPost(ctx context.Context, userID, postID string, version int) (*models.Post, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != post.Version {
+		return nil, ErrVersionConflict
+	}
+	if post.TakenDownAt != nil {
+		return nil, ErrPostTakenDown
+	}
+	version = post.Version
+
+	// Read the retained copy of this exact version; the live object may move on meanwhile
+	content, err := s.reconstructVersion(ctx, postID, models.ItemTypePost, version)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading post version for publishing", "version", version, "postID", postID, "error", err)
+		return nil, errors.New("failed to load draft for publishing")
+	}
+
+	publishedPath := generatePublishedPath(postID)
+	if err := s.storage.UploadFile(ctx, publishedPath, strings.NewReader(content), "text/markdown"); err != nil {
+		slog.ErrorContext(ctx, "Error uploading published content of post", "postID", postID, "error", err)
+		return nil, errors.New("failed to save published content")
+	}
+	excerpt := post.Excerpt
+	if !post.ExcerptManual {
+		excerpt = generateExcerpt(content)
+	}
+	now := s.now().UTC()
+	if err := s.db.SetPostPublished(ctx, postID, version, now, excerpt); err != nil {
+		slog.ErrorContext(ctx, "Error marking post published", "postID", postID, "version", version, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	// Readers' comment anchors follow the published content
+	s.queueAnchorMove(ctx, postID, models.ItemTypePost)
+	if post.ScheduledAt != nil { // Published early, or by the schedule itself
+		_ = s.clearSchedule(ctx, postID)
+	}
+
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: postID, ItemType: string(models.ItemTypePost), Action: models.ActionPublish,
+		Timestamp: now, S3PathAfter: publishedPath, ItemVersion: version,
+	}
+	s.logAction(ctx, historyLog)
+
+	post.PublishedVersion, post.PublishedAt, post.Excerpt = version, &now, excerpt
+	post.ScheduledAt, post.ScheduledVersion = nil, 0
+	return post, nil
+}
+
+// DiscardDraft resets the draft to the published content. Like SaveDraft this creates a
+// new draft version, so the discarded edits stay in the history.
+func (s *Service) DiscardDraft(ctx context.Context, userID, postID string, baseVersion int) (int, []models.Change, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return 0, nil, err
+	}
+	if post.PublishedVersion == 0 {
+		return 0, nil, ErrNotPublished
+	}
+	published, err := s.downloadContent(ctx, generatePublishedPath(postID))
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return 0, nil, ErrNotPublished
+		}
+		slog.ErrorContext(ctx, "Error loading published content of post", "postID", postID, "error", err)
+		return 0, nil, errors.New("failed to retrieve published content")
+	}
+	return s.SaveDraft(ctx, userID, postID, baseVersion, published)
+}
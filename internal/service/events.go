@@ -0,0 +1,120 @@
+// internal/service/events.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/models"
+	"strconv"
+)
+
+const (
+	defaultEventsLimit = 100
+	maxEventsLimit     = 1000
+)
+
+var ErrInvalidEventCursor = apperr.New(apperr.Validation, "since must be a cursor from a previous page")
+
+// itemEventTypes maps the history actions reported as events to their type. Snapshots
+// change nothing about the item, so they aren't.
+var itemEventTypes = map[models.HistoryAction]models.ItemEventType{
+	models.ActionCreate:    models.ItemEventCreated,
+	models.ActionPatch:     models.ItemEventUpdated,
+	models.ActionRevert:    models.ItemEventUpdated,
+	models.ActionRename:    models.ItemEventUpdated,
+	models.ActionSlug:      models.ItemEventUpdated,
+	models.ActionAuthors:   models.ItemEventUpdated,
+	models.ActionArchive:   models.ItemEventUpdated,
+	models.ActionUnarchive: models.ItemEventUpdated,
+	models.ActionTransfer:  models.ItemEventUpdated,
+	models.ActionDelete:    models.ItemEventDeleted,
+	models.ActionRestore:   models.ItemEventRestored,
+	models.ActionPublish:   models.ItemEventPublished,
+	models.ActionUnpublish: models.ItemEventUnpublished,
+	models.ActionPurge:     models.ItemEventPurged,
+}
+
+// isItemEvent reports whether entry is logged as an item event. A batch of patches is
+// logged one entry per change, and is one event.
+func isItemEvent(entry *models.HistoryLog) bool {
+	_, ok := itemEventTypes[entry.Action]
+	return ok && (entry.Action != models.ActionPatch || entry.ChangeIndex == 0)
+}
+
+// numberEvent gives entry, if it is an item event, its owner's next EventSeq before it
+// is logged. The owner is looked up unless set (a transfer's is the new one; a purged
+// item's can't be). Entries of items that are gone already aren't events.
+func (s *Service) numberEvent(ctx context.Context, entry *models.HistoryLog) error {
+	if entry.EventSeq != 0 || !isItemEvent(entry) {
+		return nil
+	}
+	if entry.OwnerID == "" {
+		owner, err := s.itemOwner(ctx, entry.ItemID, models.ItemType(entry.ItemType))
+		if errors.Is(err, ErrItemNotFound) || errors.Is(err, ErrInvalidItemType) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry.OwnerID = owner
+	}
+	seq, err := s.db.NextEventSeq(ctx, entry.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to number item event: %w", err)
+	}
+	entry.EventSeq = seq
+	return nil
+}
+
+// ListItemEvents returns the events of userID's items after the cursor since, in the
+// order they were logged and at most limit of them, for integrations that sync by
+// polling. An empty since starts with the oldest event kept. Events are read from the
+// history, so they go back as far as it does, and belong to whoever owned the item when
+// they happened: a transfer is an event of the new owner's.
+func (s *Service) ListItemEvents(ctx context.Context, userID, since string, limit int) (*models.ItemEventsPage, error) {
+	if limit <= 0 {
+		limit = defaultEventsLimit
+	}
+	limit = min(limit, maxEventsLimit)
+	var after int64
+	if since != "" {
+		var err error
+		if after, err = strconv.ParseInt(since, 10, 64); err != nil || after < 0 {
+			return nil, ErrInvalidEventCursor
+		}
+	}
+
+	entries, err := s.db.ListHistoryEvents(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item events: %w", err)
+	}
+	result := &models.ItemEventsPage{Events: []models.ItemLifecycleEvent{}, More: len(entries) > limit}
+	for _, entry := range entries[:min(len(entries), limit)] {
+		after = entry.EventSeq
+		eventType, ok := itemEventTypes[entry.Action]
+		if !ok {
+			continue
+		}
+		result.Events = append(result.Events, models.ItemLifecycleEvent{
+			ID: entry.ID, Type: eventType, Action: entry.Action,
+			ItemID: entry.ItemID, ItemType: entry.ItemType, Version: entry.ItemVersion,
+			UserID: entry.UserID, Time: entry.Timestamp, Seq: entry.EventSeq,
+		})
+	}
+	result.Next = strconv.FormatInt(after, 10)
+	return result, nil
+}
+
+// itemOwner returns the owner of an item, trashed or not.
+func (s *Service) itemOwner(ctx context.Context, itemID string, itemType models.ItemType) (string, error) {
+	if meta, err := s.cache.GetItemMeta(ctx, itemID, itemType); err == nil && meta != nil {
+		return meta.GetUserID(), nil
+	}
+	meta, err := s.loadItemMeta(ctx, itemID, itemType)
+	if err != nil {
+		return "", err
+	}
+	return meta.GetUserID(), nil
+}
@@ -0,0 +1,139 @@
+// internal/service/excerpt.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/frontmatter"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxExcerptLength       = 280 // Generated excerpts, in runes
+	maxManualExcerptLength = 500
+)
+
+var ErrInvalidExcerpt = apperr.New(apperr.Validation, "excerpt must be at most 500 characters")
+
+var (
+	mdImage       = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	mdLink        = regexp.MustCompile(`\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	mdHTMLTag     = regexp.MustCompile(`<[^>]+>`)
+	mdEmphasis    = regexp.MustCompile(`\*\*|__|~~|\*|\b_|_\b|` + "`")
+	mdListMarker  = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+	mdHorizRule   = regexp.MustCompile(`^\s*([-*_])(\s*([-*_]))*\s*$`)
+	mdSetextUnder = regexp.MustCompile(`^\s*(=+|-+)\s*$`)
+)
+
+// generateExcerpt returns a plain-text summary of a post: its first paragraph of prose,
+// skipping the front-matter, headings, code blocks and images, with Markdown formatting
+// removed and cut at a word boundary if it's long. It returns "" if there is no prose.
+func generateExcerpt(content string) string {
+	var paragraph []string
+	fence := ""
+	flush := func() string {
+		text := excerptText(paragraph)
+		paragraph = paragraph[:0]
+		return text
+	}
+
+	for _, line := range strings.Split(frontmatter.Strip(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+
+		switch {
+		case len(paragraph) > 0 && mdSetextUnder.MatchString(trimmed):
+			paragraph = paragraph[:0] // The paragraph was a heading
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			fallthrough
+		case trimmed == "", strings.HasPrefix(trimmed, "#"), mdHorizRule.MatchString(trimmed):
+			if text := flush(); text != "" {
+				return text
+			}
+		case len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			// Indented code block
+		case strings.HasPrefix(trimmed, "|"):
+			// Table row
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	return flush()
+}
+
+// excerptText turns the lines of a Markdown paragraph into plain text.
+func excerptText(lines []string) string {
+	parts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimLeft(line, "> ") // Blockquotes
+		line = mdListMarker.ReplaceAllString(line, "")
+		parts = append(parts, line)
+	}
+	text := strings.Join(parts, " ")
+	text = mdImage.ReplaceAllString(text, "")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdHTMLTag.ReplaceAllString(text, "")
+	text = mdEmphasis.ReplaceAllString(text, "")
+	text = strings.Join(strings.Fields(text), " ")
+	return truncateExcerpt(text, maxExcerptLength)
+}
+
+// truncateExcerpt cuts text to at most max runes, at the last word boundary that fits,
+// and marks the cut with an ellipsis.
+func truncateExcerpt(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)[:max-1] // Room for the ellipsis
+	cut := string(runes)
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:.-") + "…"
+}
+
+// SetPostExcerpt overrides the generated excerpt of a post. An empty excerpt removes the
+// override and goes back to the one generated from the published content, which is
+// regenerated on every publish. Requires editor access.
+func (s *Service) SetPostExcerpt(ctx context.Context, userID, postID, excerpt string) (*models.Post, error) {
+	excerpt = strings.TrimSpace(excerpt)
+	if utf8.RuneCountInString(excerpt) > maxManualExcerptLength {
+		return nil, ErrInvalidExcerpt
+	}
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	manual := excerpt != ""
+	if !manual && post.PublishedVersion != 0 {
+		published, err := s.downloadContent(ctx, generatePublishedPath(postID))
+		if err != nil {
+			slog.ErrorContext(ctx, "Error loading published content of post for its excerpt", "postID", postID, "error", err)
+			return nil, errors.New("failed to retrieve published content")
+		}
+		excerpt = generateExcerpt(published)
+	}
+
+	if err := s.db.SetPostExcerpt(ctx, postID, excerpt, manual); err != nil {
+		slog.ErrorContext(ctx, "Error setting excerpt of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+
+	post.Excerpt, post.ExcerptManual = excerpt, manual
+	s.notifyPostSettings(ctx, userID, post)
+	return post, nil
+}
@@ -0,0 +1,78 @@
+// internal/service/format.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/formatter"
+	"github.com/kkuzar/blog_system/internal/langdetect"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+var (
+	ErrNoFormatter   = apperr.New(apperr.Unprocessable, "no formatter is configured for this file's language")
+	ErrFormatFailed  = apperr.New(apperr.Unprocessable, "formatter rejected the content")
+	ErrFormatTimeout = apperr.New(apperr.Unavailable, "formatter did not finish in time")
+)
+
+// FormatCodeFile runs the formatter for the file's language over its current content
+// and applies the result as an ordinary change, returning the new version and the
+// changes for broadcast. No changes and the current version are returned if the file
+// is already formatted. A non-zero baseVersion must match the current version.
+// Requires editor access.
+func (s *Service) FormatCodeFile(ctx context.Context, userID, fileID string, baseVersion int) (int, []models.Change, error) {
+	// 1. Get Metadata (checks existence and access) and pick the formatter
+	file, err := getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, file.UserID, fileID, models.ItemTypeCodeFile, models.RoleEditor); err != nil {
+		return 0, nil, err
+	}
+	unlock, err := s.lockItemWrite(ctx, fileID, models.ItemTypeCodeFile) // No write slips in between reading and applying
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+	filePath := codeFilePath(file)
+	language := file.Language
+	if language == "" {
+		language = langdetect.FromFileName(filePath)
+	}
+	f := s.formatters.Lookup(language)
+	if f == nil {
+		return 0, nil, ErrNoFormatter
+	}
+
+	// 2. Format the current content
+	content, currentVersion, err := s.GetItemContent(ctx, userID, fileID, string(models.ItemTypeCodeFile))
+	if err != nil {
+		return 0, nil, err
+	}
+	if baseVersion != 0 && baseVersion != currentVersion {
+		return currentVersion, nil, ErrVersionConflict
+	}
+	formatted, err := f.Format(ctx, filePath, content)
+	if err != nil {
+		var sourceErr *formatter.SourceError
+		if errors.As(err, &sourceErr) {
+			return currentVersion, nil, fmt.Errorf("%w: %s", ErrFormatFailed, sourceErr.Message)
+		}
+		slog.ErrorContext(ctx, "Error formatting codefile", "fileID", fileID, "language", language, "error", err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return 0, nil, ErrFormatTimeout
+		}
+		return 0, nil, errors.New("failed to run formatter")
+	}
+
+	// 3. Apply the difference like any other edit (history, snapshots, search)
+	changes := changesFromEdits(diff.Edits(content, formatted))
+	if len(changes) == 0 {
+		return currentVersion, nil, nil
+	}
+	return s.applyItemChanges(ctx, userID, fileID, models.ItemTypeCodeFile, currentVersion, changes)
+}
@@ -0,0 +1,25 @@
+// internal/service/frontmatter.go
+package service
+
+import (
+	"github.com/kkuzar/blog_system/internal/frontmatter"
+	"github.com/kkuzar/blog_system/internal/models"
+	"strings"
+)
+
+// setFrontMatter syncs a post's title, tags, date and draft flag from the front-matter
+// block at the top of its content, so content imported from static-site generators and
+// edited back and forth keeps its metadata. Content without a block leaves them as they
+// are, and so does a block that doesn't parse, which is common halfway through an edit.
+func setFrontMatter(post *models.Post, content string) {
+	fields, err := frontmatter.Parse(content)
+	if err != nil || fields == nil {
+		return
+	}
+	if fields.Title != nil && strings.TrimSpace(*fields.Title) != "" {
+		post.Title = strings.TrimSpace(*fields.Title)
+	}
+	post.Tags = fields.Tags
+	post.Date = fields.Date
+	post.Draft = fields.Draft != nil && *fields.Draft
+}
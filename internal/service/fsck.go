@@ -0,0 +1,284 @@
+// internal/service/fsck.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// FsckOptions selects what CheckConsistency does beyond the metadata, object and history
+// checks it always runs.
+type FsckOptions struct {
+	Repair bool // Fix what can be fixed without guessing
+	Deep   bool // Also download live content and compare it with the version rebuilt from history
+}
+
+// CheckConsistency cross-checks every item's metadata against its stored objects and
+// history log. With Repair it first resolves interrupted writes, then restores live
+// objects that are missing or (Deep) differ from history, and bridges history gaps
+// with snapshots of retained versions. Other issues are only reported. Items with a
+// write in flight are skipped, but concurrent edits can still race a repair, so run it
+// when the system is quiet.
+func (s *Service) CheckConsistency(ctx context.Context, opts FsckOptions) (*models.FsckReport, error) {
+	report := &models.FsckReport{Repair: opts.Repair, Deep: opts.Deep, Issues: []models.FsckIssue{}}
+
+	// 1. Interrupted writes, so the items they touch are settled before being checked
+	if opts.Repair {
+		if _, err := s.RepairWrites(ctx); err != nil {
+			return report, err
+		}
+	}
+	intents, err := s.db.ListWriteIntents(ctx, s.now().UTC(), 0)
+	if err != nil {
+		return report, fmt.Errorf("failed to list write intents: %w", err)
+	}
+	busy := make(map[string]bool, len(intents)) // Key: changeCounterKey
+	graceStart := s.now().UTC().Add(-writeIntentGrace)
+	for _, intent := range intents {
+		busy[changeCounterKey(models.ItemType(intent.ItemType), intent.ItemID)] = true
+		if intent.CreatedAt.Before(graceStart) {
+			report.Issues = append(report.Issues, models.FsckIssue{
+				ItemID: intent.ItemID, ItemType: intent.ItemType, Kind: models.FsckPendingWrite,
+				Version: intent.BaseVersion + 1,
+				Detail:  fmt.Sprintf("write intent %s from %s", intent.ID, intent.CreatedAt.Format(time.RFC3339)),
+			})
+		}
+	}
+
+	// 2. Every item
+	err = s.forEachItemPage(ctx, func(metas []models.ItemMeta) error {
+		for _, meta := range metas {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			report.ItemsChecked++
+			issues, err := s.checkItem(ctx, meta, opts, busy)
+			if err != nil {
+				slog.InfoContext(ctx, "Consistency check of item stopped early", "item", itemKey(meta), "error", err)
+			}
+			report.Issues = append(report.Issues, issues...)
+		}
+		return nil
+	})
+	for _, issue := range report.Issues {
+		if issue.Repaired {
+			report.Repaired++
+		}
+	}
+	return report, err
+}
+
+// itemKey identifies item meta in log messages.
+func itemKey(meta models.ItemMeta) string {
+	return changeCounterKey(meta.Type(), meta.GetID())
+}
+
+// checkItem runs the checks on one item and returns what it found. An error means some
+// checks couldn't run; the issues found before it are still returned.
+func (s *Service) checkItem(ctx context.Context, meta models.ItemMeta, opts FsckOptions, busy map[string]bool) ([]models.FsckIssue, error) {
+	itemID, itemType, ownerUserID := meta.GetID(), meta.Type(), meta.GetUserID()
+	s3Path, version, size, hash := meta.GetS3Path(), meta.GetVersion(), meta.GetSize(), meta.GetContentHash()
+	if busy[changeCounterKey(itemType, itemID)] {
+		return nil, nil // Settled by the write repair
+	}
+	var issues []models.FsckIssue
+	report := func(kind string, version int, format string, args ...interface{}) *models.FsckIssue {
+		issues = append(issues, models.FsckIssue{
+			ItemID: itemID, ItemType: string(itemType), Kind: kind, Version: version, Detail: fmt.Sprintf(format, args...),
+		})
+		return &issues[len(issues)-1]
+	}
+
+	// 1. History: every version since the oldest replay base must have been produced
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if err != nil {
+		return issues, fmt.Errorf("failed to load history: %w", err)
+	}
+	gaps, ahead, anchored := historyGaps(history, version)
+	if !anchored && len(history) < maxReplayHistory { // A full window may just have cut the base off
+		report(models.FsckVersionGap, 0, "history has no create, snapshot or revert entry")
+	}
+	for _, gap := range gaps {
+		issue := report(models.FsckVersionGap, gap[0], "no history entry produced %s", versionRange(gap))
+		if opts.Repair {
+			issue.Repaired = s.bridgeHistoryGap(ctx, ownerUserID, itemID, itemType, gap[1]) == nil
+		}
+	}
+	for _, v := range ahead {
+		report(models.FsckHistoryAhead, v, "history has entries for v%d but the item is at v%d", v, version)
+	}
+	for _, entry := range history {
+		if entry.Action != models.ActionSnapshot || entry.S3PathAfter == "" {
+			continue
+		}
+		exists, err := s.storage.FileExists(ctx, entry.S3PathAfter)
+		if err != nil {
+			return issues, fmt.Errorf("failed to check %s: %w", entry.S3PathAfter, err)
+		}
+		if !exists {
+			report(models.FsckMissingSnapshot, entry.ItemVersion, "snapshot entry %s points at missing %s", entry.ID, entry.S3PathAfter)
+		}
+	}
+
+	// 2. Live object
+	if s3Path == "" {
+		if size > 0 {
+			report(models.FsckMissingPath, version, "item records %d bytes but has no storage path", size)
+		}
+		return issues, nil
+	}
+	exists, err := s.storage.FileExists(ctx, s3Path)
+	if err != nil {
+		return issues, fmt.Errorf("failed to check %s: %w", s3Path, err)
+	}
+	if !exists {
+		issue := report(models.FsckMissingObject, version, "live object %s is missing", s3Path)
+		if opts.Repair {
+			issue.Repaired = s.restoreLiveContent(ctx, meta, "") == nil
+		}
+		return issues, nil
+	}
+	if !opts.Deep {
+		return issues, nil
+	}
+
+	// 3. Live content against history (Deep)
+	live, err := s.downloadContent(ctx, s3Path)
+	if err != nil {
+		return issues, fmt.Errorf("failed to read %s: %w", s3Path, err)
+	}
+	expected, err := s.reconstructVersion(ctx, itemID, itemType, version)
+	switch {
+	case errors.Is(err, ErrVersionNotAvailable):
+		// Can't be verified; the gap checks above say why
+	case err != nil:
+		return issues, fmt.Errorf("failed to rebuild v%d: %w", version, err)
+	case expected != live:
+		issue := report(models.FsckContentMismatch, version, "live object %s (%d bytes) differs from v%d rebuilt from history (%d bytes)", s3Path, len(live), version, len(expected))
+		if opts.Repair {
+			issue.Repaired = s.restoreLiveContent(ctx, meta, expected) == nil
+		}
+		live = expected // The size and hash checks below are against the content the item should have
+	}
+	if int64(len(live)) != size {
+		report(models.FsckSizeMismatch, version, "item records %d bytes, content is %d bytes", size, len(live))
+	}
+	// Without history to rebuild from, the hash is what catches an object corrupted in storage
+	if liveHash := contentHash(live); hash != "" && liveHash != hash {
+		report(models.FsckHashMismatch, version, "item records content hash %s, content hashes to %s", hash, liveHash)
+	}
+	return issues, nil
+}
+
+// historyGaps walks an item's history (newest first, as returned by GetActionHistory) and
+// returns the ranges of versions up to current that no entry produced, and the versions
+// past current that entries exist for. Only versions after the oldest create, snapshot
+// or revert are checked, since compaction and the history window drop earlier ones;
+// anchored reports whether there was such an entry at all.
+func historyGaps(history []models.HistoryLog, current int) (gaps [][2]int, ahead []int, anchored bool) {
+	produced := make(map[int]bool)
+	oldestBase := 0
+	for _, entry := range history {
+		switch entry.Action {
+		case models.ActionCreate, models.ActionSnapshot, models.ActionRevert:
+			if !anchored || entry.ItemVersion < oldestBase {
+				oldestBase = entry.ItemVersion
+			}
+			anchored = true
+		case models.ActionPatch:
+		default:
+			continue // Other actions don't produce versions
+		}
+		if entry.ItemVersion > current && !produced[entry.ItemVersion] {
+			ahead = append(ahead, entry.ItemVersion)
+		}
+		produced[entry.ItemVersion] = true
+	}
+	if !anchored {
+		return nil, ahead, false
+	}
+	for v := oldestBase + 1; v <= current; v++ {
+		if produced[v] {
+			continue
+		}
+		if n := len(gaps); n > 0 && gaps[n-1][1] == v-1 {
+			gaps[n-1][1] = v
+		} else {
+			gaps = append(gaps, [2]int{v, v})
+		}
+	}
+	return gaps, ahead, true
+}
+
+// versionRange formats an inclusive range of versions.
+func versionRange(r [2]int) string {
+	if r[0] == r[1] {
+		return fmt.Sprintf("v%d", r[0])
+	}
+	return fmt.Sprintf("v%d-v%d", r[0], r[1])
+}
+
+// bridgeHistoryGap makes versions after a gap replayable again by snapshotting the last
+// version of the gap from its retained copy. Without one there is nothing to rebuild it
+// from.
+func (s *Service) bridgeHistoryGap(ctx context.Context, ownerUserID, itemID string, itemType models.ItemType, version int) error {
+	snapshotPath := generateSnapshotPath(itemID, itemType, version)
+	content, err := s.loadVersionContent(ctx, itemID, itemType, version)
+	if err == nil {
+		err = s.storage.UploadFile(ctx, snapshotPath, strings.NewReader(content), contentTypeFor(itemType))
+	}
+	if err != nil {
+		if !errors.Is(err, storage.ErrFileNotFound) {
+			slog.ErrorContext(ctx, "Error snapshotting retained version", "version", version, "itemType", itemType, "itemID", itemID, "error", err)
+		}
+		return err
+	}
+	snapshotLog := &models.HistoryLog{
+		UserID: ownerUserID, ItemID: itemID, ItemType: string(itemType),
+		Action:      models.ActionSnapshot,
+		Timestamp:   s.now().UTC(),
+		S3PathAfter: snapshotPath,
+		ItemVersion: version,
+	}
+	if _, err := s.db.LogAction(ctx, snapshotLog); err != nil {
+		slog.ErrorContext(ctx, "Error logging repair snapshot", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Bridged history gap with a snapshot", "itemType", itemType, "itemID", itemID, "version", version)
+	return nil
+}
+
+// restoreLiveContent uploads the content of the item's current version to its live path,
+// rebuilding it from history unless given. It gives up if the item changed meanwhile.
+func (s *Service) restoreLiveContent(ctx context.Context, meta models.ItemMeta, content string) error {
+	itemID, itemType, s3Path := meta.GetID(), meta.Type(), meta.GetS3Path()
+	current, err := s.loadItemMeta(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	version := meta.GetVersion()
+	if current.GetVersion() != version || current.GetS3Path() != s3Path {
+		return errors.New("item changed during the check")
+	}
+
+	if content == "" {
+		content, err = s.reconstructVersion(ctx, itemID, itemType, version)
+		if err != nil {
+			slog.WarnContext(ctx, "Can't restore item, failed to rebuild version", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+			return err
+		}
+	}
+	if err := s.storage.UploadFile(ctx, s3Path, strings.NewReader(content), contentTypeFor(itemType)); err != nil {
+		slog.ErrorContext(ctx, "Error restoring live content", "itemType", itemType, "itemID", itemID, "version", version, "s3Path", s3Path, "error", err)
+		return err
+	}
+	_ = s.cache.InvalidateItemContent(ctx, itemID, itemType)
+	slog.InfoContext(ctx, "Restored live content", "itemType", itemType, "itemID", itemID, "version", version, "s3Path", s3Path)
+	return nil
+}
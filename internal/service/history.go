@@ -0,0 +1,151 @@
+// internal/service/history.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+)
+
+// CompactHistory enforces the history retention policy: for every item, patch entries
+// older than the configured retention are deleted and replaced by a snapshot of the
+// newest version they produced. Creates, snapshots and all other entries are kept, so
+// older versions stay reachable at snapshot granularity and newer ones are unaffected.
+// With dryRun nothing is written.
+func (s *Service) CompactHistory(ctx context.Context, dryRun bool) (*models.HistoryCompactionReport, error) {
+	report := &models.HistoryCompactionReport{DryRun: dryRun}
+	if s.cfg.History.PatchRetention <= 0 {
+		return report, nil // History is kept forever
+	}
+	report.Cutoff = s.now().UTC().Add(-s.cfg.History.PatchRetention)
+
+	err := s.forEachItemPage(ctx, func(metas []models.ItemMeta) error {
+		for _, meta := range metas {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			itemID, itemType := meta.GetID(), meta.Type()
+			report.ItemsScanned++
+			if err := s.compactItemHistory(ctx, meta.GetUserID(), itemID, itemType, report); err != nil {
+				slog.InfoContext(ctx, "Skipping history compaction", "itemType", itemType, "itemID", itemID, "error", err)
+				report.ItemsSkipped++
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// compactItemHistory collapses one item's expired patch entries and adds what it did
+// (or, on a dry run, would do) to report. The snapshots it stores are charged to
+// ownerUserID.
+func (s *Service) compactItemHistory(ctx context.Context, ownerUserID, itemID string, itemType models.ItemType, report *models.HistoryCompactionReport) error {
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if err != nil {
+		return fmt.Errorf("failed to load history: %w", err)
+	}
+
+	// 1. Find the expired patches and the newest version they produced
+	var expired []models.HistoryLog
+	expiredIDs := make(map[string]bool)
+	collapseTo := 0
+	for _, entry := range history {
+		if entry.Action == models.ActionPatch && entry.Timestamp.Before(report.Cutoff) {
+			expired = append(expired, entry)
+			expiredIDs[entry.ID] = true
+			collapseTo = max(collapseTo, entry.ItemVersion)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	// 2. Work out the snapshots that keep later versions replayable: one at collapseTo,
+	// plus one for each later revert whose target is, or is rebuilt from, an expired patch
+	type snapshot struct {
+		version int
+		at      *models.HistoryLog // Entry the snapshot is dated and attributed after
+	}
+	var snapshots []snapshot
+	snapshotted := make(map[int]bool)
+	for i := range history {
+		entry := &history[i]
+		if entry.Action == models.ActionSnapshot {
+			snapshotted[entry.ItemVersion] = true
+		}
+	}
+	for i := range history { // Newest first, so the first match is the last patch of the version
+		entry := &history[i]
+		if entry.Action == models.ActionPatch && entry.ItemVersion == collapseTo {
+			if !snapshotted[collapseTo] {
+				snapshots = append(snapshots, snapshot{version: collapseTo, at: entry})
+				snapshotted[collapseTo] = true
+			}
+			break
+		}
+	}
+	for i := range history {
+		entry := &history[i]
+		if entry.Action != models.ActionRevert || entry.ItemVersion <= collapseTo || entry.RevertedToLogID == nil || snapshotted[entry.ItemVersion] {
+			continue
+		}
+		if !expiredIDs[*entry.RevertedToLogID] {
+			target, err := s.db.GetHistoryLogByID(ctx, *entry.RevertedToLogID)
+			if err != nil || target.ItemVersion >= collapseTo ||
+				target.Action == models.ActionCreate || target.Action == models.ActionSnapshot {
+				continue // Unaffected (or already unreplayable)
+			}
+		}
+		snapshots = append(snapshots, snapshot{version: entry.ItemVersion, at: entry})
+		snapshotted[entry.ItemVersion] = true
+	}
+
+	// 3. Rebuild every snapshot's content before anything is changed
+	contents := make([]string, len(snapshots))
+	for i, snap := range snapshots {
+		contents[i], err = s.reconstructVersion(ctx, itemID, itemType, snap.version)
+		if err != nil {
+			if errors.Is(err, ErrVersionNotAvailable) {
+				return fmt.Errorf("v%d can't be rebuilt from history", snap.version)
+			}
+			return fmt.Errorf("failed to rebuild v%d: %w", snap.version, err)
+		}
+	}
+
+	report.ItemsCompacted++
+	report.PatchesRemoved += len(expired)
+	report.SnapshotsCreated += len(snapshots)
+	if report.DryRun {
+		return nil
+	}
+
+	// 4. Store the snapshots, then drop the patches; a failure leaves extra history, never less
+	contentType := "text/plain"
+	if itemType == models.ItemTypePost {
+		contentType = "text/markdown"
+	}
+	for i, snap := range snapshots {
+		snapshotPath := generateSnapshotPath(itemID, itemType, snap.version)
+		if err := s.storage.UploadFile(ctx, snapshotPath, strings.NewReader(contents[i]), contentType); err != nil {
+			return fmt.Errorf("failed to store snapshot of v%d: %w", snap.version, err)
+		}
+		s.chargeRetained(ctx, ownerUserID, itemID, itemType, int64(len(contents[i])))
+		snapshotLog := &models.HistoryLog{
+			UserID: snap.at.UserID, ItemID: itemID, ItemType: string(itemType),
+			Action:      models.ActionSnapshot,
+			Timestamp:   snap.at.Timestamp, // Keeps the entry where the version was made
+			S3PathAfter: snapshotPath,
+			ItemVersion: snap.version,
+		}
+		if _, err := s.db.LogAction(ctx, snapshotLog); err != nil {
+			return fmt.Errorf("failed to log snapshot of v%d: %w", snap.version, err)
+		}
+	}
+	if err := s.db.DeleteHistoryLogs(ctx, expired); err != nil {
+		return fmt.Errorf("failed to delete expired patches: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// internal/service/hooks.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/hooks"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"time"
+)
+
+// syncHookTimeout bounds each sync hook, since it holds up the write that triggered it.
+const syncHookTimeout = 5 * time.Second
+
+// RegisterHook adds a content hook, run on every create and content update from then on.
+// Call it before serving requests.
+func (s *Service) RegisterHook(h hooks.Hook) {
+	s.contentHooks = append(s.contentHooks, h)
+}
+
+func (s *Service) hookByName(name string) hooks.Hook {
+	for _, h := range s.contentHooks {
+		if h.Name() == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// hookJob is the payload of a hook.run job.
+type hookJob struct {
+	Hook     string          `json:"hook"`
+	ItemID   string          `json:"itemId"`
+	ItemType models.ItemType `json:"itemType"`
+	Version  int             `json:"version"`
+	Action   string          `json:"action"`
+	UserID   string          `json:"userId"`
+}
+
+// runHooks runs the sync hooks for a new version of an item and queues the async ones.
+// Hook failures never fail the write.
+func (s *Service) runHooks(ctx context.Context, userID, itemID string, itemType models.ItemType, version int, action, content string) {
+	var ev *hooks.Event
+	for _, h := range s.contentHooks {
+		if !h.Handles(itemType) {
+			continue
+		}
+		if h.Async() {
+			payload := hookJob{Hook: h.Name(), ItemID: itemID, ItemType: itemType, Version: version, Action: action, UserID: userID}
+			jobID := fmt.Sprintf("hook:%s:%s:%s:v%d", h.Name(), itemType, itemID, version)
+			if err := s.enqueueJob(ctx, jobRunHook, payload, jobs.WithID(jobID)); err != nil {
+				slog.WarnContext(ctx, "Failed to queue hook", "hook", h.Name(), "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+			}
+			continue
+		}
+
+		if ev == nil {
+			var err error
+			if ev, err = s.hookEvent(ctx, userID, itemID, itemType, version, action, content); err != nil {
+				slog.WarnContext(ctx, "Skipping hooks", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+				return
+			}
+		}
+		hookCtx, cancel := context.WithTimeout(ctx, syncHookTimeout)
+		findings, err := h.Process(hookCtx, ev)
+		cancel()
+		s.saveHookResult(ctx, h, ev, findings, err)
+	}
+}
+
+// hookEvent describes an item version for hooks.
+func (s *Service) hookEvent(ctx context.Context, userID, itemID string, itemType models.ItemType, version int, action, content string) (*hooks.Event, error) {
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	ev := &hooks.Event{
+		ItemID: itemID, ItemType: itemType, Version: version, Action: action,
+		UserID: userID, Content: content,
+	}
+	switch m := meta.(type) {
+	case *models.Post:
+		ev.Name = m.Title
+	case *models.CodeFile:
+		ev.Name, ev.Language = codeFilePath(m), m.Language
+	}
+	return ev, nil
+}
+
+func (s *Service) saveHookResult(ctx context.Context, h hooks.Hook, ev *hooks.Event, findings []models.HookFinding, hookErr error) {
+	result := &models.HookResult{
+		ItemID: ev.ItemID, ItemType: string(ev.ItemType), Hook: h.Name(),
+		Version: ev.Version, Findings: findings, CheckedAt: s.now().UTC(),
+	}
+	if result.Findings == nil {
+		result.Findings = []models.HookFinding{}
+	}
+	if hookErr != nil {
+		slog.WarnContext(ctx, "Hook failed", "hook", h.Name(), "itemType", ev.ItemType, "itemID", ev.ItemID, "version", ev.Version, "error", hookErr)
+		result.Error = "hook failed to run"
+	}
+	if err := s.db.SaveHookResult(ctx, result); err != nil {
+		slog.WarnContext(ctx, "Failed to save hook result", "hook", h.Name(), "itemType", ev.ItemType, "itemID", ev.ItemID, "error", err)
+	}
+}
+
+// runHookJob runs an async hook on the version that queued it. It does nothing if the
+// item has moved on, since the newer version queued its own run.
+func (s *Service) runHookJob(ctx context.Context, job *jobs.Job) error {
+	var payload hookJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	h := s.hookByName(payload.Hook)
+	if h == nil {
+		return jobs.Permanent(fmt.Errorf("unknown hook %q", payload.Hook))
+	}
+
+	meta, err := s.getItemMetaWithCache(ctx, payload.ItemID, payload.ItemType)
+	if err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			return nil // Deleted since
+		}
+		return err
+	}
+	if meta.GetVersion() != payload.Version {
+		return nil
+	}
+	content, err := s.getItemContentFromSource(ctx, payload.ItemID, payload.ItemType, payload.Version, meta.GetS3Path())
+	if err != nil {
+		return err
+	}
+	ev, err := s.hookEvent(ctx, payload.UserID, payload.ItemID, payload.ItemType, payload.Version, payload.Action, content)
+	if err != nil {
+		return err
+	}
+
+	findings, err := h.Process(ctx, ev)
+	if err != nil && job.Attempts < job.MaxAttempts {
+		return err // Retry before recording a failure
+	}
+	s.saveHookResult(ctx, h, ev, findings, err)
+	return nil
+}
+
+// ListHookResults returns the latest findings of each hook for an item. Requires viewer
+// access.
+func (s *Service) ListHookResults(ctx context.Context, userID, itemID, itemTypeStr string) ([]models.HookResult, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	results, err := s.db.ListHookResults(ctx, itemID, itemTypeStr)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing hook results", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to list hook results")
+	}
+	if results == nil {
+		results = []models.HookResult{}
+	}
+	return results, nil
+}
+
+// deleteHookResults removes all hook results of an item, e.g. when it is purged.
+func (s *Service) deleteHookResults(ctx context.Context, itemID string, itemType models.ItemType) {
+	if err := s.db.DeleteHookResults(ctx, itemID, string(itemType)); err != nil {
+		slog.WarnContext(ctx, "Failed to delete hook results", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+}
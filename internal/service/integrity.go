@@ -0,0 +1,74 @@
+// internal/service/integrity.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+// ErrIntegrity means content read from storage doesn't match the hash recorded when it
+// was written, i.e. it was corrupted or replaced behind the service's back. It is only
+// returned with Storage.VerifyReads.
+var ErrIntegrity = apperr.New(apperr.Integrity, "stored content failed its integrity check")
+
+// errContentMoved means content read for a version of an item didn't belong to it any
+// more: the item was written meanwhile, replacing the object. The read starts over.
+var errContentMoved = apperr.New(apperr.Conflict, "content changed while it was read; try again")
+
+// contentReadAttempts bounds how often a read starts over because the item was written
+// meanwhile.
+const contentReadAttempts = 3
+
+var integrityFailures = metrics.Default.Counter("blog_content_integrity_failures_total",
+	"Content reads whose content didn't match the hash recorded in the item's metadata.", "item_type")
+
+// verifyContent checks content downloaded from s3Path against the hash its item recorded
+// for version, if reads are verified and a hash was recorded. On a mismatch the item is
+// read again: if it has moved on, a write replaced the object after its metadata was
+// read, and errContentMoved is returned. Otherwise the mismatch is logged and reported,
+// since someone has to restore the object (fsck -deep -repair can, from history).
+func (s *Service) verifyContent(ctx context.Context, itemID string, itemType models.ItemType, version int, s3Path, hash, content string) error {
+	if !s.cfg.Storage.VerifyReads || hash == "" {
+		return nil
+	}
+	actual := contentHash(content)
+	if actual == hash {
+		return nil
+	}
+	current, err := s.loadItemMeta(ctx, itemID, itemType)
+	if err != nil {
+		return fmt.Errorf("failed to recheck item after a hash mismatch: %w", err)
+	}
+	if current.GetVersion() != version || current.GetContentHash() != hash || current.GetS3Path() != s3Path {
+		slog.DebugContext(ctx, "Item was written while its content was read", "itemType", itemType, "itemID", itemID, "version", version, "currentVersion", current.GetVersion())
+		return errContentMoved
+	}
+	integrityFailures.Inc(string(itemType))
+	slog.ErrorContext(ctx, "CRITICAL INCONSISTENCY: Stored content doesn't match its recorded hash", "itemType", itemType, "itemID", itemID, "version", version, "s3Path", s3Path, "expectedHash", hash, "actualHash", actual)
+	errreport.Error(ctx, "Stored content doesn't match its recorded hash", ErrIntegrity, "itemType", itemType, "itemID", itemID, "version", version, "s3Path", s3Path)
+	return ErrIntegrity
+}
+
+// loadCurrentContent loads the content of meta's item at its current version, starting
+// over with fresh metadata if the item is written while it's read. It returns the
+// metadata the content belongs to.
+func (s *Service) loadCurrentContent(ctx context.Context, itemID string, itemType models.ItemType, meta models.ItemMeta) (string, models.ItemMeta, error) {
+	for attempt := 1; ; attempt++ {
+		content, err := s.loadItemContent(ctx, itemID, itemType, meta.GetVersion(), meta.GetS3Path(), meta.GetContentHash())
+		if !errors.Is(err, errContentMoved) || attempt == contentReadAttempts {
+			return content, meta, err
+		}
+		if meta, err = s.loadItemMeta(ctx, itemID, itemType); err != nil {
+			return "", nil, err
+		}
+		if meta.IsTrashed() {
+			return "", nil, ErrItemNotFound
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// internal/service/interfaces.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/runner"
+)
+
+// The service's features are grouped into the interfaces below, so handlers depend on
+// the ones they use rather than on all of Service, and tests can fake only those.
+// *Service implements them all; Services hands them out.
+
+// AuthService registers and signs in users, and decides what they may access.
+type AuthService interface {
+	RegisterUser(ctx context.Context, username, password string) (*models.User, error)
+	LoginUser(ctx context.Context, username, password string) (string, *models.User, error) // Returns a JWT
+	IsAdmin(userID string) bool
+	CheckItemAccess(ctx context.Context, userID, itemID, itemTypeStr string, required models.Role) error
+	ResolveShareToken(ctx context.Context, token string) (*auth.ShareClaims, error)
+}
+
+// PostService creates posts and manages their metadata and publishing.
+type PostService interface {
+	CreatePost(ctx context.Context, userID, title, slug, initialContent string) (*models.Post, error)
+	ListUserPosts(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error)
+	GetPostDetails(ctx context.Context, postID string) (*models.Post, error)
+	UpdatePost(ctx context.Context, userID, postID string, req models.UpdatePostRequest) (*models.Post, error)
+	PublishPost(ctx context.Context, userID, postID string, version int) (*models.Post, error)
+	SchedulePost(ctx context.Context, userID, postID, publishAt, timezone string, version int) (*models.Post, error)
+	UnschedulePost(ctx context.Context, userID, postID string) (*models.Post, error)
+	SetPostSlug(ctx context.Context, userID, postID, slug string) (*models.Post, error)
+	SetPostExcerpt(ctx context.Context, userID, postID, excerpt string) (*models.Post, error)
+	SetPostCoverImage(ctx context.Context, userID, postID, assetID string) (*models.Post, error)
+	SetPostLanguage(ctx context.Context, userID, postID, language, translationOf string) (*models.Post, error)
+	SetPostCoAuthors(ctx context.Context, userID, postID string, coAuthors []string) (*models.Post, error)
+	PinPost(ctx context.Context, userID, postID string) (*models.Post, error)
+	UnpinPost(ctx context.Context, userID, postID string) (*models.Post, error)
+	SetPostOrder(ctx context.Context, userID string, postIDs []string) error
+	ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error)
+}
+
+// CodeFileService creates code files, manages their metadata, and formats and runs them.
+type CodeFileService interface {
+	CreateCodeFile(ctx context.Context, userID, fileName, language, initialContent string) (*models.CodeFile, error)
+	UploadCodeFile(ctx context.Context, userID, filePath, language string, content []byte) (*models.CodeFile, error)
+	ListUserCodeFiles(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error)
+	GetCodeFileDetails(ctx context.Context, fileID string) (*models.CodeFile, error)
+	RenameCodeFile(ctx context.Context, userID, fileID, newPath string) (*models.CodeFile, error)
+	MoveCodeFile(ctx context.Context, userID, fileID, projectID, newPath string) (*models.CodeFile, error)
+	ReplaceCodeFileContent(ctx context.Context, userID, fileID string, baseVersion int, content []byte) (int, []models.Change, error)
+	FormatCodeFile(ctx context.Context, userID, fileID string, baseVersion int) (int, []models.Change, error)
+	RunCodeFile(ctx context.Context, userID, fileID, stdin string) (*runner.Result, error)
+}
+
+// ContentService reads and changes the content of items of either type.
+type ContentService interface {
+	GetItemContent(ctx context.Context, userID, itemID string, itemTypeStr string) (content string, version int, err error)
+	GetItemContentAtVersion(ctx context.Context, userID, itemID, itemTypeStr string, version int) (string, error)
+	GetItemContentRange(ctx context.Context, userID, itemID, itemTypeStr string, req models.GetContentRangePayload) (*models.ContentRangePayload, error)
+	DownloadItem(ctx context.Context, userID, itemID, itemTypeStr string) (*ItemDownload, error)
+	ApplyItemChanges(ctx context.Context, userID, itemID, itemTypeStr string, baseVersion int, changes []models.Change) (newVersion int, appliedChanges []models.Change, err error)
+	MergeItemChanges(ctx context.Context, userID, itemID, itemTypeStr string, baseVersion int, changes []models.Change) (*MergeOutcome, error)
+	VersionConflictState(ctx context.Context, userID, itemID, itemTypeStr string, baseVersion int) (*models.VersionConflictPayload, error)
+	DiffItemVersions(ctx context.Context, userID, itemID, itemTypeStr string, fromVersion, toVersion int) (*models.VersionDiffPayload, error)
+	GetChangesSince(ctx context.Context, userID, itemID, itemTypeStr string, sinceVersion int) (*models.ChangesSincePayload, error)
+	DeleteItem(ctx context.Context, userID, itemID, itemTypeStr string) error
+}
+
+// HistoryService reads items' history and the events derived from it, and snapshots,
+// tags and reverts their versions.
+type HistoryService interface {
+	GetHistory(ctx context.Context, userID, itemID, itemTypeStr string, limit int) ([]models.HistoryLog, error)
+	ListItemEvents(ctx context.Context, userID, since string, limit int) (*models.ItemEventsPage, error)
+	RevertToAction(ctx context.Context, userID, targetLogID string) (newItemVersion int, err error)
+	RevertToTag(ctx context.Context, userID, itemID, itemTypeStr, name string) (int, error)
+	CreateSnapshot(ctx context.Context, userID, itemID, itemTypeStr, label string) (*models.HistoryLog, error)
+	TagVersion(ctx context.Context, userID, itemID, itemTypeStr, name string, version int, logID string) (*models.VersionTag, error)
+	ListVersionTags(ctx context.Context, userID, itemID, itemTypeStr string) ([]models.VersionTag, error)
+	DeleteVersionTag(ctx context.Context, userID, itemID, itemTypeStr, name string) error
+}
+
+// UsageService counts users' API usage against their daily quotas and reports it.
+type UsageService interface {
+	CountRequest(ctx context.Context, userID, keyID string) bool
+	CountWSMessage(ctx context.Context, userID, keyID string) bool
+	GetUsage(ctx context.Context, userID string, days int) (*models.Usage, error)
+}
+
+// MaintenanceService tells whether changes are paused for maintenance.
+type MaintenanceService interface {
+	Maintenance() *models.MaintenanceStatus
+	CheckWritable() error
+}
+
+var (
+	_ AuthService        = (*Service)(nil)
+	_ PostService        = (*Service)(nil)
+	_ CodeFileService    = (*Service)(nil)
+	_ ContentService     = (*Service)(nil)
+	_ HistoryService     = (*Service)(nil)
+	_ UsageService       = (*Service)(nil)
+	_ MaintenanceService = (*Service)(nil)
+)
+
+// Services is the composition root of the service layer: the implementation of each
+// interface, for building handlers from.
+type Services struct {
+	Auth      AuthService
+	Posts     PostService
+	CodeFiles CodeFileService
+	Content   ContentService
+	History   HistoryService
+	Usage     UsageService
+	// Maintenance is consulted before changes from any of the others
+	Maintenance MaintenanceService
+	// Core serves the features that have no interface of their own yet (workspaces,
+	// comments, admin tasks and so on).
+	Core *Service
+}
+
+// NewServices returns s behind each of its interfaces.
+func NewServices(s *Service) *Services {
+	return &Services{Auth: s, Posts: s, CodeFiles: s, Content: s, History: s, Usage: s, Maintenance: s, Core: s}
+}
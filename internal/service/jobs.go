@@ -0,0 +1,259 @@
+// internal/service/jobs.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/audit"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"time"
+)
+
+// Background job types
+const (
+	jobLogHistory       = "history.log"      // Retry of a failed history write
+	jobCreateSnapshot   = "snapshot.create"  // Snapshot copy of an item version
+	jobPurgeTrash       = "trash.purge"      // Scheduled: PurgeExpiredTrash
+	jobCompactHistory   = "history.compact"  // Scheduled: CompactHistory
+	jobCompactJournal   = "journal.compact"  // Scheduled: CompactJournal
+	jobCompactVersions  = "versions.compact" // Scheduled: CompactVersions
+	jobRepairWrite      = "write.repair"     // An interrupted content write
+	jobRepairWrites     = "write.sweep"      // Scheduled: RepairWrites
+	jobRunHook          = "hook.run"         // An async content hook on one item version
+	jobPublishPost      = "post.publish"     // A scheduled publish of one post
+	jobPublishDuePosts  = "post.sweep"       // Scheduled: queues a post.publish per due post
+	jobSendPush         = "push.send"        // A notification to one user's browsers
+	jobSendNotifyMail   = "notify.mail"      // A notification by email to one user
+	jobDigestSweep      = "digest.sweep"     // Scheduled: queues a digest.send per user
+	jobSendDigest       = "digest.send"      // One user's activity digest
+	jobBuildDataExport  = "export.build"     // One user's data export archive
+	jobExpireDataExport = "export.expire"    // Deletion of a data export once it expires
+	jobBuildStaticSite  = "site.build"       // One user's static site archive
+	jobExpireStaticSite = "site.expire"      // Deletion of a static site archive once it expires
+	jobRecheckDomains   = "domains.recheck"  // Scheduled: re-verifies every verified domain
+	jobMoveAnchors      = "anchors.move"     // Moves the comment anchors of one item after it changes
+)
+
+// longJobTimeout bounds the jobs that walk every user or build an archive, which can
+// outlive the queue's lease; their lease is renewed while they run.
+const longJobTimeout = 2 * time.Hour
+
+var errNoJobQueue = errors.New("job queue not configured")
+
+// UseJobQueue registers the service's job handlers and schedules on q and sends
+// background work to it from then on. Call it before q.Run.
+func (s *Service) UseJobQueue(q *jobs.Queue) {
+	s.jobs = q
+	q.Handle(jobLogHistory, s.pauseInMaintenance(s.runLogHistoryJob))
+	q.Handle(jobCreateSnapshot, s.pauseInMaintenance(s.runSnapshotJob))
+	q.Handle(jobPurgeTrash, s.pauseInMaintenance(s.runPurgeTrashJob), jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobCompactHistory, s.pauseInMaintenance(s.runCompactHistoryJob), jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobCompactJournal, s.pauseInMaintenance(s.runCompactJournalJob), jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobCompactVersions, s.pauseInMaintenance(s.runCompactVersionsJob), jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobRepairWrite, s.pauseInMaintenance(s.runRepairWriteJob))
+	q.Handle(jobRepairWrites, s.pauseInMaintenance(s.runRepairWritesJob), jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobRunHook, s.runHookJob)
+	q.Handle(jobPublishPost, s.pauseInMaintenance(s.runPublishPostJob))
+	q.Handle(jobPublishDuePosts, s.pauseInMaintenance(s.runPublishDuePostsJob))
+	q.Handle(jobSendPush, s.runSendPushJob)
+	q.Handle(jobSendNotifyMail, s.runSendNotifyMailJob)
+	q.Handle(jobDigestSweep, s.runDigestSweepJob, jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobSendDigest, s.runSendDigestJob)
+	q.Handle(jobBuildDataExport, s.runBuildDataExportJob, jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobExpireDataExport, s.runExpireDataExportJob)
+	q.Handle(jobBuildStaticSite, s.runBuildStaticSiteJob, jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobExpireStaticSite, s.runExpireStaticSiteJob)
+	q.Handle(jobRecheckDomains, s.runRecheckDomainsJob, jobs.WithTimeout(longJobTimeout))
+	q.Handle(jobMoveAnchors, s.pauseInMaintenance(s.runMoveAnchorsJob))
+
+	q.Every(jobRepairWrites, writeRepairInterval)
+	q.Every(jobPublishDuePosts, scheduleSweepInterval)
+
+	if s.cfg.Trash.Retention > 0 {
+		q.Every(jobPurgeTrash, s.cfg.Trash.PurgeInterval)
+	} else {
+		slog.Info("Trash purging disabled")
+	}
+	if s.cfg.History.PatchRetention > 0 {
+		q.Every(jobCompactHistory, s.cfg.History.CompactionInterval)
+	} else {
+		slog.Info("History compaction disabled")
+	}
+	if s.cfg.Journal.MaxVersions > 0 || s.cfg.Journal.Retention > 0 {
+		q.Every(jobCompactJournal, s.cfg.Journal.CompactionInterval)
+	} else {
+		slog.Info("Journal compaction disabled")
+	}
+	if s.cfg.Snapshot.RetainVersions && s.cfg.Snapshot.CompactionInterval > 0 {
+		q.Every(jobCompactVersions, s.cfg.Snapshot.CompactionInterval)
+	} else {
+		slog.Info("Version compaction disabled")
+	}
+	if s.mailer != nil && s.cfg.Digest.IntervalDays > 0 {
+		q.Every(jobDigestSweep, time.Duration(s.cfg.Digest.IntervalDays)*24*time.Hour)
+	} else {
+		slog.Info("Activity digests disabled")
+	}
+	if s.cfg.Site.CustomDomains {
+		q.Every(jobRecheckDomains, domainRecheckInterval)
+	}
+}
+
+// enqueueJob adds a background job. The job outlives ctx's cancellation (e.g. the end of
+// the request that queued it).
+func (s *Service) enqueueJob(ctx context.Context, jobType string, payload interface{}, opts ...jobs.EnqueueOption) error {
+	if s.jobs == nil {
+		return errNoJobQueue
+	}
+	return s.jobs.Enqueue(context.WithoutCancel(ctx), jobType, payload, opts...)
+}
+
+// historyLogJob is the payload of a history.log job. The S3 paths and event number are
+// carried separately because HistoryLog leaves them out of its JSON.
+type historyLogJob struct {
+	Entry        models.HistoryLog `json:"entry"`
+	S3PathBefore string            `json:"s3PathBefore,omitempty"`
+	S3PathAfter  string            `json:"s3PathAfter,omitempty"`
+	EventSeq     int64             `json:"eventSeq,omitempty"`
+}
+
+// logAction writes a history entry, numbering it if it's an item event, exports it to
+// the audit sinks and tells the item hooks. If the write fails it is retried in the
+// background rather than lost; retries reuse the entry's ID and number, so they can't
+// duplicate it.
+func (s *Service) logAction(ctx context.Context, entry *models.HistoryLog) {
+	err := s.numberEvent(ctx, entry)
+	if err == nil {
+		_, err = s.db.LogAction(ctx, entry)
+	}
+	s.auditLog.Export(ctx, audit.HistoryEvent(entry)) // Even if the write is left to the retry
+	s.notifyItemHooks(ctx, entry)
+	if err == nil {
+		return
+	}
+	payload := historyLogJob{Entry: *entry, S3PathBefore: entry.S3PathBefore, S3PathAfter: entry.S3PathAfter, EventSeq: entry.EventSeq}
+	if qErr := s.enqueueJob(ctx, jobLogHistory, payload); qErr != nil {
+		slog.WarnContext(ctx, "Failed to log history (retry not queued)", "action", entry.Action, "itemType", entry.ItemType, "itemID", entry.ItemID, "error", err, "queueError", qErr)
+		return
+	}
+	slog.WarnContext(ctx, "Failed to log history, queued for retry", "action", entry.Action, "itemType", entry.ItemType, "itemID", entry.ItemID, "error", err)
+}
+
+func (s *Service) runLogHistoryJob(ctx context.Context, job *jobs.Job) error {
+	var payload historyLogJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	entry := payload.Entry
+	entry.S3PathBefore, entry.S3PathAfter = payload.S3PathBefore, payload.S3PathAfter
+	entry.EventSeq = payload.EventSeq
+	if err := s.numberEvent(ctx, &entry); err != nil {
+		return err
+	}
+	_, err := s.db.LogAction(ctx, &entry)
+	return err
+}
+
+// snapshotJob is the payload of a snapshot.create job.
+type snapshotJob struct {
+	UserID   string          `json:"userId"`
+	ItemID   string          `json:"itemId"`
+	ItemType models.ItemType `json:"itemType"`
+	Version  int             `json:"version"`
+	At       time.Time       `json:"at"`
+}
+
+// scheduleSnapshot queues a snapshot of an item's content at version.
+func (s *Service) scheduleSnapshot(ctx context.Context, userID, itemID string, itemType models.ItemType, version int) {
+	payload := snapshotJob{UserID: userID, ItemID: itemID, ItemType: itemType, Version: version, At: s.now().UTC()}
+	jobID := fmt.Sprintf("snapshot:%s:%s:v%d", itemType, itemID, version)
+	if err := s.enqueueJob(ctx, jobCreateSnapshot, payload, jobs.WithID(jobID)); err != nil {
+		slog.WarnContext(ctx, "Failed to schedule snapshot", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+	}
+}
+
+// runSnapshotJob stores the content of the version at its snapshot key and logs the
+// snapshot.
+func (s *Service) runSnapshotJob(ctx context.Context, job *jobs.Job) error {
+	var payload snapshotJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	itemID, itemType, version := payload.ItemID, payload.ItemType, payload.Version
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			return nil // Deleted since; nothing to snapshot
+		}
+		return err
+	}
+
+	snapshotPath, err := s.storeSnapshot(ctx, meta.GetUserID(), itemID, itemType, version)
+	if errors.Is(err, ErrVersionNotAvailable) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshotLog := &models.HistoryLog{
+		UserID: payload.UserID, ItemID: itemID, ItemType: string(itemType),
+		Action:      models.ActionSnapshot,
+		Timestamp:   payload.At,   // When the version was written, not when the job ran
+		S3PathAfter: snapshotPath, // Immutable copy of the content at this version
+		ItemVersion: version,
+	}
+	_, err = s.db.LogAction(ctx, snapshotLog)
+	return err
+}
+
+func (s *Service) runPurgeTrashJob(ctx context.Context, job *jobs.Job) error {
+	n, err := s.PurgeExpiredTrash(ctx)
+	if n > 0 {
+		slog.InfoContext(ctx, "Purged expired items from the trash", "count", n)
+	}
+	return err
+}
+
+func (s *Service) runCompactHistoryJob(ctx context.Context, job *jobs.Job) error {
+	report, err := s.CompactHistory(ctx, false)
+	if report != nil && (report.PatchesRemoved > 0 || report.ItemsSkipped > 0) {
+		slog.InfoContext(ctx, "Compacted history", "patchesRemoved", report.PatchesRemoved, "itemsCompacted", report.ItemsCompacted, "snapshotsCreated", report.SnapshotsCreated, "itemsSkipped", report.ItemsSkipped)
+	}
+	return err
+}
+
+func (s *Service) runCompactJournalJob(ctx context.Context, job *jobs.Job) error {
+	n, err := s.CompactJournal(ctx)
+	if n > 0 {
+		slog.InfoContext(ctx, "Compacted change journal", "itemsCompacted", n)
+	}
+	return err
+}
+
+func (s *Service) runCompactVersionsJob(ctx context.Context, job *jobs.Job) error {
+	report, err := s.CompactVersions(ctx, false)
+	if report != nil && (report.VersionsRewritten > 0 || report.ItemsSkipped > 0) {
+		slog.InfoContext(ctx, "Compacted retained versions", "versionsRewritten", report.VersionsRewritten, "itemsCompacted", report.ItemsCompacted, "bytesSaved", report.BytesSaved, "itemsSkipped", report.ItemsSkipped)
+	}
+	return err
+}
+
+func (s *Service) runRepairWriteJob(ctx context.Context, job *jobs.Job) error {
+	var intent models.WriteIntent
+	if err := job.Decode(&intent); err != nil {
+		return jobs.Permanent(err)
+	}
+	return s.repairWrite(ctx, &intent)
+}
+
+func (s *Service) runRepairWritesJob(ctx context.Context, job *jobs.Job) error {
+	n, err := s.RepairWrites(ctx)
+	if n > 0 {
+		slog.InfoContext(ctx, "Repaired interrupted content writes", "count", n)
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+// internal/service/journal.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// journalPageSize is how many entries compaction reads at a time while looking for the
+// end of an item's expired entries.
+const journalPageSize = 500
+
+// recordJournal writes the journal entry of the version a write produced. A failure is
+// logged and otherwise ignored: the journal is a shortcut, and readers fall back to the
+// history when a version is missing from it.
+func (s *Service) recordJournal(ctx context.Context, intent *models.WriteIntent, version int, now time.Time) {
+	entry := &models.JournalEntry{
+		ItemID: intent.ItemID, ItemType: intent.ItemType, Version: version,
+		UserID: intent.UserID, Action: intent.Action, CreatedAt: now,
+	}
+	switch intent.Action {
+	case models.ActionPatch:
+		entry.Changes = intent.Changes
+	case models.ActionRevert:
+		target, err := s.db.GetHistoryLogByID(ctx, intent.RevertedToLogID)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to look up revert target for the journal", "itemType", intent.ItemType, "itemID", intent.ItemID, "logID", intent.RevertedToLogID, "error", err)
+			return
+		}
+		entry.RevertedTo = target.ItemVersion
+	default:
+		return
+	}
+	if err := s.db.AppendJournal(ctx, entry); err != nil {
+		slog.WarnContext(ctx, "Failed to write journal entry", "itemType", intent.ItemType, "itemID", intent.ItemID, "version", version, "error", err)
+	}
+}
+
+// journalChangesSince returns the batches of changes that took an item from sinceVersion
+// to headVersion, oldest first, from the journal. It returns ErrVersionNotAvailable if a
+// version in between isn't a journaled patch or if there are more than limit changes.
+func (s *Service) journalChangesSince(ctx context.Context, itemID string, itemType models.ItemType, sinceVersion, headVersion, limit int) ([]models.VersionChanges, error) {
+	entries, err := s.db.ListJournal(ctx, itemID, string(itemType), sinceVersion, headVersion-sinceVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load journal: %w", err)
+	}
+	batches := make([]models.VersionChanges, 0, len(entries))
+	total := 0
+	for i, entry := range entries {
+		if entry.Version != sinceVersion+1+i || entry.Action != models.ActionPatch {
+			return nil, ErrVersionNotAvailable
+		}
+		if total += len(entry.Changes); total > limit {
+			return nil, ErrVersionNotAvailable
+		}
+		batches = append(batches, models.VersionChanges{Version: entry.Version, Changes: entry.Changes})
+	}
+	if len(batches) != headVersion-sinceVersion {
+		return nil, ErrVersionNotAvailable
+	}
+	return batches, nil
+}
+
+// deleteJournal drops all of an item's journal entries, when the item is purged.
+func (s *Service) deleteJournal(ctx context.Context, itemID string, itemType models.ItemType) {
+	if err := s.db.DeleteJournal(ctx, itemID, string(itemType), math.MaxInt); err != nil {
+		slog.WarnContext(ctx, "Failed to delete journal while purging", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+}
+
+// CompactJournal drops the journal entries of every item that are past the configured
+// limits: more than MaxVersions behind the item's version, or older than Retention. It
+// returns how many items it compacted.
+func (s *Service) CompactJournal(ctx context.Context) (int, error) {
+	maxVersions, retention := s.cfg.Journal.MaxVersions, s.cfg.Journal.Retention
+	if maxVersions <= 0 && retention <= 0 {
+		return 0, nil // The journal is kept forever
+	}
+	cutoff := s.now().UTC().Add(-retention)
+
+	compacted := 0
+	err := s.forEachItemPage(ctx, func(metas []models.ItemMeta) error {
+		for _, meta := range metas {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			itemID, itemType := meta.GetID(), meta.Type()
+
+			keepFrom := 0 // Oldest version to keep
+			if maxVersions > 0 {
+				keepFrom = meta.GetVersion() - maxVersions + 1
+			}
+			if retention > 0 {
+				expiredTo, err := s.expiredJournalVersion(ctx, itemID, itemType, cutoff)
+				if err != nil {
+					slog.WarnContext(ctx, "Skipping journal compaction", "itemType", itemType, "itemID", itemID, "error", err)
+					continue
+				}
+				keepFrom = max(keepFrom, expiredTo+1)
+			}
+			if keepFrom <= 1 {
+				continue
+			}
+			if err := s.db.DeleteJournal(ctx, itemID, string(itemType), keepFrom); err != nil {
+				slog.WarnContext(ctx, "Failed to compact journal", "itemType", itemType, "itemID", itemID, "error", err)
+				continue
+			}
+			compacted++
+		}
+		return nil
+	})
+	return compacted, err
+}
+
+// expiredJournalVersion returns the newest version of an item whose journal entry was
+// written before cutoff, or 0 if there is none.
+func (s *Service) expiredJournalVersion(ctx context.Context, itemID string, itemType models.ItemType, cutoff time.Time) (int, error) {
+	expiredTo := 0
+	for {
+		entries, err := s.db.ListJournal(ctx, itemID, string(itemType), expiredTo, journalPageSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load journal: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.CreatedAt.Before(cutoff) {
+				return expiredTo, nil
+			}
+			expiredTo = entry.Version
+		}
+		if len(entries) < journalPageSize {
+			return expiredTo, nil
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// internal/service/maintenance.go
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Maintenance mode makes the server read-only, e.g. while its database is migrated:
+// requests and WebSocket messages that would change data are answered with a READ_ONLY
+// error (see CheckWritable), while reads, signing in and WebSocket subscriptions go on.
+// Admin requests are let through, so the mode can be switched off again. Background
+// jobs that write content (publishing, purging, compactions, ...) are paused too: see
+// pauseInMaintenance. The mode is kept in the cache's shared settings, so with Redis all
+// replicas switch together, each within maintenanceSyncInterval (see RunMaintenanceSync);
+// a server started with MAINTENANCE_MODE switches it on for all of them.
+//
+// Admins can also broadcast announcements to WebSocket clients, e.g. ahead of a
+// maintenance window; the API sends them, this only checks them.
+
+const (
+	defaultMaintenanceMessage = "The server is in maintenance mode; changes are paused for now"
+	maintenanceSettingKey     = "maintenance"
+	maintenanceSyncInterval   = 5 * time.Second
+	maintenanceJobDelay       = time.Minute
+	maxAnnouncementLength     = 1000 // Characters
+	maxAnnouncementItems      = 100
+)
+
+var (
+	ErrInvalidAnnouncement      = apperr.New(apperr.Validation, "announcement must be 1 to 1000 characters, for at most 100 items, each with a type and ID")
+	ErrInvalidAnnouncementLevel = apperr.New(apperr.Validation, "announcement level must be \"info\", \"warning\" or \"critical\"")
+)
+
+// newMaintenanceStatus returns the maintenance mode the server starts in.
+func newMaintenanceStatus(cfg *config.ServerConfig, now time.Time) *models.MaintenanceStatus {
+	if !cfg.MaintenanceMode {
+		return &models.MaintenanceStatus{}
+	}
+	return &models.MaintenanceStatus{Enabled: true, Message: maintenanceMessage(cfg.MaintenanceMessage), Since: now}
+}
+
+func maintenanceMessage(message string) string {
+	if message = strings.TrimSpace(message); message != "" {
+		return message
+	}
+	return defaultMaintenanceMessage
+}
+
+// Maintenance returns whether the server is in maintenance mode.
+func (s *Service) Maintenance() *models.MaintenanceStatus {
+	status := *s.maintenance.Load()
+	return &status
+}
+
+// SetMaintenance switches maintenance mode on or off for all replicas, as userID, an admin.
+func (s *Service) SetMaintenance(ctx context.Context, userID string, req *models.MaintenanceRequest) (*models.MaintenanceStatus, error) {
+	status := &models.MaintenanceStatus{Enabled: req.Enabled, Since: s.now().UTC(), By: userID}
+	if req.Enabled {
+		status.Message = maintenanceMessage(req.Message)
+	}
+	if err := s.shareMaintenance(ctx, status); err != nil {
+		return nil, err
+	}
+	prev := s.maintenance.Swap(status)
+	slog.InfoContext(ctx, "Maintenance mode switched", "enabled", status.Enabled, "wasEnabled", prev.Enabled, "by", userID)
+	return s.Maintenance(), nil
+}
+
+// InitMaintenance brings the server's maintenance mode in line with the shared one at
+// startup; call it before the job queue runs. A server started with MAINTENANCE_MODE
+// shares its own instead.
+func (s *Service) InitMaintenance(ctx context.Context) {
+	if !s.cfg.Server.MaintenanceMode {
+		s.syncMaintenance(ctx)
+		return
+	}
+	if err := s.shareMaintenance(ctx, s.maintenance.Load()); err != nil {
+		slog.ErrorContext(ctx, "Failed to share maintenance mode", "error", err)
+	}
+}
+
+// RunMaintenanceSync keeps the server's maintenance mode in line with the shared one
+// until ctx is cancelled, calling changed (if not nil) whenever another server switched it.
+func (s *Service) RunMaintenanceSync(ctx context.Context, changed func(*models.MaintenanceStatus)) {
+	ticker := time.NewTicker(maintenanceSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if status := s.syncMaintenance(ctx); status != nil && changed != nil {
+			changed(status)
+		}
+	}
+}
+
+// syncMaintenance loads the shared maintenance mode and returns it if it differs from
+// the server's, which it replaces, and nil otherwise.
+func (s *Service) syncMaintenance(ctx context.Context) *models.MaintenanceStatus {
+	value, err := s.sharedSettings.GetSetting(ctx, maintenanceSettingKey)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			slog.WarnContext(ctx, "Failed to load shared maintenance mode", "error", err)
+		}
+		return nil
+	}
+	var status models.MaintenanceStatus
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		slog.WarnContext(ctx, "Invalid shared maintenance mode", "error", err)
+		return nil
+	}
+	current := s.maintenance.Load()
+	if status.Enabled == current.Enabled && status.Message == current.Message && status.By == current.By && status.Since.Equal(current.Since) {
+		return nil
+	}
+	// Lose to a concurrent SetMaintenance, whose status is the newer one
+	if !s.maintenance.CompareAndSwap(current, &status) {
+		return nil
+	}
+	slog.InfoContext(ctx, "Maintenance mode switched by another server", "enabled", status.Enabled, "by", status.By)
+	return s.Maintenance()
+}
+
+func (s *Service) shareMaintenance(ctx context.Context, status *models.MaintenanceStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance mode: %w", err)
+	}
+	if err := s.sharedSettings.SetSetting(ctx, maintenanceSettingKey, string(data)); err != nil {
+		return fmt.Errorf("failed to share maintenance mode: %w", err)
+	}
+	return nil
+}
+
+// CheckWritable returns an error with code apperr.ReadOnly and the maintenance message
+// while the server is in maintenance mode, and nil otherwise.
+func (s *Service) CheckWritable() error {
+	if status := s.maintenance.Load(); status.Enabled {
+		return apperr.New(apperr.ReadOnly, status.Message)
+	}
+	return nil
+}
+
+// pauseInMaintenance wraps the handler of a job that writes content so that, while the
+// server is in maintenance mode, the job is postponed (a scheduled run is skipped).
+func (s *Service) pauseInMaintenance(h jobs.Handler) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		if err := s.CheckWritable(); err != nil {
+			return jobs.Postpone(err, maintenanceJobDelay) // Checked again then
+		}
+		return h(ctx, job)
+	}
+}
+
+// NewAnnouncement checks an admin's announcement and returns the payload to broadcast
+// (for each of its items, if it has any, with the item set).
+func (s *Service) NewAnnouncement(ctx context.Context, userID string, req *models.AnnouncementRequest) (*models.AnnouncementPayload, error) {
+	message := strings.TrimSpace(req.Message)
+	if message == "" || utf8.RuneCountInString(message) > maxAnnouncementLength || len(req.Items) > maxAnnouncementItems {
+		return nil, ErrInvalidAnnouncement
+	}
+	level := req.Level
+	switch level {
+	case "":
+		level = models.AnnouncementInfo
+	case models.AnnouncementInfo, models.AnnouncementWarning, models.AnnouncementCritical:
+	default:
+		return nil, ErrInvalidAnnouncementLevel
+	}
+	for _, item := range req.Items {
+		if !models.ItemType(item.ItemType).IsValid() {
+			return nil, ErrInvalidItemType
+		}
+		if item.ItemID == "" {
+			return nil, ErrInvalidAnnouncement
+		}
+	}
+	slog.InfoContext(ctx, "Admin announcement", "by", userID, "level", level, "items", len(req.Items))
+	return &models.AnnouncementPayload{Message: message, Level: level, SentAt: s.now().UTC()}, nil
+}
@@ -0,0 +1,123 @@
+// internal/service/merge.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// ErrMergeConflict is returned by MergeItemChanges when stale changes overlap edits made on the server.
+var ErrMergeConflict = apperr.New(apperr.Conflict, "changes conflict with newer edits")
+
+// maxMergeAttempts bounds how often a merge is retried when the head moves again mid-merge.
+const maxMergeAttempts = 3
+
+// MergeOutcome describes the result of MergeItemChanges.
+type MergeOutcome struct {
+	NewVersion     int
+	CurrentVersion int             // Server head the merge was computed against
+	Changes        []models.Change // Changes relative to the previous head, suitable for broadcast
+	Merged         bool            // True if the changes were rebased onto a newer head
+	Content        string          // Merged content (with conflict markers on ErrMergeConflict)
+	Conflicts      []diff.Conflict // Populated with ErrMergeConflict
+}
+
+// MergeItemChanges applies changes like ApplyItemChanges, but when baseVersion is stale it
+// three-way merges the client's edits with the server head instead of failing outright.
+// On overlapping edits it returns ErrMergeConflict together with the conflicting regions.
+func (s *Service) MergeItemChanges(ctx context.Context, userID, itemID, itemTypeStr string, baseVersion int, changes []models.Change) (*MergeOutcome, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	unlock, err := s.lockItemWrite(ctx, itemID, itemType) // Held across the merge, so the head can't move under it
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	newVersion, applied, err := s.applyItemChanges(ctx, userID, itemID, itemType, baseVersion, changes)
+	if err == nil {
+		return &MergeOutcome{NewVersion: newVersion, CurrentVersion: baseVersion, Changes: applied}, nil
+	}
+	if !errors.Is(err, ErrVersionConflict) || baseVersion > newVersion {
+		return nil, err // Only stale bases can be merged
+	}
+
+	// 1. Rebuild what the client started from and what it ended up with
+	baseContent, err := s.reconstructVersion(ctx, itemID, itemType, baseVersion)
+	if err != nil {
+		if errors.Is(err, ErrVersionNotAvailable) {
+			return &MergeOutcome{CurrentVersion: newVersion}, ErrVersionConflict // Nothing to merge from
+		}
+		return nil, fmt.Errorf("failed to load base version for merge: %w", err)
+	}
+	clientContent, err := applyChanges(baseContent, changes)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error applying changes to merge base", "baseVersion", baseVersion, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxMergeAttempts; attempt++ {
+		// 2. Merge against the current head
+		headContent, headVersion, err := s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+		if err != nil {
+			return nil, err
+		}
+		res := diff.Merge3(baseContent, headContent, clientContent, fmt.Sprintf("v%d", headVersion), "yours")
+		if !res.Clean() {
+			return &MergeOutcome{
+				CurrentVersion: headVersion,
+				Content:        res.Merged,
+				Conflicts:      res.Conflicts,
+			}, ErrMergeConflict
+		}
+
+		// 3. Apply the merge as ordinary changes on top of head
+		rebased := changesFromEdits(diff.Edits(headContent, res.Merged))
+		if len(rebased) == 0 {
+			// The server already has the same content; nothing new to write
+			return &MergeOutcome{NewVersion: headVersion, CurrentVersion: headVersion, Merged: true, Content: res.Merged}, nil
+		}
+		newVersion, applied, err = s.applyItemChanges(ctx, userID, itemID, itemType, headVersion, rebased)
+		if errors.Is(err, ErrVersionConflict) {
+			slog.InfoContext(ctx, "Head moved during merge, retrying", "itemType", itemType, "itemID", itemID, "attempt", attempt+1)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &MergeOutcome{
+			NewVersion:     newVersion,
+			CurrentVersion: headVersion,
+			Changes:        applied,
+			Merged:         true,
+			Content:        res.Merged,
+		}, nil
+	}
+
+	latest, _ := s.getItemVersion(ctx, itemID, itemType)
+	return &MergeOutcome{CurrentVersion: latest}, ErrVersionConflict
+}
+
+// changesFromEdits converts line edits into Changes. Edits are emitted last-to-first so
+// each change's line/column still refers to the original text when applied in order.
+func changesFromEdits(edits []diff.Edit) []models.Change {
+	changes := make([]models.Change, 0, len(edits))
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		changes = append(changes, models.Change{
+			Line:    e.Start,
+			Column:  0,
+			Text:    e.NewText,
+			Removed: utf8.RuneCountInString(e.OldText),
+		})
+	}
+	return changes
+}
@@ -0,0 +1,323 @@
+// internal/service/notifications.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/mail"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/webpush"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Users are notified through Web Push of what others do to their items: edits by
+// collaborators, shares and ownership offers, and of their scheduled posts going out.
+// Notifications are sent in the background to every browser the user subscribed, unless
+// they turned the type off. Mentions are also emailed to users with an email address.
+
+const (
+	maxPushSubscriptions = 20 // Per user; subscribing past it drops the oldest
+	maxUserAgentLength   = 256
+
+	// editNotifyWindow is how long further edits of an item by the same collaborator don't
+	// notify the owner again, so a session of typing is one notification.
+	editNotifyWindow = 30 * time.Minute
+)
+
+// emailedNotifications are the notification types also sent by email.
+var emailedNotifications = []string{models.NotifyMention}
+
+var (
+	ErrPushDisabled             = apperr.New(apperr.Unavailable, "web push notifications are disabled")
+	ErrInvalidPushSubscription  = webpush.ErrInvalidSubscription
+	ErrPushSubscriptionNotFound = apperr.New(apperr.NotFound, "push subscription not found")
+	ErrInvalidNotificationType  = apperr.New(apperr.Validation, "unknown notification type")
+)
+
+// UsePushSender sends notifications with sender from then on. Without one, nothing is sent
+// and subscribing fails with ErrPushDisabled.
+func (s *Service) UsePushSender(sender *webpush.Sender) {
+	s.push = sender
+}
+
+// PushPublicKey returns the VAPID public key browsers subscribe with.
+func (s *Service) PushPublicKey() (string, error) {
+	if s.push == nil {
+		return "", ErrPushDisabled
+	}
+	return s.push.PublicKey(), nil
+}
+
+// pushSubscriptionID derives a subscription's ID from its endpoint, which push services
+// make unique to it.
+func pushSubscriptionID(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SubscribePush saves a browser's push subscription for userID. Subscribing the same
+// endpoint again replaces it, also if another user had subscribed it.
+func (s *Service) SubscribePush(ctx context.Context, userID string, req *models.PushSubscriptionRequest, userAgent string) (*models.PushSubscription, error) {
+	if s.push == nil {
+		return nil, ErrPushDisabled
+	}
+	if err := webpush.CheckSubscription(req.Endpoint, req.Keys.P256dh, req.Keys.Auth); err != nil {
+		return nil, err
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	existing, err := s.db.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing push subscriptions", "userID", userID, "error", err)
+		return nil, errors.New("failed to save push subscription")
+	}
+	sub := &models.PushSubscription{
+		ID: pushSubscriptionID(req.Endpoint), UserID: userID, Endpoint: req.Endpoint,
+		P256dh: req.Keys.P256dh, Auth: req.Keys.Auth, UserAgent: userAgent,
+	}
+	if err := s.db.PutPushSubscription(ctx, sub); err != nil {
+		slog.ErrorContext(ctx, "Error saving push subscription", "userID", userID, "error", err)
+		return nil, errors.New("failed to save push subscription")
+	}
+
+	// Browsers that were never unsubscribed pile up; the oldest make room
+	others := slices.DeleteFunc(existing, func(old models.PushSubscription) bool { return old.ID == sub.ID })
+	for i := 0; i < len(others)-(maxPushSubscriptions-1); i++ {
+		if err := s.db.DeletePushSubscription(ctx, others[i].ID); err != nil {
+			slog.WarnContext(ctx, "Failed to delete old push subscription", "userID", userID, "subscriptionID", others[i].ID, "error", err)
+		}
+	}
+	return sub, nil
+}
+
+// ListPushSubscriptions returns userID's push subscriptions, oldest first.
+func (s *Service) ListPushSubscriptions(ctx context.Context, userID string) ([]models.PushSubscription, error) {
+	subs, err := s.db.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing push subscriptions", "userID", userID, "error", err)
+		return nil, errors.New("failed to list push subscriptions")
+	}
+	if subs == nil {
+		subs = []models.PushSubscription{}
+	}
+	return subs, nil
+}
+
+// UnsubscribePush deletes one of userID's push subscriptions.
+func (s *Service) UnsubscribePush(ctx context.Context, userID, subscriptionID string) error {
+	subs, err := s.ListPushSubscriptions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(subs, func(sub models.PushSubscription) bool { return sub.ID == subscriptionID }) {
+		return ErrPushSubscriptionNotFound
+	}
+	if err := s.db.DeletePushSubscription(ctx, subscriptionID); err != nil {
+		slog.ErrorContext(ctx, "Error deleting push subscription", "userID", userID, "subscriptionID", subscriptionID, "error", err)
+		return errors.New("failed to delete push subscription")
+	}
+	return nil
+}
+
+// GetNotificationPreferences returns which notification types userID gets.
+func (s *Service) GetNotificationPreferences(ctx context.Context, userID string) (*models.NotificationPreferences, error) {
+	user, err := s.getUserWithCache(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := &models.NotificationPreferences{Types: make(map[string]bool, len(models.NotificationTypes))}
+	for _, t := range models.NotificationTypes {
+		prefs.Types[t] = !slices.Contains(user.MutedNotifications, t)
+	}
+	return prefs, nil
+}
+
+// SetNotificationPreferences turns notification types on or off for userID. Types left
+// out of prefs keep their setting.
+func (s *Service) SetNotificationPreferences(ctx context.Context, userID string, prefs *models.NotificationPreferences) (*models.NotificationPreferences, error) {
+	current, err := s.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for t, on := range prefs.Types {
+		if _, ok := current.Types[t]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidNotificationType, t)
+		}
+		current.Types[t] = on
+	}
+	var muted []string
+	for _, t := range models.NotificationTypes {
+		if !current.Types[t] {
+			muted = append(muted, t)
+		}
+	}
+	if err := s.db.SetUserMuted(ctx, userID, muted); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error setting notification preferences of user", "userID", userID, "error", err)
+		return nil, errors.New("failed to set notification preferences")
+	}
+	_ = s.cache.DeleteUser(ctx, userID)
+	return current, nil
+}
+
+// pushJob is the payload of push.send and notify.mail jobs.
+type pushJob struct {
+	UserID       string              `json:"userId"`
+	Notification models.Notification `json:"notification"`
+}
+
+// notify queues n for userID's browsers, and for their inbox if n's type is emailed.
+// Nothing is sent for what users do themselves, or without Web Push or a mailer.
+func (s *Service) notify(ctx context.Context, userID string, n models.Notification) {
+	if userID == "" || userID == n.ActorID {
+		return
+	}
+	n.Time = s.now().UTC()
+	payload := pushJob{UserID: userID, Notification: n}
+	if s.push != nil {
+		if err := s.enqueueJob(ctx, jobSendPush, payload); err != nil {
+			slog.WarnContext(ctx, "Failed to queue notification", "userID", userID, "type", n.Type, "error", err)
+		}
+	}
+	if s.mailer != nil && slices.Contains(emailedNotifications, n.Type) {
+		if err := s.enqueueJob(ctx, jobSendNotifyMail, payload); err != nil {
+			slog.WarnContext(ctx, "Failed to queue notification email", "userID", userID, "type", n.Type, "error", err)
+		}
+	}
+}
+
+// notifyEdit tells the owner of an item that a collaborator edited it, at most once per
+// editNotifyWindow for the same collaborator and item.
+func (s *Service) notifyEdit(ctx context.Context, ownerUserID, editorID, itemID string, itemType models.ItemType) {
+	if s.push == nil || ownerUserID == editorID {
+		return
+	}
+	key := "notify:edit:" + string(itemType) + ":" + itemID + ":" + editorID
+	if first, err := s.notifyDedup.FirstSeen(ctx, key, editNotifyWindow); err == nil && !first {
+		return
+	}
+	s.notify(ctx, ownerUserID, models.Notification{
+		Type: models.NotifyEdit, Title: editorID + " edited your " + itemNoun(itemType),
+		ItemID: itemID, ItemType: itemType, ActorID: editorID, Tag: "edit:" + itemID,
+	})
+}
+
+// runSendPushJob sends a notification to each of the user's browsers. Subscriptions the
+// push service reports gone are deleted; other failures are logged but not retried, so
+// browsers that did get it don't get it twice.
+func (s *Service) runSendPushJob(ctx context.Context, job *jobs.Job) error {
+	var payload pushJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	if s.push == nil {
+		return nil
+	}
+	n := payload.Notification
+	user, err := s.getUserWithCache(ctx, payload.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if slices.Contains(user.MutedNotifications, n.Type) {
+		return nil
+	}
+	subs, err := s.db.ListPushSubscriptions(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	if n.Body == "" && n.ItemID != "" {
+		if meta, err := s.getItemMetaWithCache(ctx, n.ItemID, n.ItemType); err == nil {
+			n.Body = meta.Label()
+		}
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if len(body) > webpush.MaxPayload {
+		n.Body = "" // The title and item link are what matter
+		if body, err = json.Marshal(n); err != nil || len(body) > webpush.MaxPayload {
+			return jobs.Permanent(webpush.ErrPayloadTooLarge)
+		}
+	}
+	for i := range subs {
+		err := s.push.Send(ctx, &subs[i], body)
+		switch {
+		case errors.Is(err, webpush.ErrGone), errors.Is(err, webpush.ErrInvalidSubscription):
+			if delErr := s.db.DeletePushSubscription(ctx, subs[i].ID); delErr != nil {
+				slog.WarnContext(ctx, "Failed to delete ended push subscription", "subscriptionID", subs[i].ID, "error", delErr)
+			}
+		case err != nil:
+			slog.WarnContext(ctx, "Failed to send push notification", "userID", payload.UserID, "subscriptionID", subs[i].ID, "type", n.Type, "error", err)
+		}
+	}
+	return nil
+}
+
+// runSendNotifyMailJob emails a notification to the user, unless they have no email
+// address or turned the type off. Failed sends are retried.
+func (s *Service) runSendNotifyMailJob(ctx context.Context, job *jobs.Job) error {
+	var payload pushJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	if s.mailer == nil {
+		return nil
+	}
+	n := payload.Notification
+	user, err := s.getUserWithCache(ctx, payload.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == "" || slices.Contains(user.MutedNotifications, n.Type) {
+		return nil
+	}
+
+	var b strings.Builder
+	if n.Body != "" {
+		b.WriteString(n.Body + "\n\n")
+	}
+	if n.ItemID != "" {
+		if meta, err := s.getItemMetaWithCache(ctx, n.ItemID, n.ItemType); err == nil {
+			fmt.Fprintf(&b, "%s (%s)\n\n", meta.Label(), itemNoun(n.ItemType))
+		}
+	}
+	fmt.Fprintf(&b, "To stop these emails, turn off the %s notification in your settings.\n", n.Type)
+	msg := &mail.Message{To: user.Email, Subject: n.Title, Body: b.String()}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send notification email: %w", err)
+	}
+	return nil
+}
+
+// itemNoun names an item type in notifications.
+func itemNoun(itemType models.ItemType) string {
+	if itemType == models.ItemTypeCodeFile {
+		return "file"
+	}
+	return "post"
+}
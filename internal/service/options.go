@@ -0,0 +1,118 @@
+// internal/service/options.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"time"
+)
+
+// Option customizes a Service built by NewService, for programs embedding this package.
+type Option func(*Service)
+
+// SnapshotState describes an item's edits since its last snapshot, for a SnapshotStrategy.
+type SnapshotState struct {
+	ItemID   string
+	ItemType models.ItemType
+	Version  int   // The version just written
+	Changes  int64 // Changes applied since the last snapshot, including this write's
+	Interval int   // The configured SNAPSHOT_INTERVAL
+}
+
+// SnapshotStrategy decides whether to snapshot an item's current version. The count of
+// changes starts over after each snapshot it asks for.
+type SnapshotStrategy func(SnapshotState) bool
+
+// EveryNChanges is the default SnapshotStrategy: a snapshot once the configured number
+// of changes have been applied since the last one.
+func EveryNChanges(state SnapshotState) bool {
+	return state.Changes >= int64(state.Interval)
+}
+
+// ItemEvent describes a change to an item, for ItemHooks.
+type ItemEvent struct {
+	ItemID   string
+	ItemType string
+	Action   models.HistoryAction
+	Version  int // The item's version after the change
+	UserID   string
+	Time     time.Time
+}
+
+// ItemHook is told about item changes as their history is logged. It runs synchronously
+// on the writing request, so it must be quick; hand slow work to a goroutine or a queue.
+type ItemHook func(ctx context.Context, ev ItemEvent)
+
+// WithClock replaces time.Now as the service's source of the current time.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) { s.now = now }
+}
+
+// WithIDGenerator replaces uuid.NewString for the IDs the service generates itself.
+func WithIDGenerator(newID func() string) Option {
+	return func(s *Service) { s.newID = newID }
+}
+
+// WithPasswordHashCost sets the bcrypt cost of new password hashes (bcrypt.DefaultCost
+// by default). Existing hashes keep working at their own cost.
+func WithPasswordHashCost(cost int) Option {
+	return func(s *Service) { s.hashCost = cost }
+}
+
+// WithSnapshotStrategy replaces EveryNChanges. Snapshotting stays off while
+// SNAPSHOT_INTERVAL is 0.
+func WithSnapshotStrategy(strategy SnapshotStrategy) Option {
+	return func(s *Service) { s.snapshotStrategy = strategy }
+}
+
+// WithItemChangedHook adds a hook told about every logged change to an item other than
+// its deletion: creates, edits, reverts, restores and so on.
+func WithItemChangedHook(hook ItemHook) Option {
+	return func(s *Service) { s.onItemChanged = append(s.onItemChanged, hook) }
+}
+
+// WithItemDeletedHook adds a hook told about items being deleted (moved to the trash).
+func WithItemDeletedHook(hook ItemHook) Option {
+	return func(s *Service) { s.onItemDeleted = append(s.onItemDeleted, hook) }
+}
+
+// notifyPostSettings tells the item changed hooks that settings of a post shown on its
+// public pages changed, e.g. so cached pages are expired. Those changes aren't logged,
+// and drafts aren't public, so there is nothing to tell otherwise.
+func (s *Service) notifyPostSettings(ctx context.Context, userID string, post *models.Post) {
+	if post.PublishedVersion == 0 {
+		return
+	}
+	s.notifyItemHooks(ctx, &models.HistoryLog{
+		UserID: userID, ItemID: post.ID, ItemType: string(models.ItemTypePost),
+		Action: models.ActionSettings, ItemVersion: post.Version, Timestamp: s.now().UTC(),
+	})
+}
+
+// notifyItemHooks tells the item hooks about a logged history entry. A batch of patches
+// is logged one entry per change, so only its first entry is reported. A panicking hook
+// is logged and doesn't fail the change.
+func (s *Service) notifyItemHooks(ctx context.Context, entry *models.HistoryLog) {
+	hooks := s.onItemChanged
+	if entry.Action == models.ActionDelete {
+		hooks = s.onItemDeleted
+	}
+	if len(hooks) == 0 || (entry.Action == models.ActionPatch && entry.ChangeIndex > 0) {
+		return
+	}
+	ev := ItemEvent{
+		ItemID: entry.ItemID, ItemType: entry.ItemType, Action: entry.Action,
+		Version: entry.ItemVersion, UserID: entry.UserID, Time: entry.Timestamp,
+	}
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.ErrorContext(ctx, "Item hook panicked", "action", ev.Action, "itemType", ev.ItemType, "itemID", ev.ItemID, "panic", r)
+				}
+			}()
+			hook(ctx, ev)
+		}()
+	}
+}
@@ -0,0 +1,314 @@
+// internal/service/outbox.go
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/hooks"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"github.com/kkuzar/blog_system/utils/pointer"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Content writes upload the new object before moving the item's metadata to the next
+// version, so a failure in between leaves S3 ahead of the DB. Each write records a
+// WriteIntent first; repairWrite resolves the ones left behind.
+const (
+	writeIntentGrace    = 2 * time.Minute // Younger intents may belong to writes still in flight
+	writeRepairInterval = 5 * time.Minute // How often leftover intents are swept
+	writeRepairBatch    = 100
+)
+
+// contentHash returns the hex SHA-256 of content, as recorded in item metadata and write
+// intents.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentTypeFor returns the content type items of itemType are stored with.
+func contentTypeFor(itemType models.ItemType) string {
+	if itemType == models.ItemTypePost {
+		return "text/markdown"
+	}
+	return "text/plain"
+}
+
+// beginWrite records intent for content about to be uploaded. The write must not go ahead
+// if this fails, since nothing could repair it.
+func (s *Service) beginWrite(ctx context.Context, intent *models.WriteIntent, content string) error {
+	intent.ContentHash = contentHash(content)
+	intent.Size = int64(len(content))
+	if _, err := s.db.CreateWriteIntent(ctx, intent); err != nil {
+		slog.ErrorContext(ctx, "Error recording write intent", "itemType", intent.ItemType, "itemID", intent.ItemID, "baseVersion", intent.BaseVersion, "error", err)
+		return err
+	}
+	return nil
+}
+
+// endWrite removes a resolved intent. One left behind is harmless: the repair sweep finds
+// the write already complete and drops it.
+func (s *Service) endWrite(ctx context.Context, intent *models.WriteIntent) {
+	if err := s.db.DeleteWriteIntent(ctx, intent.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove write intent", "intentID", intent.ID, "itemType", intent.ItemType, "itemID", intent.ItemID, "error", err)
+	}
+}
+
+// abortWrite hands an intent whose metadata update failed to the repair worker, once the
+// grace period the sweep also waits has passed, so the repair can't race the write's own
+// request. The sweep picks it up later if the job can't be queued.
+func (s *Service) abortWrite(ctx context.Context, intent *models.WriteIntent) {
+	if err := s.enqueueJob(ctx, jobRepairWrite, intent, jobs.WithDelay(writeIntentGrace)); err != nil {
+		slog.WarnContext(ctx, "Failed to queue repair of write intent, leaving it to the sweep", "intentID", intent.ID, "error", err)
+	}
+}
+
+// updateContentMeta moves meta from baseVersion to the next version for new content at
+// s3Path, written by userID, and queues moving the item's comment anchors. The DB adapter
+// increments the version and fails with ErrVersionMismatch if baseVersion is stale.
+func (s *Service) updateContentMeta(ctx context.Context, userID string, meta models.ItemMeta, baseVersion int, s3Path, content string, now time.Time) error {
+	switch m := meta.(type) {
+	case *models.Post:
+		title, tags, date := m.Title, m.Tags, m.Date
+		m.UpdatedAt = now
+		m.Version = baseVersion // Expected version for DB check
+		m.S3Path = s3Path       // Ensure path is updated if generated
+		m.Size = int64(len(content))
+		m.ContentHash = contentHash(content)
+		setReadingStats(m, content)
+		setFrontMatter(m, content)
+		if err := s.db.UpdatePostMeta(ctx, m); err != nil {
+			return err
+		}
+		s.queueAnchorMove(ctx, m.ID, models.ItemTypePost)
+		// The front matter's title, tags and date are listed on public pages right away
+		if m.Title != title || !slices.Equal(m.Tags, tags) || !sameDate(m.Date, date) {
+			s.notifyPostSettings(ctx, userID, m)
+		}
+		return nil
+	case *models.CodeFile:
+		m.UpdatedAt = now
+		m.Version = baseVersion
+		m.S3Path = s3Path
+		m.Size = int64(len(content))
+		m.ContentHash = contentHash(content)
+		if err := s.db.UpdateCodeFileMeta(ctx, m); err != nil {
+			return err
+		}
+		s.queueAnchorMove(ctx, m.ID, models.ItemTypeCodeFile)
+		return nil
+	}
+	return ErrInvalidItemType
+}
+
+// sameDate reports whether a and b are both unset or the same time.
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// finishWrite runs everything that follows a successful metadata update: storage usage,
+// caches, retained versions, history, snapshot counters and search. oldSize is the
+// content size before the write.
+func (s *Service) finishWrite(ctx context.Context, intent *models.WriteIntent, ownerUserID string, oldSize int64, content, contentType string, now time.Time) {
+	s.endWrite(ctx, intent)
+	itemType := models.ItemType(intent.ItemType)
+	newVersion := intent.BaseVersion + 1
+
+	s.adjustStorageUsage(ctx, ownerUserID, intent.Size-oldSize)
+
+	// Invalidate/Update Caches
+	_ = s.cache.DeleteItemMeta(ctx, intent.ItemID, itemType)        // Invalidate meta cache
+	_ = s.cache.InvalidateItemContent(ctx, intent.ItemID, itemType) // Invalidate all old content versions
+	// Cache the new content immediately
+	if cacheErr := s.cache.SetItemContent(ctx, intent.ItemID, itemType, newVersion, content, s.settings().itemContentCacheTTL); cacheErr != nil {
+		slog.WarnContext(ctx, "Failed to cache new item content", "itemID", intent.ItemID, "itemType", itemType, "newVersion", newVersion, "error", cacheErr)
+	}
+	s.storeVersionContent(ctx, ownerUserID, intent.ItemID, itemType, newVersion, content, contentType)
+
+	// Log Action History, then snapshot bookkeeping
+	switch intent.Action {
+	case models.ActionPatch:
+		for i, change := range intent.Changes {
+			changeLogData := change // Create copy
+			historyLog := &models.HistoryLog{
+				UserID: intent.UserID, ItemID: intent.ItemID, ItemType: intent.ItemType,
+				Action: models.ActionPatch, Timestamp: now,
+				ChangeData: &changeLogData, ItemVersion: newVersion,
+				ChangeIndex: i, // Order within the batch, needed to replay patches
+			}
+			s.logAction(ctx, historyLog)
+		}
+		s.handleSnapshotting(ctx, intent.UserID, intent.ItemID, itemType, newVersion, len(intent.Changes))
+	case models.ActionRevert:
+		revertLog := &models.HistoryLog{
+			UserID: intent.UserID, ItemID: intent.ItemID, ItemType: intent.ItemType,
+			Action:          models.ActionRevert,
+			Timestamp:       now,
+			S3PathAfter:     intent.S3Path, // Path *after* the revert action
+			ItemVersion:     newVersion,
+			RevertedToLogID: pointer.To(intent.RevertedToLogID), // Link to the target log entry
+		}
+		s.logAction(ctx, revertLog)
+		// Reset change counter after revert
+		_ = s.changeCounter.Reset(ctx, changeCounterKey(itemType, intent.ItemID))
+	}
+	s.recordJournal(ctx, intent, newVersion, now)
+
+	s.queueSearchUpdate(ctx, intent.ItemID, itemType)
+	s.recordEdit(ctx, intent.ItemID, itemType)
+	s.notifyEdit(ctx, ownerUserID, intent.UserID, intent.ItemID, itemType)
+	s.runHooks(ctx, intent.UserID, intent.ItemID, itemType, newVersion, hooks.ActionUpdate, content)
+}
+
+// RepairWrites resolves write intents old enough that their request has finished, and
+// returns how many it resolved. Intents that can't be repaired stay in the outbox and
+// are retried on the next sweep.
+func (s *Service) RepairWrites(ctx context.Context) (int, error) {
+	intents, err := s.db.ListWriteIntents(ctx, s.now().UTC().Add(-writeIntentGrace), writeRepairBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list write intents: %w", err)
+	}
+	repaired := 0
+	for i := range intents {
+		if err := s.repairWrite(ctx, &intents[i]); err != nil {
+			slog.ErrorContext(ctx, "Failed to repair write intent", "intentID", intents[i].ID, "itemType", intents[i].ItemType, "itemID", intents[i].ItemID, "error", err)
+			continue
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// repairWrite brings an item's live object and metadata back in line after an interrupted
+// write: it completes the metadata update if the upload landed and nothing else changed
+// the item since, and otherwise rolls the object back. The intent is removed once the
+// item is consistent. Every step is safe to repeat.
+//
+// It holds the item's write lock, and before touching the object checks again that the
+// metadata hasn't moved, so it never overwrites a write that is in flight.
+func (s *Service) repairWrite(ctx context.Context, intent *models.WriteIntent) error {
+	itemType := models.ItemType(intent.ItemType)
+	if itemType != models.ItemTypePost && itemType != models.ItemTypeCodeFile {
+		return s.db.DeleteWriteIntent(ctx, intent.ID) // Can't be acted on
+	}
+	unlock, err := s.lockItem(ctx, intent.ItemID, itemType)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := s.loadIntentItem(ctx, intent)
+	if err != nil {
+		return err
+	}
+
+	live, err := s.downloadContent(ctx, intent.S3Path)
+	if err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return fmt.Errorf("failed to read %s: %w", intent.S3Path, err)
+	}
+	uploaded := err == nil && contentHash(live) == intent.ContentHash
+
+	switch {
+	case !uploaded:
+		// The upload never landed or was overwritten since: nothing of this write is live
+
+	case meta == nil || meta.GetS3Path() != intent.S3Path:
+		// The item was purged or its content moved (e.g. a transfer): nothing points here
+		if err := s.checkIntentItem(ctx, intent, meta); err != nil {
+			return err
+		}
+		if err := s.storage.DeleteFile(ctx, intent.S3Path); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+			return fmt.Errorf("failed to delete orphaned %s: %w", intent.S3Path, err)
+		}
+		slog.InfoContext(ctx, "Repaired write intent, deleted orphaned object", "intentID", intent.ID, "s3Path", intent.S3Path)
+
+	case meta.GetVersion() == intent.BaseVersion:
+		// The metadata update never landed: finish it
+		var oldSize int64
+		switch m := meta.(type) {
+		case *models.Post:
+			oldSize = m.Size
+		case *models.CodeFile:
+			oldSize = m.Size
+		}
+		if err := s.updateContentMeta(ctx, intent.UserID, meta, intent.BaseVersion, intent.S3Path, live, s.now().UTC()); err != nil {
+			if errors.Is(err, database.ErrVersionMismatch) {
+				return fmt.Errorf("item changed during repair, will retry: %w", err)
+			}
+			return fmt.Errorf("failed to complete metadata update: %w", err)
+		}
+		s.finishWrite(ctx, intent, meta.GetUserID(), oldSize, live, contentTypeFor(itemType), s.now().UTC())
+		slog.InfoContext(ctx, "Repaired write intent, completed the write", "intentID", intent.ID, "itemType", itemType, "itemID", intent.ItemID, "version", intent.BaseVersion+1)
+		return nil // finishWrite removed the intent
+
+	default:
+		// The metadata moved on. Unless this write is what it moved to, the live object
+		// no longer matches it: put back the content of the current version.
+		current := meta.GetVersion()
+		expected, err := s.reconstructVersion(ctx, intent.ItemID, itemType, current)
+		if errors.Is(err, ErrVersionNotAvailable) && current == intent.BaseVersion+1 {
+			slog.InfoContext(ctx, "Can't verify write intent, assuming the write landed", "intentID", intent.ID, "itemType", itemType, "itemID", intent.ItemID, "current", current)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rebuild v%d: %w", current, err)
+		}
+		if contentHash(expected) == intent.ContentHash {
+			break // This write landed; only the intent was left behind
+		}
+		if err := s.checkIntentItem(ctx, intent, meta); err != nil {
+			return err
+		}
+		if err := s.storage.UploadFile(ctx, intent.S3Path, strings.NewReader(expected), contentTypeFor(itemType)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", intent.S3Path, err)
+		}
+		s.hotBuffers.remove(changeCounterKey(itemType, intent.ItemID))
+		_ = s.cache.InvalidateItemContent(ctx, intent.ItemID, itemType)
+		slog.InfoContext(ctx, "Repaired write intent, restored content", "intentID", intent.ID, "itemType", itemType, "itemID", intent.ItemID, "current", current, "s3Path", intent.S3Path)
+	}
+	return s.db.DeleteWriteIntent(ctx, intent.ID)
+}
+
+// loadIntentItem returns the metadata of the item an intent wrote to, or nil if it is gone.
+func (s *Service) loadIntentItem(ctx context.Context, intent *models.WriteIntent) (models.ItemMeta, error) {
+	var meta models.ItemMeta
+	var err error
+	if models.ItemType(intent.ItemType) == models.ItemTypePost {
+		meta, err = s.db.GetPostMetaByID(ctx, intent.ItemID)
+	} else {
+		meta, err = s.db.GetCodeFileMetaByID(ctx, intent.ItemID)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load item: %w", err)
+	}
+	return meta, nil
+}
+
+// checkIntentItem re-reads the item before repairWrite changes its object, and fails if
+// it no longer matches meta (the state the repair was worked out from): a write that got
+// past the lock has moved it on, and the next attempt decides again.
+func (s *Service) checkIntentItem(ctx context.Context, intent *models.WriteIntent, meta models.ItemMeta) error {
+	current, err := s.loadIntentItem(ctx, intent)
+	if err != nil {
+		return err
+	}
+	if (current == nil) != (meta == nil) || current != nil && (current.GetVersion() != meta.GetVersion() || current.GetS3Path() != meta.GetS3Path()) {
+		return fmt.Errorf("item changed during repair, will retry: %w", database.ErrVersionMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// internal/service/placement.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+// maxOrderedPosts bounds how many posts can be given a manual position.
+const maxOrderedPosts = 100
+
+var ErrInvalidPostOrder = apperr.New(apperr.Validation, "post order must list at most 100 distinct posts")
+
+// PinPost pins a post to the top of its owner's listing. Requires ownership.
+func (s *Service) PinPost(ctx context.Context, userID, postID string) (*models.Post, error) {
+	return s.setPostPinned(ctx, userID, postID, true)
+}
+
+// UnpinPost returns a pinned post to its place in its owner's listing.
+func (s *Service) UnpinPost(ctx context.Context, userID, postID string) (*models.Post, error) {
+	return s.setPostPinned(ctx, userID, postID, false)
+}
+
+func (s *Service) setPostPinned(ctx context.Context, userID, postID string, pinned bool) (*models.Post, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if post.Pinned == pinned {
+		return post, nil
+	}
+
+	if err := s.db.SetPostPinned(ctx, postID, pinned); err != nil {
+		slog.ErrorContext(ctx, "Error setting pin state of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+
+	updated := *post // Copy; the cached value must not be modified
+	updated.Pinned = pinned
+	s.notifyPostSettings(ctx, userID, &updated)
+	return &updated, nil
+}
+
+// SetPostOrder gives the listed posts of userID manual positions at the top of their
+// listing (after pinned posts), in the given order. Posts left out lose their position
+// and are listed by date again; an empty list removes all positions.
+func (s *Service) SetPostOrder(ctx context.Context, userID string, postIDs []string) error {
+	if len(postIDs) > maxOrderedPosts {
+		return ErrInvalidPostOrder
+	}
+	ranks := make(map[string]int, len(postIDs))
+	posts := make(map[string]*models.Post, len(postIDs)) // Listed or currently placed
+	for i, postID := range postIDs {
+		if _, dup := ranks[postID]; dup {
+			return ErrInvalidPostOrder
+		}
+		ranks[postID] = len(postIDs) - i // Higher ranks are listed first
+
+		meta, err := s.getItemMetaWithCache(ctx, postID, models.ItemTypePost)
+		if err != nil {
+			return err
+		}
+		post, ok := meta.(*models.Post)
+		if !ok || post.UserID != userID {
+			return ErrPermissionDenied // Only the owner's own posts are in their listing
+		}
+		posts[postID] = post
+	}
+
+	// Placed posts lead the listing, so the current ranks are all in its first pages
+	current := make(map[string]int)
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, offset, true)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing posts of user for reordering", "userID", userID, "error", err)
+			return errors.New("failed to update post order")
+		}
+		done := len(page) < itemPageSize
+		for i := range page {
+			if !database.IsPlaced(&page[i]) {
+				done = true
+				break
+			}
+			if page[i].Rank > 0 {
+				current[page[i].ID] = page[i].Rank
+				if posts[page[i].ID] == nil {
+					posts[page[i].ID] = &page[i]
+				}
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	for postID := range current {
+		if _, kept := ranks[postID]; !kept {
+			ranks[postID] = 0
+		}
+	}
+	for postID, rank := range ranks {
+		if current[postID] == rank {
+			continue
+		}
+		if err := s.db.SetPostRank(ctx, postID, rank); err != nil {
+			slog.ErrorContext(ctx, "Error setting rank of post", "postID", postID, "error", err)
+			return mapDBError(err, models.ItemTypePost, postID)
+		}
+		_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+		s.notifyPostSettings(ctx, userID, posts[postID])
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// internal/service/posts.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// UpdatePost changes several of a post's settings at once; fields left nil in req are
+// kept. Each field is applied as by its own setter (SetPostSlug, SetPostExcerpt,
+// SetPostCoverImage); the search engine metadata only changes here. The fields are
+// validated before anything is changed, so an invalid value doesn't leave the others half
+// applied; a taken slug is only found when it is set, which is done first. Requires
+// editor access.
+func (s *Service) UpdatePost(ctx context.Context, userID, postID string, req models.UpdatePostRequest) (*models.Post, error) {
+	if req.Slug != nil {
+		if _, err := normalizeSlug(*req.Slug); err != nil {
+			return nil, err
+		}
+	}
+	if req.Excerpt != nil && utf8.RuneCountInString(strings.TrimSpace(*req.Excerpt)) > maxManualExcerptLength {
+		return nil, ErrInvalidExcerpt
+	}
+	var canonicalURL, metaDescription string
+	if req.CanonicalURL != nil {
+		var err error
+		if canonicalURL, err = normalizeCanonicalURL(*req.CanonicalURL); err != nil {
+			return nil, err
+		}
+	}
+	if req.MetaDescription != nil {
+		var err error
+		if metaDescription, err = normalizeMetaDescription(*req.MetaDescription); err != nil {
+			return nil, err
+		}
+	}
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if req.CoverImage != nil && *req.CoverImage != "" {
+		if _, err := s.coverImageAsset(ctx, post.UserID, *req.CoverImage); err != nil {
+			return nil, err
+		}
+	}
+
+	updated := *post // Copy; the cached value must not be modified
+	if req.Slug != nil {
+		if post, err = s.SetPostSlug(ctx, userID, postID, *req.Slug); err != nil {
+			return nil, err
+		}
+		updated.Slug, updated.UpdatedAt = post.Slug, post.UpdatedAt
+	}
+	if req.Excerpt != nil {
+		if post, err = s.SetPostExcerpt(ctx, userID, postID, *req.Excerpt); err != nil {
+			return nil, err
+		}
+		updated.Excerpt, updated.ExcerptManual = post.Excerpt, post.ExcerptManual
+	}
+	if req.CoverImage != nil {
+		if post, err = s.SetPostCoverImage(ctx, userID, postID, *req.CoverImage); err != nil {
+			return nil, err
+		}
+		updated.CoverImage = post.CoverImage
+	}
+	if req.CanonicalURL != nil || req.MetaDescription != nil || req.NoIndex != nil {
+		if req.CanonicalURL != nil {
+			updated.CanonicalURL = canonicalURL
+		}
+		if req.MetaDescription != nil {
+			updated.MetaDescription = metaDescription
+		}
+		if req.NoIndex != nil {
+			updated.NoIndex = *req.NoIndex
+		}
+		if err := s.db.SetPostSEO(ctx, postID, updated.CanonicalURL, updated.MetaDescription, updated.NoIndex); err != nil {
+			slog.ErrorContext(ctx, "Error setting SEO metadata of post", "postID", postID, "error", err)
+			return nil, mapDBError(err, models.ItemTypePost, postID)
+		}
+		_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+		s.notifyPostSettings(ctx, userID, &updated)
+	}
+	return &updated, nil
+}
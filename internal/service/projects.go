@@ -0,0 +1,180 @@
+// internal/service/projects.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrProjectNotFound = apperr.New(apperr.NotFound, "project not found")
+	ErrInvalidProject  = apperr.New(apperr.Validation, "project name is required")
+)
+
+// maxProjectFiles bounds how many files a project listing or tree returns.
+const maxProjectFiles = 1000
+
+// CreateProject creates an empty project owned by userID.
+func (s *Service) CreateProject(ctx context.Context, userID, name, description string) (*models.Project, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidProject
+	}
+	project := &models.Project{UserID: userID, Name: name, Description: strings.TrimSpace(description)}
+	if _, err := s.db.CreateProject(ctx, project); err != nil {
+		slog.ErrorContext(ctx, "Error creating project for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to create project")
+	}
+	return project, nil
+}
+
+func (s *Service) ListProjects(ctx context.Context, userID string, limit, offset int) ([]models.Project, error) {
+	projects, err := s.db.ListProjectsByUser(ctx, userID, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing projects for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list projects")
+	}
+	return projects, nil
+}
+
+// getOwnedProject loads a project and checks that userID owns it.
+func (s *Service) getOwnedProject(ctx context.Context, userID, projectID string) (*models.Project, error) {
+	project, err := s.db.GetProjectByID(ctx, projectID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting project", "projectID", projectID, "error", err)
+		return nil, errors.New("failed to get project")
+	}
+	if project.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	return project, nil
+}
+
+// ListProjectFiles returns the (non-trashed) code files in a project, sorted by path.
+func (s *Service) ListProjectFiles(ctx context.Context, userID, projectID string) ([]models.CodeFile, error) {
+	if _, err := s.getOwnedProject(ctx, userID, projectID); err != nil {
+		return nil, err
+	}
+	files, err := s.db.ListCodeFileMetaByProject(ctx, projectID, maxProjectFiles)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing files for project", "projectID", projectID, "error", err)
+		return nil, errors.New("failed to list project files")
+	}
+	sort.Slice(files, func(i, j int) bool { return codeFilePath(&files[i]) < codeFilePath(&files[j]) })
+	return files, nil
+}
+
+// GetProjectTree returns the project's code files and assets arranged into folders by
+// their paths.
+func (s *Service) GetProjectTree(ctx context.Context, userID, projectID string) (*models.ProjectTreeNode, error) {
+	project, err := s.getOwnedProject(ctx, userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.ListProjectFiles(ctx, userID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := s.db.ListAssetsByProject(ctx, projectID, maxProjectFiles)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing assets for project", "projectID", projectID, "error", err)
+		return nil, errors.New("failed to list project files")
+	}
+	return buildProjectTree(project.Name, files, assets), nil
+}
+
+// buildProjectTree turns flat file paths into a folder tree. Folders exist only
+// implicitly, so a folder is listed as long as some file lives under it. Within a
+// folder, subfolders come first, then files, each sorted by name.
+func buildProjectTree(rootName string, files []models.CodeFile, assets []models.Asset) *models.ProjectTreeNode {
+	root := &models.ProjectTreeNode{Name: rootName, Type: "dir"}
+	dirs := map[string]*models.ProjectTreeNode{"": root}
+
+	// addFile adds a file node under the folders of its path, creating them as needed
+	addFile := func(node *models.ProjectTreeNode) {
+		parent := root
+		parts := strings.Split(node.Path, "/")
+		for depth, part := range parts[:len(parts)-1] {
+			dirPath := strings.Join(parts[:depth+1], "/")
+			dir, ok := dirs[dirPath]
+			if !ok {
+				dir = &models.ProjectTreeNode{Name: part, Path: dirPath, Type: "dir"}
+				dirs[dirPath] = dir
+				parent.Children = append(parent.Children, dir)
+			}
+			parent = dir
+		}
+		node.Name, node.Type = parts[len(parts)-1], "file"
+		parent.Children = append(parent.Children, node)
+	}
+	for i := range files {
+		addFile(&models.ProjectTreeNode{Path: codeFilePath(&files[i]), FileID: files[i].ID, Language: files[i].Language})
+	}
+	for _, asset := range assets {
+		addFile(&models.ProjectTreeNode{Path: asset.Path, AssetID: asset.ID, ContentType: asset.ContentType})
+	}
+
+	for _, dir := range dirs {
+		sort.SliceStable(dir.Children, func(i, j int) bool {
+			a, b := dir.Children[i], dir.Children[j]
+			if a.Type != b.Type {
+				return a.Type == "dir"
+			}
+			return a.Name < b.Name
+		})
+	}
+	return root
+}
+
+// MoveCodeFile moves a code file into projectID (or out of any project when empty),
+// optionally renaming it to newPath at the same time. If the rename fails the file is
+// moved back, so the request takes effect entirely or not at all.
+func (s *Service) MoveCodeFile(ctx context.Context, userID, fileID, projectID, newPath string) (*models.CodeFile, error) {
+	// 1. Validate the file and the target project
+	file, err := getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if projectID != "" {
+		if _, err := s.getOwnedProject(ctx, userID, projectID); err != nil {
+			return nil, err
+		}
+	}
+	if newPath != "" {
+		if _, err := normalizeCodePath(newPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Move, then rename (which records history and invalidates the cache)
+	if err := s.db.SetCodeFileProject(ctx, fileID, projectID); err != nil {
+		slog.ErrorContext(ctx, "Error moving codefile to project", "fileID", fileID, "projectID", projectID, "error", err)
+		return nil, mapDBError(err, models.ItemTypeCodeFile, fileID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, fileID, models.ItemTypeCodeFile)
+
+	if newPath != "" {
+		renamed, err := s.RenameCodeFile(ctx, userID, fileID, newPath)
+		if err != nil {
+			if undoErr := s.db.SetCodeFileProject(ctx, fileID, file.ProjectID); undoErr != nil {
+				slog.ErrorContext(ctx, "Error moving codefile back after a failed rename", "fileID", fileID, "projectID", file.ProjectID, "error", undoErr)
+			}
+			_ = s.cache.DeleteItemMeta(ctx, fileID, models.ItemTypeCodeFile)
+			return nil, err
+		}
+		return renamed, nil
+	}
+	return s.GetCodeFileDetails(ctx, fileID)
+}
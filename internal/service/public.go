@@ -0,0 +1,141 @@
+// internal/service/public.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+)
+
+// maxPublicScan bounds how many of a user's posts a public listing reads. Posts are read
+// in listing order, so only a blog with more posts than this loses its oldest pages.
+const maxPublicScan = 1000
+
+// ListPublicPosts returns a page of userID's published posts in their listing order
+// (pinned and ranked posts first, then by date), only those tagged tag if it isn't empty
+// (ignoring case). Posts without a slug are left out, since they have no public address.
+// Each post is listed once, in the variant best matching the preferred languages (most
+// preferred first), else its canonical post, at the canonical post's place. Dates are in
+// the user's time zone. No access is required.
+func (s *Service) ListPublicPosts(ctx context.Context, userID, tag string, languages []string, limit, offset int) ([]models.PublicPostSummary, error) {
+	listed := func(post *models.Post) bool {
+		return post.PublishedVersion > 0 && post.Slug != "" && post.ArchivedAt == nil && (tag == "" || hasTag(post.Tags, tag))
+	}
+	loc, _ := s.userLocation(ctx, userID)
+	posts := make([]models.PublicPostSummary, 0, limit)
+	seen := make(map[string]bool) // Canonical IDs of the posts listed so far
+	matched := 0
+	for scanned := 0; scanned < maxPublicScan && len(posts) < limit; scanned += itemPageSize {
+		page, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, scanned, false)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing public posts of user", "userID", userID, "error", err)
+			return nil, errors.New("failed to list posts")
+		}
+		for i := range page {
+			post := &page[i]
+			root := post.ID
+			if post.TranslationOf != "" {
+				root = post.TranslationOf
+			}
+			if !listed(post) || seen[root] {
+				continue
+			}
+			if root != post.ID { // Listed at its canonical post's place, if that is listed
+				canonical, err := getItemMetaAs[*models.Post](ctx, s, root)
+				if err == nil && listed(canonical) {
+					continue
+				}
+			}
+			seen[root] = true
+			if matched++; matched <= offset {
+				continue
+			}
+			if post.Language != "" && len(languages) > 0 {
+				variants, err := s.publishedVariants(ctx, post)
+				if err != nil {
+					return nil, err
+				}
+				langs := []string{post.Language}
+				for _, variant := range variants {
+					if tag == "" || hasTag(variant.Tags, tag) {
+						langs = append(langs, variant.Language)
+					} else {
+						langs = append(langs, "") // Matches nothing
+					}
+				}
+				if best := matchLanguage(languages, langs); best > 0 && langs[best] != post.Language {
+					post = &variants[best-1]
+				}
+			}
+			posts = append(posts, models.PublicPostSummary{
+				PostID: post.ID, Title: post.Title, Slug: post.Slug, Excerpt: post.Excerpt,
+				Authors: postAuthors(post), Tags: post.Tags, CoverImage: post.CoverImage,
+				Language: post.Language, PublishedAt: inLocation(post.PublishedAt, loc),
+			})
+			if len(posts) == limit {
+				break
+			}
+		}
+		if len(page) < itemPageSize {
+			break
+		}
+	}
+	return posts, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPublicCoverImage returns the cover image of the published post userID has at slug.
+// A cover whose asset has since been deleted is reported as ErrAssetNotFound.
+func (s *Service) GetPublicCoverImage(ctx context.Context, userID, slug string) (*ItemDownload, error) {
+	post, movedTo, err := s.publicPost(ctx, userID, slug)
+	if err != nil {
+		return nil, err
+	}
+	if movedTo != "" || post.CoverImage == "" {
+		return nil, ErrAssetNotFound
+	}
+	// Read on behalf of the owner, who publicPost checked is userID
+	download, err := s.DownloadAsset(ctx, userID, post.CoverImage)
+	if errors.Is(err, ErrPermissionDenied) {
+		return nil, ErrAssetNotFound // The asset stayed with a previous owner
+	}
+	return download, err
+}
+
+// ForEachPublishedPost calls fn with the published content of each of userID's published
+// posts that has a slug, front-matter stripped, in their listing order. Archived posts are
+// left out, as from listings. It stops at the first error.
+func (s *Service) ForEachPublishedPost(ctx context.Context, userID string, fn func(post *models.PublishedPost) error) error {
+	for offset := 0; ; offset += itemPageSize {
+		page, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, offset, false)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error listing published posts of user", "userID", userID, "error", err)
+			return errors.New("failed to list posts")
+		}
+		for i := range page {
+			if page[i].PublishedVersion == 0 || page[i].Slug == "" {
+				continue
+			}
+			published, err := s.publishedPost(ctx, &page[i], true)
+			if err != nil {
+				return err
+			}
+			if err := fn(published); err != nil {
+				return err
+			}
+		}
+		if len(page) < itemPageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// internal/service/quota.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+// ErrQuotaExceeded is returned when a write would take a user past their storage quota.
+var ErrQuotaExceeded = apperr.New(apperr.TooLarge, "storage quota exceeded")
+
+// A user's stored bytes are the live content of their items (Size) plus the retained
+// versions and snapshots kept of them (RetainedBytes), which are usually most of it.
+
+// checkQuota returns ErrQuotaExceeded if growing userID's stored content by delta bytes
+// would exceed the configured quota. Shrinking writes are always allowed.
+func (s *Service) checkQuota(ctx context.Context, userID string, delta int64) error {
+	limit := s.cfg.Quota.MaxBytesPerUser
+	if limit <= 0 || delta <= 0 {
+		return nil
+	}
+	// Read from the DB, not the user cache: usage changes on every write
+	user, err := s.db.GetUserByUsername(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading storage usage for user", "userID", userID, "error", err)
+		return fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	if user.StorageBytes+delta > limit {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// adjustStorageUsage records a change in userID's stored bytes. Failures are logged only;
+// the content write has already succeeded by the time this is called.
+func (s *Service) adjustStorageUsage(ctx context.Context, userID string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	if err := s.db.AdjustUserStorage(ctx, userID, delta); err != nil {
+		slog.WarnContext(ctx, "Failed to adjust storage usage for user", "userID", userID, "delta", delta, "error", err)
+		return
+	}
+	_ = s.cache.DeleteUser(ctx, userID) // Cached user carries the old usage
+}
+
+// contentWriteDelta returns how much a content write growing the live object from oldSize
+// to newSize bytes adds to its owner's usage: the change in size, plus the copy of the
+// new version if versions are retained (at most its size; a delta is smaller).
+func (s *Service) contentWriteDelta(oldSize, newSize int64) int64 {
+	if s.cfg.Snapshot.RetainVersions {
+		return newSize - oldSize + newSize
+	}
+	return newSize - oldSize
+}
+
+// chargeRetained records delta bytes added to (or, if negative, removed from) an item's
+// retained versions and snapshots: on the item, so they go with it when it's purged or
+// transferred, and on ownerUserID's usage. Failures are logged only, like
+// adjustStorageUsage.
+func (s *Service) chargeRetained(ctx context.Context, ownerUserID, itemID string, itemType models.ItemType, delta int64) {
+	if delta == 0 {
+		return
+	}
+	var err error
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.AdjustPostRetainedBytes(ctx, itemID, delta)
+	case models.ItemTypeCodeFile:
+		err = s.db.AdjustCodeFileRetainedBytes(ctx, itemID, delta)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		return // Purged meanwhile, which gave back what it had
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to adjust retained bytes of item", "itemType", itemType, "itemID", itemID, "delta", delta, "error", err)
+		return
+	}
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType) // Cached meta carries the old count
+	s.adjustStorageUsage(ctx, ownerUserID, delta)
+}
+
+// retainedBytes returns the bytes of an item's retained versions and snapshots.
+func retainedBytes(meta models.ItemMeta) int64 {
+	switch m := meta.(type) {
+	case *models.Post:
+		return m.RetainedBytes
+	case *models.CodeFile:
+		return m.RetainedBytes
+	}
+	return 0
+}
+
+// GetStorageUsage returns how many bytes userID stores and their quota.
+func (s *Service) GetStorageUsage(ctx context.Context, userID string) (*models.StorageUsage, error) {
+	user, err := s.db.GetUserByUsername(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading storage usage for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to retrieve storage usage")
+	}
+	return &models.StorageUsage{
+		UsedBytes:  user.StorageBytes,
+		QuotaBytes: s.cfg.Quota.MaxBytesPerUser,
+	}, nil
+}
@@ -0,0 +1,83 @@
+// internal/service/ranges.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/models"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidRange        = apperr.New(apperr.Validation, "range must be \"bytes\" from 0 or \"lines\" from 1, with an end not before its start")
+	ErrRangeNotSatisfiable = apperr.New(apperr.RangeNotSatisfiable, "range starts past the end of the content")
+)
+
+// GetItemContentRange returns part of an item's current content: a range of bytes or of
+// lines. Byte ranges that would split a UTF-8 character are widened to take it whole;
+// lines keep their trailing newline, so consecutive ranges join up to the content. Ends
+// past the end of the content are cut short.
+func (s *Service) GetItemContentRange(ctx context.Context, userID, itemID, itemTypeStr string, req models.GetContentRangePayload) (*models.ContentRangePayload, error) {
+	if !validRange(req.Unit, req.Start, req.End) {
+		return nil, ErrInvalidRange
+	}
+	content, version, err := s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ContentRangePayload{ItemID: itemID, ItemType: itemTypeStr, Version: version, Unit: req.Unit}
+	switch req.Unit {
+	case models.RangeBytes:
+		result.Total = len(content)
+		if req.Start >= len(content) {
+			return nil, ErrRangeNotSatisfiable
+		}
+		start, end := req.Start, len(content) // end is exclusive here
+		if req.End != nil && *req.End+1 < end {
+			end = *req.End + 1
+		}
+		for start > 0 && !utf8.RuneStart(content[start]) {
+			start--
+		}
+		for end < len(content) && !utf8.RuneStart(content[end]) {
+			end++
+		}
+		result.Start, result.End, result.Content = start, end-1, content[start:end]
+	case models.RangeLines:
+		lines := strings.SplitAfter(content, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1] // Content ending in a newline has no empty last line
+		}
+		result.Total = len(lines)
+		if req.Start > len(lines) {
+			return nil, ErrRangeNotSatisfiable
+		}
+		end := len(lines)
+		if req.End != nil && *req.End < end {
+			end = *req.End
+		}
+		result.Start, result.End = req.Start, end
+		result.Content = strings.Join(lines[req.Start-1:end], "")
+	}
+	return result, nil
+}
+
+// validRange reports whether start and end (inclusive; nil for the end of the content)
+// make a range of unit.
+func validRange(unit string, start int, end *int) bool {
+	switch unit {
+	case models.RangeBytes:
+		if start < 0 {
+			return false
+		}
+	case models.RangeLines:
+		if start < 1 {
+			return false
+		}
+	default:
+		return false
+	}
+	return end == nil || *end >= start
+}
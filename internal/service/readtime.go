@@ -0,0 +1,32 @@
+// internal/service/readtime.go
+package service
+
+import (
+	"github.com/kkuzar/blog_system/internal/frontmatter"
+	"github.com/kkuzar/blog_system/internal/models"
+	"strings"
+	"unicode"
+)
+
+// wordsPerMinute is the reading speed used to estimate reading time.
+const wordsPerMinute = 200
+
+// countWords counts whitespace-separated words, ignoring tokens without any letters or
+// digits such as Markdown markers ("#", "-", "**") and horizontal rules.
+func countWords(content string) int {
+	words := 0
+	for _, field := range strings.Fields(content) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			words++
+		}
+	}
+	return words
+}
+
+// setReadingStats updates a post's word count and reading time from its content, not
+// counting front-matter. Reading time is rounded up to whole minutes, so any non-empty
+// post takes at least one.
+func setReadingStats(post *models.Post, content string) {
+	post.WordCount = countWords(frontmatter.Strip(content))
+	post.ReadingTimeMinutes = (post.WordCount + wordsPerMinute - 1) / wordsPerMinute
+}
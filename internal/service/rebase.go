@@ -0,0 +1,145 @@
+// internal/service/rebase.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"sort"
+)
+
+const (
+	// maxRebaseChanges bounds the changes returned with a version conflict; past it the
+	// full content is usually the smaller answer.
+	maxRebaseChanges = 500
+	// maxChangesSince bounds the changes GetChangesSince returns; clients further behind
+	// reload the content.
+	maxChangesSince = 5000
+)
+
+// changesSince returns the batches of changes that took an item from sinceVersion to
+// headVersion, oldest first, from the change journal or, where it has gaps, the patch
+// entries of the history. It returns ErrVersionNotAvailable if a version in between
+// wasn't produced by patches still on record (e.g. a revert, or entries compacted away)
+// or if there are more than limit changes.
+func (s *Service) changesSince(ctx context.Context, itemID string, itemType models.ItemType, sinceVersion, headVersion, limit int) ([]models.VersionChanges, error) {
+	if sinceVersion >= headVersion {
+		return []models.VersionChanges{}, nil
+	}
+	batches, err := s.journalChangesSince(ctx, itemID, itemType, sinceVersion, headVersion, limit)
+	if err == nil {
+		return batches, nil
+	}
+	if !errors.Is(err, ErrVersionNotAvailable) {
+		slog.WarnContext(ctx, "Failed to read changes from the journal, using history", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+	return s.historyChangesSince(ctx, itemID, itemType, sinceVersion, headVersion, limit)
+}
+
+// historyChangesSince is changesSince assembled from the history alone.
+func (s *Service) historyChangesSince(ctx context.Context, itemID string, itemType models.ItemType, sinceVersion, headVersion, limit int) ([]models.VersionChanges, error) {
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %w", err)
+	}
+	patches := make(map[int][]models.HistoryLog, headVersion-sinceVersion) // Key: ItemVersion
+	total := 0
+	for _, entry := range history {
+		if entry.Action != models.ActionPatch || entry.ChangeData == nil ||
+			entry.ItemVersion <= sinceVersion || entry.ItemVersion > headVersion {
+			continue
+		}
+		if total++; total > limit {
+			return nil, ErrVersionNotAvailable
+		}
+		patches[entry.ItemVersion] = append(patches[entry.ItemVersion], entry)
+	}
+
+	batches := make([]models.VersionChanges, 0, headVersion-sinceVersion)
+	for v := sinceVersion + 1; v <= headVersion; v++ {
+		batch := patches[v]
+		if len(batch) == 0 {
+			return nil, ErrVersionNotAvailable
+		}
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].ChangeIndex < batch[j].ChangeIndex })
+		changes := make([]models.Change, len(batch))
+		for i := range batch {
+			changes[i] = *batch[i].ChangeData
+		}
+		batches = append(batches, models.VersionChanges{Version: v, Changes: changes})
+	}
+	return batches, nil
+}
+
+// VersionConflictState returns what a client whose changes were based on baseVersion
+// needs to rebase them: the changes made since, or the full current content if those
+// aren't all available. It is sent along with ErrVersionConflict.
+func (s *Service) VersionConflictState(ctx context.Context, userID, itemID, itemTypeStr string, baseVersion int) (*models.VersionConflictPayload, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	state := &models.VersionConflictPayload{
+		ItemID: itemID, ItemType: itemTypeStr, BaseVersion: baseVersion, CurrentVersion: meta.GetVersion(),
+	}
+	if baseVersion >= 1 && baseVersion < state.CurrentVersion {
+		state.Changes, err = s.changesSince(ctx, itemID, itemType, baseVersion, state.CurrentVersion, maxRebaseChanges)
+		if err == nil {
+			return state, nil
+		}
+		if !errors.Is(err, ErrVersionNotAvailable) {
+			slog.WarnContext(ctx, "Failed to collect changes for version conflict, sending content", "itemType", itemType, "itemID", itemID, "baseVersion", baseVersion, "error", err)
+		}
+		state.Changes = nil
+	}
+
+	content, version, err := s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	state.CurrentVersion, state.Content = version, &content
+	return state, nil
+}
+
+// GetChangesSince returns the changes made to an item since sinceVersion, for a client
+// catching up after a reconnect. It returns ErrVersionNotAvailable if they can't all be
+// assembled from the history (or are too many), in which case the client reloads the
+// content.
+func (s *Service) GetChangesSince(ctx context.Context, userID, itemID, itemTypeStr string, sinceVersion int) (*models.ChangesSincePayload, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	currentVersion := meta.GetVersion()
+	if sinceVersion < 1 || sinceVersion > currentVersion {
+		return nil, ErrVersionNotFound
+	}
+
+	versions, err := s.changesSince(ctx, itemID, itemType, sinceVersion, currentVersion, maxChangesSince)
+	if err != nil {
+		if !errors.Is(err, ErrVersionNotAvailable) {
+			slog.ErrorContext(ctx, "Error collecting changes", "itemType", itemType, "itemID", itemID, "sinceVersion", sinceVersion, "error", err)
+		}
+		return nil, err
+	}
+	return &models.ChangesSincePayload{
+		ItemID: itemID, ItemType: itemTypeStr, SinceVersion: sinceVersion, CurrentVersion: currentVersion, Versions: versions,
+	}, nil
+}
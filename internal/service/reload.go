@@ -0,0 +1,101 @@
+// internal/service/reload.go
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrReloadUnavailable = apperr.New(apperr.Unavailable, "config reload is not available")
+	ErrInvalidConfig     = apperr.New(apperr.Unprocessable, "invalid configuration")
+)
+
+// runtimeSettings are the settings ReloadConfig can change without a restart. The rest
+// of the configuration is read once, at startup.
+type runtimeSettings struct {
+	logLevel            string
+	snapshotInterval    int // Take a snapshot every N changes (0 to disable)
+	userCacheTTL        time.Duration
+	itemMetaCacheTTL    time.Duration
+	itemContentCacheTTL time.Duration
+	rateLimit           config.RateLimitConfig // Whether limits are enforced at all is set at startup
+}
+
+func newRuntimeSettings(cfg *config.Config) *runtimeSettings {
+	return &runtimeSettings{
+		logLevel:            cfg.Log.Level,
+		snapshotInterval:    cfg.Snapshot.IntervalChanges,
+		userCacheTTL:        cfg.Cache.UserTTL,
+		itemMetaCacheTTL:    cfg.Cache.ItemMetaTTL,
+		itemContentCacheTTL: cfg.Cache.ItemContentTTL,
+		rateLimit:           cfg.RateLimit,
+	}
+}
+
+func (s *Service) settings() *runtimeSettings {
+	return s.runtime.Load()
+}
+
+// RateLimits returns the current rate limits, which ReloadConfig may change.
+func (s *Service) RateLimits() config.RateLimitConfig {
+	return s.settings().rateLimit
+}
+
+// UseConfigLoader sets how ReloadConfig reads the configuration, normally the way it was
+// read at startup. Without a loader ReloadConfig returns ErrReloadUnavailable.
+func (s *Service) UseConfigLoader(load func() (*config.Config, error)) {
+	s.loadConfig = load
+}
+
+// ReloadConfig reads the configuration again and applies the log level, the snapshot
+// interval, the cache TTLs and the rate limits. Changes to other settings (including
+// switching rate limiting on or off) need a restart. Nothing is applied if the
+// configuration is invalid.
+func (s *Service) ReloadConfig(ctx context.Context) (*models.ConfigReloadResult, error) {
+	if s.loadConfig == nil {
+		return nil, ErrReloadUnavailable
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		slog.ErrorContext(ctx, "Config reload failed", "error", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	next := newRuntimeSettings(cfg)
+	prev := s.settings()
+	if next.logLevel != prev.logLevel {
+		if err := logging.SetLevel(next.logLevel); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	s.runtime.Store(next)
+
+	result := &models.ConfigReloadResult{Changed: []string{}}
+	changed := func(name string, differs bool) {
+		if differs {
+			result.Changed = append(result.Changed, name)
+		}
+	}
+	changed("LOG_LEVEL", next.logLevel != prev.logLevel)
+	changed("SNAPSHOT_INTERVAL_CHANGES", next.snapshotInterval != prev.snapshotInterval)
+	changed("CACHE_USER_TTL_MINUTES", next.userCacheTTL != prev.userCacheTTL)
+	changed("CACHE_ITEM_META_TTL_MINUTES", next.itemMetaCacheTTL != prev.itemMetaCacheTTL)
+	changed("CACHE_ITEM_CONTENT_TTL_MINUTES", next.itemContentCacheTTL != prev.itemContentCacheTTL)
+	changed("RATE_LIMIT_REQUESTS_PER_MINUTE", next.rateLimit.RequestsPerMinute != prev.rateLimit.RequestsPerMinute)
+	changed("RATE_LIMIT_REQUEST_BURST", next.rateLimit.RequestBurst != prev.rateLimit.RequestBurst)
+	changed("RATE_LIMIT_AUTH_PER_MINUTE", next.rateLimit.AuthPerMinute != prev.rateLimit.AuthPerMinute)
+	changed("RATE_LIMIT_AUTH_BURST", next.rateLimit.AuthBurst != prev.rateLimit.AuthBurst)
+	changed("RATE_LIMIT_WS_MESSAGES_PER_MINUTE", next.rateLimit.WSMessagesPerMinute != prev.rateLimit.WSMessagesPerMinute)
+	changed("RATE_LIMIT_WS_MESSAGE_BURST", next.rateLimit.WSMessageBurst != prev.rateLimit.WSMessageBurst)
+	slog.InfoContext(ctx, "Config reloaded", "changed", result.Changed)
+	return result, nil
+}
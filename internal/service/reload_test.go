@@ -0,0 +1,31 @@
+// internal/service/reload_test.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+	"testing"
+)
+
+// A reload with rate limiting off must still reject a zero rate: the limiter installed at
+// startup keeps reading the reloaded limits, and a zero rate would divide by zero.
+func TestReloadConfigRejectsZeroRateWithRateLimitingOff(t *testing.T) {
+	t.Setenv("DEV_MODE", "true")
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	s := &Service{cfg: cfg}
+	s.runtime.Store(newRuntimeSettings(cfg))
+	s.UseConfigLoader(func() (*config.Config, error) { return config.LoadConfig("") })
+
+	t.Setenv("RATE_LIMIT_REQUESTS_PER_MINUTE", "0")
+	if _, err := s.ReloadConfig(context.Background()); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("ReloadConfig: got %v, want ErrInvalidConfig", err)
+	}
+	if got, want := s.RateLimits().RequestsPerMinute, cfg.RateLimit.RequestsPerMinute; got != want {
+		t.Fatalf("RequestsPerMinute = %d after a rejected reload, want %d", got, want)
+	}
+}
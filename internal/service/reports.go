@@ -0,0 +1,256 @@
+// internal/service/reports.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Any signed-in user can report a published post, or a comment they can read, as
+// abusive. Reports wait in a queue for admins, who either dismiss them or take the
+// content down: a post is unpublished (its owner keeps the draft) and a comment deleted.
+// A post taken down can't be published again until an admin reinstates it. A user
+// reports the same content once, and at most maxReportsPerHour reports an hour.
+
+const (
+	maxReportDetails  = 2000 // Characters
+	maxReportNote     = 2000 // Characters
+	maxReportExcerpt  = 500  // Characters of the reported content kept with the report
+	maxReportsPerHour = 20
+	// reportDedupWindow is how long a user's report of some content is remembered, so
+	// reporting it again is refused.
+	reportDedupWindow = 90 * 24 * time.Hour
+)
+
+// Ways an admin can resolve a report
+const (
+	ReportActionDismiss   = "dismiss"
+	ReportActionUnpublish = "unpublish"
+)
+
+var (
+	ErrReportNotFound      = apperr.New(apperr.NotFound, "report not found")
+	ErrReportResolved      = apperr.New(apperr.Conflict, "report has already been resolved")
+	ErrInvalidReport       = apperr.New(apperr.Validation, "report needs a reason (spam, harassment, illegal or other) and at most 2000 characters of details")
+	ErrInvalidReportAction = apperr.New(apperr.Validation, "action must be \"dismiss\" or \"unpublish\", with at most 2000 characters of note")
+	ErrInvalidReportStatus = apperr.New(apperr.Validation, "report status must be \"open\", \"actioned\" or \"dismissed\"")
+	ErrAlreadyReported     = apperr.New(apperr.Conflict, "you have already reported this")
+	ErrTooManyReports      = apperr.New(apperr.RateLimited, "too many reports, try again later")
+	ErrPostTakenDown       = apperr.New(apperr.PermissionDenied, "post was taken down by an admin and can't be published until reinstated")
+)
+
+// ReportContent files a report by userID about a published post or, with a CommentID,
+// an approved comment userID can read. Content that doesn't exist or userID can't see is
+// reported as not found.
+func (s *Service) ReportContent(ctx context.Context, userID string, req *models.ReportRequest) (*models.Report, error) {
+	details := strings.TrimSpace(req.Details)
+	if !slices.Contains(models.ReportReasons, req.Reason) || utf8.RuneCountInString(details) > maxReportDetails {
+		return nil, ErrInvalidReport
+	}
+	itemType := models.ItemType(req.ItemType)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, req.ItemID, itemType) // Skips trashed items
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.Report{
+		ReporterID: userID, ItemID: req.ItemID, ItemType: string(itemType), CommentID: req.CommentID,
+		Reason: req.Reason, Details: details, Status: models.ReportOpen,
+	}
+	if req.CommentID == "" {
+		post, ok := meta.(*models.Post)
+		if !ok || post.PublishedVersion == 0 {
+			return nil, ErrItemNotFound // Only published posts are public
+		}
+		report.AuthorID, report.Excerpt = post.UserID, post.Title
+		if post.Excerpt != "" {
+			report.Excerpt += ": " + post.Excerpt
+		}
+	} else {
+		if err := s.authorizeComments(ctx, userID, req.ItemID, itemType, meta); err != nil {
+			return nil, ErrCommentNotFound
+		}
+		comment, err := s.db.GetComment(ctx, req.ItemID, string(itemType), req.CommentID)
+		if errors.Is(err, database.ErrNotFound) || (err == nil && !comment.Status.Is(models.CommentApproved)) {
+			return nil, ErrCommentNotFound
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting reported comment", "commentID", req.CommentID, "itemType", itemType, "itemID", req.ItemID, "error", err)
+			return nil, errors.New("failed to create report")
+		}
+		report.AuthorID, report.Excerpt = comment.UserID, comment.Body
+	}
+	if runes := []rune(report.Excerpt); len(runes) > maxReportExcerpt {
+		report.Excerpt = string(runes[:maxReportExcerpt-1]) + "…"
+	}
+
+	if !s.allowUserAction(ctx, "report", userID, maxReportsPerHour) {
+		return nil, ErrTooManyReports
+	}
+	key := "report:" + userID + ":" + string(itemType) + ":" + req.ItemID + ":" + req.CommentID
+	if first, err := s.reportDedup.FirstSeen(ctx, key, reportDedupWindow); err == nil && !first {
+		return nil, ErrAlreadyReported
+	}
+
+	if _, err := s.db.CreateReport(ctx, report); err != nil {
+		slog.ErrorContext(ctx, "Error creating report", "userID", userID, "itemType", itemType, "itemID", req.ItemID, "error", err)
+		return nil, errors.New("failed to create report")
+	}
+	slog.InfoContext(ctx, "Content reported", "reportID", report.ID, "itemType", itemType, "itemID", req.ItemID, "commentID", req.CommentID, "reason", req.Reason)
+	return report, nil
+}
+
+// ListReports returns a page of the reports with status (any if empty), newest first.
+// For admins.
+func (s *Service) ListReports(ctx context.Context, status models.ReportStatus, limit, offset int) ([]models.Report, error) {
+	if status != "" && !status.IsValid() {
+		return nil, ErrInvalidReportStatus
+	}
+	reports, err := s.db.ListReports(ctx, status, limit, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing reports", "status", status, "error", err)
+		return nil, errors.New("failed to list reports")
+	}
+	if reports == nil {
+		reports = []models.Report{}
+	}
+	return reports, nil
+}
+
+// ResolveReport closes an open report on behalf of adminID: dismissing it, or taking the
+// reported content down first. Content that is already gone counts as taken down.
+func (s *Service) ResolveReport(ctx context.Context, adminID, reportID string, req *models.ResolveReportRequest) (*models.Report, error) {
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxReportNote {
+		return nil, ErrInvalidReportAction
+	}
+	var status models.ReportStatus
+	switch req.Action {
+	case ReportActionDismiss:
+		status = models.ReportDismissed
+	case ReportActionUnpublish:
+		status = models.ReportActioned
+	default:
+		return nil, ErrInvalidReportAction
+	}
+
+	report, err := s.db.GetReport(ctx, reportID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting report", "reportID", reportID, "error", err)
+		return nil, errors.New("failed to resolve report")
+	}
+	if report.Status != models.ReportOpen {
+		return nil, ErrReportResolved
+	}
+	if status == models.ReportActioned {
+		if err := s.takeDown(ctx, adminID, report); err != nil {
+			return nil, err
+		}
+	}
+
+	now := s.now().UTC()
+	if err := s.db.ResolveReport(ctx, reportID, status, adminID, note, now); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrReportResolved // Resolved by another admin meanwhile
+		}
+		slog.ErrorContext(ctx, "Error resolving report", "reportID", reportID, "error", err)
+		return nil, errors.New("failed to resolve report")
+	}
+	report.Status, report.ResolvedBy, report.ResolvedAt, report.Note = status, adminID, &now, note
+	slog.InfoContext(ctx, "Report resolved", "reportID", reportID, "status", status, "adminID", adminID)
+	return report, nil
+}
+
+// takeDown removes what a report is about from public view: the comment is deleted, or
+// the post unpublished and marked taken down, so its owner can't publish it again.
+func (s *Service) takeDown(ctx context.Context, adminID string, report *models.Report) error {
+	if report.CommentID != "" {
+		err := s.db.DeleteComment(ctx, report.ItemID, report.ItemType, report.CommentID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			slog.ErrorContext(ctx, "Error deleting reported comment", "commentID", report.CommentID, "itemType", report.ItemType, "itemID", report.ItemID, "error", err)
+			return errors.New("failed to delete comment")
+		}
+		return nil
+	}
+	now := s.now().UTC()
+	if err := s.db.SetPostTakenDown(ctx, report.ItemID, &now); err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.ErrorContext(ctx, "Error marking post taken down", "postID", report.ItemID, "error", err)
+		return errors.New("failed to take post down")
+	}
+	_ = s.cache.DeleteItemMeta(ctx, report.ItemID, models.ItemTypePost)
+	return s.unpublishPost(ctx, adminID, report.ItemID)
+}
+
+// ReinstatePost lets the owner of a post taken down on a report publish it again. It
+// stays unpublished until they do. For admins.
+func (s *Service) ReinstatePost(ctx context.Context, adminID, postID string) (*models.Post, error) {
+	post, err := s.db.GetPostMetaByID(ctx, postID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting post to reinstate", "postID", postID, "error", err)
+		return nil, errors.New("failed to reinstate post")
+	}
+	if post.TakenDownAt == nil {
+		return post, nil
+	}
+	if err := s.db.SetPostTakenDown(ctx, postID, nil); err != nil {
+		slog.ErrorContext(ctx, "Error reinstating post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	post.TakenDownAt = nil
+	slog.InfoContext(ctx, "Post reinstated", "postID", postID, "adminID", adminID)
+	return post, nil
+}
+
+// unpublishPost takes a post's published content down, cancelling any scheduled publish,
+// and leaves the draft to its owner. Publishing again makes it public again.
+func (s *Service) unpublishPost(ctx context.Context, adminID, postID string) error {
+	post, err := s.db.GetPostMetaByID(ctx, postID) // Not the cache: it may be stale
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting post to unpublish", "postID", postID, "error", err)
+		return errors.New("failed to unpublish post")
+	}
+	if post.PublishedVersion == 0 {
+		return nil
+	}
+	if post.ScheduledAt != nil {
+		if err := s.clearSchedule(ctx, postID); err != nil {
+			return errors.New("failed to unpublish post")
+		}
+	}
+	if err := s.db.SetPostUnpublished(ctx, postID); err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.ErrorContext(ctx, "Error unpublishing post", "postID", postID, "error", err)
+		return errors.New("failed to unpublish post")
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	if err := s.storage.DeleteFile(ctx, generatePublishedPath(postID)); err != nil {
+		slog.WarnContext(ctx, "Failed to delete published content of unpublished post", "postID", postID, "error", err)
+	}
+
+	s.logAction(ctx, &models.HistoryLog{
+		UserID: adminID, ItemID: postID, ItemType: string(models.ItemTypePost), Action: models.ActionUnpublish,
+		Timestamp: s.now().UTC(), ItemVersion: post.PublishedVersion,
+	})
+	slog.InfoContext(ctx, "Post unpublished", "postID", postID, "adminID", adminID)
+	return nil
+}
@@ -0,0 +1,129 @@
+// internal/service/run.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/langdetect"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/runner"
+	"log/slog"
+	"path"
+	"sync"
+)
+
+const maxStdinSize = 64 << 10
+
+var (
+	ErrRunnerDisabled      = apperr.New(apperr.Unavailable, "code execution is not enabled")
+	ErrUnsupportedLanguage = apperr.New(apperr.Unprocessable, "this file's language can't be run")
+	ErrStdinTooLarge       = apperr.New(apperr.TooLarge, "stdin must be at most 64 KiB")
+	ErrTooManyRuns         = apperr.New(apperr.RateLimited, "too many programs running, wait for one to finish")
+)
+
+// runLimiter bounds the runs in progress on this replica: in total, where extra runs
+// wait for a slot, and per user, where they are refused so one user can't take every slot.
+type runLimiter struct {
+	slots      chan struct{}
+	maxPerUser int
+
+	mu     sync.Mutex
+	byUser map[string]int
+}
+
+func newRunLimiter(maxConcurrent, maxPerUser int) *runLimiter {
+	return &runLimiter{
+		slots:      make(chan struct{}, max(maxConcurrent, 1)),
+		maxPerUser: max(maxPerUser, 1),
+		byUser:     make(map[string]int),
+	}
+}
+
+// acquire takes a slot for a run by userID, waiting for one to free up, and returns the
+// func that releases it.
+func (l *runLimiter) acquire(ctx context.Context, userID string) (func(), error) {
+	l.mu.Lock()
+	if l.byUser[userID] >= l.maxPerUser {
+		l.mu.Unlock()
+		return nil, ErrTooManyRuns
+	}
+	l.byUser[userID]++
+	l.mu.Unlock()
+	leave := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.byUser[userID]--; l.byUser[userID] <= 0 {
+			delete(l.byUser, userID)
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		leave()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-l.slots
+		leave()
+	}, nil
+}
+
+// EnableCodeRunner turns on code execution backed by r.
+func (s *Service) EnableCodeRunner(r runner.Runner) {
+	s.runner = r
+	s.runs = newRunLimiter(s.cfg.Runner.MaxConcurrent, s.cfg.Runner.MaxPerUser)
+}
+
+// RunCodeFile executes the current content of a code file with stdin as its input and
+// returns its output. A program that fails, times out or runs out of memory is a
+// successful run; see Result. Requires viewer access. A user may only have a few runs
+// going at once (ErrTooManyRuns), and runs beyond the server's limit wait their turn.
+func (s *Service) RunCodeFile(ctx context.Context, userID, fileID, stdin string) (*runner.Result, error) {
+	if s.runner == nil {
+		return nil, ErrRunnerDisabled
+	}
+	if len(stdin) > maxStdinSize {
+		return nil, ErrStdinTooLarge
+	}
+
+	// 1. Get Metadata (checks existence), check access and pick the language
+	file, err := getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, file.UserID, fileID, models.ItemTypeCodeFile, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	filePath := codeFilePath(file)
+	language := file.Language
+	if language == "" {
+		language = langdetect.FromFileName(filePath)
+	}
+	if language == "" {
+		return nil, ErrUnsupportedLanguage
+	}
+
+	// 2. Load the content and run it once there's a slot
+	content, version, err := s.GetItemContent(ctx, userID, fileID, string(models.ItemTypeCodeFile))
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.runs.acquire(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	result, err := s.runner.Run(ctx, &runner.Request{
+		Language: language, FileName: path.Base(filePath), Content: content, Stdin: stdin,
+	})
+	if err != nil {
+		if errors.Is(err, runner.ErrUnsupportedLanguage) {
+			return nil, ErrUnsupportedLanguage
+		}
+		slog.ErrorContext(ctx, "Error running codefile", "fileID", fileID, "version", version, "language", language, "error", err)
+		return nil, errors.New("failed to run code")
+	}
+	return result, nil
+}
@@ -0,0 +1,207 @@
+// internal/service/schedule.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// A post can be scheduled to be published later: a delayed job publishes it when it is
+// due. Publishing it before then, or scheduling it again, makes that job a no-op. The
+// delayed job is only the fast path: a sweep every scheduleSweepInterval queues the
+// publish of any post that is due, so a schedule whose job was lost (the in-memory job
+// store doesn't outlive a restart) is still carried out, if late.
+
+const (
+	// maxScheduleAhead is how far ahead a post can be scheduled.
+	maxScheduleAhead = 366 * 24 * time.Hour
+	// scheduleSweepInterval is how often due posts are looked for, and maxDuePostsPerSweep
+	// how many one sweep queues; the rest wait for the next.
+	scheduleSweepInterval = time.Minute
+	maxDuePostsPerSweep   = 500
+)
+
+var (
+	ErrInvalidSchedule       = apperr.New(apperr.Validation, "publishAt must be a future time, such as 2026-10-20T09:00, within a year")
+	ErrSchedulingUnavailable = apperr.New(apperr.Unavailable, "scheduled publishing is unavailable without the job queue")
+)
+
+// localTimeLayouts are the accepted forms of a scheduled time without an offset.
+var localTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"}
+
+// parsePublishTime reads a scheduled time: RFC 3339 with an offset, or a local time in loc.
+func parsePublishTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrInvalidSchedule
+}
+
+// publishPostJob is the payload of a post.publish job.
+type publishPostJob struct {
+	PostID string    `json:"postId"`
+	At     time.Time `json:"at"` // The schedule the job is for; a different one supersedes it
+}
+
+// SchedulePost schedules the draft of a post to be published at publishAt: a time with
+// an offset, or a local time in timezone, else in the author's time zone. If version is
+// non-zero that draft version is published, else the draft as it is then; a version
+// other than the current draft's is refused, as by PublishPost. It replaces any earlier
+// schedule of the post. Requires editor access.
+func (s *Service) SchedulePost(ctx context.Context, userID, postID, publishAt, timezone string, version int) (*models.Post, error) {
+	if s.jobs == nil {
+		return nil, ErrSchedulingUnavailable
+	}
+	meta, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	post := *meta // Copy; the cached value must not be modified
+	if version != 0 && version != post.Version {
+		return nil, ErrVersionConflict
+	}
+	if post.TakenDownAt != nil {
+		return nil, ErrPostTakenDown
+	}
+
+	loc, _ := s.userLocation(ctx, post.UserID)
+	if timezone != "" {
+		if loc, err = loadLocation(timezone); err != nil {
+			return nil, err
+		}
+	}
+	at, err := parsePublishTime(publishAt, loc)
+	if err != nil {
+		return nil, err
+	}
+	at = at.UTC().Truncate(time.Second)
+	now := s.now()
+	if !at.After(now) || at.Sub(now) > maxScheduleAhead {
+		return nil, ErrInvalidSchedule
+	}
+
+	if err := s.db.SetPostSchedule(ctx, postID, &at, version); err != nil {
+		slog.ErrorContext(ctx, "Error scheduling post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	if err := s.enqueuePublish(ctx, postID, at, at.Sub(s.now())); err != nil {
+		slog.ErrorContext(ctx, "Error queueing scheduled publish of post", "postID", postID, "error", err)
+		if err := s.db.SetPostSchedule(ctx, postID, nil, 0); err != nil {
+			slog.ErrorContext(ctx, "Error unscheduling post", "postID", postID, "error", err)
+		}
+		_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+		return nil, ErrSchedulingUnavailable
+	}
+
+	post.ScheduledAt, post.ScheduledVersion = &at, version
+	slog.InfoContext(ctx, "Post scheduled", "postID", postID, "at", at, "version", version)
+	return &post, nil
+}
+
+// UnschedulePost cancels the scheduled publish of a post, if it has one. Requires editor
+// access.
+func (s *Service) UnschedulePost(ctx context.Context, userID, postID string) (*models.Post, error) {
+	meta, err := s.getPostForDraft(ctx, userID, postID, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	post := *meta
+	if post.ScheduledAt == nil {
+		return &post, nil
+	}
+	if err := s.clearSchedule(ctx, postID); err != nil {
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	post.ScheduledAt, post.ScheduledVersion = nil, 0
+	slog.InfoContext(ctx, "Post unscheduled", "postID", postID)
+	return &post, nil
+}
+
+// enqueuePublish queues the scheduled publish of a post at at, to run after delay. While
+// one is queued, queueing it again is a no-op.
+func (s *Service) enqueuePublish(ctx context.Context, postID string, at time.Time, delay time.Duration) error {
+	jobID := fmt.Sprintf("publish:%s:%d", postID, at.Unix())
+	return s.enqueueJob(ctx, jobPublishPost, publishPostJob{PostID: postID, At: at}, jobs.WithID(jobID), jobs.WithDelay(delay))
+}
+
+// runPublishDuePostsJob queues the publish of every post that is due, in case its
+// delayed job was lost. A post whose job is still queued or running is left to it.
+func (s *Service) runPublishDuePostsJob(ctx context.Context, job *jobs.Job) error {
+	posts, err := s.db.ListDuePosts(ctx, s.now().UTC(), maxDuePostsPerSweep)
+	if err != nil {
+		return fmt.Errorf("failed to list due posts: %w", err)
+	}
+	for _, post := range posts {
+		if err := s.enqueuePublish(ctx, post.ID, *post.ScheduledAt, 0); err != nil {
+			return fmt.Errorf("failed to queue publish of post %s: %w", post.ID, err)
+		}
+	}
+	if len(posts) > 0 {
+		slog.InfoContext(ctx, "Queued due scheduled posts", "count", len(posts))
+	}
+	return nil
+}
+
+// clearSchedule removes a post's schedule; its job finds it gone and does nothing.
+func (s *Service) clearSchedule(ctx context.Context, postID string) error {
+	if err := s.db.SetPostSchedule(ctx, postID, nil, 0); err != nil {
+		slog.ErrorContext(ctx, "Error unscheduling post", "postID", postID, "error", err)
+		return err
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	return nil
+}
+
+// runPublishPostJob publishes a post that is due, on behalf of its owner. A schedule
+// that can no longer be carried out (the post was trashed or taken down, or its draft
+// moved past the scheduled version) is dropped.
+func (s *Service) runPublishPostJob(ctx context.Context, job *jobs.Job) error {
+	var payload publishPostJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	post, err := s.db.GetPostMetaByID(ctx, payload.PostID) // Not the cache: it may be stale
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if post.ScheduledAt == nil || !post.ScheduledAt.Equal(payload.At) {
+		return nil // Superseded or cancelled
+	}
+	if post.DeletedAt != nil {
+		return s.clearSchedule(ctx, post.ID) // Else the sweep would keep finding it
+	}
+
+	_, err = s.PublishPost(ctx, post.UserID, post.ID, post.ScheduledVersion)
+	if errors.Is(err, ErrVersionConflict) || errors.Is(err, ErrItemNotFound) || errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrPostTakenDown) {
+		slog.WarnContext(ctx, "Dropping scheduled publish of post", "postID", post.ID, "version", post.ScheduledVersion, "error", err)
+		_ = s.clearSchedule(ctx, post.ID)
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Scheduled post published", "postID", post.ID)
+	s.notify(ctx, post.UserID, models.Notification{
+		Type: models.NotifyPublish, Title: "Your scheduled post was published",
+		ItemID: post.ID, ItemType: models.ItemTypePost, Tag: "publish:" + post.ID,
+	})
+	return nil
+}
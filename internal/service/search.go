@@ -0,0 +1,147 @@
+// internal/service/search.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/search"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrSearchDisabled     = apperr.New(apperr.Unavailable, "search is not enabled")
+	ErrInvalidSearchQuery = apperr.New(apperr.Validation, "search query is required")
+)
+
+// EnableSearch turns on full-text search backed by index. Updates are queued on every
+// write and applied by RunSearchIndexer.
+func (s *Service) EnableSearch(index search.SearchAdapter, queueSize int) {
+	s.searchIndex = index
+	s.indexer = search.NewIndexer(index, s.loadSearchDocument, queueSize)
+}
+
+// RunSearchIndexer applies queued index updates until ctx is cancelled.
+func (s *Service) RunSearchIndexer(ctx context.Context) {
+	if s.indexer == nil {
+		return
+	}
+	slog.InfoContext(ctx, "Search indexer started")
+	s.indexer.Run(ctx)
+}
+
+// queueSearchUpdate schedules an item to be reindexed (or dropped from the index if it
+// no longer exists). It is a no-op when search is disabled.
+func (s *Service) queueSearchUpdate(ctx context.Context, itemID string, itemType models.ItemType) {
+	if s.indexer != nil {
+		s.indexer.Enqueue(ctx, itemID, string(itemType))
+	}
+}
+
+// loadSearchDocument builds the search document for an item from its current state.
+func (s *Service) loadSearchDocument(ctx context.Context, itemID, itemTypeStr string) (*search.Document, error) {
+	meta, err := s.getItemMetaWithCache(ctx, itemID, models.ItemType(itemTypeStr))
+	if err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			return nil, nil // Deleted or trashed
+		}
+		return nil, err
+	}
+	return s.buildSearchDocument(ctx, meta)
+}
+
+// buildSearchDocument reads the live content of a post or code file into a document.
+func (s *Service) buildSearchDocument(ctx context.Context, meta models.ItemMeta) (*search.Document, error) {
+	doc := &search.Document{TenantID: tenant.ID(ctx)}
+	var itemType models.ItemType
+	var s3Path string
+	var version int
+	switch m := meta.(type) {
+	case *models.Post:
+		itemType = models.ItemTypePost
+		doc.ItemID, doc.UserID, doc.Title, doc.UpdatedAt = m.ID, m.UserID, m.Title, m.UpdatedAt
+		s3Path, version = m.S3Path, m.Version
+	case *models.CodeFile:
+		itemType = models.ItemTypeCodeFile
+		doc.ItemID, doc.UserID, doc.Title, doc.UpdatedAt = m.ID, m.UserID, codeFilePath(m), m.UpdatedAt
+		s3Path, version = m.S3Path, m.Version
+	}
+	doc.ItemType = string(itemType)
+	doc.ID = search.DocumentID(doc.ItemType, doc.ItemID)
+	if s3Path != "" {
+		content, err := s.getItemContentFromSource(ctx, doc.ItemID, itemType, version, s3Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load content of %s: %w", doc.ID, err)
+		}
+		doc.Content = content
+	}
+	return doc, nil
+}
+
+// Search finds the user's posts and code files matching text, best match first.
+// itemTypeStr optionally restricts results to one item type.
+func (s *Service) Search(ctx context.Context, userID, text, itemTypeStr string, limit, offset int) (*search.Results, error) {
+	if s.searchIndex == nil {
+		return nil, ErrSearchDisabled
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrInvalidSearchQuery
+	}
+	if itemTypeStr != "" && !models.ItemType(itemTypeStr).IsValid() {
+		return nil, ErrInvalidItemType
+	}
+
+	results, err := s.searchIndex.Search(ctx, search.Query{
+		UserID: userID, TenantID: tenant.ID(ctx), Text: text, ItemType: itemTypeStr, Limit: limit, Offset: offset,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error searching for user", "userID", userID, "error", err)
+		return nil, errors.New("search failed")
+	}
+	return results, nil
+}
+
+// ReindexSearch rebuilds the search index from the database: every live post and code
+// file of every user is read and written in bulk. With reset, the index is emptied first
+// so documents of items that no longer exist are dropped too. It returns the number of
+// documents indexed. Items that fail to load are logged and skipped.
+func (s *Service) ReindexSearch(ctx context.Context, reset bool) (int, error) {
+	if s.searchIndex == nil {
+		return 0, ErrSearchDisabled
+	}
+	if reset {
+		if err := s.searchIndex.Reset(ctx); err != nil {
+			return 0, fmt.Errorf("failed to reset search index: %w", err)
+		}
+	}
+
+	indexed := 0
+	err := s.forEachItemPage(ctx, func(metas []models.ItemMeta) error {
+		n, err := s.bulkIndex(ctx, metas)
+		indexed += n
+		return err
+	})
+	return indexed, err
+}
+
+// bulkIndex builds documents for a page of item metadata and indexes them in one batch.
+func (s *Service) bulkIndex(ctx context.Context, metas []models.ItemMeta) (int, error) {
+	docs := make([]*search.Document, 0, len(metas))
+	for _, meta := range metas {
+		doc, err := s.buildSearchDocument(ctx, meta)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping item in reindex", "error", err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if err := s.searchIndex.Bulk(ctx, docs); err != nil {
+		return 0, fmt.Errorf("failed to index batch: %w", err)
+	}
+	return len(docs), nil
+}
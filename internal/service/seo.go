@@ -0,0 +1,43 @@
+// internal/service/seo.go
+package service
+
+import (
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxCanonicalURLLength    = 2048
+	maxMetaDescriptionLength = 300
+)
+
+var (
+	ErrInvalidCanonicalURL    = apperr.New(apperr.Validation, "canonical URL must be an absolute http or https URL of at most 2048 characters")
+	ErrInvalidMetaDescription = apperr.New(apperr.Validation, "meta description must be at most 300 characters")
+)
+
+// normalizeCanonicalURL trims a user-supplied canonical URL and checks it is an absolute
+// web URL. An empty URL is valid and means the post's own URL is canonical.
+func normalizeCanonicalURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > maxCanonicalURLLength {
+		return "", ErrInvalidCanonicalURL
+	}
+	return raw, nil
+}
+
+// normalizeMetaDescription trims a user-supplied meta description and checks its length.
+// An empty description means search engines are given the excerpt instead.
+func normalizeMetaDescription(description string) (string, error) {
+	description = strings.Join(strings.Fields(description), " ") // A single line
+	if utf8.RuneCountInString(description) > maxMetaDescriptionLength {
+		return "", ErrInvalidMetaDescription
+	}
+	return description, nil
+}
@@ -5,17 +5,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/audit"
 	"github.com/kkuzar/blog_system/internal/auth"
 	"github.com/kkuzar/blog_system/internal/cache"  // Added
 	"github.com/kkuzar/blog_system/internal/config" // Added
 	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/formatter"
+	"github.com/kkuzar/blog_system/internal/frontmatter"
+	"github.com/kkuzar/blog_system/internal/hooks"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/langdetect"
+	"github.com/kkuzar/blog_system/internal/mail"
 	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/runner"
+	"github.com/kkuzar/blog_system/internal/search"
+	"github.com/kkuzar/blog_system/internal/spam"
 	"github.com/kkuzar/blog_system/internal/storage"
-	"github.com/kkuzar/blog_system/utils/pointer" // Added
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"github.com/kkuzar/blog_system/internal/webpush"
 	"io"
-	"log"
+	"log/slog"
+	"net"
+	"path"
+	"slices"
 	"strings"
-	"sync" // Added for change counter
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -29,74 +46,145 @@ type Service struct {
 	storage storage.StorageAdapter
 	cache   cache.Cache    // Added
 	cfg     *config.Config // Added
-	// Track changes since last snapshot (in-memory, simple approach)
-	// For multi-node, this needs distributed tracking (e.g., Redis counter)
-	changeCounters map[string]int // Key: itemType:itemID
-	counterMutex   sync.Mutex
+	// Track changes since last snapshot. Backed by Redis when available so
+	// counts are shared across replicas; falls back to an in-memory map.
+	changeCounter cache.Counter   // Key: itemType:itemID
+	hotBuffers    *hotBufferCache // Line buffers of recently edited items, keyed like changeCounter
+	searchIndex   search.SearchAdapter
+	indexer       *search.Indexer // Nil when search is disabled
+	stats         *statsRecorder  // View/edit counts waiting for RunStatsFlusher
+	viewDedup     cache.Deduper   // Viewers already counted today
+	usage         *usageRecorder  // Request/message counts waiting for RunStatsFlusher
+	usageCounter  cache.Counter   // Today's uses against the daily quotas; see allowUsage
+	itemLocks     cache.Locker    // Serializes content writes; nil unless write locks are enabled
+	jobs          *jobs.Queue     // Background work; see UseJobQueue
+	auditLog      *audit.Exporter // Nil unless audit export is configured; see UseAuditExporter
+	formatters    *formatter.Registry
+	runner        runner.Runner                   // Nil when code execution is disabled
+	runs          *runLimiter                     // Bounds concurrent runs; set with runner
+	siteBuilder   StaticSiteBuilder               // See UseStaticSiteBuilder
+	contentHooks  []hooks.Hook                    // See RegisterHook
+	runtime       atomic.Pointer[runtimeSettings] // Settings ReloadConfig may change
+	loadConfig    func() (*config.Config, error)  // See UseConfigLoader
+	reloadMu      sync.Mutex                      // Serializes ReloadConfig
+	writes        writeTracker                    // Content changes in progress; see DrainWrites
+	siteThemes    map[string]bool                 // Themes users may pick; see UseSiteThemes
+	resolver      *net.Resolver                   // Looks up domain verification records
+	push          *webpush.Sender                 // Nil unless Web Push is configured; see UsePushSender
+	notifyDedup   cache.Deduper                   // Edits already notified recently
+	reportDedup   cache.Deduper                   // Content users already reported; see ReportContent
+	mailer        *mail.Mailer                    // Nil unless email is configured; see UseMailer
+	spam          spam.Checker                    // Nil unless spam checking is configured; see UseSpamChecker
+	userLimits    cache.RateLimiter               // Per-user limits on comments, mentions and reports; see allowUserAction
+	// Maintenance mode, kept in line with sharedSettings; see maintenance.go
+	maintenance    atomic.Pointer[models.MaintenanceStatus]
+	sharedSettings cache.Settings
+	// Set by NewService's options; see options.go
+	now              func() time.Time
+	newID            func() string
+	hashCost         int
+	snapshotStrategy SnapshotStrategy
+	onItemChanged    []ItemHook
+	onItemDeleted    []ItemHook
 }
 
-// NewService creates a new service instance.
-func NewService(db database.DBAdapter, storage storage.StorageAdapter, cache cache.Cache, cfg *config.Config) *Service {
-	return &Service{
-		db:             db,
-		storage:        storage,
-		cache:          cache, // Injected
-		cfg:            cfg,   // Injected
-		changeCounters: make(map[string]int),
-		counterMutex:   sync.Mutex{},
-	}
+// NewService creates a new service instance, customized by opts.
+func NewService(db database.DBAdapter, storage storage.StorageAdapter, cacheAdapter cache.Cache, cfg *config.Config, opts ...Option) *Service {
+	formatters, err := formatter.NewRegistry(&cfg.Format)
+	if err != nil {
+		slog.Warn("Invalid formatter configuration, code formatting disabled", "error", err)
+		formatters = &formatter.Registry{}
+	}
+	s := &Service{
+		db:            db,
+		storage:       storage,
+		cache:         cacheAdapter, // Injected
+		cfg:           cfg,          // Injected
+		changeCounter: cache.NewCounter(cacheAdapter),
+		hotBuffers:    newHotBufferCache(),
+		stats:         newStatsRecorder(),
+		viewDedup:     cache.NewDeduper(cacheAdapter),
+		usage:         newUsageRecorder(),
+		usageCounter:  cache.NewCounter(cacheAdapter),
+		notifyDedup:   cache.NewDeduper(cacheAdapter),
+		reportDedup:   cache.NewDeduper(cacheAdapter),
+		userLimits:    cache.NewRateLimiter(cacheAdapter), // Shared through Redis when available
+		formatters:    formatters,
+		resolver:      net.DefaultResolver,
+
+		now:              time.Now,
+		newID:            uuid.NewString,
+		hashCost:         bcrypt.DefaultCost,
+		snapshotStrategy: EveryNChanges,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if cfg.WriteLock.Enabled {
+		s.itemLocks = cache.NewLocker(cacheAdapter)
+	}
+	s.runtime.Store(newRuntimeSettings(cfg))
+	s.maintenance.Store(newMaintenanceStatus(&cfg.Server, s.now().UTC()))
+	s.sharedSettings = cache.NewSettings(cacheAdapter) // Shared through Redis when available
+	return s
 }
 
-// --- Cache Keys (centralized, though could be in cache package) ---
-const (
-	userCacheDuration        = 1 * time.Hour
-	itemMetaCacheDuration    = 30 * time.Minute
-	itemContentCacheDuration = 10 * time.Minute // Shorter for content
-)
-
 // --- Error Definitions ---
 var (
-	ErrInvalidCredentials = errors.New("invalid username or password")
-	ErrUsernameTaken      = errors.New("username is already taken")
-	ErrItemNotFound       = errors.New("item not found")
-	ErrPermissionDenied   = errors.New("permission denied")
-	ErrInvalidItemType    = errors.New("invalid item type specified")
-	ErrVersionConflict    = errors.New("version conflict: item has been updated by another session")
-	ErrApplyChange        = errors.New("failed to apply changes to content")
-	ErrRevertNotAllowed   = errors.New("revert is only allowed for create or snapshot actions")
-	ErrHistoryLogNotFound = errors.New("target history log entry not found")
-	ErrInconsistentState  = errors.New("critical inconsistency detected") // For DB/S3 issues
+	ErrInvalidCredentials = apperr.New(apperr.Unauthenticated, "invalid username or password")
+	ErrUsernameTaken      = apperr.New(apperr.Conflict, "username is already taken")
+	ErrItemNotFound       = apperr.New(apperr.NotFound, "item not found")
+	ErrPermissionDenied   = apperr.New(apperr.PermissionDenied, "permission denied")
+	ErrInvalidItemType    = apperr.New(apperr.Validation, "invalid item type specified")
+	ErrVersionConflict    = apperr.New(apperr.Conflict, "version conflict: item has been updated by another session")
+	ErrApplyChange        = apperr.New(apperr.Unprocessable, "failed to apply changes to content")
+	ErrRevertNotAllowed   = apperr.New(apperr.Validation, "cannot revert to a delete action")
+	ErrHistoryLogNotFound = apperr.New(apperr.NotFound, "target history log entry not found")
+	ErrInconsistentState  = apperr.New(apperr.Internal, "critical inconsistency detected") // For DB/S3 issues
 )
 
 // --- User Methods (with Caching) ---
 
 func (s *Service) RegisterUser(ctx context.Context, username, password string) (*models.User, error) {
+	user, err := s.registerUser(ctx, username, password)
+	s.auditAuth(ctx, audit.AuthRegister, username, err)
+	return user, err
+}
+
+func (s *Service) registerUser(ctx context.Context, username, password string) (*models.User, error) {
 	// ... (hashing logic) ...
 	user := &models.User{
 		ID:           username,
 		Username:     username,
+		TenantID:     tenant.ID(ctx),
 		PasswordHash: string(hashedPassword),
-		CreatedAt:    time.Now().UTC(),
+		CreatedAt:    s.now().UTC(),
 	}
 
 	err = s.db.CreateUser(ctx, user)
 	// ... (error handling: ErrDuplicateUser -> ErrUsernameTaken) ...
 
 	// Cache the new user (optional, as login will cache)
-	// s.cache.SetUser(ctx, user, userCacheDuration) // Be careful caching before hash is cleared
+	// s.cache.SetUser(ctx, user, s.settings().userCacheTTL) // Be careful caching before hash is cleared
 
 	user.PasswordHash = "" // Clear hash before returning/caching
 	return user, nil
 }
 
 func (s *Service) LoginUser(ctx context.Context, username, password string) (string, *models.User, error) {
+	token, user, err := s.loginUser(ctx, username, password)
+	s.auditAuth(ctx, audit.AuthLogin, username, err)
+	return token, user, err
+}
+
+func (s *Service) loginUser(ctx context.Context, username, password string) (string, *models.User, error) {
 	// 1. Check Cache
 	cachedUser, err := s.cache.GetUser(ctx, username)
 	if err == nil && cachedUser != nil {
 		// Still need to fetch from DB for password hash comparison
 		// log.Printf("User %s meta found in cache, fetching full from DB for auth", username)
 	} else if err != nil && !errors.Is(err, cache.ErrNotFound) {
-		log.Printf("Cache error fetching user %s: %v", username, err)
+		slog.ErrorContext(ctx, "Cache error fetching user", "username", username, "error", err)
 		// Proceed to DB, but log the cache error
 	}
 
@@ -111,21 +199,40 @@ func (s *Service) LoginUser(ctx context.Context, username, password string) (str
 	// ... (handle bcrypt error -> ErrInvalidCredentials) ...
 
 	// 4. Generate JWT
-	token, err := auth.GenerateJWT(user.ID)
+	token, err := auth.GenerateJWT(user.ID, tenant.ID(ctx))
 	// ... (handle JWT error) ...
 
 	// 5. Cache User (without hash)
 	user.PasswordHash = ""
-	if cacheErr := s.cache.SetUser(ctx, user, userCacheDuration); cacheErr != nil {
-		log.Printf("Failed to cache user %s after login: %v", username, cacheErr)
+	if cacheErr := s.cache.SetUser(ctx, user, s.settings().userCacheTTL); cacheErr != nil {
+		slog.WarnContext(ctx, "Failed to cache user after login", "username", username, "error", cacheErr)
 	}
 
 	return token, user, nil
 }
 
+// ResetPassword replaces a user's password, e.g. for an administrator when the user has
+// lost theirs. Tokens issued before stay valid until they expire.
+func (s *Service) ResetPassword(ctx context.Context, username, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.hashCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.db.SetUserPasswordHash(ctx, username, string(hashedPassword)); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error resetting password", "username", username, "error", err)
+		return err
+	}
+	_ = s.cache.DeleteUser(ctx, username)
+	s.auditAuth(ctx, audit.AuthPasswordReset, username, nil)
+	return nil
+}
+
 // --- Read/List Methods (with Caching) ---
 
-func (s *Service) getItemMetaWithCache(ctx context.Context, itemID string, itemType models.ItemType) (interface{}, error) {
+func (s *Service) getItemMetaWithCache(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
 	// 1. Check Cache
 	cachedMeta, err := s.cache.GetItemMeta(ctx, itemID, itemType)
 	if err == nil && cachedMeta != nil {
@@ -133,68 +240,177 @@ func (s *Service) getItemMetaWithCache(ctx context.Context, itemID string, itemT
 		return cachedMeta, nil
 	}
 	if err != nil && !errors.Is(err, cache.ErrNotFound) {
-		log.Printf("Cache error fetching item meta %s (%s): %v", itemID, itemType, err)
+		slog.ErrorContext(ctx, "Cache error fetching item meta", "itemID", itemID, "itemType", itemType, "error", err)
 	}
 
 	// 2. Fetch from DB
-	var dbMeta interface{}
-	var dbErr error
+	dbMeta, dbErr := s.loadItemMeta(ctx, itemID, itemType)
+	if dbErr != nil {
+		return nil, dbErr
+	}
+	if dbMeta.IsTrashed() {
+		return nil, ErrItemNotFound // Only restore/purge see trashed items
+	}
+	if t := dbMeta.GetTenantID(); t != "" && t != tenant.ID(ctx) {
+		return nil, ErrItemNotFound // Each tenant has its own database; this is a safeguard
+	}
+
+	// 3. Set Cache
+	if cacheErr := s.cache.SetItemMeta(ctx, dbMeta, s.settings().itemMetaCacheTTL); cacheErr != nil {
+		slog.WarnContext(ctx, "Failed to cache item meta", "itemID", itemID, "itemType", itemType, "error", cacheErr)
+	}
+
+	return dbMeta, nil
+}
+
+// loadItemMeta reads an item's meta from the database, trashed or not.
+func (s *Service) loadItemMeta(ctx context.Context, itemID string, itemType models.ItemType) (models.ItemMeta, error) {
+	var meta models.ItemMeta
+	var err error
 	switch itemType {
 	case models.ItemTypePost:
-		dbMeta, dbErr = s.db.GetPostMetaByID(ctx, itemID)
+		meta, err = s.db.GetPostMetaByID(ctx, itemID)
 	case models.ItemTypeCodeFile:
-		dbMeta, dbErr = s.db.GetCodeFileMetaByID(ctx, itemID)
+		meta, err = s.db.GetCodeFileMetaByID(ctx, itemID)
 	default:
 		return nil, ErrInvalidItemType
 	}
-
-	if dbErr != nil {
-		return nil, mapDBError(dbErr, itemType, itemID) // mapDBError handles ErrNotFound
+	if err != nil {
+		return nil, mapDBError(err, itemType, itemID) // mapDBError handles ErrNotFound
 	}
+	return meta, nil
+}
 
-	// 3. Set Cache
-	if cacheErr := s.cache.SetItemMeta(ctx, itemID, itemType, dbMeta, itemMetaCacheDuration); cacheErr != nil {
-		log.Printf("Failed to cache item meta %s (%s): %v", itemID, itemType, cacheErr)
+// getItemMetaAs is getItemMetaWithCache for meta of a known type T, whose item type it
+// looks up.
+func getItemMetaAs[T models.ItemMeta](ctx context.Context, s *Service, itemID string) (T, error) {
+	var zero T
+	meta, err := s.getItemMetaWithCache(ctx, itemID, zero.Type())
+	if err != nil {
+		return zero, err
 	}
-
-	return dbMeta, nil
+	typed, ok := meta.(T)
+	if !ok { // The cache and database return meta of the type asked for
+		return zero, fmt.Errorf("item meta of %s %s has type %T", zero.Type(), itemID, meta)
+	}
+	return typed, nil
 }
 
 func (s *Service) GetPostDetails(ctx context.Context, postID string) (*models.Post, error) {
-	meta, err := s.getItemMetaWithCache(ctx, postID, models.ItemTypePost)
+	return getItemMetaAs[*models.Post](ctx, s, postID)
+}
+
+func (s *Service) GetCodeFileDetails(ctx context.Context, fileID string) (*models.CodeFile, error) {
+	return getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+}
+
+// List methods generally don't benefit as much from simple caching unless results are static
+// or complex cache invalidation is implemented. Skipping cache for List... for now.
+// Archived items are left out unless includeArchived.
+func (s *Service) ListUserPosts(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.Post, error) {
+	posts, err := s.db.ListPostMetaByUser(ctx, userID, limit, offset, includeArchived)
 	if err != nil {
-		return nil, err // Already mapped by getItemMetaWithCache
+		slog.ErrorContext(ctx, "Error listing posts", "userID", userID, "error", err)
+		return nil, errors.New("failed to list posts")
 	}
-	post, ok := meta.(*models.Post)
-	if !ok {
-		log.Printf("ERROR: Invalid type returned from cache/DB for post %s", postID)
-		_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost) // Clear bad cache entry
-		return nil, errors.New("internal error retrieving post details")
+	return posts, nil
+}
+func (s *Service) ListUserCodeFiles(ctx context.Context, userID string, limit, offset int, includeArchived bool) ([]models.CodeFile, error) {
+	files, err := s.db.ListCodeFileMetaByUser(ctx, userID, limit, offset, includeArchived)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing codefiles", "userID", userID, "error", err)
+		return nil, errors.New("failed to list code files")
 	}
-	return post, nil
+	return files, nil
 }
 
-func (s *Service) GetCodeFileDetails(ctx context.Context, fileID string) (*models.CodeFile, error) {
-	meta, err := s.getItemMetaWithCache(ctx, fileID, models.ItemTypeCodeFile)
-	if err != nil {
-		return nil, err
+// itemPageSize is how many items are read from the database at a time when walking
+// every item, e.g. for a search reindex or history compaction.
+const itemPageSize = 100
+
+// sweepProgress is the checkpoint of a job that walks every user: the last user done.
+type sweepProgress struct {
+	LastUserID string `json:"lastUserId"`
+}
+
+// remainingUsers sorts userIDs and, if the job running in ctx is resuming a sweep, drops
+// the users up to its last checkpoint.
+func remainingUsers(ctx context.Context, userIDs []string) []string {
+	slices.Sort(userIDs)
+	var progress sweepProgress
+	if !jobs.LoadProgress(ctx, &progress) {
+		return userIDs
 	}
-	file, ok := meta.(*models.CodeFile)
-	if !ok {
-		log.Printf("ERROR: Invalid type returned from cache/DB for codefile %s", fileID)
-		_ = s.cache.DeleteItemMeta(ctx, fileID, models.ItemTypeCodeFile) // Clear bad cache entry
-		return nil, errors.New("internal error retrieving code file details")
+	i, found := slices.BinarySearch(userIDs, progress.LastUserID)
+	if found {
+		i++
 	}
-	return file, nil
+	return userIDs[i:]
 }
 
-// List methods generally don't benefit as much from simple caching unless results are static
-// or complex cache invalidation is implemented. Skipping cache for List... for now.
-func (s *Service) ListUserPosts(ctx context.Context, userID string, limit, offset int) ([]models.Post, error) {
-	// ... (fetch directly from DB) ...
+// allowUserAction reports whether userID may take one more action of a kind limited to
+// perHour an hour, e.g. posting a comment; 0 is no limit. If the limiter fails, the action
+// is allowed.
+func (s *Service) allowUserAction(ctx context.Context, action, userID string, perHour int) bool {
+	if perHour <= 0 {
+		return true
+	}
+	limit := cache.RateLimit{Rate: perHour, Period: time.Hour, Burst: max(perHour/4, 1)}
+	allowed, _, err := s.userLimits.Allow(ctx, "user-limit:"+action+":"+tenant.ID(ctx)+":"+userID, limit)
+	if err != nil {
+		slog.WarnContext(ctx, "Rate limiter failed, allowing action", "action", action, "userID", userID, "error", err)
+		return true
+	}
+	return allowed
 }
-func (s *Service) ListUserCodeFiles(ctx context.Context, userID string, limit, offset int) ([]models.CodeFile, error) {
-	// ... (fetch directly from DB) ...
+
+// forEachItemPage calls fn with each page of live posts and code files (archived ones
+// included) of every user. It stops at the first error. Run from a job, it checkpoints
+// after each user, and a retry picks up after the last user done.
+func (s *Service) forEachItemPage(ctx context.Context, fn func(metas []models.ItemMeta) error) error {
+	userIDs, err := s.db.ListUserIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	for _, userID := range remainingUsers(ctx, userIDs) {
+		for offset := 0; ; offset += itemPageSize {
+			posts, err := s.db.ListPostMetaByUser(ctx, userID, itemPageSize, offset, true)
+			if err != nil {
+				return fmt.Errorf("failed to list posts of user %s: %w", userID, err)
+			}
+			metas := make([]models.ItemMeta, len(posts))
+			for i := range posts {
+				metas[i] = &posts[i]
+			}
+			if err := fn(metas); err != nil {
+				return err
+			}
+			if len(posts) < itemPageSize {
+				break
+			}
+		}
+		for offset := 0; ; offset += itemPageSize {
+			files, err := s.db.ListCodeFileMetaByUser(ctx, userID, itemPageSize, offset, true)
+			if err != nil {
+				return fmt.Errorf("failed to list code files of user %s: %w", userID, err)
+			}
+			metas := make([]models.ItemMeta, len(files))
+			for i := range files {
+				metas[i] = &files[i]
+			}
+			if err := fn(metas); err != nil {
+				return err
+			}
+			if len(files) < itemPageSize {
+				break
+			}
+		}
+		if err := jobs.Checkpoint(ctx, sweepProgress{LastUserID: userID}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // --- Content Methods (with Caching) ---
@@ -205,79 +421,69 @@ func (s *Service) GetItemContent(ctx context.Context, userID, itemID string, ite
 		return "", 0, ErrInvalidItemType
 	}
 
-	// 1. Get Metadata (checks ownership, gets current version)
+	// 1. Get Metadata (checks access, gets current version)
 	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
 	if err != nil {
 		return "", 0, err // Already mapped
 	}
 
-	var s3Path string
-	var ownerUserID string
-	var currentVersion int
-
-	switch itemType {
-	case models.ItemTypePost:
-		postMeta := meta.(*models.Post)
-		if postMeta.UserID != userID {
-			return "", 0, ErrPermissionDenied
-		}
-		s3Path = postMeta.S3Path
-		ownerUserID = postMeta.UserID
-		currentVersion = postMeta.Version
-	case models.ItemTypeCodeFile:
-		fileMeta := meta.(*models.CodeFile)
-		if fileMeta.UserID != userID {
-			return "", 0, ErrPermissionDenied
-		}
-		s3Path = fileMeta.S3Path
-		ownerUserID = fileMeta.UserID
-		currentVersion = fileMeta.Version
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return "", 0, err
 	}
-	// Ownership check again just in case
-	if ownerUserID != userID {
-		return "", 0, ErrPermissionDenied
+
+	content, meta, err = s.loadCurrentContent(ctx, itemID, itemType, meta)
+	if err != nil {
+		return "", 0, err
 	}
+	return content, meta.GetVersion(), nil
+}
 
-	// 2. Check Content Cache
+// loadItemContent returns the content of an item's current version from the cache, or
+// else from storage, caching it. Content that is missing from storage is empty.
+func (s *Service) loadItemContent(ctx context.Context, itemID string, itemType models.ItemType, currentVersion int, s3Path, hash string) (string, error) {
+	// 1. Check Content Cache
 	cachedContent, err := s.cache.GetItemContent(ctx, itemID, itemType, currentVersion)
 	if err == nil {
 		// log.Printf("Content cache hit for %s %s v%d", itemType, itemID, currentVersion)
-		return cachedContent, currentVersion, nil
+		return cachedContent, nil
 	}
 	if err != nil && !errors.Is(err, cache.ErrNotFound) {
-		log.Printf("Cache error fetching item content %s (%s) v%d: %v", itemID, itemType, currentVersion, err)
+		slog.ErrorContext(ctx, "Cache error fetching item content", "itemID", itemID, "itemType", itemType, "currentVersion", currentVersion, "error", err)
 	}
 
-	// 3. Fetch from S3 if not cached
+	// 2. Fetch from S3 if not cached
 	if s3Path == "" {
 		// log.Printf("Item %s (%s) has no S3 path.", itemID, itemType)
-		return "", currentVersion, nil // No content, return current version
+		return "", nil // No content
 	}
 
 	reader, err := s.storage.DownloadFile(ctx, s3Path)
 	if err != nil {
 		if errors.Is(err, storage.ErrFileNotFound) {
-			log.Printf("S3 file not found for path %s (item %s, type %s)", s3Path, itemID, itemType)
-			return "", currentVersion, nil // Content missing, return current version
+			slog.InfoContext(ctx, "S3 file not found", "s3Path", s3Path, "itemID", itemID, "itemType", itemType)
+			return "", nil // Content missing
 		}
-		log.Printf("Error downloading file %s from storage: %v", s3Path, err)
-		return "", 0, errors.New("failed to retrieve content")
+		slog.ErrorContext(ctx, "Error downloading file from storage", "s3Path", s3Path, "error", err)
+		return "", errors.New("failed to retrieve content")
 	}
 	defer reader.Close()
 
 	contentBytes, err := io.ReadAll(reader)
 	if err != nil {
-		log.Printf("Error reading content stream for %s: %v", s3Path, err)
-		return "", 0, errors.New("failed to read content")
+		slog.ErrorContext(ctx, "Error reading content stream", "s3Path", s3Path, "error", err)
+		return "", errors.New("failed to read content")
+	}
+	content := string(contentBytes)
+	if err := s.verifyContent(ctx, itemID, itemType, currentVersion, s3Path, hash, content); err != nil {
+		return "", err // Not cached, so a restored object is served as soon as it's back
 	}
-	content = string(contentBytes)
 
-	// 4. Set Content Cache
-	if cacheErr := s.cache.SetItemContent(ctx, itemID, itemType, currentVersion, content, itemContentCacheDuration); cacheErr != nil {
-		log.Printf("Failed to cache item content %s (%s) v%d: %v", itemID, itemType, currentVersion, cacheErr)
+	// 3. Set Content Cache
+	if cacheErr := s.cache.SetItemContent(ctx, itemID, itemType, currentVersion, content, s.settings().itemContentCacheTTL); cacheErr != nil {
+		slog.WarnContext(ctx, "Failed to cache item content", "itemID", itemID, "itemType", itemType, "currentVersion", currentVersion, "error", cacheErr)
 	}
 
-	return content, currentVersion, nil
+	return content, nil
 }
 
 // ApplyItemChanges applies incremental changes with OCC, caching, and snapshotting.
@@ -286,8 +492,18 @@ func (s *Service) ApplyItemChanges(ctx context.Context, userID, itemID, itemType
 	if !itemType.IsValid() {
 		return 0, nil, ErrInvalidItemType
 	}
+	unlock, err := s.lockItemWrite(ctx, itemID, itemType) // Held until the DB update and caches are done
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+	return s.applyItemChanges(ctx, userID, itemID, itemType, baseVersion, changes)
+}
 
-	// 1. Get Metadata (checks ownership & base version via cache/DB)
+// applyItemChanges is ApplyItemChanges for callers that already hold the item's write
+// lock, e.g. to read the content the changes are worked out from under it too.
+func (s *Service) applyItemChanges(ctx context.Context, userID, itemID string, itemType models.ItemType, baseVersion int, changes []models.Change) (int, []models.Change, error) {
+	// 1. Get Metadata (checks access & base version via cache/DB)
 	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
 	if err != nil {
 		return 0, nil, err // Already mapped
@@ -297,99 +513,106 @@ func (s *Service) ApplyItemChanges(ctx context.Context, userID, itemID, itemType
 	var ownerUserID string
 	var currentVersion int
 	var contentType string
+	var oldSize int64
 
 	switch itemType {
 	case models.ItemTypePost:
 		postMeta := meta.(*models.Post)
-		if postMeta.UserID != userID {
-			return 0, nil, ErrPermissionDenied
-		}
-		if postMeta.Version != baseVersion {
-			log.Printf("Version conflict for %s %s: Client base %d, DB current %d", itemType, itemID, baseVersion, postMeta.Version)
-			return postMeta.Version, nil, ErrVersionConflict
-		}
 		s3Path = postMeta.S3Path
 		ownerUserID = postMeta.UserID
 		currentVersion = postMeta.Version
+		oldSize = postMeta.Size
 		contentType = "text/markdown"
 	case models.ItemTypeCodeFile:
 		fileMeta := meta.(*models.CodeFile)
-		if fileMeta.UserID != userID {
-			return 0, nil, ErrPermissionDenied
-		}
-		if fileMeta.Version != baseVersion {
-			log.Printf("Version conflict for %s %s: Client base %d, DB current %d", itemType, itemID, baseVersion, fileMeta.Version)
-			return fileMeta.Version, nil, ErrVersionConflict
-		}
 		s3Path = fileMeta.S3Path
 		ownerUserID = fileMeta.UserID
 		currentVersion = fileMeta.Version
+		oldSize = fileMeta.Size
 		contentType = "text/plain"
 	}
-	if ownerUserID != userID {
-		return 0, nil, ErrPermissionDenied
-	} // Redundant check
-
-	// 2. Generate S3 Path if missing
-	if s3Path == "" {
-		s3Path = generateS3Path(userID, itemID, itemType)
-		log.Printf("Generated S3 path for item %s (%s): %s", itemID, itemType, s3Path)
+	if err := s.authorizeItem(ctx, userID, ownerUserID, itemID, itemType, models.RoleEditor); err != nil {
+		return 0, nil, err
+	}
+	if currentVersion != baseVersion {
+		slog.InfoContext(ctx, "Version conflict", "itemType", itemType, "itemID", itemID, "baseVersion", baseVersion, "currentVersion", currentVersion)
+		return currentVersion, nil, ErrVersionConflict
 	}
 
-	// 3. Download Current Content (Check cache first)
-	currentContent, err := s.getItemContentFromSource(ctx, itemID, itemType, currentVersion, s3Path)
-	if err != nil {
-		log.Printf("Failed to get current content for patching %s %s v%d: %v", itemType, itemID, currentVersion, err)
-		return 0, nil, fmt.Errorf("failed to retrieve current content for update: %w", err)
+	// 2. Generate S3 Path if missing (content always lives under the owner)
+	if s3Path == "" {
+		s3Path = generateS3Path(ownerUserID, itemID, itemType)
+		slog.DebugContext(ctx, "Generated S3 path", "itemID", itemID, "itemType", itemType, "s3Path", s3Path)
+	}
+
+	// 3. Load Current Content (hot line buffer, then cache, then S3)
+	bufferKey := changeCounterKey(itemType, itemID)
+	buf, hot := s.hotBuffers.get(bufferKey, currentVersion)
+	if !hot {
+		currentContent, err := s.getItemContentFromSource(ctx, itemID, itemType, currentVersion, s3Path)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to get current content for patching", "itemType", itemType, "itemID", itemID, "currentVersion", currentVersion, "error", err)
+			return 0, nil, fmt.Errorf("failed to retrieve current content for update: %w", err)
+		}
+		buf = newLineBuffer(currentContent)
 	}
 
-	// 4. Apply Changes
-	newContent, applyErr := applyChanges(currentContent, changes)
+	// 4. Apply Changes (only the touched lines are rewritten)
+	applyErr := buf.applyAll(changes)
 	if applyErr != nil {
-		log.Printf("Error applying changes to %s %s: %v", itemType, itemID, applyErr)
+		slog.ErrorContext(ctx, "Error applying changes", "itemType", itemType, "itemID", itemID, "error", applyErr)
+		var validationErr *ChangeValidationError
+		if errors.As(applyErr, &validationErr) {
+			return currentVersion, nil, applyErr // Tell the client which change was rejected
+		}
 		return 0, nil, ErrApplyChange
 	}
+	newContent := buf.String()
+	newSize := int64(len(newContent))
+	if err := s.checkQuota(ctx, ownerUserID, s.contentWriteDelta(oldSize, newSize)); err != nil { // Charged to the owner
+		return currentVersion, nil, err
+	}
+
+	// --- Transaction-like block: Write Intent -> S3 Upload -> DB Update ---
+	// This order minimizes inconsistency if DB points to S3, and the intent lets
+	// repairWrite fix up a write that stops halfway.
 
-	// --- Transaction-like block: S3 Upload -> DB Update ---
-	// This order minimizes inconsistency if DB points to S3.
+	// Once started, the write isn't cancelled with its request (or at shutdown), so it
+	// can't stop between the upload and the DB update
+	ctx = context.WithoutCancel(ctx)
 
-	// 5. Upload Patched Content to S3 *FIRST*
+	// 5. Record the Write, then Upload Patched Content to S3 *FIRST*
+	intent := &models.WriteIntent{
+		UserID: userID, ItemID: itemID, ItemType: string(itemType), Action: models.ActionPatch,
+		S3Path: s3Path, BaseVersion: currentVersion, Changes: changes,
+	}
+	if err := s.beginWrite(ctx, intent, newContent); err != nil {
+		return 0, nil, errors.New("failed to save updated content to storage")
+	}
 	uploadErr := s.storage.UploadFile(ctx, s3Path, strings.NewReader(newContent), contentType)
 	if uploadErr != nil {
-		log.Printf("Error uploading content to storage for %s (%s) at path %s: %v", itemID, itemType, s3Path, uploadErr)
+		slog.ErrorContext(ctx, "Error uploading content to storage", "itemID", itemID, "itemType", itemType, "s3Path", s3Path, "error", uploadErr)
 		// Don't proceed to DB update if S3 fails
+		s.endWrite(ctx, intent)
 		return 0, nil, errors.New("failed to save updated content to storage")
 	}
 
 	// 6. Attempt to Update Metadata in DB (Atomic Version Increment)
-	now := time.Now().UTC()
+	now := s.now().UTC()
 	expectedNewVersion := currentVersion + 1
-	var dbUpdateErr error
-
-	switch itemType {
-	case models.ItemTypePost:
-		postMeta := meta.(*models.Post)
-		postMeta.UpdatedAt = now
-		postMeta.Version = currentVersion                // Expected version for DB check
-		postMeta.S3Path = s3Path                         // Ensure path is updated if generated
-		dbUpdateErr = s.db.UpdatePostMeta(ctx, postMeta) // DB adapter increments version
-	case models.ItemTypeCodeFile:
-		fileMeta := meta.(*models.CodeFile)
-		fileMeta.UpdatedAt = now
-		fileMeta.Version = currentVersion                    // Expected version for DB check
-		fileMeta.S3Path = s3Path                             // Ensure path is updated if generated
-		dbUpdateErr = s.db.UpdateCodeFileMeta(ctx, fileMeta) // DB adapter increments version
-	}
+	dbUpdateErr := s.updateContentMeta(ctx, userID, meta, currentVersion, s3Path, newContent, now)
 
 	if dbUpdateErr != nil {
-		// S3 succeeded, but DB failed! Inconsistent state.
-		log.Printf("CRITICAL INCONSISTENCY: S3 upload succeeded for %s %s path %s, but DB update failed: %v. Expected version %d.", itemType, itemID, s3Path, dbUpdateErr, currentVersion)
+		// S3 succeeded, but DB failed! Inconsistent until the intent is repaired.
+		slog.ErrorContext(ctx, "S3 upload succeeded but DB update failed, queued for repair", "itemType", itemType, "itemID", itemID, "s3Path", s3Path, "error", dbUpdateErr, "expectedVersion", currentVersion)
+		errreport.Error(ctx, "CRITICAL INCONSISTENCY: content uploaded but metadata update failed", dbUpdateErr, "itemType", itemType, "itemID", itemID, "s3Path", s3Path, "expectedVersion", currentVersion)
+		s.abortWrite(ctx, intent)
 
 		// Attempt to fetch the actual current version if it was a version mismatch
 		if errors.Is(dbUpdateErr, database.ErrVersionMismatch) {
 			latestVersion, fetchErr := s.getItemVersion(ctx, itemID, itemType)
 			if fetchErr != nil {
-				log.Printf("Failed to fetch latest version after DB conflict for %s %s: %v", itemType, itemID, fetchErr)
+				slog.WarnContext(ctx, "Failed to fetch latest version after DB conflict", "itemType", itemType, "itemID", itemID, "error", fetchErr)
 				return 0, nil, ErrInconsistentState // Return generic inconsistency error
 			}
 			// Return the actual latest version and the conflict error
@@ -401,30 +624,9 @@ func (s *Service) ApplyItemChanges(ctx context.Context, userID, itemID, itemType
 
 	// --- Post-Update Actions (Cache, History, Snapshot) ---
 
-	// 7. Invalidate/Update Caches
-	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)        // Invalidate meta cache
-	_ = s.cache.InvalidateItemContent(ctx, itemID, itemType) // Invalidate all old content versions
-	// Cache the new content immediately
-	if cacheErr := s.cache.SetItemContent(ctx, itemID, itemType, expectedNewVersion, newContent, itemContentCacheDuration); cacheErr != nil {
-		log.Printf("Failed to cache new item content %s (%s) v%d: %v", itemID, itemType, expectedNewVersion, cacheErr)
-	}
-
-	// 8. Log Action History (Patch)
-	for _, change := range changes {
-		changeLogData := change // Create copy
-		historyLog := &models.HistoryLog{
-			UserID: userID, ItemID: itemID, ItemType: itemTypeStr,
-			Action: models.ActionPatch, Timestamp: now,
-			ChangeData: &changeLogData, ItemVersion: expectedNewVersion,
-		}
-		_, logErr := s.db.LogAction(ctx, historyLog)
-		if logErr != nil {
-			log.Printf("WARNING: Failed to log history patch for %s %s: %v", itemID, itemType, logErr)
-		}
-	}
-
-	// 9. Snapshot Logic
-	s.handleSnapshotting(ctx, userID, itemID, itemType, itemTypeStr, expectedNewVersion, s3Path, len(changes))
+	// 7. Keep the patched lines hot, then caches, history, snapshot and search
+	s.hotBuffers.put(bufferKey, expectedNewVersion, buf)
+	s.finishWrite(ctx, intent, ownerUserID, oldSize, newContent, contentType, now)
 
 	return expectedNewVersion, changes, nil // Return applied changes for broadcast
 }
@@ -437,7 +639,7 @@ func (s *Service) getItemContentFromSource(ctx context.Context, itemID string, i
 		return cachedContent, nil
 	}
 	if err != nil && !errors.Is(err, cache.ErrNotFound) {
-		log.Printf("Cache error fetching content %s %s v%d: %v", itemType, itemID, version, err)
+		slog.ErrorContext(ctx, "Cache error fetching content", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
 		// Fall through to S3
 	}
 
@@ -464,85 +666,128 @@ func (s *Service) getItemContentFromSource(ctx context.Context, itemID string, i
 	return string(contentBytes), nil
 }
 
-// handleSnapshotting checks if a snapshot is needed and logs it.
-func (s *Service) handleSnapshotting(ctx context.Context, userID, itemID string, itemType models.ItemType, itemTypeStr string, currentVersion int, currentS3Path string, numChangesApplied int) {
-	interval := s.cfg.Snapshot.IntervalChanges
+// handleSnapshotting checks if a snapshot is needed and schedules it. The snapshot job
+// stores an immutable copy of the version's content, so later edits to the live object
+// don't change what the snapshot refers to.
+func (s *Service) handleSnapshotting(ctx context.Context, userID, itemID string, itemType models.ItemType, currentVersion int, numChangesApplied int) {
+	interval := s.settings().snapshotInterval
 	if interval <= 0 {
 		return // Snapshotting disabled
 	}
 
-	counterKey := fmt.Sprintf("%s:%s", itemType, itemID)
-
-	s.counterMutex.Lock()
-	s.changeCounters[counterKey] += numChangesApplied
-	count := s.changeCounters[counterKey]
-	if count >= interval {
-		s.changeCounters[counterKey] = 0 // Reset counter
-		s.counterMutex.Unlock()          // Unlock before logging
+	counterKey := changeCounterKey(itemType, itemID)
 
-		// Log the snapshot action
-		log.Printf("Creating snapshot for %s %s at version %d (change count %d >= %d)", itemType, itemID, currentVersion, count, interval)
-		snapshotLog := &models.HistoryLog{
-			UserID: userID, ItemID: itemID, ItemType: itemTypeStr,
-			Action:      models.ActionSnapshot,
-			Timestamp:   time.Now().UTC(), // Use current time for snapshot log
-			S3PathAfter: currentS3Path,    // Log the S3 path *at the time of snapshot*
-			ItemVersion: currentVersion,
-		}
-		_, logErr := s.db.LogAction(ctx, snapshotLog)
-		if logErr != nil {
-			log.Printf("WARNING: Failed to log snapshot action for %s %s: %v", itemID, itemType, logErr)
-			// Should we put the count back if logging fails? Maybe not, just log warning.
+	count, err := s.changeCounter.IncrBy(ctx, counterKey, int64(numChangesApplied))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to update change counter", "itemType", itemType, "itemID", itemID, "error", err)
+		return
+	}
+	state := SnapshotState{ItemID: itemID, ItemType: itemType, Version: currentVersion, Changes: count, Interval: interval}
+	if s.snapshotStrategy(state) {
+		if err := s.changeCounter.Reset(ctx, counterKey); err != nil {
+			slog.WarnContext(ctx, "Failed to reset change counter", "itemType", itemType, "itemID", itemID, "error", err)
 		}
-	} else {
-		s.counterMutex.Unlock()
+
+		slog.InfoContext(ctx, "Scheduling snapshot", "itemType", itemType, "itemID", itemID, "currentVersion", currentVersion, "count", count, "interval", interval)
+		s.scheduleSnapshot(ctx, userID, itemID, itemType, currentVersion)
 	}
 }
 
+// changeCounterKey returns the counter key tracking changes since an item's last snapshot.
+func changeCounterKey(itemType models.ItemType, itemID string) string {
+	return fmt.Sprintf("%s:%s", itemType, itemID)
+}
+
+// generateSnapshotPath returns the immutable storage key for an item's content at a given version.
+func generateSnapshotPath(itemID string, itemType models.ItemType, version int) string {
+	return fmt.Sprintf("snapshots/%s/%s/v%d", itemType, itemID, version)
+}
+
 // --- Create/Delete Methods (with Caching Invalidation) ---
 
-func (s *Service) CreatePost(ctx context.Context, userID, title, initialContent string) (*models.Post, error) {
-	// ... (generate slug, ID, path, create Post struct with Version: 1) ...
-	post := &models.Post{ /* ... */ Version: 1}
+// CreatePost creates a post. slug is optional; if empty one is generated from the title.
+func (s *Service) CreatePost(ctx context.Context, userID, title, slug, initialContent string) (*models.Post, error) {
+	if fields, _ := frontmatter.Parse(initialContent); title == "" && fields != nil && fields.Title != nil {
+		title = strings.TrimSpace(*fields.Title) // Imported content names itself
+	}
+	slug, generatedSlug, err := newPostSlug(title, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(ctx, userID, s.contentWriteDelta(0, int64(len(initialContent)))); err != nil {
+		return nil, err
+	}
+
+	// ... (generate ID, path, create Post struct with Version: 1) ...
+	post := &models.Post{ /* ... */ TenantID: tenant.ID(ctx), Slug: slug, Size: int64(len(initialContent)), ContentHash: contentHash(initialContent), Version: 1}
+	setReadingStats(post, initialContent)
+	setFrontMatter(post, initialContent)
 
 	// 1. Create Metadata in DB
-	dbPostID, err := s.db.CreatePostMeta(ctx, post)
+	dbPostID, err := s.createPostMeta(ctx, post, generatedSlug)
+	if errors.Is(err, ErrSlugTaken) {
+		return nil, err
+	}
 	// ... (handle error) ...
 	post.ID = dbPostID
 
 	// 2. Upload Initial Content to S3
 	// ... (handle upload) ...
+	s.adjustStorageUsage(ctx, userID, post.Size)
+	s.storeVersionContent(ctx, userID, post.ID, models.ItemTypePost, post.Version, initialContent, "text/markdown")
 
 	// 3. Log Action History (Create)
 	historyLog := &models.HistoryLog{ /* ... */ Action: models.ActionCreate, S3PathAfter: post.S3Path, ItemVersion: post.Version}
-	_, logErr := s.db.LogAction(ctx, historyLog)
-	// ... (handle log error) ...
+	s.logAction(ctx, historyLog)
 
 	// 4. Cache Meta & Content (optional, Get will cache anyway)
-	_ = s.cache.SetItemMeta(ctx, post.ID, models.ItemTypePost, post, itemMetaCacheDuration)
+	_ = s.cache.SetItemMeta(ctx, post, s.settings().itemMetaCacheTTL)
 	if initialContent != "" {
-		_ = s.cache.SetItemContent(ctx, post.ID, models.ItemTypePost, post.Version, initialContent, itemContentCacheDuration)
+		_ = s.cache.SetItemContent(ctx, post.ID, models.ItemTypePost, post.Version, initialContent, s.settings().itemContentCacheTTL)
 	}
+	s.queueSearchUpdate(ctx, post.ID, models.ItemTypePost)
+	s.runHooks(ctx, userID, post.ID, models.ItemTypePost, post.Version, hooks.ActionCreate, initialContent)
 
 	return post, nil
 }
 
 func (s *Service) CreateCodeFile(ctx context.Context, userID, fileName, language, initialContent string) (*models.CodeFile, error) {
 	// Similar to CreatePost:
+	filePath, err := normalizeCodePath(fileName) // fileName may include directories, e.g. "src/main.go"
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(ctx, userID, s.contentWriteDelta(0, int64(len(initialContent)))); err != nil {
+		return nil, err
+	}
+	if language == "" {
+		language = langdetect.Detect(filePath, initialContent) // May still be empty; clients fall back to plain text
+	}
 	// ... Create CodeFile struct with Version: 1 ...
-	codeFile := &models.CodeFile{ /* ... */ Version: 1}
+	codeFile := &models.CodeFile{ /* ... */ TenantID: tenant.ID(ctx), FileName: path.Base(filePath), Path: filePath, Size: int64(len(initialContent)), ContentHash: contentHash(initialContent), Version: 1}
 	// ... Create Meta in DB ...
 	// ... Upload Initial Content ...
+	s.adjustStorageUsage(ctx, userID, codeFile.Size)
+	s.storeVersionContent(ctx, userID, codeFile.ID, models.ItemTypeCodeFile, codeFile.Version, initialContent, "text/plain")
 	// ... Log ActionHistory (Create) ...
 	// ... Cache Meta & Content ...
+	s.queueSearchUpdate(ctx, codeFile.ID, models.ItemTypeCodeFile)
+	s.runHooks(ctx, userID, codeFile.ID, models.ItemTypeCodeFile, codeFile.Version, hooks.ActionCreate, initialContent)
 	return codeFile, nil
 }
 
+// DeleteItem moves an item to the trash. It can be restored with RestoreItem until
+// the trash retention window passes.
 func (s *Service) DeleteItem(ctx context.Context, userID, itemID, itemTypeStr string) error {
 	itemType := models.ItemType(itemTypeStr)
 	if !itemType.IsValid() {
 		return ErrInvalidItemType
 	}
+	unlock, err := s.lockItemWrite(ctx, itemID, itemType) // No content write lands on an item being trashed
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// 1. Get Metadata (for s3path, version, ownership check)
 	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType) // Use cache
@@ -579,35 +824,32 @@ func (s *Service) DeleteItem(ctx context.Context, userID, itemID, itemTypeStr st
 		return ErrPermissionDenied
 	}
 
-	// 2. Delete Metadata from DB
+	// 2. Move to the trash. Content stays in storage (and counts towards the quota)
+	// until the item is purged; see PurgeExpiredTrash.
+	now := s.now().UTC()
 	switch itemType {
 	case models.ItemTypePost:
-		err = s.db.DeletePostMeta(ctx, itemID)
+		err = s.db.SetPostDeletedAt(ctx, itemID, &now)
 	case models.ItemTypeCodeFile:
-		err = s.db.DeleteCodeFileMeta(ctx, itemID)
-	}
-	if err != nil { /* ... handle error ... */
+		err = s.db.SetCodeFileDeletedAt(ctx, itemID, &now)
 	}
-
-	// 3. Delete Content from S3
-	if s3Path != "" {
-		err = s.storage.DeleteFile(ctx, s3Path)
-		// ... Log warning on error ...
+	if err != nil {
+		slog.ErrorContext(ctx, "Error moving to trash", "itemType", itemType, "itemID", itemID, "error", err)
+		return mapDBError(err, itemType, itemID)
 	}
 
-	// 4. Log Action History (Delete)
-	historyLog := &models.HistoryLog{ /* ... */ Action: models.ActionDelete, S3PathBefore: s3Path, ItemVersion: currentVersion}
-	_, logErr := s.db.LogAction(ctx, historyLog)
-	// ... handle log error ...
+	// 3. Log Action History (Delete)
+	historyLog := &models.HistoryLog{ /* ... */ Action: models.ActionDelete, Timestamp: now, S3PathBefore: s3Path, ItemVersion: currentVersion}
+	s.logAction(ctx, historyLog)
 
-	// 5. Invalidate Caches
+	// 4. Invalidate Caches
 	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
 	_ = s.cache.InvalidateItemContent(ctx, itemID, itemType) // Clear all content versions
 
 	// Reset change counter for deleted item
-	s.counterMutex.Lock()
-	delete(s.changeCounters, fmt.Sprintf("%s:%s", itemType, itemID))
-	s.counterMutex.Unlock()
+	_ = s.changeCounter.Reset(ctx, changeCounterKey(itemType, itemID))
+	s.hotBuffers.remove(changeCounterKey(itemType, itemID))
+	s.queueSearchUpdate(ctx, itemID, itemType) // Trashed items drop out of search
 
 	return nil
 }
@@ -620,33 +862,27 @@ func (s *Service) GetHistory(ctx context.Context, userID, itemID, itemTypeStr st
 		return nil, ErrInvalidItemType
 	}
 
-	// 1. Verify user owns the item (optional but good practice)
+	// 1. Verify user can see the item
 	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
 	if err != nil {
 		return nil, err
 	} // Includes not found check
-	switch itemType {
-	case models.ItemTypePost:
-		if meta.(*models.Post).UserID != userID {
-			return nil, ErrPermissionDenied
-		}
-	case models.ItemTypeCodeFile:
-		if meta.(*models.CodeFile).UserID != userID {
-			return nil, ErrPermissionDenied
-		}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
 	}
 
 	// 2. Fetch history from DB
 	history, err := s.db.GetActionHistory(ctx, itemID, itemTypeStr, limit)
 	if err != nil {
-		log.Printf("Error fetching history for %s %s: %v", itemType, itemID, err)
+		slog.ErrorContext(ctx, "Error fetching history", "itemType", itemType, "itemID", itemID, "error", err)
 		return nil, errors.New("failed to retrieve history")
 	}
 	return history, nil
 }
 
 // RevertToAction reverts the item's content to the state *after* the targetLogID action.
-// Limited to reverting to 'create' or 'snapshot' log entries for simplicity.
+// Any entry except a delete can be targeted; the content is reconstructed from the
+// retained version object or by replaying patches (see reconstructVersion).
 func (s *Service) RevertToAction(ctx context.Context, userID, targetLogID string) (newItemVersion int, err error) {
 	// 1. Fetch the Target History Log Entry
 	targetLog, err := s.db.GetHistoryLogByID(ctx, targetLogID)
@@ -654,7 +890,7 @@ func (s *Service) RevertToAction(ctx context.Context, userID, targetLogID string
 		if errors.Is(err, database.ErrNotFound) {
 			return 0, ErrHistoryLogNotFound
 		}
-		log.Printf("Error fetching target history log %s: %v", targetLogID, err)
+		slog.ErrorContext(ctx, "Error fetching target history log", "targetLogID", targetLogID, "error", err)
 		return 0, errors.New("failed to retrieve target history state")
 	}
 
@@ -664,16 +900,16 @@ func (s *Service) RevertToAction(ctx context.Context, userID, targetLogID string
 		return 0, ErrInvalidItemType
 	}
 	// Check if revert is allowed for this action type
-	if targetLog.Action != models.ActionCreate && targetLog.Action != models.ActionSnapshot {
+	if targetLog.Action == models.ActionDelete {
 		return 0, ErrRevertNotAllowed
 	}
-	// S3 path must exist for create/snapshot
-	if targetLog.S3PathAfter == "" {
-		log.Printf("Cannot revert to log %s: Action is %s but S3PathAfter is missing.", targetLogID, targetLog.Action)
-		return 0, errors.New("cannot revert: target state content path missing")
+	unlock, err := s.lockItemWrite(ctx, targetLog.ItemID, itemType)
+	if err != nil {
+		return 0, err
 	}
+	defer unlock()
 
-	// 3. Verify Ownership (User owns the item associated with the log)
+	// 3. Verify Access (User can edit the item associated with the log)
 	meta, err := s.getItemMetaWithCache(ctx, targetLog.ItemID, itemType)
 	if err != nil {
 		return 0, err
@@ -683,110 +919,82 @@ func (s *Service) RevertToAction(ctx context.Context, userID, targetLogID string
 	var ownerUserID string
 	var currentVersion int
 	var contentType string
+	var oldSize int64
 
 	switch itemType {
 	case models.ItemTypePost:
 		postMeta := meta.(*models.Post)
-		if postMeta.UserID != userID {
-			return 0, ErrPermissionDenied
-		}
 		currentS3Path = postMeta.S3Path // Get the *current* S3 path to overwrite
 		ownerUserID = postMeta.UserID
 		currentVersion = postMeta.Version
+		oldSize = postMeta.Size
 		contentType = "text/markdown"
 	case models.ItemTypeCodeFile:
 		fileMeta := meta.(*models.CodeFile)
-		if fileMeta.UserID != userID {
-			return 0, ErrPermissionDenied
-		}
 		currentS3Path = fileMeta.S3Path
 		ownerUserID = fileMeta.UserID
 		currentVersion = fileMeta.Version
+		oldSize = fileMeta.Size
 		contentType = "text/plain"
 	}
-	if ownerUserID != userID {
-		return 0, ErrPermissionDenied
+	if err := s.authorizeItem(ctx, userID, ownerUserID, targetLog.ItemID, itemType, models.RoleEditor); err != nil {
+		return 0, err
 	}
 	if currentS3Path == "" { // Should not happen if item exists
-		log.Printf("ERROR: Item %s %s exists but has no current S3 path during revert.", itemType, targetLog.ItemID)
+		slog.ErrorContext(ctx, "Item exists but has no current S3 path during revert", "itemType", itemType, "itemID", targetLog.ItemID)
 		return 0, errors.New("internal error: item missing storage path")
 	}
 
-	// 4. Fetch the Content from the Target State's S3 Path
-	revertContentReader, err := s.storage.DownloadFile(ctx, targetLog.S3PathAfter)
+	// 4. Reconstruct the Content as of the Target Entry's Version
+	revertContent, err := s.reconstructVersion(ctx, targetLog.ItemID, itemType, targetLog.ItemVersion)
 	if err != nil {
-		log.Printf("Error downloading revert content from %s (log %s): %v", targetLog.S3PathAfter, targetLogID, err)
+		slog.ErrorContext(ctx, "Error reconstructing revert content", "itemType", itemType, "itemID", targetLog.ItemID, "itemVersion", targetLog.ItemVersion, "targetLogID", targetLogID, "error", err)
+		if errors.Is(err, ErrVersionNotAvailable) {
+			return 0, err
+		}
 		return 0, errors.New("failed to retrieve content for revert state")
 	}
-	defer revertContentReader.Close()
-	revertContentBytes, err := io.ReadAll(revertContentReader)
-	if err != nil {
-		log.Printf("Error reading revert content stream from %s (log %s): %v", targetLog.S3PathAfter, targetLogID, err)
-		return 0, errors.New("failed to read content for revert state")
+	newSize := int64(len(revertContent))
+	if err := s.checkQuota(ctx, ownerUserID, s.contentWriteDelta(oldSize, newSize)); err != nil {
+		return 0, err
 	}
-	revertContent := string(revertContentBytes)
 
-	// --- Transaction-like: Upload Reverted Content -> Update DB Meta ---
+	// --- Transaction-like: Write Intent -> Upload Reverted Content -> Update DB Meta ---
 
-	// 5. Upload Reverted Content to the *Current* S3 Path
+	// 5. Record the Write, then Upload Reverted Content to the *Current* S3 Path
+	intent := &models.WriteIntent{
+		UserID: userID, ItemID: targetLog.ItemID, ItemType: targetLog.ItemType, Action: models.ActionRevert,
+		S3Path: currentS3Path, BaseVersion: currentVersion, RevertedToLogID: targetLogID,
+	}
+	if err := s.beginWrite(ctx, intent, revertContent); err != nil {
+		return 0, errors.New("failed to save reverted content")
+	}
 	err = s.storage.UploadFile(ctx, currentS3Path, strings.NewReader(revertContent), contentType)
 	if err != nil {
-		log.Printf("Error uploading reverted content to %s for item %s %s: %v", currentS3Path, itemType, targetLog.ItemID, err)
+		slog.ErrorContext(ctx, "Error uploading reverted content", "currentS3Path", currentS3Path, "itemType", itemType, "itemID", targetLog.ItemID, "error", err)
+		s.endWrite(ctx, intent)
 		return 0, errors.New("failed to save reverted content")
 	}
 
 	// 6. Update Item Metadata (Increment version)
-	now := time.Now().UTC()
+	now := s.now().UTC()
 	expectedNewVersion := currentVersion + 1
-	var dbUpdateErr error
-
-	switch itemType {
-	case models.ItemTypePost:
-		postMeta := meta.(*models.Post)
-		postMeta.UpdatedAt = now
-		postMeta.Version = currentVersion // Expected version for DB check
-		dbUpdateErr = s.db.UpdatePostMeta(ctx, postMeta)
-	case models.ItemTypeCodeFile:
-		fileMeta := meta.(*models.CodeFile)
-		fileMeta.UpdatedAt = now
-		fileMeta.Version = currentVersion // Expected version for DB check
-		dbUpdateErr = s.db.UpdateCodeFileMeta(ctx, fileMeta)
-	}
+	dbUpdateErr := s.updateContentMeta(ctx, userID, meta, currentVersion, currentS3Path, revertContent, now)
 
 	if dbUpdateErr != nil {
-		log.Printf("CRITICAL INCONSISTENCY: S3 revert upload succeeded for %s %s path %s, but DB update failed: %v. Expected version %d.", itemType, targetLog.ItemID, currentS3Path, dbUpdateErr, currentVersion)
+		slog.ErrorContext(ctx, "S3 revert upload succeeded but DB update failed, queued for repair", "itemType", itemType, "itemID", targetLog.ItemID, "currentS3Path", currentS3Path, "error", dbUpdateErr, "expectedVersion", currentVersion)
+		errreport.Error(ctx, "CRITICAL INCONSISTENCY: reverted content uploaded but metadata update failed", dbUpdateErr, "itemType", itemType, "itemID", targetLog.ItemID, "s3Path", currentS3Path, "expectedVersion", currentVersion)
+		s.abortWrite(ctx, intent)
 		// Don't return version conflict here, as it's a revert operation failure
 		return 0, ErrInconsistentState
 	}
 
-	// 7. Invalidate Caches
-	_ = s.cache.DeleteItemMeta(ctx, targetLog.ItemID, itemType)
-	_ = s.cache.InvalidateItemContent(ctx, targetLog.ItemID, itemType)
-	// Cache the reverted content
-	_ = s.cache.SetItemContent(ctx, targetLog.ItemID, itemType, expectedNewVersion, revertContent, itemContentCacheDuration)
-
-	// 8. Log the Revert Action
-	revertLog := &models.HistoryLog{
-		UserID: userID, ItemID: targetLog.ItemID, ItemType: targetLog.ItemType,
-		Action:          models.ActionRevert,
-		Timestamp:       now,
-		S3PathAfter:     currentS3Path, // Path *after* the revert action
-		ItemVersion:     expectedNewVersion,
-		RevertedToLogID: pointer.To(targetLogID), // Link to the target log entry
-	}
-	_, logErr := s.db.LogAction(ctx, revertLog)
-	if logErr != nil {
-		log.Printf("WARNING: Failed to log revert action for %s %s: %v", targetLog.ItemID, itemType, logErr)
-	}
-
-	// Reset change counter after revert
-	s.counterMutex.Lock()
-	delete(s.changeCounters, fmt.Sprintf("%s:%s", itemType, targetLog.ItemID))
-	s.counterMutex.Unlock()
+	// 7. Caches, History (Revert), change counter and search
+	s.finishWrite(ctx, intent, ownerUserID, oldSize, revertContent, contentType, now)
 
 	return expectedNewVersion, nil
 }
 
 // --- Helper Functions ---
-// applyChanges, generateS3Path, mapDBError, getItemVersion remain similar
+// generateS3Path, mapDBError, getItemVersion remain similar
 // generateSlug, TitleCase remain the same
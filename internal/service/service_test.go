@@ -0,0 +1,66 @@
+// internal/service/service_test.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/database/memory"
+	"github.com/kkuzar/blog_system/internal/models"
+	"testing"
+	"time"
+)
+
+func TestListUserItemsHideArchivedByDefault(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	s := &Service{db: db}
+	archivedAt := time.Now().UTC()
+
+	livePost, archivedPost := &models.Post{UserID: "u1", Slug: "live"}, &models.Post{UserID: "u1", Slug: "archived"}
+	for _, post := range []*models.Post{livePost, archivedPost} {
+		if _, err := db.CreatePostMeta(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetPostArchivedAt(ctx, archivedPost.ID, &archivedAt); err != nil {
+		t.Fatal(err)
+	}
+	liveFile, archivedFile := &models.CodeFile{UserID: "u1", Path: "live.go"}, &models.CodeFile{UserID: "u1", Path: "archived.go"}
+	for _, file := range []*models.CodeFile{liveFile, archivedFile} {
+		if _, err := db.CreateCodeFileMeta(ctx, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetCodeFileArchivedAt(ctx, archivedFile.ID, &archivedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, includeArchived := range []bool{false, true} {
+		want := map[string]bool{livePost.ID: true, liveFile.ID: true}
+		if includeArchived {
+			want[archivedPost.ID], want[archivedFile.ID] = true, true
+		}
+		got := map[string]bool{}
+		posts, err := s.ListUserPosts(ctx, "u1", 10, 0, includeArchived)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range posts {
+			got[post.ID] = true
+		}
+		files, err := s.ListUserCodeFiles(ctx, "u1", 10, 0, includeArchived)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			got[file.ID] = true
+		}
+		if len(got) != len(want) {
+			t.Fatalf("includeArchived=%v: got %d items, want %d", includeArchived, len(got), len(want))
+		}
+		for id := range want {
+			if !got[id] {
+				t.Fatalf("includeArchived=%v: item %s missing", includeArchived, id)
+			}
+		}
+	}
+}
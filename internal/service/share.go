@@ -0,0 +1,206 @@
+// internal/service/share.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrInvalidShareToken  = apperr.New(apperr.Unauthenticated, "share link is invalid or has expired")
+	ErrInvalidShareAccess = apperr.New(apperr.Validation, "share access must be \"read\"")
+	ErrShareLinkNotFound  = apperr.New(apperr.NotFound, "share link not found")
+)
+
+// sharedItemPathPrefix is the public API path that serves shared items.
+const sharedItemPathPrefix = "/api/v1/shared/"
+
+// CreateShareLink creates a signed link giving anyone who has it read access to an item.
+// ttl <= 0 creates a link that never expires. Only the owner can share an item; links
+// stop working once they are revoked, or the item is deleted or changes owner.
+func (s *Service) CreateShareLink(ctx context.Context, userID, itemID, itemTypeStr, access string, ttl time.Duration) (*models.ShareLink, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	if access == "" {
+		access = models.ShareAccessRead
+	}
+	if access != models.ShareAccessRead {
+		return nil, ErrInvalidShareAccess
+	}
+
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if meta.GetUserID() != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = s.now().Add(ttl).UTC()
+	}
+	token, linkID, err := auth.GenerateShareToken(userID, itemID, itemTypeStr, access, tenant.ID(ctx), expiresAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error generating share token", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to create share link")
+	}
+
+	link := &models.ShareLink{
+		LinkID: linkID, UserID: userID, ItemID: itemID, ItemType: itemTypeStr,
+		Access: access, CreatedAt: s.now().UTC(),
+	}
+	if !expiresAt.IsZero() {
+		link.ExpiresAt = &expiresAt
+	}
+	if err := s.db.CreateShareLink(ctx, link); err != nil {
+		slog.ErrorContext(ctx, "Error saving share link", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to create share link")
+	}
+	link.Token, link.URL = token, sharedItemPathPrefix+token
+	return link, nil
+}
+
+// ListShareLinks returns the links userID created for an item that haven't been
+// revoked, oldest first, without their tokens. Expired links are left out.
+func (s *Service) ListShareLinks(ctx context.Context, userID, itemID, itemTypeStr string) ([]models.ShareLink, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if meta.GetUserID() != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	all, err := s.db.ListShareLinksByUser(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing share links", "userID", userID, "error", err)
+		return nil, errors.New("failed to list share links")
+	}
+	now := s.now()
+	links := make([]models.ShareLink, 0, len(all))
+	for _, link := range all {
+		if link.ItemID == itemID && link.ItemType == itemTypeStr && (link.ExpiresAt == nil || link.ExpiresAt.After(now)) {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// RevokeShareLink makes a share link of an item stop working: it no longer opens the
+// item or subscribes to it. The caller ends the WebSocket subscriptions made through it
+// earlier (see websocket.Hub.DropShareLink). Only the owner can revoke links.
+func (s *Service) RevokeShareLink(ctx context.Context, userID, itemID, itemTypeStr, linkID string) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	if meta.GetUserID() != userID {
+		return ErrPermissionDenied
+	}
+
+	link, err := s.db.GetShareLink(ctx, linkID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && (link.ItemID != itemID || link.ItemType != itemTypeStr)) {
+		return ErrShareLinkNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error fetching share link", "linkID", linkID, "error", err)
+		return errors.New("failed to revoke share link")
+	}
+	if err := s.db.DeleteShareLink(ctx, linkID); err != nil {
+		slog.ErrorContext(ctx, "Error deleting share link", "linkID", linkID, "error", err)
+		return errors.New("failed to revoke share link")
+	}
+	return nil
+}
+
+// ResolveShareToken validates a share token and checks that the link hasn't been revoked
+// and that the item still exists and is still owned by the user who shared it.
+func (s *Service) ResolveShareToken(ctx context.Context, token string) (*auth.ShareClaims, error) {
+	claims, err := auth.ValidateShareToken(token)
+	if err != nil || claims.TenantID != tenant.ID(ctx) {
+		return nil, ErrInvalidShareToken
+	}
+	itemType := models.ItemType(claims.ItemType)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidShareToken
+	}
+	link, err := s.db.GetShareLink(ctx, claims.LinkID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrInvalidShareToken // Revoked
+		}
+		slog.ErrorContext(ctx, "Error fetching share link", "linkID", claims.LinkID, "error", err)
+		return nil, errors.New("failed to check share link")
+	}
+	if link.ItemID != claims.ItemID || link.ItemType != claims.ItemType {
+		return nil, ErrInvalidShareToken
+	}
+	meta, err := s.getItemMetaWithCache(ctx, claims.ItemID, itemType)
+	if err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			return nil, ErrInvalidShareToken
+		}
+		return nil, err
+	}
+	if meta.GetUserID() != claims.IssuedBy {
+		return nil, ErrInvalidShareToken // Ownership changed since the link was created
+	}
+	return claims, nil
+}
+
+// GetSharedItem returns the current content of the item a share link points to and counts
+// the view. viewerKey identifies the (anonymous) viewer for view deduplication.
+func (s *Service) GetSharedItem(ctx context.Context, token, viewerKey string) (*models.SharedItemPayload, error) {
+	claims, err := s.ResolveShareToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read on behalf of the owner; ResolveShareToken verified they still own the item
+	content, version, err := s.GetItemContent(ctx, claims.IssuedBy, claims.ItemID, claims.ItemType)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.getItemMetaWithCache(ctx, claims.ItemID, models.ItemType(claims.ItemType))
+	if err != nil {
+		return nil, err
+	}
+	var name, excerpt, coverImageURL string
+	switch m := meta.(type) {
+	case *models.Post:
+		name, excerpt = m.Title, m.Excerpt
+		if excerpt == "" {
+			excerpt = generateExcerpt(content) // Never published
+		}
+		if m.CoverImage != "" {
+			coverImageURL = sharedItemPathPrefix + token + sharedCoverPathSuffix
+		}
+	case *models.CodeFile:
+		name = codeFilePath(m)
+	}
+	s.recordView(ctx, claims.ItemID, models.ItemType(claims.ItemType), viewerKey)
+
+	return &models.SharedItemPayload{
+		ItemID: claims.ItemID, ItemType: claims.ItemType, Name: name,
+		Content: content, Version: version, Access: claims.Access, ExpiresAt: claims.ExpiresAt,
+		Excerpt: excerpt, CoverImageURL: coverImageURL,
+	}, nil
+}
@@ -0,0 +1,49 @@
+// internal/service/shutdown.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"sync"
+)
+
+var ErrShuttingDown = apperr.New(apperr.Unavailable, "server is shutting down")
+
+// writeTracker counts the content writes in progress so shutdown can wait for them.
+type writeTracker struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+}
+
+// startWrite registers a write, or returns false once draining has begun. Call the
+// returned func when the write is done.
+func (t *writeTracker) startWrite() (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, false
+	}
+	t.inFlight.Add(1)
+	return t.inFlight.Done, true
+}
+
+// DrainWrites makes new content changes fail with ErrShuttingDown and waits for the ones
+// in progress to finish, or for ctx to be done.
+func (s *Service) DrainWrites(ctx context.Context) error {
+	s.writes.mu.Lock()
+	s.writes.draining = true
+	s.writes.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.writes.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
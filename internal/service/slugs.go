@@ -0,0 +1,226 @@
+// internal/service/slugs.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrInvalidSlug = apperr.New(apperr.Validation, "slug must be 1-100 lowercase letters, digits or single hyphens")
+	ErrSlugTaken   = apperr.New(apperr.Conflict, "slug is already used by another of your posts")
+)
+
+const (
+	maxSlugLength = 100
+	// maxSlugAttempts bounds how many numbered variants of a generated slug are tried.
+	maxSlugAttempts = 20
+)
+
+// validateSlug checks slug is URL-safe: lowercase ASCII letters and digits, separated by
+// single hyphens, with no leading or trailing hyphen.
+func validateSlug(slug string) error {
+	if slug == "" || len(slug) > maxSlugLength || slug[0] == '-' || slug[len(slug)-1] == '-' {
+		return ErrInvalidSlug
+	}
+	for i := 0; i < len(slug); i++ {
+		c := slug[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-' && slug[i-1] != '-':
+		default:
+			return ErrInvalidSlug
+		}
+	}
+	return nil
+}
+
+// normalizeSlug trims and lowercases a user-supplied slug and validates it.
+func normalizeSlug(slug string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if err := validateSlug(slug); err != nil {
+		return "", err
+	}
+	return slug, nil
+}
+
+// sanitizeSlug turns arbitrary text into a valid slug, or "" if nothing usable is left.
+func sanitizeSlug(text string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	return strings.TrimRight(slug, "-")
+}
+
+// newPostSlug returns the slug for a new post: the requested one if given, otherwise one
+// generated from the title. generated reports whether it may be varied on a collision.
+func newPostSlug(title, requested string) (slug string, generated bool, err error) {
+	if requested != "" {
+		slug, err = normalizeSlug(requested)
+		return slug, false, err
+	}
+	if slug = sanitizeSlug(title); slug == "" {
+		slug = string(models.ItemTypePost)
+	}
+	return slug, true, nil
+}
+
+// numberedSlug returns the nth variant of a generated slug, e.g. "my-post-2".
+func numberedSlug(base string, n int) string {
+	suffix := fmt.Sprintf("-%d", n)
+	if len(base)+len(suffix) > maxSlugLength {
+		base = strings.TrimRight(base[:maxSlugLength-len(suffix)], "-")
+	}
+	return base + suffix
+}
+
+// createPostMeta stores a new post. A generated slug that is taken is retried with a
+// numeric suffix; an explicitly requested one fails with ErrSlugTaken.
+func (s *Service) createPostMeta(ctx context.Context, post *models.Post, generatedSlug bool) (string, error) {
+	base := post.Slug
+	for attempt := 1; ; attempt++ {
+		postID, err := s.db.CreatePostMeta(ctx, post)
+		if !errors.Is(err, database.ErrDuplicateSlug) {
+			return postID, err
+		}
+		if !generatedSlug || attempt >= maxSlugAttempts {
+			return "", ErrSlugTaken
+		}
+		post.Slug = numberedSlug(base, attempt+1)
+	}
+}
+
+// SetPostSlug changes the slug of a post. The slug must be unique among the owner's
+// posts; the change is recorded in the post's history.
+func (s *Service) SetPostSlug(ctx context.Context, userID, postID, slug string) (*models.Post, error) {
+	slug, err := normalizeSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Get Metadata (checks existence and access)
+	cached, err := getItemMetaAs[*models.Post](ctx, s, postID)
+	if err != nil {
+		return nil, err
+	}
+	post := *cached // Copy; the cached value must not be modified
+	if err := s.authorizeItem(ctx, userID, post.UserID, postID, models.ItemTypePost, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	oldSlug := post.Slug
+	if oldSlug == slug {
+		return &post, nil // Nothing to do
+	}
+
+	// 2. Update Metadata (the database enforces uniqueness)
+	if err := s.db.SetPostSlug(ctx, postID, slug); err != nil {
+		if errors.Is(err, database.ErrDuplicateSlug) {
+			return nil, ErrSlugTaken
+		}
+		slog.ErrorContext(ctx, "Error setting slug of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	post.Slug, post.UpdatedAt = slug, s.now().UTC()
+
+	// 3. Log Action History
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: postID, ItemType: string(models.ItemTypePost),
+		Action: models.ActionSlug, Timestamp: post.UpdatedAt, ItemVersion: post.Version,
+		SlugBefore: oldSlug, SlugAfter: slug,
+	}
+	s.logAction(ctx, historyLog)
+
+	// 4. Redirect the old slug, so links to it keep working; the new one is live again
+	if oldSlug != "" {
+		redirect := &models.SlugRedirect{UserID: post.UserID, Slug: oldSlug, PostID: postID}
+		if err := s.db.PutSlugRedirect(ctx, redirect); err != nil {
+			slog.WarnContext(ctx, "Failed to record redirect of old slug of post", "slug", oldSlug, "postID", postID, "error", err)
+		}
+	}
+	if err := s.db.DeleteSlugRedirect(ctx, post.UserID, slug); err != nil {
+		slog.WarnContext(ctx, "Failed to delete redirect of new slug of post", "slug", slug, "postID", postID, "error", err)
+	}
+
+	// 5. Invalidate Cache
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	return &post, nil
+}
+
+// GetPublicPost returns the published content of the post userID has at slug, without
+// its front-matter block if stripFrontMatter is set. No access is required: publishing
+// makes a post public. If slug is a former slug of a post, the post is nil and movedTo is
+// its current slug, for the caller to redirect to.
+//
+// A redirect always leads to the post's current slug, never to another redirect, and
+// only to a slug other than the one asked for, so following it can't loop.
+func (s *Service) GetPublicPost(ctx context.Context, userID, slug string, stripFrontMatter bool) (published *models.PublishedPost, movedTo string, err error) {
+	post, movedTo, err := s.publicPost(ctx, userID, slug)
+	if err != nil || movedTo != "" {
+		return nil, movedTo, err
+	}
+	published, err = s.publishedPost(ctx, post, stripFrontMatter)
+	return published, "", err
+}
+
+// publicPost resolves slug to userID's published post, or to the current slug of the post
+// it is a former slug of, as GetPublicPost.
+func (s *Service) publicPost(ctx context.Context, userID, slug string) (*models.Post, string, error) {
+	if validateSlug(slug) != nil {
+		return nil, "", ErrItemNotFound
+	}
+	found, err := s.db.GetPostMetaBySlug(ctx, userID, slug)
+	if err == nil {
+		post, err := getItemMetaAs[*models.Post](ctx, s, found.ID) // Skips trashed posts
+		if err != nil {
+			return nil, "", err
+		}
+		if post.PublishedVersion == 0 || post.UserID != userID || post.Slug != slug {
+			return nil, "", ErrItemNotFound
+		}
+		return post, "", nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		slog.ErrorContext(ctx, "Error getting post by slug", "userID", userID, "slug", slug, "error", err)
+		return nil, "", errors.New("failed to get post")
+	}
+
+	redirect, err := s.db.GetSlugRedirect(ctx, userID, slug)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, "", ErrItemNotFound
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting slug redirect", "userID", userID, "slug", slug, "error", err)
+		return nil, "", errors.New("failed to get post")
+	}
+	post, err := getItemMetaAs[*models.Post](ctx, s, redirect.PostID)
+	if err != nil {
+		return nil, "", err // Including a post deleted since
+	}
+	if post.PublishedVersion == 0 || post.UserID != userID || post.Slug == "" || post.Slug == slug {
+		return nil, "", ErrItemNotFound // Unpublished, transferred, or the redirect is stale
+	}
+	return nil, post.Slug, nil
+}
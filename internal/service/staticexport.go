@@ -0,0 +1,251 @@
+// internal/service/staticexport.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/jobs"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// StaticSiteBuilder writes userID's blog to w as a zip archive of a static site, as
+// described by opts (see site.Export).
+type StaticSiteBuilder func(ctx context.Context, userID string, opts models.StaticSiteOptions, w io.Writer) error
+
+// A static site export is built by a job, like a data export, and kept in storage next
+// to a status object until Config.DataExport.Retention passes. Each user has one at a
+// time; asking for other options replaces it.
+var (
+	ErrStaticSiteNotReady    = apperr.New(apperr.NotFound, "static site export is not ready")
+	ErrStaticSiteUnavailable = apperr.New(apperr.Unavailable, "static site exports are unavailable without the job queue")
+)
+
+// staticSiteJob is the payload of the static site export jobs. RequestedAt tells a job
+// whether its export has been superseded.
+type staticSiteJob struct {
+	UserID      string    `json:"userId"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// staticSitePath returns the storage key of a user's static site archive.
+func staticSitePath(userID string) string {
+	return fmt.Sprintf("static-exports/%s/site.zip", userID)
+}
+
+// staticSiteStatusPath returns the storage key of a user's static site export status.
+func staticSiteStatusPath(userID string) string {
+	return fmt.Sprintf("static-exports/%s/status.json", userID)
+}
+
+// UseStaticSiteBuilder sets how static site exports are rendered. Without one, requests
+// for them return ErrStaticSiteUnavailable.
+func (s *Service) UseStaticSiteBuilder(build StaticSiteBuilder) {
+	s.siteBuilder = build
+}
+
+// GetStaticSite returns the state of userID's static site export with opts, requesting
+// one first unless there is one pending or ready to download.
+func (s *Service) GetStaticSite(ctx context.Context, userID string, opts models.StaticSiteOptions) (*models.StaticSiteExport, error) {
+	export, err := s.staticSiteStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	switch {
+	case export == nil, export.StaticSiteOptions != opts, export.Status == models.DataExportFailed:
+	case export.Status == models.DataExportReady && export.ExpiresAt != nil && now.After(*export.ExpiresAt):
+	case export.Status == models.DataExportPending && now.Sub(export.RequestedAt) > dataExportStaleAfter:
+	default:
+		return export, nil
+	}
+	return s.RequestStaticSite(ctx, userID, opts, false)
+}
+
+// RequestStaticSite queues a new static site export of userID's blog with opts,
+// replacing the previous one, and with save, stores it as one of their assets once
+// built. An export with the same options already pending is returned as it is.
+func (s *Service) RequestStaticSite(ctx context.Context, userID string, opts models.StaticSiteOptions, save bool) (*models.StaticSiteExport, error) {
+	if s.jobs == nil || s.siteBuilder == nil {
+		return nil, ErrStaticSiteUnavailable
+	}
+	current, err := s.staticSiteStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Status == models.DataExportPending && current.StaticSiteOptions == opts &&
+		current.Save == save && s.now().Sub(current.RequestedAt) <= dataExportStaleAfter {
+		return current, nil
+	}
+
+	export := &models.StaticSiteExport{StaticSiteOptions: opts, Status: models.DataExportPending, Save: save, RequestedAt: s.now().UTC()}
+	if err := s.saveStaticSiteStatus(ctx, userID, export); err != nil {
+		return nil, err
+	}
+	payload := staticSiteJob{UserID: userID, RequestedAt: export.RequestedAt}
+	jobID := fmt.Sprintf("static-export:%s:%d", userID, export.RequestedAt.UnixNano())
+	if err := s.enqueueJob(ctx, jobBuildStaticSite, payload, jobs.WithID(jobID)); err != nil {
+		slog.ErrorContext(ctx, "Error queueing static site export", "userID", userID, "error", err)
+		return nil, errors.New("failed to request static site export")
+	}
+	slog.InfoContext(ctx, "Static site export requested", "userID", userID, "format", opts.Format)
+	return export, nil
+}
+
+// OpenStaticSite returns userID's static site archive for download, or
+// ErrStaticSiteNotReady if none with opts has been built (or it expired). The caller
+// closes the reader.
+func (s *Service) OpenStaticSite(ctx context.Context, userID string, opts models.StaticSiteOptions) (io.ReadCloser, *models.StaticSiteExport, error) {
+	export, err := s.staticSiteStatus(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export == nil || export.StaticSiteOptions != opts || export.Status != models.DataExportReady || s.now().After(*export.ExpiresAt) {
+		return nil, nil, ErrStaticSiteNotReady
+	}
+	reader, err := s.storage.DownloadFile(ctx, staticSitePath(userID))
+	if errors.Is(err, storage.ErrFileNotFound) {
+		return nil, nil, ErrStaticSiteNotReady
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error opening static site export", "userID", userID, "error", err)
+		return nil, nil, errors.New("failed to retrieve static site export")
+	}
+	return reader, export, nil
+}
+
+// staticSiteStatus loads the status of userID's static site export, nil if there is none.
+func (s *Service) staticSiteStatus(ctx context.Context, userID string) (*models.StaticSiteExport, error) {
+	data, err := s.downloadContent(ctx, staticSiteStatusPath(userID))
+	if errors.Is(err, storage.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading static site export status", "userID", userID, "error", err)
+		return nil, errors.New("failed to load static site export")
+	}
+	var export models.StaticSiteExport
+	if err := json.Unmarshal([]byte(data), &export); err != nil {
+		slog.ErrorContext(ctx, "Invalid static site export status", "userID", userID, "error", err)
+		return nil, nil // Start over
+	}
+	return &export, nil
+}
+
+func (s *Service) saveStaticSiteStatus(ctx context.Context, userID string, export *models.StaticSiteExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode static site export status: %w", err)
+	}
+	if err := s.storage.UploadFile(ctx, staticSiteStatusPath(userID), bytes.NewReader(data), "application/json"); err != nil {
+		slog.ErrorContext(ctx, "Error saving static site export status", "userID", userID, "error", err)
+		return errors.New("failed to save static site export")
+	}
+	return nil
+}
+
+// runBuildStaticSiteJob builds a user's static site archive, unless a later request
+// superseded it, saves it as an asset if asked to, and schedules its deletion. Once out
+// of attempts the export is marked failed, so the next request starts over.
+func (s *Service) runBuildStaticSiteJob(ctx context.Context, job *jobs.Job) error {
+	var payload staticSiteJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	if s.siteBuilder == nil {
+		return errors.New("no static site builder configured")
+	}
+	export, err := s.staticSiteStatus(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if export == nil || !export.RequestedAt.Equal(payload.RequestedAt) {
+		return nil // Superseded
+	}
+
+	fail := func(err error) error {
+		if job.Attempts >= job.MaxAttempts {
+			slog.ErrorContext(ctx, "Static site export failed", "userID", payload.UserID, "error", err)
+			export.Status = models.DataExportFailed
+			_ = s.saveStaticSiteStatus(ctx, payload.UserID, export)
+			_ = s.storage.DeleteFile(ctx, staticSitePath(payload.UserID)) // Of an earlier export
+		}
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	go func() {
+		pw.CloseWithError(s.siteBuilder(ctx, payload.UserID, export.StaticSiteOptions, counter))
+	}()
+	err = s.storage.UploadFile(ctx, staticSitePath(payload.UserID), pr, "application/zip")
+	pr.CloseWithError(err) // Stops the builder if the upload gave up first
+	if err != nil {
+		return fail(fmt.Errorf("failed to store static site export: %w", err))
+	}
+
+	if export.Save && export.AssetID == "" {
+		asset, err := s.saveStaticSiteAsset(ctx, payload.UserID, export)
+		switch code := apperr.CodeOf(err); {
+		case err == nil:
+			export.AssetID = asset.ID
+		case code == apperr.TooLarge || code == apperr.Validation:
+			export.Error = "not saved as an asset: " + apperr.Message(err) // Still downloadable
+		default:
+			return fail(err)
+		}
+	}
+
+	now := s.now().UTC()
+	expiresAt := now.Add(s.cfg.DataExport.Retention)
+	export.Status, export.CompletedAt, export.ExpiresAt, export.SizeBytes = models.DataExportReady, &now, &expiresAt, counter.n
+	if err := s.saveStaticSiteStatus(ctx, payload.UserID, export); err != nil {
+		return err
+	}
+	if err := s.enqueueJob(ctx, jobExpireStaticSite, payload, jobs.WithDelay(s.cfg.DataExport.Retention)); err != nil {
+		slog.WarnContext(ctx, "Failed to schedule deletion of static site export", "userID", payload.UserID, "error", err)
+	}
+	slog.InfoContext(ctx, "Static site export built", "userID", payload.UserID, "format", export.Format, "bytes", counter.n)
+	return nil
+}
+
+// saveStaticSiteAsset stores a copy of the built archive as one of userID's assets, at
+// exports/<format>-site-<time>.zip. It counts towards their storage quota.
+func (s *Service) saveStaticSiteAsset(ctx context.Context, userID string, export *models.StaticSiteExport) (*models.Asset, error) {
+	archive, err := s.downloadContent(ctx, staticSitePath(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static site export: %w", err)
+	}
+	filePath := "exports/" + export.Format + "-site-" + export.RequestedAt.UTC().Format("20060102T150405Z") + ".zip"
+	return s.UploadAsset(ctx, userID, filePath, "", "application/zip", []byte(archive))
+}
+
+// runExpireStaticSiteJob deletes a user's static site archive and status once they
+// expire, unless a later request replaced them.
+func (s *Service) runExpireStaticSiteJob(ctx context.Context, job *jobs.Job) error {
+	var payload staticSiteJob
+	if err := job.Decode(&payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	current, err := s.staticSiteStatus(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if current == nil || !current.RequestedAt.Equal(payload.RequestedAt) {
+		return nil
+	}
+	if err := s.storage.DeleteFile(ctx, staticSitePath(payload.UserID)); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return err
+	}
+	if err := s.storage.DeleteFile(ctx, staticSiteStatusPath(payload.UserID)); err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// internal/service/stats.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	statsDayFormat = "2006-01-02"
+	// viewDedupWindow is how long repeat views by the same viewer aren't counted again.
+	viewDedupWindow  = 24 * time.Hour
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+	// statsFlushTimeout bounds the final flush when the flusher stops.
+	statsFlushTimeout = 10 * time.Second
+)
+
+// statsKey identifies one item's counts for one day.
+type statsKey struct {
+	tenantID string
+	itemID   string
+	itemType models.ItemType
+	day      string
+}
+
+type statsDelta struct {
+	views, edits int64
+}
+
+// statsRecorder buffers view and edit counts in memory so a busy item costs one database
+// write per flush instead of one per view or edit.
+type statsRecorder struct {
+	mu      sync.Mutex
+	pending map[statsKey]*statsDelta
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{pending: make(map[statsKey]*statsDelta)}
+}
+
+func (r *statsRecorder) add(key statsKey, views, edits int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delta, ok := r.pending[key]
+	if !ok {
+		delta = &statsDelta{}
+		r.pending[key] = delta
+	}
+	delta.views += views
+	delta.edits += edits
+}
+
+// take returns the pending counts and starts a new batch.
+func (r *statsRecorder) take() map[statsKey]*statsDelta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.pending
+	r.pending = make(map[statsKey]*statsDelta)
+	return pending
+}
+
+// recordView counts a public view of an item. viewerKey identifies the viewer (e.g. a
+// user ID or a hash of their address); each viewer counts once per item per day.
+func (s *Service) recordView(ctx context.Context, itemID string, itemType models.ItemType, viewerKey string) {
+	day := s.now().UTC().Format(statsDayFormat)
+	first, err := s.viewDedup.FirstSeen(ctx, "view:"+string(itemType)+":"+itemID+":"+day+":"+viewerKey, viewDedupWindow)
+	if err != nil {
+		slog.WarnContext(ctx, "View deduplication failed, counting the view", "itemType", itemType, "itemID", itemID, "error", err)
+	} else if !first {
+		return
+	}
+	s.stats.add(statsKey{tenantID: tenant.ID(ctx), itemID: itemID, itemType: itemType, day: day}, 1, 0)
+}
+
+// RecordPublicView counts a view of a post's public page by the viewer viewerKey
+// identifies, once per day like other views.
+func (s *Service) RecordPublicView(ctx context.Context, postID, viewerKey string) {
+	s.recordView(ctx, postID, models.ItemTypePost, viewerKey)
+}
+
+// recordEdit counts a new version of an item's content.
+func (s *Service) recordEdit(ctx context.Context, itemID string, itemType models.ItemType) {
+	day := s.now().UTC().Format(statsDayFormat)
+	s.stats.add(statsKey{tenantID: tenant.ID(ctx), itemID: itemID, itemType: itemType, day: day}, 0, 1)
+}
+
+// FlushStats writes the buffered counts to the database. Counts that fail to write are
+// kept for the next flush.
+func (s *Service) FlushStats(ctx context.Context) error {
+	var firstErr error
+	for key, delta := range s.stats.take() {
+		keyCtx := ctx
+		if key.tenantID != "" {
+			keyCtx = tenant.WithID(ctx, key.tenantID)
+		}
+		err := s.db.IncrementItemStats(keyCtx, key.itemID, string(key.itemType), key.day, delta.views, delta.edits)
+		if err != nil {
+			s.stats.add(key, delta.views, delta.edits)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// RunStatsFlusher calls FlushStats and FlushUsage every interval until ctx is cancelled,
+// then flushes once more so buffered counts aren't lost on shutdown.
+func (s *Service) RunStatsFlusher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), statsFlushTimeout)
+			if err := s.FlushStats(flushCtx); err != nil {
+				slog.ErrorContext(ctx, "Error flushing item stats on shutdown", "error", err)
+			}
+			if err := s.FlushUsage(flushCtx); err != nil {
+				slog.ErrorContext(ctx, "Error flushing API usage on shutdown", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := s.FlushStats(ctx); err != nil {
+				slog.ErrorContext(ctx, "Error flushing item stats", "error", err)
+			}
+			if err := s.FlushUsage(ctx); err != nil {
+				slog.ErrorContext(ctx, "Error flushing API usage", "error", err)
+			}
+		}
+	}
+}
+
+// GetItemStats returns an item's daily views and edits for the last `days` days
+// (including today). Requires editor access.
+func (s *Service) GetItemStats(ctx context.Context, userID, itemID, itemTypeStr string, days int) (*models.ItemStats, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	if days <= 0 {
+		days = defaultStatsDays
+	}
+	days = min(days, maxStatsDays)
+
+	// 1. Get Metadata (checks existence and access)
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	// 2. Load the stored days and fill in the ones without activity
+	today := s.now().UTC()
+	first := today.AddDate(0, 0, -(days - 1))
+	stats := &models.ItemStats{
+		ItemID: itemID, ItemType: itemTypeStr,
+		From: first.Format(statsDayFormat), To: today.Format(statsDayFormat),
+		Days: make([]models.ItemStatsDay, 0, days),
+	}
+	stored, err := s.db.ListItemStats(ctx, itemID, itemTypeStr, stats.From, stats.To)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading stats", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to load item statistics")
+	}
+	byDay := make(map[string]models.ItemStatsDay, len(stored))
+	for _, day := range stored {
+		byDay[day.Day] = day
+	}
+	for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+		key := d.Format(statsDayFormat)
+		day, ok := byDay[key]
+		if !ok {
+			day = models.ItemStatsDay{Day: key}
+		}
+		stats.TotalViews += day.Views
+		stats.TotalEdits += day.Edits
+		stats.Days = append(stats.Days, day)
+	}
+
+	// 3. Bookmarks are counted as they stand, not per day
+	if itemType == models.ItemTypePost {
+		if stats.Bookmarks, err = s.db.CountPostBookmarks(ctx, itemID); err != nil {
+			slog.ErrorContext(ctx, "Error counting bookmarks of post", "itemID", itemID, "error", err)
+			return nil, errors.New("failed to load item statistics")
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,241 @@
+// internal/service/tags.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxTagNameLength = 64
+
+var (
+	ErrInvalidTagName = apperr.New(apperr.Validation, "tag name must be 1-64 characters without '/' or control characters")
+	ErrTagNotFound    = apperr.New(apperr.NotFound, "tag not found")
+	ErrTagExists      = apperr.New(apperr.Conflict, "item already has a tag with this name")
+)
+
+// normalizeTagName trims name and checks it is usable as a tag name. Names end up in
+// URL paths and document IDs, hence no slashes.
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTagNameLength || strings.ContainsRune(name, '/') {
+		return "", ErrInvalidTagName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", ErrInvalidTagName
+		}
+	}
+	return name, nil
+}
+
+// TagVersion names a version of an item. The tag points at the version of logID if it
+// is given, else at version, else (version 0) at the current version. Tags reference a
+// create, snapshot or revert entry, which history compaction keeps; a version only
+// patches produced is snapshotted first so the tag stays revertible. Requires editor
+// access.
+func (s *Service) TagVersion(ctx context.Context, userID, itemID, itemTypeStr, name string, version int, logID string) (*models.VersionTag, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	name, err := normalizeTagName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleEditor); err != nil {
+		return nil, err
+	}
+	currentVersion := meta.GetVersion()
+
+	// 1. Resolve the version
+	if logID != "" {
+		entry, err := s.db.GetHistoryLogByID(ctx, logID)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				return nil, ErrHistoryLogNotFound
+			}
+			slog.ErrorContext(ctx, "Error fetching history log for tagging", "logID", logID, "error", err)
+			return nil, errors.New("failed to retrieve history entry")
+		}
+		if entry.ItemID != itemID || entry.ItemType != itemTypeStr || entry.ItemVersion < 1 {
+			return nil, ErrHistoryLogNotFound // Not an entry that produced a version of this item
+		}
+		version = entry.ItemVersion
+	} else if version == 0 {
+		version = currentVersion
+	}
+	if version < 1 || version > currentVersion {
+		return nil, ErrVersionNotFound
+	}
+
+	// 2. Find (or make) an entry for it that compaction won't remove
+	anchor, err := s.versionAnchor(ctx, userID, meta.GetUserID(), itemID, itemType, version, name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := &models.VersionTag{
+		ItemID: itemID, ItemType: itemTypeStr, Name: name,
+		Version: version, LogID: anchor.ID, UserID: userID,
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.db.CreateVersionTag(ctx, tag); err != nil {
+		if errors.Is(err, database.ErrDuplicateTag) {
+			return nil, ErrTagExists
+		}
+		slog.ErrorContext(ctx, "Error creating tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to create tag")
+	}
+	return tag, nil
+}
+
+// versionAnchor returns the newest create, snapshot or revert entry that produced
+// version, snapshotting the version (labelled with label, charged to ownerUserID) if
+// there is none.
+func (s *Service) versionAnchor(ctx context.Context, userID, ownerUserID, itemID string, itemType models.ItemType, version int, label string) (*models.HistoryLog, error) {
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading history for tagging", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to retrieve item history")
+	}
+	for i := range history {
+		entry := &history[i]
+		if entry.ItemVersion != version {
+			continue
+		}
+		switch entry.Action {
+		case models.ActionCreate, models.ActionSnapshot, models.ActionRevert:
+			return entry, nil
+		}
+	}
+
+	snapshotPath, err := s.storeSnapshot(ctx, ownerUserID, itemID, itemType, version)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error snapshotting for tagging", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+		if errors.Is(err, ErrVersionNotAvailable) {
+			return nil, err
+		}
+		return nil, errors.New("failed to store snapshot")
+	}
+	snapshotLog := &models.HistoryLog{
+		UserID: userID, ItemID: itemID, ItemType: string(itemType),
+		Action:      models.ActionSnapshot,
+		Timestamp:   s.now().UTC(),
+		S3PathAfter: snapshotPath,
+		ItemVersion: version,
+		Label:       label,
+	}
+	if _, err := s.db.LogAction(ctx, snapshotLog); err != nil {
+		slog.ErrorContext(ctx, "Error logging snapshot for tagging", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+		return nil, errors.New("failed to record snapshot")
+	}
+	return snapshotLog, nil
+}
+
+// ListVersionTags returns an item's tags, newest version first. Requires viewer access.
+func (s *Service) ListVersionTags(ctx context.Context, userID, itemID, itemTypeStr string) ([]models.VersionTag, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.db.ListVersionTags(ctx, itemID, itemTypeStr)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing tags", "itemType", itemType, "itemID", itemID, "error", err)
+		return nil, errors.New("failed to list tags")
+	}
+	if tags == nil {
+		tags = []models.VersionTag{}
+	}
+	return tags, nil
+}
+
+// DeleteVersionTag removes a tag. The history entry it pointed at is kept. Requires
+// editor access.
+func (s *Service) DeleteVersionTag(ctx context.Context, userID, itemID, itemTypeStr, name string) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleEditor); err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteVersionTag(ctx, itemID, itemTypeStr, name); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrTagNotFound
+		}
+		slog.ErrorContext(ctx, "Error deleting tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return errors.New("failed to delete tag")
+	}
+	return nil
+}
+
+// RevertToTag reverts an item to the version a tag points at, like RevertToAction on
+// the tag's history entry, and returns the new version.
+func (s *Service) RevertToTag(ctx context.Context, userID, itemID, itemTypeStr, name string) (int, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return 0, ErrInvalidItemType
+	}
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return 0, err
+	}
+	// Checked here too so viewers can't probe tag names through the not-found error
+	if err := s.authorizeItem(ctx, userID, meta.GetUserID(), itemID, itemType, models.RoleEditor); err != nil {
+		return 0, err
+	}
+
+	tag, err := s.db.GetVersionTag(ctx, itemID, itemTypeStr, name)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return 0, ErrTagNotFound
+		}
+		slog.ErrorContext(ctx, "Error fetching tag", "tag", name, "itemType", itemType, "itemID", itemID, "error", err)
+		return 0, errors.New("failed to retrieve tag")
+	}
+	newVersion, err := s.RevertToAction(ctx, userID, tag.LogID)
+	if errors.Is(err, ErrHistoryLogNotFound) {
+		return 0, ErrVersionNotAvailable // The entry was removed from history
+	}
+	return newVersion, err
+}
+
+// deleteVersionTags removes all tags of an item, e.g. when it is purged.
+func (s *Service) deleteVersionTags(ctx context.Context, itemID string, itemType models.ItemType) {
+	tags, err := s.db.ListVersionTags(ctx, itemID, string(itemType))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to list tags for cleanup", "itemType", itemType, "itemID", itemID, "error", err)
+		return
+	}
+	for _, tag := range tags {
+		if err := s.db.DeleteVersionTag(ctx, itemID, string(itemType), tag.Name); err != nil && !errors.Is(err, database.ErrNotFound) {
+			slog.WarnContext(ctx, "Failed to delete tag", "tag", tag.Name, "itemType", itemType, "itemID", itemID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// internal/service/templates.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTemplateNameLength  = 100
+	maxTemplateContentSize = 64 << 10 // Templates are stored in the database, not in object storage
+)
+
+var (
+	ErrTemplateNotFound = apperr.New(apperr.NotFound, "template not found")
+	ErrInvalidTemplate  = apperr.New(apperr.Validation, "template needs a name of at most 100 characters, a valid item type and at most 64 KiB of content")
+)
+
+// newTemplate validates req and returns the template it describes. itemType is taken
+// from fixedType instead of req when set (updates can't change it).
+func newTemplate(req models.TemplateRequest, fixedType models.ItemType) (*models.Template, error) {
+	itemType := models.ItemType(req.ItemType)
+	if fixedType != "" {
+		itemType = fixedType
+	}
+	name := strings.TrimSpace(req.Name)
+	if !itemType.IsValid() || name == "" || utf8.RuneCountInString(name) > maxTemplateNameLength ||
+		len(req.Content) > maxTemplateContentSize {
+		return nil, ErrInvalidTemplate
+	}
+
+	template := &models.Template{Name: name, ItemType: string(itemType), Content: req.Content}
+	switch itemType {
+	case models.ItemTypePost:
+		template.Title = strings.TrimSpace(req.Title)
+	case models.ItemTypeCodeFile:
+		if req.FileName != "" {
+			filePath, err := normalizeCodePath(req.FileName)
+			if err != nil {
+				return nil, err
+			}
+			template.FileName = filePath
+		}
+		template.Language = strings.TrimSpace(req.Language)
+	}
+	return template, nil
+}
+
+// CreateTemplate saves a template owned by userID, or a system-wide one available to
+// every user if system is set. Only admins may create system-wide templates.
+func (s *Service) CreateTemplate(ctx context.Context, userID string, req models.TemplateRequest, system bool) (*models.Template, error) {
+	template, err := newTemplate(req, "")
+	if err != nil {
+		return nil, err
+	}
+	if system {
+		if !s.IsAdmin(userID) {
+			return nil, ErrPermissionDenied
+		}
+	} else {
+		template.UserID = userID
+	}
+
+	if _, err := s.db.CreateTemplate(ctx, template); err != nil {
+		slog.ErrorContext(ctx, "Error creating template for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to create template")
+	}
+	return template, nil
+}
+
+// GetTemplate returns one of the user's templates or a system-wide template.
+func (s *Service) GetTemplate(ctx context.Context, userID, templateID string) (*models.Template, error) {
+	template, err := s.db.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting template", "templateID", templateID, "error", err)
+		return nil, errors.New("failed to get template")
+	}
+	if template.UserID != "" && template.UserID != userID {
+		return nil, ErrTemplateNotFound // Other users' templates are private
+	}
+	return template, nil
+}
+
+// ListTemplates returns the user's templates followed by the system-wide ones, each
+// sorted by name. An empty itemTypeStr lists templates of both item types.
+func (s *Service) ListTemplates(ctx context.Context, userID, itemTypeStr string) ([]models.Template, error) {
+	if itemTypeStr != "" && !models.ItemType(itemTypeStr).IsValid() {
+		return nil, ErrInvalidItemType
+	}
+	own, err := s.db.ListTemplatesByUser(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing templates for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list templates")
+	}
+	system, err := s.db.ListTemplatesByUser(ctx, "")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing system templates", "error", err)
+		return nil, errors.New("failed to list templates")
+	}
+
+	templates := make([]models.Template, 0, len(own)+len(system))
+	for _, template := range append(own, system...) {
+		if itemTypeStr == "" || template.ItemType == itemTypeStr {
+			templates = append(templates, template)
+		}
+	}
+	return templates, nil
+}
+
+// editableTemplate returns a template userID may change: their own, or a system-wide
+// one if they are an admin.
+func (s *Service) editableTemplate(ctx context.Context, userID, templateID string) (*models.Template, error) {
+	template, err := s.GetTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.UserID == "" && !s.IsAdmin(userID) {
+		return nil, ErrPermissionDenied
+	}
+	return template, nil
+}
+
+// UpdateTemplate replaces a template's name and pre-filled fields. Its item type can't
+// change.
+func (s *Service) UpdateTemplate(ctx context.Context, userID, templateID string, req models.TemplateRequest) (*models.Template, error) {
+	current, err := s.editableTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newTemplate(req, models.ItemType(current.ItemType))
+	if err != nil {
+		return nil, err
+	}
+	template.ID, template.UserID, template.CreatedAt = current.ID, current.UserID, current.CreatedAt
+
+	if err := s.db.UpdateTemplate(ctx, template); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		slog.ErrorContext(ctx, "Error updating template", "templateID", templateID, "error", err)
+		return nil, errors.New("failed to update template")
+	}
+	return template, nil
+}
+
+// DeleteTemplate removes a template. Items created from it are unaffected.
+func (s *Service) DeleteTemplate(ctx context.Context, userID, templateID string) error {
+	if _, err := s.editableTemplate(ctx, userID, templateID); err != nil {
+		return err
+	}
+	if err := s.db.DeleteTemplate(ctx, templateID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrTemplateNotFound
+		}
+		slog.ErrorContext(ctx, "Error deleting template", "templateID", templateID, "error", err)
+		return errors.New("failed to delete template")
+	}
+	return nil
+}
+
+// templateOfType returns the template for creating an item of itemType.
+func (s *Service) templateOfType(ctx context.Context, userID, templateID string, itemType models.ItemType) (*models.Template, error) {
+	template, err := s.GetTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.ItemType != string(itemType) {
+		return nil, ErrInvalidTemplate
+	}
+	return template, nil
+}
+
+// CreatePostFromTemplate creates a post like CreatePost, taking the title and content
+// from the template where they are empty. An empty templateID creates a plain post.
+func (s *Service) CreatePostFromTemplate(ctx context.Context, userID, templateID, title, slug, initialContent string) (*models.Post, error) {
+	if templateID != "" {
+		template, err := s.templateOfType(ctx, userID, templateID, models.ItemTypePost)
+		if err != nil {
+			return nil, err
+		}
+		if title == "" {
+			title = template.Title
+		}
+		if initialContent == "" {
+			initialContent = template.Content
+		}
+	}
+	return s.CreatePost(ctx, userID, title, slug, initialContent)
+}
+
+// CreateCodeFileFromTemplate creates a code file like CreateCodeFile, taking the file
+// name, language and content from the template where they are empty. An empty
+// templateID creates a plain code file.
+func (s *Service) CreateCodeFileFromTemplate(ctx context.Context, userID, templateID, fileName, language, initialContent string) (*models.CodeFile, error) {
+	if templateID != "" {
+		template, err := s.templateOfType(ctx, userID, templateID, models.ItemTypeCodeFile)
+		if err != nil {
+			return nil, err
+		}
+		if fileName == "" {
+			fileName = template.FileName
+		}
+		if language == "" {
+			language = template.Language
+		}
+		if initialContent == "" {
+			initialContent = template.Content
+		}
+	}
+	return s.CreateCodeFile(ctx, userID, fileName, language, initialContent)
+}
@@ -0,0 +1,76 @@
+// internal/service/themes.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+var ErrUnknownTheme = apperr.New(apperr.Validation, "unknown theme")
+
+// UseSiteThemes sets the names of the themes users may pick for their public pages.
+// Without it, only the default theme ("") can be set.
+func (s *Service) UseSiteThemes(names []string) {
+	s.siteThemes = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.siteThemes[name] = true
+	}
+}
+
+// SetSiteTheme sets the theme of userID's public pages, or the default if theme is empty.
+func (s *Service) SetSiteTheme(ctx context.Context, userID, theme string) error {
+	if theme != "" && !s.siteThemes[theme] {
+		return ErrUnknownTheme
+	}
+	if err := s.db.SetUserSiteTheme(ctx, userID, theme); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error setting site theme of user", "userID", userID, "error", err)
+		return errors.New("failed to set theme")
+	}
+	_ = s.cache.DeleteUser(ctx, userID)
+	return nil
+}
+
+// GetSiteTheme returns the theme of userID's public pages, "" for the default. A theme
+// that has been removed from the server since it was picked is reported as the default.
+func (s *Service) GetSiteTheme(ctx context.Context, userID string) (string, error) {
+	user, err := s.getUserWithCache(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if !s.siteThemes[user.SiteTheme] {
+		return "", nil
+	}
+	return user.SiteTheme, nil
+}
+
+// getUserWithCache returns a user, without their password hash, from the cache if it has
+// them.
+func (s *Service) getUserWithCache(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.cache.GetUser(ctx, userID)
+	if err == nil && user != nil {
+		return user, nil
+	}
+	if err != nil && !errors.Is(err, cache.ErrNotFound) {
+		slog.ErrorContext(ctx, "Cache error fetching user", "userID", userID, "error", err)
+	}
+	if user, err = s.db.GetUserByUsername(ctx, userID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting user", "userID", userID, "error", err)
+		return nil, errors.New("failed to get user")
+	}
+	user.PasswordHash = ""
+	if err := s.cache.SetUser(ctx, user, s.settings().userCacheTTL); err != nil {
+		slog.WarnContext(ctx, "Failed to cache user", "userID", userID, "error", err)
+	}
+	return user, nil
+}
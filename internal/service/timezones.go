@@ -0,0 +1,85 @@
+// internal/service/timezones.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Times are stored in UTC. Each user can set a time zone; public pages show dates in the
+// author's, and scheduled times without an offset are read in it.
+
+var ErrInvalidTimezone = apperr.New(apperr.Validation, "time zone must be an IANA name such as Europe/Helsinki")
+
+// loadLocation returns the time zone named name, UTC for "".
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" { // The server's, which isn't anyone's choice
+		return nil, ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// SetTimezone sets userID's time zone, an IANA name, or UTC if it is empty.
+func (s *Service) SetTimezone(ctx context.Context, userID, timezone string) error {
+	timezone = strings.TrimSpace(timezone)
+	if _, err := loadLocation(timezone); err != nil {
+		return err
+	}
+	if timezone == "UTC" {
+		timezone = ""
+	}
+	if err := s.db.SetUserTimezone(ctx, userID, timezone); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error setting time zone of user", "userID", userID, "error", err)
+		return errors.New("failed to set time zone")
+	}
+	_ = s.cache.DeleteUser(ctx, userID)
+	return nil
+}
+
+// GetTimezone returns userID's time zone, "" for UTC.
+func (s *Service) GetTimezone(ctx context.Context, userID string) (string, error) {
+	user, err := s.getUserWithCache(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := loadLocation(user.Timezone); err != nil {
+		return "", nil // No longer known to the server's time zone database
+	}
+	return user.Timezone, nil
+}
+
+// userLocation returns userID's time zone and its name. If that can't be found out, dates
+// are still shown, in UTC.
+func (s *Service) userLocation(ctx context.Context, userID string) (*time.Location, string) {
+	timezone, err := s.GetTimezone(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get time zone, using UTC", "userID", userID, "error", err)
+		return time.UTC, ""
+	}
+	loc, _ := loadLocation(timezone)
+	return loc, timezone
+}
+
+// inLocation returns t in loc, or nil if t is nil.
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
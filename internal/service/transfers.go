@@ -0,0 +1,234 @@
+// internal/service/transfers.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+var (
+	ErrTransferNotFound   = apperr.New(apperr.NotFound, "transfer not found")
+	ErrTransferNotPending = apperr.New(apperr.Conflict, "transfer is no longer pending")
+	ErrInvalidTransfer    = apperr.New(apperr.Validation, "an item can't be transferred to its current owner")
+)
+
+// RequestTransfer offers ownership of an item to toUserID. Nothing changes until the
+// recipient accepts. Only the owner can offer an item.
+func (s *Service) RequestTransfer(ctx context.Context, userID, itemID, itemTypeStr, toUserID string) (*models.OwnershipTransfer, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return nil, ErrInvalidItemType
+	}
+
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if meta.GetUserID() != userID {
+		return nil, ErrPermissionDenied
+	}
+	if toUserID == "" || toUserID == userID {
+		return nil, ErrInvalidTransfer
+	}
+	if _, err := s.db.GetUserByUsername(ctx, toUserID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		slog.ErrorContext(ctx, "Error looking up user", "toUserID", toUserID, "error", err)
+		return nil, errors.New("failed to look up user")
+	}
+
+	transfer := &models.OwnershipTransfer{
+		ItemID: itemID, ItemType: itemTypeStr, FromUserID: userID, ToUserID: toUserID,
+		Status: models.TransferPending,
+	}
+	if _, err := s.db.CreateTransfer(ctx, transfer); err != nil {
+		slog.ErrorContext(ctx, "Error creating transfer", "itemType", itemType, "itemID", itemID, "toUserID", toUserID, "error", err)
+		return nil, errors.New("failed to create transfer")
+	}
+	s.notify(ctx, toUserID, models.Notification{
+		Type: models.NotifyTransfer, Title: userID + " offered you ownership of a " + itemNoun(itemType),
+		ItemID: itemID, ItemType: itemType, ActorID: userID, Tag: "transfer:" + itemID,
+	})
+	return transfer, nil
+}
+
+// ListIncomingTransfers returns the pending transfers offered to userID, newest first.
+func (s *Service) ListIncomingTransfers(ctx context.Context, userID string) ([]models.OwnershipTransfer, error) {
+	transfers, err := s.db.ListPendingTransfersByRecipient(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing transfers for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list transfers")
+	}
+	return transfers, nil
+}
+
+// getTransfer loads a pending transfer that userID is a party to.
+func (s *Service) getTransfer(ctx context.Context, userID, transferID string) (*models.OwnershipTransfer, error) {
+	transfer, err := s.db.GetTransferByID(ctx, transferID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, ErrTransferNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting transfer", "transferID", transferID, "error", err)
+		return nil, errors.New("failed to get transfer")
+	}
+	if transfer.FromUserID != userID && transfer.ToUserID != userID {
+		return nil, ErrTransferNotFound // Don't reveal other users' transfers
+	}
+	if transfer.Status != models.TransferPending {
+		return nil, ErrTransferNotPending
+	}
+	return transfer, nil
+}
+
+// resolveTransfer records the outcome of a pending transfer.
+func (s *Service) resolveTransfer(ctx context.Context, transfer *models.OwnershipTransfer, status models.TransferStatus) error {
+	now := s.now().UTC()
+	if err := s.db.ResolveTransfer(ctx, transfer.ID, status, now); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrTransferNotPending // Resolved concurrently
+		}
+		slog.ErrorContext(ctx, "Error resolving transfer", "transferID", transfer.ID, "status", status, "error", err)
+		return errors.New("failed to update transfer")
+	}
+	transfer.Status = status
+	transfer.ResolvedAt = &now
+	return nil
+}
+
+// DeclineTransfer lets the recipient reject a transfer.
+func (s *Service) DeclineTransfer(ctx context.Context, userID, transferID string) (*models.OwnershipTransfer, error) {
+	transfer, err := s.getTransfer(ctx, userID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ToUserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if err := s.resolveTransfer(ctx, transfer, models.TransferDeclined); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// CancelTransfer lets the sender withdraw a transfer.
+func (s *Service) CancelTransfer(ctx context.Context, userID, transferID string) (*models.OwnershipTransfer, error) {
+	transfer, err := s.getTransfer(ctx, userID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.FromUserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if err := s.resolveTransfer(ctx, transfer, models.TransferCancelled); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// AcceptTransfer makes the recipient the owner of the item. The live content moves to
+// the new owner's storage namespace and its size counts against their quota. The item
+// leaves the previous owner's workspace and project; existing history stays attributed
+// to whoever made each change. The transfer is claimed before anything moves, so a
+// concurrent cancel or second accept can't race the move; if the move fails the
+// transfer is pending again.
+func (s *Service) AcceptTransfer(ctx context.Context, userID, transferID string) (*models.OwnershipTransfer, error) {
+	transfer, err := s.getTransfer(ctx, userID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.ToUserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	itemID, itemType := transfer.ItemID, models.ItemType(transfer.ItemType)
+
+	// 1. The item must still exist and belong to the sender
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil && !errors.Is(err, ErrItemNotFound) {
+		return nil, err
+	}
+	if err != nil || meta.GetUserID() != transfer.FromUserID {
+		_ = s.resolveTransfer(ctx, transfer, models.TransferCancelled)
+		return nil, ErrTransferNotPending
+	}
+	oldPath, version := meta.GetS3Path(), meta.GetVersion()
+	size := meta.GetSize() + retainedBytes(meta) // Retained versions and snapshots move with it
+
+	// 2. Charge the recipient before anything moves
+	if err := s.checkQuota(ctx, userID, size); err != nil {
+		return nil, err
+	}
+
+	// 3. Claim the transfer; only one of accept, decline and cancel gets past this
+	if err := s.resolveTransfer(ctx, transfer, models.TransferAccepted); err != nil {
+		return nil, err
+	}
+	reopen := func() {
+		if err := s.db.ReopenTransfer(ctx, transfer.ID); err != nil {
+			slog.ErrorContext(ctx, "Error reopening transfer after a failed move", "transferID", transfer.ID, "error", err)
+		}
+	}
+
+	// 4. Copy the live content into the recipient's namespace
+	newPath := generateS3Path(userID, itemID, itemType)
+	if oldPath != "" && oldPath != newPath {
+		if err := s.storage.CopyFile(ctx, oldPath, newPath); err != nil {
+			slog.ErrorContext(ctx, "Error copying content for transfer", "oldPath", oldPath, "newPath", newPath, "transferID", transfer.ID, "error", err)
+			reopen()
+			return nil, errors.New("failed to move item content")
+		}
+	}
+
+	// 5. Switch the owner
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.SetPostOwner(ctx, itemID, userID, newPath)
+	case models.ItemTypeCodeFile:
+		err = s.db.SetCodeFileOwner(ctx, itemID, userID, newPath)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error transferring", "itemType", itemType, "itemID", itemID, "toUserID", userID, "error", err)
+		if newPath != oldPath {
+			_ = s.storage.DeleteFile(ctx, newPath)
+		}
+		reopen()
+		if errors.Is(err, database.ErrDuplicateSlug) {
+			return nil, ErrSlugTaken // The recipient must rename their post or this one first
+		}
+		return nil, mapDBError(err, itemType, itemID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+	_ = s.cache.InvalidateItemContent(ctx, itemID, itemType)
+
+	// 6. Clean up. Only drop the old object if no write raced the move and put the
+	// old path back on the item.
+	if oldPath != "" && oldPath != newPath {
+		if current, err := s.getItemMetaWithCache(ctx, itemID, itemType); err == nil && current.GetS3Path() == newPath {
+			if delErr := s.storage.DeleteFile(ctx, oldPath); delErr != nil {
+				slog.WarnContext(ctx, "Failed to delete old content after transfer", "oldPath", oldPath, "transferID", transfer.ID, "error", delErr)
+			}
+		}
+	}
+	s.adjustStorageUsage(ctx, transfer.FromUserID, -size)
+	s.adjustStorageUsage(ctx, userID, size)
+	if err := s.db.DeleteCollaborator(ctx, itemID, transfer.ItemType, userID); err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.WarnContext(ctx, "Failed to remove new owner from collaborators", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+	}
+	s.dropCoAuthor(ctx, userID, itemID, itemType, userID) // Credited as the owner now
+	if err := s.db.SetCommentsOwner(ctx, itemID, transfer.ItemType, userID); err != nil {
+		slog.WarnContext(ctx, "Failed to move comments to new owner's moderation queue", "userID", userID, "itemType", itemType, "itemID", itemID, "error", err)
+	}
+
+	historyLog := &models.HistoryLog{
+		UserID: userID, OwnerID: userID, ItemID: itemID, ItemType: transfer.ItemType, Action: models.ActionTransfer,
+		Timestamp: s.now().UTC(), S3PathBefore: oldPath, S3PathAfter: newPath, ItemVersion: version,
+	}
+	s.logAction(ctx, historyLog)
+	s.queueSearchUpdate(ctx, itemID, itemType) // Results are per owner
+	return transfer, nil
+}
@@ -0,0 +1,264 @@
+// internal/service/translations.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A post can be a translation of another of its owner's posts, the canonical post: the
+// canonical post and its translations are the language variants of one post, each at its
+// own slug. Every variant has a language. Public listings show one variant of each post,
+// in the reader's language where there is one, else the canonical post.
+
+const (
+	maxLanguageLength    = 35 // Of a language tag
+	maxAcceptedLanguages = 20 // Read from an Accept-Language header
+)
+
+var (
+	ErrInvalidLanguage    = apperr.New(apperr.Validation, "language must be a language tag such as en or pt-BR")
+	ErrInvalidTranslation = apperr.New(apperr.Validation, "a translation needs a language and must translate another of your posts that has a language and is not itself a translation")
+	ErrDuplicateLanguage  = apperr.New(apperr.Conflict, "the post already has a variant in this language")
+)
+
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// normalizeLanguage checks a language tag and puts it in its usual case: the language in
+// lower case, a region in upper case and a script in title case (zh-Hant-TW). An empty
+// tag stays empty.
+func normalizeLanguage(tag string) (string, error) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return "", nil
+	}
+	if len(tag) > maxLanguageLength || !languagePattern.MatchString(tag) {
+		return "", ErrInvalidLanguage
+	}
+	subtags := strings.Split(strings.ToLower(tag), "-")
+	for i := 1; i < len(subtags); i++ {
+		switch len(subtags[i]) {
+		case 2:
+			subtags[i] = strings.ToUpper(subtags[i])
+		case 4:
+			subtags[i] = strings.ToUpper(subtags[i][:1]) + subtags[i][1:]
+		}
+	}
+	return strings.Join(subtags, "-"), nil
+}
+
+// baseLanguage is the language subtag of a tag: en for en-GB.
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+// ParseLanguages returns the languages of an Accept-Language header (or a single tag),
+// most preferred first. Wildcards, refused languages (q=0) and malformed tags are left
+// out.
+func ParseLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var parsed []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag, err := normalizeLanguage(tag)
+		if err != nil || tag == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		parsed = append(parsed, weighted{tag, q})
+		if len(parsed) == maxAcceptedLanguages {
+			break
+		}
+	}
+	sort.SliceStable(parsed, func(i, j int) bool { return parsed[i].q > parsed[j].q })
+	languages := make([]string, len(parsed))
+	for i, lang := range parsed {
+		languages[i] = lang.tag
+	}
+	return languages
+}
+
+// matchLanguage returns the index of the variant language best matching the preferred
+// languages, or -1 if none does. For each preferred language in turn, a variant of that
+// exact language wins over one that only shares its base language.
+func matchLanguage(languages []string, variants []string) int {
+	for _, want := range languages {
+		base := -1
+		for i, have := range variants {
+			if strings.EqualFold(have, want) {
+				return i
+			}
+			if base < 0 && have != "" && strings.EqualFold(baseLanguage(have), baseLanguage(want)) {
+				base = i
+			}
+		}
+		if base >= 0 {
+			return base
+		}
+	}
+	return -1
+}
+
+// PreferredVariant returns the published variant of post that best matches the preferred
+// languages, or nil if post itself matches as well as any.
+func PreferredVariant(post *models.PublishedPost, languages []string) *models.PostVariant {
+	if post.Language == "" || len(post.Translations) == 0 {
+		return nil
+	}
+	variants := []string{post.Language}
+	for _, variant := range post.Translations {
+		variants = append(variants, variant.Language)
+	}
+	if i := matchLanguage(languages, variants); i > 0 && !strings.EqualFold(variants[i], post.Language) {
+		return &post.Translations[i-1]
+	}
+	return nil
+}
+
+// postVariants returns the variants of post other than itself: its canonical post and
+// that post's translations, or its own translations. Trashed posts are left out, as is
+// a canonical post that has gone.
+func (s *Service) postVariants(ctx context.Context, post *models.Post) ([]models.Post, error) {
+	root := post.ID
+	var variants []models.Post
+	if post.TranslationOf != "" {
+		root = post.TranslationOf
+		canonical, err := getItemMetaAs[*models.Post](ctx, s, root)
+		if err != nil && !errors.Is(err, ErrItemNotFound) {
+			return nil, err
+		}
+		if err == nil && canonical.UserID == post.UserID {
+			variants = append(variants, *canonical)
+		}
+	}
+	translations, err := s.db.ListPostTranslations(ctx, post.UserID, root)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing translations of post", "postID", root, "error", err)
+		return nil, errors.New("failed to list translations")
+	}
+	for _, translation := range translations {
+		if translation.ID != post.ID && translation.DeletedAt == nil {
+			variants = append(variants, translation)
+		}
+	}
+	return variants, nil
+}
+
+// publishedVariants returns the variants of post readers can see: published, with a
+// slug, and not archived.
+func (s *Service) publishedVariants(ctx context.Context, post *models.Post) ([]models.Post, error) {
+	variants, err := s.postVariants(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+	published := variants[:0]
+	for _, variant := range variants {
+		if variant.PublishedVersion > 0 && variant.Slug != "" && variant.ArchivedAt == nil && variant.Language != "" {
+			published = append(published, variant)
+		}
+	}
+	return published, nil
+}
+
+// SetPostLanguage sets the language of a post, and the post it is a translation of
+// (another of the owner's posts; empty for none). A post that has translations can't
+// itself become a translation or lose its language, and no two variants of a post share
+// a language. Only the owner can link their posts.
+func (s *Service) SetPostLanguage(ctx context.Context, userID, postID, language, translationOf string) (*models.Post, error) {
+	language, err := normalizeLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := getItemMetaAs[*models.Post](ctx, s, postID)
+	if err != nil {
+		return nil, err
+	}
+	post := *cached // Copy; the cached value must not be modified
+	if post.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+	if post.Language == language && post.TranslationOf == translationOf {
+		return &post, nil // Nothing to do
+	}
+
+	if translationOf != "" && (translationOf == postID || language == "") {
+		return nil, ErrInvalidTranslation
+	}
+	own, err := s.postVariants(ctx, &models.Post{ID: postID, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(own) > 0 && (translationOf != "" || language == "") {
+		return nil, ErrInvalidTranslation // Its translations would be left without a canonical post
+	}
+	variants := own
+	if translationOf != "" {
+		canonical, err := getItemMetaAs[*models.Post](ctx, s, translationOf)
+		if errors.Is(err, ErrItemNotFound) {
+			return nil, ErrInvalidTranslation
+		}
+		if err != nil {
+			return nil, err
+		}
+		if canonical.UserID != userID || canonical.TranslationOf != "" || canonical.Language == "" {
+			return nil, ErrInvalidTranslation
+		}
+		if variants, err = s.postVariants(ctx, &models.Post{ID: postID, UserID: userID, TranslationOf: translationOf}); err != nil {
+			return nil, err
+		}
+	}
+	for _, variant := range variants {
+		if language != "" && variant.Language == language {
+			return nil, ErrDuplicateLanguage
+		}
+	}
+
+	if err := s.db.SetPostLanguage(ctx, postID, language, translationOf); err != nil {
+		slog.ErrorContext(ctx, "Error setting language of post", "postID", postID, "error", err)
+		return nil, mapDBError(err, models.ItemTypePost, postID)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, postID, models.ItemTypePost)
+	post.Language, post.TranslationOf = language, translationOf
+	s.notifyPostSettings(ctx, userID, &post)
+	slog.InfoContext(ctx, "Post language set", "postID", postID, "language", language, "translationOf", translationOf)
+	return &post, nil
+}
+
+// ListPostTranslations returns the other language variants of a post that userID can
+// view: its canonical post and that post's translations, or its own translations.
+func (s *Service) ListPostTranslations(ctx context.Context, userID, postID string) ([]models.Post, error) {
+	post, err := s.getPostForDraft(ctx, userID, postID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.postVariants(ctx, post)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]models.Post, 0, len(variants))
+	for _, variant := range variants {
+		if s.authorizeItem(ctx, userID, variant.UserID, variant.ID, models.ItemTypePost, models.RoleViewer) == nil {
+			visible = append(visible, variant)
+		}
+	}
+	return visible, nil
+}
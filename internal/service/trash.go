@@ -0,0 +1,217 @@
+// internal/service/trash.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// ErrNotInTrash is returned when restoring an item that hasn't been deleted.
+var ErrNotInTrash = apperr.New(apperr.Conflict, "item is not in the trash")
+
+// purgeBatchSize bounds how many expired items of each type one purge pass removes.
+const purgeBatchSize = 100
+
+// purgeTime returns when an item deleted at deletedAt will be purged, or the zero time
+// if trash is kept indefinitely.
+func (s *Service) purgeTime(deletedAt time.Time) time.Time {
+	if s.cfg.Trash.Retention <= 0 {
+		return time.Time{}
+	}
+	return deletedAt.Add(s.cfg.Trash.Retention)
+}
+
+// ListTrash returns the user's trashed posts and code files, most recently deleted first.
+func (s *Service) ListTrash(ctx context.Context, userID string) ([]models.TrashedItem, error) {
+	q := database.TrashQuery{UserID: userID}
+	posts, err := s.db.ListTrashedPostMeta(ctx, q)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing trashed posts for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list trash")
+	}
+	files, err := s.db.ListTrashedCodeFileMeta(ctx, q)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing trashed code files for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list trash")
+	}
+
+	items := make([]models.TrashedItem, 0, len(posts)+len(files))
+	for _, p := range posts {
+		items = append(items, models.TrashedItem{
+			ItemID: p.ID, ItemType: string(models.ItemTypePost), Name: p.Title,
+			DeletedAt: *p.DeletedAt, PurgeAt: s.purgeTime(*p.DeletedAt),
+		})
+	}
+	for _, f := range files {
+		items = append(items, models.TrashedItem{
+			ItemID: f.ID, ItemType: string(models.ItemTypeCodeFile), Name: f.FileName,
+			DeletedAt: *f.DeletedAt, PurgeAt: s.purgeTime(*f.DeletedAt),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// RestoreItem takes an item out of the trash. Its content and version are unchanged.
+func (s *Service) RestoreItem(ctx context.Context, userID, itemID, itemTypeStr string) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+
+	// 1. Read meta straight from the DB; the cached path hides trashed items
+	var ownerUserID string
+	var deletedAt *time.Time
+	var currentVersion int
+	switch itemType {
+	case models.ItemTypePost:
+		post, err := s.db.GetPostMetaByID(ctx, itemID)
+		if err != nil {
+			return mapDBError(err, itemType, itemID)
+		}
+		ownerUserID, deletedAt, currentVersion = post.UserID, post.DeletedAt, post.Version
+	case models.ItemTypeCodeFile:
+		file, err := s.db.GetCodeFileMetaByID(ctx, itemID)
+		if err != nil {
+			return mapDBError(err, itemType, itemID)
+		}
+		ownerUserID, deletedAt, currentVersion = file.UserID, file.DeletedAt, file.Version
+	}
+	if ownerUserID != userID {
+		return ErrPermissionDenied
+	}
+	if deletedAt == nil {
+		return ErrNotInTrash
+	}
+
+	// 2. Clear the deletion marker
+	var err error
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.SetPostDeletedAt(ctx, itemID, nil)
+	case models.ItemTypeCodeFile:
+		err = s.db.SetCodeFileDeletedAt(ctx, itemID, nil)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error restoring from trash", "itemType", itemType, "itemID", itemID, "error", err)
+		return mapDBError(err, itemType, itemID)
+	}
+
+	// 3. Log Action History (Restore)
+	historyLog := &models.HistoryLog{
+		UserID: userID, ItemID: itemID, ItemType: itemTypeStr,
+		Action: models.ActionRestore, Timestamp: s.now().UTC(), ItemVersion: currentVersion,
+	}
+	s.logAction(ctx, historyLog)
+
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+	s.queueSearchUpdate(ctx, itemID, itemType)
+	return nil
+}
+
+// purgeItem permanently removes a trashed item: its metadata, live and published content,
+// retained versions and snapshots, and gives back the size bytes charged for them. The
+// history log is kept as an audit trail, and the purge logged in it.
+func (s *Service) purgeItem(ctx context.Context, itemID string, itemType models.ItemType, ownerUserID, s3Path string, version int, size int64) error {
+	// 1. Delete Metadata from DB first so the item can't be restored half-purged
+	var err error
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.DeletePostMeta(ctx, itemID)
+	case models.ItemTypeCodeFile:
+		err = s.db.DeleteCodeFileMeta(ctx, itemID)
+	}
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+
+	// 2. Delete Content. Storage leftovers are only logged; they're unreachable now.
+	paths := []string{s3Path}
+	for v := 1; v <= version; v++ {
+		paths = append(paths, generateVersionPath(itemID, itemType, v), generateVersionDeltaPath(itemID, itemType, v))
+	}
+	if itemType == models.ItemTypePost {
+		paths = append(paths, generatePublishedPath(itemID))
+	}
+	history, histErr := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if histErr != nil {
+		slog.WarnContext(ctx, "Failed to load history for purge, snapshots may be left behind", "itemType", itemType, "itemID", itemID, "error", histErr)
+	}
+	for _, entry := range history {
+		if entry.Action == models.ActionSnapshot {
+			paths = append(paths, entry.S3PathAfter)
+		}
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if delErr := s.storage.DeleteFile(ctx, path); delErr != nil {
+			slog.WarnContext(ctx, "Failed to delete object while purging", "path", path, "itemType", itemType, "itemID", itemID, "error", delErr)
+		}
+	}
+
+	s.adjustStorageUsage(ctx, ownerUserID, -size)
+	s.deleteCollaborators(ctx, itemID, itemType)
+	s.deleteVersionTags(ctx, itemID, itemType)
+	s.deleteHookResults(ctx, itemID, itemType)
+	s.deleteComments(ctx, itemID, itemType)
+	s.deleteJournal(ctx, itemID, itemType)
+	if itemType == models.ItemTypePost {
+		s.deletePostBookmarks(ctx, itemID)
+	}
+	if err := s.db.DeleteItemStats(ctx, itemID, string(itemType)); err != nil {
+		slog.WarnContext(ctx, "Failed to delete stats while purging", "itemType", itemType, "itemID", itemID, "error", err)
+	}
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+	_ = s.cache.InvalidateItemContent(ctx, itemID, itemType)
+
+	// Logged by nobody, as the trash retention ran out; the owner is set as it's gone
+	s.logAction(ctx, &models.HistoryLog{
+		ItemID: itemID, ItemType: string(itemType), OwnerID: ownerUserID,
+		Action: models.ActionPurge, Timestamp: s.now().UTC(), ItemVersion: version,
+	})
+	return nil
+}
+
+// PurgeExpiredTrash permanently removes items that have been in the trash longer than
+// the configured retention. It returns how many items were purged.
+func (s *Service) PurgeExpiredTrash(ctx context.Context) (int, error) {
+	if s.cfg.Trash.Retention <= 0 {
+		return 0, nil // Trash is kept forever
+	}
+	q := database.TrashQuery{DeletedBefore: s.now().UTC().Add(-s.cfg.Trash.Retention), Limit: purgeBatchSize}
+
+	purged := 0
+	posts, err := s.db.ListTrashedPostMeta(ctx, q)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired posts: %w", err)
+	}
+	for _, p := range posts {
+		if err := s.purgeItem(ctx, p.ID, models.ItemTypePost, p.UserID, p.S3Path, p.Version, p.Size+p.RetainedBytes); err != nil {
+			slog.ErrorContext(ctx, "Error purging post", "postID", p.ID, "error", err)
+			continue
+		}
+		purged++
+	}
+
+	files, err := s.db.ListTrashedCodeFileMeta(ctx, q)
+	if err != nil {
+		return purged, fmt.Errorf("failed to list expired code files: %w", err)
+	}
+	for _, f := range files {
+		if err := s.purgeItem(ctx, f.ID, models.ItemTypeCodeFile, f.UserID, f.S3Path, f.Version, f.Size+f.RetainedBytes); err != nil {
+			slog.ErrorContext(ctx, "Error purging codefile", "fileID", f.ID, "error", err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
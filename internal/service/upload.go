@@ -0,0 +1,57 @@
+// internal/service/upload.go
+package service
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/models"
+	"unicode/utf8"
+)
+
+// ErrInvalidUpload is returned for uploaded files that aren't text.
+var ErrInvalidUpload = apperr.New(apperr.Validation, "uploaded file must be UTF-8 text; upload binary files as assets")
+
+// UploadCodeFile creates a code file from an uploaded file. The path may include
+// directories; the language is inferred from the name and content when it is empty.
+func (s *Service) UploadCodeFile(ctx context.Context, userID, filePath, language string, content []byte) (*models.CodeFile, error) {
+	if !utf8.Valid(content) {
+		return nil, ErrInvalidUpload
+	}
+	return s.CreateCodeFile(ctx, userID, filePath, language, string(content))
+}
+
+// ReplaceCodeFileContent overwrites a code file's content with an uploaded file. The
+// difference is applied like any other edit (history, snapshots, search), and returned
+// for broadcasting; no changes means the content was the same. A non-zero baseVersion
+// must be the current version.
+func (s *Service) ReplaceCodeFileContent(ctx context.Context, userID, fileID string, baseVersion int, content []byte) (int, []models.Change, error) {
+	if !utf8.Valid(content) {
+		return 0, nil, ErrInvalidUpload
+	}
+	file, err := getItemMetaAs[*models.CodeFile](ctx, s, fileID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := s.authorizeItem(ctx, userID, file.UserID, fileID, models.ItemTypeCodeFile, models.RoleEditor); err != nil {
+		return 0, nil, err
+	}
+	unlock, err := s.lockItemWrite(ctx, fileID, models.ItemTypeCodeFile) // No write slips in between reading and applying
+	if err != nil {
+		return 0, nil, err
+	}
+	defer unlock()
+
+	current, currentVersion, err := s.GetItemContent(ctx, userID, fileID, string(models.ItemTypeCodeFile))
+	if err != nil {
+		return 0, nil, err
+	}
+	if baseVersion != 0 && baseVersion != currentVersion {
+		return currentVersion, nil, ErrVersionConflict
+	}
+	changes := changesFromEdits(diff.Edits(current, string(content)))
+	if len(changes) == 0 {
+		return currentVersion, nil, nil
+	}
+	return s.applyItemChanges(ctx, userID, fileID, models.ItemTypeCodeFile, currentVersion, changes)
+}
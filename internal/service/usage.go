@@ -0,0 +1,183 @@
+// internal/service/usage.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// API usage is counted per user, API key (the bearer token used; see auth.KeyID) and
+// UTC day: authenticated HTTP requests and WebSocket messages after authenticating.
+// Counts are buffered like item stats and written by RunStatsFlusher. With a daily quota
+// configured, each user's count for the day, over all their keys, is also kept in the
+// shared cache (per replica without Redis), which decides whether a request or message
+// is let through; refused ones aren't counted.
+
+// usageQuotaTTL is how long a day's quota counter is kept: past the end of the day in
+// every time zone, after which nothing reads it.
+const usageQuotaTTL = 48 * time.Hour
+
+// usageKey identifies one user's counts with one API key for one day.
+type usageKey struct {
+	tenantID string
+	userID   string
+	keyID    string
+	day      string
+}
+
+type usageDelta struct {
+	requests, wsMessages int64
+}
+
+// usageRecorder buffers users' request and message counts in memory, so an active user
+// costs one database write per flush.
+type usageRecorder struct {
+	mu      sync.Mutex
+	pending map[usageKey]*usageDelta
+}
+
+func newUsageRecorder() *usageRecorder {
+	return &usageRecorder{pending: make(map[usageKey]*usageDelta)}
+}
+
+func (r *usageRecorder) add(key usageKey, requests, wsMessages int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delta, ok := r.pending[key]
+	if !ok {
+		delta = &usageDelta{}
+		r.pending[key] = delta
+	}
+	delta.requests += requests
+	delta.wsMessages += wsMessages
+}
+
+// take returns the pending counts and starts a new batch.
+func (r *usageRecorder) take() map[usageKey]*usageDelta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.pending
+	r.pending = make(map[usageKey]*usageDelta)
+	return pending
+}
+
+// usageQuotaKey returns the counter key of a user's quota of kind ("http" or "ws") for
+// a day.
+func usageQuotaKey(ctx context.Context, kind, userID, day string) string {
+	return "usage:" + kind + ":" + tenant.ID(ctx) + ":" + userID + ":" + day
+}
+
+// CountRequest counts an authenticated HTTP request by userID with API key keyID and
+// reports whether their daily request quota allows it.
+func (s *Service) CountRequest(ctx context.Context, userID, keyID string) bool {
+	if !s.allowUsage(ctx, "http", userID, s.cfg.Quota.DailyRequests) {
+		return false
+	}
+	s.usage.add(usageKey{tenantID: tenant.ID(ctx), userID: userID, keyID: keyID, day: s.now().UTC().Format(statsDayFormat)}, 1, 0)
+	return true
+}
+
+// CountWSMessage counts a WebSocket message by userID with API key keyID and reports
+// whether their daily message quota allows it.
+func (s *Service) CountWSMessage(ctx context.Context, userID, keyID string) bool {
+	if !s.allowUsage(ctx, "ws", userID, s.cfg.Quota.DailyWSMessages) {
+		return false
+	}
+	s.usage.add(usageKey{tenantID: tenant.ID(ctx), userID: userID, keyID: keyID, day: s.now().UTC().Format(statsDayFormat)}, 0, 1)
+	return true
+}
+
+// allowUsage counts one use of kind against userID's daily quota (0 for unlimited) and
+// reports whether it is within it. Uses are let through if the counter fails.
+func (s *Service) allowUsage(ctx context.Context, kind, userID string, quota int) bool {
+	if quota <= 0 {
+		return true
+	}
+	key := usageQuotaKey(ctx, kind, userID, s.now().UTC().Format(statsDayFormat))
+	count, err := s.usageCounter.IncrByTTL(ctx, key, 1, usageQuotaTTL)
+	if err != nil {
+		slog.WarnContext(ctx, "Usage counter failed, allowing request", "userID", userID, "error", err)
+		return true
+	}
+	return count <= int64(quota)
+}
+
+// FlushUsage writes the buffered usage counts to the database. Counts that fail to write
+// are kept for the next flush.
+func (s *Service) FlushUsage(ctx context.Context) error {
+	var firstErr error
+	for key, delta := range s.usage.take() {
+		keyCtx := ctx
+		if key.tenantID != "" {
+			keyCtx = tenant.WithID(ctx, key.tenantID)
+		}
+		if err := s.db.IncrementUsage(keyCtx, key.userID, key.keyID, key.day, delta.requests, delta.wsMessages); err != nil {
+			s.usage.add(key, delta.requests, delta.wsMessages)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// GetUsage returns userID's daily API usage for the last `days` days (including today),
+// with totals per API key, and their daily quotas.
+func (s *Service) GetUsage(ctx context.Context, userID string, days int) (*models.Usage, error) {
+	if days <= 0 {
+		days = defaultStatsDays
+	}
+	days = min(days, maxStatsDays)
+
+	today := s.now().UTC()
+	first := today.AddDate(0, 0, -(days - 1))
+	usage := &models.Usage{
+		UserID: userID, From: first.Format(statsDayFormat), To: today.Format(statsDayFormat),
+		DailyRequestQuota: s.cfg.Quota.DailyRequests, DailyWSMessageQuota: s.cfg.Quota.DailyWSMessages,
+		Days: make([]models.UsageDay, 0, days), Keys: []models.KeyUsage{},
+	}
+	stored, err := s.db.ListUsage(ctx, userID, usage.From, usage.To)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading API usage", "userID", userID, "error", err)
+		return nil, errors.New("failed to load API usage")
+	}
+	byDay := make(map[string]models.UsageDay, len(stored))
+	byKey := make(map[string]*models.KeyUsage)
+	for _, day := range stored {
+		total := byDay[day.Day]
+		total.Requests += day.Requests
+		total.WSMessages += day.WSMessages
+		byDay[day.Day] = total
+		key, ok := byKey[day.KeyID]
+		if !ok {
+			key = &models.KeyUsage{KeyID: day.KeyID}
+			byKey[day.KeyID] = key
+		}
+		key.Requests += day.Requests
+		key.WSMessages += day.WSMessages
+	}
+	for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+		key := d.Format(statsDayFormat)
+		day := byDay[key]
+		day.Day = key
+		usage.TotalRequests += day.Requests
+		usage.TotalWSMessages += day.WSMessages
+		usage.Days = append(usage.Days, day)
+	}
+	for _, key := range byKey {
+		usage.Keys = append(usage.Keys, *key)
+	}
+	sort.Slice(usage.Keys, func(i, j int) bool {
+		if usage.Keys[i].Requests != usage.Keys[j].Requests {
+			return usage.Keys[i].Requests > usage.Keys[j].Requests
+		}
+		return usage.Keys[i].KeyID < usage.Keys[j].KeyID
+	})
+	return usage, nil
+}
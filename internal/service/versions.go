@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/diff"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrVersionNotFound     = apperr.New(apperr.NotFound, "requested version does not exist")
+	ErrVersionNotAvailable = apperr.New(apperr.Gone, "content for the requested version is not retained")
+)
+
+// generateVersionPath returns the immutable storage key holding an item's content at a given version.
+func generateVersionPath(itemID string, itemType models.ItemType, version int) string {
+	return fmt.Sprintf("versions/%s/%s/v%d", itemType, itemID, version)
+}
+
+// storeVersionContent keeps an immutable copy of the content written as `version`,
+// so GetItemContentAtVersion can serve it later. It is stored in full; CompactVersions
+// delta-encodes it once its chain is past (see deltas.go), which keeps reading the base
+// and diffing off the write path. Call it only after the metadata update for that
+// version succeeded, so a losing concurrent writer never overwrites it. The stored bytes
+// are charged to ownerUserID. Failures are logged but don't fail the write; the version
+// just won't be retrievable.
+func (s *Service) storeVersionContent(ctx context.Context, ownerUserID, itemID string, itemType models.ItemType, version int, content, contentType string) {
+	if !s.cfg.Snapshot.RetainVersions {
+		return
+	}
+	versionPath := generateVersionPath(itemID, itemType, version)
+	if err := s.storage.UploadFile(ctx, versionPath, strings.NewReader(content), contentType); err != nil {
+		slog.WarnContext(ctx, "Failed to store version content", "itemType", itemType, "itemID", itemID, "version", version, "versionPath", versionPath, "error", err)
+		return
+	}
+	s.chargeRetained(ctx, ownerUserID, itemID, itemType, int64(len(content)))
+}
+
+// maxReplayHistory bounds how many history entries are read when rebuilding a version by patch replay.
+const maxReplayHistory = 5000
+
+// reconstructVersion returns an item's content as of `version`. It prefers the retained
+// version, then replays the change journal onto an earlier version, and otherwise starts
+// from the nearest earlier create/snapshot/revert entry of the history and replays the
+// logged patches on top of it.
+func (s *Service) reconstructVersion(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	// 1. Retained version, in full or as a delta. A damaged delta may still be replayable.
+	content, err := s.loadVersionContent(ctx, itemID, itemType, version)
+	if err == nil {
+		return content, nil
+	}
+	if !errors.Is(err, storage.ErrFileNotFound) && !errors.Is(err, ErrIntegrity) {
+		return "", err
+	}
+
+	// 2. The journal, back to where its entries run out or a revert
+	content, err = s.journalVersion(ctx, itemID, itemType, version)
+	if !errors.Is(err, ErrVersionNotAvailable) {
+		return content, err
+	}
+
+	// 3. The history, for versions the journal has dropped or never had
+	return s.historyVersion(ctx, itemID, itemType, version)
+}
+
+// journalVersion rebuilds an item's content at version from the change journal. It walks
+// back from version over the journaled patches until an entry is missing, which makes
+// the version before it the base, or it reaches a revert, whose target is the base; then
+// it replays the patches onto the base's content. It returns ErrVersionNotAvailable if
+// version itself isn't journaled.
+func (s *Service) journalVersion(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	from := max(0, version-maxReplayHistory)
+	entries, err := s.db.ListJournal(ctx, itemID, string(itemType), from, version-from)
+	if err != nil {
+		return "", fmt.Errorf("failed to load journal: %w", err)
+	}
+
+	var batches [][]models.Change // Newest first
+	base := 0
+	for i, v := len(entries)-1, version; ; i, v = i-1, v-1 {
+		if i < 0 || entries[i].Version != v {
+			base = v // Not journaled, so its content comes from elsewhere
+			break
+		}
+		if entries[i].Action == models.ActionRevert {
+			base = entries[i].RevertedTo
+			if base < 1 || base >= v {
+				return "", ErrVersionNotAvailable // Guard against cycles in a corrupt journal
+			}
+			break
+		}
+		batches = append(batches, entries[i].Changes)
+	}
+	if base == version {
+		return "", ErrVersionNotAvailable
+	}
+
+	content, err := s.reconstructVersion(ctx, itemID, itemType, base)
+	if err != nil {
+		return "", err
+	}
+	for i := len(batches) - 1; i >= 0; i-- {
+		content, err = applyChanges(content, batches[i])
+		if err != nil {
+			slog.WarnContext(ctx, "Journal replay failed", "itemType", itemType, "itemID", itemID, "version", version, "base", base, "error", err)
+			return "", ErrVersionNotAvailable
+		}
+	}
+	return content, nil
+}
+
+// historyVersion rebuilds an item's content at version from the history: it starts from
+// the nearest earlier create/snapshot/revert entry and replays the logged patches.
+func (s *Service) historyVersion(ctx context.Context, itemID string, itemType models.ItemType, version int) (string, error) {
+	// 1. Find the replay base and the patches after it
+	history, err := s.db.GetActionHistory(ctx, itemID, string(itemType), maxReplayHistory)
+	if err != nil {
+		return "", fmt.Errorf("failed to load history for replay: %w", err)
+	}
+
+	var base *models.HistoryLog
+	patches := make(map[int][]models.HistoryLog) // Key: ItemVersion
+	for i := len(history) - 1; i >= 0; i-- {     // History is newest first; walk it oldest first
+		entry := &history[i]
+		if entry.ItemVersion > version {
+			continue
+		}
+		switch entry.Action {
+		case models.ActionPatch:
+			if entry.ChangeData != nil {
+				patches[entry.ItemVersion] = append(patches[entry.ItemVersion], *entry)
+			}
+		case models.ActionCreate, models.ActionSnapshot, models.ActionRevert:
+			// Prefer snapshots at equal versions: their content is stored directly
+			if base == nil || entry.ItemVersion > base.ItemVersion ||
+				(entry.ItemVersion == base.ItemVersion && entry.Action == models.ActionSnapshot) {
+				base = entry
+			}
+		}
+	}
+	if base == nil {
+		return "", ErrVersionNotAvailable // Base fell outside the history window
+	}
+
+	content, err := s.replayBaseContent(ctx, base)
+	if err != nil {
+		return "", err
+	}
+
+	// 2. Replay each version's batch in order
+	for v := base.ItemVersion + 1; v <= version; v++ {
+		batch := patches[v]
+		if len(batch) == 0 {
+			return "", ErrVersionNotAvailable // Gap in the log, e.g. a failed history write
+		}
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].ChangeIndex < batch[j].ChangeIndex })
+		changes := make([]models.Change, len(batch))
+		for i := range batch {
+			changes[i] = *batch[i].ChangeData
+		}
+		content, err = applyChanges(content, changes)
+		if err != nil {
+			slog.WarnContext(ctx, "Patch replay failed", "itemType", itemType, "itemID", itemID, "version", v, "error", err)
+			return "", ErrVersionNotAvailable
+		}
+	}
+	return content, nil
+}
+
+// replayBaseContent loads the content a replay starts from.
+func (s *Service) replayBaseContent(ctx context.Context, base *models.HistoryLog) (string, error) {
+	itemType := models.ItemType(base.ItemType)
+	var path string
+	switch base.Action {
+	case models.ActionSnapshot:
+		path = base.S3PathAfter // Immutable snapshot copy
+	case models.ActionCreate:
+		// The create entry points at the live object, so only the retained v1 copy is usable
+		content, err := s.loadVersionContent(ctx, base.ItemID, itemType, base.ItemVersion)
+		if errors.Is(err, storage.ErrFileNotFound) || errors.Is(err, ErrIntegrity) {
+			return "", ErrVersionNotAvailable
+		}
+		return content, err
+	case models.ActionRevert:
+		// A revert's content is whatever the version it reverted to looked like
+		if base.RevertedToLogID == nil {
+			return "", ErrVersionNotAvailable
+		}
+		target, err := s.db.GetHistoryLogByID(ctx, *base.RevertedToLogID)
+		if err != nil {
+			return "", fmt.Errorf("failed to load revert target %s: %w", *base.RevertedToLogID, err)
+		}
+		if target.ItemVersion >= base.ItemVersion {
+			return "", ErrVersionNotAvailable // Guard against cycles in corrupt history
+		}
+		return s.reconstructVersion(ctx, base.ItemID, itemType, target.ItemVersion)
+	}
+
+	content, err := s.downloadContent(ctx, path)
+	if errors.Is(err, storage.ErrFileNotFound) {
+		return "", ErrVersionNotAvailable
+	}
+	return content, err
+}
+
+// downloadContent reads a whole storage object as a string.
+func (s *Service) downloadContent(ctx context.Context, path string) (string, error) {
+	if path == "" {
+		return "", storage.ErrFileNotFound
+	}
+	reader, err := s.storage.DownloadFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	contentBytes, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return string(contentBytes), nil
+}
+
+// GetItemContentAtVersion returns the item's content as it was at the given version.
+func (s *Service) GetItemContentAtVersion(ctx context.Context, userID, itemID, itemTypeStr string, version int) (string, error) {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return "", ErrInvalidItemType
+	}
+
+	// 1. Get Metadata (checks ownership, gets current version)
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return "", err
+	}
+
+	var ownerUserID string
+	var currentVersion int
+
+	switch itemType {
+	case models.ItemTypePost:
+		postMeta := meta.(*models.Post)
+		ownerUserID = postMeta.UserID
+		currentVersion = postMeta.Version
+	case models.ItemTypeCodeFile:
+		fileMeta := meta.(*models.CodeFile)
+		ownerUserID = fileMeta.UserID
+		currentVersion = fileMeta.Version
+	}
+	if err := s.authorizeItem(ctx, userID, ownerUserID, itemID, itemType, models.RoleViewer); err != nil {
+		return "", err
+	}
+	if version < 1 || version > currentVersion {
+		return "", ErrVersionNotFound
+	}
+
+	// 2. The head version is served by the regular content path (cache, live object)
+	if version == currentVersion {
+		content, _, err := s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+		return content, err
+	}
+
+	// 3. Check Content Cache (keys are already per-version)
+	cachedContent, err := s.cache.GetItemContent(ctx, itemID, itemType, version)
+	if err == nil {
+		return cachedContent, nil
+	}
+	if !errors.Is(err, cache.ErrNotFound) {
+		slog.ErrorContext(ctx, "Cache error fetching item content", "itemID", itemID, "itemType", itemType, "version", version, "error", err)
+	}
+
+	// 4. Fetch the retained version object, or rebuild it from history
+	content, err := s.reconstructVersion(ctx, itemID, itemType, version)
+	if err != nil {
+		if !errors.Is(err, ErrVersionNotAvailable) {
+			slog.ErrorContext(ctx, "Error reconstructing version", "itemType", itemType, "itemID", itemID, "version", version, "error", err)
+		}
+		return "", err
+	}
+
+	// Historical versions never change, so they're safe to cache like the head
+	if cacheErr := s.cache.SetItemContent(ctx, itemID, itemType, version, content, s.settings().itemContentCacheTTL); cacheErr != nil {
+		slog.WarnContext(ctx, "Failed to cache item content", "itemID", itemID, "itemType", itemType, "version", version, "error", cacheErr)
+	}
+	return content, nil
+}
+
+// DiffItemVersions returns a line diff from fromVersion to toVersion of an item.
+// A toVersion <= 0 diffs against the current version.
+func (s *Service) DiffItemVersions(ctx context.Context, userID, itemID, itemTypeStr string, fromVersion, toVersion int) (*models.VersionDiffPayload, error) {
+	var toContent string
+	var err error
+	if toVersion <= 0 {
+		toContent, toVersion, err = s.GetItemContent(ctx, userID, itemID, itemTypeStr)
+	} else {
+		toContent, err = s.GetItemContentAtVersion(ctx, userID, itemID, itemTypeStr, toVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fromContent, err := s.GetItemContentAtVersion(ctx, userID, itemID, itemTypeStr, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	result := diff.Lines(fromContent, toContent, fmt.Sprintf("v%d", fromVersion), fmt.Sprintf("v%d", toVersion), diff.DefaultContext)
+	return &models.VersionDiffPayload{
+		ItemID:      itemID,
+		ItemType:    itemTypeStr,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Diff:        result,
+	}, nil
+}
@@ -0,0 +1,63 @@
+// internal/service/warmup.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+// WarmCache preloads the metadata and latest content of the items most recently active
+// in the history (up to the configured number, within the configured window) into the
+// cache, so the first requests after a restart don't all go to storage. It returns how
+// many items it warmed; items that fail to load are skipped.
+func (s *Service) WarmCache(ctx context.Context) (int, error) {
+	limit := s.cfg.Cache.WarmItems
+	if limit <= 0 {
+		return 0, nil
+	}
+	history, err := s.db.ListRecentHistory(ctx, s.now().UTC().Add(-s.cfg.Cache.WarmWindow), maxReplayHistory)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recent history: %w", err)
+	}
+
+	warmed := 0
+	seen := make(map[string]bool, limit)
+	for _, entry := range history { // Newest first
+		if warmed >= limit {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return warmed, err
+		}
+		key := entry.ItemType + ":" + entry.ItemID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		itemType := models.ItemType(entry.ItemType)
+		if !itemType.IsValid() {
+			continue
+		}
+		if err := s.warmItem(ctx, entry.ItemID, itemType); err != nil {
+			if !errors.Is(err, ErrItemNotFound) {
+				slog.WarnContext(ctx, "Failed to warm cache for item", "itemType", itemType, "itemID", entry.ItemID, "error", err)
+			}
+			continue
+		}
+		warmed++
+	}
+	return warmed, nil
+}
+
+// warmItem loads an item's metadata and current content into the cache.
+func (s *Service) warmItem(ctx context.Context, itemID string, itemType models.ItemType) error {
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.loadCurrentContent(ctx, itemID, itemType, meta)
+	return err
+}
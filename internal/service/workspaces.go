@@ -0,0 +1,131 @@
+// internal/service/workspaces.go
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/database"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+	"strings"
+)
+
+// DefaultWorkspaceID names the implicit workspace holding items without a WorkspaceID.
+const DefaultWorkspaceID = "default"
+
+var (
+	ErrWorkspaceNotFound = apperr.New(apperr.NotFound, "workspace not found")
+	ErrInvalidWorkspace  = apperr.New(apperr.Validation, "workspace name is required")
+)
+
+// storedWorkspaceID maps the public default workspace ID to the empty ID stored on items.
+func storedWorkspaceID(workspaceID string) string {
+	if workspaceID == DefaultWorkspaceID {
+		return ""
+	}
+	return workspaceID
+}
+
+// CreateWorkspace creates an empty workspace owned by userID.
+func (s *Service) CreateWorkspace(ctx context.Context, userID, name string) (*models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidWorkspace
+	}
+	workspace := &models.Workspace{UserID: userID, Name: name}
+	if _, err := s.db.CreateWorkspace(ctx, workspace); err != nil {
+		slog.ErrorContext(ctx, "Error creating workspace for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to create workspace")
+	}
+	return workspace, nil
+}
+
+// ListWorkspaces returns the user's workspaces, starting with the default workspace.
+func (s *Service) ListWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error) {
+	workspaces, err := s.db.ListWorkspacesByUser(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing workspaces for user", "userID", userID, "error", err)
+		return nil, errors.New("failed to list workspaces")
+	}
+	defaultWorkspace := models.Workspace{ID: DefaultWorkspaceID, UserID: userID, Name: "Default", Default: true}
+	return append([]models.Workspace{defaultWorkspace}, workspaces...), nil
+}
+
+// checkWorkspace verifies that userID owns workspaceID. Everyone owns their default workspace.
+func (s *Service) checkWorkspace(ctx context.Context, userID, workspaceID string) error {
+	if storedWorkspaceID(workspaceID) == "" {
+		return nil
+	}
+	workspace, err := s.db.GetWorkspaceByID(ctx, workspaceID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrWorkspaceNotFound
+		}
+		slog.ErrorContext(ctx, "Error getting workspace", "workspaceID", workspaceID, "error", err)
+		return errors.New("failed to get workspace")
+	}
+	if workspace.UserID != userID {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// ListWorkspaceItems returns the posts and code files in a workspace, newest first.
+// limit and offset apply to each item type separately. Archived items are left out
+// unless includeArchived.
+func (s *Service) ListWorkspaceItems(ctx context.Context, userID, workspaceID string, limit, offset int, includeArchived bool) (*models.WorkspaceItems, error) {
+	if err := s.checkWorkspace(ctx, userID, workspaceID); err != nil {
+		return nil, err
+	}
+	stored := storedWorkspaceID(workspaceID)
+
+	posts, err := s.db.ListPostMetaByWorkspace(ctx, userID, stored, limit, offset, includeArchived)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing posts in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, errors.New("failed to list workspace items")
+	}
+	files, err := s.db.ListCodeFileMetaByWorkspace(ctx, userID, stored, limit, offset, includeArchived)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing codefiles in workspace", "workspaceID", workspaceID, "error", err)
+		return nil, errors.New("failed to list workspace items")
+	}
+	return &models.WorkspaceItems{WorkspaceID: workspaceID, Posts: posts, CodeFiles: files}, nil
+}
+
+// MoveItemToWorkspace moves a post or code file into workspaceID ("default" or empty
+// for the default workspace).
+func (s *Service) MoveItemToWorkspace(ctx context.Context, userID, itemID, itemTypeStr, workspaceID string) error {
+	itemType := models.ItemType(itemTypeStr)
+	if !itemType.IsValid() {
+		return ErrInvalidItemType
+	}
+
+	// 1. Check ownership of the item and the target workspace
+	meta, err := s.getItemMetaWithCache(ctx, itemID, itemType)
+	if err != nil {
+		return err
+	}
+	if meta.GetUserID() != userID {
+		return ErrPermissionDenied
+	}
+	if err := s.checkWorkspace(ctx, userID, workspaceID); err != nil {
+		return err
+	}
+
+	// 2. Move
+	stored := storedWorkspaceID(workspaceID)
+	switch itemType {
+	case models.ItemTypePost:
+		err = s.db.SetPostWorkspace(ctx, itemID, stored)
+	case models.ItemTypeCodeFile:
+		err = s.db.SetCodeFileWorkspace(ctx, itemID, stored)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error moving to workspace", "itemType", itemType, "itemID", itemID, "workspaceID", workspaceID, "error", err)
+		return mapDBError(err, itemType, itemID)
+	}
+
+	_ = s.cache.DeleteItemMeta(ctx, itemID, itemType)
+	return nil
+}
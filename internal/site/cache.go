@@ -0,0 +1,324 @@
+// internal/site/cache.go
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/middleware"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedPages bounds the page cache. Past it, expired pages are dropped, and if that
+// isn't enough, all of them: a blog has few pages, so this only happens to crawlers
+// walking ?page= far past the end.
+const maxCachedPages = 1000
+
+// pageParams are the query parameters cached pages depend on. Others (tracking tags,
+// cache busters) are left out of the cache key, so they can't fill the cache with
+// copies of a page.
+var pageParams = []string{"frontMatter", "lang", "page"}
+
+type cachedPage struct {
+	status   int
+	header   http.Header
+	body     []byte
+	etag     string
+	tenantID string
+	viewOf   string    // The post the page shows, whose views are counted; see CountView
+	fresh    time.Time // Served as is until then, and while revalidated until expires
+	expires  time.Time
+}
+
+// ViewCounter counts public views of posts.
+type ViewCounter interface {
+	RecordPublicView(ctx context.Context, postID, viewerKey string)
+}
+
+// pageRender is a render of a page in progress, which requests for the same page wait
+// for rather than rendering it again.
+type pageRender struct {
+	done chan struct{}
+	page *cachedPage
+}
+
+// PageCache keeps public responses (blog pages, published posts of the API) in memory,
+// so a spike of anonymous readers costs one render per page and period. A page is fresh
+// for the configured CacheTTL, then served stale for up to CacheStale more while one
+// request renders it again in the background. Concurrent requests for a page that isn't
+// cached wait for a single render. Publishing and other changes to a tenant's public
+// posts expire its pages right away (see ItemChanged); only on the replica that made the
+// change, so other replicas catch up within CacheTTL.
+type PageCache struct {
+	ttl   time.Duration
+	stale time.Duration
+
+	views ViewCounter // Optional; see CountViews
+
+	mu      sync.Mutex
+	pages   map[string]*cachedPage
+	renders map[string]*pageRender // Keyed like pages
+	changes uint64                 // Count of ItemChanged calls, so renders overlapping one aren't cached
+}
+
+// NewPageCache creates the page cache for cfg. Share one between the blog, custom
+// domains and the API, so a change expires all their copies of a page.
+func NewPageCache(cfg *config.SiteConfig) *PageCache {
+	return &PageCache{ttl: cfg.CacheTTL, stale: cfg.CacheStale, pages: make(map[string]*cachedPage), renders: make(map[string]*pageRender)}
+}
+
+// CountViews has the views of post pages counted by views, cached or not. Call it before
+// serving requests.
+func (c *PageCache) CountViews(views ViewCounter) {
+	c.views = views
+}
+
+// CountView marks the page being written to w as showing the post postID, so each time
+// it's served counts as a view of the post.
+func CountView(w http.ResponseWriter, postID string) {
+	if rec, ok := w.(*recorder); ok {
+		rec.viewOf = postID
+	}
+}
+
+// Wrap serves next's successful responses from the cache, keyed by tenant, host and URL
+// (its path and pageParams).
+// Other responses (redirects, errors) are made every time.
+func (c *PageCache) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, "", next)
+	}
+}
+
+// cached serves next's successful responses from the page cache, keyed by tenant, host,
+// URL and the reader's languages.
+func (h *Handler) cached(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.cache.serve(w, r, strings.Join(requestLanguages(r), ","), next)
+	}
+}
+
+// serve answers r from the cache entry of its tenant, host and URL, plus variant,
+// rendering it with next if there is none.
+func (c *PageCache) serve(w http.ResponseWriter, r *http.Request, variant string, next http.HandlerFunc) {
+	if c.ttl <= 0 {
+		c.write(w, r, c.record(r, next)) // Not kept, but recorded to count the view
+		return
+	}
+	key := tenant.ID(r.Context()) + "\x00" + r.Host + pageURI(r.URL) + "\x00" + variant
+	now := time.Now()
+	c.mu.Lock()
+	p := c.pages[key]
+	if p != nil && !now.Before(p.expires) {
+		p = nil
+	}
+	stale := p != nil && !now.Before(p.fresh)
+	c.mu.Unlock()
+	if p != nil {
+		if stale {
+			c.revalidate(key, r, next)
+		}
+		c.write(w, r, p)
+		return
+	}
+
+	p = c.render(r.Context(), key, r, next)
+	if p == nil {
+		p = c.record(r, next) // Gave up waiting for another request's render
+	}
+	c.write(w, r, p)
+}
+
+// pageURI is the path and query of u, keeping only the pageParams, in order.
+func pageURI(u *url.URL) string {
+	query := u.Query()
+	params := make(url.Values)
+	for _, name := range pageParams {
+		if value := query.Get(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+	if len(params) == 0 {
+		return u.EscapedPath()
+	}
+	return u.EscapedPath() + "?" + params.Encode()
+}
+
+// write answers r with p, counting it as a view of the post it shows.
+func (c *PageCache) write(w http.ResponseWriter, r *http.Request, p *cachedPage) {
+	writeCachedPage(w, r, p)
+	if c.views != nil && p.viewOf != "" && p.status == http.StatusOK {
+		c.views.RecordPublicView(r.Context(), p.viewOf, middleware.ViewerKey(r))
+	}
+}
+
+// render renders the page at key with next, or waits for the render another request
+// already started. It returns nil if ctx ends first.
+func (c *PageCache) render(ctx context.Context, key string, r *http.Request, next http.HandlerFunc) *cachedPage {
+	c.mu.Lock()
+	if pending := c.renders[key]; pending != nil {
+		c.mu.Unlock()
+		select {
+		case <-pending.done:
+			return pending.page
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	pending := &pageRender{done: make(chan struct{})}
+	c.renders[key] = pending
+	changes := c.changes
+	c.mu.Unlock()
+
+	pending.page = c.record(r, next)
+	c.mu.Lock()
+	delete(c.renders, key)
+	if pending.page.status == http.StatusOK && c.changes == changes {
+		c.put(key, pending.page)
+	}
+	c.mu.Unlock()
+	close(pending.done)
+	return pending.page
+}
+
+// revalidate renders the stale page at key again in the background, unless that is
+// already under way. A server error keeps the stale page until it expires; any other
+// answer replaces it, or drops it if it isn't cacheable (e.g. the post is gone).
+func (c *PageCache) revalidate(key string, r *http.Request, next http.HandlerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.renders[key] != nil {
+		return
+	}
+	pending := &pageRender{done: make(chan struct{})}
+	c.renders[key] = pending
+	changes := c.changes
+
+	// Detached from the reader, who has been answered already
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	r.Header.Del("If-None-Match")
+	go func() {
+		pending.page = c.record(r, next)
+		c.mu.Lock()
+		delete(c.renders, key)
+		switch status := pending.page.status; {
+		case c.changes != changes:
+			// Rendered from before a change; the page stays stale for the next reader
+		case status == http.StatusOK:
+			c.put(key, pending.page)
+		case status < http.StatusInternalServerError:
+			delete(c.pages, key)
+		}
+		c.mu.Unlock()
+		close(pending.done)
+	}()
+}
+
+// record makes next's response to r into a page. A panic is answered with 500 rather
+// than left to net/http, since background renders have no server goroutine to catch it.
+func (c *PageCache) record(r *http.Request, next http.HandlerFunc) (page *cachedPage) {
+	rec := &recorder{header: make(http.Header), status: http.StatusOK}
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(r.Context(), "Panic rendering page", "path", r.URL.Path, "panic", v)
+			page = &cachedPage{status: http.StatusInternalServerError, header: make(http.Header), body: []byte("Internal server error\n")}
+		}
+	}()
+	next(rec, r)
+	sum := sha256.Sum256(rec.body.Bytes())
+	now := time.Now()
+	return &cachedPage{
+		status:   rec.status,
+		header:   rec.header,
+		body:     rec.body.Bytes(),
+		etag:     `"` + hex.EncodeToString(sum[:16]) + `"`,
+		tenantID: tenant.ID(r.Context()),
+		viewOf:   rec.viewOf,
+		fresh:    now.Add(c.ttl),
+		expires:  now.Add(c.ttl + c.stale),
+	}
+}
+
+// put caches p at key. Call it with c.mu held.
+func (c *PageCache) put(key string, p *cachedPage) {
+	if len(c.pages) >= maxCachedPages {
+		now := time.Now()
+		for k, cached := range c.pages {
+			if now.After(cached.expires) {
+				delete(c.pages, k)
+			}
+		}
+		if len(c.pages) >= maxCachedPages {
+			c.pages = make(map[string]*cachedPage)
+		}
+	}
+	c.pages[key] = p
+}
+
+// ItemChanged is a service.ItemHook expiring the pages of the changed post's tenant,
+// since any of them may list it. They are revalidated as readers come, except after a
+// post is taken down (deleted, archived or unpublished): those pages are dropped, so it
+// isn't served again while they render.
+func (c *PageCache) ItemChanged(ctx context.Context, ev service.ItemEvent) {
+	if ev.ItemType != string(models.ItemTypePost) {
+		return
+	}
+	drop := false
+	switch ev.Action {
+	case models.ActionPublish, models.ActionSlug, models.ActionAuthors, models.ActionRestore, models.ActionUnarchive, models.ActionTransfer,
+		models.ActionSettings:
+	case models.ActionDelete, models.ActionArchive, models.ActionUnpublish:
+		drop = true
+	default:
+		return // Drafts and snapshots aren't public
+	}
+
+	tenantID := tenant.ID(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changes++
+	for key, p := range c.pages {
+		switch {
+		case p.tenantID != tenantID:
+		case drop:
+			delete(c.pages, key)
+		default:
+			p.fresh = time.Time{}
+		}
+	}
+}
+
+func writeCachedPage(w http.ResponseWriter, r *http.Request, p *cachedPage) {
+	for name, values := range p.header {
+		w.Header()[name] = values
+	}
+	if p.status == http.StatusOK && notModified(w, r, p.etag) {
+		return
+	}
+	w.WriteHeader(p.status)
+	_, _ = w.Write(p.body)
+}
+
+// recorder captures a response for the page cache.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	viewOf string
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) { rec.status = status }
+
+func (rec *recorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
@@ -0,0 +1,130 @@
+// internal/site/domains.go
+package site
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/logging"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// domainCacheTTL is how long the domain served at a host is remembered, including that
+	// there is none: a newly verified (or unverified) domain can take that long to show.
+	domainCacheTTL = time.Minute
+	// lookupFailureTTL is how long a host whose lookup failed is taken not to be a domain,
+	// so a database outage doesn't cost a query per request.
+	lookupFailureTTL = 5 * time.Second
+	// maxCachedDomains bounds the cache of verified domains, and maxUnknownHosts that of
+	// hosts that aren't; past its bound, either starts over. They are kept apart so that
+	// requests for made-up hosts only push out each other.
+	maxCachedDomains = 10000
+	maxUnknownHosts  = 10000
+)
+
+type domainKey struct{}
+
+// blogDomain returns the custom domain the request in ctx came in at, or nil.
+func blogDomain(ctx context.Context) *models.Domain {
+	domain, _ := ctx.Value(domainKey{}).(*models.Domain)
+	return domain
+}
+
+// userID returns whose blog the request is for: the owner of its custom domain, else
+// the configured user.
+func (h *Handler) userID(r *http.Request) string {
+	if domain := blogDomain(r.Context()); domain != nil {
+		return domain.UserID
+	}
+	return h.cfg.UserID
+}
+
+type cachedDomain struct {
+	domain  *models.Domain
+	expires time.Time
+}
+
+// domainRouter sends requests for verified custom domains to their owner's blog.
+type domainRouter struct {
+	service *service.Service
+	blog    http.Handler
+	next    http.Handler
+
+	mu      sync.Mutex
+	domains map[string]cachedDomain // Verified domains, keyed by Host header
+	unknown map[string]time.Time    // Hosts that aren't, until when they're remembered
+}
+
+// CustomDomains serves the blogs of users' verified custom domains: a request for one of
+// them goes to its owner's blog, in their tenant, and any other to next. Only the blog's
+// pages are served at a custom domain, not the API. It goes before the tenant middleware,
+// which would resolve a custom domain to the default tenant.
+func CustomDomains(s *service.Service, cfg *config.SiteConfig, themes *Themes, pages *PageCache, next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	NewHandler(s, cfg, themes, pages).routes(mux)
+	return &domainRouter{
+		service: s, blog: mux, next: next,
+		domains: make(map[string]cachedDomain),
+		unknown: make(map[string]time.Time),
+	}
+}
+
+func (d *domainRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	domain := d.lookup(r)
+	if domain == nil {
+		d.next.ServeHTTP(w, r)
+		return
+	}
+	ctx := context.WithValue(r.Context(), domainKey{}, domain)
+	ctx = tenant.WithID(ctx, domain.TenantID)
+	ctx = logging.WithTenantID(ctx, domain.TenantID)
+	d.blog.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// lookup returns the verified domain the request is for, or nil. If that can't be found
+// out, the request is taken not to be for one.
+func (d *domainRouter) lookup(r *http.Request) *models.Domain {
+	host := strings.ToLower(r.Host)
+	now := time.Now()
+	d.mu.Lock()
+	cached, ok := d.domains[host]
+	unknownUntil, unknown := d.unknown[host]
+	d.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.domain
+	}
+	if unknown && now.Before(unknownUntil) {
+		return nil
+	}
+
+	domain, err := d.service.GetVerifiedDomain(r.Context(), host)
+	ttl := domainCacheTTL
+	if err != nil && !errors.Is(err, service.ErrDomainNotFound) {
+		slog.WarnContext(r.Context(), "Failed to look up custom domain", "host", host, "error", err)
+		domain, ttl = nil, lookupFailureTTL
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if domain == nil {
+		delete(d.domains, host)
+		if len(d.unknown) >= maxUnknownHosts {
+			d.unknown = make(map[string]time.Time)
+		}
+		d.unknown[host] = now.Add(ttl)
+		return nil
+	}
+	delete(d.unknown, host)
+	if len(d.domains) >= maxCachedDomains {
+		d.domains = make(map[string]cachedDomain)
+	}
+	d.domains[host] = cachedDomain{domain: domain, expires: now.Add(ttl)}
+	return domain
+}
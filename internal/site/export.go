@@ -0,0 +1,372 @@
+// internal/site/export.go
+package site
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of a static export
+const (
+	FormatHugo   = "hugo"   // content/posts/<slug>.md with YAML front-matter, covers in static/
+	FormatJekyll = "jekyll" // _posts/<date>-<slug>.md with YAML front-matter, covers in assets/
+	FormatHTML   = "html"   // The pages the server renders, as index.html files
+)
+
+var ErrUnknownFormat = errors.New("format must be hugo, jekyll or html")
+
+// ExportOptions describes a static export.
+type ExportOptions = models.StaticSiteOptions
+
+// ExportResult summarizes a static export.
+type ExportResult struct {
+	Format string `json:"format"`
+	Posts  int    `json:"posts"`
+	Covers int    `json:"covers"`
+	Files  int    `json:"files"`
+}
+
+// Export writes userID's published posts to w as a zip archive of a static site in
+// opts.Format: sources for the Hugo or Jekyll site generators, or plain HTML pages ready
+// to serve, in one of themes along with its static files. Links in the HTML pages are
+// relative to the site's root, as on the server. Drafts, archived posts and posts without
+// a slug are left out, as from the blog.
+func Export(ctx context.Context, s *service.Service, themes *Themes, userID string, opts ExportOptions, w io.Writer) (*ExportResult, error) {
+	if err := CheckExportOptions(themes, opts); err != nil {
+		return nil, err
+	}
+	if opts.Title == "" {
+		opts.Title = userID
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if opts.Theme == "" {
+		var err error
+		if opts.Theme, err = s.GetSiteTheme(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	timezone, err := s.GetTimezone(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &exporter{
+		service: s, userID: userID, opts: opts, theme: themes.Get(opts.Theme), zone: timezone,
+		zw: zip.NewWriter(w), result: &ExportResult{Format: opts.Format},
+	}
+	err = s.ForEachPublishedPost(ctx, userID, func(post *models.PublishedPost) error {
+		return e.addPost(ctx, post)
+	})
+	if err == nil {
+		err = e.finish()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := e.zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return e.result, nil
+}
+
+// Builder returns the builder of static site exports for s: Export, with themes.
+func Builder(s *service.Service, themes *Themes) service.StaticSiteBuilder {
+	return func(ctx context.Context, userID string, opts ExportOptions, w io.Writer) error {
+		_, err := Export(ctx, s, themes, userID, opts, w)
+		return err
+	}
+}
+
+// CheckExportOptions returns ErrUnknownFormat or service.ErrUnknownTheme if opts asks
+// for a format or theme that doesn't exist.
+func CheckExportOptions(themes *Themes, opts ExportOptions) error {
+	switch opts.Format {
+	case FormatHugo, FormatJekyll, FormatHTML:
+	default:
+		return ErrUnknownFormat
+	}
+	if opts.Theme != "" && themes.Get(opts.Theme).Name != opts.Theme {
+		return service.ErrUnknownTheme
+	}
+	return nil
+}
+
+type exporter struct {
+	service *service.Service
+	userID  string
+	opts    ExportOptions
+	theme   *Theme
+	zone    string // The user's time zone, which dates are in
+	zw      *zip.Writer
+	result  *ExportResult
+	posts   []models.PublicPostSummary // For the HTML index and tag pages
+}
+
+func (e *exporter) addPost(ctx context.Context, post *models.PublishedPost) error {
+	published := time.Now().UTC()
+	if post.PublishedAt != nil {
+		published = *post.PublishedAt
+	}
+
+	// The cover image goes next to the post's files, under its slug
+	coverDir := map[string]string{FormatHugo: "static/images/covers", FormatJekyll: "assets/covers", FormatHTML: "posts/" + post.Slug}[e.opts.Format]
+	coverName, err := e.addCover(ctx, post, coverDir)
+	if err != nil {
+		return err
+	}
+	coverURL := ""
+	if coverName != "" {
+		coverURL = "/" + strings.TrimPrefix(path.Join(coverDir, coverName), "static/")
+	}
+
+	switch e.opts.Format {
+	case FormatHugo:
+		fields := e.frontMatter(post, published, coverURL)
+		fields = append(fields, [2]string{"slug", yamlString(post.Slug)}, [2]string{"draft", "false"})
+		if post.Language != "" { // Hugo links the variants of a post by their translation key
+			key := post.TranslationOf
+			if key == "" {
+				key = post.PostID
+			}
+			fields = append(fields, [2]string{"translationKey", yamlString(key)})
+		}
+		err = e.writeFile(path.Join("content/posts", post.Slug+".md"), markdownFile(fields, post.Content), published)
+	case FormatJekyll:
+		fields := append([][2]string{{"layout", "post"}}, e.frontMatter(post, published, coverURL)...)
+		fields = append(fields, [2]string{"permalink", yamlString("/posts/" + post.Slug + "/")})
+		err = e.writeFile(path.Join("_posts", published.Format("2006-01-02")+"-"+post.Slug+".md"), markdownFile(fields, post.Content), published)
+	case FormatHTML:
+		data := postPage(e.opts.Title, post, coverURL, e.absURL)
+		err = e.writePage(path.Join("posts", post.Slug, "index.html"), "post.html", data, published)
+		if !hasCanonicalVariant(post) { // A translation is listed as its canonical post
+			e.posts = append(e.posts, models.PublicPostSummary{
+				PostID: post.PostID, Title: post.Title, Slug: post.Slug, Excerpt: post.Excerpt,
+				Authors: post.Authors, Tags: post.Tags, CoverImage: post.CoverImage,
+				Language: post.Language, PublishedAt: post.PublishedAt,
+			})
+		}
+	}
+	if err != nil {
+		return err
+	}
+	e.result.Posts++
+	return nil
+}
+
+// frontMatter returns the front-matter fields Hugo and Jekyll have in common, as YAML.
+func (e *exporter) frontMatter(post *models.PublishedPost, published time.Time, coverURL string) [][2]string {
+	fields := [][2]string{
+		{"title", yamlString(post.Title)},
+		{"date", published.Format(time.RFC3339)},
+		{"authors", yamlList(post.Authors)},
+	}
+	if len(post.Tags) > 0 {
+		fields = append(fields, [2]string{"tags", yamlList(post.Tags)})
+	}
+	if post.Excerpt != "" {
+		fields = append(fields, [2]string{"summary", yamlString(post.Excerpt)})
+	}
+	if post.MetaDescription != "" {
+		fields = append(fields, [2]string{"description", yamlString(post.MetaDescription)})
+	}
+	if post.CanonicalURL != "" {
+		fields = append(fields, [2]string{"canonical_url", yamlString(post.CanonicalURL)})
+	}
+	if post.NoIndex {
+		fields = append(fields, [2]string{"noindex", "true"})
+	}
+	if post.Language != "" {
+		fields = append(fields, [2]string{"lang", yamlString(post.Language)})
+	}
+	if coverURL != "" {
+		if e.opts.Format == FormatHugo {
+			fields = append(fields, [2]string{"images", yamlList([]string{coverURL})}) // Hugo's Open Graph template reads images
+		} else {
+			fields = append(fields, [2]string{"image", yamlString(coverURL)})
+		}
+	}
+	return fields
+}
+
+// hasCanonicalVariant reports whether post is a translation whose canonical post is
+// published too.
+func hasCanonicalVariant(post *models.PublishedPost) bool {
+	for _, variant := range post.Translations {
+		if variant.Canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// addCover adds a post's cover image to dir and returns its file name, or "" if the post
+// has none (or it has been deleted since it was set).
+func (e *exporter) addCover(ctx context.Context, post *models.PublishedPost, dir string) (string, error) {
+	if post.CoverImage == "" {
+		return "", nil
+	}
+	download, err := e.service.GetPublicCoverImage(ctx, e.userID, post.Slug)
+	if errors.Is(err, service.ErrAssetNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read cover image of post %s: %w", post.PostID, err)
+	}
+	defer download.Body.Close()
+	content, err := io.ReadAll(download.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cover image of post %s: %w", post.PostID, err)
+	}
+
+	name := "cover" + path.Ext(download.FileName)
+	if e.opts.Format != FormatHTML {
+		name = post.Slug + path.Ext(download.FileName)
+	}
+	if err := e.writeFile(path.Join(dir, name), content, time.Now()); err != nil {
+		return "", err
+	}
+	e.result.Covers++
+	return name, nil
+}
+
+// finish writes the files that depend on every post: the site generator's configuration,
+// or the HTML index and tag pages.
+func (e *exporter) finish() error {
+	now := time.Now()
+	switch e.opts.Format {
+	case FormatHugo:
+		config := "title = " + strconv.Quote(e.opts.Title) + "\n"
+		if e.opts.BaseURL != "" {
+			config = "baseURL = " + strconv.Quote(e.opts.BaseURL+"/") + "\n" + config
+		}
+		if e.zone != "" {
+			config += "timeZone = " + strconv.Quote(e.zone) + "\n"
+		}
+		config += "\n[permalinks]\n  posts = \"/posts/:slug/\"\n"
+		return e.writeFile("hugo.toml", []byte(config), now)
+	case FormatJekyll:
+		config := "title: " + yamlString(e.opts.Title) + "\n"
+		if e.opts.BaseURL != "" {
+			config += "url: " + yamlString(e.opts.BaseURL) + "\n"
+		}
+		if e.zone != "" {
+			config += "timezone: " + yamlString(e.zone) + "\n"
+		}
+		return e.writeFile("_config.yml", []byte(config), now)
+	}
+
+	index := &page{Site: e.opts.Title, Posts: e.posts}
+	index.Head = head{Title: e.opts.Title, URL: e.absURL("/"), Type: "website"}
+	if err := e.writePage("index.html", "list.html", index, now); err != nil {
+		return err
+	}
+
+	tagged := make(map[string][]models.PublicPostSummary)
+	for _, post := range e.posts {
+		for _, tag := range post.Tags {
+			tagged[tag] = append(tagged[tag], post)
+		}
+	}
+	tags := make([]string, 0, len(tagged))
+	for tag := range tagged {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if strings.ContainsAny(tag, `/\`) || tag == "." || tag == ".." {
+			continue // Can't be a directory name; its links go nowhere
+		}
+		heading := "Posts tagged “" + tag + "”"
+		data := &page{Site: e.opts.Title, Heading: heading, Posts: tagged[tag]}
+		data.Head = head{Title: heading + " · " + e.opts.Title, URL: e.absURL("/tags/" + tag + "/"), Type: "website"}
+		if err := e.writePage(path.Join("tags", tag, "index.html"), "list.html", data, now); err != nil {
+			return err
+		}
+	}
+
+	missing := &page{Site: e.opts.Title}
+	missing.Head = head{Title: "Not found · " + e.opts.Title, Type: "website", NoIndex: true}
+	if err := e.writePage("404.html", "missing.html", missing, now); err != nil {
+		return err
+	}
+
+	if e.theme.static == nil {
+		return nil
+	}
+	return fs.WalkDir(e.theme.static, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(e.theme.static, name)
+		if err != nil {
+			return fmt.Errorf("failed to read theme file %s: %w", name, err)
+		}
+		return e.writeFile(path.Join("theme", name), content, now)
+	})
+}
+
+// absURL makes path absolute with the base URL, if there is one.
+func (e *exporter) absURL(path string) string {
+	return e.opts.BaseURL + path
+}
+
+// writePage renders the theme's template named tmpl into the file name.
+func (e *exporter) writePage(name, tmpl string, data *page, modTime time.Time) error {
+	var buf bytes.Buffer
+	if err := e.theme.page(tmpl).ExecuteTemplate(&buf, "layout", data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return e.writeFile(name, buf.Bytes(), modTime)
+}
+
+func (e *exporter) writeFile(name string, content []byte, modTime time.Time) error {
+	f, err := e.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	e.result.Files++
+	return nil
+}
+
+// markdownFile is a Markdown file with a YAML front-matter block of fields.
+func markdownFile(fields [][2]string, content string) []byte {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range fields {
+		b.WriteString(field[0] + ": " + field[1] + "\n")
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(content)
+	return []byte(b.String())
+}
+
+// yamlString quotes s for YAML; a JSON string is a valid YAML scalar.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// yamlList is values as a YAML flow sequence, which JSON arrays are.
+func yamlList(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	list, _ := json.Marshal(values)
+	return string(list)
+}
@@ -0,0 +1,380 @@
+// Package site serves one user's published posts as a server-rendered HTML blog: an
+// index, a page per post and a page per tag, with Open Graph and Twitter card metadata
+// for link previews. Pages come from the service layer, like the API's, and are cached
+// in memory for the configured time (see PageCache), so a popular post costs one render
+// per period.
+// Each user can pick a theme from those loaded at startup to restyle their pages, and
+// serve their blog at custom domains of their own (see CustomDomains).
+package site
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/markdown"
+	"github.com/kkuzar/blog_system/internal/models"
+	"github.com/kkuzar/blog_system/internal/service"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pageSize is how many posts the index and tag pages list.
+const pageSize = 10
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var funcs = template.FuncMap{
+	"postURL": func(slug string) string { return "/posts/" + slug },
+	"tagURL":  func(tag string) string { return "/tags/" + url.PathEscape(tag) },
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("January 2, 2006")
+	},
+	"isoDate": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339) // With the author's offset, as the date shows it
+	},
+}
+
+// Handler serves the blog's pages.
+type Handler struct {
+	service *service.Service
+	cfg     *config.SiteConfig
+	themes  *Themes
+	cache   *PageCache
+}
+
+// head is the metadata of a page's <head>: its title and description, and how search
+// engines and link previews should show it.
+type head struct {
+	Title       string
+	Description string
+	URL         string // Absolute canonical URL
+	Image       string // Absolute URL; empty for none
+	Type        string // Open Graph type: "website" or "article"
+	NoIndex     bool
+	PublishedAt *time.Time
+	Language    string      // Of the page's content; empty if unknown
+	Alternates  []alternate // The page in other languages, for hreflang links
+}
+
+// alternate is a version of a page in another language. Language is x-default for the
+// version to show readers none of the languages suits.
+type alternate struct {
+	Language string
+	URL      string // Absolute
+}
+
+// page is the data of every template; fields a page doesn't use are left empty.
+type page struct {
+	Site string // The blog's title
+	Head head
+
+	// Index and tag pages
+	Heading string // Empty on the index
+	Posts   []models.PublicPostSummary
+	PrevURL string
+	NextURL string
+
+	// Post pages
+	Post     *models.PublishedPost
+	Body     template.HTML
+	CoverURL string
+}
+
+// NewHandler serves cfg.UserID's blog from s, or on a custom domain its owner's, in the
+// theme they picked from themes, caching pages in pages.
+func NewHandler(s *service.Service, cfg *config.SiteConfig, themes *Themes, pages *PageCache) *Handler {
+	return &Handler{service: s, cfg: cfg, themes: themes, cache: pages}
+}
+
+// SetupRoutes adds the blog's pages to mux, at the root.
+func SetupRoutes(mux *http.ServeMux, s *service.Service, cfg *config.SiteConfig, themes *Themes, pages *PageCache) {
+	NewHandler(s, cfg, themes, pages).routes(mux)
+}
+
+func (h *Handler) routes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", h.cached(h.Index))
+	mux.HandleFunc("GET /tags/{tag}", h.cached(h.Tag))
+	mux.HandleFunc("GET /posts/{slug}", h.cached(h.Post))
+	mux.HandleFunc("GET /posts/{slug}/cover", h.Cover)
+	mux.HandleFunc("GET /theme/{path...}", h.ThemeFile)
+}
+
+// Index lists the latest posts, pageSize at a time (?page=2, ...).
+func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
+	h.writeList(w, r, "", "")
+}
+
+// Tag lists the posts with a tag.
+func (h *Handler) Tag(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+	h.writeList(w, r, tag, "Posts tagged “"+tag+"”")
+}
+
+// requestLanguages returns the reader's languages, most preferred first: those of ?lang=
+// if it is set, else of the Accept-Language header.
+func requestLanguages(r *http.Request) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		return service.ParseLanguages(lang)
+	}
+	return service.ParseLanguages(r.Header.Get("Accept-Language"))
+}
+
+func (h *Handler) writeList(w http.ResponseWriter, r *http.Request, tag, heading string) {
+	pageNum, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	w.Header().Set("Vary", "Accept-Language") // Each post is listed in the reader's language
+	posts, err := h.service.ListPublicPosts(r.Context(), h.userID(r), tag, requestLanguages(r), pageSize+1, (pageNum-1)*pageSize)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if tag != "" && len(posts) == 0 && pageNum == 1 {
+		h.writeNotFound(w, r)
+		return
+	}
+
+	data := page{Site: h.siteTitle(r), Heading: heading, Posts: posts}
+	data.Head = head{Title: data.Site, URL: h.absURL(r, r.URL.Path), Type: "website"}
+	if heading != "" {
+		data.Head.Title = heading + " · " + data.Site
+	}
+	pageURL := func(n int) string {
+		query := url.Values{}
+		if n > 1 {
+			query.Set("page", strconv.Itoa(n))
+		}
+		if lang := r.URL.Query().Get("lang"); lang != "" {
+			query.Set("lang", lang)
+		}
+		if len(query) == 0 {
+			return r.URL.Path
+		}
+		return r.URL.Path + "?" + query.Encode()
+	}
+	if len(posts) > pageSize {
+		data.Posts = posts[:pageSize]
+		data.NextURL = pageURL(pageNum + 1)
+	}
+	if pageNum > 1 {
+		data.PrevURL = pageURL(pageNum - 1)
+	}
+	if pageNum > 1 {
+		data.Head.URL += "?page=" + strconv.Itoa(pageNum)
+	}
+	h.render(w, r, "list.html", http.StatusOK, &data)
+}
+
+// Post shows a published post. A former slug is redirected to the current one.
+func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
+	published, movedTo, err := h.service.GetPublicPost(r.Context(), h.userID(r), r.PathValue("slug"), true)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if movedTo != "" {
+		w.Header().Set("Cache-Control", "no-cache") // A later rename may point the slug elsewhere
+		http.Redirect(w, r, "/posts/"+movedTo, http.StatusMovedPermanently)
+		return
+	}
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if variant := service.PreferredVariant(published, service.ParseLanguages(lang)); variant != nil {
+			http.Redirect(w, r, "/posts/"+variant.Slug, http.StatusFound)
+			return
+		}
+	}
+
+	coverURL := ""
+	if published.CoverImage != "" {
+		coverURL = "/posts/" + published.Slug + "/cover"
+	}
+	data := postPage(h.siteTitle(r), published, coverURL, func(path string) string { return h.absURL(r, path) })
+	if published.NoIndex {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+	if published.Language != "" {
+		w.Header().Set("Content-Language", published.Language)
+	}
+	CountView(w, published.PostID)
+	h.render(w, r, "post.html", http.StatusOK, data)
+}
+
+// postPage is the data of a post's page. coverURL is where its cover image is served, if
+// it has one, and absURL makes a path absolute.
+func postPage(site string, published *models.PublishedPost, coverURL string, absURL func(path string) string) *page {
+	data := &page{Site: site, Post: published, Body: template.HTML(markdown.Render(published.Content)), CoverURL: coverURL}
+	data.Head = head{
+		Title:       published.Title + " · " + site,
+		Description: published.MetaDescription,
+		URL:         published.CanonicalURL,
+		Type:        "article",
+		NoIndex:     published.NoIndex,
+		PublishedAt: published.PublishedAt,
+		Language:    published.Language,
+	}
+	if data.Head.URL == "" {
+		data.Head.URL = absURL("/posts/" + published.Slug)
+	}
+	if len(published.Translations) > 0 {
+		self := alternate{Language: published.Language, URL: absURL("/posts/" + published.Slug)}
+		data.Head.Alternates = append(data.Head.Alternates, self)
+		canonical := self
+		for _, variant := range published.Translations {
+			data.Head.Alternates = append(data.Head.Alternates, alternate{Language: variant.Language, URL: absURL("/posts/" + variant.Slug)})
+			if variant.Canonical {
+				canonical = data.Head.Alternates[len(data.Head.Alternates)-1]
+			}
+		}
+		data.Head.Alternates = append(data.Head.Alternates, alternate{Language: "x-default", URL: canonical.URL})
+	}
+	if coverURL != "" {
+		data.Head.Image = absURL(coverURL)
+	}
+	return data
+}
+
+// Cover streams a post's cover image.
+func (h *Handler) Cover(w http.ResponseWriter, r *http.Request) {
+	download, err := h.service.GetPublicCoverImage(r.Context(), h.userID(r), r.PathValue("slug"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	defer download.Body.Close()
+
+	if download.ContentHash != "" {
+		etag := `"` + download.ContentHash + "." + strconv.Itoa(download.Version) + `"`
+		if notModified(w, r, etag) {
+			return
+		}
+	}
+	w.Header().Set("Content-Type", download.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(download.Size, 10))
+	w.Header().Set("Cache-Control", h.cacheControl())
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, download.Body); err != nil {
+		slog.WarnContext(r.Context(), "Download interrupted", "path", r.URL.Path, "error", err)
+	}
+}
+
+// ThemeFile serves a static file of the blog's theme.
+func (h *Handler) ThemeFile(w http.ResponseWriter, r *http.Request) {
+	theme := h.theme(r)
+	name := r.PathValue("path")
+	if theme.static == nil || name == "" || strings.HasSuffix(name, "/") {
+		h.writeNotFound(w, r)
+		return
+	}
+	if info, err := fs.Stat(theme.static, name); err != nil || info.IsDir() {
+		h.writeNotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", h.cacheControl())
+	http.ServeFileFS(w, r, theme.static, name)
+}
+
+// theme returns the theme the blog's user picked. If that can't be found out, the page
+// is still served, in the built-in theme.
+func (h *Handler) theme(r *http.Request) *Theme {
+	userID := h.userID(r)
+	name, err := h.service.GetSiteTheme(r.Context(), userID)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to get site theme, using the default", "userID", userID, "error", err)
+	}
+	return h.themes.Get(name)
+}
+
+// render executes the theme's template named name into the response. It is rendered to a
+// buffer first, so a template error can still be answered with 500.
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, name string, status int, data *page) {
+	var buf bytes.Buffer
+	if err := h.theme(r).page(name).ExecuteTemplate(&buf, "layout", data); err != nil {
+		slog.ErrorContext(r.Context(), "Error rendering page", "path", r.URL.Path, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if status == http.StatusOK {
+		w.Header().Set("Cache-Control", h.cacheControl())
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrItemNotFound) || errors.Is(err, service.ErrAssetNotFound) {
+		h.writeNotFound(w, r)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func (h *Handler) writeNotFound(w http.ResponseWriter, r *http.Request) {
+	data := page{Site: h.siteTitle(r)}
+	data.Head = head{Title: "Not found · " + data.Site, Type: "website", NoIndex: true}
+	h.render(w, r, "missing.html", http.StatusNotFound, &data)
+}
+
+func (h *Handler) siteTitle(r *http.Request) string {
+	if domain := blogDomain(r.Context()); domain != nil {
+		return domain.UserID
+	}
+	if h.cfg.Title != "" {
+		return h.cfg.Title
+	}
+	return h.cfg.UserID
+}
+
+func (h *Handler) cacheControl() string {
+	if h.cfg.CacheTTL <= 0 {
+		return "no-cache"
+	}
+	cacheControl := "public, max-age=" + strconv.Itoa(int(h.cfg.CacheTTL.Seconds()))
+	if h.cfg.CacheStale > 0 {
+		cacheControl += ", stale-while-revalidate=" + strconv.Itoa(int(h.cfg.CacheStale.Seconds()))
+	}
+	return cacheControl
+}
+
+// absURL makes path absolute with the configured base URL, else (and on custom domains)
+// the request's own scheme and host.
+func (h *Handler) absURL(r *http.Request, path string) string {
+	if h.cfg.BaseURL != "" && blogDomain(r.Context()) == nil {
+		return h.cfg.BaseURL + path
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+// notModified sets the response's ETag and reports whether the client already has that
+// representation (If-None-Match), in which case it has been answered with 304.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// internal/site/themes.go
+package site
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+)
+
+var themeName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// themePages are the templates of the pages, each executed with the layout.
+var themePages = []string{"list.html", "post.html", "missing.html"}
+
+// builtinTheme is the theme of users who haven't picked one. Its templates are embedded,
+// so failing to parse them is a bug.
+var builtinTheme = mustLoadTheme("", nil)
+
+func mustLoadTheme(name string, files fs.FS) *Theme {
+	theme, err := loadTheme(name, files)
+	if err != nil {
+		panic(err)
+	}
+	return theme
+}
+
+// Theme is a set of page templates and static files, loaded from a directory. Each of
+// the templates (layout.html, list.html, post.html and missing.html) the directory has
+// replaces the built-in one, so a theme can restyle the layout alone; they get the same
+// data and functions. Files under static/ are served at /theme/ and copied into HTML
+// exports.
+type Theme struct {
+	Name   string // Empty for the built-in theme
+	pages  map[string]*template.Template
+	static fs.FS // Nil without static files
+}
+
+func (t *Theme) page(name string) *template.Template {
+	return t.pages[name]
+}
+
+// loadTheme parses a theme's templates over the built-in ones. files is nil for the
+// built-in theme.
+func loadTheme(name string, files fs.FS) (*Theme, error) {
+	theme := &Theme{Name: name, pages: make(map[string]*template.Template)}
+	for _, page := range themePages {
+		tmpl, err := template.New(page).Funcs(funcs).ParseFS(templateFiles, "templates/layout.html", "templates/"+page)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range []string{"layout.html", page} {
+			if files == nil {
+				break
+			}
+			if _, err := fs.Stat(files, file); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if tmpl, err = tmpl.ParseFS(files, file); err != nil {
+				return nil, fmt.Errorf("theme %s: %w", name, err)
+			}
+		}
+		theme.pages[page] = tmpl
+	}
+	if files != nil {
+		if info, err := fs.Stat(files, "static"); err == nil && info.IsDir() {
+			theme.static, _ = fs.Sub(files, "static")
+		}
+	}
+	return theme, nil
+}
+
+// Themes are the themes users can pick from.
+type Themes struct {
+	byName map[string]*Theme
+}
+
+// LoadThemes loads each directory in dir as a theme named after it. An empty dir has no
+// themes but the built-in one. Directories whose names aren't theme names (lowercase
+// letters, digits, - and _) are skipped; a theme that fails to parse is an error.
+func LoadThemes(dir string) (*Themes, error) {
+	themes := &Themes{byName: make(map[string]*Theme)}
+	if dir == "" {
+		return themes, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read themes directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if !themeName.MatchString(entry.Name()) {
+			slog.Warn("Skipping theme with an invalid name", "theme", entry.Name())
+			continue
+		}
+		theme, err := loadTheme(entry.Name(), os.DirFS(dir+"/"+entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		themes.byName[theme.Name] = theme
+	}
+	return themes, nil
+}
+
+// Names returns the names of the themes, sorted.
+func (t *Themes) Names() []string {
+	if t == nil {
+		return nil
+	}
+	names := make([]string, 0, len(t.byName))
+	for name := range t.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the named theme, or the built-in one if name is empty or unknown.
+func (t *Themes) Get(name string) *Theme {
+	if t != nil {
+		if theme := t.byName[name]; theme != nil {
+			return theme
+		}
+	}
+	return builtinTheme
+}
@@ -0,0 +1,66 @@
+// internal/spam/akismet.go
+package spam
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const akismetEndpoint = "https://rest.akismet.com/1.1/comment-check"
+
+// Akismet checks submissions with the Akismet service.
+type Akismet struct {
+	key      string
+	site     string // The blog's address, as registered with the key
+	endpoint string
+	client   *http.Client
+}
+
+func NewAkismet(key, siteURL string) *Akismet {
+	return &Akismet{key: key, site: siteURL, endpoint: akismetEndpoint, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// IsSpam asks Akismet whether sub is spam. Akismet answers "true" or "false"; anything
+// else is an error, with its reason in the X-akismet-debug-help header.
+func (a *Akismet) IsSpam(ctx context.Context, sub *Submission) (bool, error) {
+	form := url.Values{
+		"api_key":         {a.key},
+		"blog":            {a.site},
+		"user_ip":         {sub.UserIP},
+		"user_agent":      {sub.UserAgent},
+		"comment_type":    {sub.Type},
+		"comment_author":  {sub.AuthorID},
+		"comment_content": {sub.Content},
+		"blog_charset":    {"UTF-8"},
+	}
+	if sub.Permalink != "" {
+		form.Set("permalink", sub.Permalink)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("akismet request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return false, fmt.Errorf("failed to read akismet response: %w", err)
+	}
+	switch strings.TrimSpace(string(body)) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("akismet error (status %d): %s", resp.StatusCode, resp.Header.Get("X-akismet-debug-help"))
+}
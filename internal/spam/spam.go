@@ -0,0 +1,59 @@
+// Package spam checks what users submit, such as comments, with a spam filtering service.
+package spam
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/metrics"
+)
+
+var checks = metrics.Default.Counter("blog_spam_checks_total",
+	"Submissions checked for spam, by result: spam, ham or failed.", "result")
+
+// Submission is something a user wrote, with what the checker may weigh besides the text.
+type Submission struct {
+	Type      string // What it is, e.g. "comment"
+	Content   string
+	AuthorID  string
+	UserIP    string
+	UserAgent string
+	Permalink string // Optional: the page it appears on
+}
+
+// Checker decides whether submissions are spam.
+type Checker interface {
+	IsSpam(ctx context.Context, sub *Submission) (bool, error)
+}
+
+// NewChecker returns the checker cfg selects, or nil if spam checking is off.
+func NewChecker(cfg *config.CommentsConfig) (Checker, error) {
+	var checker Checker
+	switch cfg.SpamChecker {
+	case "":
+		return nil, nil
+	case "akismet":
+		checker = NewAkismet(cfg.AkismetKey, cfg.AkismetSiteURL)
+	default:
+		return nil, fmt.Errorf("unsupported spam checker %q", cfg.SpamChecker)
+	}
+	return counted{checker}, nil
+}
+
+// counted counts the results of a checker's checks.
+type counted struct {
+	Checker
+}
+
+func (c counted) IsSpam(ctx context.Context, sub *Submission) (bool, error) {
+	isSpam, err := c.Checker.IsSpam(ctx, sub)
+	switch {
+	case err != nil:
+		checks.Inc("failed")
+	case isSpam:
+		checks.Inc("spam")
+	default:
+		checks.Inc("ham")
+	}
+	return isSpam, err
+}
@@ -3,14 +3,16 @@ package storage
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
 	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/storage/local"
 	"github.com/kkuzar/blog_system/internal/storage/s3"
 	"io"
 )
 
-var ErrFileNotFound = errors.New("file not found")
-var ErrStorageConfig = errors.New("invalid storage configuration")
+var ErrFileNotFound = apperr.New(apperr.NotFound, "file not found")
+var ErrStorageConfig = apperr.New(apperr.Internal, "invalid storage configuration")
 
 // StorageAdapter defines the interface for file storage operations.
 type StorageAdapter interface {
@@ -18,6 +20,7 @@ type StorageAdapter interface {
 	DownloadFile(ctx context.Context, key string) (io.ReadCloser, error)
 	DeleteFile(ctx context.Context, key string) error
 	FileExists(ctx context.Context, key string) (bool, error)
+	CopyFile(ctx context.Context, srcKey, dstKey string) error // Server-side copy; returns ErrFileNotFound if srcKey is missing
 	// GetPresignedURL(ctx context.Context, key string, duration time.Duration) (string, error) // Optional: for direct browser uploads/downloads
 	Close() error // For any cleanup needed
 }
@@ -28,17 +31,22 @@ func NewStorageAdapter(cfg *config.StorageConfig) (StorageAdapter, error) {
 	case "s3":
 		if cfg.S3Bucket == "" || cfg.S3Region == "" {
 			// Only return error if S3 is selected but improperly configured
-			return nil, errors.New("S3 storage selected but S3_BUCKET_NAME or AWS_REGION is missing")
+			return nil, fmt.Errorf("%w: S3 storage selected but S3_BUCKET_NAME or AWS_REGION is missing", ErrStorageConfig)
 		}
 		return s3.NewS3Client(cfg)
-	// Add other storage types here (e.g., "local", "gcs")
+	case "local":
+		return local.NewLocalStorage(cfg.LocalDir)
+	case "memory":
+		// Files are lost on restart; for development (DEV_MODE) and tests
+		return local.NewMemoryStorage(), nil
+	// Add other storage types here (e.g., "gcs")
 	default:
 		// Only return error if a type is specified but not supported
 		if cfg.Type != "" {
-			return nil, errors.New("unsupported storage type: " + cfg.Type)
+			return nil, fmt.Errorf("%w: unsupported storage type %q", ErrStorageConfig, cfg.Type)
 		}
 		// If no storage type is configured, maybe return a nil adapter or a no-op one?
 		// For this project, storage is essential, so let's require it.
-		return nil, errors.New("STORAGE_TYPE must be configured (e.g., 's3')")
+		return nil, fmt.Errorf("%w: STORAGE_TYPE must be configured (e.g., 's3', 'local', 'memory')", ErrStorageConfig)
 	}
 }
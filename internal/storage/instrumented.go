@@ -0,0 +1,66 @@
+// internal/storage/instrumented.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"io"
+	"time"
+)
+
+// Instrument wraps storage so the latency and failures of every call are recorded in the
+// metrics registry, labelled with backend (the configured STORAGE_TYPE) and the method
+// called. ErrFileNotFound results don't count as failures. DownloadFile is timed until
+// the object starts streaming, not until it has been read.
+func Instrument(storage StorageAdapter, backend string) StorageAdapter {
+	return &instrumentedStorage{storage: storage, backend: backend}
+}
+
+type instrumentedStorage struct {
+	storage StorageAdapter
+	backend string
+}
+
+func (s *instrumentedStorage) observe(operation string, start time.Time, err error) {
+	metrics.ObserveCall("storage", s.backend, operation, start, err != nil && !errors.Is(err, ErrFileNotFound))
+}
+
+func (s *instrumentedStorage) Close() error {
+	return s.storage.Close()
+}
+
+func (s *instrumentedStorage) UploadFile(ctx context.Context, key string, body io.Reader, contentType string) error {
+	start := time.Now()
+	err := s.storage.UploadFile(ctx, key, body, contentType)
+	s.observe("UploadFile", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	start := time.Now()
+	body, err := s.storage.DownloadFile(ctx, key)
+	s.observe("DownloadFile", start, err)
+	return body, err
+}
+
+func (s *instrumentedStorage) DeleteFile(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.storage.DeleteFile(ctx, key)
+	s.observe("DeleteFile", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) FileExists(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	exists, err := s.storage.FileExists(ctx, key)
+	s.observe("FileExists", start, err)
+	return exists, err
+}
+
+func (s *instrumentedStorage) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	start := time.Now()
+	err := s.storage.CopyFile(ctx, srcKey, dstKey)
+	s.observe("CopyFile", start, err)
+	return err
+}
@@ -0,0 +1,191 @@
+// internal/storage/local/client.go
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/storage"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LocalStorage stores files under a directory on the local disk, one file per key. It
+// is meant for development and single-node setups.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a storage adapter rooted at dir, creating it if needed.
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if dir == "" {
+		return nil, errors.New("local storage directory is empty")
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local storage directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+// path maps key to a file under the root. Keys can't escape it: ".." elements are
+// resolved against the root as if it were "/".
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(key))
+	if cleaned == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, cleaned), nil
+}
+
+// UploadFile writes the file to a temporary name and renames it into place, so readers
+// never see a partial file.
+func (s *LocalStorage) UploadFile(ctx context.Context, key string, body io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write local file (key: %s): %w", key, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to write local file (key: %s): %w", key, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write local file (key: %s): %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write local file (key: %s): %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write local file (key: %s): %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local file (key: %s): %w", key, err)
+	}
+	return f, nil
+}
+
+func (s *LocalStorage) DeleteFile(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete local file (key: %s): %w", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.DownloadFile(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.UploadFile(ctx, dstKey, src, "")
+}
+
+func (s *LocalStorage) FileExists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check local file existence (key: %s): %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *LocalStorage) Close() error {
+	return nil
+}
+
+// MemoryStorage keeps files in process memory, so they are lost on restart. It is meant
+// for development and tests.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStorage) UploadFile(ctx context.Context, key string, body io.Reader, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read upload (key: %s): %w", key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[strings.TrimPrefix(key, "/")] = data
+	return nil
+}
+
+func (s *MemoryStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.files[strings.TrimPrefix(key, "/")]
+	if !ok {
+		return nil, storage.ErrFileNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil // Never modified in place, so safe to share
+}
+
+func (s *MemoryStorage) DeleteFile(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, strings.TrimPrefix(key, "/"))
+	return nil
+}
+
+func (s *MemoryStorage) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[strings.TrimPrefix(srcKey, "/")]
+	if !ok {
+		return storage.ErrFileNotFound
+	}
+	s.files[strings.TrimPrefix(dstKey, "/")] = data
+	return nil
+}
+
+func (s *MemoryStorage) FileExists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.files[strings.TrimPrefix(key, "/")]
+	return ok, nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/kkuzar/blog_system/internal/config"
 	"github.com/kkuzar/blog_system/internal/storage"
 	"io"
-	"log"
+	"log/slog"
 	"net/url"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -49,7 +49,7 @@ func NewS3Client(cfg *config.StorageConfig) (*S3Client, error) {
 		if endpointURL.Scheme == "" {
 			// Default to http if no scheme provided, adjust if needed
 			cfg.S3Endpoint = "http://" + cfg.S3Endpoint
-			log.Printf("S3 Endpoint missing scheme, defaulting to http: %s", cfg.S3Endpoint)
+			slog.Warn("S3 Endpoint missing scheme, defaulting to http", "endpoint", cfg.S3Endpoint)
 		}
 
 		resolver := s3.EndpointResolverFunc(func(region string, options s3.EndpointResolverOptions) (aws.Endpoint, error) {
@@ -113,7 +113,7 @@ func (s *S3Client) DeleteFile(ctx context.Context, key string) error {
 		// Check if the error is because the file doesn't exist, which might be okay for delete
 		var nsk *types.NoSuchKey
 		if errors.As(err, &nsk) {
-			log.Printf("Attempted to delete non-existent S3 key: %s", key)
+			slog.InfoContext(ctx, "Attempted to delete non-existent S3 key", "key", key)
 			return nil // Or return storage.ErrFileNotFound if needed upstream
 		}
 		return fmt.Errorf("failed to delete from S3 (bucket: %s, key: %s): %w", s.bucket, key, err)
@@ -121,6 +121,22 @@ func (s *S3Client) DeleteFile(ctx context.Context, key string) error {
 	return nil
 }
 
+func (s *S3Client) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(s.bucket + "/" + srcKey)),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return storage.ErrFileNotFound
+		}
+		return fmt.Errorf("failed to copy in S3 (bucket: %s, src: %s, dst: %s): %w", s.bucket, srcKey, dstKey, err)
+	}
+	return nil
+}
+
 func (s *S3Client) FileExists(ctx context.Context, key string) (bool, error) {
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -0,0 +1,50 @@
+// internal/storage/tenant.go
+package storage
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"io"
+)
+
+// ForTenants wraps s so the files of each tenant are kept under tenants/<tenantID>/,
+// the tenant being the one in the call's context. Calls without a tenant use keys as
+// given. Keys stored in the database stay unprefixed, so data can move between tenants.
+func ForTenants(s StorageAdapter) StorageAdapter {
+	return &tenantStorage{s: s}
+}
+
+type tenantStorage struct {
+	s StorageAdapter
+}
+
+func tenantKey(ctx context.Context, key string) string {
+	if tenantID := tenant.ID(ctx); tenantID != "" {
+		return "tenants/" + tenantID + "/" + key
+	}
+	return key
+}
+
+func (t *tenantStorage) UploadFile(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return t.s.UploadFile(ctx, tenantKey(ctx, key), body, contentType)
+}
+
+func (t *tenantStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	return t.s.DownloadFile(ctx, tenantKey(ctx, key))
+}
+
+func (t *tenantStorage) DeleteFile(ctx context.Context, key string) error {
+	return t.s.DeleteFile(ctx, tenantKey(ctx, key))
+}
+
+func (t *tenantStorage) FileExists(ctx context.Context, key string) (bool, error) {
+	return t.s.FileExists(ctx, tenantKey(ctx, key))
+}
+
+func (t *tenantStorage) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	return t.s.CopyFile(ctx, tenantKey(ctx, srcKey), tenantKey(ctx, dstKey))
+}
+
+func (t *tenantStorage) Close() error {
+	return t.s.Close()
+}
@@ -0,0 +1,74 @@
+// internal/storage/timeout.go
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// WithTimeout wraps storage so every call gives up after timeout, so slow or unreachable
+// storage fails the operation with context.DeadlineExceeded instead of hanging it. For
+// DownloadFile the deadline covers reading the object too. A timeout of 0 returns
+// storage unchanged.
+func WithTimeout(storage StorageAdapter, timeout time.Duration) StorageAdapter {
+	if timeout <= 0 {
+		return storage
+	}
+	return &timeoutStorage{storage: storage, timeout: timeout}
+}
+
+type timeoutStorage struct {
+	storage StorageAdapter
+	timeout time.Duration
+}
+
+func (s *timeoutStorage) Close() error {
+	return s.storage.Close()
+}
+
+func (s *timeoutStorage) UploadFile(ctx context.Context, key string, body io.Reader, contentType string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.storage.UploadFile(ctx, key, body, contentType)
+}
+
+func (s *timeoutStorage) DownloadFile(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	body, err := s.storage.DownloadFile(ctx, key)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelOnClose{ReadCloser: body, cancel: cancel}, nil
+}
+
+func (s *timeoutStorage) DeleteFile(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.storage.DeleteFile(ctx, key)
+}
+
+func (s *timeoutStorage) FileExists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.storage.FileExists(ctx, key)
+}
+
+func (s *timeoutStorage) CopyFile(ctx context.Context, srcKey, dstKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.storage.CopyFile(ctx, srcKey, dstKey)
+}
+
+// cancelOnClose releases a download's deadline once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
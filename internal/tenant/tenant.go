@@ -0,0 +1,108 @@
+// Package tenant carries the tenant a request acts for. With multi-tenancy enabled one
+// deployment serves several isolated organizations: each tenant has its own database
+// namespace, cache keys and storage prefix, picked by the tenant in the context. Without
+// it the tenant is always "" and nothing is scoped.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"github.com/kkuzar/blog_system/internal/config"
+	"net"
+	"regexp"
+	"strings"
+)
+
+type contextKey struct{}
+
+// validID keeps tenant IDs safe to use in database and table names, cache keys and
+// storage paths.
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidID reports whether id can name a tenant.
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// WithID returns a context acting for the tenant id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns the tenant ctx acts for, or "" if none.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Resolver finds the tenant served at a host name.
+type Resolver struct {
+	known      map[string]bool
+	hosts      map[string]string
+	baseDomain string
+	fallback   string
+}
+
+// NewResolver creates a resolver for the tenants in cfg.
+func NewResolver(cfg *config.TenancyConfig) (*Resolver, error) {
+	r := &Resolver{
+		known:      make(map[string]bool),
+		hosts:      make(map[string]string),
+		baseDomain: strings.ToLower(strings.TrimPrefix(cfg.BaseDomain, ".")),
+		fallback:   cfg.Default,
+	}
+	for _, id := range cfg.Tenants {
+		if !ValidID(id) {
+			return nil, fmt.Errorf("invalid tenant ID %q (want lower-case letters, digits and hyphens)", id)
+		}
+		r.known[id] = true
+	}
+	for host, id := range cfg.Hosts {
+		if !r.known[id] {
+			return nil, fmt.Errorf("host %s is mapped to unknown tenant %q", host, id)
+		}
+		r.hosts[strings.ToLower(host)] = id
+	}
+	if r.fallback != "" && !r.known[r.fallback] {
+		return nil, fmt.Errorf("default tenant %q is not a known tenant", r.fallback)
+	}
+	return r, nil
+}
+
+// Known reports whether id is one of the configured tenants.
+func (r *Resolver) Known(id string) bool {
+	return r.known[id]
+}
+
+// Tenants returns the IDs of the configured tenants.
+func (r *Resolver) Tenants() []string {
+	ids := make([]string, 0, len(r.known))
+	for id := range r.known {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Default returns the tenant of requests no host or token resolves, or "".
+func (r *Resolver) Default() string {
+	return r.fallback
+}
+
+// FromHost returns the tenant served at host (a Host header; any port is ignored): the
+// one it's mapped to, or the tenant named by its first label under the base domain.
+// It returns "" if there is none.
+func (r *Resolver) FromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if id, ok := r.hosts[host]; ok {
+		return id
+	}
+	if r.baseDomain != "" {
+		if sub, ok := strings.CutSuffix(host, "."+r.baseDomain); ok && r.known[sub] {
+			return sub
+		}
+	}
+	return ""
+}
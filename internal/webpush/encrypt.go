@@ -0,0 +1,110 @@
+// internal/webpush/encrypt.go
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	recordSize = 4096 // Of the single aes128gcm record a message is sent in
+	headerSize = 16 + 4 + 1 + 65
+	// MaxPayload is the largest payload that fits the one record push services accept:
+	// the record less its header, the GCM tag and the padding delimiter.
+	MaxPayload = recordSize - headerSize - 16 - 1
+)
+
+var errInvalidKeys = errors.New("subscription keys must be a base64url P-256 public key (p256dh) and 16-byte secret (auth)")
+
+// decodeKey decodes a key as browsers give it: base64url, usually without padding.
+func decodeKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// subscriptionKeys decodes and checks a subscription's public key and auth secret.
+func subscriptionKeys(p256dh, auth string) (*ecdh.PublicKey, []byte, error) {
+	public, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, nil, errInvalidKeys
+	}
+	key, err := ecdh.P256().NewPublicKey(public)
+	if err != nil {
+		return nil, nil, errInvalidKeys
+	}
+	secret, err := decodeKey(auth)
+	if err != nil || len(secret) != 16 {
+		return nil, nil, errInvalidKeys
+	}
+	return key, secret, nil
+}
+
+// encrypt encrypts payload for a subscription's keys as an aes128gcm message (RFC 8291):
+// a key agreed between a new key pair of ours and the subscription's key, mixed with its
+// auth secret, encrypts the payload as one record. The message header carries our public
+// key, for the browser to agree the same key.
+func encrypt(payload []byte, p256dh, auth string) ([]byte, error) {
+	uaKey, authSecret, err := subscriptionKeys(p256dh, auth)
+	if err != nil {
+		return nil, err
+	}
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	uaPublic, asPublic := uaKey.Bytes(), asKey.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, shared, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	info := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length and key ID (our public key)
+	message := make([]byte, 0, headerSize+len(payload)+1+gcm.Overhead())
+	message = append(message, salt...)
+	message = binary.BigEndian.AppendUint32(message, recordSize)
+	message = append(message, byte(len(asPublic)))
+	message = append(message, asPublic...)
+	plaintext := append(append([]byte{}, payload...), 0x02) // Delimiter of the last record, without padding
+	return gcm.Seal(message, nonce, plaintext, nil), nil
+}
@@ -0,0 +1,212 @@
+// Package webpush sends Web Push notifications to browsers through their push services
+// (RFC 8030). Payloads are encrypted for the subscription they go to (RFC 8291) and
+// requests are signed with the server's VAPID key (RFC 8292), whose public half browsers
+// subscribe with.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/config"
+	"github.com/kkuzar/blog_system/internal/metrics"
+	"github.com/kkuzar/blog_system/internal/models"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	sendTimeout       = 30 * time.Second
+	vapidTokenTTL     = 12 * time.Hour // Push services refuse tokens valid for more than 24h
+	maxEndpointLength = 2048
+)
+
+var (
+	// ErrGone is returned when the push service no longer knows the subscription: the
+	// user unsubscribed or it expired. It should be deleted.
+	ErrGone = errors.New("push subscription has expired or was removed")
+	// ErrInvalidSubscription is returned for subscriptions that can't be sent to.
+	ErrInvalidSubscription = apperr.New(apperr.Validation, "invalid push subscription")
+	ErrPayloadTooLarge     = errors.New("push payload too large")
+
+	errBlockedAddress = errors.New("address is not public")
+)
+
+var sentNotifications = metrics.Default.Counter("blog_push_notifications_total",
+	"Web Push notifications, by result: sent, gone (the subscription has ended) or failed.", "result")
+
+// Sender sends notifications with the server's VAPID key.
+type Sender struct {
+	key       *ecdsa.PrivateKey
+	publicKey string // Uncompressed point, base64url; what browsers subscribe with
+	subject   string
+	ttl       time.Duration
+	client    *http.Client
+}
+
+// NewSender returns a sender with the configured VAPID key, or nil if Web Push isn't
+// configured.
+func NewSender(cfg *config.PushConfig) (*Sender, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	raw, err := decodeKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID private key is not base64url: %w", err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(public[1:33]), Y: new(big.Int).SetBytes(public[33:])},
+		D:         new(big.Int).SetBytes(raw),
+	}
+
+	// Endpoints come from users, so only public addresses are contacted
+	dialer := &net.Dialer{Timeout: sendTimeout, Control: rejectNonPublic}
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: sendTimeout, ResponseHeaderTimeout: sendTimeout},
+		Timeout:   sendTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Sender{
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		subject:   cfg.VAPIDSubject,
+		ttl:       cfg.TTL,
+		client:    client,
+	}, nil
+}
+
+// GenerateKey returns a new VAPID key pair, base64url-encoded: the private key to
+// configure and the public key browsers will subscribe with.
+func GenerateKey() (privateKey, publicKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// PublicKey returns the VAPID public key, the applicationServerKey browsers subscribe
+// with.
+func (s *Sender) PublicKey() string {
+	return s.publicKey
+}
+
+// CheckSubscription checks that a subscription, as a browser's PushSubscription gives it,
+// can be sent to: an https endpoint and well-formed keys.
+func CheckSubscription(endpoint, p256dh, auth string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || len(endpoint) > maxEndpointLength {
+		return fmt.Errorf("%w: the endpoint must be an https URL", ErrInvalidSubscription)
+	}
+	if _, _, err := subscriptionKeys(p256dh, auth); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	return nil
+}
+
+// Send encrypts payload for sub and hands it to sub's push service, which delivers it
+// when the browser is next online, within the configured TTL. It returns ErrGone if the
+// subscription has ended.
+func (s *Sender) Send(ctx context.Context, sub *models.PushSubscription, payload []byte) error {
+	err := s.send(ctx, sub, payload)
+	switch {
+	case err == nil:
+		sentNotifications.Inc("sent")
+	case errors.Is(err, ErrGone):
+		sentNotifications.Inc("gone")
+	default:
+		sentNotifications.Inc("failed")
+	}
+	return err
+}
+
+func (s *Sender) send(ctx context.Context, sub *models.PushSubscription, payload []byte) error {
+	if len(payload) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	if err := CheckSubscription(sub.Endpoint, sub.P256dh, sub.Auth); err != nil {
+		return err
+	}
+	body, err := encrypt(payload, sub.P256dh, sub.Auth)
+	if err != nil {
+		return err
+	}
+	token, err := s.vapidToken(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.ttl/time.Second)))
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.publicKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	}
+	return fmt.Errorf("push service answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// vapidToken returns a token identifying the server to the push service of endpoint.
+func (s *Sender) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(vapidTokenTTL).Unix(),
+		"sub": s.subject,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(s.key)
+}
+
+// rejectNonPublic is a net.Dialer Control function refusing connections to addresses
+// that aren't on the public internet, after DNS resolution.
+func rejectNonPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errBlockedAddress
+	}
+	return nil
+}
@@ -3,10 +3,17 @@ package websocket
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/logging"
 	"github.com/kkuzar/blog_system/internal/models"
-	"log"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 )
@@ -23,6 +30,13 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 2048 * 1024 // 2MB limit for edits, adjust as needed
+
+	// Messages larger than this are sent as a chunked transfer, so large content doesn't
+	// hold up the write pump in one frame or exceed the client's own message size limit.
+	chunkThreshold = 512 * 1024
+
+	// Bytes of the original message per chunk
+	chunkSize = 256 * 1024
 )
 
 var (
@@ -40,19 +54,70 @@ type Client struct {
 	// Buffered channel of outbound messages.
 	send chan []byte
 
+	// Guards against sending on send once the hub has closed it
+	sendMu     sync.Mutex
+	sendClosed bool
+	transfers  int64 // Chunked transfers started; the last one's ID. Guarded by sendMu
+
 	// User ID associated with this client (set after successful auth)
 	userID string
+	keyID  string // API key the client authenticated with; see auth.KeyID
+
+	// Tenant the connection was opened for ("" without multi-tenancy)
+	tenantID string
+
+	// Request ID of the upgrade request; the IDs of the client's messages extend it
+	connID   string
+	messages atomic.Int64 // Messages received, numbering their request IDs
+
+	// Address the connection was opened from, for rate limits before authentication
+	remoteIP string
 
 	// Is the client authenticated?
 	isAuthenticated bool
 }
 
+// context returns the context of the client's connection, whose log lines carry the
+// upgrade request's ID.
+func (c *Client) context() context.Context {
+	ctx := c.hub.Context()
+	if c.tenantID != "" {
+		ctx = logging.WithTenantID(tenant.WithID(ctx, c.tenantID), c.tenantID)
+	}
+	if c.connID != "" {
+		ctx = logging.WithRequestID(ctx, c.connID)
+	}
+	return ctx
+}
+
+// messageContext returns the context to handle the client's next message in. Its log
+// lines carry a request ID of the message's own, the connection's numbered ("<id>.3"),
+// so everything a message leads to can be found, and traced back to the connection.
+func (c *Client) messageContext() context.Context {
+	ctx := c.context()
+	if c.connID != "" {
+		ctx = logging.WithRequestID(ctx, c.connID+"."+strconv.FormatInt(c.messages.Add(1), 10))
+	}
+	return ctx
+}
+
+// withPayloadItem adds the item a message payload names (its "itemId") to the log fields
+// of ctx.
+func withPayloadItem(ctx context.Context, payload interface{}) context.Context {
+	if fields, ok := payload.(map[string]interface{}); ok {
+		if itemID, ok := fields["itemId"].(string); ok && itemID != "" {
+			return logging.WithItemID(ctx, itemID)
+		}
+	}
+	return ctx
+}
+
 // readPump pumps messages from the websocket connection to the hub's message processor.
 func (c *Client) readPump(handler *WebSocketHandler) {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
-		log.Printf("WebSocket readPump closed for client %s", c.userID)
+		slog.InfoContext(c.context(), "WebSocket readPump closed for client", "userID", c.userID)
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait)) // Initial read deadline
@@ -65,9 +130,9 @@ func (c *Client) readPump(handler *WebSocketHandler) {
 		messageType, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket unexpected close error for client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "WebSocket unexpected close error for client", "userID", c.userID, "error", err)
 			} else {
-				log.Printf("WebSocket read error for client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "WebSocket read error for client", "userID", c.userID, "error", err)
 			}
 			break // Exit loop on error
 		}
@@ -77,7 +142,7 @@ func (c *Client) readPump(handler *WebSocketHandler) {
 
 		// We only process text messages containing JSON
 		if messageType != websocket.TextMessage {
-			log.Printf("Received non-text message type %d from client %s", messageType, c.userID)
+			slog.InfoContext(c.context(), "Received non-text message type from client", "messageType", messageType, "userID", c.userID)
 			continue
 		}
 
@@ -88,13 +153,25 @@ func (c *Client) readPump(handler *WebSocketHandler) {
 	}
 }
 
+// closeSend closes the send channel, making writePump close the connection after writing
+// the queued messages. Later messages are dropped.
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.send)
+	}
+}
+
 // writePump pumps messages from the send channel to the websocket connection.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
-		log.Printf("WebSocket writePump closed for client %s", c.userID)
+		c.hub.pumps.Done()
+		slog.InfoContext(c.context(), "WebSocket writePump closed for client", "userID", c.userID)
 		// No need to unregister here, readPump handles it on error/close
 	}()
 	for {
@@ -103,19 +180,19 @@ func (c *Client) writePump() {
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait)) // Set deadline for this write
 			if !ok {
 				// The hub closed the channel.
-				log.Printf("Client %s send channel closed by hub.", c.userID)
+				slog.InfoContext(c.context(), "Client send channel closed by hub", "userID", c.userID)
 				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
 			w, err := c.conn.NextWriter(websocket.TextMessage)
 			if err != nil {
-				log.Printf("Error getting next writer for client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "Error getting next writer for client", "userID", c.userID, "error", err)
 				return // Exit loop on error
 			}
 			_, err = w.Write(message)
 			if err != nil {
-				log.Printf("Error writing message for client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "Error writing message for client", "userID", c.userID, "error", err)
 				// Don't return immediately, try closing the writer
 			}
 
@@ -128,13 +205,13 @@ func (c *Client) writePump() {
 			// }
 
 			if err := w.Close(); err != nil {
-				log.Printf("Error closing writer for client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "Error closing writer for client", "userID", c.userID, "error", err)
 				return // Exit loop on error
 			}
 		case <-ticker.C:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Error sending ping to client %s: %v", c.userID, err)
+				slog.ErrorContext(c.context(), "Error sending ping to client", "userID", c.userID, "error", err)
 				return // Exit loop on error
 			}
 		}
@@ -144,13 +221,13 @@ func (c *Client) writePump() {
 // sendJSON sends a structured message marshalled as JSON to the client.
 func (c *Client) sendJSON(message interface{}) {
 	if c == nil || c.send == nil {
-		log.Println("Attempted to send JSON to nil client or closed channel")
+		slog.Warn("Attempted to send JSON to nil client or closed channel")
 		return
 	}
 
 	b, err := json.Marshal(message)
 	if err != nil {
-		log.Printf("Error marshalling JSON message for client %s: %v", c.userID, err)
+		slog.ErrorContext(c.context(), "Error marshalling JSON message for client", "userID", c.userID, "error", err)
 		// Send an error message back to the client?
 		errorMsg := models.WebSocketMessage{
 			Action: "error",
@@ -160,23 +237,96 @@ func (c *Client) sendJSON(message interface{}) {
 		}
 		errorBytes, _ := json.Marshal(errorMsg)
 		// Use non-blocking send with select to avoid deadlock if send channel is full
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
+		if c.sendClosed {
+			return
+		}
 		select {
 		case c.send <- errorBytes:
 		default:
-			log.Printf("Send channel full for client %s when trying to send serialization error.", c.userID)
+			slog.WarnContext(c.context(), "Send channel full for client when trying to send serialization error", "userID", c.userID)
 			// Consider closing the connection here via unregister channel
 			// go func() { c.hub.unregister <- c }()
 		}
 		return
 	}
 
+	if len(b) > chunkThreshold {
+		c.sendChunked(message, b)
+		return
+	}
+
 	// Use non-blocking send
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return
+	}
 	select {
 	case c.send <- b:
 		// Message queued successfully
 	default:
-		log.Printf("Send channel full for client %s. Dropping message: %s", c.userID, string(b))
+		slog.WarnContext(c.context(), "Send channel full for client, dropping message", "userID", c.userID, "message", string(b))
 		// Consider closing the connection here
 		// go func() { c.hub.unregister <- c }()
 	}
 }
+
+// sendChunked queues a large marshalled message as "chunk" frames of up to chunkSize
+// bytes, split between UTF-8 characters, and a "chunk_end" frame. Other messages may be
+// sent between the frames. The transfer is queued whole or, if the send channel hasn't
+// room for it, dropped.
+func (c *Client) sendChunked(message interface{}, b []byte) {
+	var action string
+	var seq int64
+	if msg, ok := message.(models.WebSocketMessage); ok {
+		action, seq = msg.Action, msg.Seq
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return
+	}
+	c.transfers++
+	transferID := c.transfers
+
+	var frames [][]byte
+	for start := 0; start < len(b); {
+		end := min(start+chunkSize, len(b))
+		for end < len(b) && !utf8.RuneStart(b[end]) {
+			end--
+		}
+		frame, err := json.Marshal(models.WebSocketMessage{
+			Action:  "chunk",
+			Payload: models.ChunkPayload{TransferID: transferID, Index: len(frames), Data: string(b[start:end])},
+			Seq:     seq,
+		})
+		if err != nil {
+			slog.ErrorContext(c.context(), "Error marshalling chunk for client", "userID", c.userID, "error", err)
+			return
+		}
+		frames = append(frames, frame)
+		start = end
+	}
+	last, err := json.Marshal(models.WebSocketMessage{
+		Action:  "chunk_end",
+		Payload: models.ChunkEndPayload{TransferID: transferID, Action: action, Chunks: len(frames), Size: len(b)},
+		Seq:     seq,
+	})
+	if err != nil {
+		slog.ErrorContext(c.context(), "Error marshalling chunk end for client", "userID", c.userID, "error", err)
+		return
+	}
+	frames = append(frames, last)
+
+	// Only writePump takes from the channel while sendMu is held, so the room can only grow
+	if cap(c.send)-len(c.send) < len(frames) {
+		slog.WarnContext(c.context(), "Send channel full for client, dropping chunked message", "userID", c.userID, "action", action, "size", len(b))
+		return
+	}
+	for _, frame := range frames {
+		c.send <- frame
+	}
+}
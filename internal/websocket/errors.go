@@ -0,0 +1,29 @@
+// internal/websocket/errors.go
+package websocket
+
+import (
+	"context"
+	"github.com/kkuzar/blog_system/internal/apperr"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
+)
+
+// sendError answers the message (action, seq) of client with an error.
+func sendError(client *Client, message string, code apperr.Code, action string, seq int64) {
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "error",
+		Payload: models.ErrorPayload{Message: message, Code: string(code), Action: action, Seq: seq},
+		Seq:     seq,
+	})
+}
+
+// sendServiceError answers the message (action, seq) of client with err's apperr code,
+// as the HTTP API answers it. Internal errors are logged (in the message's ctx) and sent
+// with a generic message.
+func sendServiceError(ctx context.Context, client *Client, err error, action string, seq int64) {
+	code := apperr.CodeOf(err)
+	if code == apperr.Internal {
+		slog.ErrorContext(ctx, "Unhandled service error", "action", action, "seq", seq, "error", err)
+	}
+	sendError(client, apperr.Message(err), code, action, seq)
+}
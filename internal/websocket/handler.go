@@ -5,23 +5,165 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/kkuzar/blog_system/internal/apperr"
 	"github.com/kkuzar/blog_system/internal/auth"
+	"github.com/kkuzar/blog_system/internal/errreport"
+	"github.com/kkuzar/blog_system/internal/logging"
 	"github.com/kkuzar/blog_system/internal/middleware"
 	"github.com/kkuzar/blog_system/internal/models"
 	"github.com/kkuzar/blog_system/internal/service"
-	"log"
+	"github.com/kkuzar/blog_system/internal/tenant"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// ... (upgrader, WebSocketHandler struct, NewWebSocketHandler, HandleConnections remain same) ...
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Allow all origins for now; restrict in production.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocketHandler handles WebSocket connections and routes their messages to the service layer.
+type WebSocketHandler struct {
+	auth      service.AuthService
+	posts     service.PostService
+	codeFiles service.CodeFileService
+	content   service.ContentService
+	history   service.HistoryService
+	usage     service.UsageService
+	hub       *Hub
+	// Pauses the actions in writeActions during maintenance
+	maintenance service.MaintenanceService
+}
+
+func NewWebSocketHandler(s *service.Services, hub *Hub) *WebSocketHandler {
+	return &WebSocketHandler{
+		auth: s.Auth, posts: s.Posts, codeFiles: s.CodeFiles, content: s.Content, history: s.History, usage: s.Usage,
+		maintenance: s.Maintenance, hub: hub,
+	}
+}
+
+// HandleConnections upgrades the HTTP request to a WebSocket connection.
+// Clients can authenticate during the upgrade with an "Authorization: Bearer" header
+// or a one-time "?ticket=" from POST /api/v1/auth/ws-ticket; otherwise they must
+// send an "auth" message after connecting.
+func (h *WebSocketHandler) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	userID, keyID, err := authenticateUpgrade(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "WebSocket upgrade rejected", "remoteAddr", r.RemoteAddr, "error", err)
+		http.Error(w, "Invalid or expired credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.hub.admit() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.hub.pumps.Done()
+		slog.ErrorContext(r.Context(), "WebSocket upgrade error", "error", err)
+		return // Upgrade already wrote an HTTP error response
+	}
+
+	client := &Client{
+		hub:             h.hub,
+		conn:            conn,
+		send:            make(chan []byte, 256),
+		userID:          userID,
+		keyID:           keyID,
+		tenantID:        tenant.ID(r.Context()),
+		connID:          logging.RequestID(r.Context()),
+		remoteIP:        middleware.ClientIP(r),
+		isAuthenticated: userID != "",
+	}
+	h.hub.register <- client
+
+	go client.writePump()
+	go client.readPump(h)
+
+	if client.isAuthenticated {
+		client.sendJSON(models.WebSocketMessage{
+			Action:  "auth_success",
+			Payload: map[string]string{"userId": userID},
+		})
+	}
+	if status := h.maintenance.Maintenance(); status.Enabled {
+		client.sendJSON(models.WebSocketMessage{Action: "maintenance", Payload: status})
+	}
+}
+
+// authenticateUpgrade checks the upgrade request for credentials, returning the user
+// and API key (see auth.KeyID) they are for. It returns an empty user ID (and no error)
+// when none were supplied.
+func authenticateUpgrade(r *http.Request) (string, string, error) {
+	token, validate := r.URL.Query().Get("ticket"), auth.ValidateWSTicket
+	if token == "" {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			return "", "", nil
+		}
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+			return "", "", errors.New("authorization header format must be Bearer {token}")
+		}
+		token, validate = parts[1], auth.ValidateJWT
+	}
+	if err := checkTenant(r, token); err != nil {
+		return "", "", err
+	}
+	userID, err := validate(token)
+	if err != nil {
+		return "", "", err
+	}
+	keyID, _ := auth.KeyID(token)
+	return userID, keyID, nil
+}
+
+// checkTenant rejects tokens issued for another tenant than the request's.
+func checkTenant(r *http.Request, token string) error {
+	tenantID, err := auth.TokenTenant(token)
+	if err != nil {
+		return err
+	}
+	if tenantID != tenant.ID(r.Context()) {
+		return errors.New("token was issued for another tenant")
+	}
+	return nil
+}
+
+// writeActions are the actions that change data, which are answered with a READ_ONLY
+// error in maintenance mode. Reads and subscriptions go on.
+var writeActions = map[string]bool{
+	"apply_changes":   true,
+	"create_post":     true,
+	"create_codefile": true,
+	"delete_item":     true,
+	"revert_action":   true,
+	"revert_to_tag":   true,
+	"create_snapshot": true,
+	"rename_codefile": true,
+	"format_code":     true,
+}
 
 // processMessage routes incoming messages.
 func (h *WebSocketHandler) processMessage(client *Client, message []byte) {
 	var msg models.WebSocketMessage
+	ctx := client.messageContext()
+	defer recoverMessage(ctx, client, &msg)
 	// ... (unmarshal logic) ...
+	ctx = withPayloadItem(ctx, msg.Payload)
+
+	if !h.hub.allowMessage(ctx, client) {
+		sendError(client, "Too many messages, slow down", apperr.RateLimited, msg.Action, msg.Seq)
+		return
+	}
 
 	// log.Printf("Received message: Action=%s, Authenticated=%v, UserID=%s, Seq=%d", msg.Action, client.isAuthenticated, client.userID, msg.Seq)
 
@@ -30,12 +172,36 @@ func (h *WebSocketHandler) processMessage(client *Client, message []byte) {
 		return
 	}
 
+	// --- Share Link Actions ---
+	// Subscribing through a share link needs no account; such clients can only listen.
+	switch msg.Action {
+	case "subscribe_shared":
+		h.handleSubscribeShared(ctx, client, msg.Payload, msg.Seq)
+		return
+	case "unsubscribe":
+		if !client.isAuthenticated {
+			h.handleUnsubscribe(ctx, client, msg.Payload, msg.Seq)
+			return
+		}
+	}
+
 	// --- Authenticated Actions ---
 	if !client.isAuthenticated { /* ... send auth required error ... */
 		return
 	}
 
-	ctx := context.WithValue(context.Background(), middleware.UserIDContextKey, client.userID)
+	ctx = context.WithValue(ctx, middleware.UserIDContextKey, client.userID)
+	ctx = logging.WithAction(logging.WithUserID(ctx, client.userID), msg.Action)
+	if writeActions[msg.Action] {
+		if err := h.maintenance.CheckWritable(); err != nil {
+			sendServiceError(ctx, client, err, msg.Action, msg.Seq)
+			return
+		}
+	}
+	if !h.usage.CountWSMessage(ctx, client.userID, client.keyID) {
+		sendError(client, "Daily message quota exceeded", "QUOTA_EXCEEDED", msg.Action, msg.Seq)
+		return
+	}
 
 	switch msg.Action {
 	case "get_content":
@@ -56,14 +222,52 @@ func (h *WebSocketHandler) processMessage(client *Client, message []byte) {
 		h.handleGetHistory(ctx, client, msg.Payload, msg.Seq)
 	case "revert_action": // Added
 		h.handleRevertAction(ctx, client, msg.Payload, msg.Seq)
+	case "revert_to_tag":
+		h.handleRevertToTag(ctx, client, msg.Payload, msg.Seq)
+	case "create_snapshot":
+		h.handleCreateSnapshot(ctx, client, msg.Payload, msg.Seq)
+	case "get_content_at_version":
+		h.handleGetContentAtVersion(ctx, client, msg.Payload, msg.Seq)
+	case "get_diff":
+		h.handleGetDiff(ctx, client, msg.Payload, msg.Seq)
+	case "get_changes":
+		h.handleGetChanges(ctx, client, msg.Payload, msg.Seq)
+	case "get_content_range":
+		h.handleGetContentRange(ctx, client, msg.Payload, msg.Seq)
+	case "rename_codefile":
+		h.handleRenameCodeFile(ctx, client, msg.Payload, msg.Seq)
+	case "format_code":
+		h.handleFormatCode(ctx, client, msg.Payload, msg.Seq)
+	case "run_code":
+		h.handleRunCode(ctx, client, msg.Payload, msg.Seq)
 	default:
 		// ... (send unknown action error) ...
 	}
 }
 
+// recoverMessage, deferred by processMessage, turns a panic while handling msg (in ctx)
+// into an error reply, so the connection (and its read loop) survives it, and logs and
+// reports it with its stack.
+func recoverMessage(ctx context.Context, client *Client, msg *models.WebSocketMessage) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if client.userID != "" {
+		ctx = logging.WithUserID(ctx, client.userID)
+	}
+	ctx = logging.WithAction(ctx, msg.Action)
+	stack := debug.Stack()
+	slog.ErrorContext(ctx, "Panic processing WebSocket message", "seq", msg.Seq, "panic", p, "stack", string(stack))
+	errreport.Panic(ctx, "Panic processing WebSocket message", p, stack, "seq", msg.Seq)
+	sendError(client, "Internal server error", apperr.Internal, msg.Action, msg.Seq)
+}
+
 // --- Message Handler Implementations ---
 
-// handleGetContent, handleCreatePost, handleCreateCodeFile remain similar (return data in SuccessPayload)
+// handleGetContent, handleCreatePost, handleCreateCodeFile remain similar (return data in SuccessPayload).
+// The create handlers go through CreatePostFromTemplate / CreateCodeFileFromTemplate so
+// a payload's templateId pre-fills the fields it leaves empty.
 
 func (h *WebSocketHandler) handleApplyChanges(ctx context.Context, client *Client, payload interface{}, seq int64) {
 	var req models.IncrementalUpdatePayload
@@ -71,22 +275,59 @@ func (h *WebSocketHandler) handleApplyChanges(ctx context.Context, client *Clien
 	itemType := models.ItemType(req.ItemType) // Get validated type
 
 	userID := middleware.GetUserIDFromContext(ctx)
-	newVersion, appliedChanges, err := h.service.ApplyItemChanges(ctx, userID, req.ItemID, req.ItemType, req.BaseVersion, req.Changes)
+	success := models.ApplyChangesSuccessPayload{
+		ItemID: req.ItemID, ItemType: req.ItemType,
+		Message: "Changes applied successfully",
+	}
+	var newVersion int
+	var appliedChanges []models.Change
+	var err error
+	if req.Merge {
+		var outcome *service.MergeOutcome
+		outcome, err = h.content.MergeItemChanges(ctx, userID, req.ItemID, req.ItemType, req.BaseVersion, req.Changes)
+		if errors.Is(err, service.ErrMergeConflict) {
+			client.sendJSON(models.WebSocketMessage{
+				Action: "merge_conflict",
+				Payload: models.MergeConflictPayload{
+					ItemID: req.ItemID, ItemType: req.ItemType,
+					BaseVersion: req.BaseVersion, CurrentVersion: outcome.CurrentVersion,
+					Content: outcome.Content, Conflicts: outcome.Conflicts,
+				},
+				Seq: seq,
+			})
+			return
+		}
+		if err == nil {
+			newVersion, appliedChanges = outcome.NewVersion, outcome.Changes
+			if outcome.Merged {
+				success.Merged, success.Content = true, outcome.Content
+				success.Message = "Changes merged with newer version"
+			}
+		}
+	} else {
+		newVersion, appliedChanges, err = h.content.ApplyItemChanges(ctx, userID, req.ItemID, req.ItemType, req.BaseVersion, req.Changes)
+	}
+	if errors.Is(err, service.ErrVersionConflict) {
+		h.sendVersionConflict(ctx, client, req.ItemID, req.ItemType, req.BaseVersion, seq)
+		return
+	}
 	if err != nil {
-		// ... (handle service errors, including ErrVersionConflict) ...
+		// ... (handle other service errors) ...
 		return
 	}
 
 	// Send success response to originator
+	success.NewVersion = newVersion
 	client.sendJSON(models.WebSocketMessage{
-		Action: "changes_applied",
-		Payload: models.ApplyChangesSuccessPayload{
-			ItemID: req.ItemID, ItemType: req.ItemType, NewVersion: newVersion,
-			Message: "Changes applied successfully",
-		},
-		Seq: seq,
+		Action:  "changes_applied",
+		Payload: success,
+		Seq:     seq,
 	})
 
+	if len(appliedChanges) == 0 {
+		return // Merge was a no-op; nothing to broadcast
+	}
+
 	// Broadcast the applied changes to other subscribers
 	broadcastPayload := models.BroadcastChangePayload{
 		ItemID:     req.ItemID,
@@ -101,7 +342,7 @@ func (h *WebSocketHandler) handleApplyChanges(ctx context.Context, client *Clien
 	}
 	broadcastBytes, err := json.Marshal(broadcastMsg)
 	if err != nil {
-		log.Printf("ERROR: Failed to marshal broadcast message for %s %s: %v", itemType, req.ItemID, err)
+		slog.ErrorContext(ctx, "Failed to marshal broadcast message", "itemType", itemType, "itemID", req.ItemID, "error", err)
 		return
 	}
 
@@ -112,15 +353,32 @@ func (h *WebSocketHandler) handleApplyChanges(ctx context.Context, client *Clien
 	}
 }
 
+// sendVersionConflict answers apply_changes based on a stale version with a CONFLICT error
+// carrying the server state to rebase the changes on (without it if that fails to load).
+func (h *WebSocketHandler) sendVersionConflict(ctx context.Context, client *Client, itemID, itemType string, baseVersion int, seq int64) {
+	state, err := h.content.VersionConflictState(ctx, middleware.GetUserIDFromContext(ctx), itemID, itemType, baseVersion)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load server state for version conflict", "itemType", itemType, "itemID", itemID, "baseVersion", baseVersion, "error", err)
+	}
+	client.sendJSON(models.WebSocketMessage{
+		Action: "error",
+		Payload: models.ErrorPayload{
+			Message: service.ErrVersionConflict.Error(), Code: string(apperr.Conflict), Action: "apply_changes", Seq: seq,
+			Conflict: state,
+		},
+		Seq: seq,
+	})
+}
+
 func (h *WebSocketHandler) handleDeleteItem(ctx context.Context, client *Client, payload interface{}, seq int64) {
 	var req models.DeleteItemPayload
 	// ... (decode payload, validate itemType) ...
 	itemType := models.ItemType(req.ItemType)
 
 	userID := middleware.GetUserIDFromContext(ctx)
-	err := h.service.DeleteItem(ctx, userID, req.ItemID, req.ItemType)
+	err := h.content.DeleteItem(ctx, userID, req.ItemID, req.ItemType)
 	if err != nil {
-		sendServiceError(client, err, "delete_item", seq)
+		sendServiceError(ctx, client, err, "delete_item", seq)
 		return
 	}
 
@@ -149,6 +407,132 @@ func (h *WebSocketHandler) handleDeleteItem(ctx context.Context, client *Client,
 		Message:    broadcastBytes,
 		Originator: client, // Can be nil if originator doesn't matter for delete broadcast
 	}
+	h.hub.DropSharedSubscribers(itemType, req.ItemID) // Its share links no longer open it
+}
+
+func (h *WebSocketHandler) handleRenameCodeFile(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.RenameCodeFilePayload
+	if !decodePayload(payload, &req, client, "rename_codefile", seq) {
+		return
+	}
+	if req.ItemID == "" || req.Path == "" {
+		sendError(client, "itemId and path are required", apperr.Validation, "rename_codefile", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	file, err := h.codeFiles.RenameCodeFile(ctx, userID, req.ItemID, req.Path)
+	if err != nil {
+		sendServiceError(ctx, client, err, "rename_codefile", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "codefile_renamed",
+		Payload: file,
+		Seq:     seq,
+	})
+
+	// Broadcast the new name to other subscribers
+	broadcastPayload := models.BroadcastRenamePayload{
+		ItemID: req.ItemID, ItemType: string(models.ItemTypeCodeFile),
+		FileName: file.FileName, Path: file.Path, Originator: userID,
+	}
+	broadcastMsg := models.WebSocketMessage{
+		Action:  "item_renamed",
+		Payload: broadcastPayload,
+	}
+	broadcastBytes, err := json.Marshal(broadcastMsg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal rename broadcast for codefile", "itemID", req.ItemID, "error", err)
+		return
+	}
+
+	h.hub.broadcastToItem <- &ItemBroadcast{
+		ItemID:     getItemSubKey(models.ItemTypeCodeFile, req.ItemID),
+		Message:    broadcastBytes,
+		Originator: client,
+	}
+}
+
+func (h *WebSocketHandler) handleFormatCode(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.FormatCodePayload
+	if !decodePayload(payload, &req, client, "format_code", seq) {
+		return
+	}
+	if req.ItemID == "" {
+		sendError(client, "itemId is required", apperr.Validation, "format_code", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	newVersion, changes, err := h.codeFiles.FormatCodeFile(ctx, userID, req.ItemID, req.BaseVersion)
+	if err != nil {
+		sendServiceError(ctx, client, err, "format_code", seq)
+		return
+	}
+
+	message := "File is already formatted"
+	if len(changes) > 0 {
+		message = "File formatted"
+	}
+	client.sendJSON(models.WebSocketMessage{
+		Action: "changes_applied",
+		Payload: models.ApplyChangesSuccessPayload{
+			ItemID: req.ItemID, ItemType: string(models.ItemTypeCodeFile),
+			NewVersion: newVersion, Message: message,
+		},
+		Seq: seq,
+	})
+	if len(changes) == 0 {
+		return
+	}
+
+	// The originator has to apply the changes too, unlike after apply_changes
+	broadcastMsg := models.WebSocketMessage{
+		Action: "content_changed",
+		Payload: models.BroadcastChangePayload{
+			ItemID: req.ItemID, ItemType: string(models.ItemTypeCodeFile),
+			Changes: changes, NewVersion: newVersion, Originator: userID,
+		},
+	}
+	broadcastBytes, err := json.Marshal(broadcastMsg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal format broadcast for codefile", "itemID", req.ItemID, "error", err)
+		return
+	}
+	h.hub.broadcastToItem <- &ItemBroadcast{
+		ItemID:  getItemSubKey(models.ItemTypeCodeFile, req.ItemID),
+		Message: broadcastBytes,
+	}
+}
+
+func (h *WebSocketHandler) handleRunCode(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.RunCodePayload
+	if !decodePayload(payload, &req, client, "run_code", seq) {
+		return
+	}
+	if req.ItemID == "" {
+		sendError(client, "itemId is required", apperr.Validation, "run_code", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	result, err := h.codeFiles.RunCodeFile(ctx, userID, req.ItemID, req.Stdin)
+	if err != nil {
+		sendServiceError(ctx, client, err, "run_code", seq)
+		return
+	}
+
+	// Only the requester sees the output
+	client.sendJSON(models.WebSocketMessage{
+		Action: "run_result",
+		Payload: map[string]interface{}{
+			"itemId": req.ItemID,
+			"result": result,
+		},
+		Seq: seq,
+	})
 }
 
 // --- New Handlers ---
@@ -163,9 +547,11 @@ func (h *WebSocketHandler) handleSubscribe(ctx context.Context, client *Client,
 		return
 	}
 
-	// Optional: Verify user has permission to view/subscribe to this item
-	// _, err := h.service.GetItemContent(ctx, client.userID, req.ItemID, req.ItemType) // Reuses permission check
-	// if err != nil { sendServiceError(client, err, "subscribe", seq); return }
+	// Only the owner and collaborators may follow an item's changes
+	if err := h.auth.CheckItemAccess(ctx, client.userID, req.ItemID, req.ItemType, models.RoleViewer); err != nil {
+		sendServiceError(ctx, client, err, "subscribe", seq)
+		return
+	}
 
 	subKey := getItemSubKey(itemType, req.ItemID)
 	h.hub.subscribe <- &SubscriptionRequest{client: client, itemID: subKey}
@@ -178,6 +564,31 @@ func (h *WebSocketHandler) handleSubscribe(ctx context.Context, client *Client,
 	})
 }
 
+// handleSubscribeShared subscribes a client to an item's changes using a share token
+// instead of its own permissions. The subscription only delivers broadcasts, and ends
+// when the link expires or is revoked, or the item is deleted or changes owner.
+func (h *WebSocketHandler) handleSubscribeShared(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.SubscribeSharedPayload
+	if !decodePayload(payload, &req, client, "subscribe_shared", seq) {
+		return
+	}
+
+	claims, err := h.auth.ResolveShareToken(ctx, req.Token)
+	if err != nil {
+		sendServiceError(ctx, client, err, "subscribe_shared", seq)
+		return
+	}
+
+	subKey := getItemSubKey(models.ItemType(claims.ItemType), claims.ItemID)
+	h.hub.subscribe <- &SubscriptionRequest{client: client, itemID: subKey, linkID: claims.LinkID, expiresAt: claims.ExpiresAt}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "subscribe_success",
+		Payload: map[string]string{"itemId": claims.ItemID, "itemType": claims.ItemType, "access": claims.Access},
+		Seq:     seq,
+	})
+}
+
 func (h *WebSocketHandler) handleUnsubscribe(ctx context.Context, client *Client, payload interface{}, seq int64) {
 	var req models.UnsubscribePayload
 	if !decodePayload(payload, &req, client, "unsubscribe", seq) {
@@ -215,9 +626,9 @@ func (h *WebSocketHandler) handleGetHistory(ctx context.Context, client *Client,
 		limit = 50
 	} // Default limit
 
-	history, err := h.service.GetHistory(ctx, userID, req.ItemID, req.ItemType, limit)
+	history, err := h.history.GetHistory(ctx, userID, req.ItemID, req.ItemType, limit)
 	if err != nil {
-		sendServiceError(client, err, "get_history", seq)
+		sendServiceError(ctx, client, err, "get_history", seq)
 		return
 	}
 
@@ -238,21 +649,21 @@ func (h *WebSocketHandler) handleRevertAction(ctx context.Context, client *Clien
 	}
 
 	userID := middleware.GetUserIDFromContext(ctx)
-	newVersion, err := h.service.RevertToAction(ctx, userID, req.TargetLogID)
+	newVersion, err := h.history.RevertToAction(ctx, userID, req.TargetLogID)
 	if err != nil {
-		sendServiceError(client, err, "revert_action", seq)
+		sendServiceError(ctx, client, err, "revert_action", seq)
 		return
 	}
 
 	// Fetch the latest content and metadata after revert to send back
-	targetLog, _ := h.service.GetHistoryLogByID(ctx, req.TargetLogID) // Assume service checked ownership
+	targetLog, _ := h.history.GetHistoryLogByID(ctx, req.TargetLogID) // Assume service checked ownership
 	var itemID, itemTypeStr string
 	if targetLog != nil {
 		itemID = targetLog.ItemID
 		itemTypeStr = targetLog.ItemType
 	} else {
 		// This shouldn't happen if revert succeeded, but handle defensively
-		sendError(client, "Internal error after revert", "INTERNAL_ERROR", "revert_action", seq)
+		sendError(client, "Internal error after revert", apperr.Internal, "revert_action", seq)
 		return
 	}
 
@@ -274,4 +685,173 @@ func (h *WebSocketHandler) handleRevertAction(ctx context.Context, client *Clien
 	// For now, other clients won't know about the revert until they refresh/resubscribe.
 }
 
-// --- Helper Functions (decodePayload, sendError, sendServiceError) remain similar ---
+func (h *WebSocketHandler) handleRevertToTag(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.RevertToTagPayload
+	if !decodePayload(payload, &req, client, "revert_to_tag", seq) {
+		return
+	}
+	if req.ItemID == "" || req.ItemType == "" || req.Tag == "" {
+		sendError(client, "itemId, itemType and tag are required", apperr.Validation, "revert_to_tag", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	newVersion, err := h.history.RevertToTag(ctx, userID, req.ItemID, req.ItemType, req.Tag)
+	if err != nil {
+		sendServiceError(ctx, client, err, "revert_to_tag", seq)
+		return
+	}
+
+	// Same reply as revert_action
+	client.sendJSON(models.WebSocketMessage{
+		Action: "revert_success",
+		Payload: map[string]interface{}{
+			"message":    fmt.Sprintf("Successfully reverted item %s to tag %q", req.ItemID, req.Tag),
+			"itemId":     req.ItemID,
+			"itemType":   req.ItemType,
+			"newVersion": newVersion,
+		},
+		Seq: seq,
+	})
+}
+
+func (h *WebSocketHandler) handleCreateSnapshot(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.CreateSnapshotPayload
+	if !decodePayload(payload, &req, client, "create_snapshot", seq) {
+		return
+	}
+	if req.ItemID == "" || req.ItemType == "" {
+		sendError(client, "itemId and itemType are required", apperr.Validation, "create_snapshot", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	snapshot, err := h.history.CreateSnapshot(ctx, userID, req.ItemID, req.ItemType, req.Label)
+	if err != nil {
+		sendServiceError(ctx, client, err, "create_snapshot", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "snapshot_created",
+		Payload: snapshot,
+		Seq:     seq,
+	})
+
+	// Let other subscribers know a checkpoint exists
+	broadcastPayload := models.BroadcastSnapshotPayload{
+		ItemID: req.ItemID, ItemType: req.ItemType, LogID: snapshot.ID,
+		Version: snapshot.ItemVersion, Label: snapshot.Label, Originator: userID,
+	}
+	broadcastMsg := models.WebSocketMessage{
+		Action:  "item_snapshotted",
+		Payload: broadcastPayload,
+	}
+	broadcastBytes, err := json.Marshal(broadcastMsg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal snapshot broadcast", "itemType", req.ItemType, "itemID", req.ItemID, "error", err)
+		return
+	}
+
+	h.hub.broadcastToItem <- &ItemBroadcast{
+		ItemID:     getItemSubKey(models.ItemType(req.ItemType), req.ItemID),
+		Message:    broadcastBytes,
+		Originator: client,
+	}
+}
+
+func (h *WebSocketHandler) handleGetContentAtVersion(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.GetVersionPayload
+	if !decodePayload(payload, &req, client, "get_content_at_version", seq) {
+		return
+	}
+	if req.Version < 1 {
+		sendError(client, "version must be a positive integer", apperr.Validation, "get_content_at_version", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	content, err := h.content.GetItemContentAtVersion(ctx, userID, req.ItemID, req.ItemType, req.Version)
+	if err != nil {
+		sendServiceError(ctx, client, err, "get_content_at_version", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action: "version_content",
+		Payload: models.ContentResponsePayload{
+			ItemID: req.ItemID, ItemType: req.ItemType, Content: content, Version: req.Version,
+		},
+		Seq: seq,
+	})
+}
+
+func (h *WebSocketHandler) handleGetChanges(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.GetChangesPayload
+	if !decodePayload(payload, &req, client, "get_changes", seq) {
+		return
+	}
+	if req.SinceVersion < 1 {
+		sendError(client, "sinceVersion must be a positive integer", apperr.Validation, "get_changes", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	result, err := h.content.GetChangesSince(ctx, userID, req.ItemID, req.ItemType, req.SinceVersion)
+	if err != nil {
+		sendServiceError(ctx, client, err, "get_changes", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "changes_since",
+		Payload: result,
+		Seq:     seq,
+	})
+}
+
+func (h *WebSocketHandler) handleGetContentRange(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.GetContentRangePayload
+	if !decodePayload(payload, &req, client, "get_content_range", seq) {
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	result, err := h.content.GetItemContentRange(ctx, userID, req.ItemID, req.ItemType, req)
+	if err != nil {
+		sendServiceError(ctx, client, err, "get_content_range", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "content_range",
+		Payload: result,
+		Seq:     seq,
+	})
+}
+
+func (h *WebSocketHandler) handleGetDiff(ctx context.Context, client *Client, payload interface{}, seq int64) {
+	var req models.GetDiffPayload
+	if !decodePayload(payload, &req, client, "get_diff", seq) {
+		return
+	}
+	if req.FromVersion < 1 || req.ToVersion < 0 {
+		sendError(client, "fromVersion must be a positive integer", apperr.Validation, "get_diff", seq)
+		return
+	}
+
+	userID := middleware.GetUserIDFromContext(ctx)
+	result, err := h.content.DiffItemVersions(ctx, userID, req.ItemID, req.ItemType, req.FromVersion, req.ToVersion)
+	if err != nil {
+		sendServiceError(ctx, client, err, "get_diff", seq)
+		return
+	}
+
+	client.sendJSON(models.WebSocketMessage{
+		Action:  "diff_data",
+		Payload: result,
+		Seq:     seq,
+	})
+}
+
+// --- Helper Functions (decodePayload) remain similar ---
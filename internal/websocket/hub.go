@@ -2,8 +2,13 @@
 package websocket
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"github.com/kkuzar/blog_system/internal/cache"
+	"github.com/kkuzar/blog_system/internal/models"
+	"log/slog"
 	"sync"
+	"time"
 )
 
 // Hub maintains the set of active clients and broadcasts messages.
@@ -20,41 +25,192 @@ type Hub struct {
 	// Unregister requests from clients.
 	unregister chan *Client
 
+	// Item subscriptions, by item (see getItemSubKey), then client. Only Run touches them.
+	subscriptions   map[string]map[*Client]*subscription
+	subscribe       chan *SubscriptionRequest
+	unsubscribe     chan *SubscriptionRequest
+	broadcastToItem chan *ItemBroadcast
+	dropShared      chan shareDrop
+
 	// Mutex for thread-safe access to clients map when modifying outside run loop
 	mu sync.RWMutex
+
+	// Shutdown state: no new connections once closed; pumps counts the connections whose
+	// queued messages are still being written.
+	closed bool
+	pumps  sync.WaitGroup
+	stop   chan chan struct{}
+
+	// Context of the clients' requests, cancelled on Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Limits how fast clients send messages; nil for no limit. See UseRateLimiter.
+	limiter      cache.RateLimiter
+	messageLimit func() cache.RateLimit
 }
 
 func NewHub() *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Hub{
 		broadcast:  make(chan []byte), // Consider buffering?
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
+		stop:       make(chan chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+
+		subscriptions:   make(map[string]map[*Client]*subscription),
+		subscribe:       make(chan *SubscriptionRequest),
+		unsubscribe:     make(chan *SubscriptionRequest),
+		broadcastToItem: make(chan *ItemBroadcast),
+		dropShared:      make(chan shareDrop),
+	}
+}
+
+// SubscriptionRequest subscribes a client to an item's broadcasts, or unsubscribes it.
+// A subscription made through a share link carries the link's ID and expiry, so it ends
+// with the link.
+type SubscriptionRequest struct {
+	client    *Client
+	itemID    string // See getItemSubKey
+	linkID    string
+	expiresAt *time.Time
+}
+
+// ItemBroadcast is a message for the subscribers of an item, other than Originator (the
+// client whose action it reports, if any).
+type ItemBroadcast struct {
+	ItemID     string // See getItemSubKey
+	Message    []byte
+	Originator *Client
+}
+
+// subscription is how a client follows an item: with its own access, or through the
+// share link linkID until expiresAt (nil if the link never expires).
+type subscription struct {
+	linkID    string
+	expiresAt *time.Time
+}
+
+func (s *subscription) expired(now time.Time) bool {
+	return s.expiresAt != nil && !now.Before(*s.expiresAt)
+}
+
+// shareDrop ends the subscriptions made through the share link linkID, or if itemID is
+// set, through any share link of that item.
+type shareDrop struct {
+	linkID string
+	itemID string // See getItemSubKey
+}
+
+// getItemSubKey returns the key of an item's subscribers.
+func getItemSubKey(itemType models.ItemType, itemID string) string {
+	return string(itemType) + ":" + itemID
+}
+
+// Context returns the context WebSocket messages are handled in. It's cancelled when
+// the hub shuts down.
+func (h *Hub) Context() context.Context {
+	return h.ctx
+}
+
+// UseRateLimiter limits how fast each user, or each client address before it
+// authenticates, may send messages, to what limit returns at the time. Call it before
+// serving connections.
+func (h *Hub) UseRateLimiter(limiter cache.RateLimiter, limit func() cache.RateLimit) {
+	h.limiter, h.messageLimit = limiter, limit
+}
+
+// allowMessage reports whether client may send another message now. Messages are let
+// through if the limiter fails.
+func (h *Hub) allowMessage(ctx context.Context, client *Client) bool {
+	if h.limiter == nil {
+		return true
+	}
+	key := "ws:addr:" + client.remoteIP
+	if client.userID != "" {
+		key = "ws:user:" + client.userID
+	}
+	allowed, _, err := h.limiter.Allow(ctx, key, h.messageLimit())
+	if err != nil {
+		slog.WarnContext(ctx, "Rate limiter failed, allowing WebSocket message", "error", err)
+		return true
+	}
+	return allowed
+}
+
+// admit reserves a place for a new connection, or returns false once the hub is shutting
+// down. An admitted connection must be registered or released with pumps.Done.
+func (h *Hub) admit() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.pumps.Add(1)
+	return true
+}
+
+// Shutdown refuses new connections, cancels the hub's context and closes the open
+// connections once the messages queued for them are written. It waits for that until ctx
+// is done. Messages sent after Shutdown are dropped.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.cancel()
+
+	stopped := make(chan struct{})
+	select {
+	case h.stop <- stopped:
+		<-stopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 // Run starts the hub's event loop in a separate goroutine.
 func (h *Hub) Run() {
-	log.Println("WebSocket Hub started")
+	slog.Info("WebSocket Hub started")
+	stopped := false
 	for {
 		select {
 		case client := <-h.register:
+			if stopped { // Admitted just before Shutdown
+				client.closeSend()
+				continue
+			}
 			h.mu.Lock()
 			h.clients[client] = true
-			log.Printf("Client registered: %s (Total: %d)", client.userID, len(h.clients))
+			slog.InfoContext(client.context(), "Client registered", "userID", client.userID, "clients", len(h.clients))
 			h.mu.Unlock()
 		case client := <-h.unregister:
+			h.removeSubscriptions(client)
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send) // Close the send channel for this client
-				log.Printf("Client unregistered: %s (Total: %d)", client.userID, len(h.clients))
+				client.closeSend() // Close the send channel for this client
+				slog.InfoContext(client.context(), "Client unregistered", "userID", client.userID, "clients", len(h.clients))
 			}
 			h.mu.Unlock()
 		case message := <-h.broadcast:
 			// This broadcasts to ALL clients. Might need more targeted messaging.
 			h.mu.RLock()
-			log.Printf("Broadcasting message to %d clients", len(h.clients))
+			slog.Debug("Broadcasting message to clients", "clients", len(h.clients))
 			for client := range h.clients {
 				select {
 				case client.send <- message:
@@ -62,12 +218,101 @@ func (h *Hub) Run() {
 				default:
 					// Send buffer is full, client might be slow or disconnected.
 					// Close the connection and unregister the client.
-					log.Printf("Client %s send buffer full, closing connection.", client.userID)
+					slog.WarnContext(client.context(), "Client send buffer full, closing connection", "userID", client.userID)
 					// Need to unregister outside the read lock
 					go func(c *Client) { h.unregister <- c }(client)
 				}
 			}
 			h.mu.RUnlock()
+		case req := <-h.subscribe:
+			if stopped {
+				continue
+			}
+			subscribers := h.subscriptions[req.itemID]
+			if subscribers == nil {
+				subscribers = make(map[*Client]*subscription)
+				h.subscriptions[req.itemID] = subscribers
+			}
+			subscribers[req.client] = &subscription{linkID: req.linkID, expiresAt: req.expiresAt}
+		case req := <-h.unsubscribe:
+			if subscribers := h.subscriptions[req.itemID]; subscribers != nil {
+				delete(subscribers, req.client)
+				if len(subscribers) == 0 {
+					delete(h.subscriptions, req.itemID)
+				}
+			}
+		case b := <-h.broadcastToItem:
+			h.sendToSubscribers(b)
+		case drop := <-h.dropShared:
+			h.dropSharedSubscriptions(drop)
+		case done := <-h.stop:
+			// Closing the send channels makes each writePump flush what's queued, then
+			// send a close frame. The loop keeps running to take the unregistrations.
+			stopped = true
+			clear(h.subscriptions)
+			h.mu.Lock()
+			for client := range h.clients {
+				delete(h.clients, client)
+				client.closeSend()
+			}
+			slog.Info("WebSocket Hub stopped, closing client connections")
+			h.mu.Unlock()
+			close(done)
+		}
+	}
+}
+
+// sendToSubscribers sends b to the item's subscribers, first dropping those whose share
+// link expired.
+func (h *Hub) sendToSubscribers(b *ItemBroadcast) {
+	subscribers := h.subscriptions[b.ItemID]
+	now := time.Now()
+	for client, sub := range subscribers {
+		if sub.expired(now) {
+			delete(subscribers, client)
+			slog.InfoContext(client.context(), "Share link expired, subscription ended", "item", b.ItemID, "linkID", sub.linkID)
+			continue
+		}
+		if client == b.Originator {
+			continue
+		}
+		select {
+		case client.send <- b.Message:
+		default:
+			slog.WarnContext(client.context(), "Client send buffer full, closing connection", "userID", client.userID)
+			go func(c *Client) { h.unregister <- c }(client)
+		}
+	}
+	if len(subscribers) == 0 {
+		delete(h.subscriptions, b.ItemID)
+	}
+}
+
+// dropSharedSubscriptions ends the share link subscriptions drop names.
+func (h *Hub) dropSharedSubscriptions(drop shareDrop) {
+	for itemID, subscribers := range h.subscriptions {
+		if drop.itemID != "" && itemID != drop.itemID {
+			continue
+		}
+		for client, sub := range subscribers {
+			if sub.linkID != "" && (drop.itemID != "" || sub.linkID == drop.linkID) {
+				delete(subscribers, client)
+			}
+		}
+		if len(subscribers) == 0 {
+			delete(h.subscriptions, itemID)
+		}
+	}
+}
+
+// removeSubscriptions drops all of a disconnecting client's subscriptions.
+func (h *Hub) removeSubscriptions(client *Client) {
+	for itemID, subscribers := range h.subscriptions {
+		if _, ok := subscribers[client]; ok {
+			delete(subscribers, client)
+			if len(subscribers) == 0 {
+				delete(h.subscriptions, itemID)
+			}
 		}
 	}
 }
@@ -79,4 +324,39 @@ func (h *Hub) GetClientCount() int {
 	return len(h.clients)
 }
 
+// BroadcastToAll sends msg to every connected client, e.g. an admin's announcement.
+func (h *Hub) BroadcastToAll(msg models.WebSocketMessage) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	h.broadcast <- msgBytes
+	return nil
+}
+
+// BroadcastToItem sends msg to every client subscribed to the item. It lets code outside
+// the WebSocket handler (e.g. the REST API) notify subscribers of changes.
+func (h *Hub) BroadcastToItem(itemType models.ItemType, itemID string, msg models.WebSocketMessage) error {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	h.broadcastToItem <- &ItemBroadcast{
+		ItemID:  getItemSubKey(itemType, itemID),
+		Message: msgBytes,
+	}
+	return nil
+}
+
+// DropShareLink ends the subscriptions made through a share link, e.g. once it is revoked.
+func (h *Hub) DropShareLink(linkID string) {
+	h.dropShared <- shareDrop{linkID: linkID}
+}
+
+// DropSharedSubscribers ends the subscriptions made through any share link of an item,
+// e.g. once it is deleted or changes owner, which invalidates its links.
+func (h *Hub) DropSharedSubscribers(itemType models.ItemType, itemID string) {
+	h.dropShared <- shareDrop{itemID: getItemSubKey(itemType, itemID)}
+}
+
 // Add specific broadcast methods if needed, e.g., BroadcastToUser(userID string, message []byte)
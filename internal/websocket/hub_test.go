@@ -0,0 +1,80 @@
+// internal/websocket/hub_test.go
+package websocket
+
+import (
+	"github.com/kkuzar/blog_system/internal/models"
+	"testing"
+	"time"
+)
+
+func newTestClient(h *Hub) *Client {
+	client := &Client{hub: h, send: make(chan []byte, 16)}
+	h.register <- client
+	return client
+}
+
+func receive(t *testing.T, client *Client) []byte {
+	t.Helper()
+	select {
+	case msg := <-client.send:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestRevokedShareLinkStopsBroadcasts(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+	defer h.Shutdown(t.Context())
+
+	subKey := getItemSubKey(models.ItemTypePost, "post-1")
+	shared := newTestClient(h)
+	owner := newTestClient(h)
+	h.subscribe <- &SubscriptionRequest{client: shared, itemID: subKey, linkID: "link-1"}
+	h.subscribe <- &SubscriptionRequest{client: owner, itemID: subKey}
+
+	msg := models.WebSocketMessage{Action: "content_changed"}
+	if err := h.BroadcastToItem(models.ItemTypePost, "post-1", msg); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, shared)
+	receive(t, owner)
+
+	h.DropShareLink("link-1")
+	if err := h.BroadcastToItem(models.ItemTypePost, "post-1", msg); err != nil {
+		t.Fatal(err)
+	}
+	// The hub handles a broadcast for all subscribers at once, so once the owner has it
+	// the shared client would have too
+	receive(t, owner)
+	select {
+	case <-shared.send:
+		t.Fatal("revoked share link subscriber received a broadcast")
+	default:
+	}
+}
+
+func TestExpiredShareLinkStopsBroadcasts(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+	defer h.Shutdown(t.Context())
+
+	subKey := getItemSubKey(models.ItemTypeCodeFile, "file-1")
+	expired := time.Now().Add(-time.Minute)
+	shared := newTestClient(h)
+	owner := newTestClient(h)
+	h.subscribe <- &SubscriptionRequest{client: shared, itemID: subKey, linkID: "link-1", expiresAt: &expired}
+	h.subscribe <- &SubscriptionRequest{client: owner, itemID: subKey}
+
+	if err := h.BroadcastToItem(models.ItemTypeCodeFile, "file-1", models.WebSocketMessage{Action: "content_changed"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, owner)
+	select {
+	case <-shared.send:
+		t.Fatal("expired share link subscriber received a broadcast")
+	default:
+	}
+}